@@ -0,0 +1,109 @@
+// Command backup snapshots all KV buckets of the network into a tarball and
+// restores them. It uses the same environment configuration as the proxy.
+//
+//	backup create network.tar.gz
+//	backup restore -buckets network_whitelist -prune -dry-run network.tar.gz
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/backup"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("usage: %s create|restore [flags] <file>", os.Args[0])
+	}
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "create":
+		create(ctx, os.Args[2:])
+	case "restore":
+		restore(ctx, os.Args[2:])
+	default:
+		log.Fatalf("unknown command %s", os.Args[1])
+	}
+}
+
+func create(ctx context.Context, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("usage: %s create <file>", os.Args[0])
+	}
+
+	h, err := hosting.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := h.Backup(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fd, err := os.Create(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fd.Close()
+
+	if err := s.Write(fd); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Wrote %d buckets to %s", len(s.Data), args[0])
+}
+
+func restore(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	buckets := flags.String("buckets", "", "comma separated buckets to restore, all if empty")
+	prune := flags.Bool("prune", false, "delete keys that are not in the backup")
+	dryRun := flags.Bool("dry-run", false, "only print what would change")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalf("usage: %s restore [flags] <file>", os.Args[0])
+	}
+
+	fd, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fd.Close()
+
+	s, err := backup.Read(fd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Backup of %s taken at %s", s.Manifest.Pod, s.Manifest.CreatedAt)
+
+	h, err := hosting.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := backup.RestoreOptions{Prune: *prune, DryRun: *dryRun}
+	if *buckets != "" {
+		opts.Buckets = strings.Split(*buckets, ",")
+	}
+
+	diff, err := h.Restore(ctx, "cli", s, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diff); err != nil {
+		log.Fatal(err)
+	}
+}
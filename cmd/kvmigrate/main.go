@@ -0,0 +1,77 @@
+// Command kvmigrate copies every bucket from the KV backend configured in the
+// environment (KV_BACKEND, KV_BACKEND_OPTIONS, STORAGE_*) to another backend.
+//
+//	kvmigrate -to sql -to-options '{"driver":"postgres","dsn":"postgres://..."}'
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+)
+
+func main() {
+	to := flag.String("to", "", "destination KV backend (nats, json, sql)")
+	toOptions := flag.String("to-options", "{}", "destination KV backend options as JSON")
+	dryRun := flag.Bool("dry-run", false, "only print what would be copied")
+	flag.Parse()
+
+	if *to == "" {
+		log.Fatal("-to is required")
+	}
+
+	ctx := context.Background()
+
+	h, err := hosting.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dst, err := hosting.NewKVClient(*to, *toOptions, h.Storage())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	buckets, err := h.KV().ListBuckets(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, name := range buckets {
+		src, err := h.KV().Bucket(ctx, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		keys, err := src.ListKeys(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Copying %d keys of bucket %s", len(keys), name)
+
+		if *dryRun {
+			continue
+		}
+
+		b, err := dst.Bucket(ctx, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, key := range keys {
+			v, err := src.Get(ctx, key)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := b.Set(ctx, key, v); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	log.Printf("Migrated %d buckets", len(buckets))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/protocol"
+)
+
+type config struct {
+	addr           string
+	opts           protocol.Options
+	timeout        time.Duration
+	chatInterval   time.Duration
+	servers        []string
+	switchInterval time.Duration
+}
+
+// bot is an offline player that stays online, chats and switches servers
+// until ctx is done or it is disconnected.
+type bot struct {
+	name  string
+	cfg   *config
+	stats *stats
+	c     *protocol.Client
+
+	// pending chat messages by their text, to measure the echo
+	pending map[string]time.Time
+	m       sync.Mutex
+}
+
+func (b *bot) run(ctx context.Context) error {
+	start := time.Now()
+
+	opts := b.cfg.opts
+	opts.OnChat = b.echo
+
+	c, err := protocol.Connect(ctx, b.cfg.addr, b.name, opts)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	b.c = c
+
+	// Unblocks the waits when the test ends
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.Close()
+	})
+	defer stop()
+
+	if err := c.WaitJoin(b.cfg.timeout); err != nil {
+		return err
+	}
+
+	b.stats.record("login", time.Since(start))
+
+	b.stats.join(1)
+	defer b.stats.join(-1)
+
+	return b.act(ctx)
+}
+
+// echo records the latency of pending chat messages found in a packet. The
+// text shows up unchanged in both player and system chat packets.
+func (b *bot) echo(data []byte) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for text, sent := range b.pending {
+		if bytes.Contains(data, []byte(text)) {
+			b.stats.record("chat", time.Since(sent))
+			delete(b.pending, text)
+		}
+	}
+}
+
+func (b *bot) act(ctx context.Context) error {
+	never := make(<-chan time.Time)
+
+	chat := never
+	if b.cfg.chatInterval > 0 {
+		t := time.NewTicker(jitter(b.cfg.chatInterval))
+		defer t.Stop()
+		chat = t.C
+	}
+
+	switches := never
+	if len(b.cfg.servers) > 0 && b.cfg.switchInterval > 0 {
+		t := time.NewTicker(jitter(b.cfg.switchInterval))
+		defer t.Stop()
+		switches = t.C
+	}
+
+	seq, next := 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.c.Done():
+			return b.c.Err()
+		case <-chat:
+			b.expire()
+
+			seq++
+			if err := b.chat(fmt.Sprintf("%s says hello #%d", b.name, seq)); err != nil {
+				return err
+			}
+		case <-switches:
+			server := b.cfg.servers[next%len(b.cfg.servers)]
+			next++
+
+			if err := b.switchTo(server); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// jitter spreads the bots' actions so they don't all chat at once.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d)
+}
+
+// expire counts echoes that never came as errors.
+func (b *bot) expire() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for text, sent := range b.pending {
+		if time.Since(sent) > b.cfg.timeout {
+			b.stats.fail("chat", errors.New("no echo"))
+			delete(b.pending, text)
+		}
+	}
+}
+
+func (b *bot) chat(text string) error {
+	b.m.Lock()
+	b.pending[text] = time.Now()
+	b.m.Unlock()
+
+	return b.c.Chat(text)
+}
+
+func (b *bot) switchTo(server string) error {
+	b.c.DropJoin()
+
+	start := time.Now()
+	if err := b.c.Command("server " + server); err != nil {
+		return err
+	}
+
+	err := b.c.WaitJoin(b.cfg.timeout)
+
+	select {
+	case <-b.c.Done():
+		return b.c.Err()
+	default:
+	}
+
+	if err != nil {
+		b.stats.fail("switch", errors.New("timed out switching to "+strconv.Quote(server)))
+		return nil
+	}
+
+	b.stats.record("switch", time.Since(start))
+
+	return nil
+}
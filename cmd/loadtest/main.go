@@ -0,0 +1,278 @@
+// Command loadtest runs simulated players against a proxy and reports the
+// latency and errors of status pings, logins, chat and server switches, to
+// catch performance regressions before a deploy.
+//
+//	loadtest [-addr 127.0.0.1:25566] [-clients 100] [-pingers 10] [-duration 1m] [-servers lobby,survival] <flags>
+//
+// The bots join in offline mode, so -addr must be a listener with
+// "offline":true and the bots need offline accounts. -register adds them
+// through the admin API (-api, -token, defaulting to PROXYCTL_ADDR and
+// PROXYCTL_TOKEN) and removes them afterwards. The bots speak 1.21
+// (protocol 767).
+//
+// The exit code is 1 if more than -max-error-rate of the operations failed
+// or an operation's p99 is above -max-p99.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/protocol"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+func main() {
+	log.SetFlags(log.Ltime)
+
+	addr := flag.String("addr", "127.0.0.1:25566", "address of the offline listener")
+	host := flag.String("host", "", "host sent in the handshake, e.g. for forced hosts, defaults to -addr")
+	proxyProtocol := flag.Bool("proxy-protocol", false, "send a PROXY protocol v1 header")
+	clients := flag.Int("clients", 10, "bots that join")
+	pingers := flag.Int("pingers", 1, "concurrent status pingers")
+	pingInterval := flag.Duration("ping-interval", time.Second, "time between the status pings of a pinger")
+	prefix := flag.String("prefix", "loadtest", "bot name prefix, bots are named <prefix><n>")
+	duration := flag.Duration("duration", time.Minute, "how long to run")
+	ramp := flag.Duration("ramp", 10*time.Second, "time over which the bots join")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each operation")
+	chat := flag.Duration("chat-interval", 5*time.Second, "time between chat messages of a bot, 0 disables chat")
+	servers := flag.String("servers", "", "comma separated servers the bots switch between with /server")
+	switchInterval := flag.Duration("switch-interval", 30*time.Second, "time between server switches of a bot")
+	register := flag.Bool("register", false, "add the bots as offline accounts through the admin API and remove them afterwards")
+	apiAddr := flag.String("api", util.EnvWithDefault("PROXYCTL_ADDR", "http://127.0.0.1:8080"), "admin API base URL for -register")
+	token := flag.String("token", os.Getenv("PROXYCTL_TOKEN"), "admin API token for -register")
+	maxErrorRate := flag.Float64("max-error-rate", 0.01, "highest fraction of failed operations that passes")
+	maxP99 := flag.Duration("max-p99", 0, "highest p99 latency of any operation that passes, 0 disables the check")
+	output := flag.String("o", "table", "output format (table, json)")
+	flag.Parse()
+
+	if *clients > 0 && len(*prefix)+len(strconv.Itoa(*clients-1)) > 16 {
+		log.Fatalf("bot names would be longer than 16 characters, use a shorter -prefix")
+	}
+
+	cfg := &config{addr: *addr, opts: protocol.Options{ProxyProtocol: *proxyProtocol, Timeout: *timeout}}
+	if *host != "" {
+		_, port, err := net.SplitHostPort(*addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			log.Fatalf("invalid port %q", port)
+		}
+
+		cfg.opts.Host, cfg.opts.Port = *host, uint16(p)
+	}
+
+	cfg.timeout = *timeout
+	cfg.chatInterval = *chat
+	cfg.switchInterval = *switchInterval
+	if *servers != "" {
+		cfg.servers = strings.Split(*servers, ",")
+	}
+
+	names := make([]string, *clients)
+	for i := range names {
+		names[i] = *prefix + strconv.Itoa(i)
+	}
+
+	a := &accounts{addr: strings.TrimSuffix(*apiAddr, "/"), token: *token}
+	if *register {
+		if err := a.add(names); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancelTimeout := context.WithTimeout(ctx, *duration)
+
+	s := newStats()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < *pingers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runPinger(ctx, cfg, s, *pingInterval)
+		}()
+	}
+
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Spread the joins over the ramp
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(*ramp * time.Duration(i) / time.Duration(len(names))):
+			}
+
+			runBot(ctx, cfg, s, name)
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				log.Print(s.progress())
+			}
+		}
+	}()
+
+	wg.Wait()
+	cancelTimeout()
+	cancel()
+
+	if *register {
+		a.remove(names)
+	}
+
+	reports := s.report()
+	if *output == "json" {
+		if err := writeJSON(os.Stdout, reports); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		writeTable(os.Stdout, reports)
+	}
+
+	if failures := check(reports, *maxErrorRate, *maxP99); len(failures) > 0 {
+		for _, f := range failures {
+			log.Print(f)
+		}
+
+		os.Exit(1)
+	}
+}
+
+func runPinger(ctx context.Context, cfg *config, s *stats, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if _, err := protocol.Ping(ctx, cfg.addr, cfg.opts); err != nil && ctx.Err() == nil {
+			s.fail("status", err)
+		} else if err == nil {
+			s.record("status", time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runBot keeps the bot online until ctx is done, rejoining a second after
+// it is disconnected.
+func runBot(ctx context.Context, cfg *config, s *stats, name string) {
+	for {
+		b := &bot{name: name, cfg: cfg, stats: s, pending: make(map[string]time.Time)}
+		if err := b.run(ctx); err != nil && ctx.Err() == nil {
+			s.fail("login", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// check returns why the run fails the thresholds.
+func check(reports []opReport, maxErrorRate float64, maxP99 time.Duration) []string {
+	var failures []string
+
+	count, errs := 0, 0
+	for _, r := range reports {
+		count += r.Count
+		errs += r.Errors
+
+		if maxP99 > 0 && r.P99 > maxP99 {
+			failures = append(failures, fmt.Sprintf("%s p99 of %s is above %s", r.Op, r.P99, maxP99))
+		}
+	}
+
+	if count == 0 {
+		return append(failures, "no operations ran")
+	}
+
+	if rate := float64(errs) / float64(count); rate > maxErrorRate {
+		failures = append(failures, fmt.Sprintf("%.1f%% of the operations failed, more than %.1f%%", rate*100, maxErrorRate*100))
+	}
+
+	return failures
+}
+
+// accounts registers the bots as offline accounts.
+type accounts struct {
+	addr  string
+	token string
+}
+
+func (a *accounts) request(method, name, body string) error {
+	req, err := http.NewRequest(method, a.addr+"/offline/accounts/"+name, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Removing an account that is already gone is fine
+	if res.StatusCode >= 300 && (method != http.MethodDelete || res.StatusCode != http.StatusNotFound) {
+		return errors.New(method + " " + name + ": " + res.Status)
+	}
+
+	return nil
+}
+
+func (a *accounts) add(names []string) error {
+	for _, name := range names {
+		if err := a.request(http.MethodPut, name, `{"comment":"loadtest"}`); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Registered %d offline accounts", len(names))
+
+	return nil
+}
+
+func (a *accounts) remove(names []string) {
+	for _, name := range names {
+		if err := a.request(http.MethodDelete, name, ""); err != nil {
+			log.Printf("Failed to remove offline account %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stats collects the latencies and errors of every operation.
+type stats struct {
+	ops    map[string]*op
+	online int
+	m      sync.Mutex
+}
+
+type op struct {
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+type opReport struct {
+	Op     string         `json:"op"`
+	Count  int            `json:"count"`
+	Errors int            `json:"errors"`
+	P50    time.Duration  `json:"p50"`
+	P95    time.Duration  `json:"p95"`
+	P99    time.Duration  `json:"p99"`
+	Max    time.Duration  `json:"max"`
+	Causes map[string]int `json:"causes,omitempty"`
+}
+
+func newStats() *stats {
+	return &stats{ops: make(map[string]*op)}
+}
+
+func (s *stats) get(name string) *op {
+	o, ok := s.ops[name]
+	if !ok {
+		o = &op{errors: make(map[string]int)}
+		s.ops[name] = o
+	}
+
+	return o
+}
+
+func (s *stats) record(name string, d time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	o := s.get(name)
+	o.latencies = append(o.latencies, d)
+}
+
+func (s *stats) fail(name string, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.get(name).errors[err.Error()]++
+}
+
+func (s *stats) join(delta int) {
+	s.m.Lock()
+	s.online += delta
+	s.m.Unlock()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func (s *stats) report() []opReport {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	reports := make([]opReport, 0, len(s.ops))
+	for name, o := range s.ops {
+		sorted := slices.Clone(o.latencies)
+		slices.Sort(sorted)
+
+		r := opReport{Op: name, Count: len(sorted), P50: percentile(sorted, 0.5), P95: percentile(sorted, 0.95), P99: percentile(sorted, 0.99), Max: percentile(sorted, 1)}
+		for _, n := range o.errors {
+			r.Errors += n
+			r.Count += n
+		}
+
+		if r.Errors > 0 {
+			r.Causes = maps.Clone(o.errors)
+		}
+
+		reports = append(reports, r)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Op < reports[j].Op
+	})
+
+	return reports
+}
+
+// progress is a one line summary for the periodic output.
+func (s *stats) progress() string {
+	reports := s.report()
+
+	s.m.Lock()
+	line := fmt.Sprintf("online %d", s.online)
+	s.m.Unlock()
+
+	for _, r := range reports {
+		line += fmt.Sprintf(", %s %d/%d failed", r.Op, r.Errors, r.Count)
+	}
+
+	return line
+}
+
+func writeTable(w io.Writer, reports []opReport) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OP\tCOUNT\tERRORS\tP50\tP95\tP99\tMAX")
+
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", r.Op, r.Count, r.Errors, r.P50.Round(time.Millisecond/10), r.P95.Round(time.Millisecond/10), r.P99.Round(time.Millisecond/10), r.Max.Round(time.Millisecond/10))
+	}
+	_ = tw.Flush()
+
+	for _, r := range reports {
+		for cause, n := range r.Causes {
+			fmt.Fprintf(w, "%s: %d× %s\n", r.Op, n, cause)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, reports []opReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(reports)
+}
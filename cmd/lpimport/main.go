@@ -0,0 +1,49 @@
+// Command lpimport imports a LuckPerms JSON export into the permissions KV.
+// It uses the same environment configuration as the proxy.
+//
+//	lpimport luckperms-export.json.gz
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("usage: %s <luckperms export (.json or .json.gz)>", os.Args[0])
+	}
+
+	ctx := context.Background()
+
+	h, err := hosting.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	perms, err := permissions.NewKVPermissions(ctx, h)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := perms.Reload(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	fd, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fd.Close()
+
+	res, err := perms.ImportLuckPerms(ctx, fd)
+	if err != nil {
+		log.Fatalf("failed to import (only JSON exports are supported, H2/MySQL users should run `/lp export` first): %v", err)
+	}
+
+	log.Printf("Done: %+v", *res)
+}
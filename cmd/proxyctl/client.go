@@ -0,0 +1,632 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type client struct {
+	addr  string
+	token string
+	json  bool
+	http  *http.Client
+}
+
+// httpClient trusts ca in addition to the system roots and presents the
+// client certificate if one is given.
+func httpClient(ca, cert, key string) (*http.Client, error) {
+	if ca == "" && cert == "" {
+		return http.DefaultClient, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ca != "" {
+		raw, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificates in %s", ca)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}, nil
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// request returns an error for any status >= 300 that is not listed in also,
+// decoding the API's error body if there is one.
+func (c *client) request(method, path string, body io.Reader, also ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.addr+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 && !slices.Contains(also, res.StatusCode) {
+		defer res.Body.Close()
+
+		e := apiError{}
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Error == "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+		}
+
+		return nil, fmt.Errorf("%s %s: %s", method, path, e.Error)
+	}
+
+	return res, nil
+}
+
+// do sends in as JSON and decodes the response into out. If out is nil the
+// response is printed as JSON in JSON mode and ignored otherwise.
+func (c *client) do(method, path string, in any, out any, also ...int) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(raw)
+	}
+
+	res, err := c.request(method, path, body, also...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		if c.json {
+			_, err := io.Copy(os.Stdout, res.Body)
+			return err
+		}
+
+		return nil
+	}
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// print writes v as JSON or lets table render it.
+func (c *client) print(v any, table func(w *tabwriter.Writer)) error {
+	if c.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+
+	return w.Flush()
+}
+
+type check struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type report struct {
+	Status  string           `json:"status"`
+	Pod     string           `json:"pod"`
+	Checks  map[string]check `json:"checks"`
+	Plugins []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+		Error string `json:"error"`
+	} `json:"plugins"`
+	Backends []string `json:"backends"`
+}
+
+func (c *client) status() error {
+	r := report{}
+	// Failing checks are reported with 503 and a normal body
+	if err := c.do(http.MethodGet, "/readyz/details", nil, &r, http.StatusServiceUnavailable); err != nil {
+		return err
+	}
+
+	return c.print(r, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "POD\t%s\nSTATUS\t%s\nBACKENDS\t%s\n\n", r.Pod, r.Status, strings.Join(r.Backends, ", "))
+
+		fmt.Fprintln(w, "CHECK\tSTATUS\tERROR")
+		for name, c := range r.Checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, c.Status, c.Error)
+		}
+
+		fmt.Fprintln(w, "\nPLUGIN\tSTATE\tERROR")
+		for _, p := range r.Plugins {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, p.State, p.Error)
+		}
+	})
+}
+
+func (c *client) cluster() error {
+	var instances []struct {
+		Name          string `json:"name"`
+		Region        string `json:"region"`
+		Version       string `json:"version"`
+		Players       int    `json:"players"`
+		Live          bool   `json:"live"`
+		UptimeSeconds int64  `json:"uptimeSeconds"`
+	}
+	if err := c.do(http.MethodGet, "/cluster", nil, &instances); err != nil {
+		return err
+	}
+
+	return c.print(instances, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tREGION\tVERSION\tPLAYERS\tLIVE\tUPTIME")
+		for _, i := range instances {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%t\t%s\n", i.Name, i.Region, i.Version, i.Players, i.Live, time.Duration(i.UptimeSeconds)*time.Second)
+		}
+	})
+}
+
+func (c *client) restartCluster() error {
+	res := struct {
+		Leader string `json:"leader"`
+	}{}
+	if err := c.do(http.MethodPost, "/cluster/restart", nil, &res); err != nil {
+		return err
+	}
+
+	return c.print(res, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "LEADER\t%s\n", res.Leader)
+	})
+}
+
+func (c *client) players() error {
+	var players []struct {
+		UUID     string `json:"uuid"`
+		Username string `json:"username"`
+		Server   string `json:"server"`
+		PingMs   int64  `json:"pingMs"`
+	}
+	if err := c.do(http.MethodGet, "/players", nil, &players); err != nil {
+		return err
+	}
+
+	return c.print(players, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "USERNAME\tUUID\tSERVER\tPING")
+		for _, p := range players {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%dms\n", p.Username, p.UUID, p.Server, p.PingMs)
+		}
+	})
+}
+
+type instance struct {
+	Gamemode string            `json:"gamemode"`
+	Address  string            `json:"address"`
+	Port     int               `json:"port"`
+	Canary   bool              `json:"canary,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+func (c *client) servers(selector string) error {
+	var servers []struct {
+		Name     string    `json:"name"`
+		Address  string    `json:"address"`
+		Players  int       `json:"players"`
+		Instance *instance `json:"instance"`
+	}
+	if err := c.do(http.MethodGet, "/servers?selector="+url.QueryEscape(selector), nil, &servers); err != nil {
+		return err
+	}
+
+	return c.print(servers, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tADDRESS\tPLAYERS\tGAMEMODE\tCANARY\tTAGS")
+		for _, s := range servers {
+			gamemode, canary, tags := "-", false, make([]string, 0)
+			if s.Instance != nil {
+				gamemode, canary = s.Instance.Gamemode, s.Instance.Canary
+				for k, v := range s.Instance.Tags {
+					tags = append(tags, k+"="+v)
+				}
+				slices.Sort(tags)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%t\t%s\n", s.Name, s.Address, s.Players, gamemode, canary, strings.Join(tags, ","))
+		}
+	})
+}
+
+func (c *client) setServer(name string, i instance) error {
+	return c.do(http.MethodPut, "/servers/"+url.PathEscape(name), i, nil)
+}
+
+func (c *client) whitelist(list bool) error {
+	status := struct {
+		Enabled bool     `json:"enabled"`
+		Players []string `json:"players"`
+	}{}
+	if err := c.do(http.MethodGet, "/whitelist", nil, &status); err != nil {
+		return err
+	}
+
+	return c.print(status, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ENABLED\t%t\nPLAYERS\t%d\n", status.Enabled, len(status.Players))
+
+		if list {
+			fmt.Fprintln(w, "\nUUID")
+			for _, id := range status.Players {
+				fmt.Fprintln(w, id)
+			}
+		}
+	})
+}
+
+type punishment struct {
+	ID        string    `json:"id"`
+	Player    string    `json:"player"`
+	Name      string    `json:"name"`
+	Category  string    `json:"category"`
+	Kind      string    `json:"kind"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	Until     time.Time `json:"until"`
+	Permanent bool      `json:"permanent"`
+	Lifted    bool      `json:"lifted"`
+}
+
+func (p punishment) active(now time.Time) bool {
+	return !p.Lifted && (p.Permanent || now.Before(p.Until))
+}
+
+func printBans(c *client, bans []punishment) error {
+	return c.print(bans, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tUUID\tID\tCATEGORY\tUNTIL\tBY\tREASON")
+		for _, b := range bans {
+			until := "permanent"
+			if !b.Permanent {
+				until = b.Until.Local().Format(time.DateTime)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", b.Name, b.Player, b.ID, b.Category, until, b.Actor, b.Reason)
+		}
+	})
+}
+
+func (c *client) bans() error {
+	var bans []punishment
+	if err := c.do(http.MethodGet, "/punishments/active?kind=ban", nil, &bans); err != nil {
+		return err
+	}
+
+	return printBans(c, bans)
+}
+
+func (c *client) ban(player, category, reason string, minutes int) error {
+	req := map[string]any{
+		"category": category,
+		"reason":   reason,
+		"override": map[string]any{"kind": "ban", "minutes": minutes},
+	}
+
+	issued := punishment{}
+	if err := c.do(http.MethodPost, "/punishments/players/"+url.PathEscape(player), req, &issued); err != nil {
+		return err
+	}
+
+	return printBans(c, []punishment{issued})
+}
+
+// unban lifts the ban with the ID, or every active ban of the player.
+func (c *client) unban(player, id string) error {
+	path := "/punishments/players/" + url.PathEscape(player)
+
+	ids := []string{id}
+	if id == "" {
+		var history []punishment
+		if err := c.do(http.MethodGet, path, nil, &history); err != nil {
+			return err
+		}
+
+		ids = ids[:0]
+		now := time.Now()
+		for _, p := range history {
+			if p.Kind == "ban" && p.active(now) {
+				ids = append(ids, p.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			return fmt.Errorf("%s is not banned", player)
+		}
+	}
+
+	lifted := make([]punishment, 0, len(ids))
+	for _, id := range ids {
+		p := punishment{}
+		if err := c.do(http.MethodDelete, path+"/"+url.PathEscape(id), nil, &p); err != nil {
+			return err
+		}
+
+		lifted = append(lifted, p)
+	}
+
+	return printBans(c, lifted)
+}
+
+func (c *client) reload() error {
+	var results []struct {
+		Plugin string `json:"plugin"`
+		Error  string `json:"error"`
+	}
+
+	// Failed reloads are reported with 500 and the results as body
+	if err := c.do(http.MethodPost, "/reload", nil, &results, http.StatusInternalServerError); err != nil {
+		return err
+	}
+
+	return c.print(results, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "PLUGIN\tRESULT")
+		for _, r := range results {
+			result := "ok"
+			if r.Error != "" {
+				result = r.Error
+			}
+
+			fmt.Fprintf(w, "%s\t%s\n", r.Plugin, result)
+		}
+	})
+}
+
+func (c *client) backup(file string) error {
+	res, err := c.request(http.MethodGet, "/backup", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if _, err := io.Copy(fd, res.Body); err != nil {
+		return err
+	}
+
+	return fd.Close()
+}
+
+func (c *client) restore(file, buckets string, prune, dryRun bool) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	q := url.Values{
+		"prune":  {strconv.FormatBool(prune)},
+		"dryRun": {strconv.FormatBool(dryRun)},
+	}
+	if buckets != "" {
+		q.Set("buckets", buckets)
+	}
+
+	res, err := c.request(http.MethodPost, "/restore?"+q.Encode(), fd)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	diff := struct {
+		DryRun  bool `json:"dryRun"`
+		Buckets map[string]struct {
+			Added   []string `json:"added"`
+			Changed []string `json:"changed"`
+			Removed []string `json:"removed"`
+		} `json:"buckets"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&diff); err != nil {
+		return err
+	}
+
+	return c.print(diff, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "BUCKET\tADDED\tCHANGED\tREMOVED")
+		for name, d := range diff.Buckets {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", name, len(d.Added), len(d.Changed), len(d.Removed))
+		}
+	})
+}
+
+type monitorMode struct {
+	Global  bool     `json:"global"`
+	Plugins []string `json:"plugins"`
+}
+
+func (c *client) monitor() error {
+	mode := monitorMode{}
+	if err := c.do(http.MethodGet, "/moderation/monitor", nil, &mode); err != nil {
+		return err
+	}
+
+	return c.print(mode, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "GLOBAL\t%t\nPLUGINS\t%s\n", mode.Global, strings.Join(mode.Plugins, ", "))
+	})
+}
+
+type canary struct {
+	Enabled    bool   `json:"enabled"`
+	Percent    int    `json:"percent"`
+	Permission string `json:"permission,omitempty"`
+}
+
+func (c *client) canaries() error {
+	canaries := make(map[string]canary)
+	if err := c.do(http.MethodGet, "/routing/canary", nil, &canaries); err != nil {
+		return err
+	}
+
+	gamemodes := make([]string, 0, len(canaries))
+	for gamemode := range canaries {
+		gamemodes = append(gamemodes, gamemode)
+	}
+	slices.Sort(gamemodes)
+
+	return c.print(canaries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "GAMEMODE\tENABLED\tPERCENT\tPERMISSION")
+		for _, gamemode := range gamemodes {
+			cfg := canaries[gamemode]
+			fmt.Fprintf(w, "%s\t%t\t%d\t%s\n", gamemode, cfg.Enabled, cfg.Percent, cfg.Permission)
+		}
+	})
+}
+
+func (c *client) setCanary(gamemode string, cfg canary) error {
+	return c.do(http.MethodPut, "/routing/canary/"+url.PathEscape(gamemode), cfg, nil)
+}
+
+type gdprReport struct {
+	Kind     string `json:"kind"`
+	Player   string `json:"player"`
+	Sections []struct {
+		Subsystem string          `json:"subsystem"`
+		Data      json.RawMessage `json:"data"`
+		Erased    int             `json:"erased"`
+		Kept      []struct {
+			ID     string `json:"id"`
+			Reason string `json:"reason"`
+		} `json:"kept"`
+		Error string `json:"error"`
+	} `json:"sections"`
+	Signature string `json:"signature"`
+}
+
+// gdpr exports or erases the data of the player and writes the signed report
+// to file as it was received, so its signature still verifies.
+func (c *client) gdpr(method, player, file string) error {
+	res, err := c.request(method, "/gdpr/"+url.PathEscape(player), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(file, raw, 0o600); err != nil {
+		return err
+	}
+
+	r := gdprReport{}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+
+	failed := 0
+	err = c.print(r, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "REPORT\t%s\nSIGNATURE\t%s\n\n", file, r.Signature)
+
+		fmt.Fprintln(w, "SUBSYSTEM\tRESULT\tKEPT")
+		for _, s := range r.Sections {
+			result := "no data"
+			switch {
+			case s.Error != "":
+				result = "failed: " + s.Error
+			case r.Kind == "erase":
+				result = fmt.Sprintf("%d erased", s.Erased)
+			case s.Data != nil:
+				result = "exported"
+			}
+
+			kept := make([]string, 0, len(s.Kept))
+			for _, k := range s.Kept {
+				kept = append(kept, k.ID+" ("+k.Reason+")")
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Subsystem, result, strings.Join(kept, ", "))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range r.Sections {
+		if s.Error != "" {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d subsystems failed, the report is incomplete", failed)
+	}
+
+	return nil
+}
+
+func (c *client) verifyGDPR(file string) error {
+	report, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		Valid bool   `json:"valid"`
+		Error string `json:"error"`
+	}{}
+	if err := c.do(http.MethodPost, "/gdpr/verify", json.RawMessage(report), &res); err != nil {
+		return err
+	}
+
+	if err := c.print(res, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "VALID\t%t\n", res.Valid)
+	}); err != nil {
+		return err
+	}
+
+	if !res.Valid {
+		return fmt.Errorf("%s: %s", file, res.Error)
+	}
+
+	return nil
+}
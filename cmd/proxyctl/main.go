@@ -0,0 +1,359 @@
+// Command proxyctl administers the proxy through the admin API, for use in CI
+// and ops runbooks.
+//
+//	proxyctl [-addr http://127.0.0.1:8080] [-token ...] [-ca file] [-cert file -key file] [-o table|json] <command>
+//
+// The address and token default to PROXYCTL_ADDR and PROXYCTL_TOKEN, the TLS
+// files to PROXYCTL_CA, PROXYCTL_CERT and PROXYCTL_KEY.
+// Commands:
+//
+//	status
+//	cluster [restart]
+//	players
+//	servers [list [selector]]
+//	servers set [-canary] [-tags k=v,...] <name> <gamemode> <host:port>
+//	servers remove <name>
+//	servers start|stop <name>
+//	servers command <name> <command...>
+//	whitelist [status|list|enable|disable]
+//	whitelist add|remove <player>
+//	bans [list]
+//	bans add [-minutes n] [-category c] [-reason text] <player>
+//	bans remove <player> [id]
+//	reload
+//	monitor [set [-global] [-plugins a,b]]
+//	canary [list]
+//	canary set [-percent n] [-permission perm] <gamemode>
+//	canary off <gamemode>
+//	backup <file>
+//	restore [-buckets a,b] [-prune] [-dry-run] <file>
+//	gdpr export|erase [-out file] <uuid>
+//	gdpr verify <file>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	addr := flag.String("addr", util.EnvWithDefault("PROXYCTL_ADDR", "http://127.0.0.1:8080"), "admin API base URL")
+	token := flag.String("token", os.Getenv("PROXYCTL_TOKEN"), "admin API token")
+	ca := flag.String("ca", os.Getenv("PROXYCTL_CA"), "CA certificate to verify an https admin API")
+	cert := flag.String("cert", os.Getenv("PROXYCTL_CERT"), "client certificate for mutual TLS")
+	key := flag.String("key", os.Getenv("PROXYCTL_KEY"), "client key for mutual TLS")
+	output := flag.String("o", "table", "output format (table, json)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	httpC, err := httpClient(*ca, *cert, *key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c := &client{addr: strings.TrimSuffix(*addr, "/"), token: *token, json: *output == "json", http: httpC}
+
+	if err := run(c, flag.Arg(0), flag.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "status":
+		return c.status()
+	case "cluster":
+		return runCluster(c, args)
+	case "players":
+		return c.players()
+	case "servers":
+		return runServers(c, args)
+	case "whitelist":
+		return runWhitelist(c, args)
+	case "bans":
+		return runBans(c, args)
+	case "reload":
+		return c.reload()
+	case "monitor":
+		return runMonitor(c, args)
+	case "canary":
+		return runCanary(c, args)
+	case "backup":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: backup <file>")
+		}
+
+		return c.backup(args[0])
+	case "restore":
+		return runRestore(c, args)
+	case "gdpr":
+		return runGDPR(c, args)
+	default:
+		return fmt.Errorf("unknown command %s", cmd)
+	}
+}
+
+func runCluster(c *client, args []string) error {
+	switch {
+	case len(args) == 0:
+		return c.cluster()
+	case len(args) == 1 && args[0] == "restart":
+		return c.restartCluster()
+	default:
+		return fmt.Errorf("usage: cluster [restart]")
+	}
+}
+
+func runServers(c *client, args []string) error {
+	if len(args) == 0 {
+		return c.servers("")
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: servers list [selector]")
+		}
+
+		selector := ""
+		if len(args) == 2 {
+			selector = args[1]
+		}
+
+		return c.servers(selector)
+	case "set":
+		flags := flag.NewFlagSet("servers set", flag.ExitOnError)
+		canary := flags.Bool("canary", false, "only route players to it through the gamemode's canary")
+		rawTags := flags.String("tags", "", "comma separated key=value tags")
+		_ = flags.Parse(args[1:])
+
+		if flags.NArg() != 3 {
+			return fmt.Errorf("usage: servers set [-canary] <name> <gamemode> <host:port>")
+		}
+
+		host, rawPort, err := net.SplitHostPort(flags.Arg(2))
+		if err != nil {
+			return err
+		}
+
+		port, err := strconv.Atoi(rawPort)
+		if err != nil {
+			return err
+		}
+
+		tags := make(map[string]string)
+		for _, tag := range strings.Split(*rawTags, ",") {
+			if tag == "" {
+				continue
+			}
+
+			k, v, ok := strings.Cut(tag, "=")
+			if !ok {
+				return fmt.Errorf("tag %s is not key=value", tag)
+			}
+
+			tags[k] = v
+		}
+
+		return c.setServer(flags.Arg(0), instance{Gamemode: flags.Arg(1), Address: host, Port: port, Canary: *canary, Tags: tags})
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: servers remove <name>")
+		}
+
+		return c.do(http.MethodDelete, "/servers/"+args[1], nil, nil)
+	case "start", "stop":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: servers %s <name>", args[0])
+		}
+
+		return c.do(http.MethodPost, "/provider/servers/"+url.PathEscape(args[1])+"/"+args[0], nil, nil)
+	case "command":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: servers command <name> <command...>")
+		}
+
+		return c.do(http.MethodPost, "/provider/servers/"+url.PathEscape(args[1])+"/command", map[string]string{"command": strings.Join(args[2:], " ")}, nil)
+	default:
+		return fmt.Errorf("unknown servers command %s", args[0])
+	}
+}
+
+func runWhitelist(c *client, args []string) error {
+	if len(args) == 0 || args[0] == "status" || args[0] == "list" {
+		return c.whitelist(len(args) > 0 && args[0] == "list")
+	}
+
+	switch args[0] {
+	case "enable", "disable":
+		return c.do(http.MethodPut, "/whitelist/enabled", map[string]bool{"enabled": args[0] == "enable"}, nil)
+	case "add":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: whitelist add <player>")
+		}
+
+		return c.do(http.MethodPost, "/whitelist/players", map[string]string{"player": args[1]}, nil)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: whitelist remove <player>")
+		}
+
+		return c.do(http.MethodDelete, "/whitelist/players/"+args[1], nil, nil)
+	default:
+		return fmt.Errorf("unknown whitelist command %s", args[0])
+	}
+}
+
+func runBans(c *client, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return c.bans()
+	}
+
+	switch args[0] {
+	case "add":
+		flags := flag.NewFlagSet("bans add", flag.ExitOnError)
+		minutes := flags.Int("minutes", 0, "length of the ban, 0 is permanent")
+		category := flags.String("category", "manual", "punishment category the ban counts towards")
+		reason := flags.String("reason", "", "reason shown to the player")
+		_ = flags.Parse(args[1:])
+
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: bans add [flags] <player>")
+		}
+
+		return c.ban(flags.Arg(0), *category, *reason, *minutes)
+	case "remove":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("usage: bans remove <player> [id]")
+		}
+
+		id := ""
+		if len(args) == 3 {
+			id = args[2]
+		}
+
+		return c.unban(args[1], id)
+	default:
+		return fmt.Errorf("unknown bans command %s", args[0])
+	}
+}
+
+func runRestore(c *client, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	buckets := flags.String("buckets", "", "comma separated buckets to restore, all if empty")
+	prune := flags.Bool("prune", false, "delete keys that are not in the backup")
+	dryRun := flags.Bool("dry-run", false, "only print what would change")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: restore [flags] <file>")
+	}
+
+	return c.restore(flags.Arg(0), *buckets, *prune, *dryRun)
+}
+
+func runGDPR(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: gdpr export|erase|verify ...")
+	}
+
+	switch args[0] {
+	case "export", "erase":
+		flags := flag.NewFlagSet("gdpr "+args[0], flag.ExitOnError)
+		out := flags.String("out", "", "file to write the signed report to, <uuid>-"+args[0]+".json by default")
+		_ = flags.Parse(args[1:])
+
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: gdpr %s [-out file] <uuid>", args[0])
+		}
+
+		file := *out
+		if file == "" {
+			file = flags.Arg(0) + "-" + args[0] + ".json"
+		}
+
+		method := http.MethodGet
+		if args[0] == "erase" {
+			method = http.MethodDelete
+		}
+
+		return c.gdpr(method, flags.Arg(0), file)
+	case "verify":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: gdpr verify <file>")
+		}
+
+		return c.verifyGDPR(args[1])
+	default:
+		return fmt.Errorf("unknown gdpr command %s", args[0])
+	}
+}
+
+func runMonitor(c *client, args []string) error {
+	if len(args) == 0 {
+		return c.monitor()
+	}
+
+	if args[0] != "set" {
+		return fmt.Errorf("unknown monitor command %s", args[0])
+	}
+
+	flags := flag.NewFlagSet("monitor set", flag.ExitOnError)
+	global := flags.Bool("global", false, "monitor all plugins")
+	plugins := flags.String("plugins", "", "comma separated plugins to monitor")
+	_ = flags.Parse(args[1:])
+
+	mode := monitorMode{Global: *global, Plugins: make([]string, 0)}
+	if *plugins != "" {
+		mode.Plugins = strings.Split(*plugins, ",")
+	}
+
+	if err := c.do(http.MethodPut, "/moderation/monitor", mode, nil); err != nil {
+		return err
+	}
+
+	return c.monitor()
+}
+
+func runCanary(c *client, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return c.canaries()
+	}
+
+	switch args[0] {
+	case "set":
+		flags := flag.NewFlagSet("canary set", flag.ExitOnError)
+		percent := flags.Int("percent", 0, "percentage of players routed to the canary")
+		permission := flags.String("permission", "", "players with this permission always go to the canary")
+		_ = flags.Parse(args[1:])
+
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: canary set [flags] <gamemode>")
+		}
+
+		return c.setCanary(flags.Arg(0), canary{Enabled: true, Percent: *percent, Permission: *permission})
+	case "off":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: canary off <gamemode>")
+		}
+
+		return c.setCanary(args[1], canary{})
+	default:
+		return fmt.Errorf("unknown canary command %s", args[0])
+	}
+}
@@ -0,0 +1,98 @@
+// Command replay lists the session recordings in the object store and
+// prints them as a timeline. It uses the same environment configuration as
+// the proxy.
+//
+//	replay list [player]
+//	replay timeline recordings/notch/1760000000000-proxy-0.jsonl.gz
+//	replay timeline -file notch.jsonl.gz
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/recordings"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("usage: %s list|timeline [flags] [args]", os.Args[0])
+	}
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "list":
+		list(ctx, os.Args[2:])
+	case "timeline":
+		timeline(ctx, os.Args[2:])
+	default:
+		log.Fatalf("unknown command %s", os.Args[1])
+	}
+}
+
+func list(ctx context.Context, args []string) {
+	if len(args) > 1 {
+		log.Fatalf("usage: %s list [player]", os.Args[0])
+	}
+
+	prefix := recordings.Prefix
+	if len(args) == 1 {
+		prefix += strings.ToLower(args[0]) + "/"
+	}
+
+	h, err := hosting.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	infos, err := h.ObjectStore().List(ctx, prefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, info := range infos {
+		fmt.Printf("%s\t%d\t%s\n", info.Name, info.Size, info.ModTime.Format("2006-01-02 15:04:05"))
+	}
+}
+
+func timeline(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("timeline", flag.ExitOnError)
+	file := flags.String("file", "", "read the recording from a local file instead of the object store")
+	_ = flags.Parse(args)
+
+	var r io.ReadCloser
+	if *file != "" {
+		fd, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		r = fd
+	} else {
+		if flags.NArg() != 1 {
+			log.Fatalf("usage: %s timeline [-file <file>] <object>", os.Args[0])
+		}
+
+		h, err := hosting.Init()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		r, err = h.ObjectStore().Get(ctx, flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer r.Close()
+
+	if err := recordings.Timeline(r, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package dev
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+)
+
+// Backend is an entry of the backends list:
+//
+//	# backends.dev.yml
+//	- name: lobby-1
+//	  address: 127.0.0.1:25566
+//	- name: survival-1
+//	  gamemode: survival
+//	  address: 127.0.0.1:25567
+//	  tags: region=eu,version=1.21
+//	  canary: true
+//
+// The gamemode defaults to the name without a trailing -<n>.
+type Backend struct {
+	Name     string
+	Gamemode string
+	Address  string
+	Tags     map[string]string
+	Canary   bool
+}
+
+func (b Backend) Instance() (hosting.InstanceInfo, error) {
+	host, rawPort, err := net.SplitHostPort(b.Address)
+	if err != nil {
+		return hosting.InstanceInfo{}, err
+	}
+
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return hosting.InstanceInfo{}, fmt.Errorf("invalid port %q", rawPort)
+	}
+
+	gamemode := b.Gamemode
+	if gamemode == "" {
+		gamemode = b.Name
+		if i := strings.LastIndexByte(gamemode, '-'); i > 0 {
+			if _, err := strconv.Atoi(gamemode[i+1:]); err == nil {
+				gamemode = gamemode[:i]
+			}
+		}
+	}
+
+	return hosting.InstanceInfo{Gamemode: gamemode, Address: host, Port: port, Canary: b.Canary, Tags: b.Tags}, nil
+}
+
+// ParseBackends reads a YAML list of backends. Only the flat list of the
+// Backend example is supported, not YAML in general.
+func ParseBackends(raw []byte) ([]Backend, error) {
+	backends := make([]Backend, 0)
+
+	for i, line := range strings.Split(string(raw), "\n") {
+		if j := strings.Index(line, "#"); j >= 0 && (j == 0 || line[j-1] == ' ' || line[j-1] == '\t') {
+			line = line[:j]
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(trimmed, "-"); ok {
+			backends = append(backends, Backend{})
+			trimmed = strings.TrimSpace(rest)
+			if trimmed == "" {
+				continue
+			}
+		} else if len(backends) == 0 || (line[0] != ' ' && line[0] != '\t') {
+			return nil, fmt.Errorf("line %d: expected a list item", i+1)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+
+		if err := backends[len(backends)-1].set(strings.TrimSpace(key), unquote(strings.TrimSpace(value))); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+
+	for _, b := range backends {
+		if b.Name == "" || b.Address == "" {
+			return nil, errors.New("every backend needs a name and an address")
+		}
+	}
+
+	return backends, nil
+}
+
+func (b *Backend) set(key, value string) error {
+	switch key {
+	case "name":
+		b.Name = value
+	case "gamemode":
+		b.Gamemode = value
+	case "address":
+		b.Address = value
+	case "canary":
+		canary, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid canary %q", value)
+		}
+		b.Canary = canary
+	case "tags":
+		b.Tags = make(map[string]string)
+		for _, tag := range strings.Split(value, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(tag), "=")
+			if !ok {
+				return fmt.Errorf("invalid tag %q, expected key=value", tag)
+			}
+			b.Tags[k] = v
+		}
+	default:
+		return fmt.Errorf("unknown key %s", key)
+	}
+
+	return nil
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+
+	return v
+}
@@ -0,0 +1,56 @@
+package dev
+
+import (
+	"testing"
+)
+
+func TestParseBackends(t *testing.T) {
+	backends, err := ParseBackends([]byte(`# comment
+- name: lobby-1
+  address: 127.0.0.1:25566 # trailing comment
+
+- name: "event"
+  gamemode: minigames
+  address: 'localhost:25570'
+  tags: region=eu, version=1.21
+  canary: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backends) != 2 {
+		t.Fatalf("expected 2 backends, got %d", len(backends))
+	}
+
+	lobby, err := backends[0].Instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lobby.Gamemode != "lobby" || lobby.Address != "127.0.0.1" || lobby.Port != 25566 {
+		t.Fatalf("unexpected lobby %+v", lobby)
+	}
+
+	event, err := backends[1].Instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Gamemode != "minigames" || !event.Canary || event.Tags["version"] != "1.21" || event.Tags["region"] != "eu" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func TestParseBackendsErrors(t *testing.T) {
+	for _, raw := range []string{
+		"name: lobby\n",
+		"- name: lobby\n",
+		"- name: lobby\n  address: 127.0.0.1:25566\n  port: 1\n",
+		"- name: lobby\naddress: 127.0.0.1:25566\n",
+	} {
+		if _, err := ParseBackends([]byte(raw)); err == nil {
+			t.Errorf("expected an error for %q", raw)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package dev implements `proxy dev`, a single proxy for plugin development
+// that needs nothing but Go: in-memory KV, storage and object store, an
+// embedded NATS server or none at all, and backends from a YAML list.
+package dev
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+type Dev struct {
+	backends string
+	nats     *natsserver.Server
+}
+
+// Setup parses the flags of `proxy dev` and sets the environment of the
+// development defaults, variables that are already set win. It returns the
+// remaining arguments, which are passed on to Gate.
+func Setup(args []string) (*Dev, []string, error) {
+	flags := flag.NewFlagSet("dev", flag.ContinueOnError)
+	backends := flags.String("backends", "backends.dev.yml", "YAML list of the backends to register, ignored if missing")
+	nats := flags.String("nats", "embedded", "embedded, none for in-process messaging, or the URL of a NATS server")
+	verbose := flags.Bool("verbose", true, "log every KV, storage and messaging operation and Gate's debug output")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	d := &Dev{backends: *backends}
+
+	env := map[string]string{
+		"KV_BACKEND":           "json",
+		"STORAGE_BACKEND":      "memory",
+		"OBJECT_STORE_BACKEND": "memory",
+		"CSMC_NETWORK":         "dev",
+		"POD_NAME":             "proxy-0",
+		"POD_NAMESPACE":        "dev",
+		"API_ADDR":             "127.0.0.1:8080",
+		"API_TOKEN":            "dev",
+		// Nothing survives a restart anyway
+		"SNAPSHOT_DIR": "",
+		"KV_SNAPSHOTS": "",
+	}
+
+	switch *nats {
+	case "none":
+		env["MESSAGING_BACKEND"] = "memory"
+	case "embedded":
+		s, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1, NoSigs: true})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s.Start()
+		if !s.ReadyForConnections(10 * time.Second) {
+			return nil, nil, fmt.Errorf("embedded NATS server didn't start")
+		}
+		log.Printf("Started embedded NATS server on %s", s.ClientURL())
+
+		d.nats = s
+		env["MESSAGING_BACKEND"] = "nats"
+		env["MESSAGING_BACKEND_OPTIONS"] = fmt.Sprintf(`{"url":%q}`, s.ClientURL())
+	default:
+		env["MESSAGING_BACKEND"] = "nats"
+		env["MESSAGING_BACKEND_OPTIONS"] = fmt.Sprintf(`{"url":%q}`, *nats)
+	}
+
+	if *verbose {
+		for _, key := range []string{"KV_LOGGING", "STORAGE_LOGGING", "OBJECT_STORE_LOGGING", "MESSAGING_LOGGING"} {
+			env[key] = "true"
+		}
+	}
+
+	for k, v := range env {
+		if _, exists := os.LookupEnv(k); !exists {
+			os.Setenv(k, v)
+		}
+	}
+
+	rest := flags.Args()
+	if *verbose && !slices.Contains(rest, "-d") && !slices.Contains(rest, "--debug") {
+		rest = append([]string{"--debug"}, rest...)
+	}
+
+	// Without a config.yml Gate uses the development one of the repository
+	if !slices.Contains(rest, "-c") && !slices.Contains(rest, "--config") {
+		if _, err := os.Stat("config.yml"); os.IsNotExist(err) {
+			if _, err := os.Stat("config.dev.yml"); err == nil {
+				rest = append([]string{"--config", "config.dev.yml"}, rest...)
+			}
+		}
+	}
+
+	return d, rest, nil
+}
+
+// Seed registers the backends of the YAML list in the instances bucket, so
+// they show up like those of a real network.
+func (d *Dev) Seed(ctx context.Context, h *hosting.Hosting) error {
+	raw, err := os.ReadFile(d.backends)
+	if os.IsNotExist(err) {
+		log.Printf("No %s, register backends with PUT /servers/<name>", d.backends)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	backends, err := ParseBackends(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.backends, err)
+	}
+
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVInstancesKey())
+	if err != nil {
+		return err
+	}
+
+	for _, b := range backends {
+		info, err := b.Instance()
+		if err != nil {
+			return fmt.Errorf("%s: backend %s: %w", d.backends, b.Name, err)
+		}
+
+		if err := kv.Typed[hosting.InstanceInfo](bucket, b.Name).Set(ctx, info); err != nil {
+			return err
+		}
+
+		log.Printf("Registered backend %s (%s) at %s", b.Name, info.Gamemode, b.Address)
+	}
+
+	return nil
+}
+
+// Close stops the embedded NATS server.
+func (d *Dev) Close() {
+	if d.nats != nil {
+		d.nats.Shutdown()
+	}
+}
@@ -0,0 +1,366 @@
+package harness
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/protocol"
+)
+
+// Backend is a fake server that lets players log in and join an empty
+// world, and records what they send. It expects no forwarding and speaks
+// 1.21 without compression.
+type Backend struct {
+	Name string
+	l    net.Listener
+
+	players  map[string]*protocol.Conn
+	messages []Message
+	joins    chan string
+	closed   bool
+	m        sync.Mutex
+}
+
+// Message is a chat message or command a player sent to a backend.
+type Message struct {
+	Player  string
+	Text    string
+	Command bool
+}
+
+// NewBackend listens on a random local port.
+func NewBackend(name string) (*Backend, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backend{Name: name, l: l, players: make(map[string]*protocol.Conn), joins: make(chan string, 64)}
+	go b.accept()
+
+	return b, nil
+}
+
+func (b *Backend) Addr() *net.TCPAddr {
+	return b.l.Addr().(*net.TCPAddr)
+}
+
+// Close stops the backend and drops every player, like a crash.
+func (b *Backend) Close() error {
+	b.m.Lock()
+	b.closed = true
+	for _, c := range b.players {
+		c.Close()
+	}
+	b.m.Unlock()
+
+	return b.l.Close()
+}
+
+// Players returns the names of the players on the backend, sorted.
+func (b *Backend) Players() []string {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	players := make([]string, 0, len(b.players))
+	for name := range b.players {
+		players = append(players, name)
+	}
+	slices.Sort(players)
+
+	return players
+}
+
+func (b *Backend) Messages() []Message {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return slices.Clone(b.messages)
+}
+
+// WaitPlayer waits until the player joined the backend.
+func (b *Backend) WaitPlayer(name string, timeout time.Duration) error {
+	deadline := time.After(timeout)
+
+	for {
+		b.m.Lock()
+		_, ok := b.players[name]
+		b.m.Unlock()
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-b.joins:
+		case <-deadline:
+			return fmt.Errorf("%s didn't join %s", name, b.Name)
+		}
+	}
+}
+
+// Kick disconnects the player from the backend, the proxy decides where it
+// goes next.
+func (b *Backend) Kick(name, reason string) error {
+	b.m.Lock()
+	c, ok := b.players[name]
+	b.m.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%s is not on %s", name, b.Name)
+	}
+
+	return c.Write(protocol.PlayDisconnect, protocol.AppendText(nil, reason))
+}
+
+// Broadcast sends a system chat message to every player.
+func (b *Backend) Broadcast(text string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for _, c := range b.players {
+		_ = c.Write(protocol.PlaySystemChat, append(protocol.AppendText(nil, text), 0))
+	}
+}
+
+func (b *Backend) accept() {
+	for {
+		c, err := b.l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer c.Close()
+
+			if err := b.serve(protocol.NewConn(c)); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Backend %s: %v", b.Name, err)
+			}
+		}()
+	}
+}
+
+func (b *Backend) serve(c *protocol.Conn) error {
+	id, r, err := c.Read()
+	if err != nil {
+		return err
+	}
+
+	if id != protocol.Handshake {
+		return fmt.Errorf("expected a handshake, got 0x%02X", id)
+	}
+
+	// Protocol, host and port
+	if _, err := protocol.ReadVarInt(r); err != nil {
+		return err
+	}
+	if _, err := protocol.ReadString(r); err != nil {
+		return err
+	}
+	if _, err := r.Seek(2, io.SeekCurrent); err != nil {
+		return err
+	}
+
+	next, err := protocol.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if next == 1 {
+		return b.status(c)
+	}
+
+	name, err := b.login(c)
+	if err != nil {
+		return err
+	}
+
+	b.m.Lock()
+	if b.closed {
+		b.m.Unlock()
+		return nil
+	}
+	b.players[name] = c
+	b.m.Unlock()
+
+	defer func() {
+		b.m.Lock()
+		if b.players[name] == c {
+			delete(b.players, name)
+		}
+		b.m.Unlock()
+	}()
+
+	select {
+	case b.joins <- name:
+	default:
+	}
+
+	return b.play(c, name)
+}
+
+func (b *Backend) status(c *protocol.Conn) error {
+	for {
+		id, r, err := c.Read()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case protocol.StatusRequest:
+			status := fmt.Sprintf(`{"version":{"name":"1.21","protocol":%d},"players":{"max":100,"online":%d},"description":{"text":%q}}`, protocol.Version, len(b.Players()), b.Name)
+			if err := c.Write(protocol.StatusResponse, protocol.AppendString(nil, status)); err != nil {
+				return err
+			}
+		case protocol.StatusPing:
+			return c.Write(protocol.StatusPing, protocol.Rest(r))
+		}
+	}
+}
+
+// login lets the player in and finishes an empty configuration.
+func (b *Backend) login(c *protocol.Conn) (string, error) {
+	id, r, err := c.Read()
+	if err != nil {
+		return "", err
+	}
+
+	if id != protocol.LoginStart {
+		return "", fmt.Errorf("expected a login start, got 0x%02X", id)
+	}
+
+	name, err := protocol.ReadString(r)
+	if err != nil {
+		return "", err
+	}
+
+	uuid := make([]byte, 16)
+	if _, err := io.ReadFull(r, uuid); err != nil {
+		return "", err
+	}
+
+	data := protocol.AppendString(uuid, name)
+	// No properties, no strict error handling
+	data = protocol.AppendVarInt(data, 0)
+	data = append(data, 0)
+	if err := c.Write(protocol.LoginSuccess, data); err != nil {
+		return "", err
+	}
+
+	if err := expect(c, protocol.LoginAcknowledged); err != nil {
+		return "", err
+	}
+
+	if err := c.Write(protocol.ConfigFinish, nil); err != nil {
+		return "", err
+	}
+
+	if err := expect(c, protocol.ConfigFinishAck); err != nil {
+		return "", err
+	}
+
+	return name, c.Write(protocol.PlayLogin, joinGame())
+}
+
+// expect skips packets until one with the ID, e.g. the plugin messages
+// the proxy sends during login and configuration.
+func expect(c *protocol.Conn, want int) error {
+	for {
+		id, _, err := c.Read()
+		if err != nil {
+			return err
+		}
+
+		if id == want {
+			return nil
+		}
+	}
+}
+
+// joinGame is the login packet of an overworld in survival.
+func joinGame() []byte {
+	data := binary.BigEndian.AppendUint32(nil, 1)
+	// Not hardcore, one dimension
+	data = append(data, 0)
+	data = protocol.AppendVarInt(data, 1)
+	data = protocol.AppendString(data, "minecraft:overworld")
+	// Max players, view and simulation distance
+	data = protocol.AppendVarInt(data, 100)
+	data = protocol.AppendVarInt(data, 10)
+	data = protocol.AppendVarInt(data, 10)
+	// Reduced debug info, respawn screen, limited crafting
+	data = append(data, 0, 1, 0)
+	data = protocol.AppendVarInt(data, 0)
+	data = protocol.AppendString(data, "minecraft:overworld")
+	data = binary.BigEndian.AppendUint64(data, 0)
+	// Survival, no previous game mode, not debug, not flat, no death location
+	data = append(data, 0, 0xFF, 0, 0, 0)
+	data = protocol.AppendVarInt(data, 0)
+
+	// No secure chat enforced
+	return append(data, 0)
+}
+
+func (b *Backend) play(c *protocol.Conn, name string) error {
+	// Keeps the proxy's read timeout from closing an idle connection
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	go func() {
+		for range ticker.C {
+			if err := c.Write(protocol.PlayKeepAlive, binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixMilli()))); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		id, r, err := c.Read()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case protocol.PlayChatMessage:
+			text, err := protocol.ReadString(r)
+			if err != nil {
+				return err
+			}
+
+			b.record(Message{Player: name, Text: text})
+			// Echo like a vanilla server does
+			b.Broadcast("<" + name + "> " + text)
+		case protocol.PlayChatCommand:
+			text, err := protocol.ReadString(r)
+			if err != nil {
+				return err
+			}
+
+			b.record(Message{Player: name, Text: text, Command: true})
+		case protocol.PlayStartConfigAck:
+			// The proxy moves the player elsewhere
+			return nil
+		}
+	}
+}
+
+func (b *Backend) record(msg Message) {
+	b.m.Lock()
+	b.messages = append(b.messages, msg)
+	b.m.Unlock()
+}
+
+// Says reports whether a player sent a message containing text.
+func (b *Backend) Says(player, text string) bool {
+	return slices.ContainsFunc(b.Messages(), func(m Message) bool {
+		return m.Player == player && strings.Contains(m.Text, text)
+	})
+}
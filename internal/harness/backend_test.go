@@ -0,0 +1,81 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/protocol"
+)
+
+func TestBackend(t *testing.T) {
+	b, err := NewBackend("lobby-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	addr := b.Addr().String()
+
+	status, err := protocol.Ping(context.Background(), addr, protocol.Options{Timeout: Timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(status, "lobby-0") {
+		t.Errorf("unexpected status %s", status)
+	}
+
+	chat := make(chan string, 8)
+	c, err := protocol.Connect(context.Background(), addr, "Alice", protocol.Options{
+		Timeout: Timeout,
+		OnChat:  func(data []byte) { chat <- protocol.Text(data) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.WaitJoin(Timeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WaitPlayer("Alice", Timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Chat("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Command("spawn"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case text := <-chat:
+		if !strings.Contains(text, "<Alice> hello") {
+			t.Errorf("unexpected echo %q", text)
+		}
+	case <-time.After(Timeout):
+		t.Fatal("no echo")
+	}
+
+	deadline := time.Now().Add(Timeout)
+	for len(b.Messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if want := []Message{{Player: "Alice", Text: "hello"}, {Player: "Alice", Text: "spawn", Command: true}}; !slices.Equal(b.Messages(), want) {
+		t.Errorf("got messages %+v, want %+v", b.Messages(), want)
+	}
+
+	if err := b.Kick("Alice", "Server closed"); err != nil {
+		t.Fatal(err)
+	}
+
+	<-c.Done()
+	var dc *protocol.DisconnectError
+	if !errors.As(c.Err(), &dc) || dc.Reason != "Server closed" {
+		t.Errorf("got %v, want a disconnect", c.Err())
+	}
+}
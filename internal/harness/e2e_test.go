@@ -0,0 +1,105 @@
+package harness_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/harness"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/rpc"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/protocol"
+)
+
+func TestWhitelistDeny(t *testing.T) {
+	n := harness.Start(t, harness.Options{})
+	lobby := n.Backend(t, "lobby-0", "lobby")
+
+	id := protocol.OfflineUUID("Alice")
+	n.API(t, http.MethodPost, "/whitelist/players", map[string]string{"player": hex.EncodeToString(id[:])})
+	n.API(t, http.MethodPut, "/whitelist/enabled", map[string]bool{"enabled": true})
+
+	n.Join(t, "Alice")
+	if err := lobby.WaitPlayer("Alice", harness.Timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if c, cerr := n.Connect("Bob"); cerr != nil {
+		err = cerr
+	} else {
+		defer c.Close()
+		err = c.Err()
+	}
+
+	var dc *protocol.DisconnectError
+	if !errors.As(err, &dc) || !strings.Contains(dc.Reason, "not whitelisted") {
+		t.Fatalf("got %v, want Bob to be denied", err)
+	}
+
+	if got := lobby.Players(); len(got) != 1 || got[0] != "Alice" {
+		t.Errorf("got players %v on the lobby, want only Alice", got)
+	}
+}
+
+func TestFallbackRouting(t *testing.T) {
+	n := harness.Start(t, harness.Options{})
+	first := n.Backend(t, "lobby-0", "lobby")
+
+	c := n.Join(t, "Alice")
+	if err := first.WaitPlayer("Alice", harness.Timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the second lobby is left to fall back to
+	n.Unregister(t, "lobby-0")
+	second := n.Backend(t, "lobby-1", "lobby")
+
+	c.DropJoin()
+	if err := first.Kick("Alice", "Restarting"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.WaitJoin(harness.Timeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.WaitPlayer("Alice", harness.Timeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	n := harness.Start(t, harness.Options{})
+	n.Backend(t, "lobby-0", "lobby")
+	game := n.Backend(t, "bedwars-0", "bedwars")
+
+	c := n.Join(t, "Alice")
+
+	slot, err := json.Marshal(rpc.GameSlot{ID: "game-1", Gamemode: "bedwars", Server: "bedwars-0", Free: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.H.Messaging().Publish(context.Background(), n.H.Info.MatchmakingSlotsSubject(), slot); err != nil {
+		t.Fatal(err)
+	}
+
+	n.Eventually(t, "the game slot", func() bool {
+		return bytes.Contains(n.API(t, http.MethodGet, "/matchmaking", nil), []byte("game-1"))
+	})
+
+	c.DropJoin()
+	if err := c.Command("play bedwars"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.WaitJoin(harness.Timeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.WaitPlayer("Alice", harness.Timeout); err != nil {
+		t.Fatal(err)
+	}
+}
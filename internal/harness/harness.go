@@ -0,0 +1,300 @@
+// Package harness runs the proxy with all plugins against an embedded NATS
+// server, the in-memory KV and fake backends, for end-to-end tests that
+// need no external infrastructure.
+package harness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/protocol"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/gate"
+	"go.minekube.com/gate/pkg/gate/config"
+)
+
+// Timeout bounds every wait of the harness.
+const Timeout = 15 * time.Second
+
+const token = "harness"
+
+type Options struct {
+	// KVBackend is json (in memory) by default, nats uses JetStream of the
+	// embedded server.
+	KVBackend string
+	// Env is set before the plugins are created, e.g. to enable them.
+	Env map[string]string
+}
+
+// Network is a running proxy, see Start.
+type Network struct {
+	H    *hosting.Hosting
+	Addr string
+
+	api *httptest.Server
+}
+
+// Start runs the proxy until the test ends. proxy.Plugins is global, so
+// tests using the harness must not run in parallel.
+func Start(t testing.TB, opts Options) *Network {
+	t.Helper()
+
+	url := StartNATS(t)
+
+	env := map[string]string{
+		"MESSAGING_BACKEND":         "nats",
+		"MESSAGING_BACKEND_OPTIONS": fmt.Sprintf(`{"url":%q}`, url),
+		"KV_BACKEND":                "json",
+		"STORAGE_BACKEND":           "memory",
+		"OBJECT_STORE_BACKEND":      "memory",
+		"CSMC_NETWORK":              "harness",
+		"POD_NAME":                  "proxy-0",
+		"POD_NAMESPACE":             "harness",
+		"API_ADDR":                  "",
+		"API_TOKEN":                 token,
+		"CONSOLE_ENABLED":           "false",
+	}
+	if opts.KVBackend == "nats" {
+		env["KV_BACKEND"] = "nats"
+		env["KV_BACKEND_OPTIONS"] = fmt.Sprintf(`{"url":%q}`, url)
+	}
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	h, err := hosting.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := plugins.All(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := proxy.Plugins
+	proxy.Plugins = ps
+	t.Cleanup(func() { proxy.Plugins = prev })
+
+	addr := freeAddr(t)
+
+	cfg := config.DefaultConfig
+	cfg.Config.Bind = addr
+	cfg.Config.OnlineMode = false
+	cfg.Config.ForceKeyAuthentication = false
+	cfg.Config.Forwarding.Mode = "none"
+	// Servers come from the instances bucket like in production
+	cfg.Config.Servers = map[string]string{}
+	cfg.Config.Try = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- gate.Start(ctx, gate.WithConfig(cfg))
+	}()
+
+	n := &Network{H: h, Addr: addr, api: httptest.NewServer(h.API())}
+
+	t.Cleanup(func() {
+		n.api.Close()
+		cancel()
+		h.Shutdown()
+
+		select {
+		case <-done:
+		case <-time.After(Timeout):
+			t.Error("proxy didn't stop")
+		}
+	})
+
+	n.waitReady(t, done)
+
+	return n
+}
+
+func freeAddr(t testing.TB) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+// waitReady waits until the proxy answers status pings.
+func (n *Network) waitReady(t testing.TB, done <-chan error) {
+	t.Helper()
+
+	deadline := time.Now().Add(Timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-done:
+			t.Fatalf("proxy stopped: %v", err)
+		default:
+		}
+
+		if _, err := protocol.Ping(context.Background(), n.Addr, protocol.Options{Timeout: time.Second}); err == nil {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("proxy didn't come up")
+}
+
+// Backend starts a fake backend and registers it as an instance of the
+// gamemode, like a game server pod announcing itself.
+func (n *Network) Backend(t testing.TB, name, gamemode string) *Backend {
+	t.Helper()
+
+	b, err := NewBackend(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	n.Register(t, name, hosting.InstanceInfo{Gamemode: gamemode, Address: b.Addr().IP.String(), Port: b.Addr().Port})
+
+	return b
+}
+
+// Register writes an instance and waits until the proxy knows the server.
+func (n *Network) Register(t testing.TB, name string, info hosting.InstanceInfo) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	bucket, err := n.H.KV().Bucket(ctx, n.H.Info.KVInstancesKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bucket.Set(ctx, name, data); err != nil {
+		t.Fatal(err)
+	}
+
+	n.Eventually(t, "server "+name+" registered", func() bool {
+		prx := n.H.Proxy()
+		return prx != nil && prx.Server(name) != nil
+	})
+}
+
+// Unregister deletes an instance, players on it stay connected.
+func (n *Network) Unregister(t testing.TB, name string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	bucket, err := n.H.KV().Bucket(ctx, n.H.Info.KVInstancesKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bucket.Delete(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	n.Eventually(t, "server "+name+" unregistered", func() bool {
+		return n.H.Proxy().Server(name) == nil
+	})
+}
+
+// Join connects an offline player and waits until it joined a server.
+func (n *Network) Join(t testing.TB, name string) *protocol.Client {
+	t.Helper()
+
+	c, err := n.Connect(name)
+	if err != nil {
+		t.Fatalf("%s failed to log in: %v", name, err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	if err := c.WaitJoin(Timeout); err != nil {
+		t.Fatalf("%s failed to join: %v", name, err)
+	}
+
+	return c
+}
+
+// Connect logs in an offline player without waiting for the join, for
+// players that are expected to be denied.
+func (n *Network) Connect(name string) (*protocol.Client, error) {
+	return protocol.Connect(context.Background(), n.Addr, name, protocol.Options{Timeout: Timeout})
+}
+
+// API makes an authorized request to the admin API, body is encoded as JSON
+// unless nil. It fails the test unless the status is 2xx.
+func (n *Network) API(t testing.TB, method, path string, body any) []byte {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, n.api.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.api.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode/100 != 2 {
+		t.Fatalf("%s %s: %s %s", method, path, strconv.Itoa(res.StatusCode), data)
+	}
+
+	return data
+}
+
+// Eventually polls cond until it holds, failing the test after Timeout.
+func (n *Network) Eventually(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
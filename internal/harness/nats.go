@@ -0,0 +1,33 @@
+package harness
+
+import (
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// StartNATS runs an embedded NATS server with JetStream on a random port
+// and returns its URL. It shuts down when the test ends.
+func StartNATS(t testing.TB) string {
+	t.Helper()
+
+	s, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Start()
+	t.Cleanup(s.Shutdown)
+
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server didn't start")
+	}
+
+	return s.ClientURL()
+}
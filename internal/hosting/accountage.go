@@ -0,0 +1,163 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const accountAgeKeyPrefix = "accountage."
+
+// AccountAgeConfig keeps accounts off a gamemode until they are old enough,
+// by the estimate of when they were created: when they first joined the
+// network, or earlier if an external source knows better.
+type AccountAgeConfig struct {
+	// MinDays accounts must be old
+	MinDays int `json:"minDays,omitempty"`
+	// SeenBefore, if set, admits only accounts created before it
+	SeenBefore time.Time `json:"seenBefore"`
+	// DuringIncident applies the config only while incident mode is on
+	DuringIncident bool `json:"duringIncident,omitempty"`
+	// Message is shown to players that are kept off
+	Message string `json:"message,omitempty"`
+}
+
+func (c AccountAgeConfig) Validate() error {
+	if c.MinDays < 0 {
+		return errors.New("minDays must not be negative")
+	}
+
+	if c.MinDays == 0 && c.SeenBefore.IsZero() {
+		return errors.New("minDays or seenBefore is required")
+	}
+
+	return nil
+}
+
+// Admits reports whether an account created at created may join at now.
+// Accounts without an estimate are as new as they get.
+func (c AccountAgeConfig) Admits(created time.Time, known bool, now time.Time) bool {
+	if !known {
+		return false
+	}
+
+	if c.MinDays > 0 && now.Sub(created) < time.Duration(c.MinDays)*24*time.Hour {
+		return false
+	}
+
+	return c.SeenBefore.IsZero() || created.Before(c.SeenBefore)
+}
+
+func (m *InstanceManager) GroupAccountAge(ctx context.Context, gamemode string) (AccountAgeConfig, bool, error) {
+	return kv.Typed[AccountAgeConfig](m.routingKV, accountAgeKeyPrefix+gamemode).Lookup(ctx)
+}
+
+// AccountAge returns the account age config of the gamemode of the server,
+// false if it has none.
+func (m *InstanceManager) AccountAge(ctx context.Context, server proxy.RegisteredServer) (AccountAgeConfig, bool, error) {
+	gamemode, err := m.Gamemode(ctx, server)
+	if err != nil || gamemode == "" {
+		return AccountAgeConfig{}, false, err
+	}
+
+	return m.GroupAccountAge(ctx, gamemode)
+}
+
+func (n *Hosting) GroupAccountAges(ctx context.Context) (map[string]AccountAgeConfig, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ages := make(map[string]AccountAgeConfig)
+	for _, key := range keys {
+		gamemode, ok := strings.CutPrefix(key, accountAgeKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		cfg, err := kv.Typed[AccountAgeConfig](n.rt, key).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ages[gamemode] = cfg
+	}
+
+	return ages, nil
+}
+
+func (n *Hosting) SetGroupAccountAge(ctx context.Context, actor, gamemode string, cfg AccountAgeConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := kv.Typed[AccountAgeConfig](n.rt, accountAgeKeyPrefix+gamemode).Set(ctx, cfg); err != nil {
+		return err
+	}
+
+	details := map[string]string{"minDays": strconv.Itoa(cfg.MinDays), "duringIncident": strconv.FormatBool(cfg.DuringIncident)}
+	if !cfg.SeenBefore.IsZero() {
+		details["seenBefore"] = cfg.SeenBefore.Format(time.RFC3339)
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "routing.accountage", Target: gamemode, Details: details})
+}
+
+func (n *Hosting) DeleteGroupAccountAge(ctx context.Context, actor, gamemode string) error {
+	if err := kv.Typed[AccountAgeConfig](n.rt, accountAgeKeyPrefix+gamemode).Delete(ctx); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "routing.accountage.delete", Target: gamemode})
+}
+
+func (n *Hosting) handleGetAccountAges(w http.ResponseWriter, r *http.Request) {
+	ages, err := n.GroupAccountAges(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, ages)
+}
+
+func (n *Hosting) handleSetAccountAge(w http.ResponseWriter, r *http.Request) {
+	cfg := AccountAgeConfig{}
+	if err := api.ReadJSON(r, &cfg); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetGroupAccountAge(r.Context(), "api", r.PathValue("gamemode"), cfg); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
+
+func (n *Hosting) handleDeleteAccountAge(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteGroupAccountAge(r.Context(), "api", r.PathValue("gamemode")); errors.Is(err, kv.ErrKeyNotFound) {
+		api.WriteError(w, http.StatusNotFound, errors.New("gamemode has no account age requirement"))
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
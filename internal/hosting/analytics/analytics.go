@@ -0,0 +1,170 @@
+// Package analytics publishes what players do on the proxy, joins, quits,
+// server switches, kicks and chat, as JSON events to a messaging subject for
+// the data pipeline. Events are sampled per player, so a sampled player's
+// session is complete, and scrubbed of what the operator doesn't want to
+// leave the network. Chat events never carry the message itself.
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+// Version of the event schema, raised when fields change meaning or go
+// away. New fields don't raise it.
+const Version = 1
+
+var eventsTotal = metrics.NewCounterVec("gate_analytics_events_total", "Analytics events by type and what happened to them.", "type", "result")
+
+type Type string
+
+const (
+	Join   Type = "join"
+	Quit   Type = "quit"
+	Switch Type = "switch"
+	Kick   Type = "kick"
+	Chat   Type = "chat"
+)
+
+// Event is published to <subject>.<type>. Fields that don't apply to the
+// type are left out.
+type Event struct {
+	Version int       `json:"version"`
+	Type    Type      `json:"type"`
+	Time    time.Time `json:"time"`
+	Proxy   string    `json:"proxy"`
+	Network string    `json:"network"`
+	// Player is the undashed UUID, or a salted hash of it if scrubbed
+	Player string `json:"player"`
+	Name   string `json:"name,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	// Server is the one switched to, quit from, kicked from or chatted on
+	Server string `json:"server,omitempty"`
+	// From is the server a switch left, empty for the first one
+	From string `json:"from,omitempty"`
+	// Reason is the plain kick message
+	Reason string `json:"reason,omitempty"`
+	// Session is how many seconds the player was on the proxy when they
+	// quit
+	Session int64 `json:"sessionSeconds,omitempty"`
+	// Length is the length of the chat message in characters
+	Length int `json:"length,omitempty"`
+	// Blocked is set for chat messages that were not delivered
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+const (
+	ScrubIP     = "ip"
+	ScrubPlayer = "player"
+	ScrubName   = "name"
+	ScrubReason = "reason"
+)
+
+type Options struct {
+	// SampleRate is the share of players whose events are published, from
+	// 0 to 1
+	SampleRate float64 `json:"sampleRate"`
+	// Sampling overrides SampleRate for some types, e.g. {"chat": 0.1}
+	Sampling map[Type]float64 `json:"sampling"`
+	// Scrub lists what to leave out, ip, player, name and reason. Players
+	// are replaced by a hash of their UUID and Salt, so sessions can still
+	// be followed. Defaults to ip.
+	Scrub []string `json:"scrub"`
+	Salt  string   `json:"salt"`
+}
+
+// Publisher publishes events. A nil Publisher drops everything, so callers
+// don't need to check whether analytics are set up.
+type Publisher struct {
+	msg     messaging.Messager
+	subject string
+	proxy   string
+	network string
+	opts    Options
+}
+
+func New(msg messaging.Messager, subject, proxy, network string, opts Options) *Publisher {
+	if opts.Scrub == nil {
+		opts.Scrub = []string{ScrubIP}
+	}
+
+	return &Publisher{msg: msg, subject: subject, proxy: proxy, network: network, opts: opts}
+}
+
+// Publish fills in the version, time, proxy and network of the event and
+// publishes it, unless the player isn't sampled for its type.
+func (p *Publisher) Publish(ctx context.Context, e Event) error {
+	if p == nil {
+		return nil
+	}
+
+	e.Player = strings.ToLower(strings.ReplaceAll(e.Player, "-", ""))
+	sum := sha256.Sum256([]byte(p.opts.Salt + e.Player))
+
+	if !p.sampled(e.Type, sum) {
+		eventsTotal.Inc(string(e.Type), "sampled")
+		return nil
+	}
+
+	e.Version = Version
+	e.Time = time.Now()
+	e.Proxy = p.proxy
+	e.Network = p.network
+	p.scrub(&e, sum)
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := p.msg.Publish(ctx, p.subject+"."+string(e.Type), raw); err != nil {
+		eventsTotal.Inc(string(e.Type), "failed")
+		return err
+	}
+
+	eventsTotal.Inc(string(e.Type), "published")
+	return nil
+}
+
+// sampled draws from the hash of the player rather than at random, the
+// same players are sampled on every proxy and for every event.
+func (p *Publisher) sampled(t Type, sum [sha256.Size]byte) bool {
+	rate, ok := p.opts.Sampling[t]
+	if !ok {
+		rate = p.opts.SampleRate
+	}
+
+	if rate >= 1 {
+		return true
+	}
+
+	return float64(binary.BigEndian.Uint64(sum[8:16]))/math.MaxUint64 < rate
+}
+
+func (p *Publisher) scrub(e *Event, sum [sha256.Size]byte) {
+	if slices.Contains(p.opts.Scrub, ScrubIP) {
+		e.IP = ""
+	}
+
+	if slices.Contains(p.opts.Scrub, ScrubPlayer) {
+		e.Player = hex.EncodeToString(sum[:8])
+	}
+
+	if slices.Contains(p.opts.Scrub, ScrubName) {
+		e.Name = ""
+	}
+
+	if slices.Contains(p.opts.Scrub, ScrubReason) {
+		e.Reason = ""
+	}
+}
@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+)
+
+func subscribe(t *testing.T, msg *messaging.Memory, topic string) <-chan messaging.Message {
+	t.Helper()
+
+	ch := make(chan messaging.Message, 16)
+	if err := msg.Subscribe(topic, func(m messaging.Message) { ch <- m }); err != nil {
+		t.Fatal(err)
+	}
+
+	return ch
+}
+
+func TestPublishScrubs(t *testing.T) {
+	msg := messaging.NewMemory()
+	ch := subscribe(t, msg, "csmc.default.main.analytics.>")
+
+	p := New(msg, "csmc.default.main.analytics", "proxy-0", "main", Options{SampleRate: 1, Scrub: []string{ScrubIP, ScrubPlayer}, Salt: "pepper"})
+	err := p.Publish(context.Background(), Event{
+		Type:   Switch,
+		Player: "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+		Name:   "Notch",
+		IP:     "10.0.0.7",
+		Server: "bedwars-1",
+		From:   "lobby-0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-ch:
+		if m.Topic != "csmc.default.main.analytics.switch" {
+			t.Fatalf("unexpected topic %s", m.Topic)
+		}
+
+		e := Event{}
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.IP != "" || e.Player == "" || e.Player == "069a79f444e94726a5befca90e38aaf5" {
+			t.Fatalf("expected the player hashed and the IP removed, got %+v", e)
+		}
+
+		if e.Version != Version || e.Proxy != "proxy-0" || e.Network != "main" || e.Name != "Notch" || e.Server != "bedwars-1" || e.From != "lobby-0" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an event")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	msg := messaging.NewMemory()
+	p := New(msg, "analytics", "proxy-0", "main", Options{SampleRate: 0.5, Sampling: map[Type]float64{Chat: 0}})
+
+	sampled := 0
+	for i := range 1000 {
+		sum := sha256.Sum256([]byte(fmt.Sprint(i)))
+
+		if p.sampled(Join, sum) != p.sampled(Join, sum) {
+			t.Fatal("expected the same player to be sampled the same way")
+		}
+
+		if p.sampled(Chat, sum) {
+			t.Fatal("expected no chat events at a rate of 0")
+		}
+
+		if p.sampled(Join, sum) {
+			sampled++
+		}
+	}
+
+	if sampled < 300 || sampled > 700 {
+		t.Fatalf("expected about half of the players sampled, got %d of 1000", sampled)
+	}
+}
+
+func TestNilPublisher(t *testing.T) {
+	var p *Publisher
+	if err := p.Publish(context.Background(), Event{Type: Join}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+type Options struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+	// TLSCert and TLSKey enable TLS, the files are reloaded when they
+	// change. TLSClientCA additionally requires client certificates signed
+	// by it.
+	TLSCert       string `json:"tlsCert"`
+	TLSKey        string `json:"tlsKey"`
+	TLSClientCA   string `json:"tlsClientCA"`
+	TLSMinVersion string `json:"tlsMinVersion"`
+	TLSCiphers    string `json:"tlsCiphers"`
+}
+
+// Server is the admin HTTP API shared by all plugins. Plugins register their
+// routes during Init, every route requires the bearer token.
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+}
+
+func New(opts Options) *Server {
+	return &Server{
+		opts: opts,
+		mux:  http.NewServeMux(),
+	}
+}
+
+func (s *Server) Enabled() bool {
+	return s.opts.Addr != ""
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.authenticated(handler))
+}
+
+func (s *Server) HandleFunc(pattern string, handler func(w http.ResponseWriter, r *http.Request)) {
+	s.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// HandlePublic registers a route that does not require the token, meant for
+// probes that can't send one.
+func (s *Server) HandlePublic(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) HandlePublicFunc(pattern string, handler func(w http.ResponseWriter, r *http.Request)) {
+	s.HandlePublic(pattern, http.HandlerFunc(handler))
+}
+
+// ServeHTTP serves the API without ListenAndServe, e.g. from httptest in
+// end-to-end tests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	correlated(s.mux).ServeHTTP(w, r)
+}
+
+func (s *Server) ListenAndServe() error {
+	if !s.Enabled() {
+		log.Println("Admin API is disabled")
+		return nil
+	}
+
+	cfg, err := s.opts.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	l, err := util.Listen(s.opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: correlated(s.mux), TLSConfig: cfg}
+
+	if cfg == nil {
+		log.Printf("Admin API listening on %s", s.opts.Addr)
+		return srv.Serve(l)
+	}
+
+	log.Printf("Admin API listening on %s with TLS", s.opts.Addr)
+
+	return srv.ServeTLS(l, "", "")
+}
+
+func (s *Server) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			WriteError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// correlated gives every request the correlation ID of its
+// Csmc-Correlation-Id header, if valid, or a new one, and returns it in the response.
+// Messages the request leads to carry the same ID.
+func correlated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlation.Header)
+		if !correlation.Valid(id) {
+			id = correlation.New()
+		}
+
+		w.Header().Set(correlation.Header, id)
+		next.ServeHTTP(w, r.WithContext(correlation.With(r.Context(), id)))
+	})
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode API response: %v", err)
+	}
+}
+
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func ReadJSON(r *http.Request, v any) error {
+	defer r.Body.Close()
+
+	return json.NewDecoder(r.Body).Decode(v)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most once per handshake.
+const certCheckInterval = 10 * time.Second
+
+// certLoader serves a certificate from files and reloads it when they
+// change, so renewed certificates are picked up without a restart.
+type certLoader struct {
+	certFile string
+	keyFile  string
+
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+	m       sync.Mutex
+}
+
+func newCertLoader(certFile, keyFile string) (*certLoader, error) {
+	l := &certLoader{certFile: certFile, keyFile: keyFile}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *certLoader) modified() (time.Time, error) {
+	cert, err := os.Stat(l.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	key, err := os.Stat(l.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if key.ModTime().After(cert.ModTime()) {
+		return key.ModTime(), nil
+	}
+
+	return cert.ModTime(), nil
+}
+
+func (l *certLoader) load() error {
+	modTime, err := l.modified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+
+	l.cert = &cert
+	l.modTime = modTime
+
+	return nil
+}
+
+func (l *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if time.Since(l.checked) < certCheckInterval {
+		return l.cert, nil
+	}
+	l.checked = time.Now()
+
+	// A failed reload keeps serving the old certificate, the files may be
+	// in the middle of being replaced
+	if modTime, err := l.modified(); err == nil && modTime.After(l.modTime) {
+		if err := l.load(); err != nil {
+			log.Printf("Failed to reload admin API certificate: %v", err)
+		} else {
+			log.Println("Reloaded admin API certificate")
+		}
+	}
+
+	return l.cert, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func cipherSuites(names string) ([]uint16, error) {
+	if names == "" {
+		return nil, nil
+	}
+
+	byName := make(map[string]uint16)
+	for _, c := range tls.CipherSuites() {
+		byName[c.Name] = c.ID
+	}
+
+	ids := make([]uint16, 0)
+	for _, name := range strings.Split(names, ",") {
+		id, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// tlsConfig returns nil if TLS is not configured.
+func (o Options) tlsConfig() (*tls.Config, error) {
+	if o.TLSCert == "" && o.TLSKey == "" {
+		if o.TLSClientCA != "" {
+			return nil, errors.New("a client CA requires a certificate and key")
+		}
+
+		return nil, nil
+	}
+
+	loader, err := newCertLoader(o.TLSCert, o.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{GetCertificate: loader.GetCertificate, MinVersion: tls.VersionTLS12}
+
+	if o.TLSMinVersion != "" {
+		v, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q", o.TLSMinVersion)
+		}
+
+		cfg.MinVersion = v
+	}
+
+	// TLS 1.3 suites are not configurable, this only affects TLS 1.2
+	if cfg.CipherSuites, err = cipherSuites(o.TLSCiphers); err != nil {
+		return nil, err
+	}
+
+	if o.TLSClientCA != "" {
+		raw, err := os.ReadFile(o.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificates in %s", o.TLSClientCA)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`
+	Action  string            `json:"action"`
+	Target  string            `json:"target"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Log is an append-only audit trail. Every entry is stored under its own key
+// so concurrent writers on different proxies never overwrite each other.
+type Log struct {
+	kv kv.Bucket
+
+	listeners []func(Entry)
+	m         sync.RWMutex
+}
+
+func New(kv kv.Bucket) *Log {
+	return &Log{kv: kv}
+}
+
+func (l *Log) Record(ctx context.Context, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	val, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%020d", e.Time.UnixNano())
+
+	log.Printf("AUDIT: %s %s %s %v", e.Actor, e.Action, e.Target, e.Details)
+
+	if err := l.kv.Set(ctx, key, val); err != nil {
+		return err
+	}
+
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	for _, fn := range l.listeners {
+		fn(e)
+	}
+
+	return nil
+}
+
+// OnRecord calls fn with every entry recorded on this proxy, after it was
+// stored.
+func (l *Log) OnRecord(fn func(Entry)) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.listeners = append(l.listeners, fn)
+}
+
+// List returns all entries, oldest first.
+func (l *Log) List(ctx context.Context) ([]Entry, error) {
+	keys, err := l.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(keys)
+
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		v, err := l.kv.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		e := Entry{}
+		if err := json.Unmarshal(v, &e); err != nil {
+			log.Printf("Failed to unmarshal audit entry %s: %v", key, err)
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,154 @@
+package hosting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+// Availability decides how a plugin behaves while its KV data can't be
+// loaded or its watcher is disconnected.
+type Availability string
+
+const (
+	// AvailabilityOpen lets everyone through, as if the plugin was off
+	AvailabilityOpen Availability = "fail-open"
+	// AvailabilityClosed denies everyone
+	AvailabilityClosed Availability = "fail-closed"
+	// AvailabilityLastKnown keeps deciding with the last data it loaded,
+	// from the snapshot on disk if it couldn't load any since starting
+	AvailabilityLastKnown Availability = "last-known"
+)
+
+// Availability returns the policy of the named plugin, configured through
+// AVAILABILITY_POLICIES, e.g. {"Whitelist":"fail-closed"}, or def.
+func (n *Hosting) Availability(plugin string, def Availability) Availability {
+	raw := util.EnvWithDefault("AVAILABILITY_POLICIES", "")
+	if raw == "" {
+		return def
+	}
+
+	policies := make(map[string]Availability)
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		log.Printf("Ignoring invalid AVAILABILITY_POLICIES: %v", err)
+		return def
+	}
+
+	switch p := policies[plugin]; p {
+	case AvailabilityOpen, AvailabilityClosed, AvailabilityLastKnown:
+		return p
+	case "":
+		return def
+	default:
+		log.Printf("Ignoring unknown availability policy %q for %s", p, plugin)
+		return def
+	}
+}
+
+// Connected reports whether every watcher of the bucket is connected. A
+// bucket without watchers counts as connected.
+func (n *Hosting) Connected(bucket string) bool {
+	for _, s := range kv.WatchStates() {
+		if s.Bucket == bucket && !s.Connected {
+			return false
+		}
+	}
+
+	return true
+}
+
+type snapshot struct {
+	Saved time.Time       `json:"saved"`
+	Data  json.RawMessage `json:"data"`
+}
+
+var ErrNoSnapshot = errors.New("no snapshot")
+
+func snapshotPath(name string) (string, bool) {
+	dir := util.EnvWithDefault("SNAPSHOT_DIR", "")
+	if dir == "" {
+		return "", false
+	}
+
+	return filepath.Join(dir, strings.ReplaceAll(name, "/", "_")+".json"), true
+}
+
+// SaveSnapshot persists v as JSON under SNAPSHOT_DIR, so it can be loaded with
+// LoadSnapshot after a restart during a KV outage. An empty SNAPSHOT_DIR
+// disables snapshots.
+func (n *Hosting) SaveSnapshot(name string, v any) error {
+	path, ok := snapshotPath(name)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(snapshot{Saved: time.Now(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Written next to it and renamed, a crash never leaves half a snapshot
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// LoadSnapshot decodes the snapshot saved under name into v and returns when
+// it was saved, or ErrNoSnapshot.
+func (n *Hosting) LoadSnapshot(name string, v any) (time.Time, error) {
+	path, ok := snapshotPath(name)
+	if !ok {
+		return time.Time{}, ErrNoSnapshot
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, ErrNoSnapshot
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	s := snapshot{}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return time.Time{}, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(s.Data, v); err != nil {
+		return time.Time{}, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+
+	return s.Saved, nil
+}
+
+// handleGetSnapshots lists the buckets copied to disk through KV_SNAPSHOTS,
+// and whether their reads are served from the copy right now.
+func (n *Hosting) handleGetSnapshots(w http.ResponseWriter, r *http.Request) {
+	if n.snp == nil {
+		api.WriteJSON(w, http.StatusOK, []kv.SnapshotState{})
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, n.snp.States())
+}
@@ -0,0 +1,137 @@
+package hosting
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var backendsUp = metrics.NewGaugeVec("gate_backends_up", "Backends that accepted a connection at the last probe.")
+
+// backends is the state of the backends as of the last probe. recovered is
+// closed once a backend is up again after all were down.
+type backends struct {
+	up        map[string]bool
+	down      bool
+	since     time.Time
+	recovered chan struct{}
+	m         sync.RWMutex
+}
+
+type backendsResponse struct {
+	Down    bool            `json:"down"`
+	Since   time.Time       `json:"since,omitempty"`
+	Servers map[string]bool `json:"servers"`
+}
+
+// BackendsDown reports whether no backend accepted a connection at the last
+// probe, and since when.
+func (n *Hosting) BackendsDown() (bool, time.Time) {
+	n.bk.m.RLock()
+	defer n.bk.m.RUnlock()
+
+	return n.bk.down, n.bk.since
+}
+
+// WaitForBackends blocks until a backend is up, false if ctx is done first.
+func (n *Hosting) WaitForBackends(ctx context.Context) bool {
+	n.bk.m.RLock()
+	down, recovered := n.bk.down, n.bk.recovered
+	n.bk.m.RUnlock()
+
+	if !down {
+		return true
+	}
+
+	select {
+	case <-recovered:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// probeBackends dials every backend each interval until ctx is done. A dial
+// is cheaper than a status ping and tells the same, whether players can be
+// sent there.
+func (n *Hosting) probeBackends(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			prx := n.prx.Load()
+			if prx == nil {
+				continue
+			}
+
+			up := make(map[string]bool)
+			m := sync.Mutex{}
+			wg := sync.WaitGroup{}
+
+			for _, s := range prx.Servers() {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					d := net.Dialer{Timeout: timeout}
+					c, err := d.DialContext(ctx, "tcp", s.ServerInfo().Addr().String())
+					if err == nil {
+						_ = c.Close()
+					}
+
+					m.Lock()
+					up[s.ServerInfo().Name()] = err == nil
+					m.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			n.setBackends(up, now)
+		}
+	}
+}
+
+func (n *Hosting) setBackends(up map[string]bool, now time.Time) {
+	count := 0
+	for _, ok := range up {
+		if ok {
+			count++
+		}
+	}
+	backendsUp.Set(int64(count))
+
+	n.bk.m.Lock()
+	defer n.bk.m.Unlock()
+
+	n.bk.up = up
+
+	switch {
+	case count == 0 && !n.bk.down:
+		log.Printf("All %d backends are down", len(up))
+
+		n.bk.down, n.bk.since = true, now
+		n.bk.recovered = make(chan struct{})
+	case count > 0 && n.bk.down:
+		log.Printf("%d backends recovered after %s", count, now.Sub(n.bk.since).Round(time.Second))
+
+		n.bk.down, n.bk.since = false, time.Time{}
+		close(n.bk.recovered)
+	}
+}
+
+func (n *Hosting) handleGetBackends(w http.ResponseWriter, r *http.Request) {
+	n.bk.m.RLock()
+	defer n.bk.m.RUnlock()
+
+	api.WriteJSON(w, http.StatusOK, backendsResponse{Down: n.bk.down, Since: n.bk.since, Servers: n.bk.up})
+}
@@ -0,0 +1,171 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/backup"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+)
+
+func (n *Hosting) Backup(ctx context.Context) (*backup.Snapshot, error) {
+	return backup.Take(ctx, n.kv, n.Info.PodName)
+}
+
+// Restore writes a snapshot back and records it in the audit log unless it is
+// a dry run.
+func (n *Hosting) Restore(ctx context.Context, actor string, s *backup.Snapshot, opts backup.RestoreOptions) (*backup.Diff, error) {
+	diff, err := backup.Restore(ctx, n.kv, s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return diff, nil
+	}
+
+	buckets := make([]string, 0, len(diff.Buckets))
+	for name := range diff.Buckets {
+		buckets = append(buckets, name)
+	}
+
+	if err := n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "backup.restore",
+		Target: s.Manifest.CreatedAt.Format(time.RFC3339),
+		Details: map[string]string{
+			"buckets": strings.Join(buckets, ","),
+			"prune":   strconv.FormatBool(opts.Prune),
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+func (n *Hosting) handleBackup(w http.ResponseWriter, r *http.Request) {
+	s, err := n.Backup(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backupFileName(s)))
+
+	if err := s.Write(w); err != nil {
+		// Headers are already sent, the client sees a truncated archive
+		return
+	}
+}
+
+// handleRestore takes the tarball as body, or the name of a stored backup as
+// the object query parameter. Other parameters: buckets (comma separated),
+// prune and dryRun.
+func (n *Hosting) handleRestore(w http.ResponseWriter, r *http.Request) {
+	opts := backup.RestoreOptions{}
+
+	if raw := r.URL.Query().Get("buckets"); raw != "" {
+		opts.Buckets = strings.Split(raw, ",")
+	}
+
+	for name, dst := range map[string]*bool{"prune": &opts.Prune, "dryRun": &opts.DryRun} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		*dst = v
+	}
+
+	var body io.Reader = r.Body
+	if name := r.URL.Query().Get("object"); name != "" {
+		obj, err := n.obj.Get(r.Context(), name)
+		if errors.Is(err, object.ErrObjectNotFound) {
+			api.WriteError(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		defer obj.Close()
+
+		body = obj
+	}
+
+	s, err := backup.Read(body)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	diff, err := n.Restore(r.Context(), "api", s, opts)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, diff)
+}
+
+const backupPrefix = "backups/"
+
+// StoreBackup takes a snapshot and uploads it to the object store.
+func (n *Hosting) StoreBackup(ctx context.Context) (string, error) {
+	s, err := n.Backup(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.Write(pw))
+	}()
+
+	name := backupPrefix + backupFileName(s)
+	if err := n.obj.Put(ctx, name, pr); err != nil {
+		pr.CloseWithError(err)
+		return "", err
+	}
+
+	return name, nil
+}
+
+func (n *Hosting) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	infos, err := n.obj.List(r.Context(), backupPrefix)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, infos)
+}
+
+func (n *Hosting) handleStoreBackup(w http.ResponseWriter, r *http.Request) {
+	name, err := n.StoreBackup(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusCreated, map[string]string{"name": name})
+}
+
+func backupFileName(s *backup.Snapshot) string {
+	return fmt.Sprintf("%s-%s.tar.gz", s.Manifest.Pod, s.Manifest.CreatedAt.Format("20060102-150405"))
+}
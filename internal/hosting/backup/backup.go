@@ -0,0 +1,339 @@
+// Package backup snapshots every KV bucket into a gzipped tarball and restores
+// them, optionally only some buckets and optionally as a dry run.
+//
+// The archive contains a manifest.json followed by one file per key at
+// buckets/<bucket>/<path escaped key>.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+const (
+	Version      = 1
+	manifestName = "manifest.json"
+	bucketsDir   = "buckets/"
+)
+
+var (
+	ErrNoManifest         = errors.New("backup has no manifest")
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+)
+
+type Manifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Pod       string         `json:"pod"`
+	Buckets   map[string]int `json:"buckets"`
+}
+
+type Snapshot struct {
+	Manifest Manifest
+	Data     map[string]map[string][]byte
+}
+
+// Take reads every bucket of the client into memory.
+func Take(ctx context.Context, client kv.Client, pod string) (*Snapshot, error) {
+	names, err := client.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Manifest: Manifest{
+			Version:   Version,
+			CreatedAt: time.Now().UTC(),
+			Pod:       pod,
+			Buckets:   make(map[string]int),
+		},
+		Data: make(map[string]map[string][]byte),
+	}
+
+	for _, name := range names {
+		b, err := client.Bucket(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := b.ListKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			v, err := b.Get(ctx, key)
+			if errors.Is(err, kv.ErrKeyNotFound) {
+				// Deleted since it was listed
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read %s/%s: %w", name, key, err)
+			}
+
+			data[key] = v
+		}
+
+		s.Data[name] = data
+		s.Manifest.Buckets[name] = len(data)
+	}
+
+	return s, nil
+}
+
+// Write writes the snapshot as a gzipped tarball.
+func (s *Snapshot) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(s.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(tw, manifestName, manifest, s.Manifest.CreatedAt); err != nil {
+		return err
+	}
+
+	buckets := make([]string, 0, len(s.Data))
+	for name := range s.Data {
+		buckets = append(buckets, name)
+	}
+	slices.Sort(buckets)
+
+	for _, name := range buckets {
+		keys := make([]string, 0, len(s.Data[name]))
+		for key := range s.Data[name] {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			path := bucketsDir + url.PathEscape(name) + "/" + url.PathEscape(key)
+			if err := writeFile(tw, path, s.Data[name][key], s.Manifest.CreatedAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(data)
+
+	return err
+}
+
+// Read parses a tarball written by Write.
+func Read(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	s := &Snapshot{Data: make(map[string]map[string][]byte)}
+	hasManifest := false
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Name == manifestName {
+			if err := json.Unmarshal(data, &s.Manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+
+			if s.Manifest.Version != Version {
+				return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, s.Manifest.Version)
+			}
+
+			hasManifest = true
+			continue
+		}
+
+		rest, ok := strings.CutPrefix(hdr.Name, bucketsDir)
+		if !ok {
+			continue
+		}
+
+		rawBucket, rawKey, ok := strings.Cut(rest, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid backup entry %s", hdr.Name)
+		}
+
+		bucket, err := url.PathUnescape(rawBucket)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := url.PathUnescape(rawKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Data[bucket] == nil {
+			s.Data[bucket] = make(map[string][]byte)
+		}
+		s.Data[bucket][key] = data
+	}
+
+	if !hasManifest {
+		return nil, ErrNoManifest
+	}
+
+	// Buckets without keys only show up in the manifest
+	for name := range s.Manifest.Buckets {
+		if s.Data[name] == nil {
+			s.Data[name] = make(map[string][]byte)
+		}
+	}
+
+	return s, nil
+}
+
+type RestoreOptions struct {
+	// Buckets limits the restore to these buckets, all buckets if empty.
+	Buckets []string `json:"buckets,omitempty"`
+	// Prune deletes keys that are not in the backup.
+	Prune  bool `json:"prune"`
+	DryRun bool `json:"dryRun"`
+}
+
+type BucketDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func (d *BucketDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+type Diff struct {
+	DryRun  bool                   `json:"dryRun"`
+	Buckets map[string]*BucketDiff `json:"buckets"`
+}
+
+// Restore writes the snapshot back into the client. Keys that are identical
+// are left alone, so the returned diff only lists what actually changed.
+func Restore(ctx context.Context, client kv.Client, s *Snapshot, opts RestoreOptions) (*Diff, error) {
+	diff := &Diff{DryRun: opts.DryRun, Buckets: make(map[string]*BucketDiff)}
+
+	for name, data := range s.Data {
+		if len(opts.Buckets) > 0 && !slices.Contains(opts.Buckets, name) {
+			continue
+		}
+
+		b, err := client.Bucket(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := restoreBucket(ctx, b, data, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore bucket %s: %w", name, err)
+		}
+
+		if !d.empty() {
+			diff.Buckets[name] = d
+		}
+	}
+
+	return diff, nil
+}
+
+func restoreBucket(ctx context.Context, b kv.Bucket, data map[string][]byte, opts RestoreOptions) (*BucketDiff, error) {
+	d := &BucketDiff{}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		current, err := b.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			d.Added = append(d.Added, key)
+		} else if err != nil {
+			return nil, err
+		} else if bytes.Equal(current, data[key]) {
+			continue
+		} else {
+			d.Changed = append(d.Changed, key)
+		}
+
+		if opts.DryRun {
+			continue
+		}
+
+		if err := b.Set(ctx, key, data[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	if !opts.Prune {
+		return d, nil
+	}
+
+	existing, err := b.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(existing)
+
+	for _, key := range existing {
+		if _, ok := data[key]; ok {
+			continue
+		}
+
+		d.Removed = append(d.Removed, key)
+
+		if opts.DryRun {
+			continue
+		}
+
+		if err := b.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
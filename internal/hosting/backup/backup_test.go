@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+
+	src, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := src.Bucket(ctx, "network_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "enabled", []byte("true")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "a/b.c", []byte("escaped")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := src.Bucket(ctx, "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := Take(ctx, src, "test-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := snap.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Manifest.Pod != "test-0" || restored.Manifest.Buckets["network_whitelist"] != 2 {
+		t.Fatalf("unexpected manifest: %+v", restored.Manifest)
+	}
+
+	if _, ok := restored.Data["empty"]; !ok {
+		t.Fatal("expected empty bucket to be restored")
+	}
+
+	if string(restored.Data["network_whitelist"]["a/b.c"]) != "escaped" {
+		t.Fatalf("unexpected data: %v", restored.Data)
+	}
+
+	dst, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := dst.Bucket(ctx, "network_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Set(ctx, "enabled", []byte("false")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Set(ctx, "stale", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RestoreOptions{Buckets: []string{"network_whitelist"}, Prune: true, DryRun: true}
+
+	diff, err := Restore(ctx, dst, restored, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := diff.Buckets["network_whitelist"]
+	if d == nil || !slices.Equal(d.Added, []string{"a/b.c"}) || !slices.Equal(d.Changed, []string{"enabled"}) || !slices.Equal(d.Removed, []string{"stale"}) {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+
+	if v, _ := db.Get(ctx, "enabled"); string(v) != "false" {
+		t.Fatal("dry run must not write")
+	}
+
+	opts.DryRun = false
+	if _, err := Restore(ctx, dst, restored, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := db.Get(ctx, "enabled"); string(v) != "true" {
+		t.Fatalf("expected enabled to be restored, got %s", v)
+	}
+
+	if _, err := db.Get(ctx, "stale"); err != kv.ErrKeyNotFound {
+		t.Fatalf("expected stale key to be pruned, got %v", err)
+	}
+
+	buckets, err := dst.ListBuckets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.Contains(buckets, "empty") {
+		t.Fatal("bucket filter was ignored")
+	}
+}
@@ -0,0 +1,106 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/bandwidth"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/common/minecraft/color"
+	"go.minekube.com/common/minecraft/component"
+)
+
+var (
+	bandwidthBytes     = metrics.NewCounterVec("gate_bandwidth_bytes_total", "Bytes of client connections by the server the player was on, in is read from the client.", "server", "direction")
+	bandwidthCapAlerts = metrics.NewCounterVec("gate_bandwidth_cap_alerts_total", "Players that went over the bandwidth soft cap.")
+)
+
+// Bandwidth counts the bytes of the connections that plugins meter, e.g.
+// those of the additional listeners.
+func (n *Hosting) Bandwidth() *bandwidth.Meter {
+	return n.bw
+}
+
+// sampleBandwidth attributes the bytes of the connections to players and
+// servers and alerts staff about players going over the soft cap, in bytes
+// per second. A cap of 0 never alerts.
+func (n *Hosting) sampleBandwidth(ctx context.Context, interval time.Duration, softCap int64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// alerted are the connections over the cap, alerted about once until
+	// they drop below it
+	alerted := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			prx := n.prx.Load()
+			if prx == nil {
+				continue
+			}
+
+			players := make(map[string]bandwidth.Player)
+			for _, player := range prx.Players() {
+				p := bandwidth.Player{Name: player.Username()}
+				if s := player.CurrentServer(); s != nil {
+					p.Server = s.Server().ServerInfo().Name()
+				}
+
+				players[player.RemoteAddr().String()] = p
+			}
+
+			for _, d := range n.bw.Sample(interval, players) {
+				server := d.Server
+				if server == "" {
+					server = "none"
+				}
+
+				bandwidthBytes.Add(d.In, server, "in")
+				bandwidthBytes.Add(d.Out, server, "out")
+			}
+
+			if softCap <= 0 {
+				continue
+			}
+
+			over := make(map[string]bool)
+			for _, u := range n.bw.Usage() {
+				if u.Rate() <= softCap {
+					break
+				}
+
+				over[u.Remote] = true
+				if alerted[u.Remote] || u.Player == "" {
+					continue
+				}
+
+				log.Printf("%s (%s) uses %s, over the soft cap of %s", u.Player, u.Remote, bandwidth.FormatRate(u.Rate()), bandwidth.FormatRate(softCap))
+				bandwidthCapAlerts.Inc()
+
+				msg := &component.Text{Content: fmt.Sprintf("%s uses %s on %s, over the soft cap of %s.", u.Player, bandwidth.FormatRate(u.Rate()), u.Server, bandwidth.FormatRate(softCap)), S: component.Style{Color: color.Gold}}
+				for _, player := range prx.Players() {
+					if player.HasPermission("csmc.bandwidth") {
+						_ = player.SendMessage(msg)
+					}
+				}
+			}
+			alerted = over
+		}
+	}
+}
+
+type bandwidthResponse struct {
+	Players  []bandwidth.Usage   `json:"players"`
+	Backends []bandwidth.Backend `json:"backends"`
+}
+
+func (n *Hosting) handleGetBandwidth(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, bandwidthResponse{Players: n.bw.Usage(), Backends: n.bw.Backends()})
+}
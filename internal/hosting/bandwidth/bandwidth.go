@@ -0,0 +1,210 @@
+// Package bandwidth counts the bytes of proxied connections. Connections
+// count their bytes as they are read and written, a sampler attributes them
+// to the player and the backend server the player is on and computes rates.
+package bandwidth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Conn counts the bytes of one client connection, it is safe to use from
+// the reading and writing goroutine at once.
+type Conn struct {
+	in, out atomic.Int64
+}
+
+// Read counts n bytes read from the client.
+func (c *Conn) Read(n int) {
+	c.in.Add(int64(n))
+}
+
+// Wrote counts n bytes written to the client.
+func (c *Conn) Wrote(n int) {
+	c.out.Add(int64(n))
+}
+
+// Player is who a connection belongs to when it is sampled.
+type Player struct {
+	Name   string
+	Server string
+}
+
+type Usage struct {
+	Remote string `json:"remote"`
+	Player string `json:"player,omitempty"`
+	Server string `json:"server,omitempty"`
+	// In and Out are the bytes since the connection opened
+	In  int64 `json:"in"`
+	Out int64 `json:"out"`
+	// InRate and OutRate are in bytes per second over the last sample
+	InRate  int64     `json:"inRate"`
+	OutRate int64     `json:"outRate"`
+	Opened  time.Time `json:"opened"`
+}
+
+// Rate is the bytes per second in both directions.
+func (u Usage) Rate() int64 {
+	return u.InRate + u.OutRate
+}
+
+// Backend is the bytes of the players while they were on a server.
+type Backend struct {
+	Server string `json:"server"`
+	In     int64  `json:"in"`
+	Out    int64  `json:"out"`
+}
+
+type entry struct {
+	conn  *Conn
+	usage Usage
+}
+
+type Meter struct {
+	conns    map[string]*entry
+	backends map[string]*Backend
+	m        sync.Mutex
+}
+
+func New() *Meter {
+	return &Meter{conns: make(map[string]*entry), backends: make(map[string]*Backend)}
+}
+
+// Conn starts counting the connection from remote.
+func (m *Meter) Conn(remote string, now time.Time) *Conn {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	c := &Conn{}
+	m.conns[remote] = &entry{conn: c, usage: Usage{Remote: remote, Opened: now}}
+
+	return c
+}
+
+// Close stops counting the connection. Bytes since the last sample are
+// not attributed to a backend.
+func (m *Meter) Close(remote string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	delete(m.conns, remote)
+}
+
+// Sample attributes the bytes since the last sample, elapsed ago, to the
+// players of the connections and the servers they are on now, and returns
+// the bytes by server. Bytes of connections without a server are returned
+// under "".
+func (m *Meter) Sample(elapsed time.Duration, players map[string]Player) []Backend {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	deltas := make(map[string]*Backend)
+	for remote, e := range m.conns {
+		in, out := e.conn.in.Load(), e.conn.out.Load()
+		dIn, dOut := in-e.usage.In, out-e.usage.Out
+
+		if p, ok := players[remote]; ok {
+			e.usage.Player, e.usage.Server = p.Name, p.Server
+		}
+
+		e.usage.In, e.usage.Out = in, out
+		if elapsed > 0 {
+			e.usage.InRate = int64(float64(dIn) / elapsed.Seconds())
+			e.usage.OutRate = int64(float64(dOut) / elapsed.Seconds())
+		}
+
+		d, ok := deltas[e.usage.Server]
+		if !ok {
+			d = &Backend{Server: e.usage.Server}
+			deltas[e.usage.Server] = d
+		}
+		d.In += dIn
+		d.Out += dOut
+	}
+
+	list := make([]Backend, 0, len(deltas))
+	for server, d := range deltas {
+		list = append(list, *d)
+
+		if server == "" {
+			continue
+		}
+
+		b, ok := m.backends[server]
+		if !ok {
+			b = &Backend{Server: server}
+			m.backends[server] = b
+		}
+		b.In += d.In
+		b.Out += d.Out
+	}
+
+	slices.SortFunc(list, func(a, b Backend) int {
+		return strings.Compare(a.Server, b.Server)
+	})
+
+	return list
+}
+
+// Usage returns the connections as of the last sample, the highest rate
+// first.
+func (m *Meter) Usage() []Usage {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	list := make([]Usage, 0, len(m.conns))
+	for _, e := range m.conns {
+		list = append(list, e.usage)
+	}
+
+	slices.SortFunc(list, func(a, b Usage) int {
+		if a.Rate() != b.Rate() {
+			return int(b.Rate() - a.Rate())
+		}
+
+		return strings.Compare(a.Remote, b.Remote)
+	})
+
+	return list
+}
+
+// Backends returns the bytes by server since the proxy started, sorted by
+// server.
+func (m *Meter) Backends() []Backend {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	list := make([]Backend, 0, len(m.backends))
+	for _, b := range m.backends {
+		list = append(list, *b)
+	}
+
+	slices.SortFunc(list, func(a, b Backend) int {
+		return strings.Compare(a.Server, b.Server)
+	})
+
+	return list
+}
+
+// FormatRate formats bytes per second, e.g. 1.5 MB/s.
+func FormatRate(rate int64) string {
+	return FormatBytes(rate) + "/s"
+}
+
+// FormatBytes formats bytes with a decimal unit, e.g. 1.5 MB.
+func FormatBytes(b int64) string {
+	switch {
+	case b >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(b)/1e9)
+	case b >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(b)/1e6)
+	case b >= 1e3:
+		return fmt.Sprintf("%.1f kB", float64(b)/1e3)
+	default:
+		return fmt.Sprintf("%d B", b)
+	}
+}
@@ -0,0 +1,52 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSample(t *testing.T) {
+	m := New()
+
+	a := m.Conn("10.0.0.1:1000", now)
+	b := m.Conn("10.0.0.2:1000", now)
+
+	a.Read(1000)
+	a.Wrote(9000)
+	b.Read(100)
+
+	deltas := m.Sample(10*time.Second, map[string]Player{
+		"10.0.0.1:1000": {Name: "Notch", Server: "lobby-0"},
+	})
+
+	if len(deltas) != 2 || deltas[0].Server != "" || deltas[0].In != 100 || deltas[1].Server != "lobby-0" || deltas[1].Out != 9000 {
+		t.Fatalf("unexpected deltas %+v", deltas)
+	}
+
+	usage := m.Usage()
+	if len(usage) != 2 || usage[0].Player != "Notch" || usage[0].InRate != 100 || usage[0].OutRate != 900 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	// The player switched, only the new bytes go to the new server
+	a.Wrote(500)
+	m.Sample(10*time.Second, map[string]Player{
+		"10.0.0.1:1000": {Name: "Notch", Server: "survival-0"},
+	})
+
+	backends := m.Backends()
+	if len(backends) != 2 || backends[0].Server != "lobby-0" || backends[0].Out != 9000 || backends[1].Out != 500 {
+		t.Fatalf("unexpected backends %+v", backends)
+	}
+
+	if usage := m.Usage(); usage[0].Out != 9500 || usage[0].OutRate != 50 {
+		t.Fatalf("unexpected usage after the switch %+v", usage)
+	}
+
+	m.Close("10.0.0.1:1000")
+	if usage := m.Usage(); len(usage) != 1 {
+		t.Fatalf("expected the closed connection to be gone, got %+v", usage)
+	}
+}
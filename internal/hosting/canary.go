@@ -0,0 +1,194 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const canaryKeyPrefix = "canary."
+
+var canaryRoutes = metrics.NewCounterVec("gate_canary_routes_total", "Players routed by gamemode and whether they went to a canary instance.", "gamemode", "canary")
+
+// CanaryConfig sends part of a gamemode's players to the instances registered
+// with Canary set. Disabling it routes everyone back to the stable instances.
+type CanaryConfig struct {
+	Enabled bool `json:"enabled"`
+	// Percent of players, 0-100, that go to the canary.
+	Percent int `json:"percent"`
+	// Permission, if set, always sends its holders to the canary.
+	Permission string `json:"permission,omitempty"`
+}
+
+// inCanary buckets players by a hash of their UUID and the gamemode, so a
+// player stays on the same side for as long as the percentage is not lowered.
+func (c CanaryConfig) inCanary(gamemode string, player proxy.Player) bool {
+	if !c.Enabled {
+		return false
+	}
+
+	if c.Permission != "" && player.HasPermission(c.Permission) {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(gamemode))
+	id := player.ID()
+	h.Write(id[:])
+
+	return int(h.Sum32()%100) < c.Percent
+}
+
+func (m *InstanceManager) Canary(ctx context.Context, gamemode string) (CanaryConfig, error) {
+	return kv.Typed[CanaryConfig](m.routingKV, canaryKeyPrefix+gamemode).Get(ctx)
+}
+
+// ChooseServer picks a random instance of the gamemode for the player,
+// honouring capacity limits, the gamemode's canary config and the player's
+// sticky key, weighted by the active theme. Instances in the proxy's region
+// are preferred while there are any. Canary instances only receive players while the canary is
+// enabled.
+func (m *InstanceManager) ChooseServer(ctx context.Context, gamemode string, player proxy.Player) (proxy.RegisteredServer, error) {
+	sel := registry.Selector{{Key: "gamemode", Operator: registry.Equals, Value: gamemode}}
+
+	instances, err := m.selectInstances(ctx, sel.And(m.routing))
+	if err != nil {
+		return nil, err
+	}
+
+	instances = m.preferRegion(instances)
+
+	if len(instances) > 0 && !player.HasPermission(CapacityBypassPermission) {
+		instances, err = m.available(ctx, gamemode, instances)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(instances) == 0 {
+			capacityRejections.Inc(gamemode)
+			return nil, ErrServersFull
+		}
+	}
+
+	cfg, err := m.Canary(ctx, gamemode)
+	if err != nil {
+		return nil, err
+	}
+
+	var stable, canary []proxy.RegisteredServer
+	for _, i := range instances {
+		if i.info.Canary {
+			canary = append(canary, i.server)
+		} else {
+			stable = append(stable, i.server)
+		}
+	}
+
+	toCanary := len(canary) > 0 && cfg.inCanary(gamemode, player)
+
+	servers := stable
+	if toCanary {
+		servers = canary
+	}
+
+	if len(servers) == 0 {
+		return nil, ErrNoServersAvailable
+	}
+
+	canaryRoutes.Inc(gamemode, strconv.FormatBool(toCanary))
+
+	key, err := m.StickyKey(ctx, player.ID())
+	if err != nil {
+		log.Printf("Failed to get sticky key of player %s: %v", player.ID(), err)
+	} else if key != "" {
+		return m.chooseSticky(ctx, gamemode, key, servers)
+	}
+
+	return m.pick(gamemode, servers, instances), nil
+}
+
+func (n *Hosting) Canaries(ctx context.Context) (map[string]CanaryConfig, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	canaries := make(map[string]CanaryConfig)
+	for _, key := range keys {
+		gamemode, ok := strings.CutPrefix(key, canaryKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		cfg, err := kv.Typed[CanaryConfig](n.rt, key).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		canaries[gamemode] = cfg
+	}
+
+	return canaries, nil
+}
+
+func (n *Hosting) SetCanary(ctx context.Context, actor, gamemode string, cfg CanaryConfig) error {
+	if cfg.Percent < 0 || cfg.Percent > 100 {
+		return errors.New("percent must be between 0 and 100")
+	}
+
+	if err := kv.Typed[CanaryConfig](n.rt, canaryKeyPrefix+gamemode).Set(ctx, cfg); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "routing.canary",
+		Target: gamemode,
+		Details: map[string]string{
+			"enabled":    strconv.FormatBool(cfg.Enabled),
+			"percent":    strconv.Itoa(cfg.Percent),
+			"permission": cfg.Permission,
+		},
+	})
+}
+
+func (n *Hosting) handleGetCanaries(w http.ResponseWriter, r *http.Request) {
+	canaries, err := n.Canaries(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, canaries)
+}
+
+func (n *Hosting) handleSetCanary(w http.ResponseWriter, r *http.Request) {
+	cfg := CanaryConfig{}
+	if err := api.ReadJSON(r, &cfg); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if cfg.Percent < 0 || cfg.Percent > 100 {
+		api.WriteError(w, http.StatusBadRequest, errors.New("percent must be between 0 and 100"))
+		return
+	}
+
+	if err := n.SetCanary(r.Context(), "api", r.PathValue("gamemode"), cfg); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
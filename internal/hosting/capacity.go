@@ -0,0 +1,210 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const (
+	capacityKeyPrefix = "capacity."
+	// CapacityBypassPermission lets staff join full servers and groups.
+	CapacityBypassPermission = "csmc.capacity.bypass"
+)
+
+var ErrServersFull = errors.New("all servers are full")
+
+var (
+	groupPlayers       = metrics.NewGaugeVec("gate_group_players", "Players on the instances of a gamemode.", "gamemode")
+	groupCapacity      = metrics.NewGaugeVec("gate_group_capacity", "Maximum players of a gamemode, 0 if unlimited.", "gamemode")
+	capacityRejections = metrics.NewCounterVec("gate_capacity_rejections_total", "Connections denied because a server or gamemode was full.", "gamemode")
+)
+
+// CapacityConfig limits the players of all instances of a gamemode together,
+// on top of the limit of every instance.
+type CapacityConfig struct {
+	MaxPlayers int `json:"maxPlayers"`
+}
+
+// Capacity of an instance. Players is the larger of what this proxy sees and
+// what the backend announced, so players of other proxies are included once
+// the backend announces them.
+type Capacity struct {
+	Players    int `json:"players"`
+	MaxPlayers int `json:"maxPlayers"`
+}
+
+func (c Capacity) Full() bool {
+	return c.MaxPlayers > 0 && c.Players >= c.MaxPlayers
+}
+
+func (m *InstanceManager) capacity(i instance) Capacity {
+	c := Capacity{Players: max(i.server.Players().Len(), i.info.Online), MaxPlayers: i.info.MaxPlayers}
+	if c.MaxPlayers == 0 {
+		c.MaxPlayers = m.maxPlayers
+	}
+
+	return c
+}
+
+func (m *InstanceManager) GroupCapacity(ctx context.Context, gamemode string) (CapacityConfig, error) {
+	return kv.Typed[CapacityConfig](m.routingKV, capacityKeyPrefix+gamemode).Get(ctx)
+}
+
+// available drops full instances, or all of them if the group is full. It
+// also updates the group metrics.
+func (m *InstanceManager) available(ctx context.Context, gamemode string, instances []instance) ([]instance, error) {
+	cfg, err := m.GroupCapacity(ctx, gamemode)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := m.instancesOfGamemode(ctx, gamemode)
+	if err != nil {
+		return nil, err
+	}
+
+	players := 0
+	for _, i := range all {
+		players += m.capacity(i).Players
+	}
+
+	groupPlayers.Set(int64(players), gamemode)
+	groupCapacity.Set(int64(cfg.MaxPlayers), gamemode)
+
+	if cfg.MaxPlayers > 0 && players >= cfg.MaxPlayers {
+		return nil, nil
+	}
+
+	available := make([]instance, 0, len(instances))
+	for _, i := range instances {
+		if !m.capacity(i).Full() {
+			available = append(available, i)
+		}
+	}
+
+	return available, nil
+}
+
+// CanJoin reports whether the player may connect to the server now. Players
+// with CapacityBypassPermission can always join.
+func (m *InstanceManager) CanJoin(ctx context.Context, player proxy.Player, server proxy.RegisteredServer) (bool, error) {
+	if player.HasPermission(CapacityBypassPermission) {
+		return true, nil
+	}
+
+	name := server.ServerInfo().Name()
+
+	// Players that are already on the server count towards its capacity
+	if cur := player.CurrentServer(); cur != nil && cur.Server().ServerInfo().Name() == name {
+		return true, nil
+	}
+
+	info := InstanceInfo{}
+	raw, err := m.instancesKV.Get(ctx, m.instanceKey(name))
+	if err == nil {
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return false, err
+		}
+	} else if !errors.Is(err, kv.ErrKeyNotFound) {
+		return false, err
+	}
+
+	i := instance{server: server, info: info}
+
+	if info.Gamemode == "" {
+		return !m.capacity(i).Full(), nil
+	}
+
+	available, err := m.available(ctx, info.Gamemode, []instance{i})
+	if err != nil {
+		return false, err
+	}
+
+	if len(available) == 0 {
+		capacityRejections.Inc(info.Gamemode)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (n *Hosting) GroupCapacities(ctx context.Context) (map[string]CapacityConfig, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	capacities := make(map[string]CapacityConfig)
+	for _, key := range keys {
+		gamemode, ok := strings.CutPrefix(key, capacityKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		cfg, err := kv.Typed[CapacityConfig](n.rt, key).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		capacities[gamemode] = cfg
+	}
+
+	return capacities, nil
+}
+
+func (n *Hosting) SetGroupCapacity(ctx context.Context, actor, gamemode string, cfg CapacityConfig) error {
+	if cfg.MaxPlayers < 0 {
+		return errors.New("maxPlayers must not be negative")
+	}
+
+	if err := kv.Typed[CapacityConfig](n.rt, capacityKeyPrefix+gamemode).Set(ctx, cfg); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "routing.capacity",
+		Target:  gamemode,
+		Details: map[string]string{"maxPlayers": strconv.Itoa(cfg.MaxPlayers)},
+	})
+}
+
+func (n *Hosting) handleGetCapacities(w http.ResponseWriter, r *http.Request) {
+	capacities, err := n.GroupCapacities(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, capacities)
+}
+
+func (n *Hosting) handleSetCapacity(w http.ResponseWriter, r *http.Request) {
+	cfg := CapacityConfig{}
+	if err := api.ReadJSON(r, &cfg); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if cfg.MaxPlayers < 0 {
+		api.WriteError(w, http.StatusBadRequest, errors.New("maxPlayers must not be negative"))
+		return
+	}
+
+	if err := n.SetGroupCapacity(r.Context(), "api", r.PathValue("gamemode"), cfg); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
@@ -0,0 +1,231 @@
+package hosting
+
+import (
+	"context"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var (
+	schemaSkew      = metrics.NewGaugeVec("gate_cluster_schema_skew", "Whether the live proxies disagree on the schema version of a migration scope.", "scope")
+	clusterVersions = metrics.NewGaugeVec("gate_cluster_versions", "Distinct versions the live proxies run.")
+)
+
+// schemas are the schema versions this proxy migrated to and the skews of
+// the cluster as of the last heartbeat.
+type schemas struct {
+	versions map[string]int
+	skews    []cluster.Skew
+	m        sync.RWMutex
+}
+
+func (s *schemas) set(scope string, version int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.versions == nil {
+		s.versions = make(map[string]int)
+	}
+	s.versions[scope] = version
+}
+
+func (s *schemas) snapshot() map[string]int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return maps.Clone(s.versions)
+}
+
+type deathHooks struct {
+	fns   map[string]func(ctx context.Context, instance string) error
+	names []string
+	m     sync.Mutex
+}
+
+// Cluster lists the proxies of the network and whether they are alive.
+func (n *Hosting) Cluster() *cluster.Registry {
+	return n.cls
+}
+
+// Version is PROXY_VERSION, or the VCS revision the binary was built from.
+func Version() string {
+	if v := os.Getenv("PROXY_VERSION"); v != "" {
+		return v
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+
+	return "dev"
+}
+
+// Skews returns the migration scopes the live proxies disagreed on at the
+// last heartbeat.
+func (n *Hosting) Skews() []cluster.Skew {
+	n.sch.m.RLock()
+	defer n.sch.m.RUnlock()
+
+	return slices.Clone(n.sch.skews)
+}
+
+// Compatible reports whether every live proxy is on the same schema version
+// of the scope. During a rollout, plugins should hold back features that
+// depend on a new schema until it is, old proxies don't understand the data.
+func (n *Hosting) Compatible(scope string) bool {
+	for _, s := range n.Skews() {
+		if s.Scope == scope {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkSkew warns about the cluster disagreeing on versions when that
+// changes.
+func (n *Hosting) checkSkew(ctx context.Context, now time.Time) {
+	instances, err := n.cls.Instances(ctx, now)
+	if err != nil {
+		log.Printf("Failed to check the cluster for version skew: %v", err)
+		return
+	}
+
+	versions := cluster.Versions(instances)
+	clusterVersions.Set(int64(len(versions)))
+
+	skews := cluster.Skews(instances)
+
+	n.sch.m.Lock()
+	previous := n.sch.skews
+	n.sch.skews = skews
+	n.sch.m.Unlock()
+
+	skewed := make(map[string]bool)
+	for _, s := range skews {
+		skewed[s.Scope] = true
+		schemaSkew.Set(1, s.Scope)
+
+		if !slices.ContainsFunc(previous, func(p cluster.Skew) bool { return p.Scope == s.Scope }) {
+			log.Printf("Proxies disagree on the schema version of %s, holding back features that depend on it: %v (running %s)", s.Scope, s.Versions, strings.Join(versions, ", "))
+		}
+	}
+
+	for _, p := range previous {
+		if !skewed[p.Scope] {
+			schemaSkew.Set(0, p.Scope)
+			log.Printf("Proxies agree on the schema version of %s again", p.Scope)
+		}
+	}
+}
+
+// OnInstanceDead registers fn to clean up the state a proxy that died
+// without leaving the cluster owned. fn may run on several proxies for the
+// same instance, so it must not mind if the state is gone already.
+func (n *Hosting) OnInstanceDead(plugin string, fn func(ctx context.Context, instance string) error) {
+	n.dh.m.Lock()
+	defer n.dh.m.Unlock()
+
+	if n.dh.fns == nil {
+		n.dh.fns = make(map[string]func(ctx context.Context, instance string) error)
+	}
+
+	if _, ok := n.dh.fns[plugin]; !ok {
+		n.dh.names = append(n.dh.names, plugin)
+		slices.Sort(n.dh.names)
+	}
+
+	n.dh.fns[plugin] = fn
+}
+
+func (n *Hosting) instanceDead(ctx context.Context, instance string) {
+	n.dh.m.Lock()
+	names := slices.Clone(n.dh.names)
+	fns := make([]func(ctx context.Context, instance string) error, len(names))
+	for i, name := range names {
+		fns[i] = n.dh.fns[name]
+	}
+	n.dh.m.Unlock()
+
+	for i, name := range names {
+		if err := fns[i](ctx, instance); err != nil {
+			log.Printf("Failed to clean up the state of %s owned by dead proxy %s: %v", name, instance, err)
+		}
+	}
+}
+
+// heartbeat keeps this proxy in the cluster until ctx is done.
+func (n *Hosting) heartbeat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	version := Version()
+	beat := func(now time.Time) {
+		players := 0
+		if prx := n.prx.Load(); prx != nil {
+			players = prx.PlayerCount()
+		}
+		ready := n.Readiness(ctx).Status == StatusOk
+
+		if err := n.cls.Heartbeat(ctx, cluster.Instance{
+			Name:    n.Info.PodName,
+			Region:  n.Info.Region,
+			Version: version,
+			Players: players,
+			Ready:   ready,
+			Schemas: n.sch.snapshot(),
+			Started: processStart,
+			Seen:    now,
+		}); err != nil {
+			log.Printf("Failed to heartbeat into the cluster: %v", err)
+			return
+		}
+
+		n.checkSkew(ctx, now)
+	}
+
+	beat(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			if err := n.cls.Leave(context.Background(), n.Info.PodName); err != nil {
+				log.Printf("Failed to leave the cluster: %v", err)
+			}
+			return
+		case now := <-ticker.C:
+			beat(now)
+		}
+	}
+}
+
+func (n *Hosting) handleCluster(w http.ResponseWriter, r *http.Request) {
+	instances, err := n.cls.Instances(r.Context(), time.Now())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, instances)
+}
+
+func (n *Hosting) handleSkews(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.Skews())
+}
@@ -0,0 +1,215 @@
+// Package cluster keeps track of the proxies of a network. Every proxy
+// heartbeats into a KV bucket, so the others know which are alive and can
+// clean up after those that died without leaving.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+// Instance is what a proxy heartbeats about itself.
+type Instance struct {
+	Name    string `json:"name"`
+	Region  string `json:"region,omitempty"`
+	Version string `json:"version"`
+	Players int    `json:"players"`
+	// Ready is whether the instance passes its readiness check and isn't
+	// draining
+	Ready bool `json:"ready"`
+	// Schemas are the data schema versions the instance migrated to, by
+	// migration scope
+	Schemas map[string]int `json:"schemas,omitempty"`
+	Started time.Time      `json:"started"`
+	Seen    time.Time      `json:"seen"`
+	// Live and UptimeSeconds are set by Instances, they aren't stored
+	Live          bool  `json:"live"`
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+}
+
+type Registry struct {
+	kv kv.Bucket
+	// ttl is how long an instance counts as live after its last heartbeat
+	ttl time.Duration
+}
+
+func New(bucket kv.Bucket, ttl time.Duration) *Registry {
+	return &Registry{kv: bucket, ttl: ttl}
+}
+
+func (r *Registry) TTL() time.Duration {
+	return r.ttl
+}
+
+func (r *Registry) Heartbeat(ctx context.Context, i Instance) error {
+	i.Live, i.UptimeSeconds = false, 0
+
+	raw, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	return r.kv.Set(ctx, i.Name, raw)
+}
+
+// Leave removes the instance, e.g. when it shuts down, so it doesn't count
+// as dead.
+func (r *Registry) Leave(ctx context.Context, name string) error {
+	if err := r.kv.Delete(ctx, name); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// Instances returns every instance that heartbeated, live or not, sorted by
+// name.
+func (r *Registry) Instances(ctx context.Context, now time.Time) ([]Instance, error) {
+	keys, err := r.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(keys))
+	for _, key := range keys {
+		raw, err := r.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		i := Instance{}
+		if err := json.Unmarshal(raw, &i); err != nil {
+			return nil, err
+		}
+
+		i.Live = now.Sub(i.Seen) <= r.ttl
+		i.UptimeSeconds = int64(i.Seen.Sub(i.Started).Seconds())
+		instances = append(instances, i)
+	}
+
+	slices.SortFunc(instances, func(a, b Instance) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return instances, nil
+}
+
+// Live reports whether the instance heartbeated within the TTL.
+func (r *Registry) Live(ctx context.Context, name string, now time.Time) (bool, error) {
+	raw, err := r.kv.Get(ctx, name)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	i := Instance{}
+	if err := json.Unmarshal(raw, &i); err != nil {
+		return false, err
+	}
+
+	return now.Sub(i.Seen) <= r.ttl, nil
+}
+
+// Prune removes the instances that didn't heartbeat for after and returns
+// them. Every proxy prunes, so two may return the same instance.
+func (r *Registry) Prune(ctx context.Context, now time.Time, after time.Duration) ([]Instance, error) {
+	instances, err := r.Instances(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	dead := make([]Instance, 0)
+	for _, i := range instances {
+		if now.Sub(i.Seen) <= after {
+			continue
+		}
+
+		if err := r.Leave(ctx, i.Name); err != nil {
+			return nil, err
+		}
+		dead = append(dead, i)
+	}
+
+	return dead, nil
+}
+
+// Leader returns the name of the live instance that coordinates work for
+// the cluster, the first by name, or "" if none is live. Instances agree on
+// the leader as long as they see the same heartbeats.
+func Leader(instances []Instance) string {
+	leader := ""
+	for _, i := range instances {
+		if i.Live && (leader == "" || i.Name < leader) {
+			leader = i.Name
+		}
+	}
+
+	return leader
+}
+
+// Skew is a migration scope live instances disagree on.
+type Skew struct {
+	Scope string `json:"scope"`
+	// Versions are the schema versions by instance, 0 if the instance
+	// doesn't know the scope yet
+	Versions map[string]int `json:"versions"`
+}
+
+// Skews returns the scopes the live instances disagree on the schema
+// version of, sorted by scope.
+func Skews(instances []Instance) []Skew {
+	live := make([]Instance, 0, len(instances))
+	scopes := make(map[string]bool)
+	for _, i := range instances {
+		if !i.Live {
+			continue
+		}
+
+		live = append(live, i)
+		for scope := range i.Schemas {
+			scopes[scope] = true
+		}
+	}
+
+	skews := make([]Skew, 0)
+	for scope := range scopes {
+		versions := make(map[string]int, len(live))
+		seen := make(map[int]bool)
+		for _, i := range live {
+			versions[i.Name] = i.Schemas[scope]
+			seen[i.Schemas[scope]] = true
+		}
+
+		if len(seen) > 1 {
+			skews = append(skews, Skew{Scope: scope, Versions: versions})
+		}
+	}
+
+	slices.SortFunc(skews, func(a, b Skew) int {
+		return strings.Compare(a.Scope, b.Scope)
+	})
+
+	return skews
+}
+
+// Versions returns the distinct versions of the live instances, sorted.
+func Versions(instances []Instance) []string {
+	versions := make([]string, 0)
+	for _, i := range instances {
+		if i.Live && !slices.Contains(versions, i.Version) {
+			versions = append(versions, i.Version)
+		}
+	}
+
+	slices.Sort(versions)
+	return versions
+}
@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func newRegistry(t *testing.T) *Registry {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(bucket, 45*time.Second)
+}
+
+func TestInstances(t *testing.T) {
+	ctx := context.Background()
+	r := newRegistry(t)
+
+	if err := r.Heartbeat(ctx, Instance{Name: "proxy-1", Version: "abc", Players: 4, Started: now.Add(-time.Hour), Seen: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Heartbeat(ctx, Instance{Name: "proxy-0", Version: "abc", Started: now.Add(-2 * time.Hour), Seen: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := r.Instances(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 2 || instances[0].Name != "proxy-0" || instances[1].Name != "proxy-1" {
+		t.Fatalf("unexpected instances %+v", instances)
+	}
+
+	if instances[0].Live || !instances[1].Live {
+		t.Fatalf("expected only proxy-1 to be live, got %+v", instances)
+	}
+
+	if instances[1].UptimeSeconds != 3600 || instances[1].Players != 4 {
+		t.Fatalf("unexpected proxy-1 %+v", instances[1])
+	}
+
+	if live, err := r.Live(ctx, "proxy-2", now); err != nil || live {
+		t.Fatalf("expected an unknown instance to be dead, got %v %v", live, err)
+	}
+
+	if err := r.Leave(ctx, "proxy-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if live, err := r.Live(ctx, "proxy-1", now); err != nil || live {
+		t.Fatalf("expected proxy-1 to be gone, got %v %v", live, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	r := newRegistry(t)
+
+	for _, i := range []Instance{
+		{Name: "proxy-0", Seen: now},
+		{Name: "proxy-1", Seen: now.Add(-time.Minute)},
+		{Name: "proxy-2", Seen: now.Add(-10 * time.Minute)},
+	} {
+		if err := r.Heartbeat(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead, err := r.Prune(ctx, now, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dead) != 1 || dead[0].Name != "proxy-2" {
+		t.Fatalf("expected proxy-2 to be pruned, got %+v", dead)
+	}
+
+	// Missing a heartbeat or two isn't dead yet
+	instances, err := r.Instances(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 2 {
+		t.Fatalf("unexpected instances %+v", instances)
+	}
+}
+
+func TestSkews(t *testing.T) {
+	instances := []Instance{
+		{Name: "proxy-0", Version: "abc", Live: true, Schemas: map[string]int{"whitelist": 2, "punishments": 1}},
+		{Name: "proxy-1", Version: "def", Live: true, Schemas: map[string]int{"whitelist": 3, "punishments": 1}},
+		{Name: "proxy-2", Version: "old", Live: false, Schemas: map[string]int{"punishments": 0}},
+	}
+
+	skews := Skews(instances)
+	if len(skews) != 1 || skews[0].Scope != "whitelist" || skews[0].Versions["proxy-0"] != 2 || skews[0].Versions["proxy-1"] != 3 {
+		t.Fatalf("expected only whitelist to skew, got %+v", skews)
+	}
+
+	// An instance that doesn't know a scope yet disagrees with those that do
+	instances = append(instances, Instance{Name: "proxy-3", Version: "abc", Live: true})
+	if skews := Skews(instances); len(skews) != 2 || skews[0].Versions["proxy-3"] != 0 {
+		t.Fatalf("expected proxy-3 to skew both scopes, got %+v", skews)
+	}
+
+	if versions := Versions(instances); !slices.Equal(versions, []string{"abc", "def"}) {
+		t.Fatalf("unexpected versions %v", versions)
+	}
+}
+
+func TestLeader(t *testing.T) {
+	instances := []Instance{
+		{Name: "proxy-1", Live: true},
+		{Name: "proxy-0", Live: false},
+		{Name: "proxy-2", Live: true},
+	}
+
+	if leader := Leader(instances); leader != "proxy-1" {
+		t.Fatalf("expected proxy-1 to lead, got %q", leader)
+	}
+
+	if leader := Leader(instances[1:2]); leader != "" {
+		t.Fatalf("expected no leader without live instances, got %q", leader)
+	}
+}
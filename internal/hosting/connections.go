@@ -0,0 +1,101 @@
+package hosting
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// connectionGrace is how long the ID of a connection that never logged in
+// is kept, e.g. one denied by Shield or failing authentication.
+const connectionGrace = time.Minute
+
+type connection struct {
+	id      string
+	created time.Time
+	// joined is set once the player logged in, their ID is then kept until
+	// they disconnect
+	joined bool
+}
+
+type connections struct {
+	byAddr    map[string]*connection
+	lastPrune time.Time
+	m         sync.Mutex
+}
+
+// ConnectionID returns the correlation ID of the connection from addr. The
+// first call, usually in the handshake, creates it, and it stays the same
+// from there to the disconnect.
+func (n *Hosting) ConnectionID(addr net.Addr) string {
+	n.conns.m.Lock()
+	defer n.conns.m.Unlock()
+
+	if c, ok := n.conns.byAddr[addr.String()]; ok {
+		return c.id
+	}
+
+	now := time.Now()
+	if n.conns.byAddr == nil {
+		n.conns.byAddr = make(map[string]*connection)
+	}
+
+	if now.Sub(n.conns.lastPrune) > connectionGrace {
+		for key, c := range n.conns.byAddr {
+			if !c.joined && now.Sub(c.created) > connectionGrace {
+				delete(n.conns.byAddr, key)
+			}
+		}
+		n.conns.lastPrune = now
+	}
+
+	c := &connection{id: correlation.New(), created: now}
+	n.conns.byAddr[addr.String()] = c
+
+	return c.id
+}
+
+// JoinConnection keeps the ID of the player's connection until
+// EndConnection.
+func (n *Hosting) JoinConnection(player proxy.Player) {
+	n.ConnectionID(player.RemoteAddr())
+
+	n.conns.m.Lock()
+	n.conns.byAddr[player.RemoteAddr().String()].joined = true
+	n.conns.m.Unlock()
+}
+
+// ConnectedAt returns when the connection from addr was made, false if the
+// proxy doesn't know it.
+func (n *Hosting) ConnectedAt(addr net.Addr) (time.Time, bool) {
+	n.conns.m.Lock()
+	defer n.conns.m.Unlock()
+
+	c, ok := n.conns.byAddr[addr.String()]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return c.created, true
+}
+
+func (n *Hosting) EndConnection(addr net.Addr) {
+	n.conns.m.Lock()
+	delete(n.conns.byAddr, addr.String())
+	n.conns.m.Unlock()
+}
+
+// PlayerContext returns ctx with the correlation ID of the player's
+// connection, for messages and requests on their behalf. An ID ctx already
+// carries, e.g. of an admin API request, is kept.
+func (n *Hosting) PlayerContext(ctx context.Context, player proxy.Player) context.Context {
+	if correlation.ID(ctx) != "" {
+		return ctx
+	}
+
+	return correlation.With(ctx, n.ConnectionID(player.RemoteAddr()))
+}
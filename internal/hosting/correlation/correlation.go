@@ -0,0 +1,73 @@
+// Package correlation carries the ID that ties together the log lines,
+// messages and API responses about one connection, across the proxies and
+// the co-plugins on the backends.
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// Header carries the ID in NATS message headers and the admin API.
+const Header = "Csmc-Correlation-Id"
+
+type key struct{}
+
+// New returns a random ID, 16 hex characters.
+func New() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// Valid reports whether an ID from outside, such as a header, is safe to
+// log: up to 64 letters, digits and dashes.
+func Valid(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// With returns a context carrying the ID, or ctx itself for an empty ID.
+func With(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, key{}, id)
+}
+
+// ID returns the ID of the context, or "" if it has none.
+func ID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// Logf logs with the ID in front, like "[3f2a9c01d4e5b6a7] Chose server".
+// Without an ID the line is logged as is.
+func Logf(id string, format string, args ...any) {
+	if id == "" {
+		log.Printf(format, args...)
+		return
+	}
+
+	log.Printf("[%s] %s", id, fmt.Sprintf(format, args...))
+}
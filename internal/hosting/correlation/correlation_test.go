@@ -0,0 +1,41 @@
+package correlation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id := ID(ctx); id != "" {
+		t.Fatalf("expected no ID, got %q", id)
+	}
+
+	if With(ctx, "") != ctx {
+		t.Fatal("expected an empty ID to keep the context")
+	}
+
+	id := New()
+	if len(id) != 16 || id == New() {
+		t.Fatalf("unexpected ID %q", id)
+	}
+
+	if got := ID(With(ctx, id)); got != id {
+		t.Fatalf("expected %q, got %q", id, got)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for id, valid := range map[string]bool{
+		New():                    true,
+		"api-1234":               true,
+		"":                       false,
+		"a b":                    false,
+		"line\nbreak":            false,
+		string(make([]byte, 65)): false,
+	} {
+		if Valid(id) != valid {
+			t.Errorf("expected Valid(%q) to be %t", id, valid)
+		}
+	}
+}
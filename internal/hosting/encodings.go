@@ -0,0 +1,63 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+// kvEncodings parses KV_ENCODINGS, e.g. {"whitelist":"msgpack","*":"json"}.
+func kvEncodings(raw string) (map[string]kv.Encoding, error) {
+	names := map[string]string{}
+	if err := json.Unmarshal([]byte(raw), &names); err != nil {
+		return nil, fmt.Errorf("invalid KV_ENCODINGS: %w", err)
+	}
+
+	byBucket := make(map[string]kv.Encoding, len(names))
+	for bucket, name := range names {
+		e, err := kv.LookupEncoding(name)
+		if err != nil {
+			return nil, err
+		}
+
+		byBucket[bucket] = e
+	}
+
+	return byBucket, nil
+}
+
+// ReencodeBucket rewrites the values of a bucket that aren't stored in its
+// encoding yet. Only run it once every proxy reads the encoding.
+func (n *Hosting) ReencodeBucket(ctx context.Context, actor, bucket string) (int, error) {
+	rewritten, err := n.enc.Reencode(ctx, bucket)
+	if err != nil {
+		return rewritten, err
+	}
+
+	return rewritten, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "kv.reencode",
+		Target:  bucket,
+		Details: map[string]string{"values": strconv.Itoa(rewritten)},
+	})
+}
+
+func (n *Hosting) handleGetEncodings(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.enc.Encodings())
+}
+
+func (n *Hosting) handleReencode(w http.ResponseWriter, r *http.Request) {
+	rewritten, err := n.ReencodeBucket(r.Context(), "api", r.PathValue("bucket"))
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]int{"rewritten": rewritten})
+}
@@ -0,0 +1,87 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/experiments"
+)
+
+// Experiments buckets players into A/B variants, e.g.
+// h.Experiments().Variant(player.ID().String(), "new-lobby").
+func (n *Hosting) Experiments() *experiments.Experiments {
+	return n.exp
+}
+
+func (n *Hosting) SetExperiment(ctx context.Context, actor string, exp experiments.Experiment) error {
+	if err := n.exp.Set(ctx, exp); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "experiment.set",
+		Target:  exp.Name,
+		Details: map[string]string{"enabled": strconv.FormatBool(exp.Enabled), "variants": strconv.Itoa(len(exp.Variants))},
+	})
+}
+
+func (n *Hosting) DeleteExperiment(ctx context.Context, actor, name string) error {
+	if err := n.exp.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "experiment.delete", Target: name})
+}
+
+func (n *Hosting) handleListExperiments(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.exp.List())
+}
+
+func (n *Hosting) handleSetExperiment(w http.ResponseWriter, r *http.Request) {
+	exp := experiments.Experiment{}
+	if err := api.ReadJSON(r, &exp); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	exp.Name = r.PathValue("name")
+
+	if err := exp.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetExperiment(r.Context(), "api", exp); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, exp)
+}
+
+func (n *Hosting) handleDeleteExperiment(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteExperiment(r.Context(), "api", r.PathValue("name")); errors.Is(err, experiments.ErrExperimentNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Hosting) handleExposures(w http.ResponseWriter, r *http.Request) {
+	counts, err := n.exp.Exposures(r.Context(), r.PathValue("name"))
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, counts)
+}
@@ -0,0 +1,352 @@
+// Package experiments buckets players into variants of A/B experiments and
+// records which variant each player was exposed to.
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var (
+	ErrExperimentNotFound = errors.New("experiment not found")
+	ErrNoVariants         = errors.New("experiment has no variants with a positive weight")
+)
+
+var exposures = metrics.NewCounterVec("gate_experiment_exposures_total", "Players exposed to an experiment variant for the first time on this proxy.", "experiment", "variant")
+
+type Variant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+type Experiment struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Salt is hashed together with the player UUID. Changing it reshuffles
+	// all players, it defaults to the name.
+	Salt     string    `json:"salt,omitempty"`
+	Variants []Variant `json:"variants"`
+}
+
+func (e Experiment) Validate() error {
+	if e.Name == "" {
+		return errors.New("experiment name is required")
+	}
+
+	for _, v := range e.Variants {
+		if v.Weight > 0 {
+			return nil
+		}
+	}
+
+	return ErrNoVariants
+}
+
+// assign deterministically picks a variant for the player, proportional to
+// the variant weights.
+func (e Experiment) assign(player string) string {
+	total := 0
+	for _, v := range e.Variants {
+		total += max(v.Weight, 0)
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	salt := e.Salt
+	if salt == "" {
+		salt = e.Name
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(player))
+
+	n := int(h.Sum64() % uint64(total))
+	for _, v := range e.Variants {
+		if n < max(v.Weight, 0) {
+			return v.Name
+		}
+
+		n -= max(v.Weight, 0)
+	}
+
+	return ""
+}
+
+type Exposure struct {
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	Player     string    `json:"player"`
+	Time       time.Time `json:"time"`
+}
+
+// Experiments keeps the experiment definitions of a bucket in memory. The
+// first exposure of every player is stored in the exposures bucket under
+// <experiment>.<player>.
+type Experiments struct {
+	kv          kv.Bucket
+	exposuresKV kv.Bucket
+	experiments map[string]Experiment
+	seen        map[string]struct{}
+	pending     chan Exposure
+	m           sync.RWMutex
+}
+
+func New(ctx context.Context, definitions kv.Bucket, exposures kv.Bucket) (*Experiments, error) {
+	e := &Experiments{
+		kv:          definitions,
+		exposuresKV: exposures,
+		experiments: make(map[string]Experiment),
+		seen:        make(map[string]struct{}),
+		pending:     make(chan Exposure, 1024),
+	}
+
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Experiments) Reload(ctx context.Context) error {
+	keys, err := e.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	experiments := make(map[string]Experiment, len(keys))
+	for _, key := range keys {
+		raw, err := e.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		exp := Experiment{}
+		if err := json.Unmarshal(raw, &exp); err != nil {
+			log.Printf("Failed to unmarshal experiment %s: %v", key, err)
+			continue
+		}
+
+		experiments[key] = exp
+	}
+
+	e.m.Lock()
+	e.experiments = experiments
+	e.m.Unlock()
+
+	return nil
+}
+
+// Watch keeps the definitions in sync with the bucket until ctx is done.
+func (e *Experiments) Watch(ctx context.Context) {
+	kv.Watch(ctx, e.kv, e.handleChange, e.Reload)
+}
+
+func (e *Experiments) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		exp := Experiment{}
+		if err := json.Unmarshal(v.Value, &exp); err != nil {
+			log.Printf("Failed to unmarshal experiment %s: %v", v.Key, err)
+			return
+		}
+
+		e.experiments[v.Key] = exp
+
+	case kv.Delete:
+		delete(e.experiments, v.Key)
+	}
+}
+
+// Variant returns the player's variant of the named experiment, or "" if the
+// experiment does not exist or is disabled. The first call for a player is
+// recorded as an exposure.
+func (e *Experiments) Variant(player, name string) string {
+	e.m.RLock()
+	exp, ok := e.experiments[name]
+	e.m.RUnlock()
+
+	if !ok || !exp.Enabled {
+		return ""
+	}
+
+	variant := exp.assign(player)
+	if variant != "" {
+		e.expose(Exposure{Experiment: name, Variant: variant, Player: player, Time: time.Now()})
+	}
+
+	return variant
+}
+
+func (e *Experiments) expose(x Exposure) {
+	key := exposureKey(x.Experiment, x.Player)
+
+	e.m.Lock()
+	_, seen := e.seen[key]
+	e.seen[key] = struct{}{}
+	e.m.Unlock()
+
+	if seen {
+		return
+	}
+
+	exposures.Inc(x.Experiment, x.Variant)
+
+	select {
+	case e.pending <- x:
+	default:
+		log.Printf("Dropping exposure of %s to %s, the queue is full", x.Player, x.Experiment)
+	}
+}
+
+// Record writes queued exposures to KV until ctx is done, so Variant never
+// blocks on storage.
+func (e *Experiments) Record(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case x := <-e.pending:
+			if err := e.record(ctx, x); err != nil {
+				log.Printf("Failed to record exposure of %s to %s: %v", x.Player, x.Experiment, err)
+			}
+		}
+	}
+}
+
+// record keeps the first exposure if another proxy already stored one.
+func (e *Experiments) record(ctx context.Context, x Exposure) error {
+	key := exposureKey(x.Experiment, x.Player)
+
+	if _, err := e.exposuresKV.Get(ctx, key); err == nil {
+		return nil
+	} else if !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+
+	raw, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+
+	return e.exposuresKV.Set(ctx, key, raw)
+}
+
+func exposureKey(experiment, player string) string {
+	return experiment + "." + player
+}
+
+func (e *Experiments) List() []Experiment {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	list := make([]Experiment, 0, len(e.experiments))
+	for _, exp := range e.experiments {
+		list = append(list, exp)
+	}
+
+	slices.SortFunc(list, func(a, b Experiment) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (e *Experiments) Set(ctx context.Context, exp Experiment) error {
+	if err := exp.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(exp)
+	if err != nil {
+		return err
+	}
+
+	if err := e.kv.Set(ctx, exp.Name, raw); err != nil {
+		return err
+	}
+
+	e.m.Lock()
+	e.experiments[exp.Name] = exp
+	e.m.Unlock()
+
+	return nil
+}
+
+func (e *Experiments) Delete(ctx context.Context, name string) error {
+	if err := e.kv.Delete(ctx, name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrExperimentNotFound
+	} else if err != nil {
+		return err
+	}
+
+	e.m.Lock()
+	delete(e.experiments, name)
+	e.m.Unlock()
+
+	return nil
+}
+
+// Exposures counts the recorded exposures of an experiment by variant.
+func (e *Experiments) Exposures(ctx context.Context, name string) (map[string]int, error) {
+	keys, err := e.exposuresKV.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, name+".") {
+			continue
+		}
+
+		raw, err := e.exposuresKV.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		x := Exposure{}
+		if err := json.Unmarshal(raw, &x); err != nil {
+			return nil, fmt.Errorf("exposure %s: %w", key, err)
+		}
+
+		counts[x.Variant]++
+	}
+
+	return counts, nil
+}
+
+var placeholder = regexp.MustCompile(`\{experiment:([^}]+)\}`)
+
+// Expand replaces {experiment:<name>} in s with the player's variant.
+func (e *Experiments) Expand(player, s string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		return e.Variant(player, placeholder.FindStringSubmatch(m)[1])
+	})
+}
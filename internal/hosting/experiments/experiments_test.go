@@ -0,0 +1,121 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newExperiments(t *testing.T) *Experiments {
+	ctx := context.Background()
+
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definitions, err := k.Bucket(ctx, "experiments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exposures, err := k.Bucket(ctx, "exposures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := New(ctx, definitions, exposures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestVariantDeterministic(t *testing.T) {
+	ctx := context.Background()
+	e := newExperiments(t)
+
+	if err := e.Set(ctx, Experiment{
+		Name:     "new-lobby",
+		Enabled:  true,
+		Variants: []Variant{{Name: "control", Weight: 3}, {Name: "treatment", Weight: 1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		player := fmt.Sprintf("player-%d", i)
+
+		v := e.Variant(player, "new-lobby")
+		if again := e.Variant(player, "new-lobby"); again != v {
+			t.Fatalf("player %s got %s and then %s", player, v, again)
+		}
+
+		counts[v]++
+	}
+
+	if counts["treatment"] < 800 || counts["treatment"] > 1200 {
+		t.Fatalf("expected about 1000 players in treatment, got %v", counts)
+	}
+}
+
+func TestVariantDisabled(t *testing.T) {
+	ctx := context.Background()
+	e := newExperiments(t)
+
+	if v := e.Variant("player", "missing"); v != "" {
+		t.Fatalf("expected no variant for a missing experiment, got %s", v)
+	}
+
+	if err := e.Set(ctx, Experiment{Name: "off", Variants: []Variant{{Name: "a", Weight: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := e.Variant("player", "off"); v != "" {
+		t.Fatalf("expected no variant for a disabled experiment, got %s", v)
+	}
+
+	if err := e.Set(ctx, Experiment{Name: "empty", Enabled: true}); err != ErrNoVariants {
+		t.Fatalf("expected ErrNoVariants, got %v", err)
+	}
+}
+
+func TestExposures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := newExperiments(t)
+
+	if err := e.Set(ctx, Experiment{Name: "exp", Enabled: true, Variants: []Variant{{Name: "only", Weight: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		e.Variant("a", "exp")
+		e.Variant("b", "exp")
+	}
+
+	if got := e.Expand("c", "variant {experiment:exp}"); got != "variant only" {
+		t.Fatalf("unexpected expansion %q", got)
+	}
+
+	for len(e.pending) > 0 {
+		if err := e.record(ctx, <-e.pending); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := e.Exposures(ctx, "exp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counts["only"] != 3 {
+		t.Fatalf("expected 3 exposures, got %v", counts)
+	}
+}
@@ -0,0 +1,128 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+// faultTargets are the wrappers faults can be injected into, each starts
+// with the config in FAULTS_<TARGET>.
+var faultTargets = []string{"kv", "messaging", "object"}
+
+// initFaults returns the injectors by target, nil unless FAULTS is set.
+// They can only be added when the backends are created, the API changes
+// their config afterwards.
+func initFaults() (map[string]*faults.Injector, error) {
+	if !util.EnvBoolWithDefault("FAULTS", false) {
+		return nil, nil
+	}
+
+	log.Println("WARNING: Fault injection is enabled")
+
+	flt := make(map[string]*faults.Injector, len(faultTargets))
+	for _, target := range faultTargets {
+		cfg := faults.Config{}
+
+		if s := os.Getenv("FAULTS_" + strings.ToUpper(target)); s != "" {
+			if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+				return nil, fmt.Errorf("invalid faults of %s: %w", target, err)
+			}
+
+			if err := cfg.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid faults of %s: %w", target, err)
+			}
+		}
+
+		flt[target] = faults.New(target, cfg)
+	}
+
+	return flt, nil
+}
+
+// SetFaults changes the faults injected into the target at runtime.
+func (n *Hosting) SetFaults(ctx context.Context, actor, target string, cfg faults.Config) error {
+	f, ok := n.flt[target]
+	if !ok {
+		return fmt.Errorf("unknown fault target %q", target)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	f.Set(cfg)
+	log.Printf("WARNING: Injecting faults into %s: %+v", target, cfg)
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "faults.set",
+		Target: target,
+		Details: map[string]string{
+			"latencyMs": strconv.Itoa(cfg.LatencyMs),
+			"jitterMs":  strconv.Itoa(cfg.JitterMs),
+			"errorRate": strconv.FormatFloat(cfg.ErrorRate, 'f', -1, 64),
+			"dropRate":  strconv.FormatFloat(cfg.DropRate, 'f', -1, 64),
+		},
+	})
+}
+
+func (n *Hosting) handleGetFaults(w http.ResponseWriter, r *http.Request) {
+	res := make(map[string]faults.Config, len(n.flt))
+	for target, f := range n.flt {
+		res[target] = f.Config()
+	}
+
+	api.WriteJSON(w, http.StatusOK, res)
+}
+
+func (n *Hosting) handleSetFaults(w http.ResponseWriter, r *http.Request) {
+	target := r.PathValue("target")
+	if _, ok := n.flt[target]; !ok {
+		api.WriteError(w, http.StatusNotFound, fmt.Errorf("unknown fault target %q", target))
+		return
+	}
+
+	cfg := faults.Config{}
+	if err := api.ReadJSON(r, &cfg); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetFaults(r.Context(), "api", target, cfg); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
+
+func (n *Hosting) handleDeleteFaults(w http.ResponseWriter, r *http.Request) {
+	target := r.PathValue("target")
+	if _, ok := n.flt[target]; !ok {
+		api.WriteError(w, http.StatusNotFound, fmt.Errorf("unknown fault target %q", target))
+		return
+	}
+
+	if err := n.SetFaults(r.Context(), "api", target, faults.Config{}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
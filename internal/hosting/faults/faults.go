@@ -0,0 +1,111 @@
+// Package faults injects latency, errors and dropped events into the
+// infrastructure wrappers, to test how plugins cope with a misbehaving KV,
+// messaging backend or object store.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var ErrInjected = errors.New("injected fault")
+
+// Config of faults, the zero value injects nothing.
+type Config struct {
+	// LatencyMs delays every operation, JitterMs adds up to that much on
+	// top at random.
+	LatencyMs int `json:"latencyMs"`
+	JitterMs  int `json:"jitterMs"`
+	// ErrorRate is the share of operations that fail with ErrInjected.
+	ErrorRate float64 `json:"errorRate"`
+	// DropRate is the share of watch events and received messages that are
+	// silently dropped.
+	DropRate float64 `json:"dropRate"`
+}
+
+func (c Config) Validate() error {
+	if c.LatencyMs < 0 || c.JitterMs < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+
+	if c.ErrorRate < 0 || c.ErrorRate > 1 || c.DropRate < 0 || c.DropRate > 1 {
+		return errors.New("rates must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// Injector applies a Config that can be changed at runtime.
+type Injector struct {
+	Name string
+
+	cfg Config
+	m   sync.RWMutex
+}
+
+func New(name string, cfg Config) *Injector {
+	return &Injector{Name: name, cfg: cfg}
+}
+
+func (i *Injector) Config() Config {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	return i.cfg
+}
+
+func (i *Injector) Set(cfg Config) {
+	i.m.Lock()
+	i.cfg = cfg
+	i.m.Unlock()
+}
+
+// Before runs before an operation: it waits for the latency and returns
+// ErrInjected for the share of operations that should fail.
+func (i *Injector) Before(ctx context.Context, op string) error {
+	cfg := i.Config()
+
+	if d := delay(cfg); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if cfg.ErrorRate > 0 && rand.Float64() < cfg.ErrorRate {
+		return fmt.Errorf("%s %s: %w", i.Name, op, ErrInjected)
+	}
+
+	return nil
+}
+
+// Drop reports whether the next event should be dropped.
+func (i *Injector) Drop() bool {
+	rate := i.Config().DropRate
+
+	return rate > 0 && rand.Float64() < rate
+}
+
+// Delay waits for the latency of events, which have no context.
+func (i *Injector) Delay() {
+	if d := delay(i.Config()); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func delay(cfg Config) time.Duration {
+	d := time.Duration(cfg.LatencyMs) * time.Millisecond
+	if cfg.JitterMs > 0 {
+		d += rand.N(time.Duration(cfg.JitterMs) * time.Millisecond)
+	}
+
+	return d
+}
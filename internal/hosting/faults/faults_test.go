@@ -0,0 +1,56 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInjector(t *testing.T) {
+	ctx := context.Background()
+
+	i := New("kv", Config{})
+	if err := i.Before(ctx, "get"); err != nil {
+		t.Errorf("got %v without faults", err)
+	}
+	if i.Drop() {
+		t.Error("dropped without faults")
+	}
+
+	i.Set(Config{ErrorRate: 1, DropRate: 1})
+	if err := i.Before(ctx, "get"); !errors.Is(err, ErrInjected) {
+		t.Errorf("got %v, want an injected fault", err)
+	}
+	if !i.Drop() {
+		t.Error("not dropped with a drop rate of 1")
+	}
+
+	i.Set(Config{LatencyMs: 20})
+	start := time.Now()
+	if err := i.Before(ctx, "get"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("delayed by %s, want at least 20ms", d)
+	}
+
+	i.Set(Config{LatencyMs: 10_000})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := i.Before(ctx, "get"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's error", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, cfg := range []Config{{LatencyMs: -1}, {ErrorRate: 1.5}, {DropRate: -0.1}} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%+v is valid", cfg)
+		}
+	}
+
+	if err := (Config{LatencyMs: 100, JitterMs: 50, ErrorRate: 0.1, DropRate: 0.5}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
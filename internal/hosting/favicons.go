@@ -0,0 +1,128 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/favicons"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/favicon"
+)
+
+// Favicons holds the server list icons of the network.
+func (n *Hosting) Favicons() *favicons.Favicons {
+	return n.fav
+}
+
+// Favicon returns the icon for a ping of the connection, from the set of the
+// host it connected with, of the active theme or the default set.
+func (n *Hosting) Favicon(ctx context.Context, conn proxy.Inbound) (favicon.Favicon, bool) {
+	sets := make([]string, 0, 3)
+	if vh := conn.VirtualHost(); vh != nil {
+		host, _, err := net.SplitHostPort(vh.String())
+		if err != nil {
+			host = vh.String()
+		}
+		sets = append(sets, strings.ToLower(host))
+	}
+
+	if theme, ok := n.thm.Current(); ok {
+		sets = append(sets, favicons.ThemeSet(theme.Name))
+	}
+
+	return n.fav.Favicon(ctx, time.Now(), append(sets, "default")...)
+}
+
+func (n *Hosting) SetFavicons(ctx context.Context, actor string, s favicons.Set) error {
+	if err := n.fav.Set(ctx, s); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "favicons.set",
+		Target:  s.Name,
+		Details: map[string]string{"icons": strings.Join(s.Icons, ","), "strategy": s.Strategy},
+	})
+}
+
+func (n *Hosting) DeleteFavicons(ctx context.Context, actor, name string) error {
+	if err := n.fav.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "favicons.delete", Target: name})
+}
+
+// AdvanceFavicons shows the next icon of the set on every proxy.
+func (n *Hosting) AdvanceFavicons(ctx context.Context, actor, name string) (favicons.Set, error) {
+	s, err := n.fav.Advance(ctx, name)
+	if err != nil {
+		return s, err
+	}
+
+	return s, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "favicons.advance",
+		Target:  name,
+		Details: map[string]string{"current": strconv.Itoa(s.Current)},
+	})
+}
+
+func (n *Hosting) handleListFavicons(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.fav.List())
+}
+
+func (n *Hosting) handleSetFavicons(w http.ResponseWriter, r *http.Request) {
+	s := favicons.Set{}
+	if err := api.ReadJSON(r, &s); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Name = strings.ToLower(r.PathValue("name"))
+
+	if err := s.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetFavicons(r.Context(), "api", s); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, s)
+}
+
+func (n *Hosting) handleDeleteFavicons(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteFavicons(r.Context(), "api", strings.ToLower(r.PathValue("name"))); errors.Is(err, favicons.ErrSetNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Hosting) handleAdvanceFavicons(w http.ResponseWriter, r *http.Request) {
+	s, err := n.AdvanceFavicons(r.Context(), "api", strings.ToLower(r.PathValue("name")))
+	if errors.Is(err, favicons.ErrSetNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, s)
+}
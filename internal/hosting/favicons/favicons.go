@@ -0,0 +1,336 @@
+// Package favicons picks the server list icon for each ping from sets of
+// icons, by the host players connect with or the active theme, so branding
+// differs by subdomain. The sets live in KV, the icons in the object store,
+// and decoded icons are cached since every ping needs one.
+package favicons
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"go.minekube.com/gate/pkg/util/favicon"
+)
+
+var ErrSetNotFound = errors.New("favicon set not found")
+
+const (
+	// Random picks an icon for every ping
+	Random = "random"
+	// Daily shows each icon for a day, in order
+	Daily = "daily"
+	// Event shows the current icon until Advance moves to the next, e.g.
+	// when a tournament starts
+	Event = "event"
+)
+
+// Set is a rotation of icons. It is named after the host it applies to, like
+// play.example.com, or ThemeSet of a theme, or default for every other ping.
+type Set struct {
+	Name string `json:"name"`
+	// Icons are names of 64x64 PNGs in the object store
+	Icons    []string `json:"icons"`
+	Strategy string   `json:"strategy,omitempty"`
+	// Current is the icon the event strategy shows
+	Current int `json:"current,omitempty"`
+}
+
+func (s Set) Validate() error {
+	if s.Name == "" {
+		return errors.New("set name is required")
+	}
+
+	if len(s.Icons) == 0 {
+		return errors.New("a set needs icons")
+	}
+
+	switch s.Strategy {
+	case "", Random, Daily, Event:
+	default:
+		return fmt.Errorf("unknown strategy %q", s.Strategy)
+	}
+
+	if s.Current < 0 || s.Current >= len(s.Icons) {
+		return errors.New("current must be the index of an icon")
+	}
+
+	return nil
+}
+
+// Pick returns the icon to show at now.
+func (s Set) Pick(now time.Time, rnd *rand.Rand) string {
+	switch s.Strategy {
+	case Daily:
+		days := now.UTC().Unix() / int64(24*time.Hour/time.Second)
+		return s.Icons[int(days%int64(len(s.Icons)))]
+	case Event:
+		return s.Icons[s.Current%len(s.Icons)]
+	default:
+		return s.Icons[rnd.Intn(len(s.Icons))]
+	}
+}
+
+// ThemeSet is the name of the set of a theme.
+func ThemeSet(theme string) string {
+	return "theme." + strings.ToLower(theme)
+}
+
+type cached struct {
+	icon    favicon.Favicon
+	err     error
+	expires time.Time
+}
+
+// Favicons keeps the sets of a bucket in memory and the icons they show.
+type Favicons struct {
+	kv    kv.Bucket
+	store object.Store
+	ttl   time.Duration
+	sets  map[string]Set
+	icons map[string]cached
+	rnd   *rand.Rand
+	m     sync.Mutex
+}
+
+// New loads the sets. Icons are cached for ttl, failures to load one for a
+// tenth of it so a missing icon doesn't hit the store on every ping.
+func New(ctx context.Context, bucket kv.Bucket, store object.Store, ttl time.Duration) (*Favicons, error) {
+	f := &Favicons{
+		kv:    bucket,
+		store: store,
+		ttl:   ttl,
+		sets:  make(map[string]Set),
+		icons: make(map[string]cached),
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if err := f.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *Favicons) Reload(ctx context.Context) error {
+	keys, err := f.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	sets := make(map[string]Set, len(keys))
+	for _, key := range keys {
+		raw, err := f.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		s := Set{}
+		if err := json.Unmarshal(raw, &s); err != nil {
+			log.Printf("Failed to unmarshal favicon set %s: %v", key, err)
+			continue
+		}
+
+		sets[key] = s
+	}
+
+	f.m.Lock()
+	f.sets = sets
+	clear(f.icons)
+	f.m.Unlock()
+
+	return nil
+}
+
+// Watch keeps the sets in sync with the bucket until ctx is done.
+func (f *Favicons) Watch(ctx context.Context) {
+	kv.Watch(ctx, f.kv, f.handleChange, f.Reload)
+}
+
+func (f *Favicons) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		s := Set{}
+		if err := json.Unmarshal(v.Value, &s); err != nil {
+			log.Printf("Failed to unmarshal favicon set %s: %v", v.Key, err)
+			return
+		}
+
+		f.sets[v.Key] = s
+		f.forget(s)
+
+	case kv.Delete:
+		delete(f.sets, v.Key)
+	}
+}
+
+// forget drops the cached icons of the set, an icon may have been replaced
+// under the same name. It must be called with the lock held.
+func (f *Favicons) forget(s Set) {
+	for _, icon := range s.Icons {
+		delete(f.icons, icon)
+	}
+}
+
+// List returns the sets sorted by name.
+func (f *Favicons) List() []Set {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	list := make([]Set, 0, len(f.sets))
+	for _, s := range f.sets {
+		list = append(list, s)
+	}
+
+	slices.SortFunc(list, func(a, b Set) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (f *Favicons) Get(name string) (Set, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	s, ok := f.sets[name]
+	return s, ok
+}
+
+func (f *Favicons) Set(ctx context.Context, s Set) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := f.kv.Set(ctx, s.Name, raw); err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	f.sets[s.Name] = s
+	f.forget(s)
+	f.m.Unlock()
+
+	return nil
+}
+
+func (f *Favicons) Delete(ctx context.Context, name string) error {
+	if err := f.kv.Delete(ctx, name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrSetNotFound
+	} else if err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	delete(f.sets, name)
+	f.m.Unlock()
+
+	return nil
+}
+
+// Advance moves the set to its next icon, for the event strategy.
+func (f *Favicons) Advance(ctx context.Context, name string) (Set, error) {
+	s, ok := f.Get(name)
+	if !ok {
+		return Set{}, ErrSetNotFound
+	}
+
+	s.Current = (s.Current + 1) % len(s.Icons)
+
+	return s, f.Set(ctx, s)
+}
+
+// Favicon returns the icon of the first of the sets that exists, false if
+// none does or its icon can't be loaded.
+func (f *Favicons) Favicon(ctx context.Context, now time.Time, sets ...string) (favicon.Favicon, bool) {
+	f.m.Lock()
+	name := ""
+	for _, set := range sets {
+		if s, ok := f.sets[set]; ok {
+			name = s.Pick(now, f.rnd)
+			break
+		}
+	}
+
+	c, ok := f.icons[name]
+	f.m.Unlock()
+
+	if name == "" {
+		return "", false
+	}
+
+	if !ok || now.After(c.expires) {
+		c = f.load(ctx, name, now)
+	}
+
+	return c.icon, c.err == nil
+}
+
+func (f *Favicons) load(ctx context.Context, name string, now time.Time) cached {
+	icon, err := f.fetch(ctx, name)
+	c := cached{icon: icon, err: err, expires: now.Add(f.ttl)}
+	if err != nil {
+		log.Printf("Failed to load favicon %s: %v", name, err)
+		c.expires = now.Add(f.ttl / 10)
+	}
+
+	f.m.Lock()
+	f.icons[name] = c
+	f.m.Unlock()
+
+	return c
+}
+
+func (f *Favicons) fetch(ctx context.Context, name string) (favicon.Favicon, error) {
+	r, err := f.store.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	return Decode(raw)
+}
+
+// Decode checks that raw is a 64x64 PNG, the only icons clients show.
+func Decode(raw []byte) (favicon.Favicon, error) {
+	cfg, err := png.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("not a PNG: %w", err)
+	}
+
+	if cfg.Width != 64 || cfg.Height != 64 {
+		return "", fmt.Errorf("icon is %dx%d, it must be 64x64", cfg.Width, cfg.Height)
+	}
+
+	return favicon.FromBytes(raw)
+}
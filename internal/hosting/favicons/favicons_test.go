@@ -0,0 +1,101 @@
+package favicons
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func icon(t *testing.T, size int) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func TestPick(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	day := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	daily := Set{Name: "default", Icons: []string{"a", "b", "c"}, Strategy: Daily}
+	if daily.Pick(day, rnd) == daily.Pick(day.Add(24*time.Hour), rnd) {
+		t.Error("daily showed the same icon two days in a row")
+	}
+	if daily.Pick(day, rnd) != daily.Pick(day.Add(time.Hour), rnd) {
+		t.Error("daily changed the icon within a day")
+	}
+
+	event := Set{Name: "default", Icons: []string{"a", "b"}, Strategy: Event, Current: 1}
+	if got := event.Pick(day, rnd); got != "b" {
+		t.Errorf("event picked %s, want b", got)
+	}
+
+	if err := (Set{Name: "default", Icons: []string{"a"}, Current: 1}).Validate(); err == nil {
+		t.Error("accepted a current icon out of range")
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(ctx, "favicons")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := object.NewMemory()
+	if err := store.Put(ctx, "icons/play.png", icon(t, 64)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "icons/large.png", icon(t, 128)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New(ctx, bucket, store, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []Set{
+		{Name: "play.example.com", Icons: []string{"icons/play.png"}},
+		{Name: "large.example.com", Icons: []string{"icons/large.png"}},
+		{Name: "missing.example.com", Icons: []string{"icons/missing.png"}},
+	} {
+		if err := f.Set(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	if _, ok := f.Favicon(ctx, now, "other.example.com", "play.example.com"); !ok {
+		t.Error("didn't fall back to the next set")
+	}
+	if _, ok := f.Favicon(ctx, now, "large.example.com"); ok {
+		t.Error("accepted an icon larger than 64x64")
+	}
+	if _, ok := f.Favicon(ctx, now, "missing.example.com", "play.example.com"); ok {
+		t.Error("fell back past a set whose icon is missing")
+	}
+	if _, ok := f.Favicon(ctx, now, "other.example.com"); ok {
+		t.Error("returned an icon without a set")
+	}
+
+	if _, err := f.Advance(ctx, "other.example.com"); err != ErrSetNotFound {
+		t.Errorf("advancing an unknown set returned %v", err)
+	}
+}
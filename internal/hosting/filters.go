@@ -0,0 +1,81 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/filters"
+)
+
+// Filters matches packets against the exploit signatures of the network.
+func (n *Hosting) Filters() *filters.Engine {
+	return n.pf
+}
+
+func (n *Hosting) SetFilter(ctx context.Context, actor string, r filters.Rule) error {
+	if err := n.pf.Set(ctx, r); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "filter.set",
+		Target: r.Name,
+		Details: map[string]string{
+			"check":    r.Check,
+			"max":      strconv.Itoa(r.Max),
+			"action":   r.Action,
+			"disabled": strconv.FormatBool(r.Disabled),
+		},
+	})
+}
+
+func (n *Hosting) DeleteFilter(ctx context.Context, actor, name string) error {
+	if err := n.pf.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "filter.delete", Target: name})
+}
+
+func (n *Hosting) handleListFilters(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.pf.List())
+}
+
+func (n *Hosting) handleSetFilter(w http.ResponseWriter, r *http.Request) {
+	rule := filters.Rule{}
+	if err := api.ReadJSON(r, &rule); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rule.Name = r.PathValue("name")
+
+	if err := rule.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetFilter(r.Context(), "api", rule); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, rule)
+}
+
+func (n *Hosting) handleDeleteFilter(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteFilter(r.Context(), "api", r.PathValue("name")); errors.Is(err, filters.ErrRuleNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,434 @@
+// Package filters matches packets against signatures of known exploits,
+// like NBT nested deep enough to overflow the stack of the backend or books
+// too large to save. Rules live in KV and are watched, so a rule against a
+// new exploit reaches every proxy within moments.
+//
+// A rule names the check it runs, Register adds checks besides the built-in
+// ones.
+package filters
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+var ErrRuleNotFound = errors.New("rule not found")
+
+const (
+	Drop = "drop"
+	Kick = "kick"
+)
+
+type Rule struct {
+	Name string `json:"name"`
+	// Check is the name of the check, e.g. nbt_depth
+	Check string `json:"check"`
+	// Disabled turns the rule off, e.g. a built-in one
+	Disabled bool `json:"disabled,omitempty"`
+	// Channels are the custom payload channels payload checks apply to, with
+	// path.Match patterns. Empty applies to every channel.
+	Channels []string `json:"channels,omitempty"`
+	// Protocols and Packets are the protocol versions and serverbound play
+	// packet IDs packet checks apply to. Empty Protocols applies to every
+	// version, but Packets are required.
+	Protocols []int `json:"protocols,omitempty"`
+	Packets   []int `json:"packets,omitempty"`
+	// Offset is where the checked value starts in the packet data, after
+	// the packet ID
+	Offset int `json:"offset,omitempty"`
+	// Max and MaxLength are the limits of the check
+	Max       int `json:"max"`
+	MaxLength int `json:"maxLength,omitempty"`
+	// Action is drop or kick, the default. Packet checks only see copies
+	// of the packets, so they can only kick.
+	Action string `json:"action,omitempty"`
+}
+
+// Check reports whether data violates the rule and why. Payload checks get
+// the data of a custom payload, packet checks that of a packet.
+type Check struct {
+	Payload bool
+	Fn      func(r Rule, data []byte) (bool, string)
+}
+
+var (
+	checks = map[string]Check{
+		"payload_size": {Payload: true, Fn: checkSize},
+		"packet_size":  {Fn: checkSize},
+		"nbt_depth":    {Fn: checkNBTDepth},
+		"book":         {Fn: checkBook},
+		"slot_index":   {Fn: checkSlot},
+	}
+	checksM sync.RWMutex
+)
+
+// Register adds a check rules can name.
+func Register(name string, c Check) {
+	checksM.Lock()
+	defer checksM.Unlock()
+
+	checks[name] = c
+}
+
+func check(name string) (Check, bool) {
+	checksM.RLock()
+	defer checksM.RUnlock()
+
+	c, ok := checks[name]
+	return c, ok
+}
+
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("rule name is required")
+	}
+
+	c, ok := check(r.Check)
+	if !ok {
+		return fmt.Errorf("unknown check %q", r.Check)
+	}
+
+	if !c.Payload && len(r.Packets) == 0 {
+		return fmt.Errorf("check %s needs packets", r.Check)
+	}
+
+	for _, pattern := range r.Channels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid channel pattern %q", pattern)
+		}
+	}
+
+	if r.Offset < 0 || r.Max < 0 || r.MaxLength < 0 {
+		return errors.New("offset and limits must not be negative")
+	}
+
+	if r.Action != "" && r.Action != Drop && r.Action != Kick {
+		return errors.New("action must be drop or kick")
+	}
+
+	if !c.Payload && r.Action == Drop {
+		return fmt.Errorf("check %s can't drop packets, only kick", r.Check)
+	}
+
+	return nil
+}
+
+// Kicks reports whether the player is kicked for violating the rule.
+func (r Rule) Kicks() bool {
+	return r.Action != Drop
+}
+
+func (r Rule) matchesChannel(channel string) bool {
+	if len(r.Channels) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(r.Channels, func(pattern string) bool {
+		ok, _ := path.Match(pattern, channel)
+		return ok
+	})
+}
+
+func (r Rule) matchesPacket(protocol, id int) bool {
+	return (len(r.Protocols) == 0 || slices.Contains(r.Protocols, protocol)) && slices.Contains(r.Packets, id)
+}
+
+// Defaults are active unless a rule with the same name replaces them. The
+// packet IDs are those of 1.20.5 to 1.21.1, other versions need rules of
+// their own.
+var Defaults = []Rule{
+	// The vanilla limit of serverbound payloads
+	{Name: "payload-size", Check: "payload_size", Max: 32767, Action: Drop},
+	// Edit Book, vanilla books have at most 100 pages of 1024 characters
+	{Name: "book", Check: "book", Protocols: []int{766, 767}, Packets: []int{0x14}, Max: 100, MaxLength: 4096},
+	// Set Creative Mode Slot, the player inventory has 46 slots
+	{Name: "creative-slot", Check: "slot_index", Protocols: []int{766, 767}, Packets: []int{0x32}, Max: 45},
+}
+
+// Engine keeps the rules of a bucket in memory.
+type Engine struct {
+	kv    kv.Bucket
+	rules map[string]Rule
+	// active are the rules in effect, rebuilt on every change since every
+	// packet goes through them
+	active []Rule
+	m      sync.RWMutex
+}
+
+func New(ctx context.Context, bucket kv.Bucket) (*Engine, error) {
+	e := &Engine{kv: bucket, rules: make(map[string]Rule), active: slices.Clone(Defaults)}
+
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Engine) Reload(ctx context.Context) error {
+	keys, err := e.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[string]Rule, len(keys))
+	for _, key := range keys {
+		raw, err := e.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		r := Rule{}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			log.Printf("Failed to unmarshal packet filter %s: %v", key, err)
+			continue
+		}
+
+		rules[key] = r
+	}
+
+	e.m.Lock()
+	e.rules = rules
+	e.rebuild()
+	e.m.Unlock()
+
+	return nil
+}
+
+// Watch keeps the rules in sync with the bucket until ctx is done.
+func (e *Engine) Watch(ctx context.Context) {
+	kv.Watch(ctx, e.kv, e.handleChange, e.Reload)
+}
+
+func (e *Engine) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		r := Rule{}
+		if err := json.Unmarshal(v.Value, &r); err != nil {
+			log.Printf("Failed to unmarshal packet filter %s: %v", v.Key, err)
+			return
+		}
+
+		e.rules[v.Key] = r
+
+	case kv.Delete:
+		delete(e.rules, v.Key)
+	}
+
+	e.rebuild()
+}
+
+// List returns the rules in effect, the defaults replaced by the stored
+// rules of the same name, sorted by name.
+func (e *Engine) List() []Rule {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return slices.Clone(e.active)
+}
+
+// rebuild must be called with the lock held.
+func (e *Engine) rebuild() {
+	list := make([]Rule, 0, len(Defaults)+len(e.rules))
+	for _, r := range Defaults {
+		if _, ok := e.rules[r.Name]; !ok {
+			list = append(list, r)
+		}
+	}
+	for _, r := range e.rules {
+		list = append(list, r)
+	}
+
+	slices.SortFunc(list, func(a, b Rule) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	e.active = list
+}
+
+func (e *Engine) Set(ctx context.Context, r Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if err := e.kv.Set(ctx, r.Name, raw); err != nil {
+		return err
+	}
+
+	e.m.Lock()
+	e.rules[r.Name] = r
+	e.rebuild()
+	e.m.Unlock()
+
+	return nil
+}
+
+// Delete removes a stored rule, a default of the same name applies again.
+func (e *Engine) Delete(ctx context.Context, name string) error {
+	if err := e.kv.Delete(ctx, name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrRuleNotFound
+	} else if err != nil {
+		return err
+	}
+
+	e.m.Lock()
+	delete(e.rules, name)
+	e.rebuild()
+	e.m.Unlock()
+
+	return nil
+}
+
+// Payload returns the first rule the custom payload violates and why.
+func (e *Engine) Payload(channel string, data []byte) (Rule, string, bool) {
+	return e.match(func(r Rule, c Check) bool {
+		return c.Payload && r.matchesChannel(channel)
+	}, data)
+}
+
+// Packet returns the first rule the serverbound play packet violates and
+// why.
+func (e *Engine) Packet(protocol, id int, data []byte) (Rule, string, bool) {
+	return e.match(func(r Rule, c Check) bool {
+		return !c.Payload && r.matchesPacket(protocol, id)
+	}, data)
+}
+
+func (e *Engine) match(applies func(r Rule, c Check) bool, data []byte) (Rule, string, bool) {
+	e.m.RLock()
+	active := e.active
+	e.m.RUnlock()
+
+	for _, r := range active {
+		if r.Disabled {
+			continue
+		}
+
+		c, ok := check(r.Check)
+		if !ok || !applies(r, c) {
+			continue
+		}
+
+		if violated, why := c.Fn(r, data); violated {
+			return r, why, true
+		}
+	}
+
+	return Rule{}, "", false
+}
+
+func checkSize(r Rule, data []byte) (bool, string) {
+	if len(data) > r.Max {
+		return true, fmt.Sprintf("%d bytes", len(data))
+	}
+
+	return false, ""
+}
+
+func checkSlot(r Rule, data []byte) (bool, string) {
+	if len(data) < r.Offset+2 {
+		return true, "truncated"
+	}
+
+	// -999 is a click outside the window, -1 none
+	slot := int(int16(binary.BigEndian.Uint16(data[r.Offset:])))
+	if slot != -999 && (slot < -1 || slot > r.Max) {
+		return true, fmt.Sprintf("slot %d", slot)
+	}
+
+	return false, ""
+}
+
+// checkBook reads the page count and pages of an Edit Book packet after the
+// slot at the offset.
+func checkBook(r Rule, data []byte) (bool, string) {
+	b := data[min(r.Offset, len(data)):]
+
+	_, n := readVarInt(b)
+	if n == 0 {
+		return true, "truncated"
+	}
+	b = b[n:]
+
+	pages, n := readVarInt(b)
+	if n == 0 || pages < 0 {
+		return true, "truncated"
+	}
+	b = b[n:]
+
+	if pages > r.Max {
+		return true, fmt.Sprintf("%d pages", pages)
+	}
+
+	for i := 0; i < pages; i++ {
+		l, n := readVarInt(b)
+		if n == 0 || l < 0 || n+l > len(b) {
+			return true, "truncated"
+		}
+
+		if r.MaxLength > 0 && l > r.MaxLength {
+			return true, fmt.Sprintf("page %d has %d bytes", i+1, l)
+		}
+
+		b = b[n+l:]
+	}
+
+	return false, ""
+}
+
+// checkNBTDepth walks the network NBT at the offset, a nameless root tag.
+func checkNBTDepth(r Rule, data []byte) (bool, string) {
+	b := data[min(r.Offset, len(data)):]
+	if len(b) == 0 {
+		return true, "truncated"
+	}
+
+	// TAG_End is an empty item
+	if b[0] == 0 {
+		return false, ""
+	}
+
+	w := nbtWalker{b: b[1:], max: r.Max}
+	if err := w.payload(b[0], 1); err != nil {
+		return true, err.Error()
+	}
+
+	return false, ""
+}
+
+// readVarInt returns the value and its length, 0 if b ends before it does.
+func readVarInt(b []byte) (int, int) {
+	var u uint32
+	for i := 0; i < 5 && i < len(b); i++ {
+		u |= uint32(b[i]&0x7F) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return int(int32(u)), i + 1
+		}
+	}
+
+	return 0, 0
+}
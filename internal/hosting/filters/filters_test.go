@@ -0,0 +1,129 @@
+package filters
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newEngine(t *testing.T) *Engine {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "filters")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := New(context.Background(), bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func varInt(v int) []byte {
+	return binary.AppendUvarint(nil, uint64(v))
+}
+
+func book(pages ...int) []byte {
+	b := append(varInt(0), varInt(len(pages))...)
+	for _, l := range pages {
+		b = append(b, varInt(l)...)
+		b = append(b, make([]byte, l)...)
+	}
+
+	return append(b, 0)
+}
+
+// nested returns a compound nesting levels-1 lists of a compound, each
+// level is two tags deep.
+func nested(levels int) []byte {
+	b := []byte{10}
+	for i := 1; i < levels; i++ {
+		// A list with one compound, named "a"
+		b = append(b, 9, 0, 1, 'a', 10, 0, 0, 0, 1)
+	}
+	for i := 1; i < levels; i++ {
+		b = append(b, 0)
+	}
+
+	return append(b, 0)
+}
+
+func TestDefaults(t *testing.T) {
+	e := newEngine(t)
+
+	if _, _, ok := e.Payload("minecraft:brand", make([]byte, 100)); ok {
+		t.Fatal("expected a small payload to pass")
+	}
+
+	if r, _, ok := e.Payload("minecraft:brand", make([]byte, 40000)); !ok || r.Name != "payload-size" || r.Kicks() {
+		t.Fatalf("expected a large payload to be dropped, got %+v %v", r, ok)
+	}
+
+	if _, _, ok := e.Packet(767, 0x14, book(10, 20)); ok {
+		t.Fatal("expected a vanilla book to pass")
+	}
+
+	if r, why, ok := e.Packet(767, 0x14, book(10, 5000)); !ok || r.Name != "book" || why != "page 2 has 5000 bytes" {
+		t.Fatalf("expected an oversized page to be caught, got %+v %q %v", r, why, ok)
+	}
+
+	if _, _, ok := e.Packet(769, 0x14, book(10, 5000)); ok {
+		t.Fatal("expected the book rule not to apply to other protocols")
+	}
+
+	slot := func(s int16) []byte {
+		return binary.BigEndian.AppendUint16(nil, uint16(s))
+	}
+
+	for s, caught := range map[int16]bool{-999: false, -1: false, 36: false, 46: true, -5: true} {
+		if _, _, ok := e.Packet(766, 0x32, slot(s)); ok != caught {
+			t.Fatalf("slot %d: expected %v, got %v", s, caught, ok)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+	e := newEngine(t)
+
+	if err := e.Set(ctx, Rule{Name: "depth", Check: "nbt_depth", Packets: []int{0x32}, Offset: 2, Max: 15}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Set(ctx, Rule{Name: "creative-slot", Check: "slot_index", Disabled: true, Packets: []int{0x32}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := e.Packet(766, 0x32, append([]byte{0, 99}, nested(8)...)); ok {
+		t.Fatal("expected NBT within the depth to pass and the slot rule to be off")
+	}
+
+	if r, _, ok := e.Packet(766, 0x32, append([]byte{0, 0}, nested(9)...)); !ok || r.Name != "depth" {
+		t.Fatalf("expected deep NBT to be caught, got %+v %v", r, ok)
+	}
+
+	if err := e.Delete(ctx, "creative-slot"); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _, ok := e.Packet(766, 0x32, append([]byte{0, 99}, nested(1)...)); !ok || r.Name != "creative-slot" {
+		t.Fatalf("expected the default slot rule to apply again, got %+v %v", r, ok)
+	}
+
+	if err := e.Set(ctx, Rule{Name: "bad", Check: "unknown"}); err == nil {
+		t.Fatal("expected an unknown check to be rejected")
+	}
+
+	if err := e.Set(ctx, Rule{Name: "bad", Check: "nbt_depth", Packets: []int{0x32}, Max: 15, Action: Drop}); err == nil {
+		t.Fatal("expected a packet rule that drops to be rejected")
+	}
+}
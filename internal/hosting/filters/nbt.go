@@ -0,0 +1,126 @@
+package filters
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errTruncated = errors.New("truncated")
+
+// nbtWalker checks the nesting of NBT without decoding it.
+type nbtWalker struct {
+	b   []byte
+	max int
+}
+
+func (w *nbtWalker) take(n int) ([]byte, error) {
+	if n < 0 || n > len(w.b) {
+		return nil, errTruncated
+	}
+
+	b := w.b[:n]
+	w.b = w.b[n:]
+
+	return b, nil
+}
+
+// length reads the int length of an array or list of elements of size.
+func (w *nbtWalker) length(size int) (int, error) {
+	b, err := w.take(4)
+	if err != nil {
+		return 0, err
+	}
+
+	l := int(int32(binary.BigEndian.Uint32(b)))
+	if l < 0 || l*size > len(w.b) {
+		return 0, errTruncated
+	}
+
+	return l, nil
+}
+
+// payload walks the payload of a tag of the type at the depth.
+func (w *nbtWalker) payload(tag byte, depth int) error {
+	if depth > w.max {
+		return fmt.Errorf("nested deeper than %d", w.max)
+	}
+
+	switch tag {
+	case 1:
+		_, err := w.take(1)
+		return err
+	case 2:
+		_, err := w.take(2)
+		return err
+	case 3, 5:
+		_, err := w.take(4)
+		return err
+	case 4, 6:
+		_, err := w.take(8)
+		return err
+	case 7, 11, 12:
+		size := map[byte]int{7: 1, 11: 4, 12: 8}[tag]
+
+		l, err := w.length(size)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.take(l * size)
+		return err
+	case 8:
+		b, err := w.take(2)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.take(int(binary.BigEndian.Uint16(b)))
+		return err
+	case 9:
+		t, err := w.take(1)
+		if err != nil {
+			return err
+		}
+
+		// Every element takes at least a byte, except for empty lists
+		l, err := w.length(0)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < l; i++ {
+			if err := w.payload(t[0], depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case 10:
+		for {
+			t, err := w.take(1)
+			if err != nil {
+				return err
+			}
+
+			if t[0] == 0 {
+				return nil
+			}
+
+			name, err := w.take(2)
+			if err != nil {
+				return err
+			}
+
+			if _, err := w.take(int(binary.BigEndian.Uint16(name))); err != nil {
+				return err
+			}
+
+			if err := w.payload(t[0], depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid tag %d", tag)
+	}
+}
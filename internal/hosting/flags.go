@@ -0,0 +1,84 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/flags"
+)
+
+// Flags turns features on and off at runtime, e.g.
+// h.Flags().Enabled(ctx, "new-queue", player.ID().String()).
+func (n *Hosting) Flags() *flags.Flags {
+	return n.flg
+}
+
+func (n *Hosting) SetFlag(ctx context.Context, actor string, flag flags.Flag) error {
+	if err := n.flg.Set(ctx, flag); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "flag.set",
+		Target: flag.Name,
+		Details: map[string]string{
+			"enabled":    strconv.FormatBool(flag.Enabled),
+			"groups":     strings.Join(flag.Groups, ","),
+			"percentage": fmt.Sprint(flag.Percentage),
+			"players":    strconv.Itoa(len(flag.Players)),
+		},
+	})
+}
+
+func (n *Hosting) DeleteFlag(ctx context.Context, actor, name string) error {
+	if err := n.flg.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "flag.delete", Target: name})
+}
+
+func (n *Hosting) handleListFlags(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.flg.List())
+}
+
+func (n *Hosting) handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	flag := flags.Flag{}
+	if err := api.ReadJSON(r, &flag); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	flag.Name = r.PathValue("name")
+
+	if err := flag.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetFlag(r.Context(), "api", flag); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, flag)
+}
+
+func (n *Hosting) handleDeleteFlag(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteFlag(r.Context(), "api", r.PathValue("name")); errors.Is(err, flags.ErrFlagNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
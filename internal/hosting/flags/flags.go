@@ -0,0 +1,240 @@
+// Package flags turns features on and off without a deploy. Flags live in KV
+// and are watched, so a change reaches every proxy within moments.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+)
+
+var ErrFlagNotFound = errors.New("flag not found")
+
+// Flag is on for a player if any of its targets matches. A flag without
+// targets is off, which is how features ship dark.
+type Flag struct {
+	Name string `json:"name"`
+	// Enabled turns the flag on for everyone
+	Enabled bool `json:"enabled"`
+	// Groups turns it on for the players in these server groups, the
+	// gamemodes
+	Groups []string `json:"groups,omitempty"`
+	// Percentage turns it on for this share of players, from 0 to 100. A
+	// player stays in the rollout as it grows.
+	Percentage float64 `json:"percentage,omitempty"`
+	// Players turns it on for these UUIDs, e.g. for testers
+	Players []string `json:"players,omitempty"`
+	// Salt is hashed with the player UUID for the rollout, it defaults to
+	// the name. Changing it picks other players.
+	Salt string `json:"salt,omitempty"`
+}
+
+func (f Flag) Validate() error {
+	if f.Name == "" {
+		return errors.New("flag name is required")
+	}
+
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return errors.New("percentage must be between 0 and 100")
+	}
+
+	return nil
+}
+
+func (f Flag) enabled(player, group string) bool {
+	if f.Enabled {
+		return true
+	}
+
+	if group != "" && slices.Contains(f.Groups, group) {
+		return true
+	}
+
+	if player == "" {
+		return false
+	}
+
+	player = uuid.Normalize(player)
+	if slices.ContainsFunc(f.Players, func(p string) bool { return uuid.Normalize(p) == player }) {
+		return true
+	}
+
+	return f.Percentage > 0 && f.rollout(player) < f.Percentage
+}
+
+// rollout places the player between 0 and 100. Players below the percentage
+// have the flag on.
+func (f Flag) rollout(player string) float64 {
+	salt := f.Salt
+	if salt == "" {
+		salt = f.Name
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(player))
+
+	return float64(h.Sum64()%10000) / 100
+}
+
+type groupKey struct{}
+
+// WithGroup sets the server group flags are evaluated for, e.g. the gamemode
+// the player is being sent to.
+func WithGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, groupKey{}, group)
+}
+
+// Flags keeps the flags of a bucket in memory.
+type Flags struct {
+	kv    kv.Bucket
+	flags map[string]Flag
+	m     sync.RWMutex
+}
+
+func New(ctx context.Context, bucket kv.Bucket) (*Flags, error) {
+	f := &Flags{kv: bucket, flags: make(map[string]Flag)}
+
+	if err := f.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *Flags) Reload(ctx context.Context) error {
+	keys, err := f.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	flags := make(map[string]Flag, len(keys))
+	for _, key := range keys {
+		raw, err := f.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		flag := Flag{}
+		if err := json.Unmarshal(raw, &flag); err != nil {
+			log.Printf("Failed to unmarshal flag %s: %v", key, err)
+			continue
+		}
+
+		flags[key] = flag
+	}
+
+	f.m.Lock()
+	f.flags = flags
+	f.m.Unlock()
+
+	return nil
+}
+
+// Watch keeps the flags in sync with the bucket until ctx is done.
+func (f *Flags) Watch(ctx context.Context) {
+	kv.Watch(ctx, f.kv, f.handleChange, f.Reload)
+}
+
+func (f *Flags) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		flag := Flag{}
+		if err := json.Unmarshal(v.Value, &flag); err != nil {
+			log.Printf("Failed to unmarshal flag %s: %v", v.Key, err)
+			return
+		}
+
+		f.flags[v.Key] = flag
+
+	case kv.Delete:
+		delete(f.flags, v.Key)
+	}
+}
+
+// Enabled reports whether the named flag is on for the player, given by
+// UUID, in the server group of ctx. Unknown flags are off.
+//
+//	if h.Flags().Enabled(ctx, "new-queue", player.ID().String()) { ... }
+func (f *Flags) Enabled(ctx context.Context, name, player string) bool {
+	f.m.RLock()
+	flag, ok := f.flags[name]
+	f.m.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	group, _ := ctx.Value(groupKey{}).(string)
+
+	return flag.enabled(player, group)
+}
+
+func (f *Flags) List() []Flag {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	list := make([]Flag, 0, len(f.flags))
+	for _, flag := range f.flags {
+		list = append(list, flag)
+	}
+
+	slices.SortFunc(list, func(a, b Flag) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (f *Flags) Set(ctx context.Context, flag Flag) error {
+	if err := flag.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+
+	if err := f.kv.Set(ctx, flag.Name, raw); err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	f.flags[flag.Name] = flag
+	f.m.Unlock()
+
+	return nil
+}
+
+func (f *Flags) Delete(ctx context.Context, name string) error {
+	if err := f.kv.Delete(ctx, name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrFlagNotFound
+	} else if err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	delete(f.flags, name)
+	f.m.Unlock()
+
+	return nil
+}
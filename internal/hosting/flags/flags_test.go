@@ -0,0 +1,133 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newFlags(t *testing.T) (*Flags, kv.Bucket) {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New(context.Background(), bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f, bucket
+}
+
+func TestTargets(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newFlags(t)
+
+	if f.Enabled(ctx, "new-queue", "069a79f444e94726a5befca90e38aaf5") {
+		t.Fatal("expected an unknown flag to be off")
+	}
+
+	if err := f.Set(ctx, Flag{Name: "new-queue", Groups: []string{"survival"}, Players: []string{"069a79f4-44e9-4726-a5be-fca90e38aaf5"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.Enabled(ctx, "new-queue", "069a79f444e94726a5befca90e38aaf5") {
+		t.Fatal("expected the flag on for a listed player")
+	}
+
+	if f.Enabled(ctx, "new-queue", "853c80ef3c3749fdaa49938b674adae6") {
+		t.Fatal("expected the flag off outside of its groups")
+	}
+
+	if !f.Enabled(WithGroup(ctx, "survival"), "new-queue", "853c80ef3c3749fdaa49938b674adae6") {
+		t.Fatal("expected the flag on in its group")
+	}
+
+	if err := f.Set(ctx, Flag{Name: "new-queue", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.Enabled(ctx, "new-queue", "") {
+		t.Fatal("expected a global flag on for everyone")
+	}
+
+	if err := f.Delete(ctx, "new-queue"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Delete(ctx, "new-queue"); !errors.Is(err, ErrFlagNotFound) {
+		t.Fatalf("expected ErrFlagNotFound, got %v", err)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newFlags(t)
+
+	enabled := func() map[string]bool {
+		on := make(map[string]bool)
+		for i := 0; i < 4000; i++ {
+			player := fmt.Sprintf("player-%d", i)
+			if f.Enabled(ctx, "new-queue", player) {
+				on[player] = true
+			}
+		}
+		return on
+	}
+
+	if err := f.Set(ctx, Flag{Name: "new-queue", Percentage: 10}); err != nil {
+		t.Fatal(err)
+	}
+	ten := enabled()
+
+	if len(ten) < 300 || len(ten) > 500 {
+		t.Fatalf("expected about 400 of 4000 players, got %d", len(ten))
+	}
+
+	if err := f.Set(ctx, Flag{Name: "new-queue", Percentage: 50}); err != nil {
+		t.Fatal(err)
+	}
+	fifty := enabled()
+
+	for player := range ten {
+		if !fifty[player] {
+			t.Fatalf("player %s left the rollout as it grew", player)
+		}
+	}
+
+	if err := f.Set(ctx, Flag{Name: "new-queue", Percentage: 120}); err == nil {
+		t.Fatal("expected a percentage above 100 to fail")
+	}
+}
+
+func TestReload(t *testing.T) {
+	ctx := context.Background()
+	f, bucket := newFlags(t)
+
+	other, err := New(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := other.Set(ctx, Flag{Name: "new-queue", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.Enabled(ctx, "new-queue", "") || len(f.List()) != 1 {
+		t.Fatal("expected the flag of the other proxy after a reload")
+	}
+}
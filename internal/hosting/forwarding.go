@@ -0,0 +1,163 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+// initForwarding hands the current secret of the keyring to Gate, which
+// reads GATE_VELOCITY_SECRET when it loads its config. Gate signs the
+// forwarding data of every backend with that one secret, so the keyring is
+// per network rather than per backend.
+func (n *Hosting) initForwarding(ctx context.Context, bucket kv.Bucket) error {
+	n.fwd = secrets.New(bucket, "keyring")
+
+	keyring, err := n.fwd.Ensure(ctx, os.Getenv("VELOCITY_SECRET"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := os.Setenv("GATE_VELOCITY_SECRET", keyring.Current.Value); err != nil {
+		return err
+	}
+
+	n.fwdVersion = keyring.Current.Version
+	n.fwdWindow = util.EnvDurationWithDefault("FORWARDING_ACCEPT_WINDOW", 24*time.Hour)
+	log.Printf("Using forwarding secret v%d", n.fwdVersion)
+
+	return nil
+}
+
+// ForwardingVersion is the version of the forwarding secret this proxy signs
+// with, 0 without a keyring.
+func (n *Hosting) ForwardingVersion() int {
+	return n.fwdVersion
+}
+
+func (n *Hosting) RotateForwarding(ctx context.Context, actor string, window time.Duration) (secrets.Keyring, error) {
+	keyring, err := n.fwd.Rotate(ctx, window, time.Now())
+	if err != nil {
+		return secrets.Keyring{}, err
+	}
+
+	return keyring, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "forwarding.rotate",
+		Target:  "v" + strconv.Itoa(keyring.Current.Version),
+		Details: map[string]string{"acceptUntil": keyring.AcceptUntil.Format(time.RFC3339)},
+	})
+}
+
+// checkForwarding fails once backends no longer accept the secret of this
+// proxy, so no players are routed to it until it is restarted with the
+// current one.
+func (n *Hosting) checkForwarding(ctx context.Context) error {
+	keyring, err := n.fwd.Keyring(ctx)
+	if err != nil {
+		// Not being able to read it is a KV problem, which the kv check
+		// reports
+		log.Printf("Failed to read the forwarding keyring: %v", err)
+		return nil
+	}
+
+	if !keyring.Accepts(n.fwdVersion, time.Now()) {
+		return fmt.Errorf("forwarding secret v%d is no longer accepted, restart to use v%d", n.fwdVersion, keyring.Current.Version)
+	}
+
+	return nil
+}
+
+func (n *Hosting) rotateForwarding(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// Of the proxies racing to rotate one wins, the others report
+			// that they didn't rotate
+			keyring, rotated, err := n.fwd.RotateIfDue(ctx, interval, n.fwdWindow, now)
+			if err != nil {
+				log.Printf("Failed to rotate the forwarding secret: %v", err)
+				continue
+			}
+
+			if !rotated {
+				continue
+			}
+
+			log.Printf("Rotated the forwarding secret to v%d, v%d is accepted until %s", keyring.Current.Version, keyring.Previous.Version, keyring.AcceptUntil.Format(time.RFC3339))
+
+			if err := n.adt.Record(ctx, audit.Entry{Actor: "scheduler", Action: "forwarding.rotate", Target: "v" + strconv.Itoa(keyring.Current.Version)}); err != nil {
+				log.Printf("Failed to record forwarding rotation: %v", err)
+			}
+		}
+	}
+}
+
+// forwardingStatus leaves out the secrets, backends read them from KV.
+type forwardingStatus struct {
+	Proxy       int       `json:"proxy"`
+	Current     int       `json:"current"`
+	Accepted    []int     `json:"accepted"`
+	AcceptUntil time.Time `json:"acceptUntil,omitempty"`
+}
+
+func (n *Hosting) handleGetForwarding(w http.ResponseWriter, r *http.Request) {
+	keyring, err := n.fwd.Keyring(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := forwardingStatus{Proxy: n.fwdVersion, Current: keyring.Current.Version, AcceptUntil: keyring.AcceptUntil}
+	for _, s := range keyring.Accepted(time.Now()) {
+		status.Accepted = append(status.Accepted, s.Version)
+	}
+
+	api.WriteJSON(w, http.StatusOK, status)
+}
+
+type rotateForwardingRequest struct {
+	// WindowSeconds defaults to FORWARDING_ACCEPT_WINDOW.
+	WindowSeconds int `json:"windowSeconds"`
+}
+
+func (n *Hosting) handleRotateForwarding(w http.ResponseWriter, r *http.Request) {
+	req := rotateForwardingRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	window := n.fwdWindow
+	if req.WindowSeconds > 0 {
+		window = time.Duration(req.WindowSeconds) * time.Second
+	}
+
+	keyring, err := n.RotateForwarding(r.Context(), "api", window)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, forwardingStatus{
+		Proxy:       n.fwdVersion,
+		Current:     keyring.Current.Version,
+		Accepted:    []int{keyring.Current.Version, keyring.Previous.Version},
+		AcceptUntil: keyring.AcceptUntil,
+	})
+}
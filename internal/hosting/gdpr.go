@@ -0,0 +1,125 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// GDPR is where plugins register the data they keep about players, e.g.
+// h.GDPR().Register("skins", gdpr.Subsystem{...}).
+func (n *Hosting) GDPR() *gdpr.Registry {
+	return n.gdp
+}
+
+// PlayerData exports or erases the data of the player across every
+// subsystem and returns the signed report. Subsystems that fail are listed
+// in the report, the others still run.
+func (n *Hosting) PlayerData(ctx context.Context, kind, actor, player string) (gdpr.Report, error) {
+	id, err := uuid.Parse(player)
+	if err != nil {
+		return gdpr.Report{}, fmt.Errorf("invalid player %q: %w", player, err)
+	}
+
+	report := gdpr.Report{
+		Version: gdpr.Version,
+		Kind:    kind,
+		Player:  id.Undashed(),
+		Actor:   actor,
+		Proxy:   n.Info.PodName,
+		Time:    time.Now().UTC(),
+	}
+
+	switch kind {
+	case gdpr.KindExport:
+		report.Sections = n.gdp.Export(ctx, report.Player)
+	case gdpr.KindErase:
+		report.Sections = n.gdp.Erase(ctx, report.Player)
+	default:
+		return gdpr.Report{}, fmt.Errorf("unknown kind %q", kind)
+	}
+
+	keyring, err := n.gdk.Ensure(ctx, "", time.Now())
+	if err != nil {
+		return gdpr.Report{}, err
+	}
+
+	if err := report.Sign(keyring); err != nil {
+		return gdpr.Report{}, err
+	}
+
+	touched := make([]string, 0, len(report.Sections))
+	for _, s := range report.Sections {
+		switch {
+		case s.Error != "":
+			touched = append(touched, s.Subsystem+":failed")
+		case kind == gdpr.KindErase:
+			touched = append(touched, s.Subsystem+":"+strconv.Itoa(s.Erased))
+		case s.Data != nil:
+			touched = append(touched, s.Subsystem)
+		}
+	}
+
+	// The audit entry only names the subsystems, it must not keep a copy of
+	// what was erased
+	if err := n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "gdpr." + kind,
+		Target:  report.Player,
+		Details: map[string]string{"subsystems": strings.Join(touched, ","), "signature": report.Signature},
+	}); err != nil {
+		return gdpr.Report{}, err
+	}
+
+	return report, nil
+}
+
+// VerifyPlayerData checks that a report was signed by this network.
+func (n *Hosting) VerifyPlayerData(ctx context.Context, report gdpr.Report) error {
+	keyring, err := n.gdk.Keyring(ctx)
+	if err != nil {
+		return err
+	}
+
+	return report.Verify(keyring)
+}
+
+func (n *Hosting) handlePlayerData(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := uuid.Parse(r.PathValue("player")); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		report, err := n.PlayerData(r.Context(), kind, "api", r.PathValue("player"))
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		api.WriteJSON(w, http.StatusOK, report)
+	}
+}
+
+func (n *Hosting) handleVerifyPlayerData(w http.ResponseWriter, r *http.Request) {
+	report := gdpr.Report{}
+	if err := api.ReadJSON(r, &report); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.VerifyPlayerData(r.Context(), report); err != nil {
+		api.WriteJSON(w, http.StatusOK, map[string]any{"valid": false, "error": err.Error()})
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]any{"valid": true})
+}
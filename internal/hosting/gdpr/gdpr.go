@@ -0,0 +1,223 @@
+// Package gdpr collects and erases what the subsystems of the proxy store
+// about a player, for data subject requests. Plugins register the data they
+// keep, and every export or erasure produces a report of what was touched,
+// signed so it can be handed out and verified later.
+package gdpr
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+)
+
+const (
+	Version = 1
+
+	KindExport = "export"
+	KindErase  = "erase"
+)
+
+var ErrInvalidSignature = errors.New("invalid report signature")
+
+// Subsystem is the data a plugin keeps about players. Both functions get the
+// undashed UUID.
+type Subsystem struct {
+	// Export returns the data of the player, nil if there is none
+	Export func(ctx context.Context, player string) (any, error)
+	// Erase deletes the data of the player, except what has to be kept
+	Erase func(ctx context.Context, player string) (Erasure, error)
+}
+
+type Erasure struct {
+	Erased int `json:"erased"`
+	// Kept is what was held back from the erasure and why
+	Kept []Hold `json:"kept,omitempty"`
+}
+
+// Hold is a record kept despite an erasure, e.g. a ban that is still being
+// enforced.
+type Hold struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type Section struct {
+	Subsystem string          `json:"subsystem"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Erased    int             `json:"erased,omitempty"`
+	Kept      []Hold          `json:"kept,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type Report struct {
+	Version  int       `json:"version"`
+	Kind     string    `json:"kind"`
+	Player   string    `json:"player"`
+	Actor    string    `json:"actor"`
+	Proxy    string    `json:"proxy"`
+	Time     time.Time `json:"time"`
+	Sections []Section `json:"sections"`
+	// Signature is v<key version>.<HMAC-SHA256 of the report without it>
+	Signature string `json:"signature,omitempty"`
+}
+
+// Failed reports whether a subsystem failed, the report is incomplete then.
+func (r Report) Failed() bool {
+	return slices.ContainsFunc(r.Sections, func(s Section) bool { return s.Error != "" })
+}
+
+func (r Report) payload() ([]byte, error) {
+	r.Signature = ""
+	return json.Marshal(r)
+}
+
+func mac(key secrets.Secret, payload []byte) string {
+	m := hmac.New(sha256.New, []byte(key.Value))
+	m.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// Sign signs the report with the current key of the keyring.
+func (r *Report) Sign(keyring secrets.Keyring) error {
+	payload, err := r.payload()
+	if err != nil {
+		return err
+	}
+
+	r.Signature = "v" + strconv.Itoa(keyring.Current.Version) + "." + mac(keyring.Current, payload)
+
+	return nil
+}
+
+// Verify checks the signature against the keys of the keyring. Reports
+// outlive key rotations, so unlike session tokens the previous key is
+// accepted regardless of its window.
+func (r Report) Verify(keyring secrets.Keyring) error {
+	rawVersion, sig, ok := strings.Cut(strings.TrimPrefix(r.Signature, "v"), ".")
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	version, err := strconv.Atoi(rawVersion)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	payload, err := r.payload()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []*secrets.Secret{&keyring.Current, keyring.Previous} {
+		if key != nil && key.Version == version && hmac.Equal([]byte(mac(*key, payload)), []byte(sig)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// Registry is the subsystems that keep player data, safe for concurrent use.
+type Registry struct {
+	subsystems map[string]Subsystem
+	names      []string
+	m          sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{subsystems: make(map[string]Subsystem)}
+}
+
+// Register adds or replaces the subsystem.
+func (r *Registry) Register(name string, s Subsystem) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.subsystems[name]; !ok {
+		r.names = append(r.names, name)
+		slices.Sort(r.names)
+	}
+
+	r.subsystems[name] = s
+}
+
+// Subsystems lists the names of the registered subsystems, sorted.
+func (r *Registry) Subsystems() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return slices.Clone(r.names)
+}
+
+func (r *Registry) each(fn func(name string, s Subsystem) Section) []Section {
+	r.m.Lock()
+	names := slices.Clone(r.names)
+	subsystems := make([]Subsystem, len(names))
+	for i, name := range names {
+		subsystems[i] = r.subsystems[name]
+	}
+	r.m.Unlock()
+
+	sections := make([]Section, len(names))
+	for i, name := range names {
+		sections[i] = fn(name, subsystems[i])
+		sections[i].Subsystem = name
+	}
+
+	return sections
+}
+
+// Export collects the data of the player from every subsystem. Failing
+// subsystems are listed with their error, the others still export.
+func (r *Registry) Export(ctx context.Context, player string) []Section {
+	return r.each(func(name string, s Subsystem) Section {
+		if s.Export == nil {
+			return Section{}
+		}
+
+		data, err := s.Export(ctx, player)
+		if err != nil {
+			return Section{Error: err.Error()}
+		}
+
+		if data == nil {
+			return Section{}
+		}
+
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return Section{Error: fmt.Sprintf("failed to marshal: %v", err)}
+		}
+
+		return Section{Data: raw}
+	})
+}
+
+// Erase deletes the data of the player from every subsystem.
+func (r *Registry) Erase(ctx context.Context, player string) []Section {
+	return r.each(func(name string, s Subsystem) Section {
+		if s.Erase == nil {
+			return Section{}
+		}
+
+		e, err := s.Erase(ctx, player)
+		section := Section{Erased: e.Erased, Kept: e.Kept}
+		if err != nil {
+			section.Error = err.Error()
+		}
+
+		return section
+	})
+}
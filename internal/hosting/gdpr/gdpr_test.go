@@ -0,0 +1,84 @@
+package gdpr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register("skins", Subsystem{
+		Export: func(ctx context.Context, player string) (any, error) {
+			return map[string]string{"account": player}, nil
+		},
+		Erase: func(ctx context.Context, player string) (Erasure, error) {
+			return Erasure{Erased: 1}, nil
+		},
+	})
+	r.Register("links", Subsystem{
+		Export: func(ctx context.Context, player string) (any, error) {
+			return nil, errors.New("unavailable")
+		},
+	})
+	r.Register("chat", Subsystem{
+		Export: func(ctx context.Context, player string) (any, error) {
+			return nil, nil
+		},
+	})
+
+	sections := r.Export(context.Background(), "069a79f444e94726a5befca90e38aaf5")
+	if len(sections) != 3 || sections[0].Subsystem != "chat" || sections[1].Subsystem != "links" || sections[2].Subsystem != "skins" {
+		t.Fatalf("expected a section per subsystem sorted by name, got %+v", sections)
+	}
+
+	if sections[0].Data != nil || sections[1].Error != "unavailable" || string(sections[2].Data) != `{"account":"069a79f444e94726a5befca90e38aaf5"}` {
+		t.Fatalf("unexpected sections %+v", sections)
+	}
+
+	erased := r.Erase(context.Background(), "069a79f444e94726a5befca90e38aaf5")
+	if erased[2].Erased != 1 || erased[0].Erased != 0 {
+		t.Fatalf("expected skins to erase 1 record, got %+v", erased)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	now := time.Now()
+	keyring := secrets.Keyring{Current: secrets.Secret{Version: 1, Value: "first", Created: now}}
+
+	r := Report{Version: Version, Kind: KindExport, Player: "069a79f444e94726a5befca90e38aaf5", Time: now, Sections: []Section{{Subsystem: "skins", Data: json.RawMessage(`{"account":"853c80ef3c3749fdaa49938b674adae6"}`)}}}
+	if err := r.Sign(keyring); err != nil {
+		t.Fatal(err)
+	}
+
+	// As handed out by the API and read back from a file
+	raw, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = Report{}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Verify(keyring); err != nil {
+		t.Fatalf("expected the signature to verify, got %v", err)
+	}
+
+	// Long after the rotation window
+	rotated := secrets.Keyring{Current: secrets.Secret{Version: 2, Value: "second"}, Previous: &keyring.Current, AcceptUntil: now.Add(-time.Hour)}
+	if err := r.Verify(rotated); err != nil {
+		t.Fatalf("expected the previous key to verify, got %v", err)
+	}
+
+	tampered := r
+	tampered.Sections = []Section{{Subsystem: "skins", Data: json.RawMessage(`{"account":"069a79f444e94726a5befca90e38aaf5"}`)}}
+	if err := tampered.Verify(keyring); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a tampered report to fail, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/graphql"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// GraphQLPlayer is what the Player object of the GraphQL schema resolves
+// from, so plugins can add the fields of their services to it.
+type GraphQLPlayer struct {
+	// UUID is undashed
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+	// Player is nil if they aren't on this proxy
+	Player proxy.Player `json:"-"`
+}
+
+// GraphQL is the schema of POST /graphql. Plugins add fields to its objects,
+// e.g. h.GraphQL().Object("Player").Field("punishments", ...).
+func (n *Hosting) GraphQL() *graphql.Schema {
+	return n.gql
+}
+
+func (n *Hosting) initGraphQL() {
+	n.gql.Query().Field("incident", graphql.Field{
+		Type:        n.gql.Object("Incident"),
+		Description: "Whether incident mode is on",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			state, _ := n.Incident()
+			return state, nil
+		},
+	})
+
+	incident := n.gql.Object("Incident")
+	for _, name := range []string{"active", "reason", "actor", "since"} {
+		incident.Field(name, graphql.Field{})
+	}
+}
+
+func (n *Hosting) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	req := graphql.Request{}
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	} else if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Query == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("query is required"))
+		return
+	}
+
+	res := n.gql.Execute(r.Context(), req)
+	if res.Data == nil {
+		api.WriteJSON(w, http.StatusBadRequest, res)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, res)
+}
+
+func (n *Hosting) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.gql.Describe())
+}
@@ -0,0 +1,469 @@
+// Package graphql serves read-only GraphQL queries over the services of the
+// proxy, so the dashboard can fetch a player with their punishments, ping
+// and location in one round trip. Plugins add the fields of their services
+// to the shared objects, queries are checked against depth and complexity
+// limits before anything is resolved.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Args are the arguments of a field, ints are int64 and floats float64.
+type Args map[string]any
+
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int returns the argument or def if it wasn't given.
+func (a Args) Int(name string, def int) int {
+	switch v := a[name].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+
+	return def
+}
+
+func (a Args) Bool(name string) bool {
+	b, _ := a[name].(bool)
+	return b
+}
+
+// Resolve returns the value of a field of source, the value its parent
+// resolved to. Slices resolve list fields.
+type Resolve func(ctx context.Context, source any, args Args) (any, error)
+
+type Field struct {
+	// Type is the object the field resolves to, nil for scalars
+	Type *Object
+	// Args are the arguments the field takes, others are rejected
+	Args []string
+	// Resolve defaults to the property of source with the field's name:
+	// the key of a map or the struct field with that JSON name
+	Resolve Resolve
+	// List fields multiply the complexity of their selection
+	List        bool
+	Description string
+}
+
+// Object is a GraphQL object type. Plugins add fields to it as they
+// initialize, so it is safe for concurrent use.
+type Object struct {
+	Name   string
+	fields map[string]*Field
+	m      sync.RWMutex
+}
+
+// Field adds or replaces the field of the object.
+func (o *Object) Field(name string, f Field) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	o.fields[name] = &f
+}
+
+func (o *Object) field(name string) (*Field, bool) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
+	f, ok := o.fields[name]
+	return f, ok
+}
+
+// Fields lists the names of the fields, for the schema description.
+func (o *Object) Fields() []string {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
+	names := make([]string, 0, len(o.fields))
+	for name := range o.fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+type Options struct {
+	// MaxDepth is how deep selections may nest
+	MaxDepth int
+	// MaxComplexity caps the fields a query may resolve. Every field costs
+	// 1, the selection of a list field costs ListFactor times as much.
+	MaxComplexity int
+	ListFactor    int
+}
+
+type Schema struct {
+	opts    Options
+	objects map[string]*Object
+	m       sync.Mutex
+}
+
+func NewSchema(opts Options) *Schema {
+	return &Schema{opts: opts, objects: make(map[string]*Object)}
+}
+
+// Object returns the named object, creating it so plugins can extend an
+// object regardless of which of them initializes first. Query is the root.
+func (s *Schema) Object(name string) *Object {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	o, ok := s.objects[name]
+	if !ok {
+		o = &Object{Name: name, fields: make(map[string]*Field)}
+		s.objects[name] = o
+	}
+
+	return o
+}
+
+// Query is the root object.
+func (s *Schema) Query() *Object {
+	return s.Object("Query")
+}
+
+// Describe lists every object with its fields, in place of the
+// introspection queries this package doesn't answer.
+func (s *Schema) Describe() map[string][]string {
+	s.m.Lock()
+	objects := make([]*Object, 0, len(s.objects))
+	for _, o := range s.objects {
+		objects = append(objects, o)
+	}
+	s.m.Unlock()
+
+	described := make(map[string][]string, len(objects))
+	for _, o := range objects {
+		described[o.Name] = o.Fields()
+	}
+
+	return described
+}
+
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   *ordered `json:"data,omitempty"`
+	Errors []Error  `json:"errors,omitempty"`
+}
+
+// Execute runs the query. Errors of the document fail it as a whole, those
+// of resolvers null their field and are listed next to the data.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	vars, err := op.variableValues(req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	if err := s.validate(op.selection, s.Query(), 1); err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	if c := s.complexity(op.selection, s.Query()); s.opts.MaxComplexity > 0 && c > s.opts.MaxComplexity {
+		return Response{Errors: []Error{{Message: fmt.Sprintf("query complexity %d exceeds the limit of %d", c, s.opts.MaxComplexity)}}}
+	}
+
+	e := &execution{vars: vars}
+	data := e.object(ctx, s.Query(), nil, op.selection, nil)
+
+	return Response{Data: data, Errors: e.errors}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for a document with several operations")
+		}
+
+		return d.operations[0], nil
+	}
+
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+func (op *operation) variableValues(given map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(op.variables))
+	for _, def := range op.variables {
+		v, ok := given[def.name]
+		if !ok && def.hasValue {
+			v, ok = def.fallback, true
+		}
+
+		if (!ok || v == nil) && def.nonNull {
+			return nil, fmt.Errorf("variable $%s is required", def.name)
+		}
+
+		// JSON numbers without a fraction are ints, like literals
+		if f, isFloat := v.(float64); isFloat && f == float64(int64(f)) {
+			v = int64(f)
+		}
+
+		vars[def.name] = v
+	}
+
+	return vars, nil
+}
+
+// validate rejects unknown fields and arguments and selections that nest
+// deeper than MaxDepth.
+func (s *Schema) validate(selection []*field, obj *Object, depth int) error {
+	if s.opts.MaxDepth > 0 && depth > s.opts.MaxDepth {
+		return fmt.Errorf("query depth exceeds the limit of %d", s.opts.MaxDepth)
+	}
+
+	for _, f := range selection {
+		if f.name == "__typename" {
+			if f.selection != nil {
+				return fmt.Errorf("line %d: __typename has no fields", f.line)
+			}
+			continue
+		}
+
+		def, ok := obj.field(f.name)
+		if !ok {
+			return fmt.Errorf("line %d: %s has no field %s", f.line, obj.Name, f.name)
+		}
+
+		for arg := range f.arguments {
+			if !slices.Contains(def.Args, arg) {
+				return fmt.Errorf("line %d: field %s of %s has no argument %s", f.line, f.name, obj.Name, arg)
+			}
+		}
+
+		switch {
+		case def.Type == nil && f.selection != nil:
+			return fmt.Errorf("line %d: field %s of %s has no fields", f.line, f.name, obj.Name)
+		case def.Type != nil && f.selection == nil:
+			return fmt.Errorf("line %d: field %s of %s needs a selection of %s fields", f.line, f.name, obj.Name, def.Type.Name)
+		case def.Type != nil:
+			if err := s.validate(f.selection, def.Type, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) complexity(selection []*field, obj *Object) int {
+	total := 0
+	for _, f := range selection {
+		total++
+
+		def, ok := obj.field(f.name)
+		if !ok || def.Type == nil {
+			continue
+		}
+
+		nested := s.complexity(f.selection, def.Type)
+		if def.List {
+			nested *= max(s.opts.ListFactor, 1)
+		}
+		total += nested
+	}
+
+	return total
+}
+
+type execution struct {
+	vars   map[string]any
+	errors []Error
+	m      sync.Mutex
+}
+
+func (e *execution) fail(path []any, err error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.errors = append(e.errors, Error{Message: err.Error(), Path: slices.Clone(path)})
+}
+
+func (e *execution) object(ctx context.Context, obj *Object, source any, selection []*field, path []any) *ordered {
+	out := &ordered{}
+
+	for _, f := range selection {
+		key := f.key()
+		if f.name == "__typename" {
+			out.set(key, obj.Name)
+			continue
+		}
+
+		def, _ := obj.field(f.name)
+		fieldPath := append(slices.Clone(path), key)
+
+		args := make(Args, len(f.arguments))
+		for name, v := range f.arguments {
+			args[name] = v.resolve(e.vars)
+		}
+
+		resolve := def.Resolve
+		if resolve == nil {
+			resolve = property(f.name)
+		}
+
+		v, err := resolve(ctx, source, args)
+		if err != nil {
+			e.fail(fieldPath, err)
+			out.set(key, nil)
+			continue
+		}
+
+		out.set(key, e.complete(ctx, def, v, f.selection, fieldPath))
+	}
+
+	return out
+}
+
+func (e *execution) complete(ctx context.Context, def *Field, v any, selection []*field, path []any) any {
+	if isNil(v) || def.Type == nil {
+		return v
+	}
+
+	if !def.List {
+		return e.object(ctx, def.Type, v, selection, path)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		e.fail(path, fmt.Errorf("expected a list, got %T", v))
+		return nil
+	}
+
+	list := make([]any, rv.Len())
+	for i := range rv.Len() {
+		list[i] = e.object(ctx, def.Type, rv.Index(i).Interface(), selection, append(slices.Clone(path), i))
+	}
+
+	return list
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	return false
+}
+
+// property resolves a field to the map key or JSON struct field of source
+// with its name.
+func property(name string) Resolve {
+	return func(ctx context.Context, source any, args Args) (any, error) {
+		if m, ok := source.(map[string]any); ok {
+			return m[name], nil
+		}
+
+		rv := reflect.ValueOf(source)
+		for rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return nil, nil
+			}
+			rv = rv.Elem()
+		}
+
+		if rv.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%s can't be resolved from %T", name, source)
+		}
+
+		for i := range rv.NumField() {
+			sf := rv.Type().Field(i)
+			tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if tag == name || (tag == "" && sf.Name == name) {
+				return rv.Field(i).Interface(), nil
+			}
+		}
+
+		return nil, fmt.Errorf("%T has no property %s", source, name)
+	}
+}
+
+// ordered keeps the fields of a result in the order they were selected.
+type ordered struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *ordered) set(key string, v any) {
+	if o.values == nil {
+		o.values = make(map[string]any)
+	}
+
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *ordered) Get(key string) any {
+	return o.values[key]
+}
+
+func (o *ordered) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
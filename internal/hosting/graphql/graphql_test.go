@@ -0,0 +1,133 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type player struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+func newSchema() *Schema {
+	s := NewSchema(Options{MaxDepth: 4, MaxComplexity: 200, ListFactor: 10})
+
+	players := map[string]player{
+		"069a79f444e94726a5befca90e38aaf5": {UUID: "069a79f444e94726a5befca90e38aaf5", Name: "Notch"},
+		"853c80ef3c3749fdaa49938b674adae6": {UUID: "853c80ef3c3749fdaa49938b674adae6", Name: "jeb_"},
+	}
+
+	p := s.Object("Player")
+	p.Field("uuid", Field{})
+	p.Field("name", Field{})
+
+	s.Query().Field("player", Field{
+		Type: p,
+		Args: []string{"uuid"},
+		Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+			if pl, ok := players[args.String("uuid")]; ok {
+				return pl, nil
+			}
+
+			return nil, nil
+		},
+	})
+
+	s.Query().Field("players", Field{
+		Type: p,
+		List: true,
+		Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+			return []player{players["853c80ef3c3749fdaa49938b674adae6"], players["069a79f444e94726a5befca90e38aaf5"]}, nil
+		},
+	})
+
+	// Extended by another plugin after the query fields were added
+	p.Field("punishments", Field{
+		Type: s.Object("Punishment"),
+		List: true,
+		Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+			if source.(player).Name == "jeb_" {
+				return nil, errors.New("punishments are unavailable")
+			}
+
+			return []map[string]any{{"kind": "mute", "reason": "spam"}}, nil
+		},
+	})
+	s.Object("Punishment").Field("kind", Field{})
+	s.Object("Punishment").Field("reason", Field{})
+
+	return s
+}
+
+func marshal(t *testing.T, res Response) string {
+	t.Helper()
+
+	raw, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(raw)
+}
+
+func TestExecute(t *testing.T) {
+	res := newSchema().Execute(context.Background(), Request{
+		Query: `query Profile($uuid: String!) {
+			# The dashboard's profile view
+			player(uuid: $uuid) { name, id: uuid, punishments { kind } __typename }
+			missing: player(uuid: "00000000000000000000000000000000") { name }
+		}`,
+		Variables: map[string]any{"uuid": "069a79f444e94726a5befca90e38aaf5"},
+	})
+
+	want := `{"data":{"player":{"name":"Notch","id":"069a79f444e94726a5befca90e38aaf5","punishments":[{"kind":"mute"}],"__typename":"Player"},"missing":null}}`
+	if got := marshal(t, res); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	res := newSchema().Execute(context.Background(), Request{Query: `{ players { name punishments { reason } } }`})
+
+	want := `{"data":{"players":[{"name":"jeb_","punishments":null},{"name":"Notch","punishments":[{"reason":"spam"}]}]},"errors":[{"message":"punishments are unavailable","path":["players",0,"punishments"]}]}`
+	if got := marshal(t, res); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	for query, msg := range map[string]string{
+		`{ player(uuid: "x") { email } }`:                           "Player has no field email",
+		`{ player(name: "Notch") { name } }`:                        "has no argument name",
+		`{ player(uuid: "x") }`:                                     "needs a selection of Player fields",
+		`{ players { name { first } } }`:                            "has no fields",
+		`mutation { ban }`:                                          "only queries are supported",
+		`{ players { ...Names } }`:                                  "fragments are not supported",
+		`{ players { punishments { kind reason } name uuid } }`:     "complexity 231 exceeds the limit of 200",
+		`query($uuid: String!) { player(uuid: $uuid) { name } }`:    "variable $uuid is required",
+		`{ player(uuid: "x") { name }`:                              "expected a name, found the end of the document",
+		`query A { players { name } } query B { players { name } }`: "operationName is required",
+	} {
+		res := newSchema().Execute(context.Background(), Request{Query: query})
+		if res.Data != nil || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, msg) {
+			t.Fatalf("expected %q to be rejected with %q, got %s", query, msg, marshal(t, res))
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	s := newSchema()
+	p := s.Object("Player")
+	p.Field("friends", Field{Type: p, List: true, Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+		return nil, nil
+	}})
+
+	res := s.Execute(context.Background(), Request{Query: `{ player(uuid: "x") { friends { friends { friends { name } } } } }`})
+	if len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "depth exceeds the limit of 4") {
+		t.Fatalf("expected the depth limit, got %s", marshal(t, res))
+	}
+}
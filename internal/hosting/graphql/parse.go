@@ -0,0 +1,616 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The parser takes the query subset of GraphQL the dashboard needs:
+// operations with variables, fields with aliases and arguments, and nested
+// selections. Fragments, directives, mutations and subscriptions are
+// rejected.
+
+type document struct {
+	operations []*operation
+}
+
+type operation struct {
+	name      string
+	variables []variableDefinition
+	selection []*field
+}
+
+type variableDefinition struct {
+	name     string
+	nonNull  bool
+	fallback any
+	hasValue bool
+}
+
+type field struct {
+	alias     string
+	name      string
+	arguments map[string]value
+	selection []*field
+	line      int
+}
+
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+
+	return f.name
+}
+
+// value is a literal or a variable reference, resolved when the operation
+// runs.
+type value struct {
+	literal  any
+	variable string
+	list     []value
+	object   map[string]value
+	kind     valueKind
+}
+
+type valueKind int
+
+const (
+	literalValue valueKind = iota
+	variableValue
+	listValue
+	objectValue
+)
+
+func (v value) resolve(vars map[string]any) any {
+	switch v.kind {
+	case variableValue:
+		return vars[v.variable]
+	case listValue:
+		list := make([]any, len(v.list))
+		for i, item := range v.list {
+			list[i] = item.resolve(vars)
+		}
+		return list
+	case objectValue:
+		obj := make(map[string]any, len(v.object))
+		for k, item := range v.object {
+			obj[k] = item.resolve(vars)
+		}
+		return obj
+	}
+
+	return v.literal
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return l.token()
+		}
+	}
+
+	return token{kind: tokenEOF, line: l.line}, nil
+}
+
+func (l *lexer) token() (token, error) {
+	start, c := l.pos, l.src[l.pos]
+
+	switch {
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunct, text: string(c), line: l.line}, nil
+
+	case c == '.':
+		if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.pos += 3
+			return token{kind: tokenPunct, text: "...", line: l.line}, nil
+		}
+
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, text: l.src[start:l.pos], line: l.line}, nil
+
+	case c == '-' || isDigit(c):
+		return l.number()
+
+	case c == '"':
+		return l.string()
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return token{}, fmt.Errorf("line %d: unexpected character %q", l.line, r)
+}
+
+func (l *lexer) number() (token, error) {
+	start, kind := l.pos, tokenInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+
+	digits := func() {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+
+	digits()
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		digits()
+	}
+
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+
+	return token{kind: kind, text: l.src[start:l.pos], line: l.line}, nil
+}
+
+func (l *lexer) string() (token, error) {
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		return token{}, fmt.Errorf("line %d: block strings are not supported", l.line)
+	}
+
+	l.pos++
+	sb := strings.Builder{}
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokenString, text: sb.String(), line: l.line}, nil
+		case '\n':
+			return token{}, fmt.Errorf("line %d: unterminated string", l.line)
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, fmt.Errorf("line %d: unterminated string", l.line)
+			}
+
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case '"', '\\', '/':
+				sb.WriteByte(e)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if l.pos+5 > len(l.src) {
+					return token{}, fmt.Errorf("line %d: invalid unicode escape", l.line)
+				}
+
+				r, err := strconv.ParseUint(l.src[l.pos+1:l.pos+5], 16, 32)
+				if err != nil {
+					return token{}, fmt.Errorf("line %d: invalid unicode escape", l.line)
+				}
+				sb.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				return token{}, fmt.Errorf("line %d: invalid escape \\%c", l.line, e)
+			}
+			l.pos++
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	return token{}, fmt.Errorf("line %d: unterminated string", l.line)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func parse(src string) (*document, error) {
+	p := &parser{lex: &lexer{src: src, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{}
+	for p.tok.kind != tokenEOF {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		doc.operations = append(doc.operations, op)
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("the document has no operation")
+	}
+
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) is(text string) bool {
+	return p.tok.kind == tokenPunct && p.tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.unexpected("%q", text)
+	}
+
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected("a name")
+	}
+
+	name := p.tok.text
+	return name, p.advance()
+}
+
+func (p *parser) unexpected(format string, args ...any) error {
+	found := p.tok.text
+	if p.tok.kind == tokenEOF {
+		found = "the end of the document"
+	} else if p.tok.kind == tokenString {
+		found = strconv.Quote(found)
+	}
+
+	return fmt.Errorf("line %d: expected %s, found %s", p.tok.line, fmt.Sprintf(format, args...), found)
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{}
+
+	if p.tok.kind == tokenName {
+		switch p.tok.text {
+		case "query":
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("line %d: only queries are supported", p.tok.line)
+		case "fragment":
+			return nil, fmt.Errorf("line %d: fragments are not supported", p.tok.line)
+		default:
+			return nil, p.unexpected("an operation")
+		}
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		if p.tok.kind == tokenName {
+			op.name = p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.is("(") {
+			vars, err := p.variableDefinitions()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = vars
+		}
+	}
+
+	selection, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selection = selection
+
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]variableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var defs []variableDefinition
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		def := variableDefinition{name: name}
+		if def.nonNull, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+
+		if p.is("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+
+			v, err := p.value(true)
+			if err != nil {
+				return nil, err
+			}
+			def.fallback, def.hasValue = v.resolve(nil), true
+		}
+
+		defs = append(defs, def)
+	}
+
+	return defs, p.advance()
+}
+
+// typeRef skips a type like [String!]!, types are only checked by the
+// resolvers. It reports whether the outer type is non-null.
+func (p *parser) typeRef() (bool, error) {
+	if p.is("[") {
+		if err := p.advance(); err != nil {
+			return false, err
+		}
+
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+
+	if p.is("!") {
+		return true, p.advance()
+	}
+
+	return false, nil
+}
+
+func (p *parser) selectionSet() ([]*field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var fields []*field
+	for !p.is("}") {
+		if p.is("...") {
+			return nil, fmt.Errorf("line %d: fragments are not supported", p.tok.line)
+		}
+
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+
+	if len(fields) == 0 {
+		return nil, p.unexpected("a field")
+	}
+
+	return fields, p.advance()
+}
+
+func (p *parser) field() (*field, error) {
+	f := &field{line: p.tok.line}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		f.alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	f.name = name
+
+	if p.is("(") {
+		if f.arguments, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.is("@") {
+		return nil, fmt.Errorf("line %d: directives are not supported", p.tok.line)
+	}
+
+	if p.is("{") {
+		if f.selection, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (p *parser) arguments() (map[string]value, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]value)
+	for !p.is(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = v
+	}
+
+	return args, p.advance()
+}
+
+// value parses a value, constant ones can't reference variables.
+func (p *parser) value(constant bool) (value, error) {
+	tok := p.tok
+
+	switch {
+	case p.is("$") && !constant:
+		if err := p.advance(); err != nil {
+			return value{}, err
+		}
+
+		name, err := p.name()
+		return value{kind: variableValue, variable: name}, err
+
+	case p.is("["):
+		if err := p.advance(); err != nil {
+			return value{}, err
+		}
+
+		v := value{kind: listValue}
+		for !p.is("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return value{}, err
+			}
+			v.list = append(v.list, item)
+		}
+
+		return v, p.advance()
+
+	case p.is("{"):
+		if err := p.advance(); err != nil {
+			return value{}, err
+		}
+
+		v := value{kind: objectValue, object: make(map[string]value)}
+		for !p.is("}") {
+			name, err := p.name()
+			if err != nil {
+				return value{}, err
+			}
+
+			if err := p.expect(":"); err != nil {
+				return value{}, err
+			}
+
+			if v.object[name], err = p.value(constant); err != nil {
+				return value{}, err
+			}
+		}
+
+		return v, p.advance()
+
+	case tok.kind == tokenInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return value{}, fmt.Errorf("line %d: invalid int %s", tok.line, tok.text)
+		}
+		return value{literal: n}, p.advance()
+
+	case tok.kind == tokenFloat:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return value{}, fmt.Errorf("line %d: invalid float %s", tok.line, tok.text)
+		}
+		return value{literal: f}, p.advance()
+
+	case tok.kind == tokenString:
+		return value{literal: tok.text}, p.advance()
+
+	case tok.kind == tokenName:
+		switch tok.text {
+		case "true":
+			return value{literal: true}, p.advance()
+		case "false":
+			return value{literal: false}, p.advance()
+		case "null":
+			return value{literal: nil}, p.advance()
+		}
+
+		// Enum values are passed on as their names
+		return value{literal: tok.text}, p.advance()
+	}
+
+	return value{}, p.unexpected("a value")
+}
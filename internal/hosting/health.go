@@ -0,0 +1,173 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const (
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+var healthCheckTimeout = 2 * time.Second
+
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status   string           `json:"status"`
+	Pod      string           `json:"pod"`
+	Checks   map[string]Check `json:"checks"`
+	Plugins  []PluginState    `json:"plugins,omitempty"`
+	Watchers []kv.WatchState  `json:"watchers,omitempty"`
+	Backends []string         `json:"backends,omitempty"`
+}
+
+func (r *HealthReport) check(name string, err error) {
+	if err != nil {
+		r.Checks[name] = Check{Status: StatusFail, Error: err.Error()}
+		r.Status = StatusFail
+		return
+	}
+
+	r.Checks[name] = Check{Status: StatusOk}
+}
+
+func (n *Hosting) setProxy(prx *proxy.Proxy) {
+	n.prx.Store(prx)
+}
+
+// Proxy is the proxy the plugins were initialized with, nil before that.
+func (n *Hosting) Proxy() *proxy.Proxy {
+	return n.prx.Load()
+}
+
+// Health is the liveness of the proxy process. It leaves out everything that
+// is shared by the cluster, so an outage of NATS or a rotation of the
+// forwarding secret doesn't restart every proxy at once.
+func (n *Hosting) Health(ctx context.Context) *HealthReport {
+	return &HealthReport{
+		Status: StatusOk,
+		Pod:    n.Info.PodName,
+		Checks: make(map[string]Check),
+	}
+}
+
+// Readiness extends Health with the connections to the KV and messaging
+// backends, the forwarding secret and the plugin and watcher state. The proxy is ready once every
+// plugin initialized, every KV watcher is connected and every warmup loaded.
+func (n *Hosting) Readiness(ctx context.Context) *HealthReport {
+	r := n.Health(ctx)
+
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	_, err := n.kv.ListBuckets(checkCtx)
+	r.check("kv", err)
+	r.check("messaging", n.msg.Ping(checkCtx))
+
+	if n.fwd != nil {
+		r.check("forwarding", n.checkForwarding(checkCtx))
+	}
+
+	r.Plugins = n.PluginStates()
+	r.Watchers = kv.WatchStates()
+
+	var pluginsErr error
+	for _, p := range r.Plugins {
+		if p.State == PluginPending || p.State == PluginFailed {
+			pluginsErr = fmt.Errorf("plugin %s is %s", p.Name, p.State)
+			break
+		}
+	}
+	r.check("plugins", pluginsErr)
+
+	var watchersErr error
+	for _, w := range r.Watchers {
+		if !w.Connected {
+			watchersErr = fmt.Errorf("watcher for bucket %s is disconnected", w.Bucket)
+			break
+		}
+	}
+	r.check("watchers", watchersErr)
+
+	var warmupErr error
+	for _, s := range n.WarmupStates() {
+		if s.State != WarmupLoaded {
+			warmupErr = fmt.Errorf("warmup %s is %s", s.Name, s.State)
+			break
+		}
+	}
+	r.check("warmup", warmupErr)
+
+	var drainErr error
+	if n.Draining() {
+		drainErr = errors.New("draining for a restart")
+	}
+	r.check("draining", drainErr)
+
+	if prx := n.prx.Load(); prx != nil {
+		for _, s := range prx.Servers() {
+			r.Backends = append(r.Backends, s.ServerInfo().Name())
+		}
+	}
+
+	return r
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// handleHealth and handleReady are public, so they only answer with the
+// status. handleReadyDetails returns the whole report with the token.
+func (n *Hosting) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, n.Health(r.Context()))
+}
+
+func (n *Hosting) handleReady(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, n.Readiness(r.Context()))
+}
+
+func (n *Hosting) handleReadyDetails(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, n.Readiness(r.Context()))
+}
+
+func writeStatus(w http.ResponseWriter, r *HealthReport) {
+	status := http.StatusOK
+	if r.Status != StatusOk {
+		status = http.StatusServiceUnavailable
+	}
+
+	api.WriteJSON(w, status, statusResponse{Status: r.Status})
+}
+
+func writeReport(w http.ResponseWriter, r *HealthReport) {
+	status := http.StatusOK
+	if r.Status != StatusOk {
+		status = http.StatusServiceUnavailable
+	}
+
+	api.WriteJSON(w, status, r)
+}
+
+// handleGetSharedWatchers lists the watchers shared through KV_WATCH_MUX with
+// their number of subscribers.
+func (n *Hosting) handleGetSharedWatchers(w http.ResponseWriter, r *http.Request) {
+	if n.mux == nil {
+		api.WriteJSON(w, http.StatusOK, []kv.FeedState{})
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, n.mux.Feeds())
+}
@@ -1,21 +1,128 @@
 package hosting
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"strconv"
-
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/bandwidth"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/experiments"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/favicons"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/filters"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/flags"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/graphql"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	_ "github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv/sqldrivers"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/migrations"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/netbuf"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/profiles"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/provider"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/quality"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/regions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/reporting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/sessions"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/themes"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/webhooks"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/nats-io/nats.go"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
 )
 
 type Hosting struct {
-	strg storage.Storage
-	kv   kv.Client
-	msg  messaging.Messager
-	Info *PodInfo
+	strg  storage.Storage
+	kv    kv.Client
+	obj   object.Store
+	msg   messaging.Messager
+	api   *api.Server
+	adt   *audit.Log
+	lc    *lifecycle
+	rl    reloaders
+	wu    warmups
+	nw    networks
+	tr    traces
+	conns connections
+	mon   *monitor
+	inc   *incident
+	rt    kv.Bucket
+	exp   *experiments.Experiments
+	flg   *flags.Flags
+	whk   *webhooks.Webhooks
+	gql   *graphql.Schema
+	gdp   *gdpr.Registry
+	gdk   *secrets.Keyrings
+	pf    *filters.Engine
+	qlt   *quality.Tracker
+	bw    *bandwidth.Meter
+	prf   *profiles.Cache
+	thm   *themes.Themes
+	fav   *favicons.Favicons
+	fwd   *secrets.Keyrings
+	ses   *sessions.Signer
+	reg   *regions.Directory
+	geo   *regions.GeoIP
+	cls   *cluster.Registry
+	dh    deathHooks
+	sch   schemas
+	ret   retentions
+	ro    rollouts
+	bk    backends
+	pkt   *packets.Inspector
+	nb    *netbuf.Pool
+	flt   map[string]*faults.Injector
+	enc   *kv.Encoded
+	mux   *kv.Muxed
+	snp   *kv.Snapshots
+	prv   provider.Provider
+	rep   *reporting.Reporter
+	ps    pluginStores
+	mig   *migrations.Runner
+	prx   atomic.Pointer[proxy.Proxy]
+	Info  *PodInfo
+
+	// fwdVersion is the forwarding secret Gate was started with, fwdWindow
+	// how long the previous secret stays accepted after a rotation
+	fwdVersion int
+	fwdWindow  time.Duration
+
+	// traceDuration is how long players are traced if not given
+	traceDuration time.Duration
+
+	// stickyTTL is how long a sticky key stays pinned after its last use
+	stickyTTL time.Duration
+
+	// The watchdog disconnects players that sent nothing for sessionTimeout,
+	// forgets connections logging in for longer than loginTimeout and
+	// removes proxies that didn't heartbeat for proxyTimeout. 0
+	// disables the first two.
+	sessionTimeout time.Duration
+	loginTimeout   time.Duration
+	proxyTimeout   time.Duration
+
+	// A rolling restart gives each proxy drainTimeout for its players to
+	// leave and restartTimeout to be replaced by a ready one
+	drainTimeout   time.Duration
+	restartTimeout time.Duration
+	// draining is set while the proxy drains for a restart
+	draining atomic.Bool
 }
 
 func Init() (*Hosting, error) {
@@ -24,22 +131,439 @@ func Init() (*Hosting, error) {
 		return nil, err
 	}
 
-	kvC, err := initKV(storageC)
+	flt, err := initFaults()
+	if err != nil {
+		return nil, err
+	}
+
+	kvL, err := initKV(storageC, flt["kv"])
+	if err != nil {
+		return nil, err
+	}
+	kvC := kvL.client
+
+	objC, err := initObjectStore(flt["object"])
+	if err != nil {
+		return nil, err
+	}
+
+	msgC, err := initMessaging(flt["messaging"])
+	if err != nil {
+		return nil, err
+	}
+
+	apiS, err := initAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	info := ParsePodInfo()
+
+	prv, err := initProvider(info.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	geo, err := initGeoIP()
+	if err != nil {
+		return nil, err
+	}
+
+	rep, err := initReporter(info.PodName)
+	if err != nil {
+		return nil, err
+	}
+
+	auditKV, err := kvC.Bucket(context.Background(), info.KVAuditKey())
+	if err != nil {
+		return nil, err
+	}
+
+	gdprKV, err := kvC.Bucket(context.Background(), info.KVGDPRKey())
+	if err != nil {
+		return nil, err
+	}
+
+	moderationKV, err := kvC.Bucket(context.Background(), info.KVModerationKey())
+	if err != nil {
+		return nil, err
+	}
+
+	routingKV, err := kvC.Bucket(context.Background(), info.KVRoutingKey())
+	if err != nil {
+		return nil, err
+	}
+
+	experimentsKV, err := kvC.Bucket(context.Background(), info.KVExperimentsKey())
+	if err != nil {
+		return nil, err
+	}
+
+	exposuresKV, err := kvC.Bucket(context.Background(), info.KVExposuresKey())
+	if err != nil {
+		return nil, err
+	}
+
+	profilesKV, err := kvC.Bucket(context.Background(), info.KVProfilesKey())
+	if err != nil {
+		return nil, err
+	}
+
+	regionsKV, err := kvC.Bucket(context.Background(), info.KVRegionsKey())
+	if err != nil {
+		return nil, err
+	}
+
+	// A proxy missing three announcements no longer counts as live
+	regionInterval := util.EnvDurationWithDefault("REGION_ANNOUNCE_INTERVAL", 15*time.Second)
+
+	clusterKV, err := kvC.Bucket(context.Background(), info.KVClusterKey())
 	if err != nil {
 		return nil, err
 	}
 
-	msgC, err := initMessaging()
+	heartbeatInterval := util.EnvDurationWithDefault("HEARTBEAT_INTERVAL", 15*time.Second)
+
+	migrationsKV, err := kvC.Bucket(context.Background(), info.KVMigrationsKey())
 	if err != nil {
 		return nil, err
 	}
 
-	return &Hosting{
+	themesKV, err := kvC.Bucket(context.Background(), info.KVThemesKey())
+	if err != nil {
+		return nil, err
+	}
+
+	thm, err := themes.New(context.Background(), themesKV)
+	if err != nil {
+		return nil, err
+	}
+
+	faviconsKV, err := kvC.Bucket(context.Background(), info.KVFaviconsKey())
+	if err != nil {
+		return nil, err
+	}
+
+	fav, err := favicons.New(context.Background(), faviconsKV, objC, util.EnvDurationWithDefault("FAVICON_CACHE_TTL", 10*time.Minute))
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := experiments.New(context.Background(), experimentsKV, exposuresKV)
+	if err != nil {
+		return nil, err
+	}
+
+	flagsKV, err := kvC.Bucket(context.Background(), info.KVFlagsKey())
+	if err != nil {
+		return nil, err
+	}
+
+	flg, err := flags.New(context.Background(), flagsKV)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooksKV, err := kvC.Bucket(context.Background(), info.KVWebhooksKey())
+	if err != nil {
+		return nil, err
+	}
+
+	whk, err := webhooks.New(context.Background(), webhooksKV, webhooks.Options{
+		Attempts:   util.EnvIntWithDefault("WEBHOOK_ATTEMPTS", 8),
+		Backoff:    util.EnvDurationWithDefault("WEBHOOK_BACKOFF", 5*time.Second),
+		MaxBackoff: util.EnvDurationWithDefault("WEBHOOK_MAX_BACKOFF", 10*time.Minute),
+		Timeout:    util.EnvDurationWithDefault("WEBHOOK_TIMEOUT", 10*time.Second),
+		Workers:    util.EnvIntWithDefault("WEBHOOK_WORKERS", 4),
+		Queue:      util.EnvIntWithDefault("WEBHOOK_QUEUE", 1000),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filtersKV, err := kvC.Bucket(context.Background(), info.KVFiltersKey())
+	if err != nil {
+		return nil, err
+	}
+
+	pf, err := filters.New(context.Background(), filtersKV)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hosting{
 		strg: storageC,
 		kv:   kvC,
+		obj:  objC,
 		msg:  msgC,
-		Info: ParsePodInfo(),
-	}, nil
+		api:  apiS,
+		adt:  audit.New(auditKV),
+		lc:   newLifecycle(),
+		rt:   routingKV,
+		exp:  exp,
+		flg:  flg,
+		whk:  whk,
+		gdp:  gdpr.NewRegistry(),
+		gdk:  secrets.New(gdprKV, "keyring"),
+		gql: graphql.NewSchema(graphql.Options{
+			MaxDepth:      util.EnvIntWithDefault("GRAPHQL_MAX_DEPTH", 6),
+			MaxComplexity: util.EnvIntWithDefault("GRAPHQL_MAX_COMPLEXITY", 5000),
+			ListFactor:    10,
+		}),
+		pf: pf,
+		qlt: quality.New(
+			util.EnvIntWithDefault("PING_WINDOW", 60),
+			util.EnvDurationWithDefault("PING_KEEPALIVE_INTERVAL", 15*time.Second),
+		),
+		prf: profiles.New(profilesKV, profiles.Options{
+			TTL:         util.EnvDurationWithDefault("PROFILE_TTL", 24*time.Hour),
+			NotFoundTTL: util.EnvDurationWithDefault("PROFILE_NOT_FOUND_TTL", 10*time.Minute),
+			Requests:    util.EnvIntWithDefault("MOJANG_REQUESTS", 500),
+			Window:      util.EnvDurationWithDefault("MOJANG_WINDOW", 10*time.Minute),
+		}),
+		thm: thm,
+		fav: fav,
+		bw:  bandwidth.New(),
+		reg: regions.New(regionsKV, 3*regionInterval),
+		geo: geo,
+		cls: cluster.New(clusterKV, 3*heartbeatInterval),
+		pkt: packets.New(
+			util.EnvIntWithDefault("PACKET_CAPTURE_SIZE", 1000),
+			util.EnvIntWithDefault("PACKET_CAPTURE_DATA", 256),
+		),
+		nb: netbuf.New(netbuf.Options{
+			BufferSize: util.EnvIntWithDefault("NET_BUFFER_SIZE", 16<<10),
+			PoolSize:   util.EnvIntWithDefault("NET_BUFFER_POOL", 4096),
+			Batch:      util.EnvIntWithDefault("NET_WRITE_BATCH", 64<<10),
+			Limit:      util.EnvIntWithDefault("WRITE_QUEUE_LIMIT", 16<<20),
+			Wait:       util.EnvDurationWithDefault("WRITE_QUEUE_WAIT", 30*time.Second),
+		}),
+		flt: flt,
+		enc: kvL.enc,
+		mux: kvL.mux,
+		snp: kvL.snp,
+		prv: prv,
+		rep: rep,
+		ps: pluginStores{
+			quota: kv.Quota{
+				MaxKeys:  util.EnvIntWithDefault("PLUGIN_STORE_MAX_KEYS", 10000),
+				MaxBytes: int64(util.EnvIntWithDefault("PLUGIN_STORE_MAX_BYTES", 16<<20)),
+			},
+			stores: make(map[string]*kv.QuotaBucket),
+		},
+		mig:  migrations.New(migrationsKV, info.PodName, util.EnvDurationWithDefault("MIGRATION_LOCK_TTL", time.Minute)),
+		Info: info,
+
+		traceDuration: util.EnvDurationWithDefault("TRACE_DURATION", 15*time.Minute),
+		stickyTTL:     util.EnvDurationWithDefault("STICKY_TTL", 30*time.Minute),
+
+		sessionTimeout: util.EnvDurationWithDefault("WATCHDOG_SESSION_TIMEOUT", 10*time.Minute),
+		loginTimeout:   util.EnvDurationWithDefault("WATCHDOG_LOGIN_TIMEOUT", connectionGrace),
+		proxyTimeout:   util.EnvDurationWithDefault("WATCHDOG_PROXY_TIMEOUT", 10*heartbeatInterval),
+
+		drainTimeout:   util.EnvDurationWithDefault("RESTART_DRAIN_TIMEOUT", time.Minute),
+		restartTimeout: util.EnvDurationWithDefault("RESTART_TIMEOUT", 10*time.Minute),
+	}
+	h.mon = newMonitor(h.Context(), moderationKV)
+	h.inc = newIncident(h.Context(), moderationKV)
+	h.initGraphQL()
+
+	if raw := util.EnvWithDefault("PACKET_PASSTHROUGH", ""); raw != "" {
+		passthrough := make([]packets.Filter, 0)
+		if err := json.Unmarshal([]byte(raw), &passthrough); err != nil {
+			return nil, fmt.Errorf("invalid PACKET_PASSTHROUGH: %w", err)
+		}
+
+		h.pkt.SetPassthrough(passthrough)
+	}
+
+	if err := h.initNetworks(util.EnvWithDefault("NETWORKS", "")); err != nil {
+		return nil, err
+	}
+
+	if util.EnvBoolWithDefault("FORWARDING_KEYRING", false) {
+		forwardingKV, err := kvC.Bucket(context.Background(), info.KVForwardingKey())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := h.initForwarding(context.Background(), forwardingKV); err != nil {
+			return nil, err
+		}
+
+		if interval := util.EnvDurationWithDefault("FORWARDING_ROTATE_INTERVAL", 0); interval > 0 {
+			go h.rotateForwarding(h.Context(), interval)
+		}
+
+		apiS.HandleFunc("GET /forwarding", h.handleGetForwarding)
+		apiS.HandleFunc("POST /forwarding/rotate", h.handleRotateForwarding)
+	}
+
+	if util.EnvBoolWithDefault("SESSION_TOKENS", false) {
+		sessionsKV, err := kvC.Bucket(context.Background(), info.KVSessionsKey())
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := h.initSessions(context.Background(), sessionsKV)
+		if err != nil {
+			return nil, err
+		}
+
+		go h.rotateSessions(h.Context(), keys, util.EnvDurationWithDefault("SESSION_KEY_ROTATE_INTERVAL", 7*24*time.Hour))
+	}
+
+	if info.Region != "" {
+		go h.announceRegion(h.Context(), regionInterval)
+	}
+
+	// Dead proxies didn't withdraw from their region
+	h.OnInstanceDead("Regions", h.reg.Withdraw)
+
+	go h.heartbeat(h.Context(), heartbeatInterval)
+
+	if err := h.msg.Subscribe(info.ClusterSubject(info.PodName), h.onClusterMessage); err != nil {
+		return nil, err
+	}
+
+	go exp.Watch(h.Context())
+	go exp.Record(h.Context())
+	go flg.Watch(h.Context())
+	go whk.Watch(h.Context())
+	go whk.Run(h.Context())
+	h.adt.OnRecord(h.deliverAudit)
+	h.RetainLog("audit", auditKV, RetentionPolicy("AUDIT"))
+	go h.pruneLogs(h.Context(), util.EnvDurationWithDefault("RETENTION_INTERVAL", time.Hour))
+	go pf.Watch(h.Context())
+	go fav.Watch(h.Context())
+	go thm.Watch(h.Context())
+	go h.scheduleThemes(h.Context(), util.EnvDurationWithDefault("THEME_SCHEDULE_INTERVAL", time.Minute))
+	go h.pruneSticky(h.Context(), time.Minute)
+	if h.snp != nil {
+		go h.snp.Run(h.Context(), util.EnvDurationWithDefault("KV_SNAPSHOT_INTERVAL", time.Minute))
+	}
+	go h.sampleRuntime(h.Context(), 15*time.Second)
+	go h.sampleBandwidth(h.Context(),
+		util.EnvDurationWithDefault("BANDWIDTH_SAMPLE_INTERVAL", 10*time.Second),
+		int64(util.EnvIntWithDefault("BANDWIDTH_SOFT_CAP", 0)),
+	)
+	go h.sampleQuality(h.Context(), util.EnvDurationWithDefault("PING_SAMPLE_INTERVAL", 5*time.Second))
+	go h.watchdog(h.Context(), util.EnvDurationWithDefault("WATCHDOG_INTERVAL", time.Minute))
+	go h.probeBackends(h.Context(),
+		util.EnvDurationWithDefault("BACKEND_PROBE_INTERVAL", 5*time.Second),
+		util.EnvDurationWithDefault("BACKEND_PROBE_TIMEOUT", 2*time.Second),
+	)
+
+	apiS.HandlePublicFunc("GET /healthz", h.handleHealth)
+	apiS.HandlePublicFunc("GET /readyz", h.handleReady)
+	apiS.HandleFunc("GET /readyz/details", h.handleReadyDetails)
+	apiS.HandleFunc("POST /reload", h.handleReload)
+	apiS.HandleFunc("GET /warmup", h.handleGetWarmup)
+	apiS.HandleFunc("GET /networks", h.handleGetNetworks)
+	apiS.HandleFunc("GET /backends", h.handleGetBackends)
+	apiS.HandleFunc("GET /moderation/monitor", h.handleGetMonitor)
+	apiS.HandleFunc("PUT /moderation/monitor", h.handleSetMonitor)
+	apiS.HandleFunc("GET /moderation/incident", h.handleGetIncident)
+	apiS.HandleFunc("PUT /moderation/incident", h.handleSetIncident)
+	apiS.HandleFunc("PUT /moderation/incident/bundle", h.handleSetIncidentBundle)
+	apiS.HandleFunc("GET /routing/canary", h.handleGetCanaries)
+	apiS.HandleFunc("PUT /routing/canary/{gamemode}", h.handleSetCanary)
+	apiS.HandleFunc("GET /routing/capacity", h.handleGetCapacities)
+	apiS.HandleFunc("PUT /routing/capacity/{gamemode}", h.handleSetCapacity)
+	apiS.HandleFunc("GET /routing/timeouts", h.handleGetTimeouts)
+	apiS.HandleFunc("PUT /routing/timeouts/{gamemode}", h.handleSetTimeouts)
+	apiS.HandleFunc("GET /routing/modded", h.handleGetModded)
+	apiS.HandleFunc("PUT /routing/modded/{gamemode}", h.handleSetModded)
+	apiS.HandleFunc("DELETE /routing/modded/{gamemode}", h.handleDeleteModded)
+	apiS.HandleFunc("GET /routing/accountage", h.handleGetAccountAges)
+	apiS.HandleFunc("PUT /routing/accountage/{gamemode}", h.handleSetAccountAge)
+	apiS.HandleFunc("DELETE /routing/accountage/{gamemode}", h.handleDeleteAccountAge)
+	apiS.HandleFunc("GET /routing/lockdown", h.handleGetLockdowns)
+	apiS.HandleFunc("PUT /routing/lockdown/{gamemode}", h.handleSetLockdown)
+	apiS.HandleFunc("DELETE /routing/lockdown/{gamemode}", h.handleDeleteLockdown)
+	apiS.HandleFunc("GET /routing/sticky", h.handleListSticky)
+	apiS.HandleFunc("PUT /routing/sticky/{gamemode}/{key}", h.handleColocate)
+	apiS.HandleFunc("DELETE /routing/sticky/{gamemode}/{key}", h.handleDeleteSticky)
+	apiS.HandleFunc("GET /experiments", h.handleListExperiments)
+	apiS.HandleFunc("PUT /experiments/{name}", h.handleSetExperiment)
+	apiS.HandleFunc("DELETE /experiments/{name}", h.handleDeleteExperiment)
+	apiS.HandleFunc("GET /experiments/{name}/exposures", h.handleExposures)
+	apiS.HandleFunc("GET /flags", h.handleListFlags)
+	apiS.HandleFunc("PUT /flags/{name}", h.handleSetFlag)
+	apiS.HandleFunc("DELETE /flags/{name}", h.handleDeleteFlag)
+	apiS.HandleFunc("GET /gdpr/{player}", h.handlePlayerData(gdpr.KindExport))
+	apiS.HandleFunc("DELETE /gdpr/{player}", h.handlePlayerData(gdpr.KindErase))
+	apiS.HandleFunc("POST /gdpr/verify", h.handleVerifyPlayerData)
+	apiS.HandleFunc("GET /graphql", h.handleGraphQL)
+	apiS.HandleFunc("POST /graphql", h.handleGraphQL)
+	apiS.HandleFunc("GET /graphql/schema", h.handleGraphQLSchema)
+	apiS.HandleFunc("GET /retention", h.handleGetRetention)
+	apiS.HandleFunc("POST /retention/prune", h.handlePruneLogs)
+	apiS.HandleFunc("GET /webhooks", h.handleListWebhooks)
+	apiS.HandleFunc("PUT /webhooks/{id}", h.handleSetWebhook)
+	apiS.HandleFunc("DELETE /webhooks/{id}", h.handleDeleteWebhook)
+	apiS.HandleFunc("POST /webhooks/{id}/ping", h.handlePingWebhook)
+	apiS.HandleFunc("GET /favicons", h.handleListFavicons)
+	apiS.HandleFunc("PUT /favicons/{name}", h.handleSetFavicons)
+	apiS.HandleFunc("DELETE /favicons/{name}", h.handleDeleteFavicons)
+	apiS.HandleFunc("POST /favicons/{name}/next", h.handleAdvanceFavicons)
+	apiS.HandleFunc("GET /filters", h.handleListFilters)
+	apiS.HandleFunc("PUT /filters/{name}", h.handleSetFilter)
+	apiS.HandleFunc("DELETE /filters/{name}", h.handleDeleteFilter)
+	apiS.HandleFunc("GET /themes", h.handleListThemes)
+	apiS.HandleFunc("PUT /themes/{name}", h.handleSetTheme)
+	apiS.HandleFunc("DELETE /themes/{name}", h.handleDeleteTheme)
+	apiS.HandleFunc("GET /theme", h.handleGetActiveTheme)
+	apiS.HandleFunc("PUT /theme", h.handleActivateTheme)
+	apiS.HandleFunc("GET /themes/schedules", h.handleListThemeSchedules)
+	apiS.HandleFunc("PUT /themes/schedules/{id}", h.handleSetThemeSchedule)
+	apiS.HandleFunc("DELETE /themes/schedules/{id}", h.handleDeleteThemeSchedule)
+	apiS.HandleFunc("GET /bandwidth", h.handleGetBandwidth)
+	apiS.HandleFunc("GET /cluster", h.handleCluster)
+	apiS.HandleFunc("GET /cluster/skew", h.handleSkews)
+	apiS.HandleFunc("GET /cluster/restart", h.handleGetRollout)
+	apiS.HandleFunc("POST /cluster/restart", h.handleRestartCluster)
+	apiS.HandleFunc("GET /regions", h.handleListRegions)
+	apiS.HandleFunc("PUT /regions/{name}", h.handleSetRegion)
+	apiS.HandleFunc("DELETE /regions/{name}", h.handleDeleteRegion)
+	apiS.HandleFunc("GET /debug/packets", h.handleGetPackets)
+	apiS.HandleFunc("PUT /debug/packets", h.handleCapturePackets)
+	apiS.HandleFunc("DELETE /debug/packets", h.handleStopPackets)
+	apiS.HandleFunc("POST /debug/packets/dump", h.handleDumpPackets)
+	apiS.HandleFunc("GET /debug/traces", h.handleListTraces)
+	apiS.HandleFunc("PUT /debug/traces/{player}", h.handleTracePlayer)
+	apiS.HandleFunc("DELETE /debug/traces/{player}", h.handleUntracePlayer)
+	apiS.HandleFunc("GET /debug/runtime", h.handleGetRuntime)
+	apiS.HandleFunc("POST /debug/profiles/dump", h.handleDumpProfiles)
+	registerPprof(apiS)
+	if flt != nil {
+		apiS.HandleFunc("GET /debug/faults", h.handleGetFaults)
+		apiS.HandleFunc("PUT /debug/faults/{target}", h.handleSetFaults)
+		apiS.HandleFunc("DELETE /debug/faults/{target}", h.handleDeleteFaults)
+	}
+
+	apiS.HandleFunc("GET /migrations/{scope}", h.handleGetMigrations)
+	apiS.HandleFunc("GET /kv/encodings", h.handleGetEncodings)
+	apiS.HandleFunc("GET /kv/watchers/shared", h.handleGetSharedWatchers)
+	apiS.HandleFunc("GET /kv/snapshots", h.handleGetSnapshots)
+	apiS.HandleFunc("POST /kv/encodings/{bucket}/reencode", h.handleReencode)
+	apiS.HandleFunc("GET /plugins/store", h.handleListPluginStores)
+	apiS.HandleFunc("DELETE /plugins/store/{plugin}", h.handleWipePluginStore)
+	apiS.HandleFunc("GET /backup", h.handleBackup)
+	apiS.HandleFunc("POST /restore", h.handleRestore)
+	apiS.HandleFunc("GET /backups", h.handleListBackups)
+	apiS.HandleFunc("POST /backups", h.handleStoreBackup)
+	if prv != nil {
+		apiS.HandleFunc("GET /provider/servers", h.handleListProviderServers)
+		apiS.HandleFunc("POST /provider/servers", h.handleCreateProviderServer)
+		apiS.HandleFunc("GET /provider/servers/{name}", h.handleGetProviderServer)
+		apiS.HandleFunc("DELETE /provider/servers/{name}", h.handleDeleteProviderServer)
+		apiS.HandleFunc("POST /provider/servers/{name}/start", h.handlePowerProviderServer(true))
+		apiS.HandleFunc("POST /provider/servers/{name}/stop", h.handlePowerProviderServer(false))
+		apiS.HandleFunc("POST /provider/servers/{name}/command", h.handleProviderServerCommand)
+	}
+
+	return h, nil
 }
 
 func (n *Hosting) Storage() storage.Storage {
@@ -50,36 +574,32 @@ func (n *Hosting) KV() kv.Client {
 	return n.kv
 }
 
+// ObjectStore holds blobs that are too large for KV values.
+func (n *Hosting) ObjectStore() object.Store {
+	return n.obj
+}
+
 func (n *Hosting) Messaging() messaging.Messager {
 	return n.msg
 }
 
-func getEnvWithDefault(key, def string) string {
-	v, exists := os.LookupEnv(key)
-	if !exists {
-		return def
-	}
-
-	return v
+func (n *Hosting) API() *api.Server {
+	return n.api
 }
 
-func getEnvBoolWithDefault(key string, def bool) bool {
-	raw, exists := os.LookupEnv(key)
-	if !exists {
-		return def
-	}
-
-	v, err := strconv.ParseBool(raw)
-	if err != nil {
-		log.Fatal(err)
-	}
+func (n *Hosting) Audit() *audit.Log {
+	return n.adt
+}
 
-	return v
+// Profiles resolves names, UUIDs and skins, shared by all proxies of the
+// network so the Mojang rate limit isn't hit once per proxy.
+func (n *Hosting) Profiles() *profiles.Cache {
+	return n.prf
 }
 
 func initStorage() (storage.Storage, error) {
-	logging := getEnvBoolWithDefault("STORAGE_LOGGING", false)
-	backend := getEnvWithDefault("STORAGE_BACKEND", "memory")
+	logging := util.EnvBoolWithDefault("STORAGE_LOGGING", false)
+	backend := util.EnvWithDefault("STORAGE_BACKEND", "memory")
 	backendOptions := os.Getenv("STORAGE_BACKEND_OPTIONS")
 
 	var storageC storage.Storage
@@ -110,11 +630,82 @@ func initStorage() (storage.Storage, error) {
 	return storageC, nil
 }
 
-func initKV(strg storage.Storage) (kv.Client, error) {
-	logging := getEnvBoolWithDefault("KV_LOGGING", false)
-	backend := getEnvWithDefault("KV_BACKEND", "json")
+// kvLayers is the KV client with the layers Hosting needs to reach.
+type kvLayers struct {
+	client kv.Client
+	// enc is always there, so values written by proxies with KV_ENCODINGS
+	// stay readable
+	enc *kv.Encoded
+	// mux is nil with KV_WATCH_MUX=false
+	mux *kv.Muxed
+	// snp is nil with an empty KV_SNAPSHOTS or SNAPSHOT_DIR
+	snp *kv.Snapshots
+}
+
+func initKV(strg storage.Storage, flt *faults.Injector) (kvLayers, error) {
+	logging := util.EnvBoolWithDefault("KV_LOGGING", false)
+	caching := util.EnvBoolWithDefault("KV_CACHE", false)
+	muxing := util.EnvBoolWithDefault("KV_WATCH_MUX", true)
+	snapshots := util.EnvWithDefault("KV_SNAPSHOTS", "whitelist,shield,permissions,commands")
+	snapshotDir := util.EnvWithDefault("SNAPSHOT_DIR", "")
+	backend := util.EnvWithDefault("KV_BACKEND", "json")
 	backendOptions := os.Getenv("KV_BACKEND_OPTIONS")
 
+	l := kvLayers{}
+
+	kvC, err := NewKVClient(backend, backendOptions, strg)
+	if err != nil {
+		return l, err
+	}
+
+	byBucket, err := kvEncodings(util.EnvWithDefault("KV_ENCODINGS", "{}"))
+	if err != nil {
+		return l, err
+	}
+
+	l.enc = kv.WithEncodings(kvC, byBucket)
+	kvC = l.enc
+
+	if flt != nil {
+		kvC = kv.WithFaults(kvC, flt)
+	}
+
+	if snapshots != "" && snapshotDir != "" {
+		dir := filepath.Join(snapshotDir, "kv")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return l, err
+		}
+
+		l.snp = kv.WithSnapshots(kvC, storage.NewFS(storage.FSOptions{Folder: dir}), strings.Split(snapshots, ","))
+		kvC = l.snp
+	}
+
+	if logging {
+		log.Println("Enabling logging for KV")
+
+		kvC = kv.WithLogger(kvC)
+	}
+
+	// Inside the cache, so its watchers are shared too
+	if muxing {
+		l.mux = kv.WithMux(kvC)
+		kvC = l.mux
+	}
+
+	if caching {
+		log.Println("Enabling read-through cache for KV")
+
+		kvC = kv.WithCache(kvC)
+	}
+
+	l.client = kvC
+
+	return l, nil
+}
+
+// NewKVClient creates a KV client for the given backend. The JSON backend
+// stores its data in strg.
+func NewKVClient(backend string, backendOptions string, strg storage.Storage) (kv.Client, error) {
 	var kvC kv.Client
 	var err error
 
@@ -127,7 +718,12 @@ func initKV(strg storage.Storage) (kv.Client, error) {
 			return nil, err
 		}
 
-		js, err := connectToJetStream(opts.URL)
+		var natsOpts []nats.Option
+		if opts.RetryOnFailedConnect {
+			natsOpts = append(natsOpts, nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+		}
+
+		js, err := connectToJetStream(opts.URL, natsOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -138,30 +734,103 @@ func initKV(strg storage.Storage) (kv.Client, error) {
 		log.Println("Using JSON as KV backend")
 
 		kvC, err = kv.NewJSONClient(strg, "")
+
+	case "sql":
+		log.Println("Using SQL as KV backend")
+
+		opts := kv.SQLOptions{}
+		if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+			return nil, err
+		}
+
+		kvC, err = kv.NewSQLClient(context.Background(), opts)
+
+	default:
+		return nil, fmt.Errorf("unknown KV backend: %s", backend)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	if logging {
-		log.Println("Enabling logging for KV")
+	return kvC, nil
+}
 
-		kvC = kv.WithLogger(kvC)
+func initObjectStore(flt *faults.Injector) (object.Store, error) {
+	logging := util.EnvBoolWithDefault("OBJECT_STORE_LOGGING", false)
+	backend := util.EnvWithDefault("OBJECT_STORE_BACKEND", "memory")
+	backendOptions := os.Getenv("OBJECT_STORE_BACKEND_OPTIONS")
+
+	var objC object.Store
+	var err error
+
+	switch backend {
+	case "memory":
+		log.Println("Using memory as object store backend")
+
+		objC = object.NewMemory()
+
+	case "nats":
+		log.Println("Using NATS as object store backend")
+
+		opts := object.NATSOptions{}
+		if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+			return nil, err
+		}
+
+		js, err := connectToJetStream(opts.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		objC, err = object.NewNATS(context.Background(), js, opts.Bucket)
+		if err != nil {
+			return nil, err
+		}
+
+	case "s3":
+		log.Println("Using S3 as object store backend")
+
+		opts := object.S3Options{}
+		if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+			return nil, err
+		}
+
+		objC, err = object.NewS3(opts)
+
+	default:
+		return nil, fmt.Errorf("unknown object store backend: %s", backend)
 	}
 
-	return kvC, nil
+	if err != nil {
+		return nil, err
+	}
+
+	if flt != nil {
+		objC = object.WithFaults(objC, flt)
+	}
+
+	if logging {
+		objC = object.WithLogger(objC)
+	}
+
+	return objC, nil
 }
 
-func initMessaging() (messaging.Messager, error) {
-	logging := getEnvBoolWithDefault("MESSAGING_LOGGING", false)
-	backend := getEnvWithDefault("MESSAGING_BACKEND", "nats")
-	backendOptions := getEnvWithDefault("MESSAGING_BACKEND_OPTIONS", "{\"url\":\"nats://127.0.0.1:4222\"}")
+func initMessaging(flt *faults.Injector) (messaging.Messager, error) {
+	logging := util.EnvBoolWithDefault("MESSAGING_LOGGING", false)
+	backend := util.EnvWithDefault("MESSAGING_BACKEND", "nats")
+	backendOptions := util.EnvWithDefault("MESSAGING_BACKEND_OPTIONS", "{\"url\":\"nats://127.0.0.1:4222\"}")
 
 	var msgC messaging.Messager
 	var err error
 
 	switch backend {
+	case "memory":
+		log.Println("Using memory as messaging backend")
+
+		msgC = messaging.NewMemory()
+
 	case "nats":
 		log.Println("Using NATS as messaging backend")
 
@@ -185,9 +854,38 @@ func initMessaging() (messaging.Messager, error) {
 		return nil, err
 	}
 
+	if flt != nil {
+		msgC = messaging.WithFaults(msgC, flt)
+	}
+
 	if logging {
 		msgC = messaging.WithLogger(msgC)
 	}
 
 	return msgC, nil
 }
+
+func initAPI() (*api.Server, error) {
+	opts := api.Options{
+		Addr:          os.Getenv("API_ADDR"),
+		Token:         os.Getenv("API_TOKEN"),
+		TLSCert:       os.Getenv("API_TLS_CERT"),
+		TLSKey:        os.Getenv("API_TLS_KEY"),
+		TLSClientCA:   os.Getenv("API_TLS_CLIENT_CA"),
+		TLSMinVersion: os.Getenv("API_TLS_MIN_VERSION"),
+		TLSCiphers:    os.Getenv("API_TLS_CIPHERS"),
+	}
+
+	if opts.Addr != "" && opts.Token == "" {
+		return nil, errors.New("API_TOKEN must be set when API_ADDR is set")
+	}
+
+	s := api.New(opts)
+
+	s.HandleFunc("GET /metrics", metrics.Handler)
+	s.HandleFunc("GET /kv/watchers", func(w http.ResponseWriter, r *http.Request) {
+		api.WriteJSON(w, http.StatusOK, kv.WatchStates())
+	})
+
+	return s, nil
+}
@@ -0,0 +1,237 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+const (
+	incidentKey       = "incident"
+	incidentBundleKey = "incident.bundle"
+)
+
+// IncidentState is whether incident mode is on, switched by staff while the
+// network is under attack or being raided.
+type IncidentState struct {
+	Active bool      `json:"active"`
+	Reason string    `json:"reason,omitempty"`
+	Actor  string    `json:"actor,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// IncidentBundle is what incident mode changes while it is on. Plugins read
+// it when they act, so turning incident mode off reverts all of it at once.
+type IncidentBundle struct {
+	// RateLimitPercent scales the Shield rate limits, 50 halves them
+	RateLimitPercent int `json:"rateLimitPercent"`
+	// SlowModeSeconds is how long players wait between chat messages, 0
+	// leaves chat alone
+	SlowModeSeconds int `json:"slowModeSeconds"`
+	// NewAccountMinutes denies the logins of players that first joined less
+	// than this ago, 0 lets everyone join
+	NewAccountMinutes int `json:"newAccountMinutes"`
+	// Message is the disconnect reason of denied new accounts
+	Message string `json:"message,omitempty"`
+	// Notify tells the staff online when incident mode is switched
+	Notify bool `json:"notify"`
+}
+
+func (b IncidentBundle) Validate() error {
+	if b.RateLimitPercent < 1 || b.RateLimitPercent > 100 {
+		return errors.New("rateLimitPercent must be between 1 and 100")
+	}
+
+	if b.SlowModeSeconds < 0 || b.NewAccountMinutes < 0 {
+		return errors.New("slowModeSeconds and newAccountMinutes must not be negative")
+	}
+
+	return nil
+}
+
+var defaultIncidentBundle = IncidentBundle{
+	RateLimitPercent:  50,
+	SlowModeSeconds:   5,
+	NewAccountMinutes: 24 * 60,
+	Message:           "The network is only open to known players right now, try again later.",
+	Notify:            true,
+}
+
+type incident struct {
+	state     IncidentState
+	bundle    IncidentBundle
+	stateKey  *kv.TypedKey[IncidentState]
+	bundleKey *kv.TypedKey[IncidentBundle]
+	// listeners are told about every switch, on every proxy
+	listeners []func(IncidentState)
+	m         sync.RWMutex
+}
+
+func newIncident(ctx context.Context, bucket kv.Bucket) *incident {
+	i := &incident{
+		bundle:    defaultIncidentBundle,
+		stateKey:  kv.Typed[IncidentState](bucket, incidentKey),
+		bundleKey: kv.Typed[IncidentBundle](bucket, incidentBundleKey).Default(func() IncidentBundle { return defaultIncidentBundle }).Validate(IncidentBundle.Validate),
+	}
+
+	if state, err := i.stateKey.Get(ctx); err != nil {
+		log.Printf("Failed to load incident mode: %v", err)
+	} else {
+		i.state = state
+	}
+
+	go i.stateKey.Watch(ctx, i.switched)
+	go i.bundleKey.Watch(ctx, func(b IncidentBundle) {
+		i.m.Lock()
+		i.bundle = b
+		i.m.Unlock()
+	})
+
+	return i
+}
+
+// switched stores the state and tells the listeners if incident mode was
+// turned on or off.
+func (i *incident) switched(state IncidentState) {
+	i.m.Lock()
+	changed := i.state.Active != state.Active
+	i.state = state
+	listeners := i.listeners
+	i.m.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.Printf("Incident mode is %s", onOff(state.Active))
+
+	for _, fn := range listeners {
+		fn(state)
+	}
+}
+
+func onOff(active bool) string {
+	if active {
+		return "on"
+	}
+
+	return "off"
+}
+
+// Incident returns whether incident mode is on and what it changes.
+func (n *Hosting) Incident() (IncidentState, IncidentBundle) {
+	n.inc.m.RLock()
+	defer n.inc.m.RUnlock()
+
+	return n.inc.state, n.inc.bundle
+}
+
+// OnIncident registers fn to be called whenever incident mode is turned on
+// or off, on this or another proxy.
+func (n *Hosting) OnIncident(fn func(IncidentState)) {
+	n.inc.m.Lock()
+	defer n.inc.m.Unlock()
+
+	n.inc.listeners = append(n.inc.listeners, fn)
+}
+
+// SetIncident turns incident mode on or off on every proxy.
+func (n *Hosting) SetIncident(ctx context.Context, actor string, active bool, reason string) (IncidentState, error) {
+	state := IncidentState{Active: active, Reason: reason, Actor: actor, Since: time.Now()}
+	if err := n.inc.stateKey.Set(ctx, state); err != nil {
+		return IncidentState{}, err
+	}
+
+	n.inc.switched(state)
+
+	return state, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "moderation.incident." + onOff(active),
+		Details: map[string]string{"reason": reason},
+	})
+}
+
+func (n *Hosting) SetIncidentBundle(ctx context.Context, actor string, b IncidentBundle) error {
+	if err := n.inc.bundleKey.Set(ctx, b); err != nil {
+		return err
+	}
+
+	n.inc.m.Lock()
+	n.inc.bundle = b
+	n.inc.m.Unlock()
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "moderation.incident.bundle",
+		Details: map[string]string{
+			"rateLimitPercent":  strconv.Itoa(b.RateLimitPercent),
+			"slowModeSeconds":   strconv.Itoa(b.SlowModeSeconds),
+			"newAccountMinutes": strconv.Itoa(b.NewAccountMinutes),
+			"notify":            strconv.FormatBool(b.Notify),
+		},
+	})
+}
+
+type incidentResponse struct {
+	IncidentState
+	Bundle IncidentBundle `json:"bundle"`
+}
+
+type incidentRequest struct {
+	Active bool   `json:"active"`
+	Reason string `json:"reason"`
+	// Actor is the staff member switching, "api" by default
+	Actor string `json:"actor"`
+}
+
+func (n *Hosting) handleGetIncident(w http.ResponseWriter, r *http.Request) {
+	state, b := n.Incident()
+	api.WriteJSON(w, http.StatusOK, incidentResponse{IncidentState: state, Bundle: b})
+}
+
+func (n *Hosting) handleSetIncident(w http.ResponseWriter, r *http.Request) {
+	req := incidentRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Actor == "" {
+		req.Actor = "api"
+	}
+
+	if _, err := n.SetIncident(r.Context(), req.Actor, req.Active, req.Reason); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	n.handleGetIncident(w, r)
+}
+
+func (n *Hosting) handleSetIncidentBundle(w http.ResponseWriter, r *http.Request) {
+	b := IncidentBundle{}
+	if err := api.ReadJSON(r, &b); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := b.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetIncidentBundle(r.Context(), "api", b); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, b)
+}
@@ -8,9 +8,14 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/sessions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/themes"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 )
 
@@ -19,32 +24,118 @@ var (
 )
 
 type InstanceManager struct {
-	prx         *proxy.Proxy
+	prx *proxy.Proxy
+	// network owns the servers named with its ServerPrefix, the primary
+	// network those without one
+	network     *Network
 	instancesKV kv.Bucket
-	rnd         *rand.Rand
+	routingKV   kv.Bucket
+	stickyTTL   time.Duration
+	// routing narrows down the instances ChooseServer picks from, e.g.
+	// region=eu for the proxies of one region.
+	routing registry.Selector
+	// region is the region of the proxy, ChooseServer prefers instances
+	// tagged with it.
+	region string
+	// maxPlayers is the default capacity of instances, 0 is unlimited.
+	maxPlayers int
+	// connectTimeout applies to gamemodes without TimeoutConfig.
+	connectTimeout time.Duration
+	// themes weights the random pick of ChooseServer.
+	themes *themes.Themes
+	// sessions signs the session cookie of transfers, nil without
+	// SESSION_TOKENS.
+	sessions *sessions.Signer
+	rnd      *rand.Rand
 }
 
+// InstanceManager manages the servers of the primary network.
 func (h *Hosting) InstanceManager(ctx context.Context, prx *proxy.Proxy) (*InstanceManager, error) {
+	return h.NetworkInstanceManager(ctx, prx, h.PrimaryNetwork())
+}
+
+// NetworkInstanceManager manages the servers of the network, it doesn't see
+// those of the others.
+func (h *Hosting) NetworkInstanceManager(ctx context.Context, prx *proxy.Proxy, nw *Network) (*InstanceManager, error) {
 	rnd := rand.New(rand.NewSource(time.Now().Unix()))
 
-	instancesKV, err := h.KV().Bucket(ctx, h.Info.KVInstancesKey())
+	instancesKV, err := nw.KV().Bucket(ctx, nw.Info.KVInstancesKey())
+	if err != nil {
+		return nil, err
+	}
+
+	routingKV := h.rt
+	if !nw.Primary() {
+		routingKV, err = nw.KV().Bucket(ctx, nw.Info.KVRoutingKey())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	routing, err := registry.Parse(util.EnvWithDefault("ROUTING_SELECTOR", ""))
 	if err != nil {
 		return nil, err
 	}
 
 	return &InstanceManager{
 		prx:         prx,
+		network:     nw,
 		instancesKV: instancesKV,
+		routingKV:   routingKV,
+		stickyTTL:   h.stickyTTL,
+		routing:     routing,
+		region:      h.Info.Region,
+		maxPlayers:  util.EnvIntWithDefault("SERVER_MAX_PLAYERS", 0),
 		rnd:         rnd,
+
+		connectTimeout: util.EnvDurationWithDefault("CONNECT_TIMEOUT", 10*time.Second),
+		themes:         h.thm,
+		sessions:       h.ses,
 	}, nil
 }
 
+func (m *InstanceManager) Network() *Network {
+	return m.network
+}
+
+// owns reports whether the registered server belongs to the network.
+func (m *InstanceManager) owns(name string) bool {
+	if prefix := m.network.ServerPrefix(); prefix != "" {
+		return strings.HasPrefix(name, prefix)
+	}
+
+	return !strings.Contains(name, "/")
+}
+
+// server returns the registered server of the network by name, with or
+// without the network's prefix.
+func (m *InstanceManager) server(name string) proxy.RegisteredServer {
+	if !m.owns(name) {
+		name = m.network.ServerPrefix() + name
+	}
+
+	if !m.owns(name) {
+		return nil
+	}
+
+	return m.prx.Server(name)
+}
+
+// instanceKey is the key of the registered server in the instances bucket.
+func (m *InstanceManager) instanceKey(name string) string {
+	return strings.TrimPrefix(name, m.network.ServerPrefix())
+}
+
+// Register registers the instance with Gate, named with the network's
+// prefix.
 func (m *InstanceManager) Register(ctx context.Context, name string, info InstanceInfo) error {
 	ip, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf("%s:%d", info.Address, info.Port))
 	if err != nil {
 		return err
 	}
 
+	name = m.network.ServerPrefix() + name
+
 	if s := m.prx.Server(name); s != nil {
 		if m.prx.Unregister(s.ServerInfo()) {
 			log.Printf("Unregistered server %s", name)
@@ -57,7 +148,7 @@ func (m *InstanceManager) Register(ctx context.Context, name string, info Instan
 }
 
 func (m *InstanceManager) Unregister(ctx context.Context, name string) error {
-	s := m.prx.Server(name)
+	s := m.prx.Server(m.network.ServerPrefix() + name)
 	if s == nil {
 		return nil
 	}
@@ -69,16 +160,123 @@ func (m *InstanceManager) Unregister(ctx context.Context, name string) error {
 	return nil
 }
 
+type instance struct {
+	server proxy.RegisteredServer
+	info   InstanceInfo
+}
+
 func (m *InstanceManager) GetServersOfGamemode(ctx context.Context, gamemode string) ([]proxy.RegisteredServer, error) {
+	instances, err := m.instancesOfGamemode(ctx, gamemode)
+	if err != nil {
+		return nil, err
+	}
+
+	return servers(instances), nil
+}
+
+// Select returns every registered server whose labels match sel. Servers
+// that are not in the instances bucket, e.g. from the Gate config, only have
+// the name label.
+func (m *InstanceManager) Select(ctx context.Context, sel registry.Selector) ([]proxy.RegisteredServer, error) {
+	instances, err := m.selectInstances(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	return servers(instances), nil
+}
+
+// FindServer resolves a destination given by a backend or a command: the
+// name of a server, a selector, or a gamemode as shorthand for
+// gamemode=<destination>. A random match is returned.
+func (m *InstanceManager) FindServer(ctx context.Context, destination string) (proxy.RegisteredServer, error) {
+	if s := m.server(destination); s != nil {
+		return s, nil
+	}
+
+	instances, err := m.resolve(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, ErrNoServersAvailable
+	}
+
+	return instances[m.rnd.Intn(len(instances))].server, nil
+}
+
+// Online counts the servers of a destination as FindServer resolves it and
+// the players on them, including those of other proxies once the backends
+// announce them. The empty destination counts the whole network.
+func (m *InstanceManager) Online(ctx context.Context, destination string) (players int, servers int, err error) {
+	var instances []instance
+	if destination == "" {
+		instances, err = m.selectInstances(ctx, nil)
+	} else {
+		instances, err = m.resolve(ctx, destination)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, i := range instances {
+		players += m.capacity(i).Players
+	}
+
+	return players, len(instances), nil
+}
+
+func (m *InstanceManager) resolve(ctx context.Context, destination string) ([]instance, error) {
+	if s := m.server(destination); s != nil {
+		return m.selectInstances(ctx, registry.Selector{{Key: "name", Operator: registry.Equals, Value: s.ServerInfo().Name()}})
+	}
+
+	if !strings.ContainsAny(destination, "=!,") {
+		destination = "gamemode=" + destination
+	}
+
+	sel, err := registry.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.selectInstances(ctx, sel)
+}
+
+// Labels returns the selector labels of a registered server.
+func (m *InstanceManager) Labels(ctx context.Context, name string) (map[string]string, error) {
+	info, err := kv.Typed[InstanceInfo](m.instancesKV, m.instanceKey(name)).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return info.Labels(name), nil
+}
+
+// Gamemode returns the gamemode of a registered server, empty if it has
+// none.
+func (m *InstanceManager) Gamemode(ctx context.Context, server proxy.RegisteredServer) (string, error) {
+	info, err := kv.Typed[InstanceInfo](m.instancesKV, m.instanceKey(server.ServerInfo().Name())).Get(ctx)
+	return info.Gamemode, err
+}
+
+func (m *InstanceManager) instancesOfGamemode(ctx context.Context, gamemode string) ([]instance, error) {
+	return m.selectInstances(ctx, registry.Selector{{Key: "gamemode", Operator: registry.Equals, Value: gamemode}})
+}
+
+func (m *InstanceManager) selectInstances(ctx context.Context, sel registry.Selector) ([]instance, error) {
 	keys, err := m.instancesKV.ListKeys(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var servers []proxy.RegisteredServer
+	infos := make(map[string]InstanceInfo, len(keys))
 	for _, key := range keys {
 		v, err := m.instancesKV.Get(ctx, key)
-		if err != nil {
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 
@@ -88,20 +286,35 @@ func (m *InstanceManager) GetServersOfGamemode(ctx context.Context, gamemode str
 			continue
 		}
 
-		if info.Gamemode != gamemode {
+		infos[m.network.ServerPrefix()+key] = info
+	}
+
+	var instances []instance
+	for _, s := range m.prx.Servers() {
+		name := s.ServerInfo().Name()
+		if !m.owns(name) {
 			continue
 		}
 
-		s := m.prx.Server(key)
-		if s == nil {
-			log.Printf("Server %s not found in registry", key)
+		info := infos[name]
+
+		if !sel.Matches(info.Labels(name)) {
 			continue
 		}
 
-		servers = append(servers, s)
+		instances = append(instances, instance{server: s, info: info})
+	}
+
+	return instances, nil
+}
+
+func servers(instances []instance) []proxy.RegisteredServer {
+	servers := make([]proxy.RegisteredServer, 0, len(instances))
+	for _, i := range instances {
+		servers = append(servers, i.server)
 	}
 
-	return servers, nil
+	return servers
 }
 
 func (m *InstanceManager) GetRandomServerOfGamemode(ctx context.Context, gamemode string) (proxy.RegisteredServer, error) {
@@ -0,0 +1,234 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var _ Client = &Cached{}
+
+// Cached is a read-through cache in front of another client. Every bucket
+// keeps a watcher on the underlying bucket, so entries are updated as soon as
+// any proxy changes them. A bucket only caches while its watcher is caught
+// up, it is emptied when the watcher reconnects.
+type Cached struct {
+	c       Client
+	buckets map[string]*CachedBucket
+	m       sync.Mutex
+}
+
+func WithCache(c Client) *Cached {
+	return &Cached{
+		c:       c,
+		buckets: make(map[string]*CachedBucket),
+	}
+}
+
+func (c *Cached) Bucket(ctx context.Context, name string) (Bucket, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if b, exists := c.buckets[name]; exists {
+		return b, nil
+	}
+
+	b, err := c.c.Bucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cb := &CachedBucket{
+		b:     b,
+		reads: make(map[string]*pendingRead),
+	}
+	go Watch(context.Background(), b, cb.handleChange, cb.resync)
+
+	c.buckets[name] = cb
+
+	return cb, nil
+}
+
+func (c *Cached) ListBuckets(ctx context.Context) ([]string, error) {
+	return c.c.ListBuckets(ctx)
+}
+
+// Stats returns the cache hits and misses of all buckets.
+func (c *Cached) Stats() (hits uint64, misses uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, b := range c.buckets {
+		hits += b.hits.Load()
+		misses += b.misses.Load()
+	}
+
+	return hits, misses
+}
+
+type cacheEntry struct {
+	value    []byte
+	notFound bool
+}
+
+// pendingRead is a key being read from the bucket. gen is bumped on every
+// change of the key meanwhile, so a read that raced with a change does not
+// put a stale value into the cache.
+type pendingRead struct {
+	readers int
+	gen     uint64
+}
+
+var _ Bucket = &CachedBucket{}
+
+type CachedBucket struct {
+	b Bucket
+	// entries is nil until the watcher replayed the bucket, nothing is
+	// cached until then
+	entries map[string]cacheEntry
+	// reads only has the keys being read, so it doesn't grow with the
+	// bucket
+	reads map[string]*pendingRead
+	// epoch is bumped on every resync, for the reads that raced with it
+	epoch  uint64
+	group  singleflight
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	m      sync.RWMutex
+}
+
+func (b *CachedBucket) handleChange(change *Value) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if change == nil {
+		if b.entries == nil {
+			b.entries = make(map[string]cacheEntry)
+		}
+
+		return
+	}
+
+	if r := b.reads[change.Key]; r != nil {
+		r.gen++
+	}
+
+	if b.entries == nil {
+		return
+	}
+
+	switch change.Operation {
+	case Put:
+		b.entries[change.Key] = cacheEntry{value: change.Value}
+	case Delete:
+		b.entries[change.Key] = cacheEntry{notFound: true}
+	}
+}
+
+// resync drops the entries after the watcher reconnected, they may have
+// missed changes. Caching resumes once the bucket was replayed again.
+func (b *CachedBucket) resync(ctx context.Context) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.entries = nil
+	b.epoch++
+
+	return nil
+}
+
+func (b *CachedBucket) Name() string {
+	return b.b.Name()
+}
+
+func (b *CachedBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	b.m.RLock()
+	e, cached := b.entries[key]
+	b.m.RUnlock()
+
+	if cached {
+		b.hits.Add(1)
+
+		if e.notFound {
+			return nil, ErrKeyNotFound
+		}
+
+		return e.value, nil
+	}
+
+	b.misses.Add(1)
+
+	b.m.Lock()
+	r := b.reads[key]
+	if r == nil {
+		r = &pendingRead{}
+		b.reads[key] = r
+	}
+	r.readers++
+	gen, epoch := r.gen, b.epoch
+	b.m.Unlock()
+
+	v, err := b.group.do(ctx, key, func(ctx context.Context) ([]byte, error) {
+		return b.b.Get(ctx, key)
+	})
+
+	b.m.Lock()
+	if (err == nil || errors.Is(err, ErrKeyNotFound)) && b.entries != nil && r.gen == gen && b.epoch == epoch {
+		b.entries[key] = cacheEntry{value: v, notFound: err != nil}
+	}
+
+	r.readers--
+	if r.readers == 0 {
+		delete(b.reads, key)
+	}
+	b.m.Unlock()
+
+	return v, err
+}
+
+func (b *CachedBucket) forget(key string) {
+	b.m.Lock()
+	if r := b.reads[key]; r != nil {
+		r.gen++
+	}
+
+	if b.entries != nil {
+		delete(b.entries, key)
+	}
+	b.m.Unlock()
+}
+
+func (b *CachedBucket) Set(ctx context.Context, key string, value []byte) error {
+	b.forget(key)
+
+	return b.b.Set(ctx, key, value)
+}
+
+func (b *CachedBucket) Create(ctx context.Context, key string, value []byte) error {
+	b.forget(key)
+
+	return Create(ctx, b.b, key, value)
+}
+
+func (b *CachedBucket) Delete(ctx context.Context, key string) error {
+	b.forget(key)
+
+	return b.b.Delete(ctx, key)
+}
+
+func (b *CachedBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	return b.b.WatchAll(ctx)
+}
+
+func (b *CachedBucket) WatchFiltered(ctx context.Context, f Filter) (Watcher, error) {
+	return WatchFiltered(ctx, b.b, f)
+}
+
+func (b *CachedBucket) Unwatch(w Watcher) {
+	b.b.Unwatch(w)
+}
+
+func (b *CachedBucket) ListKeys(ctx context.Context) ([]string, error) {
+	return b.b.ListKeys(ctx)
+}
@@ -0,0 +1,201 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func TestCachedKV(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testKV(ctx, t, WithCache(k))
+}
+
+func TestCachedKVWatch(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testKVWatch(ctx, t, WithCache(k))
+}
+
+func TestCachedKVHits(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := WithCache(k)
+
+	b, err := c.Bucket(ctx, "hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "test", []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			v, err := b.Get(ctx, "test")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if string(v) != "test" {
+				t.Errorf("expected value to be 'test', got '%s'", string(v))
+			}
+		}()
+	}
+	wg.Wait()
+
+	hits, misses := c.Stats()
+	if hits+misses != 10 {
+		t.Fatalf("expected 10 reads, got %d", hits+misses)
+	}
+
+	// A change through another client must reach the cache through the watcher.
+	raw, err := k.Bucket(ctx, "hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := raw.Set(ctx, "test", []byte("test2")); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		v, err := b.Get(ctx, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(v) == "test2" {
+			break
+		}
+	}
+}
+
+// flakyClient hands out flakyBuckets.
+type flakyClient struct {
+	Client
+	watchers chan Watcher
+}
+
+func (c *flakyClient) Bucket(ctx context.Context, name string) (Bucket, error) {
+	b, err := c.Client.Bucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flakyBucket{Bucket: b, watchers: c.watchers}, nil
+}
+
+func TestCachedKVReconnects(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watchers := make(chan Watcher, 2)
+	c := WithCache(&flakyClient{Client: k, watchers: watchers})
+
+	b, err := c.Bucket(ctx, "reconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-watchers
+
+	if err := b.Set(ctx, "test", []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	// waitFor reads the key until it has the value and the read was a hit
+	waitFor := func(value string) {
+		t.Helper()
+
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			hits, _ := c.Stats()
+
+			v, err := b.Get(ctx, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if after, _ := c.Stats(); string(v) == value && after > hits {
+				return
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		t.Fatalf("value '%s' wasn't cached", value)
+	}
+
+	waitFor("test")
+
+	first.Unwatch()
+	<-watchers
+
+	raw, err := k.Bucket(ctx, "reconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := raw.Set(ctx, "test", []byte("test2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache has to resume with the new watcher
+	waitFor("test2")
+}
+
+func TestCachedKVForgetsReads(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := WithCache(k).Bucket(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb := b.(*CachedBucket)
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = cb.Get(ctx, key)
+	}
+
+	cb.m.RLock()
+	defer cb.m.RUnlock()
+
+	if len(cb.reads) != 0 {
+		t.Fatalf("expected the finished reads to be forgotten, got %d", len(cb.reads))
+	}
+}
@@ -0,0 +1,503 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoding stores the JSON values of a bucket in another format. Callers
+// keep reading and writing JSON, only the stored bytes change.
+type Encoding interface {
+	Name() string
+	// ID is written in front of every encoded value, so values can be
+	// decoded no matter which encoding the bucket currently writes.
+	ID() byte
+	Encode(value []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// Encoded values start with encodedMarker and the ID of their encoding. JSON
+// never starts with a zero byte, so values without the marker are returned
+// as they are, e.g. JSON written before the bucket switched encodings.
+const (
+	encodedMarker byte = 0
+	rawID         byte = 0
+)
+
+var (
+	encodings  = map[string]Encoding{}
+	encodingsM sync.RWMutex
+)
+
+func RegisterEncoding(e Encoding) {
+	encodingsM.Lock()
+	defer encodingsM.Unlock()
+
+	encodings[e.Name()] = e
+}
+
+// LookupEncoding returns the encoding of that name, "json" is nil and stores
+// values unchanged.
+func LookupEncoding(name string) (Encoding, error) {
+	if name == "json" {
+		return nil, nil
+	}
+
+	encodingsM.RLock()
+	defer encodingsM.RUnlock()
+
+	if e, ok := encodings[name]; ok {
+		return e, nil
+	}
+
+	return nil, fmt.Errorf("unknown KV encoding %q", name)
+}
+
+func encodingByID(id byte) (Encoding, bool) {
+	encodingsM.RLock()
+	defer encodingsM.RUnlock()
+
+	for _, e := range encodings {
+		if e.ID() == id {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+func init() {
+	RegisterEncoding(MsgPack)
+	RegisterEncoding(Protobuf)
+}
+
+func encodeValue(e Encoding, value []byte) ([]byte, error) {
+	if e == nil || !json.Valid(value) {
+		// Not JSON, store it as is unless it could be mistaken for an
+		// encoded value
+		if len(value) > 0 && value[0] == encodedMarker {
+			return append([]byte{encodedMarker, rawID}, value...), nil
+		}
+
+		return value, nil
+	}
+
+	data, err := e.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{encodedMarker, e.ID()}, data...), nil
+}
+
+// isEncoded reports whether the value was written by encodeValue with an
+// encoding or escaped as raw.
+func isEncoded(data []byte) bool {
+	return len(data) >= 2 && data[0] == encodedMarker
+}
+
+func decodeValue(data []byte) ([]byte, error) {
+	if !isEncoded(data) {
+		return data, nil
+	}
+
+	if data[1] == rawID {
+		return data[2:], nil
+	}
+
+	e, ok := encodingByID(data[1])
+	if !ok {
+		return nil, fmt.Errorf("value written with unknown KV encoding %d", data[1])
+	}
+
+	return e.Decode(data[2:])
+}
+
+var _ Client = &Encoded{}
+
+// Encoded stores the values of the buckets in the encoding configured for
+// them and decodes values of every encoding, so proxies can switch a bucket
+// over one by one and old JSON values stay readable.
+type Encoded struct {
+	c Client
+	// byBucket maps bucket names, or their last part after "_", to the
+	// encoding new values are written in. "*" matches every bucket.
+	byBucket map[string]Encoding
+}
+
+func WithEncodings(c Client, byBucket map[string]Encoding) *Encoded {
+	return &Encoded{c: c, byBucket: byBucket}
+}
+
+func (c *Encoded) encoding(bucket string) Encoding {
+	if e, ok := c.byBucket[bucket]; ok {
+		return e
+	}
+
+	if i := strings.LastIndexByte(bucket, '_'); i >= 0 {
+		if e, ok := c.byBucket[bucket[i+1:]]; ok {
+			return e
+		}
+	}
+
+	return c.byBucket["*"]
+}
+
+func (c *Encoded) Bucket(ctx context.Context, name string) (Bucket, error) {
+	b, err := c.c.Bucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncodedBucket{b: b, e: c.encoding(name)}, nil
+}
+
+// Encodings returns the configured encoding names by bucket pattern.
+func (c *Encoded) Encodings() map[string]string {
+	names := make(map[string]string, len(c.byBucket))
+	for bucket, e := range c.byBucket {
+		names[bucket] = "json"
+		if e != nil {
+			names[bucket] = e.Name()
+		}
+	}
+
+	return names
+}
+
+// Reencode rewrites the values of the bucket in its encoding, see
+// EncodedBucket.Reencode.
+func (c *Encoded) Reencode(ctx context.Context, name string) (int, error) {
+	b, err := c.Bucket(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.(*EncodedBucket).Reencode(ctx)
+}
+
+func (c *Encoded) ListBuckets(ctx context.Context) ([]string, error) {
+	return c.c.ListBuckets(ctx)
+}
+
+var _ Bucket = &EncodedBucket{}
+
+type EncodedBucket struct {
+	b Bucket
+	e Encoding
+}
+
+func (b *EncodedBucket) Name() string {
+	return b.b.Name()
+}
+
+// Encoding returns the name of the encoding new values are written in.
+func (b *EncodedBucket) Encoding() string {
+	if b.e == nil {
+		return "json"
+	}
+
+	return b.e.Name()
+}
+
+func (b *EncodedBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := b.b.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := decodeValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", b.Name(), key, err)
+	}
+
+	return value, nil
+}
+
+func (b *EncodedBucket) Set(ctx context.Context, key string, value []byte) error {
+	data, err := encodeValue(b.e, value)
+	if err != nil {
+		return fmt.Errorf("%s/%s: %w", b.Name(), key, err)
+	}
+
+	return b.b.Set(ctx, key, data)
+}
+
+func (b *EncodedBucket) Create(ctx context.Context, key string, value []byte) error {
+	data, err := encodeValue(b.e, value)
+	if err != nil {
+		return fmt.Errorf("%s/%s: %w", b.Name(), key, err)
+	}
+
+	return Create(ctx, b.b, key, data)
+}
+
+func (b *EncodedBucket) Delete(ctx context.Context, key string) error {
+	return b.b.Delete(ctx, key)
+}
+
+func (b *EncodedBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	w, err := b.b.WatchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ew := &EncodedWatcher{w: w, bucket: b.Name(), changes: make(chan *Value), done: make(chan struct{})}
+	go ew.forward()
+
+	return ew, nil
+}
+
+func (b *EncodedBucket) Unwatch(w Watcher) {
+	if ew, ok := w.(*EncodedWatcher); ok {
+		ew.Unwatch()
+		return
+	}
+
+	b.b.Unwatch(w)
+}
+
+func (b *EncodedBucket) ListKeys(ctx context.Context) ([]string, error) {
+	return b.b.ListKeys(ctx)
+}
+
+// Reencode rewrites every value that isn't stored in the bucket's encoding
+// yet and returns how many it rewrote. Once it ran, proxies that only read
+// JSON can't read the bucket anymore.
+func (b *EncodedBucket) Reencode(ctx context.Context) (int, error) {
+	keys, err := b.b.ListKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, key := range keys {
+		data, err := b.b.Get(ctx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return rewritten, err
+		}
+
+		value, err := decodeValue(data)
+		if err != nil {
+			return rewritten, fmt.Errorf("%s/%s: %w", b.Name(), key, err)
+		}
+
+		// Encodings are deterministic, values already in the bucket's
+		// encoding come out the same
+		want, err := encodeValue(b.e, value)
+		if err != nil {
+			return rewritten, fmt.Errorf("%s/%s: %w", b.Name(), key, err)
+		}
+
+		if bytes.Equal(want, data) {
+			continue
+		}
+
+		if err := b.b.Set(ctx, key, want); err != nil {
+			return rewritten, err
+		}
+
+		rewritten++
+	}
+
+	return rewritten, nil
+}
+
+var _ Watcher = &EncodedWatcher{}
+
+// EncodedWatcher decodes the values of the changes it forwards. Values that
+// can't be decoded are logged and skipped.
+type EncodedWatcher struct {
+	w       Watcher
+	bucket  string
+	changes chan *Value
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (w *EncodedWatcher) forward() {
+	defer close(w.changes)
+
+	for {
+		var v *Value
+		var ok bool
+
+		select {
+		case v, ok = <-w.w.Changes():
+			if !ok {
+				return
+			}
+		case <-w.done:
+			return
+		}
+
+		if v != nil && v.Operation == Put {
+			value, err := decodeValue(v.Value)
+			if err != nil {
+				log.Printf("Skipping change of %s/%s: %v", w.bucket, v.Key, err)
+				continue
+			}
+
+			v = &Value{Key: v.Key, Value: value, Operation: v.Operation}
+		}
+
+		select {
+		case w.changes <- v:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *EncodedWatcher) Changes() <-chan *Value {
+	return w.changes
+}
+
+func (w *EncodedWatcher) Unwatch() {
+	w.once.Do(func() { close(w.done) })
+	w.w.Unwatch()
+}
+
+// jsonObject keeps the members of a JSON object in order, so values come
+// back byte for byte as json.Marshal wrote them.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	Key   string
+	Value any
+}
+
+// parseJSON parses a value into nil, bool, json.Number, string, []any and
+// jsonObject.
+func parseJSON(data []byte) (any, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	v, err := parseJSONValue(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after JSON value")
+	}
+
+	return v, nil
+}
+
+func parseJSONValue(d *json.Decoder) (any, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			arr := make([]any, 0)
+			for d.More() {
+				v, err := parseJSONValue(d)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+
+			_, err := d.Token()
+			return arr, err
+
+		case '{':
+			obj := make(jsonObject, 0)
+			for d.More() {
+				k, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				v, err := parseJSONValue(d)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, jsonMember{Key: k.(string), Value: v})
+			}
+
+			_, err := d.Token()
+			return obj, err
+		}
+
+		return nil, fmt.Errorf("unexpected %s", t)
+
+	default:
+		return t, nil
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		buf.WriteString(string(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(v, 10))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%v has no JSON form", v)
+		}
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		e := json.NewEncoder(buf)
+		e.SetEscapeHTML(false)
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+		// Encode ends every value with a newline
+		buf.Truncate(buf.Len() - 1)
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, m := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, m.Key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, m.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value %T", v)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+var encodingValues = []string{
+	`null`,
+	`true`,
+	`"café <b>"`,
+	`{"enabled":true,"whitelisted":["a","b"],"limit":-100000,"ratio":0.25,"big":1e+21,"nested":{"empty":[],"none":null}}`,
+	`[0,127,128,-1,-32,-33,-129,65536,-2147483649,18446744073709551615]`,
+	`{}`,
+}
+
+func TestEncodingsRoundTrip(t *testing.T) {
+	for _, e := range []Encoding{MsgPack, Protobuf} {
+		for _, value := range encodingValues {
+			data, err := e.Encode([]byte(value))
+			if err != nil {
+				t.Fatalf("%s: encoding %s: %v", e.Name(), value, err)
+			}
+
+			got, err := e.Decode(data)
+			if err != nil {
+				t.Fatalf("%s: decoding %s: %v", e.Name(), value, err)
+			}
+
+			want := value
+			if e == Protobuf && value == encodingValues[4] {
+				// Every number is a double
+				want = `[0,127,128,-1,-32,-33,-129,65536,-2147483649,1.8446744073709552e+19]`
+			}
+
+			if string(got) != want {
+				t.Errorf("%s: got %s, want %s", e.Name(), got, want)
+			}
+		}
+	}
+}
+
+func TestEncodingsWireFormat(t *testing.T) {
+	value := []byte(`{"a":1,"b":[true,null]}`)
+
+	tests := map[Encoding]string{
+		MsgPack:  "82a16101a16292c3c0",
+		Protobuf: "2a210a0e0a0161120911000000000000f03f0a0f0a0162120a32080a0220010a020800",
+	}
+
+	for e, want := range tests {
+		data, err := e.Encode(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := hex.EncodeToString(data); got != want {
+			t.Errorf("%s: got %s, want %s", e.Name(), got, want)
+		}
+	}
+}
+
+func TestEncodedKV(t *testing.T) {
+	ctx := context.Background()
+
+	for _, e := range []Encoding{MsgPack, Protobuf} {
+		k, err := NewJSONClient(storage.NewMemory(), "test.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		enc := WithEncodings(k, map[string]Encoding{"*": e})
+
+		testKV(ctx, t, enc)
+		testKVWatch(ctx, t, enc)
+	}
+}
+
+func TestEncodedKVTransition(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := k.Bucket(ctx, "csmc_ns_net_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := []byte(`{"whitelisted":["a","b","c"]}`)
+	if err := raw.Set(ctx, "legacy", legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Set(ctx, "zero", []byte{0}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := WithEncodings(k, map[string]Encoding{"whitelist": MsgPack}).Bucket(ctx, "csmc_ns_net_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := b.Get(ctx, "legacy"); err != nil || !bytes.Equal(got, legacy) {
+		t.Fatalf("legacy value read as %s, %v", got, err)
+	}
+
+	if err := b.Set(ctx, "new", legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored, _ := raw.Get(ctx, "new"); len(stored) >= len(legacy) || stored[0] != 0 {
+		t.Errorf("new value stored as %q", stored)
+	}
+
+	n, err := b.(*EncodedBucket).Reencode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("reencoded %d values, want the legacy and the zero value", n)
+	}
+
+	if n, err := b.(*EncodedBucket).Reencode(ctx); err != nil || n != 0 {
+		t.Errorf("reencoded %d values again: %v", n, err)
+	}
+
+	for key, want := range map[string][]byte{"legacy": legacy, "new": legacy, "zero": {0}} {
+		if got, err := b.Get(ctx, key); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s read as %q, %v", key, got, err)
+		}
+	}
+
+	// Switching back to JSON still reads the encoded values
+	back, err := WithEncodings(k, nil).Bucket(ctx, "csmc_ns_net_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := back.Get(ctx, "new"); err != nil || !bytes.Equal(got, legacy) {
+		t.Errorf("encoded value read back as %s, %v", got, err)
+	}
+}
@@ -0,0 +1,167 @@
+package kv
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+)
+
+var _ Client = &Faulty{}
+
+// Faulty injects the faults of f into every bucket of c.
+type Faulty struct {
+	c Client
+	f *faults.Injector
+}
+
+func WithFaults(c Client, f *faults.Injector) *Faulty {
+	return &Faulty{c: c, f: f}
+}
+
+func (c *Faulty) Bucket(ctx context.Context, name string) (Bucket, error) {
+	if err := c.f.Before(ctx, "bucket "+name); err != nil {
+		return nil, err
+	}
+
+	b, err := c.c.Bucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FaultyBucket{b: b, f: c.f}, nil
+}
+
+func (c *Faulty) ListBuckets(ctx context.Context) ([]string, error) {
+	if err := c.f.Before(ctx, "list buckets"); err != nil {
+		return nil, err
+	}
+
+	return c.c.ListBuckets(ctx)
+}
+
+var _ Bucket = &FaultyBucket{}
+
+type FaultyBucket struct {
+	b Bucket
+	f *faults.Injector
+}
+
+func (b *FaultyBucket) Name() string {
+	return b.b.Name()
+}
+
+func (b *FaultyBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := b.f.Before(ctx, "get "+b.Name()+"/"+key); err != nil {
+		return nil, err
+	}
+
+	return b.b.Get(ctx, key)
+}
+
+func (b *FaultyBucket) Set(ctx context.Context, key string, value []byte) error {
+	if err := b.f.Before(ctx, "set "+b.Name()+"/"+key); err != nil {
+		return err
+	}
+
+	return b.b.Set(ctx, key, value)
+}
+
+func (b *FaultyBucket) Create(ctx context.Context, key string, value []byte) error {
+	if err := b.f.Before(ctx, "create "+b.Name()+"/"+key); err != nil {
+		return err
+	}
+
+	return Create(ctx, b.b, key, value)
+}
+
+func (b *FaultyBucket) Delete(ctx context.Context, key string) error {
+	if err := b.f.Before(ctx, "delete "+b.Name()+"/"+key); err != nil {
+		return err
+	}
+
+	return b.b.Delete(ctx, key)
+}
+
+func (b *FaultyBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	if err := b.f.Before(ctx, "watch "+b.Name()); err != nil {
+		return nil, err
+	}
+
+	w, err := b.b.WatchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &FaultyWatcher{w: w, changes: make(chan *Value), done: make(chan struct{})}
+	go fw.forward(b.f)
+
+	return fw, nil
+}
+
+func (b *FaultyBucket) Unwatch(w Watcher) {
+	if fw, ok := w.(*FaultyWatcher); ok {
+		fw.Unwatch()
+		return
+	}
+
+	b.b.Unwatch(w)
+}
+
+func (b *FaultyBucket) ListKeys(ctx context.Context) ([]string, error) {
+	if err := b.f.Before(ctx, "list "+b.Name()); err != nil {
+		return nil, err
+	}
+
+	return b.b.ListKeys(ctx)
+}
+
+var _ Watcher = &FaultyWatcher{}
+
+// FaultyWatcher delays and drops changes. The nil marking the end of the
+// replay is never dropped, so watchers still finish their initial load.
+type FaultyWatcher struct {
+	w       Watcher
+	changes chan *Value
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (w *FaultyWatcher) forward(f *faults.Injector) {
+	defer close(w.changes)
+
+	for {
+		var v *Value
+		var ok bool
+
+		select {
+		case v, ok = <-w.w.Changes():
+			if !ok {
+				return
+			}
+		case <-w.done:
+			return
+		}
+
+		if v != nil && f.Drop() {
+			continue
+		}
+
+		f.Delay()
+
+		select {
+		case w.changes <- v:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *FaultyWatcher) Changes() <-chan *Value {
+	return w.changes
+}
+
+func (w *FaultyWatcher) Unwatch() {
+	w.once.Do(func() { close(w.done) })
+	w.w.Unwatch()
+}
@@ -0,0 +1,93 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func TestFaultyKV(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testKV(ctx, t, WithFaults(k, faults.New("kv", faults.Config{})))
+	testKVWatch(ctx, t, WithFaults(k, faults.New("kv", faults.Config{LatencyMs: 1})))
+}
+
+func TestFaultyKVErrors(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := faults.New("kv", faults.Config{})
+	b, err := WithFaults(k, f).Bucket(ctx, "errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Set(faults.Config{ErrorRate: 1})
+
+	if err := b.Set(ctx, "test", []byte("test")); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("got %v, want an injected fault", err)
+	}
+
+	if _, err := b.Get(ctx, "test"); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("got %v, want an injected fault", err)
+	}
+
+	f.Set(faults.Config{})
+
+	if err := b.Set(ctx, "test", []byte("test")); err != nil {
+		t.Errorf("got %v after clearing the faults", err)
+	}
+}
+
+func TestFaultyKVDrop(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := WithFaults(k, faults.New("kv", faults.Config{DropRate: 1})).Bucket(ctx, "drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "before", []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := b.WatchAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Unwatch()
+
+	// The replayed key is dropped, the end of the replay is not
+	if v := <-w.Changes(); v != nil {
+		t.Fatalf("got %+v, want the end of the replay", v)
+	}
+
+	if err := b.Set(ctx, "after", []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case v := <-w.Changes():
+		t.Errorf("got %+v, want the change to be dropped", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -71,6 +71,13 @@ func (j *JSONClient) save(ctx context.Context) error {
 	j.m.Lock()
 	defer j.m.Unlock()
 
+	// Buckets are written concurrently, their data must not change while
+	// it is encoded
+	for _, b := range j.buckets {
+		b.m.RLock()
+		defer b.m.RUnlock()
+	}
+
 	if err := json.NewEncoder(fd).Encode(j.buckets); err != nil {
 		return err
 	}
@@ -102,6 +109,18 @@ func (j *JSONClient) Bucket(ctx context.Context, name string) (Bucket, error) {
 	return b, nil
 }
 
+func (j *JSONClient) ListBuckets(ctx context.Context) ([]string, error) {
+	j.m.RLock()
+	defer j.m.RUnlock()
+
+	names := make([]string, 0, len(j.buckets))
+	for name := range j.buckets {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
 var _ Bucket = &JSONBucket{}
 
 type JSONBucket struct {
@@ -134,9 +153,25 @@ func (b *JSONBucket) Set(ctx context.Context, key string, value []byte) error {
 
 	for _, w := range b.watchers {
 		log.Printf("sending put change for %s", key)
-		w.m.Lock()
-		w.changes <- &Value{Key: key, Value: value, Operation: Put}
-		w.m.Unlock()
+		w.send(&Value{Key: key, Value: value, Operation: Put})
+	}
+
+	b.m.Unlock()
+
+	return b.save(ctx)
+}
+
+func (b *JSONBucket) Create(ctx context.Context, key string, value []byte) error {
+	b.m.Lock()
+	if _, exists := b.Data[key]; exists {
+		b.m.Unlock()
+		return ErrKeyExists
+	}
+
+	b.Data[key] = value
+
+	for _, w := range b.watchers {
+		w.send(&Value{Key: key, Value: value, Operation: Put})
 	}
 
 	b.m.Unlock()
@@ -155,9 +190,7 @@ func (b *JSONBucket) Delete(ctx context.Context, key string) error {
 
 	for _, w := range b.watchers {
 		log.Printf("sending delete change for %s", key)
-		w.m.Lock()
-		w.changes <- &Value{Key: key, Operation: Delete}
-		w.m.Unlock()
+		w.send(&Value{Key: key, Operation: Delete})
 	}
 
 	b.m.Unlock()
@@ -182,9 +215,9 @@ func (b *JSONBucket) WatchAll(ctx context.Context) (Watcher, error) {
 	w := &JSONWatcher{
 		bucket:  b,
 		changes: make(chan *Value, len(b.Data)+1),
+		done:    make(chan struct{}),
 	}
 
-	w.m.Lock()
 	b.watchers = append(b.watchers, w)
 
 	log.Printf("replaying %d changes", len(b.Data))
@@ -197,8 +230,6 @@ func (b *JSONBucket) WatchAll(ctx context.Context) (Watcher, error) {
 
 	w.changes <- nil
 
-	w.m.Unlock()
-
 	b.m.Unlock()
 
 	return w, nil
@@ -218,14 +249,27 @@ func (b *JSONBucket) Unwatch(w Watcher) {
 	})
 }
 
-var ErrKeyNotFound = errors.New("key not found")
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrKeyExists   = errors.New("key exists")
+)
 
 var _ Watcher = &JSONWatcher{}
 
 type JSONWatcher struct {
 	bucket  *JSONBucket
 	changes chan *Value
-	m       sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+// send is called with the bucket lock held. It gives up once the watcher is
+// stopped so a consumer that stopped reading can never block the bucket.
+func (j *JSONWatcher) send(v *Value) {
+	select {
+	case j.changes <- v:
+	case <-j.done:
+	}
 }
 
 func (j *JSONWatcher) Changes() <-chan *Value {
@@ -233,9 +277,12 @@ func (j *JSONWatcher) Changes() <-chan *Value {
 }
 
 func (j *JSONWatcher) Unwatch() {
-	j.m.Lock()
-	defer j.m.Unlock()
+	j.once.Do(func() {
+		close(j.done)
 
-	close(j.changes)
-	j.bucket.Unwatch(j)
+		// Once removed from the bucket no more sends can start, so closing
+		// the channel afterwards is safe.
+		j.bucket.Unwatch(j)
+		close(j.changes)
+	})
 }
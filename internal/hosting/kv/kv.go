@@ -1,9 +1,16 @@
 package kv
 
-import "context"
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
 
 type Client interface {
 	Bucket(ctx context.Context, name string) (Bucket, error)
+	ListBuckets(ctx context.Context) ([]string, error)
 }
 
 type Bucket interface {
@@ -16,6 +23,65 @@ type Bucket interface {
 	ListKeys(ctx context.Context) ([]string, error)
 }
 
+// Creator is implemented by buckets that can set a key only if it doesn't
+// exist yet, atomically. Use Create, which falls back for other buckets.
+type Creator interface {
+	Create(ctx context.Context, key string, value []byte) error
+}
+
+// Create sets the key unless it exists, then it returns ErrKeyExists. It is
+// only atomic if the bucket implements Creator.
+func Create(ctx context.Context, b Bucket, key string, value []byte) error {
+	if c, ok := b.(Creator); ok {
+		return c.Create(ctx, key, value)
+	}
+
+	if _, err := b.Get(ctx, key); err == nil {
+		return ErrKeyExists
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	return b.Set(ctx, key, value)
+}
+
+// Filter selects the keys a watcher receives changes of.
+type Filter func(key string) bool
+
+func Keys(keys ...string) Filter {
+	return func(key string) bool {
+		return slices.Contains(keys, key)
+	}
+}
+
+func Prefix(prefix string) Filter {
+	return func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}
+}
+
+// FilterWatcher is implemented by buckets that only deliver the changes
+// matching a filter, saving the work of passing on the others. Use
+// WatchFiltered, which filters itself for other buckets.
+type FilterWatcher interface {
+	WatchFiltered(ctx context.Context, f Filter) (Watcher, error)
+}
+
+// WatchFiltered is WatchAll for the keys matching f. The replay ends with nil
+// like for WatchAll.
+func WatchFiltered(ctx context.Context, b Bucket, f Filter) (Watcher, error) {
+	if fw, ok := b.(FilterWatcher); ok {
+		return fw.WatchFiltered(ctx, f)
+	}
+
+	w, err := b.WatchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFilteredWatcher(w, f), nil
+}
+
 type Watcher interface {
 	Changes() <-chan *Value
 	Unwatch()
@@ -44,3 +110,55 @@ func (o Operation) String() string {
 		return "Unknown"
 	}
 }
+
+type filteredWatcher struct {
+	w       Watcher
+	f       Filter
+	changes chan *Value
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newFilteredWatcher(w Watcher, f Filter) *filteredWatcher {
+	fw := &filteredWatcher{w: w, f: f, changes: make(chan *Value), done: make(chan struct{})}
+	go fw.forward()
+
+	return fw
+}
+
+func (w *filteredWatcher) forward() {
+	defer close(w.changes)
+
+	for {
+		var v *Value
+		var ok bool
+
+		select {
+		case v, ok = <-w.w.Changes():
+			if !ok {
+				return
+			}
+		case <-w.done:
+			return
+		}
+
+		if v != nil && !w.f(v.Key) {
+			continue
+		}
+
+		select {
+		case w.changes <- v:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *filteredWatcher) Changes() <-chan *Value {
+	return w.changes
+}
+
+func (w *filteredWatcher) Unwatch() {
+	w.once.Do(func() { close(w.done) })
+	w.w.Unwatch()
+}
@@ -2,12 +2,50 @@ package kv
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func testKV(ctx context.Context, t *testing.T, k Client) {
 	testKVCRUD(ctx, t, k)
 	testKVDoubleAccess(ctx, t, k)
+	testKVCreate(ctx, t, k)
+}
+
+func testKVCreate(ctx context.Context, t *testing.T, k Client) {
+	t.Run("Create", func(t *testing.T) {
+		b, err := k.Bucket(ctx, "create")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Create(ctx, b, "test", []byte("first")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Create(ctx, b, "test", []byte("second")); !errors.Is(err, ErrKeyExists) {
+			t.Fatalf("expected ErrKeyExists, got %v", err)
+		}
+
+		v, err := b.Get(ctx, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(v) != "first" {
+			t.Fatalf("expected value to be 'first', got '%s'", string(v))
+		}
+
+		if err := b.Delete(ctx, "test"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Create(ctx, b, "test", []byte("third")); err != nil {
+			t.Fatalf("expected a deleted key to be created again, got %v", err)
+		}
+	})
 }
 
 func testKVCRUD(ctx context.Context, t *testing.T, k Client) {
@@ -100,6 +138,7 @@ func testKVWatchWatch(ctx context.Context, t *testing.T, k Client) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		defer watcher.Unwatch()
 
 		tests := []*Value{
 			nil,
@@ -107,72 +146,46 @@ func testKVWatchWatch(ctx context.Context, t *testing.T, k Client) {
 			{Key: "test", Value: nil, Operation: Delete},
 		}
 
-		t.Run("Watcher", func(t *testing.T) {
-			t.Parallel()
-
-			for _, test := range tests {
-				t.Logf("expected: %v", test)
-
-				msg := <-watcher.Changes()
-				t.Logf("got:      %v", msg)
-
-				if msg == nil {
-					if test != nil {
-						t.Fatalf("expected key to be '%s', got nil", test.Key)
-					}
-				} else {
-					if test == nil {
-						t.Fatalf("expected key to be nil, got '%s'", msg.Key)
-					}
-
-					if msg.Key != test.Key {
-						t.Fatalf("expected key to be '%s', got '%s'", test.Key, msg.Key)
-					}
-
-					if string(msg.Value) != string(test.Value) {
-						t.Fatalf("expected value to be '%s', got '%s'", string(test.Value), string(msg.Value))
-					}
-
-					if msg.Operation != test.Operation {
-						t.Fatalf("expected operation to be %d, got %d", test.Operation, msg.Operation)
-					}
+		// The changes are made concurrently, so a watcher that only delivers
+		// while nobody is reading can't block the test
+		errs := make(chan error, 1)
+		go func() {
+			errs <- func() error {
+				if err := b.Set(ctx, "test", []byte("test")); err != nil {
+					return err
 				}
-			}
-		})
 
-		t.Run("Modifier", func(t *testing.T) {
-			t.Parallel()
+				v, err := b.Get(ctx, "test")
+				if err != nil {
+					return err
+				}
 
-			if err := b.Set(ctx, "test", []byte("test")); err != nil {
-				t.Fatal(err)
-			}
+				if string(v) != "test" {
+					return fmt.Errorf("expected value to be 'test', got '%s'", string(v))
+				}
 
-			v, err := b.Get(ctx, "test")
-			if err != nil {
-				t.Fatal(err)
-			}
+				keys, err := b.ListKeys(ctx)
+				if err != nil {
+					return err
+				}
 
-			if string(v) != "test" {
-				t.Fatalf("expected value to be 'test', got '%s'", string(v))
-			}
+				if len(keys) != 1 {
+					return fmt.Errorf("expected 1 key, got %d", len(keys))
+				}
 
-			keys, err := b.ListKeys(ctx)
-			if err != nil {
-				t.Fatal(err)
-			}
+				if keys[0] != "test" {
+					return fmt.Errorf("expected key to be 'test', got '%s'", keys[0])
+				}
 
-			if len(keys) != 1 {
-				t.Fatalf("expected 1 key, got %d", len(keys))
-			}
+				return b.Delete(ctx, "test")
+			}()
+		}()
 
-			if keys[0] != "test" {
-				t.Fatalf("expected key to be 'test', got '%s'", keys[0])
-			}
+		expectChanges(t, watcher, tests)
 
-			if err := b.Delete(ctx, "test"); err != nil {
-				t.Fatal(err)
-			}
-		})
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
 	})
 }
 
@@ -191,6 +204,7 @@ func testKVWatchReplay(ctx context.Context, t *testing.T, k Client) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		defer watcher.Unwatch()
 
 		tests := []*Value{
 			{Key: "test", Value: []byte("test"), Operation: Put},
@@ -199,51 +213,67 @@ func testKVWatchReplay(ctx context.Context, t *testing.T, k Client) {
 			{Key: "test", Value: nil, Operation: Delete},
 		}
 
-		t.Run("Watcher", func(t *testing.T) {
-			t.Parallel()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- func() error {
+				if err := b.Set(ctx, "test", []byte("test2")); err != nil {
+					return err
+				}
+
+				if err := b.Delete(ctx, "test"); err != nil {
+					return err
+				}
+
+				return b.Set(ctx, "test", []byte("test3"))
+			}()
+		}()
 
-			for _, test := range tests {
-				t.Logf("expected: %v", test)
+		expectChanges(t, watcher, tests)
 
-				msg := <-watcher.Changes()
-				t.Logf("got:      %v", msg)
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
 
-				if msg == nil {
-					if test != nil {
-						t.Fatalf("expected key to be '%s', got nil", test.Key)
-					}
-				} else {
-					if msg.Key != test.Key {
-						t.Fatalf("expected key to be '%s', got '%s'", test.Key, msg.Key)
-					}
+// expectChanges reads the changes from the watcher, nil being the end of the
+// initial values, and fails if one doesn't arrive within 10 seconds.
+func expectChanges(t *testing.T, watcher Watcher, tests []*Value) {
+	t.Helper()
 
-					if string(msg.Value) != string(test.Value) {
-						t.Fatalf("expected value to be '%s', got '%s'", string(test.Value), string(msg.Value))
-					}
+	for _, test := range tests {
+		t.Logf("expected: %v", test)
 
-					if msg.Operation != test.Operation {
-						t.Fatalf("expected operation to be %d, got %d", test.Operation, msg.Operation)
-					}
-				}
+		var msg *Value
+		select {
+		case msg = <-watcher.Changes():
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %v", test)
+		}
+		t.Logf("got:      %v", msg)
+
+		if msg == nil {
+			if test != nil {
+				t.Fatalf("expected key to be '%s', got nil", test.Key)
 			}
 
-			watcher.Unwatch()
-		})
+			continue
+		}
 
-		t.Run("Modifier", func(t *testing.T) {
-			t.Parallel()
+		if test == nil {
+			t.Fatalf("expected key to be nil, got '%s'", msg.Key)
+		}
 
-			if err := b.Set(ctx, "test", []byte("test2")); err != nil {
-				t.Fatal(err)
-			}
+		if msg.Key != test.Key {
+			t.Fatalf("expected key to be '%s', got '%s'", test.Key, msg.Key)
+		}
 
-			if err := b.Delete(ctx, "test"); err != nil {
-				t.Fatal(err)
-			}
+		if string(msg.Value) != string(test.Value) {
+			t.Fatalf("expected value to be '%s', got '%s'", string(test.Value), string(msg.Value))
+		}
 
-			if err := b.Set(ctx, "test", []byte("test3")); err != nil {
-				t.Fatal(err)
-			}
-		})
-	})
+		if msg.Operation != test.Operation {
+			t.Fatalf("expected operation to be %d, got %d", test.Operation, msg.Operation)
+		}
+	}
 }
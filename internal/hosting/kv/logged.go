@@ -26,6 +26,10 @@ func (l *Logged) Bucket(ctx context.Context, name string) (Bucket, error) {
 	}, nil
 }
 
+func (l *Logged) ListBuckets(ctx context.Context) ([]string, error) {
+	return l.c.ListBuckets(ctx)
+}
+
 var _ Bucket = &LoggedBucket{}
 
 type LoggedBucket struct {
@@ -45,6 +49,11 @@ func (b *LoggedBucket) Set(ctx context.Context, key string, value []byte) error
 	return b.b.Set(ctx, key, value)
 }
 
+func (b *LoggedBucket) Create(ctx context.Context, key string, value []byte) error {
+	log.Printf("Create %s/%s", b.Name(), key)
+	return Create(ctx, b.b, key, value)
+}
+
 func (b *LoggedBucket) Delete(ctx context.Context, key string) error {
 	log.Printf("Delete %s/%s", b.Name(), key)
 	return b.b.Delete(ctx, key)
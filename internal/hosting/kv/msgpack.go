@@ -0,0 +1,332 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MsgPack stores values as MessagePack. Integers keep their full range,
+// numbers with a fraction or exponent become float64.
+var MsgPack Encoding = msgPack{}
+
+type msgPack struct{}
+
+func (msgPack) Name() string {
+	return "msgpack"
+}
+
+func (msgPack) ID() byte {
+	return 1
+}
+
+func (msgPack) Encode(value []byte) ([]byte, error) {
+	v, err := parseJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeMsgPack(buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (msgPack) Decode(data []byte) ([]byte, error) {
+	r := &msgPackReader{data: data}
+
+	v, err := r.value()
+	if err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+
+	if r.pos != len(data) {
+		return nil, errors.New("msgpack: trailing data after value")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeMsgPack(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			writeMsgPackInt(buf, i)
+		} else if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			buf.WriteByte(0xcf)
+			buf.Write(binary.BigEndian.AppendUint64(nil, u))
+		} else if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			buf.WriteByte(0xcb)
+			buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+		} else {
+			return fmt.Errorf("msgpack: invalid number %s", v)
+		}
+
+	case string:
+		switch n := len(v); {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+		default:
+			buf.WriteByte(0xdb)
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+		}
+		buf.WriteString(v)
+
+	case []any:
+		writeMsgPackHeader(buf, len(v), 0x90, 0xdc)
+		for _, e := range v {
+			if err := writeMsgPack(buf, e); err != nil {
+				return err
+			}
+		}
+
+	case jsonObject:
+		writeMsgPackHeader(buf, len(v), 0x80, 0xde)
+		for _, m := range v {
+			if err := writeMsgPack(buf, m.Key); err != nil {
+				return err
+			}
+			if err := writeMsgPack(buf, m.Value); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack: unexpected value %T", v)
+	}
+
+	return nil
+}
+
+func writeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		buf.WriteByte(byte(i))
+	case i >= -32 && i < 0:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.Write([]byte{0xd0, byte(int8(i))})
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(int16(i))))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(int32(i))))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+// writeMsgPackHeader writes the header of an array or map, fix is the
+// prefix of the 4 bit form and wide the one of the 16 bit form, the 32 bit
+// form follows it.
+func writeMsgPackHeader(buf *bytes.Buffer, n int, fix, wide byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(wide)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(wide + 1)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+type msgPackReader struct {
+	data []byte
+	pos  int
+}
+
+var errMsgPackShort = errors.New("unexpected end of value")
+
+func (r *msgPackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, errMsgPackShort
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+
+	return b, nil
+}
+
+func (r *msgPackReader) uint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (r *msgPackReader) value() (any, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := b[0]; {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xe0 == 0xa0:
+		return r.str(int(t & 0x1f))
+	case t&0xf0 == 0x90:
+		return r.array(int(t & 0x0f))
+	case t&0xf0 == 0x80:
+		return r.object(int(t & 0x0f))
+	}
+
+	switch t := b[0]; t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.uint(1 << (t - 0xcc))
+
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (t - 0xd0)
+		u, err := r.uint(n)
+		if err != nil {
+			return nil, err
+		}
+
+		// Sign extend from n bytes
+		shift := 64 - 8*n
+		return int64(u<<shift) >> shift, nil
+
+	case 0xca:
+		u, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := r.uint(8)
+		return math.Float64frombits(u), err
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (t - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(int(n))
+
+	case 0xc4, 0xc5, 0xc6:
+		// Binary has no JSON form, []byte marshals as base64
+		n, err := r.uint(1 << (t - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := r.next(int(n))
+		return base64.StdEncoding.EncodeToString(data), err
+
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (t - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.array(int(n))
+
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (t - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.object(int(n))
+
+	default:
+		return nil, fmt.Errorf("unsupported type 0x%02x", t)
+	}
+}
+
+func (r *msgPackReader) str(n int) (string, error) {
+	b, err := r.next(n)
+	return string(b), err
+}
+
+func (r *msgPackReader) array(n int) ([]any, error) {
+	// Every element takes at least a byte, don't trust n further
+	if n > len(r.data)-r.pos {
+		return nil, errMsgPackShort
+	}
+
+	arr := make([]any, 0, n)
+	for range n {
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+
+	return arr, nil
+}
+
+func (r *msgPackReader) object(n int) (jsonObject, error) {
+	if 2*n > len(r.data)-r.pos {
+		return nil, errMsgPackShort
+	}
+
+	obj := make(jsonObject, 0, n)
+	for range n {
+		k, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key %T is not a string", k)
+		}
+
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, jsonMember{Key: key, Value: v})
+	}
+
+	return obj, nil
+}
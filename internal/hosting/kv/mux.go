@@ -0,0 +1,326 @@
+package kv
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var _ Client = &Muxed{}
+
+// Muxed shares one watcher per bucket between everyone watching it, instead
+// of every WatchAll opening a watcher (a JetStream consumer for NATS) of its
+// own. The shared watcher is opened with the first subscriber and closed with
+// the last one.
+type Muxed struct {
+	c       Client
+	buckets map[string]*MuxedBucket
+	m       sync.Mutex
+}
+
+func WithMux(c Client) *Muxed {
+	return &Muxed{c: c, buckets: make(map[string]*MuxedBucket)}
+}
+
+func (c *Muxed) Bucket(ctx context.Context, name string) (Bucket, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if b, exists := c.buckets[name]; exists {
+		return b, nil
+	}
+
+	b, err := c.c.Bucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	mb := &MuxedBucket{b: b}
+	c.buckets[name] = mb
+
+	return mb, nil
+}
+
+func (c *Muxed) ListBuckets(ctx context.Context) ([]string, error) {
+	return c.c.ListBuckets(ctx)
+}
+
+type FeedState struct {
+	Bucket      string `json:"bucket"`
+	Subscribers int    `json:"subscribers"`
+	Keys        int    `json:"keys"`
+}
+
+// Feeds returns the shared watchers that are open.
+func (c *Muxed) Feeds() []FeedState {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	states := make([]FeedState, 0)
+	for _, b := range c.buckets {
+		b.m.Lock()
+		if b.feed != nil {
+			states = append(states, FeedState{Bucket: b.Name(), Subscribers: len(b.feed.subs), Keys: len(b.feed.values)})
+		}
+		b.m.Unlock()
+	}
+
+	slices.SortFunc(states, func(a, b FeedState) int {
+		return strings.Compare(a.Bucket, b.Bucket)
+	})
+
+	return states
+}
+
+var (
+	_ Bucket        = &MuxedBucket{}
+	_ FilterWatcher = &MuxedBucket{}
+)
+
+type MuxedBucket struct {
+	b    Bucket
+	feed *muxFeed
+	m    sync.Mutex
+}
+
+// muxFeed is a shared watcher. It keeps the latest value of every key, so
+// subscribers joining later get a replay without a watcher of their own.
+type muxFeed struct {
+	w        Watcher
+	subs     map[*MuxWatcher]struct{}
+	values   map[string][]byte
+	replayed bool
+}
+
+func (b *MuxedBucket) Name() string {
+	return b.b.Name()
+}
+
+func (b *MuxedBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	return b.b.Get(ctx, key)
+}
+
+func (b *MuxedBucket) Set(ctx context.Context, key string, value []byte) error {
+	return b.b.Set(ctx, key, value)
+}
+
+func (b *MuxedBucket) Create(ctx context.Context, key string, value []byte) error {
+	return Create(ctx, b.b, key, value)
+}
+
+func (b *MuxedBucket) Delete(ctx context.Context, key string) error {
+	return b.b.Delete(ctx, key)
+}
+
+func (b *MuxedBucket) ListKeys(ctx context.Context) ([]string, error) {
+	return b.b.ListKeys(ctx)
+}
+
+func (b *MuxedBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	return b.WatchFiltered(ctx, nil)
+}
+
+func (b *MuxedBucket) WatchFiltered(ctx context.Context, f Filter) (Watcher, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.feed == nil {
+		// The feed outlives the subscriber that opened it
+		w, err := b.b.WatchAll(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		b.feed = &muxFeed{w: w, subs: make(map[*MuxWatcher]struct{}), values: make(map[string][]byte)}
+		go b.run(b.feed)
+	}
+
+	mw := &MuxWatcher{
+		b:       b,
+		feed:    b.feed,
+		f:       f,
+		changes: make(chan *Value),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	for key, value := range b.feed.values {
+		if mw.matches(key) {
+			mw.queue = append(mw.queue, &Value{Key: key, Value: value, Operation: Put})
+		}
+	}
+	if b.feed.replayed {
+		mw.queue = append(mw.queue, nil)
+	}
+
+	b.feed.subs[mw] = struct{}{}
+	go mw.forward()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			mw.Unwatch()
+		case <-mw.done:
+		}
+	}()
+
+	return mw, nil
+}
+
+func (b *MuxedBucket) Unwatch(w Watcher) {
+	w.Unwatch()
+}
+
+// run fans the changes of the feed out to its subscribers. When the shared
+// watcher closes, so do the subscribers, and the next WatchAll opens a new
+// one.
+func (b *MuxedBucket) run(feed *muxFeed) {
+	for v := range feed.w.Changes() {
+		b.m.Lock()
+
+		switch {
+		case v == nil:
+			feed.replayed = true
+		case v.Operation == Put:
+			feed.values[v.Key] = v.Value
+		case v.Operation == Delete:
+			delete(feed.values, v.Key)
+		}
+
+		for mw := range feed.subs {
+			if v == nil || mw.matches(v.Key) {
+				mw.push(v)
+			}
+		}
+
+		b.m.Unlock()
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.feed == feed {
+		b.feed = nil
+	}
+
+	for mw := range feed.subs {
+		mw.end()
+	}
+}
+
+func (b *MuxedBucket) unsubscribe(mw *MuxWatcher) {
+	b.m.Lock()
+
+	// The feed may have closed and been replaced since
+	feed := mw.feed
+	if b.feed != feed {
+		b.m.Unlock()
+		return
+	}
+
+	delete(feed.subs, mw)
+
+	last := len(feed.subs) == 0
+	if last {
+		b.feed = nil
+	}
+
+	b.m.Unlock()
+
+	// Outside the lock, the watcher may be blocked handing run a change
+	if last {
+		feed.w.Unwatch()
+	}
+}
+
+var _ Watcher = &MuxWatcher{}
+
+// MuxWatcher is a subscriber of a shared watcher. Changes are queued for it,
+// so a slow subscriber doesn't hold up the others.
+type MuxWatcher struct {
+	b       *MuxedBucket
+	feed    *muxFeed
+	f       Filter
+	changes chan *Value
+
+	queue []*Value
+	ended bool
+	m     sync.Mutex
+	wake  chan struct{}
+
+	done chan struct{}
+	once sync.Once
+}
+
+func (w *MuxWatcher) matches(key string) bool {
+	return w.f == nil || w.f(key)
+}
+
+func (w *MuxWatcher) push(v *Value) {
+	w.m.Lock()
+	w.queue = append(w.queue, v)
+	w.m.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// end closes the subscriber once it delivered the queued changes.
+func (w *MuxWatcher) end() {
+	w.m.Lock()
+	w.ended = true
+	w.m.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *MuxWatcher) forward() {
+	defer close(w.changes)
+
+	for {
+		w.m.Lock()
+		if len(w.queue) == 0 {
+			ended := w.ended
+			w.m.Unlock()
+
+			if ended {
+				return
+			}
+
+			select {
+			case <-w.wake:
+			case <-w.done:
+				return
+			}
+			continue
+		}
+
+		v := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		w.m.Unlock()
+
+		select {
+		case w.changes <- v:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *MuxWatcher) Changes() <-chan *Value {
+	return w.changes
+}
+
+func (w *MuxWatcher) Unwatch() {
+	w.once.Do(func() {
+		close(w.done)
+		w.b.unsubscribe(w)
+	})
+}
@@ -0,0 +1,187 @@
+package kv
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+// countingClient counts the watchers opened on its buckets.
+type countingClient struct {
+	Client
+	watches atomic.Int32
+}
+
+func (c *countingClient) Bucket(ctx context.Context, name string) (Bucket, error) {
+	b, err := c.Client.Bucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingBucket{Bucket: b, c: c}, nil
+}
+
+type countingBucket struct {
+	Bucket
+	c *countingClient
+}
+
+func (b *countingBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	b.c.watches.Add(1)
+	return b.Bucket.WatchAll(ctx)
+}
+
+func TestMuxedKV(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testKV(ctx, t, WithMux(k))
+	testKVWatch(ctx, t, WithMux(k))
+}
+
+func next(t *testing.T, w Watcher) *Value {
+	t.Helper()
+
+	select {
+	case v, ok := <-w.Changes():
+		if !ok {
+			t.Fatal("watcher closed")
+		}
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a change")
+		return nil
+	}
+}
+
+func TestMuxSharesWatcher(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &countingClient{Client: k}
+	mux := WithMux(c)
+
+	b, err := mux.Bucket(ctx, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "enabled", []byte("true")); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := b.WatchAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := next(t, all); v == nil || v.Key != "enabled" {
+		t.Fatalf("expected the replay of enabled, got %v", v)
+	}
+	if v := next(t, all); v != nil {
+		t.Fatalf("expected the end of the replay, got %v", v)
+	}
+
+	// Joins after the replay, it gets one from the feed
+	players, err := WatchFiltered(ctx, b, Prefix("player."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := next(t, players); v != nil {
+		t.Fatalf("expected an empty replay, got %v", v)
+	}
+
+	if err := b.Set(ctx, "enabled", []byte("false")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set(ctx, "player.a", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := next(t, all); v == nil || v.Key != "enabled" || string(v.Value) != "false" {
+		t.Fatalf("expected enabled to change, got %v", v)
+	}
+	if v := next(t, all); v == nil || v.Key != "player.a" {
+		t.Fatalf("expected player.a, got %v", v)
+	}
+	if v := next(t, players); v == nil || v.Key != "player.a" {
+		t.Fatalf("expected only player.a, got %v", v)
+	}
+
+	if n := c.watches.Load(); n != 1 {
+		t.Errorf("opened %d watchers, want one shared", n)
+	}
+
+	if feeds := mux.Feeds(); len(feeds) != 1 || feeds[0].Subscribers != 2 || feeds[0].Keys != 2 {
+		t.Errorf("unexpected feeds %+v", feeds)
+	}
+
+	all.Unwatch()
+	players.Unwatch()
+
+	if _, ok := <-players.Changes(); ok {
+		t.Error("watcher still open after Unwatch")
+	}
+
+	if feeds := mux.Feeds(); len(feeds) != 0 {
+		t.Errorf("feed still open without subscribers: %+v", feeds)
+	}
+
+	again, err := b.WatchAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Unwatch()
+
+	if n := c.watches.Load(); n != 2 {
+		t.Errorf("opened %d watchers, want a new one after the last unsubscribed", n)
+	}
+}
+
+func TestMuxUnwatchOnCancel(t *testing.T) {
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := WithMux(k)
+
+	b, err := mux.Bucket(context.Background(), "cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w, err := b.WatchAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := next(t, w); v != nil {
+		t.Fatalf("expected an empty replay, got %v", v)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-w.Changes():
+		if ok {
+			t.Fatal("got a change after cancelling")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher not closed after cancelling")
+	}
+}
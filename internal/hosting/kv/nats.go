@@ -14,6 +14,9 @@ var _ Client = &NATSClient{}
 
 type NATSOptions struct {
 	URL string `json:"url"`
+	// RetryOnFailedConnect lets the proxy start while NATS is down, with
+	// snapshotted buckets served from their snapshot until it comes up
+	RetryOnFailedConnect bool `json:"retryOnFailedConnect"`
 }
 
 type NATSClient struct {
@@ -42,6 +45,21 @@ func (n *NATSClient) Bucket(ctx context.Context, name string) (Bucket, error) {
 	}, nil
 }
 
+func (n *NATSClient) ListBuckets(ctx context.Context) ([]string, error) {
+	lister := n.js.KeyValueStoreNames(ctx)
+
+	names := make([]string, 0)
+	for name := range lister.Name() {
+		names = append(names, name)
+	}
+
+	if err := lister.Error(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
 var _ Bucket = &NATSBucket{}
 
 type NATSBucket struct {
@@ -75,6 +93,16 @@ func (b *NATSBucket) Set(ctx context.Context, key string, value []byte) error {
 	return nil
 }
 
+func (b *NATSBucket) Create(ctx context.Context, key string, value []byte) error {
+	if _, err := b.kv.Create(ctx, key, value); errors.Is(err, jetstream.ErrKeyExists) {
+		return ErrKeyExists
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (b *NATSBucket) Delete(ctx context.Context, key string) error {
 	if err := b.kv.Delete(ctx, key); err != nil {
 		return err
@@ -107,15 +135,21 @@ func (b *NATSBucket) WatchAll(ctx context.Context) (Watcher, error) {
 		bucket:  b,
 		w:       watcher,
 		changes: make(chan *Value),
+		done:    make(chan struct{}),
 	}
 
 	go func() {
+		// The updates channel is closed when the watcher is stopped or the
+		// subscription is lost, e.g. because the NATS server restarted.
+		// Closing changes lets consumers notice and re-establish the watch.
+		defer close(w.changes)
+
 		for msg := range watcher.Updates() {
 			if msg == nil {
-				w.m.Lock()
 				log.Printf("sending nil change")
-				w.changes <- nil
-				w.m.Unlock()
+				if !w.send(nil) {
+					return
+				}
 				continue
 			}
 
@@ -129,14 +163,14 @@ func (b *NATSBucket) WatchAll(ctx context.Context) (Watcher, error) {
 				continue
 			}
 
-			w.m.Lock()
 			log.Printf("sending %s change for %s", op, msg.Key())
-			w.changes <- &Value{
+			if !w.send(&Value{
 				Key:       msg.Key(),
 				Value:     msg.Value(),
 				Operation: op,
+			}) {
+				return
 			}
-			w.m.Unlock()
 		}
 
 		log.Printf("watcher stopped")
@@ -170,7 +204,17 @@ type NATSWatcher struct {
 	bucket  *NATSBucket
 	w       jetstream.KeyWatcher
 	changes chan *Value
-	m       sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (w *NATSWatcher) send(v *Value) bool {
+	select {
+	case w.changes <- v:
+		return true
+	case <-w.done:
+		return false
+	}
 }
 
 func (w *NATSWatcher) Changes() <-chan *Value {
@@ -178,9 +222,8 @@ func (w *NATSWatcher) Changes() <-chan *Value {
 }
 
 func (w *NATSWatcher) Unwatch() {
-	w.m.Lock()
-	defer w.m.Unlock()
-
-	close(w.changes)
-	w.bucket.Unwatch(w)
+	w.once.Do(func() {
+		close(w.done)
+		w.bucket.Unwatch(w)
+	})
 }
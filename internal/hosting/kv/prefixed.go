@@ -0,0 +1,51 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrForeignBucket = errors.New("bucket belongs to another network")
+
+var _ Client = &Prefixed{}
+
+// Prefixed only opens the buckets whose name starts with prefix, so a network
+// can't reach the buckets of another one by accident.
+type Prefixed struct {
+	c      Client
+	prefix string
+}
+
+func WithPrefix(c Client, prefix string) *Prefixed {
+	return &Prefixed{c: c, prefix: prefix}
+}
+
+func (c *Prefixed) Prefix() string {
+	return c.prefix
+}
+
+func (c *Prefixed) Bucket(ctx context.Context, name string) (Bucket, error) {
+	if !strings.HasPrefix(name, c.prefix) {
+		return nil, fmt.Errorf("%s: %w", name, ErrForeignBucket)
+	}
+
+	return c.c.Bucket(ctx, name)
+}
+
+func (c *Prefixed) ListBuckets(ctx context.Context) ([]string, error) {
+	buckets, err := c.c.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	own := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		if strings.HasPrefix(b, c.prefix) {
+			own = append(own, b)
+		}
+	}
+
+	return own, nil
+}
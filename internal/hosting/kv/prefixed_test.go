@@ -0,0 +1,44 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func TestPrefixedKV(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"csmc_ns_a_whitelist", "csmc_ns_b_whitelist"} {
+		if _, err := k.Bucket(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := WithPrefix(k, "csmc_ns_a_")
+
+	if _, err := a.Bucket(ctx, "csmc_ns_a_whitelist"); err != nil {
+		t.Errorf("own bucket: %v", err)
+	}
+
+	if _, err := a.Bucket(ctx, "csmc_ns_b_whitelist"); !errors.Is(err, ErrForeignBucket) {
+		t.Errorf("got %v for the bucket of another network", err)
+	}
+
+	buckets, err := a.ListBuckets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(buckets, []string{"csmc_ns_a_whitelist"}) {
+		t.Errorf("listed %v", buckets)
+	}
+}
@@ -0,0 +1,272 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Protobuf stores values as a google.protobuf.Value message, so other
+// services can read them with the well-known types. Like in JavaScript every
+// number is a double, integers beyond 2^53 lose precision.
+var Protobuf Encoding = protobuf{}
+
+type protobuf struct{}
+
+func (protobuf) Name() string {
+	return "protobuf"
+}
+
+func (protobuf) ID() byte {
+	return 2
+}
+
+// Fields of google.protobuf.Value, Struct and ListValue
+const (
+	pbNullValue   = 1
+	pbNumberValue = 2
+	pbStringValue = 3
+	pbBoolValue   = 4
+	pbStructValue = 5
+	pbListValue   = 6
+
+	pbStructFields = 1
+	pbEntryKey     = 1
+	pbEntryValue   = 2
+	pbListValues   = 1
+)
+
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+func (protobuf) Encode(value []byte) ([]byte, error) {
+	v, err := parseJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendPBValue(nil, v)
+}
+
+func appendPBTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendPBBytes(b []byte, field int, data []byte) []byte {
+	b = appendPBTag(b, field, pbBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendPBValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		b = appendPBTag(b, pbNullValue, pbVarint)
+		b = append(b, 0)
+
+	case bool:
+		b = appendPBTag(b, pbBoolValue, pbVarint)
+		if v {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("protobuf: invalid number %s", v)
+		}
+
+		b = appendPBTag(b, pbNumberValue, pbFixed64)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+
+	case string:
+		b = appendPBBytes(b, pbStringValue, []byte(v))
+
+	case []any:
+		list := []byte{}
+		for _, e := range v {
+			ev, err := appendPBValue(nil, e)
+			if err != nil {
+				return nil, err
+			}
+			list = appendPBBytes(list, pbListValues, ev)
+		}
+		b = appendPBBytes(b, pbListValue, list)
+
+	case jsonObject:
+		st := []byte{}
+		for _, m := range v {
+			mv, err := appendPBValue(nil, m.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			entry := appendPBBytes(nil, pbEntryKey, []byte(m.Key))
+			entry = appendPBBytes(entry, pbEntryValue, mv)
+			st = appendPBBytes(st, pbStructFields, entry)
+		}
+		b = appendPBBytes(b, pbStructValue, st)
+
+	default:
+		return nil, fmt.Errorf("protobuf: unexpected value %T", v)
+	}
+
+	return b, nil
+}
+
+func (protobuf) Decode(data []byte) ([]byte, error) {
+	v, err := readPBValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+var errPBShort = errors.New("unexpected end of message")
+
+// pbFields calls fn for every field of the message. data holds the payload
+// of length delimited fields and is nil for the others, whose value is in n.
+func pbFields(msg []byte, fn func(field int, n uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		tag, l := binary.Uvarint(msg)
+		if l <= 0 {
+			return errPBShort
+		}
+		msg = msg[l:]
+
+		field, wire := int(tag>>3), int(tag&7)
+
+		var n uint64
+		var data []byte
+
+		switch wire {
+		case pbVarint:
+			n, l = binary.Uvarint(msg)
+			if l <= 0 {
+				return errPBShort
+			}
+			msg = msg[l:]
+
+		case pbFixed64:
+			if len(msg) < 8 {
+				return errPBShort
+			}
+			n, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+
+		case pbFixed32:
+			if len(msg) < 4 {
+				return errPBShort
+			}
+			n, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+
+		case pbBytes:
+			size, l := binary.Uvarint(msg)
+			if l <= 0 || size > uint64(len(msg)-l) {
+				return errPBShort
+			}
+			data, msg = msg[l:l+int(size)], msg[l+int(size):]
+
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+
+		if err := fn(field, n, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readPBValue(msg []byte) (any, error) {
+	// An empty Value has no kind set, treat it like null
+	var v any
+
+	err := pbFields(msg, func(field int, n uint64, data []byte) error {
+		var err error
+
+		switch field {
+		case pbNullValue:
+			v = nil
+		case pbNumberValue:
+			v = math.Float64frombits(n)
+			if f := v.(float64); math.Trunc(f) == f && math.Abs(f) < 1<<63 {
+				v = int64(f)
+			}
+		case pbStringValue:
+			v = string(data)
+		case pbBoolValue:
+			v = n != 0
+		case pbStructValue:
+			v, err = readPBStruct(data)
+		case pbListValue:
+			v, err = readPBList(data)
+		}
+
+		return err
+	})
+
+	return v, err
+}
+
+func readPBStruct(msg []byte) (jsonObject, error) {
+	obj := make(jsonObject, 0)
+
+	err := pbFields(msg, func(field int, _ uint64, data []byte) error {
+		if field != pbStructFields {
+			return nil
+		}
+
+		m := jsonMember{}
+		err := pbFields(data, func(field int, _ uint64, data []byte) error {
+			var err error
+
+			switch field {
+			case pbEntryKey:
+				m.Key = string(data)
+			case pbEntryValue:
+				m.Value, err = readPBValue(data)
+			}
+
+			return err
+		})
+		obj = append(obj, m)
+
+		return err
+	})
+
+	return obj, err
+}
+
+func readPBList(msg []byte) ([]any, error) {
+	list := make([]any, 0)
+
+	err := pbFields(msg, func(field int, _ uint64, data []byte) error {
+		if field != pbListValues {
+			return nil
+		}
+
+		v, err := readPBValue(data)
+		list = append(list, v)
+
+		return err
+	})
+
+	return list, err
+}
@@ -0,0 +1,195 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits a bucket, 0 is unlimited.
+type Quota struct {
+	MaxKeys  int   `json:"maxKeys"`
+	MaxBytes int64 `json:"maxBytes"`
+}
+
+type Usage struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+var _ Bucket = &QuotaBucket{}
+
+// QuotaBucket rejects writes that would take the bucket over its quota with
+// ErrQuotaExceeded. The usage is loaded from the bucket on first use and then
+// counted from the writes through it, a write that would exceed the quota
+// reloads it first in case other proxies deleted keys.
+type QuotaBucket struct {
+	b     Bucket
+	quota Quota
+
+	sizes  map[string]int64
+	bytes  int64
+	loaded bool
+	m      sync.Mutex
+}
+
+func WithQuota(b Bucket, q Quota) *QuotaBucket {
+	return &QuotaBucket{b: b, quota: q}
+}
+
+func (b *QuotaBucket) Name() string {
+	return b.b.Name()
+}
+
+func (b *QuotaBucket) Quota() Quota {
+	return b.quota
+}
+
+func (b *QuotaBucket) Usage(ctx context.Context) (Usage, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if err := b.load(ctx, false); err != nil {
+		return Usage{}, err
+	}
+
+	return Usage{Keys: len(b.sizes), Bytes: b.bytes}, nil
+}
+
+// load must be called with b.m held.
+func (b *QuotaBucket) load(ctx context.Context, force bool) error {
+	if b.loaded && !force {
+		return nil
+	}
+
+	keys, err := b.b.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[string]int64, len(keys))
+	total := int64(0)
+	for _, key := range keys {
+		v, err := b.b.Get(ctx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		sizes[key] = int64(len(v))
+		total += int64(len(v))
+	}
+
+	b.sizes, b.bytes, b.loaded = sizes, total, true
+
+	return nil
+}
+
+func (b *QuotaBucket) exceeds(key string, size int64) error {
+	old, exists := b.sizes[key]
+
+	if !exists && b.quota.MaxKeys > 0 && len(b.sizes)+1 > b.quota.MaxKeys {
+		return fmt.Errorf("%s: %w: more than %d keys", b.Name(), ErrQuotaExceeded, b.quota.MaxKeys)
+	}
+
+	if b.quota.MaxBytes > 0 && b.bytes-old+size > b.quota.MaxBytes {
+		return fmt.Errorf("%s: %w: more than %d bytes", b.Name(), ErrQuotaExceeded, b.quota.MaxBytes)
+	}
+
+	return nil
+}
+
+func (b *QuotaBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	return b.b.Get(ctx, key)
+}
+
+func (b *QuotaBucket) Set(ctx context.Context, key string, value []byte) error {
+	return b.write(ctx, key, value, b.b.Set)
+}
+
+func (b *QuotaBucket) Create(ctx context.Context, key string, value []byte) error {
+	return b.write(ctx, key, value, func(ctx context.Context, key string, value []byte) error {
+		return Create(ctx, b.b, key, value)
+	})
+}
+
+func (b *QuotaBucket) write(ctx context.Context, key string, value []byte, set func(ctx context.Context, key string, value []byte) error) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if err := b.load(ctx, false); err != nil {
+		return err
+	}
+
+	size := int64(len(value))
+	if err := b.exceeds(key, size); err != nil {
+		if err := b.load(ctx, true); err != nil {
+			return err
+		}
+
+		if err := b.exceeds(key, size); err != nil {
+			return err
+		}
+	}
+
+	if err := set(ctx, key, value); err != nil {
+		return err
+	}
+
+	b.bytes += size - b.sizes[key]
+	b.sizes[key] = size
+
+	return nil
+}
+
+func (b *QuotaBucket) Delete(ctx context.Context, key string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if err := b.b.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	if b.loaded {
+		b.bytes -= b.sizes[key]
+		delete(b.sizes, key)
+	}
+
+	return nil
+}
+
+func (b *QuotaBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	return b.b.WatchAll(ctx)
+}
+
+func (b *QuotaBucket) WatchFiltered(ctx context.Context, f Filter) (Watcher, error) {
+	return WatchFiltered(ctx, b.b, f)
+}
+
+func (b *QuotaBucket) Unwatch(w Watcher) {
+	b.b.Unwatch(w)
+}
+
+func (b *QuotaBucket) ListKeys(ctx context.Context) ([]string, error) {
+	return b.b.ListKeys(ctx)
+}
+
+// Wipe deletes every key of the bucket.
+func (b *QuotaBucket) Wipe(ctx context.Context) (int, error) {
+	keys, err := b.ListKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, key := range keys {
+		if err := b.Delete(ctx, key); err != nil {
+			return i, err
+		}
+	}
+
+	return len(keys), nil
+}
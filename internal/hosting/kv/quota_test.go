@@ -0,0 +1,77 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func TestQuotaKV(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner, err := k.Bucket(ctx, "quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Counted when the usage is loaded
+	if err := inner.Set(ctx, "existing", []byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := WithQuota(inner, Quota{MaxKeys: 2, MaxBytes: 10})
+
+	if err := b.Set(ctx, "a", []byte("12345")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "b", []byte("1")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got %v, want the key count exceeded", err)
+	}
+
+	if err := b.Set(ctx, "a", []byte("1234567")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got %v, want the size exceeded", err)
+	}
+
+	// Overwriting only counts the difference
+	if err := b.Set(ctx, "a", []byte("123456")); err != nil {
+		t.Fatal(err)
+	}
+
+	if usage, err := b.Usage(ctx); err != nil {
+		t.Fatal(err)
+	} else if usage != (Usage{Keys: 2, Bytes: 10}) {
+		t.Errorf("got usage %+v, want 2 keys and 10 bytes", usage)
+	}
+
+	// Deleted by someone else, the usage is reloaded before rejecting
+	if err := inner.Delete(ctx, "existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "b", []byte("1")); err != nil {
+		t.Errorf("got %v after freeing a key", err)
+	}
+
+	deleted, err := b.Wipe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("wiped %d keys, want 2", deleted)
+	}
+
+	if usage, err := b.Usage(ctx); err != nil {
+		t.Fatal(err)
+	} else if usage != (Usage{}) {
+		t.Errorf("got usage %+v after wiping", usage)
+	}
+}
@@ -0,0 +1,64 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// loadTimeout bounds a shared lookup, it doesn't end with the context of
+// the caller that started it.
+const loadTimeout = 30 * time.Second
+
+type call struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+// singleflight collapses concurrent lookups of the same key into one backend
+// round trip.
+type singleflight struct {
+	calls map[string]*call
+	m     sync.Mutex
+}
+
+// do runs fn once for the concurrent callers with the same key. fn gets a
+// context that isn't cancelled with the caller's, so one caller giving up
+// doesn't fail the others; each caller still returns once its own ctx is
+// done.
+func (g *singleflight) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	g.m.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+
+		go g.run(context.WithoutCancel(ctx), key, c, fn)
+	}
+	g.m.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *singleflight) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) ([]byte, error)) {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+
+	c.val, c.err = fn(ctx)
+
+	g.m.Lock()
+	delete(g.calls, key)
+	g.m.Unlock()
+
+	close(c.done)
+}
@@ -0,0 +1,62 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleflightCallerCancels(t *testing.T) {
+	g := singleflight{}
+	release := make(chan struct{})
+	calls := atomic.Int32{}
+
+	load := func(ctx context.Context) ([]byte, error) {
+		calls.Add(1)
+
+		select {
+		case <-release:
+			return []byte("value"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := g.do(ctx, "key", load)
+		first <- err
+	}()
+
+	// The second caller joins the load the first one started
+	second := make(chan []byte)
+	go func() {
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		v, _ := g.do(context.Background(), "key", load)
+		second <- v
+	}()
+
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the first caller to give up, got %v", err)
+	}
+
+	close(release)
+	if v := <-second; string(v) != "value" {
+		t.Fatalf("expected the second caller to get the value, got %q", v)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected one load, got %d", n)
+	}
+}
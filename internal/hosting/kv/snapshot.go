@@ -0,0 +1,405 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+var _ Client = &Snapshots{}
+
+// Snapshots keeps a copy of some buckets in a storage, the local disk in
+// production. While the backend is unreachable their reads are served from
+// the copy, even if a bucket couldn't be opened at all because the proxy
+// started during the outage. Writes still need the backend.
+type Snapshots struct {
+	c    Client
+	strg storage.Storage
+	// buckets are bucket names, or their last part after "_", to keep a copy
+	// of. "*" matches every bucket.
+	buckets []string
+
+	opened map[string]*SnapshotBucket
+	m      sync.Mutex
+}
+
+func WithSnapshots(c Client, strg storage.Storage, buckets []string) *Snapshots {
+	return &Snapshots{c: c, strg: strg, buckets: buckets, opened: make(map[string]*SnapshotBucket)}
+}
+
+func (c *Snapshots) snapshotted(bucket string) bool {
+	if slices.Contains(c.buckets, bucket) || slices.Contains(c.buckets, "*") {
+		return true
+	}
+
+	i := strings.LastIndexByte(bucket, '_')
+	return i >= 0 && slices.Contains(c.buckets, bucket[i+1:])
+}
+
+func (c *Snapshots) Bucket(ctx context.Context, name string) (Bucket, error) {
+	if !c.snapshotted(name) {
+		return c.c.Bucket(ctx, name)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if b, exists := c.opened[name]; exists {
+		return b, nil
+	}
+
+	sb := &SnapshotBucket{name: name, c: c.c, strg: c.strg}
+
+	b, err := c.c.Bucket(ctx, name)
+	if err != nil {
+		// Without a copy there is nothing to fall back to
+		if loadErr := sb.load(ctx); loadErr != nil {
+			return nil, err
+		}
+
+		log.Printf("Failed to open bucket %s, serving reads from its snapshot of %s: %v", name, sb.saved.Format(time.RFC3339), err)
+		sb.offline = true
+	} else {
+		sb.b = b
+
+		go func() {
+			if err := sb.Snapshot(context.Background()); err != nil {
+				log.Printf("Failed to snapshot bucket %s: %v", name, err)
+			}
+		}()
+	}
+
+	c.opened[name] = sb
+
+	return sb, nil
+}
+
+func (c *Snapshots) ListBuckets(ctx context.Context) ([]string, error) {
+	return c.c.ListBuckets(ctx)
+}
+
+// Snapshot saves a fresh copy of every opened bucket.
+func (c *Snapshots) Snapshot(ctx context.Context) error {
+	c.m.Lock()
+	buckets := make([]*SnapshotBucket, 0, len(c.opened))
+	for _, b := range c.opened {
+		buckets = append(buckets, b)
+	}
+	c.m.Unlock()
+
+	var errs []error
+	for _, b := range buckets {
+		if err := b.Snapshot(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run saves a copy of every opened bucket each interval until ctx is done.
+func (c *Snapshots) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Snapshot(ctx); err != nil {
+			log.Printf("Failed to snapshot KV: %v", err)
+		}
+	}
+}
+
+type SnapshotState struct {
+	Bucket  string    `json:"bucket"`
+	Keys    int       `json:"keys"`
+	Saved   time.Time `json:"saved"`
+	Offline bool      `json:"offline"`
+}
+
+// States returns the snapshot of every opened bucket, sorted by name.
+func (c *Snapshots) States() []SnapshotState {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	states := make([]SnapshotState, 0, len(c.opened))
+	for _, b := range c.opened {
+		b.m.Lock()
+		states = append(states, SnapshotState{Bucket: b.name, Keys: len(b.values), Saved: b.saved, Offline: b.offline})
+		b.m.Unlock()
+	}
+
+	slices.SortFunc(states, func(a, b SnapshotState) int {
+		return strings.Compare(a.Bucket, b.Bucket)
+	})
+
+	return states
+}
+
+var _ Bucket = &SnapshotBucket{}
+
+type SnapshotBucket struct {
+	name string
+	c    Client
+	strg storage.Storage
+
+	// b is nil until the bucket could be opened
+	b       Bucket
+	values  map[string][]byte
+	saved   time.Time
+	offline bool
+	m       sync.Mutex
+}
+
+type snapshotFile struct {
+	Saved  time.Time         `json:"saved"`
+	Values map[string][]byte `json:"values"`
+}
+
+func (b *SnapshotBucket) key() string {
+	return b.name + ".json"
+}
+
+// load reads the copy from the storage, it must be called with the lock held
+// or before the bucket is shared.
+func (b *SnapshotBucket) load(ctx context.Context) error {
+	raw, err := b.strg.Read(ctx, b.key())
+	if err != nil {
+		return err
+	}
+
+	f := snapshotFile{}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return err
+	}
+
+	b.values, b.saved = f.Values, f.Saved
+	if b.values == nil {
+		b.values = make(map[string][]byte)
+	}
+
+	return nil
+}
+
+// backend returns the underlying bucket, opening it if the proxy started
+// without it.
+func (b *SnapshotBucket) backend(ctx context.Context) (Bucket, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.b != nil {
+		return b.b, nil
+	}
+
+	nb, err := b.c.Bucket(ctx, b.name)
+	if err != nil {
+		return nil, err
+	}
+
+	b.b = nb
+	return nb, nil
+}
+
+// fallback reports whether err is an outage the copy can stand in for.
+func (b *SnapshotBucket) fallback(err error) bool {
+	if err == nil || errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrKeyExists) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.values == nil {
+		if loadErr := b.load(context.Background()); loadErr != nil {
+			return false
+		}
+	}
+
+	if !b.offline {
+		log.Printf("Bucket %s is unreachable, serving reads from its snapshot of %s: %v", b.name, b.saved.Format(time.RFC3339), err)
+		b.offline = true
+	}
+
+	return true
+}
+
+// online is called after every successful operation, the first after an
+// outage refreshes the copy.
+func (b *SnapshotBucket) online() {
+	b.m.Lock()
+	reconnected := b.offline
+	b.offline = false
+	b.m.Unlock()
+
+	if reconnected {
+		log.Printf("Bucket %s is reachable again", b.name)
+
+		go func() {
+			if err := b.Snapshot(context.Background()); err != nil {
+				log.Printf("Failed to snapshot bucket %s: %v", b.name, err)
+			}
+		}()
+	}
+}
+
+func (b *SnapshotBucket) Name() string {
+	return b.name
+}
+
+func (b *SnapshotBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := b.get(ctx, key)
+	if !b.fallback(err) {
+		if err == nil || errors.Is(err, ErrKeyNotFound) {
+			b.online()
+		}
+		return value, err
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	value, ok := b.values[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return value, nil
+}
+
+func (b *SnapshotBucket) get(ctx context.Context, key string) ([]byte, error) {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return nb.Get(ctx, key)
+}
+
+func (b *SnapshotBucket) ListKeys(ctx context.Context) ([]string, error) {
+	keys, err := b.listKeys(ctx)
+	if !b.fallback(err) {
+		if err == nil {
+			b.online()
+		}
+		return keys, err
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	keys = make([]string, 0, len(b.values))
+	for key := range b.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+func (b *SnapshotBucket) listKeys(ctx context.Context) ([]string, error) {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return nb.ListKeys(ctx)
+}
+
+func (b *SnapshotBucket) Set(ctx context.Context, key string, value []byte) error {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nb.Set(ctx, key, value)
+}
+
+func (b *SnapshotBucket) Create(ctx context.Context, key string, value []byte) error {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	return Create(ctx, nb, key, value)
+}
+
+func (b *SnapshotBucket) Delete(ctx context.Context, key string) error {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nb.Delete(ctx, key)
+}
+
+func (b *SnapshotBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := nb.WatchAll(ctx)
+	if err == nil {
+		b.online()
+	}
+
+	return w, err
+}
+
+func (b *SnapshotBucket) Unwatch(w Watcher) {
+	w.Unwatch()
+}
+
+// Snapshot saves a fresh copy of the bucket.
+func (b *SnapshotBucket) Snapshot(ctx context.Context) error {
+	nb, err := b.backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := nb.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := nb.Get(ctx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		values[key] = value
+	}
+
+	f := snapshotFile{Saved: time.Now(), Values: values}
+
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	if err := b.strg.Save(ctx, b.key(), raw); err != nil {
+		return err
+	}
+
+	b.m.Lock()
+	b.values, b.saved = f.Values, f.Saved
+	b.m.Unlock()
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func TestSnapshotFallback(t *testing.T) {
+	ctx := context.Background()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := faults.New("kv", faults.Config{})
+	disk := storage.NewMemory()
+
+	b, err := WithSnapshots(WithFaults(k, f), disk, []string{"whitelist"}).Bucket(ctx, "csmc_ns_net_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Set(ctx, "enabled", []byte("true")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(*SnapshotBucket).Snapshot(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Set(faults.Config{ErrorRate: 1})
+
+	if got, err := b.Get(ctx, "enabled"); err != nil || string(got) != "true" {
+		t.Errorf("got %s, %v from the snapshot", got, err)
+	}
+	if _, err := b.Get(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got %v for a key missing from the snapshot", err)
+	}
+	if keys, err := b.ListKeys(ctx); err != nil || len(keys) != 1 {
+		t.Errorf("got %v, %v from the snapshot", keys, err)
+	}
+	if err := b.Set(ctx, "enabled", []byte("false")); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("got %v, writes need the backend", err)
+	}
+
+	// A proxy starting during the outage opens the bucket from the snapshot
+	restarted, err := WithSnapshots(WithFaults(k, f), disk, []string{"whitelist"}).Bucket(ctx, "csmc_ns_net_whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := restarted.Get(ctx, "enabled"); err != nil || string(got) != "true" {
+		t.Errorf("got %s, %v after restarting", got, err)
+	}
+
+	if _, err := WithSnapshots(WithFaults(k, f), disk, []string{"whitelist"}).Bucket(ctx, "csmc_ns_net_permissions"); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("got %v for a bucket without snapshots", err)
+	}
+
+	f.Set(faults.Config{})
+
+	if err := restarted.Set(ctx, "enabled", []byte("false")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := restarted.Get(ctx, "enabled"); err != nil || !bytes.Equal(got, []byte("false")) {
+		t.Errorf("got %s, %v once reachable again", got, err)
+	}
+}
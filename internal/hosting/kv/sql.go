@@ -0,0 +1,559 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+var _ Client = &SQLClient{}
+
+type SQLOptions struct {
+	// Driver is the database/sql driver name, e.g. "postgres", "pgx", "mysql"
+	// or "sqlite". "postgres" uses pgx unless another driver registered it.
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+	// PollInterval controls how often watchers look for changes made by other
+	// proxies. Changes made through this client are delivered immediately.
+	PollInterval string `json:"pollInterval"`
+}
+
+type sqlDialect struct {
+	placeholder func(n int) string
+	blob        string
+	upsert      string
+}
+
+var (
+	questionPlaceholder = func(int) string { return "?" }
+	dollarPlaceholder   = func(n int) string { return fmt.Sprintf("$%d", n) }
+
+	mysqlDialect = sqlDialect{
+		placeholder: questionPlaceholder,
+		blob:        "LONGBLOB",
+		upsert:      "ON DUPLICATE KEY UPDATE value = VALUES(value)",
+	}
+	postgresDialect = sqlDialect{
+		placeholder: dollarPlaceholder,
+		blob:        "BYTEA",
+		upsert:      "ON CONFLICT (bucket, name) DO UPDATE SET value = excluded.value",
+	}
+	sqliteDialect = sqlDialect{
+		placeholder: questionPlaceholder,
+		blob:        "BLOB",
+		upsert:      "ON CONFLICT (bucket, name) DO UPDATE SET value = excluded.value",
+	}
+)
+
+func dialectFor(driver string) (sqlDialect, error) {
+	switch driver {
+	case "mysql":
+		return mysqlDialect, nil
+	case "postgres", "pgx":
+		return postgresDialect, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect, nil
+	default:
+		return sqlDialect{}, fmt.Errorf("unsupported SQL driver: %s", driver)
+	}
+}
+
+// sqlMigrations are applied in order and recorded in kv_schema_migrations.
+// Never edit an existing entry, append a new one instead.
+var sqlMigrations = []func(d sqlDialect) string{
+	func(d sqlDialect) string {
+		return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS kv_entries (
+	bucket VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	value %s NOT NULL,
+	PRIMARY KEY (bucket, name)
+)`, d.blob)
+	},
+}
+
+type SQLClient struct {
+	db           *sql.DB
+	d            sqlDialect
+	pollInterval time.Duration
+	buckets      map[string]*SQLBucket
+	m            sync.Mutex
+}
+
+func NewSQLClient(ctx context.Context, opts SQLOptions) (*SQLClient, error) {
+	d, err := dialectFor(opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	pollInterval := 5 * time.Second
+	if opts.PollInterval != "" {
+		pollInterval, err = time.ParseDuration(opts.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	driver := opts.Driver
+	if driver == "postgres" && !slices.Contains(sql.Drivers(), driver) {
+		driver = "pgx"
+	}
+
+	db, err := sql.Open(driver, opts.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+
+	c := &SQLClient{
+		db:           db,
+		d:            d,
+		pollInterval: pollInterval,
+		buckets:      make(map[string]*SQLBucket),
+	}
+
+	if err := c.migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *SQLClient) migrate(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS kv_schema_migrations (version INTEGER NOT NULL PRIMARY KEY)"); err != nil {
+		return err
+	}
+
+	var current int
+	if err := c.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM kv_schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(sqlMigrations); i++ {
+		version := i + 1
+		log.Printf("Applying SQL KV migration %d", version)
+
+		tx, err := c.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, sqlMigrations[i](c.d)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO kv_schema_migrations (version) VALUES ("+c.d.placeholder(1)+")", version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *SQLClient) Bucket(ctx context.Context, name string) (Bucket, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	b, exists := c.buckets[name]
+	if !exists {
+		b = &SQLBucket{
+			name:     name,
+			c:        c,
+			watchers: make([]*SQLWatcher, 0),
+		}
+		c.buckets[name] = b
+	}
+
+	return b, nil
+}
+
+// ListBuckets returns the buckets that currently hold at least one key.
+func (c *SQLClient) ListBuckets(ctx context.Context) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT DISTINCT bucket FROM kv_entries")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+var _ Bucket = &SQLBucket{}
+
+type SQLBucket struct {
+	name     string
+	c        *SQLClient
+	watchers []*SQLWatcher
+	m        sync.Mutex
+}
+
+func (b *SQLBucket) Name() string {
+	return b.name
+}
+
+func (b *SQLBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	q := fmt.Sprintf("SELECT value FROM kv_entries WHERE bucket = %s AND name = %s", b.c.d.placeholder(1), b.c.d.placeholder(2))
+
+	var v []byte
+	if err := b.c.db.QueryRowContext(ctx, q, b.name, key).Scan(&v); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (b *SQLBucket) Set(ctx context.Context, key string, value []byte) error {
+	q := fmt.Sprintf("INSERT INTO kv_entries (bucket, name, value) VALUES (%s, %s, %s) %s",
+		b.c.d.placeholder(1), b.c.d.placeholder(2), b.c.d.placeholder(3), b.c.d.upsert)
+
+	if _, err := b.c.db.ExecContext(ctx, q, b.name, key, value); err != nil {
+		return err
+	}
+
+	b.notify(&Value{Key: key, Value: value, Operation: Put})
+
+	return nil
+}
+
+// Create relies on the primary key, the errors of a conflict differ between
+// drivers so the key is looked up after a failed insert.
+func (b *SQLBucket) Create(ctx context.Context, key string, value []byte) error {
+	q := fmt.Sprintf("INSERT INTO kv_entries (bucket, name, value) VALUES (%s, %s, %s)",
+		b.c.d.placeholder(1), b.c.d.placeholder(2), b.c.d.placeholder(3))
+
+	if _, err := b.c.db.ExecContext(ctx, q, b.name, key, value); err != nil {
+		if _, gerr := b.Get(ctx, key); gerr == nil {
+			return ErrKeyExists
+		}
+
+		return err
+	}
+
+	b.notify(&Value{Key: key, Value: value, Operation: Put})
+
+	return nil
+}
+
+func (b *SQLBucket) Delete(ctx context.Context, key string) error {
+	q := fmt.Sprintf("DELETE FROM kv_entries WHERE bucket = %s AND name = %s", b.c.d.placeholder(1), b.c.d.placeholder(2))
+
+	res, err := b.c.db.ExecContext(ctx, q, b.name, key)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrKeyNotFound
+	}
+
+	b.notify(&Value{Key: key, Operation: Delete})
+
+	return nil
+}
+
+func (b *SQLBucket) ListKeys(ctx context.Context) ([]string, error) {
+	q := fmt.Sprintf("SELECT name FROM kv_entries WHERE bucket = %s", b.c.d.placeholder(1))
+
+	rows, err := b.c.db.QueryContext(ctx, q, b.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (b *SQLBucket) snapshot(ctx context.Context) (map[string][]byte, error) {
+	q := fmt.Sprintf("SELECT name, value FROM kv_entries WHERE bucket = %s", b.c.d.placeholder(1))
+
+	rows, err := b.c.db.QueryContext(ctx, q, b.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		data[key] = value
+	}
+
+	return data, rows.Err()
+}
+
+func (b *SQLBucket) notify(v *Value) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for _, w := range b.watchers {
+		w.local(v)
+	}
+}
+
+func (b *SQLBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	data, err := b.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &SQLWatcher{
+		bucket:  b,
+		last:    make(map[string][]byte),
+		touched: make(map[string]uint64),
+		changes: make(chan *Value),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	for k, v := range data {
+		w.apply(&Value{Key: k, Value: v, Operation: Put})
+	}
+	w.enqueue(nil)
+
+	b.m.Lock()
+	b.watchers = append(b.watchers, w)
+	b.m.Unlock()
+
+	go w.deliver()
+	go w.poll()
+
+	return w, nil
+}
+
+func (b *SQLBucket) Unwatch(w Watcher) {
+	w_, ok := w.(*SQLWatcher)
+	if !ok {
+		return
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.watchers = slices.DeleteFunc(b.watchers, func(w2 *SQLWatcher) bool {
+		return w_ == w2
+	})
+}
+
+var _ Watcher = &SQLWatcher{}
+
+// SQLWatcher emits local writes right away and polls the table to pick up
+// writes made by other proxies. It remembers the last value it emitted per
+// key so polling never repeats a change. Changes are queued and delivered by
+// their own goroutine, so a slow consumer, or one writing to the bucket from
+// its handler, never blocks the writes to the bucket.
+//
+// Local writes are numbered, a poll skips the keys written locally since it
+// started, its snapshot may predate them.
+type SQLWatcher struct {
+	bucket  *SQLBucket
+	last    map[string][]byte
+	pending []*Value
+	// rev counts the local writes, touched is the last one of every key
+	// written since the oldest running poll started
+	rev     uint64
+	touched map[string]uint64
+	changes chan *Value
+	// wake tells deliver that pending isn't empty
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once
+	m    sync.Mutex
+}
+
+// update records v and reports whether it changes what was emitted last.
+// The lock must be held.
+func (w *SQLWatcher) update(v *Value) bool {
+	prev, existed := w.last[v.Key]
+	switch v.Operation {
+	case Put:
+		if existed && bytes.Equal(prev, v.Value) {
+			return false
+		}
+		w.last[v.Key] = v.Value
+	case Delete:
+		if !existed {
+			return false
+		}
+		delete(w.last, v.Key)
+	}
+
+	return true
+}
+
+func (w *SQLWatcher) apply(v *Value) {
+	w.m.Lock()
+	if w.update(v) {
+		w.pending = append(w.pending, v)
+	}
+	w.m.Unlock()
+
+	w.signal()
+}
+
+// local applies a write of this proxy.
+func (w *SQLWatcher) local(v *Value) {
+	w.m.Lock()
+	w.rev++
+	w.touched[v.Key] = w.rev
+	if w.update(v) {
+		w.pending = append(w.pending, v)
+	}
+	w.m.Unlock()
+
+	w.signal()
+}
+
+func (w *SQLWatcher) enqueue(v *Value) {
+	w.m.Lock()
+	w.pending = append(w.pending, v)
+	w.m.Unlock()
+
+	w.signal()
+}
+
+func (w *SQLWatcher) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver is the only sender on changes and closes it once the watcher is
+// stopped.
+func (w *SQLWatcher) deliver() {
+	defer close(w.changes)
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		}
+
+		w.m.Lock()
+		pending := w.pending
+		w.pending = nil
+		w.m.Unlock()
+
+		for _, v := range pending {
+			select {
+			case w.changes <- v:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+func (w *SQLWatcher) poll() {
+	ticker := time.NewTicker(w.bucket.c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		w.m.Lock()
+		started := w.rev
+		w.m.Unlock()
+
+		data, err := w.bucket.snapshot(context.Background())
+		if err != nil {
+			log.Printf("Failed to poll SQL bucket %s: %v", w.bucket.name, err)
+			continue
+		}
+
+		w.sync(data, started)
+	}
+}
+
+// sync emits the difference to a snapshot of the table. Keys written
+// locally after rev started may be newer than the snapshot, they are skipped.
+func (w *SQLWatcher) sync(data map[string][]byte, started uint64) {
+	w.m.Lock()
+
+	changes := make([]*Value, 0)
+	for k, v := range data {
+		if w.touched[k] <= started {
+			changes = append(changes, &Value{Key: k, Value: v, Operation: Put})
+		}
+	}
+
+	for k := range w.last {
+		if _, exists := data[k]; !exists && w.touched[k] <= started {
+			changes = append(changes, &Value{Key: k, Operation: Delete})
+		}
+	}
+
+	for _, v := range changes {
+		if w.update(v) {
+			w.pending = append(w.pending, v)
+		}
+	}
+
+	// Only one poll runs at a time, the next one starts after this
+	for k, rev := range w.touched {
+		if rev <= started {
+			delete(w.touched, k)
+		}
+	}
+
+	w.m.Unlock()
+
+	w.signal()
+}
+
+func (w *SQLWatcher) Changes() <-chan *Value {
+	return w.changes
+}
+
+func (w *SQLWatcher) Unwatch() {
+	w.once.Do(func() {
+		close(w.done)
+		w.bucket.Unwatch(w)
+	})
+}
@@ -0,0 +1,40 @@
+package kv
+
+import (
+	"testing"
+)
+
+func TestSQLWatcherKeepsLocalWrites(t *testing.T) {
+	w := &SQLWatcher{
+		last:    map[string][]byte{"a": []byte("1"), "b": []byte("1")},
+		touched: make(map[string]uint64),
+		wake:    make(chan struct{}, 1),
+	}
+
+	// A poll starts, then this proxy writes before its snapshot is applied
+	started := w.rev
+	w.local(&Value{Key: "a", Value: []byte("2"), Operation: Put})
+	w.local(&Value{Key: "b", Operation: Delete})
+
+	w.sync(map[string][]byte{"a": []byte("1"), "b": []byte("1"), "c": []byte("1")}, started)
+
+	if string(w.last["a"]) != "2" {
+		t.Fatalf("expected the local write to be kept, got %q", w.last["a"])
+	}
+
+	if _, ok := w.last["b"]; ok {
+		t.Fatal("expected the local delete to be kept")
+	}
+
+	if len(w.pending) != 3 || w.pending[2].Key != "c" {
+		t.Fatalf("expected the two local writes and c, got %d changes", len(w.pending))
+	}
+
+	// The next poll sees the table after the writes
+	w.pending = nil
+	w.sync(map[string][]byte{"a": []byte("2"), "c": []byte("1")}, w.rev)
+
+	if len(w.pending) != 0 || len(w.touched) != 0 {
+		t.Fatalf("expected no changes and nothing touched, got %d and %d", len(w.pending), len(w.touched))
+	}
+}
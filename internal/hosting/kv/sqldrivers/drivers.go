@@ -0,0 +1,9 @@
+//go:build !nosqldrivers
+
+package sqldrivers
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
@@ -0,0 +1,5 @@
+// Package sqldrivers links the database/sql drivers of the SQL KV backend:
+// pgx for Postgres, MySQL and a pure Go SQLite, so the static binary needs no
+// cgo. Build with -tags nosqldrivers to leave them out, e.g. to keep the
+// binary small when the KV lives in NATS anyway.
+package sqldrivers
@@ -0,0 +1,175 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Codec encodes the values of a TypedKey. JSON is the default, other
+// encodings like msgpack can be plugged in with TypedKey.Codec.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+var JSON Codec = jsonCodec{}
+
+// TypedKey is a single key of a bucket holding a value of type T, so callers
+// don't have to encode and decode it themselves.
+type TypedKey[T any] struct {
+	b     Bucket
+	key   string
+	codec Codec
+
+	def      func() T
+	validate func(v T) error
+}
+
+// Typed returns the key of b holding a T. The options return a copy, so a
+// TypedKey can be shared and specialized.
+func Typed[T any](b Bucket, key string) *TypedKey[T] {
+	return &TypedKey[T]{b: b, key: key, codec: JSON}
+}
+
+// Default sets the value Get returns while the key isn't set. fn is called
+// for every Get, so maps and slices aren't shared between callers.
+func (k *TypedKey[T]) Default(fn func() T) *TypedKey[T] {
+	c := *k
+	c.def = fn
+	return &c
+}
+
+// Validate sets a check Set runs before writing and Get runs after reading.
+func (k *TypedKey[T]) Validate(fn func(v T) error) *TypedKey[T] {
+	c := *k
+	c.validate = fn
+	return &c
+}
+
+func (k *TypedKey[T]) Codec(codec Codec) *TypedKey[T] {
+	c := *k
+	c.codec = codec
+	return &c
+}
+
+func (k *TypedKey[T]) Key() string {
+	return k.key
+}
+
+func (k *TypedKey[T]) zero() T {
+	if k.def != nil {
+		return k.def()
+	}
+
+	var v T
+	return v
+}
+
+// decode starts from the zero value rather than the default, so stored
+// values aren't merged into it.
+func (k *TypedKey[T]) decode(data []byte) (T, error) {
+	var v T
+	if err := k.codec.Unmarshal(data, &v); err != nil {
+		return k.zero(), fmt.Errorf("%s/%s: failed to decode: %w", k.b.Name(), k.key, err)
+	}
+
+	if k.validate != nil {
+		if err := k.validate(v); err != nil {
+			return k.zero(), fmt.Errorf("%s/%s: invalid value: %w", k.b.Name(), k.key, err)
+		}
+	}
+
+	return v, nil
+}
+
+// Lookup returns the value and whether the key is set. Unset keys return the
+// default.
+func (k *TypedKey[T]) Lookup(ctx context.Context) (T, bool, error) {
+	data, err := k.b.Get(ctx, k.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return k.zero(), false, nil
+	} else if err != nil {
+		return k.zero(), false, err
+	}
+
+	v, err := k.decode(data)
+	return v, err == nil, err
+}
+
+// Get returns the value of the key, or the default if it isn't set.
+func (k *TypedKey[T]) Get(ctx context.Context) (T, error) {
+	v, _, err := k.Lookup(ctx)
+	return v, err
+}
+
+func (k *TypedKey[T]) Set(ctx context.Context, v T) error {
+	if k.validate != nil {
+		if err := k.validate(v); err != nil {
+			return fmt.Errorf("%s/%s: invalid value: %w", k.b.Name(), k.key, err)
+		}
+	}
+
+	data, err := k.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%s/%s: failed to encode: %w", k.b.Name(), k.key, err)
+	}
+
+	return k.b.Set(ctx, k.key, data)
+}
+
+func (k *TypedKey[T]) Delete(ctx context.Context) error {
+	return k.b.Delete(ctx, k.key)
+}
+
+// Watch calls fn with the current value and then with every change of the
+// key until ctx is done, an unset or deleted key passes the default. Values
+// that can't be decoded or are invalid are logged and skipped. Like Watch it
+// survives the watcher being dropped, the value is passed again once it is
+// back.
+func (k *TypedKey[T]) Watch(ctx context.Context, fn func(v T)) {
+	// seen tracks whether the replay contained the key, if it didn't the key
+	// isn't set (anymore)
+	replaying, seen := true, false
+
+	WatchKeys(ctx, k.b, Keys(k.key), func(v *Value) {
+		if v == nil {
+			if replaying && !seen {
+				fn(k.zero())
+			}
+
+			replaying = false
+			return
+		}
+
+		seen = true
+
+		if v.Operation == Delete {
+			fn(k.zero())
+			return
+		}
+
+		val, err := k.decode(v.Value)
+		if err != nil {
+			log.Printf("Ignoring change: %v", err)
+			return
+		}
+
+		fn(val)
+	}, func(ctx context.Context) error {
+		replaying, seen = true, false
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+type typedConfig struct {
+	Limit int      `json:"limit"`
+	Names []string `json:"names"`
+}
+
+func typedBucket(t *testing.T) Bucket {
+	t.Helper()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := k.Bucket(context.Background(), "typed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestTypedKey(t *testing.T) {
+	ctx := context.Background()
+	b := typedBucket(t)
+
+	errNegative := errors.New("negative limit")
+	key := Typed[typedConfig](b, "config").
+		Default(func() typedConfig { return typedConfig{Limit: 10, Names: []string{}} }).
+		Validate(func(c typedConfig) error {
+			if c.Limit < 0 {
+				return errNegative
+			}
+			return nil
+		})
+
+	if c, ok, err := key.Lookup(ctx); err != nil || ok || c.Limit != 10 || c.Names == nil {
+		t.Fatalf("unset key returned %+v, %v, %v", c, ok, err)
+	}
+
+	if err := key.Set(ctx, typedConfig{Limit: -1}); !errors.Is(err, errNegative) {
+		t.Fatalf("invalid value was set: %v", err)
+	}
+
+	if err := key.Set(ctx, typedConfig{Limit: 3, Names: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := key.Get(ctx); err != nil || c.Limit != 3 || len(c.Names) != 1 {
+		t.Fatalf("got %+v, %v", c, err)
+	}
+
+	if err := b.Set(ctx, "config", []byte(`{"limit":-5}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := key.Get(ctx); !errors.Is(err, errNegative) {
+		t.Fatalf("invalid stored value was returned: %v", err)
+	}
+
+	if err := key.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := key.Lookup(ctx); err != nil || ok {
+		t.Fatalf("deleted key is still set: %v, %v", ok, err)
+	}
+}
+
+func TestTypedKeyWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := typedBucket(t)
+	key := Typed[int](b, "limit").Default(func() int { return 1 })
+
+	values := make(chan int, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		key.Watch(ctx, func(v int) {
+			values <- v
+		})
+	}()
+
+	// Stop watching before returning, TestWatchReconnects checks every watch
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	next := func() int {
+		t.Helper()
+
+		select {
+		case v := <-values:
+			return v
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a change")
+			return 0
+		}
+	}
+
+	if v := next(); v != 1 {
+		t.Errorf("got %d for the unset key, want the default", v)
+	}
+
+	if err := b.Set(ctx, "other", []byte("5")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set(ctx, "limit", []byte(`"five"`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Set(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := next(); v != 5 {
+		t.Errorf("got %d, want 5", v)
+	}
+
+	if err := key.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := next(); v != 1 {
+		t.Errorf("got %d after deleting, want the default", v)
+	}
+}
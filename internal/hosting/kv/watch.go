@@ -0,0 +1,167 @@
+package kv
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	watchMinBackoff = time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+type WatchState struct {
+	Bucket     string    `json:"bucket"`
+	Connected  bool      `json:"connected"`
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"lastError,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+var (
+	watchStates  = make(map[*WatchState]struct{})
+	watchStatesM sync.Mutex
+)
+
+// WatchStates returns a snapshot of all watches started through Watch.
+func WatchStates() []WatchState {
+	watchStatesM.Lock()
+	defer watchStatesM.Unlock()
+
+	states := make([]WatchState, 0, len(watchStates))
+	for s := range watchStates {
+		states = append(states, *s)
+	}
+
+	slices.SortFunc(states, func(a, b WatchState) int {
+		return strings.Compare(a.Bucket, b.Bucket)
+	})
+
+	return states
+}
+
+func updateWatchState(s *WatchState, fn func(s *WatchState)) {
+	watchStatesM.Lock()
+	defer watchStatesM.Unlock()
+
+	fn(s)
+}
+
+// Watch calls handle for every change of the bucket until ctx is done. Unlike
+// a plain WatchAll it survives the backend dropping the watcher: it
+// re-establishes it with exponential backoff and calls resync, if set, so the
+// caller can reload state that changed while it was disconnected, or that it
+// loaded from a snapshot because the first watcher failed too. The replayed
+// values (and the nil marking the end of the replay) are passed to handle
+// again after every reconnect.
+func Watch(ctx context.Context, b Bucket, handle func(v *Value), resync func(ctx context.Context) error) {
+	watch(ctx, b, nil, handle, resync)
+}
+
+// WatchKeys is Watch for the keys matching f.
+func WatchKeys(ctx context.Context, b Bucket, f Filter, handle func(v *Value), resync func(ctx context.Context) error) {
+	watch(ctx, b, f, handle, resync)
+}
+
+func watch(ctx context.Context, b Bucket, f Filter, handle func(v *Value), resync func(ctx context.Context) error) {
+	state := &WatchState{Bucket: b.Name(), Since: time.Now()}
+
+	watchStatesM.Lock()
+	watchStates[state] = struct{}{}
+	watchStatesM.Unlock()
+
+	defer func() {
+		watchStatesM.Lock()
+		delete(watchStates, state)
+		watchStatesM.Unlock()
+	}()
+
+	backoff := watchMinBackoff
+	first := true
+	// failed is set if establishing the watcher failed, the caller's state
+	// may be stale by then even on the first one, e.g. loaded from a snapshot
+	failed := false
+
+	for {
+		var watcher Watcher
+		var err error
+		if f != nil {
+			watcher, err = WatchFiltered(ctx, b, f)
+		} else {
+			watcher, err = b.WatchAll(ctx)
+		}
+		if err != nil {
+			log.Printf("Failed to watch bucket %s, retrying in %s: %v", b.Name(), backoff, err)
+			failed = true
+			updateWatchState(state, func(s *WatchState) {
+				s.Connected = false
+				s.LastError = err.Error()
+			})
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff = min(backoff*2, watchMaxBackoff)
+			continue
+		}
+
+		if !first || failed {
+			log.Printf("Re-established watcher for bucket %s", b.Name())
+
+			if resync != nil {
+				if err := resync(ctx); err != nil {
+					log.Printf("Failed to resync bucket %s: %v", b.Name(), err)
+				}
+			}
+		}
+		failed = false
+
+		updateWatchState(state, func(s *WatchState) {
+			s.Connected = true
+			s.Since = time.Now()
+			if !first {
+				s.Reconnects++
+			}
+		})
+
+		first = false
+		backoff = watchMinBackoff
+
+		stopped := consume(ctx, watcher, handle)
+		if stopped {
+			watcher.Unwatch()
+			return
+		}
+
+		log.Printf("Watcher for bucket %s closed unexpectedly, reconnecting", b.Name())
+		updateWatchState(state, func(s *WatchState) {
+			s.Connected = false
+			s.LastError = "watcher closed"
+			s.Since = time.Now()
+		})
+	}
+}
+
+// consume forwards changes until the watcher closes or ctx is done, in which
+// case it returns true.
+func consume(ctx context.Context, watcher Watcher, handle func(v *Value)) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case v, ok := <-watcher.Changes():
+			if !ok {
+				return false
+			}
+
+			handle(v)
+		}
+	}
+}
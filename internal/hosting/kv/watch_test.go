@@ -0,0 +1,119 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+// flakyBucket hands out the watchers so the test can close them, simulating
+// a backend that drops the watch.
+type flakyBucket struct {
+	Bucket
+	watchers chan Watcher
+}
+
+func (b *flakyBucket) WatchAll(ctx context.Context) (Watcher, error) {
+	w, err := b.Bucket.WatchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.watchers <- w
+
+	return w, nil
+}
+
+func init() {
+	// Set before any test starts a watch, the cached buckets keep theirs
+	watchMinBackoff = time.Millisecond
+}
+
+// watchStatesOf returns the watch states of the bucket, other tests leave
+// the watches of their cached buckets behind.
+func watchStatesOf(bucket string) []WatchState {
+	var states []WatchState
+	for _, s := range WatchStates() {
+		if s.Bucket == bucket {
+			states = append(states, s)
+		}
+	}
+
+	return states
+}
+
+func TestWatchReconnects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k, err := NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := k.Bucket(ctx, "watch-reconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &flakyBucket{Bucket: raw, watchers: make(chan Watcher, 2)}
+
+	changes := make(chan *Value, 16)
+	resyncs := 0
+	m := sync.Mutex{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		Watch(ctx, b, func(v *Value) {
+			changes <- v
+		}, func(ctx context.Context) error {
+			m.Lock()
+			resyncs++
+			m.Unlock()
+			return nil
+		})
+	}()
+
+	first := <-b.watchers
+	if v := <-changes; v != nil {
+		t.Fatalf("expected end of replay, got %v", v)
+	}
+
+	first.Unwatch()
+
+	<-b.watchers
+	if v := <-changes; v != nil {
+		t.Fatalf("expected end of replay after reconnect, got %v", v)
+	}
+
+	if err := raw.Set(ctx, "test", []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := <-changes; v == nil || v.Key != "test" || v.Operation != Put {
+		t.Fatalf("expected put of 'test', got %v", v)
+	}
+
+	m.Lock()
+	if resyncs != 1 {
+		t.Fatalf("expected 1 resync, got %d", resyncs)
+	}
+	m.Unlock()
+
+	states := watchStatesOf("watch-reconnect")
+	if len(states) != 1 || states[0].Reconnects != 1 || !states[0].Connected {
+		t.Fatalf("unexpected watch states: %+v", states)
+	}
+
+	cancel()
+	<-done
+
+	if states := watchStatesOf("watch-reconnect"); len(states) != 0 {
+		t.Fatalf("expected no watch states after cancel, got %+v", states)
+	}
+}
@@ -0,0 +1,203 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/reporting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// lifecycle owns the contexts handed to long-running plugin goroutines
+// (watchers, tickers). Cancelling a plugin's context stops only that plugin,
+// cancelling the root stops all of them.
+type lifecycle struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	plugins map[string]*pluginContext
+	m       sync.Mutex
+
+	// A plugin that panics panicLimit times within panicWindow is disabled.
+	// A limit of 0 never disables.
+	panicLimit  int
+	panicWindow time.Duration
+}
+
+type pluginContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// disabled is read by every guarded event without the lock
+	disabled atomic.Bool
+	panics   []time.Time
+	state    PluginState
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &lifecycle{
+		ctx:     ctx,
+		cancel:  cancel,
+		plugins: make(map[string]*pluginContext),
+
+		panicLimit:  util.EnvIntWithDefault("PLUGIN_PANIC_LIMIT", 0),
+		panicWindow: util.EnvDurationWithDefault("PLUGIN_PANIC_WINDOW", 5*time.Minute),
+	}
+}
+
+// Context is cancelled when the proxy shuts down.
+func (n *Hosting) Context() context.Context {
+	return n.lc.ctx
+}
+
+// PluginContext returns the context for the named plugin. It is cancelled when
+// the plugin is disabled or the proxy shuts down.
+func (n *Hosting) PluginContext(name string) context.Context {
+	n.lc.m.Lock()
+	defer n.lc.m.Unlock()
+
+	return n.lc.plugin(name).ctx
+}
+
+// plugin must be called with the lock held.
+func (l *lifecycle) plugin(name string) *pluginContext {
+	if p, ok := l.plugins[name]; ok {
+		return p
+	}
+
+	ctx, cancel := context.WithCancel(l.ctx)
+	p := &pluginContext{ctx: ctx, cancel: cancel, state: PluginState{Name: name, State: PluginPending}}
+	l.plugins[name] = p
+
+	return p
+}
+
+// DisablePlugin cancels the context of the named plugin and makes guarded
+// event handlers skip it. It reports whether the plugin was enabled.
+func (n *Hosting) DisablePlugin(name string) bool {
+	n.lc.m.Lock()
+	defer n.lc.m.Unlock()
+
+	p := n.lc.plugin(name)
+	if p.disabled.Load() {
+		return false
+	}
+
+	log.Printf("Disabling plugin %s", name)
+	p.disabled.Store(true)
+	p.cancel()
+
+	return true
+}
+
+// EnablePlugin gives a disabled plugin a fresh context. Goroutines stopped by
+// DisablePlugin are not restarted, the plugin has to do that on its own.
+func (n *Hosting) EnablePlugin(name string) bool {
+	n.lc.m.Lock()
+	defer n.lc.m.Unlock()
+
+	p := n.lc.plugin(name)
+	if !p.disabled.Load() {
+		return false
+	}
+
+	log.Printf("Enabling plugin %s", name)
+	p.ctx, p.cancel = context.WithCancel(n.lc.ctx)
+	p.disabled.Store(false)
+	p.panics = nil
+
+	return true
+}
+
+func (n *Hosting) PluginDisabled(name string) bool {
+	n.lc.m.Lock()
+	defer n.lc.m.Unlock()
+
+	return n.lc.plugin(name).disabled.Load()
+}
+
+// Shutdown cancels the root context and with it every plugin context.
+func (n *Hosting) Shutdown() {
+	log.Println("Stopping plugin goroutines")
+	n.lc.cancel()
+
+	// Panics of the shutdown itself can't be reported anymore
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n.rep.Close(ctx)
+}
+
+const (
+	PluginPending  = "pending"
+	PluginReady    = "ready"
+	PluginFailed   = "failed"
+	PluginDisabled = "disabled"
+)
+
+type PluginState struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Track wraps the Init of a plugin to record whether it initialized, which is
+// reported by the readiness endpoint.
+func (n *Hosting) Track(p proxy.Plugin) proxy.Plugin {
+	n.lc.m.Lock()
+	n.lc.plugin(p.Name)
+	n.lc.m.Unlock()
+
+	init := p.Init
+	p.Init = func(ctx context.Context, prx *proxy.Proxy) error {
+		n.setProxy(prx)
+
+		err := init(ctx, prx)
+
+		n.lc.m.Lock()
+		state := &n.lc.plugin(p.Name).state
+		if err != nil {
+			state.State = PluginFailed
+			state.Error = err.Error()
+		} else {
+			state.State = PluginReady
+		}
+		n.lc.m.Unlock()
+
+		if err != nil {
+			n.ReportError(ctx, p.Name, fmt.Errorf("init: %w", err), reporting.Context{})
+		}
+
+		return err
+	}
+
+	return p
+}
+
+// PluginStates returns the state of every tracked plugin, sorted by name.
+func (n *Hosting) PluginStates() []PluginState {
+	n.lc.m.Lock()
+	defer n.lc.m.Unlock()
+
+	states := make([]PluginState, 0, len(n.lc.plugins))
+	for _, p := range n.lc.plugins {
+		s := p.state
+		if p.disabled.Load() {
+			s.State = PluginDisabled
+		}
+
+		states = append(states, s)
+	}
+
+	slices.SortFunc(states, func(a, b PluginState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return states
+}
@@ -0,0 +1,170 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const (
+	lockdownKeyPrefix = "lockdown."
+	// LockdownBypassPermission lets staff join groups in lockdown.
+	LockdownBypassPermission = "csmc.lockdown.bypass"
+)
+
+var lockdownRejections = metrics.NewCounterVec("gate_lockdown_rejections_total", "Connections denied because the gamemode was in lockdown.", "gamemode")
+
+// LockdownConfig closes a gamemode to new connections, e.g. while one of its
+// minigames is being exploited. Players already on it stay.
+type LockdownConfig struct {
+	// Message is shown to players that are kept off
+	Message string    `json:"message,omitempty"`
+	Actor   string    `json:"actor"`
+	Since   time.Time `json:"since"`
+}
+
+func (m *InstanceManager) GroupLockdown(ctx context.Context, gamemode string) (LockdownConfig, bool, error) {
+	return kv.Typed[LockdownConfig](m.routingKV, lockdownKeyPrefix+gamemode).Lookup(ctx)
+}
+
+// LockedDown returns the lockdown that keeps the player off the server, false
+// if they may connect. Players on another instance of its gamemode and those
+// with LockdownBypassPermission may.
+func (m *InstanceManager) LockedDown(ctx context.Context, player proxy.Player, server proxy.RegisteredServer) (LockdownConfig, bool, error) {
+	if player.HasPermission(LockdownBypassPermission) {
+		return LockdownConfig{}, false, nil
+	}
+
+	gamemode, err := m.Gamemode(ctx, server)
+	if err != nil || gamemode == "" {
+		return LockdownConfig{}, false, err
+	}
+
+	cfg, ok, err := m.GroupLockdown(ctx, gamemode)
+	if err != nil || !ok {
+		return LockdownConfig{}, false, err
+	}
+
+	if cur := player.CurrentServer(); cur != nil {
+		current, err := m.Gamemode(ctx, cur.Server())
+		if err != nil {
+			return LockdownConfig{}, false, err
+		}
+
+		if current == gamemode {
+			return LockdownConfig{}, false, nil
+		}
+	}
+
+	lockdownRejections.Inc(gamemode)
+
+	return cfg, true, nil
+}
+
+func (n *Hosting) GroupLockdowns(ctx context.Context) (map[string]LockdownConfig, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lockdowns := make(map[string]LockdownConfig)
+	for _, key := range keys {
+		gamemode, ok := strings.CutPrefix(key, lockdownKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		cfg, err := kv.Typed[LockdownConfig](n.rt, key).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		lockdowns[gamemode] = cfg
+	}
+
+	return lockdowns, nil
+}
+
+// SetGroupLockdown closes the gamemode to new connections.
+func (n *Hosting) SetGroupLockdown(ctx context.Context, actor, gamemode, message string) (LockdownConfig, error) {
+	if gamemode == "" {
+		return LockdownConfig{}, errors.New("gamemode is required")
+	}
+
+	cfg := LockdownConfig{Message: message, Actor: actor, Since: time.Now()}
+	if err := kv.Typed[LockdownConfig](n.rt, lockdownKeyPrefix+gamemode).Set(ctx, cfg); err != nil {
+		return LockdownConfig{}, err
+	}
+
+	return cfg, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "routing.lockdown",
+		Target:  gamemode,
+		Details: map[string]string{"message": message},
+	})
+}
+
+// DeleteGroupLockdown opens the gamemode again.
+func (n *Hosting) DeleteGroupLockdown(ctx context.Context, actor, gamemode string) error {
+	if err := kv.Typed[LockdownConfig](n.rt, lockdownKeyPrefix+gamemode).Delete(ctx); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "routing.lockdown.delete", Target: gamemode})
+}
+
+type lockdownRequest struct {
+	Message string `json:"message"`
+	// Actor is the staff member locking the gamemode down, "api" by default
+	Actor string `json:"actor"`
+}
+
+func (n *Hosting) handleGetLockdowns(w http.ResponseWriter, r *http.Request) {
+	lockdowns, err := n.GroupLockdowns(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, lockdowns)
+}
+
+func (n *Hosting) handleSetLockdown(w http.ResponseWriter, r *http.Request) {
+	req := lockdownRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Actor == "" {
+		req.Actor = "api"
+	}
+
+	cfg, err := n.SetGroupLockdown(r.Context(), req.Actor, r.PathValue("gamemode"), req.Message)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
+
+func (n *Hosting) handleDeleteLockdown(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteGroupLockdown(r.Context(), "api", r.PathValue("gamemode")); errors.Is(err, kv.ErrKeyNotFound) {
+		api.WriteError(w, http.StatusNotFound, errors.New("gamemode is not in lockdown"))
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package messaging
+
+import (
+	"context"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+)
+
+var _ Messager = &Faulty{}
+
+// Faulty injects the faults of f: publishing is delayed and fails, received
+// messages are delayed and dropped.
+type Faulty struct {
+	m Messager
+	f *faults.Injector
+}
+
+func WithFaults(m Messager, f *faults.Injector) *Faulty {
+	return &Faulty{m: m, f: f}
+}
+
+func (f *Faulty) Subscribe(topic string, handler func(Message)) error {
+	return f.m.Subscribe(topic, func(m Message) {
+		if f.f.Drop() {
+			return
+		}
+
+		f.f.Delay()
+		handler(m)
+	})
+}
+
+func (f *Faulty) Publish(ctx context.Context, topic string, message []byte) error {
+	if err := f.f.Before(ctx, "publish "+topic); err != nil {
+		return err
+	}
+
+	return f.m.Publish(ctx, topic, message)
+}
+
+func (f *Faulty) Nak(msg Message) error {
+	return f.m.Nak(msg)
+}
+
+func (f *Faulty) Ack(msg Message) error {
+	return f.m.Ack(msg)
+}
+
+func (f *Faulty) Ping(ctx context.Context) error {
+	if err := f.f.Before(ctx, "ping"); err != nil {
+		return err
+	}
+
+	return f.m.Ping(ctx)
+}
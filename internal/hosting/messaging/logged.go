@@ -3,6 +3,8 @@ package messaging
 import (
 	"context"
 	"log"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
 )
 
 var _ Messager = &Logged{}
@@ -26,7 +28,11 @@ func (l *Logged) Subscribe(topic string, handler func(Message)) error {
 }
 
 func (l *Logged) Publish(ctx context.Context, topic string, message []byte) error {
-	log.Printf("Publish %s/%s", topic, message)
+	if id := correlation.ID(ctx); id != "" {
+		log.Printf("Publish [%s] %s/%s", id, topic, message)
+	} else {
+		log.Printf("Publish %s/%s", topic, message)
+	}
 
 	return l.m.Publish(ctx, topic, message)
 }
@@ -42,3 +48,7 @@ func (l *Logged) Ack(msg Message) error {
 
 	return l.m.Ack(msg)
 }
+
+func (l *Logged) Ping(ctx context.Context) error {
+	return l.m.Ping(ctx)
+}
@@ -0,0 +1,85 @@
+package messaging
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+)
+
+var _ Messager = &Memory{}
+
+// Memory delivers messages within the process only, for a single proxy in
+// development. Topics match like NATS subjects, "*" matches one token and
+// ">" the rest.
+type Memory struct {
+	subs []memorySub
+	m    sync.RWMutex
+}
+
+type memorySub struct {
+	topic   string
+	handler func(Message)
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Subscribe(topic string, handler func(Message)) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.subs = append(m.subs, memorySub{topic: topic, handler: handler})
+
+	return nil
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, message []byte) error {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	id := correlation.ID(ctx)
+
+	for _, s := range m.subs {
+		if !matchTopic(s.topic, topic) {
+			continue
+		}
+
+		// Handlers get their own copy and run like NATS callbacks, outside
+		// of the publisher
+		data := append([]byte(nil), message...)
+		go s.handler(Message{m: m, Context: correlation.With(context.Background(), id), Topic: topic, Data: data})
+	}
+
+	return nil
+}
+
+func matchTopic(pattern, topic string) bool {
+	pt, tt := strings.Split(pattern, "."), strings.Split(topic, ".")
+
+	for i, p := range pt {
+		if p == ">" {
+			return len(tt) > i
+		}
+
+		if i >= len(tt) || (p != "*" && p != tt[i]) {
+			return false
+		}
+	}
+
+	return len(pt) == len(tt)
+}
+
+func (m *Memory) Ack(msg Message) error {
+	return nil
+}
+
+func (m *Memory) Nak(msg Message) error {
+	return nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
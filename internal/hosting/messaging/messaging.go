@@ -3,6 +3,8 @@ package messaging
 import (
 	"context"
 	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
 )
 
 type Messager interface {
@@ -10,10 +12,13 @@ type Messager interface {
 	Publish(ctx context.Context, topic string, message []byte) error
 	Ack(msg Message) error
 	Nak(msg Message) error
+	// Ping reports an error if the connection to the broker is down.
+	Ping(ctx context.Context) error
 }
 
 type Message struct {
-	m       Messager
+	m Messager
+	// Context carries the correlation ID of the publisher, if it sent one
 	Context context.Context
 	Topic   string
 	Data    []byte
@@ -23,6 +28,11 @@ type Message struct {
 func (m Message) String() string {
 	sb := strings.Builder{}
 
+	if id := correlation.ID(m.Context); id != "" {
+		sb.WriteString("[")
+		sb.WriteString(id)
+		sb.WriteString("] ")
+	}
 	sb.WriteString(m.Topic)
 	sb.WriteString(" ")
 	if m.ReplyTo != nil {
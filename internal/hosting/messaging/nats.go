@@ -2,7 +2,9 @@ package messaging
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
 	"github.com/nats-io/nats.go"
 )
 
@@ -22,18 +24,36 @@ func NewNATS(nc *nats.Conn) *NATSMessager {
 
 func (n *NATSMessager) Subscribe(topic string, handler func(Message)) error {
 	_, err := n.nc.Subscribe(topic, func(msg *nats.Msg) {
-		handler(Message{
-			m:     n,
-			Topic: topic,
-			Data:  msg.Data,
-		})
+		id := msg.Header.Get(correlation.Header)
+		if !correlation.Valid(id) {
+			id = ""
+		}
+
+		m := Message{
+			m:       n,
+			Context: correlation.With(context.Background(), id),
+			Topic:   topic,
+			Data:    msg.Data,
+		}
+		if msg.Reply != "" {
+			m.ReplyTo = &msg.Reply
+		}
+
+		handler(m)
 	})
 
 	return err
 }
 
-func (n *NATSMessager) Publish(_ctx context.Context, topic string, message []byte) error {
-	return n.nc.Publish(topic, message)
+// Publish sends the correlation ID of ctx along as a header, so that
+// subscribers and their replies can be tied to the publisher.
+func (n *NATSMessager) Publish(ctx context.Context, topic string, message []byte) error {
+	msg := &nats.Msg{Subject: topic, Data: message}
+	if id := correlation.ID(ctx); id != "" {
+		msg.Header = nats.Header{correlation.Header: []string{id}}
+	}
+
+	return n.nc.PublishMsg(msg)
 }
 
 func (n *NATSMessager) Ack(msg Message) error {
@@ -43,3 +63,11 @@ func (n *NATSMessager) Ack(msg Message) error {
 func (n *NATSMessager) Nak(msg Message) error {
 	return msg.Ack()
 }
+
+func (n *NATSMessager) Ping(ctx context.Context) error {
+	if !n.nc.IsConnected() {
+		return fmt.Errorf("nats connection is %s", n.nc.Status())
+	}
+
+	return n.nc.FlushWithContext(ctx)
+}
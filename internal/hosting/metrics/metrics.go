@@ -0,0 +1,239 @@
+// Package metrics is a minimal registry of counters, gauges and histograms
+// exposed in the Prometheus text format on the admin API.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+type family struct {
+	name   string
+	help   string
+	kind   kind
+	labels []string
+	values map[string]*atomic.Int64
+	// hists is only used by histograms, keyed like values
+	hists   map[string]*histogram
+	buckets []float64
+	m       sync.Mutex
+}
+
+var (
+	families  = make(map[string]*family)
+	familiesM sync.Mutex
+)
+
+func register(name, help string, k kind, labels []string) *family {
+	familiesM.Lock()
+	defer familiesM.Unlock()
+
+	if f, ok := families[name]; ok {
+		return f
+	}
+
+	f := &family{name: name, help: help, kind: k, labels: labels, values: make(map[string]*atomic.Int64), hists: make(map[string]*histogram)}
+	families[name] = f
+
+	return f
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = fmt.Sprintf("%s=%q", f.labels[i], v)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f *family) with(values []string) *atomic.Int64 {
+	key := f.key(values)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	v, ok := f.values[key]
+	if !ok {
+		v = &atomic.Int64{}
+		f.values[key] = v
+	}
+
+	return v
+}
+
+type CounterVec struct {
+	f *family
+}
+
+// NewCounterVec registers a counter with the given label names. Registering
+// the same name twice returns the existing counter.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: register(name, help, kindCounter, labels)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.f.with(labelValues).Add(1)
+}
+
+func (c *CounterVec) Add(n int64, labelValues ...string) {
+	c.f.with(labelValues).Add(n)
+}
+
+type GaugeVec struct {
+	f *family
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: register(name, help, kindGauge, labels)}
+}
+
+func (g *GaugeVec) Set(v int64, labelValues ...string) {
+	g.f.with(labelValues).Store(v)
+}
+
+func (g *GaugeVec) Add(n int64, labelValues ...string) {
+	g.f.with(labelValues).Add(n)
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+type HistogramVec struct {
+	f *family
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds,
+// the +Inf bucket is added automatically.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	f := register(name, help, kindHistogram, labels)
+
+	f.m.Lock()
+	if f.buckets == nil {
+		f.buckets = slices.Clone(buckets)
+		slices.Sort(f.buckets)
+	}
+	f.m.Unlock()
+
+	return &HistogramVec{f: f}
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.f.key(labelValues)
+
+	h.f.m.Lock()
+	defer h.f.m.Unlock()
+
+	hist, ok := h.f.hists[key]
+	if !ok {
+		hist = &histogram{counts: make([]int64, len(h.f.buckets))}
+		h.f.hists[key] = hist
+	}
+
+	for i, b := range h.f.buckets {
+		if v <= b {
+			hist.counts[i]++
+		}
+	}
+
+	hist.count++
+	hist.sum += v
+}
+
+// labels joins the label pairs of a series with an extra pair.
+func labels(key, extra string) string {
+	if key == "" {
+		return "{" + extra + "}"
+	}
+
+	return "{" + key + "," + extra + "}"
+}
+
+func (f *family) writeHistograms(w http.ResponseWriter) {
+	keys := make([]string, 0, len(f.hists))
+	for k := range f.hists {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		hist := f.hists[k]
+
+		for i, b := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels(k, fmt.Sprintf("le=%q", strconv.FormatFloat(b, 'g', -1, 64))), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels(k, `le="+Inf"`), hist.count)
+
+		series := ""
+		if k != "" {
+			series = "{" + k + "}"
+		}
+
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, series, strconv.FormatFloat(hist.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, series, hist.count)
+	}
+}
+
+// Handler writes all registered metrics in the Prometheus text format.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	familiesM.Lock()
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	familiesM.Unlock()
+
+	slices.Sort(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	for _, name := range names {
+		familiesM.Lock()
+		f := families[name]
+		familiesM.Unlock()
+
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+
+		f.m.Lock()
+		if f.kind == kindHistogram {
+			f.writeHistograms(w)
+			f.m.Unlock()
+			continue
+		}
+
+		keys := make([]string, 0, len(f.values))
+		for k := range f.values {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			if k == "" {
+				fmt.Fprintf(w, "%s %d\n", f.name, f.values[k].Load())
+			} else {
+				fmt.Fprintf(w, "%s{%s} %d\n", f.name, k, f.values[k].Load())
+			}
+		}
+		f.m.Unlock()
+	}
+}
@@ -0,0 +1,46 @@
+package hosting
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/migrations"
+)
+
+// Migrate applies the pending migrations of a plugin's bucket before the
+// plugin loads it, scope names the plugin's data, e.g. "whitelist". Proxies
+// starting at the same time wait for the one migrating. The schema version
+// this proxy migrated to is heartbeated, see Compatible.
+func (n *Hosting) Migrate(ctx context.Context, scope string, b kv.Bucket, ms ...migrations.Migration) error {
+	applied, err := n.mig.Run(ctx, scope, b, ms)
+	if err == nil {
+		n.sch.set(scope, len(ms))
+	}
+
+	for _, version := range applied {
+		if err := n.adt.Record(ctx, audit.Entry{
+			Actor:   n.Info.PodName,
+			Action:  "migration.apply",
+			Target:  scope,
+			Details: map[string]string{"version": strconv.Itoa(version)},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (n *Hosting) handleGetMigrations(w http.ResponseWriter, r *http.Request) {
+	s, err := n.mig.State(r.Context(), r.PathValue("scope"))
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, s)
+}
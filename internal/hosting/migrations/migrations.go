@@ -0,0 +1,225 @@
+// Package migrations runs versioned migrations of the data plugins keep in
+// KV, like moving a list stored as one value to a key per entry. Every proxy
+// runs them at startup, a lock in KV makes sure only one applies them.
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+// Migration moves the data of a bucket from Version-1 to Version. Up must
+// be safe to run again on data it already migrated, a proxy crashing after
+// Up but before recording the version runs it again.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, b kv.Bucket) error
+}
+
+type Applied struct {
+	Version int       `json:"version"`
+	Name    string    `json:"name"`
+	By      string    `json:"by"`
+	At      time.Time `json:"at"`
+}
+
+// State of the migrations of a scope, usually a plugin.
+type State struct {
+	Version int       `json:"version"`
+	Applied []Applied `json:"applied"`
+}
+
+type lock struct {
+	Owner string    `json:"owner"`
+	Until time.Time `json:"until"`
+}
+
+// Runner keeps the state and locks of every scope in one bucket.
+type Runner struct {
+	state kv.Bucket
+	owner string
+	// ttl is how long a lock is held without being refreshed, a crashed
+	// proxy blocks migrations for at most that long.
+	ttl time.Duration
+	// retry is how often a held lock is checked.
+	retry time.Duration
+}
+
+func New(state kv.Bucket, owner string, ttl time.Duration) *Runner {
+	return &Runner{state: state, owner: owner, ttl: ttl, retry: time.Second}
+}
+
+func (r *Runner) State(ctx context.Context, scope string) (State, error) {
+	s := State{Applied: make([]Applied, 0)}
+
+	data, err := r.state.Get(ctx, scope)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+
+	return s, json.Unmarshal(data, &s)
+}
+
+// Run applies the migrations of the scope to b that weren't applied yet, in
+// order of their version, and returns the versions it applied. It waits for
+// other proxies migrating the same scope.
+func (r *Runner) Run(ctx context.Context, scope string, b kv.Bucket, ms []Migration) ([]int, error) {
+	ms = slices.Clone(ms)
+	slices.SortFunc(ms, func(a, b Migration) int { return a.Version - b.Version })
+
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations of %s must be numbered from 1 without gaps, got %d at %d", scope, m.Version, i+1)
+		}
+	}
+
+	// Most starts have nothing to do, skip the lock then
+	s, err := r.State(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if s.Version >= len(ms) {
+		return nil, nil
+	}
+
+	unlock, err := r.lock(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Another proxy may have migrated while we waited
+	if s, err = r.State(ctx, scope); err != nil {
+		return nil, err
+	}
+
+	applied := make([]int, 0)
+	for _, m := range ms[s.Version:] {
+		log.Printf("Migrating %s to v%d (%s)", scope, m.Version, m.Name)
+
+		if err := m.Up(ctx, b); err != nil {
+			return applied, fmt.Errorf("migration %s v%d (%s): %w", scope, m.Version, m.Name, err)
+		}
+
+		s.Version = m.Version
+		s.Applied = append(s.Applied, Applied{Version: m.Version, Name: m.Name, By: r.owner, At: time.Now()})
+
+		data, err := json.Marshal(s)
+		if err != nil {
+			return applied, err
+		}
+
+		if err := r.state.Set(ctx, scope, data); err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, m.Version)
+	}
+
+	return applied, nil
+}
+
+// lock takes the lock of the scope, waiting while another proxy holds it and
+// taking it over once that proxy stopped refreshing it. The lock is refreshed
+// until unlock is called.
+func (r *Runner) lock(ctx context.Context, scope string) (func(), error) {
+	key := scope + ".lock"
+
+	for {
+		ok, err := r.tryLock(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.retry):
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(r.ttl / 3)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := r.state.Set(ctx, key, r.lockValue()); err != nil && ctx.Err() == nil {
+					log.Printf("Failed to refresh the migration lock of %s: %v", scope, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+
+		if err := r.state.Delete(context.Background(), key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			log.Printf("Failed to release the migration lock of %s: %v", scope, err)
+		}
+	}, nil
+}
+
+func (r *Runner) lockValue() []byte {
+	data, _ := json.Marshal(lock{Owner: r.owner, Until: time.Now().Add(r.ttl)})
+
+	return data
+}
+
+func (r *Runner) tryLock(ctx context.Context, key string) (bool, error) {
+	err := kv.Create(ctx, r.state, key, r.lockValue())
+	if err == nil {
+		return true, nil
+	} else if !errors.Is(err, kv.ErrKeyExists) {
+		return false, err
+	}
+
+	data, err := r.state.Get(ctx, key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		// Released in the meantime
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	l := lock{}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return false, err
+	}
+
+	if time.Now().Before(l.Until) {
+		return false, nil
+	}
+
+	log.Printf("Migration lock %s of %s expired at %s, taking it over", key, l.Owner, l.Until.Format(time.RFC3339))
+
+	// Whoever deletes the expired lock first races the others for Create
+	if err := r.state.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return false, err
+	}
+
+	return false, nil
+}
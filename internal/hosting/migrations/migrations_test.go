@@ -0,0 +1,184 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func buckets(t *testing.T) (kv.Bucket, kv.Bucket) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	c, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := c.Bucket(ctx, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Bucket(ctx, "whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state, data
+}
+
+// splitList moves the players of the whitelisted list to a key each.
+var splitList = Migration{
+	Version: 1,
+	Name:    "split whitelisted",
+	Up: func(ctx context.Context, b kv.Bucket) error {
+		data, err := b.Get(ctx, "whitelisted")
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		players := []string{}
+		if err := json.Unmarshal(data, &players); err != nil {
+			return err
+		}
+
+		for _, p := range players {
+			if err := b.Set(ctx, "player."+p, []byte("{}")); err != nil {
+				return err
+			}
+		}
+
+		return b.Delete(ctx, "whitelisted")
+	},
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	state, data := buckets(t)
+
+	if err := data.Set(ctx, "whitelisted", []byte(`["a","b"]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := 0
+	count := Migration{Version: 2, Name: "count", Up: func(ctx context.Context, b kv.Bucket) error {
+		ran++
+		return nil
+	}}
+
+	r := New(state, "proxy-0", time.Minute)
+
+	applied, err := r.Run(ctx, "whitelist", data, []Migration{count, splitList})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(applied, []int{1, 2}) {
+		t.Errorf("applied %v, want [1 2]", applied)
+	}
+
+	keys, err := data.ListKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+
+	if !slices.Equal(keys, []string{"player.a", "player.b"}) {
+		t.Errorf("got keys %v after migrating", keys)
+	}
+
+	if applied, err := r.Run(ctx, "whitelist", data, []Migration{splitList, count}); err != nil {
+		t.Fatal(err)
+	} else if len(applied) != 0 || ran != 1 {
+		t.Errorf("applied %v again", applied)
+	}
+
+	s, err := r.State(ctx, "whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Version != 2 || len(s.Applied) != 2 || s.Applied[0].By != "proxy-0" {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	if _, err := state.Get(ctx, "whitelist.lock"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("lock not released: %v", err)
+	}
+}
+
+func TestRunConcurrently(t *testing.T) {
+	ctx := context.Background()
+	state, data := buckets(t)
+
+	ran := atomic.Int32{}
+	slow := Migration{Version: 1, Name: "slow", Up: func(ctx context.Context, b kv.Bucket) error {
+		ran.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}}
+
+	wg := sync.WaitGroup{}
+	for _, owner := range []string{"proxy-0", "proxy-1", "proxy-2"} {
+		r := New(state, owner, time.Minute)
+		r.retry = 10 * time.Millisecond
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := r.Run(ctx, "whitelist", data, []Migration{slow}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := ran.Load(); n != 1 {
+		t.Errorf("ran %d times, want once", n)
+	}
+}
+
+func TestExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	state, data := buckets(t)
+
+	stale, _ := json.Marshal(lock{Owner: "crashed", Until: time.Now().Add(-time.Second)})
+	if err := state.Set(ctx, "whitelist.lock", stale); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(state, "proxy-0", time.Minute)
+	r.retry = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if applied, err := r.Run(ctx, "whitelist", data, []Migration{splitList}); err != nil {
+		t.Fatal(err)
+	} else if !slices.Equal(applied, []int{1}) {
+		t.Errorf("applied %v, want [1]", applied)
+	}
+}
+
+func TestInvalidVersions(t *testing.T) {
+	state, data := buckets(t)
+	r := New(state, "proxy-0", time.Minute)
+
+	gap := Migration{Version: 3, Name: "gap", Up: splitList.Up}
+	if _, err := r.Run(context.Background(), "whitelist", data, []Migration{splitList, gap}); err == nil {
+		t.Error("migrations with a gap ran")
+	}
+}
@@ -0,0 +1,185 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const moddedKeyPrefix = "modded."
+
+// Loaders are the mod loaders a modded group can require.
+var Loaders = []string{"forge", "neoforge", "fabric", "quilt"}
+
+const (
+	// ModdedNegotiate connects players whose client matches the group
+	// through the proxy, for loaders whose handshake works through it.
+	ModdedNegotiate = "negotiate"
+	// ModdedPassthrough transfers players whose client matches the group to
+	// Host and Port, so the loader handshake runs directly with the backend.
+	// Gate doesn't relay the login handshake of Forge and NeoForge.
+	ModdedPassthrough = "passthrough"
+)
+
+// ModdedConfig marks the instances of a gamemode as modded, only clients
+// with the loader and mods can join them.
+type ModdedConfig struct {
+	Loader string `json:"loader"`
+	// Mods the client must announce, by the namespace of their channels
+	Mods []string `json:"mods,omitempty"`
+	// Mode is negotiate, the default, or passthrough
+	Mode string `json:"mode,omitempty"`
+	// Host and Port are where passthrough transfers players to, e.g. the
+	// public address of the modded backend
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+func (c ModdedConfig) Validate() error {
+	if !slices.Contains(Loaders, c.Loader) {
+		return errors.New("loader must be one of " + strings.Join(Loaders, ", "))
+	}
+
+	switch c.Mode {
+	case "", ModdedNegotiate:
+	case ModdedPassthrough:
+		if c.Host == "" || c.Port <= 0 || c.Port > 65535 {
+			return errors.New("passthrough needs a host and port")
+		}
+	default:
+		return errors.New("mode must be negotiate or passthrough")
+	}
+
+	return nil
+}
+
+// Passthrough reports whether players are transferred rather than connected.
+func (c ModdedConfig) Passthrough() bool {
+	return c.Mode == ModdedPassthrough
+}
+
+// Missing returns the required mods that aren't in mods.
+func (c ModdedConfig) Missing(mods []string) []string {
+	missing := make([]string, 0)
+	for _, mod := range c.Mods {
+		if !slices.Contains(mods, strings.ToLower(mod)) {
+			missing = append(missing, mod)
+		}
+	}
+
+	return missing
+}
+
+func (m *InstanceManager) GroupModded(ctx context.Context, gamemode string) (ModdedConfig, bool, error) {
+	return kv.Typed[ModdedConfig](m.routingKV, moddedKeyPrefix+gamemode).Lookup(ctx)
+}
+
+// Modded returns the modded config of the gamemode of the server, false if
+// it is vanilla.
+func (m *InstanceManager) Modded(ctx context.Context, server proxy.RegisteredServer) (ModdedConfig, bool, error) {
+	gamemode, err := m.Gamemode(ctx, server)
+	if err != nil || gamemode == "" {
+		return ModdedConfig{}, false, err
+	}
+
+	return m.GroupModded(ctx, gamemode)
+}
+
+func (n *Hosting) GroupModded(ctx context.Context) (map[string]ModdedConfig, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modded := make(map[string]ModdedConfig)
+	for _, key := range keys {
+		gamemode, ok := strings.CutPrefix(key, moddedKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		cfg, err := kv.Typed[ModdedConfig](n.rt, key).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		modded[gamemode] = cfg
+	}
+
+	return modded, nil
+}
+
+func (n *Hosting) SetGroupModded(ctx context.Context, actor, gamemode string, cfg ModdedConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := kv.Typed[ModdedConfig](n.rt, moddedKeyPrefix+gamemode).Set(ctx, cfg); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "routing.modded",
+		Target:  gamemode,
+		Details: map[string]string{"loader": cfg.Loader, "mods": strings.Join(cfg.Mods, ","), "mode": cfg.Mode},
+	})
+}
+
+// DeleteGroupModded makes the gamemode vanilla again.
+func (n *Hosting) DeleteGroupModded(ctx context.Context, actor, gamemode string) error {
+	if err := kv.Typed[ModdedConfig](n.rt, moddedKeyPrefix+gamemode).Delete(ctx); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "routing.modded.delete", Target: gamemode})
+}
+
+func (n *Hosting) handleGetModded(w http.ResponseWriter, r *http.Request) {
+	modded, err := n.GroupModded(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, modded)
+}
+
+func (n *Hosting) handleSetModded(w http.ResponseWriter, r *http.Request) {
+	cfg := ModdedConfig{}
+	if err := api.ReadJSON(r, &cfg); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetGroupModded(r.Context(), "api", r.PathValue("gamemode"), cfg); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
+
+func (n *Hosting) handleDeleteModded(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteGroupModded(r.Context(), "api", r.PathValue("gamemode")); errors.Is(err, kv.ErrKeyNotFound) {
+		api.WriteError(w, http.StatusNotFound, errors.New("gamemode is not modded"))
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
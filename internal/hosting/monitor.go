@@ -0,0 +1,150 @@
+package hosting
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+const monitorKey = "monitor"
+
+var moderationDecisions = metrics.NewCounterVec("gate_moderation_decisions_total", "Moderation decisions by plugin and rule, enforced or only monitored.", "plugin", "rule", "enforced")
+
+// MonitorMode lists where moderation decisions (whitelist kicks, chat
+// filters, rate limits, ...) are only logged and counted instead of enforced.
+type MonitorMode struct {
+	Global  bool     `json:"global"`
+	Plugins []string `json:"plugins"`
+}
+
+type monitor struct {
+	mode MonitorMode
+	key  *kv.TypedKey[MonitorMode]
+	m    sync.RWMutex
+}
+
+// newMonitor starts from MONITOR_MODE and MONITOR_MODE_PLUGINS. A value stored
+// in KV, set through the admin API, takes precedence.
+func newMonitor(ctx context.Context, bucket kv.Bucket) *monitor {
+	def := MonitorMode{
+		Global:  util.EnvBoolWithDefault("MONITOR_MODE", false),
+		Plugins: make([]string, 0),
+	}
+
+	if raw := util.EnvWithDefault("MONITOR_MODE_PLUGINS", ""); raw != "" {
+		def.Plugins = strings.Split(raw, ",")
+	}
+
+	m := &monitor{
+		mode: def,
+		key: kv.Typed[MonitorMode](bucket, monitorKey).Default(func() MonitorMode {
+			return MonitorMode{Global: def.Global, Plugins: slices.Clone(def.Plugins)}
+		}),
+	}
+
+	if err := m.reload(ctx); err != nil {
+		log.Printf("Failed to load monitor mode: %v", err)
+	}
+
+	go m.key.Watch(ctx, func(mode MonitorMode) {
+		m.m.Lock()
+		m.mode = mode
+		m.m.Unlock()
+	})
+
+	return m
+}
+
+func (m *monitor) reload(ctx context.Context) error {
+	mode, err := m.key.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	m.mode = mode
+	m.m.Unlock()
+
+	return nil
+}
+
+func (m *monitor) monitored(plugin string) bool {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	return m.mode.Global || slices.Contains(m.mode.Plugins, plugin)
+}
+
+// Enforce is called by plugins right before they act on a moderation decision
+// and reports whether they should. In monitor mode the decision is logged and
+// counted but not enforced.
+func (n *Hosting) Enforce(plugin, rule, target string) bool {
+	enforce := !n.mon.monitored(plugin)
+
+	moderationDecisions.Inc(plugin, rule, strconv.FormatBool(enforce))
+
+	if !enforce {
+		log.Printf("MONITOR: %s would apply %s to %s", plugin, rule, target)
+	}
+
+	return enforce
+}
+
+func (n *Hosting) MonitorMode() MonitorMode {
+	n.mon.m.RLock()
+	defer n.mon.m.RUnlock()
+
+	return MonitorMode{Global: n.mon.mode.Global, Plugins: slices.Clone(n.mon.mode.Plugins)}
+}
+
+func (n *Hosting) SetMonitorMode(ctx context.Context, actor string, mode MonitorMode) error {
+	if mode.Plugins == nil {
+		mode.Plugins = make([]string, 0)
+	}
+
+	if err := n.mon.key.Set(ctx, mode); err != nil {
+		return err
+	}
+
+	n.mon.m.Lock()
+	n.mon.mode = mode
+	n.mon.m.Unlock()
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "moderation.monitor",
+		Details: map[string]string{
+			"global":  strconv.FormatBool(mode.Global),
+			"plugins": strings.Join(mode.Plugins, ","),
+		},
+	})
+}
+
+func (n *Hosting) handleGetMonitor(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.MonitorMode())
+}
+
+func (n *Hosting) handleSetMonitor(w http.ResponseWriter, r *http.Request) {
+	mode := MonitorMode{}
+	if err := api.ReadJSON(r, &mode); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetMonitorMode(r.Context(), "api", mode); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, n.MonitorMode())
+}
@@ -1,17 +1,13 @@
 package hosting
 
 import (
-	"context"
-	"encoding/json"
-
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/pkg/errors"
 )
 
-func connectToNATS(url string) (*nats.Conn, error) {
-	nc, err := nats.Connect(url)
+func connectToNATS(url string, opts ...nats.Option) (*nats.Conn, error) {
+	nc, err := nats.Connect(url, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to connect to NATS")
 	}
@@ -19,8 +15,8 @@ func connectToNATS(url string) (*nats.Conn, error) {
 	return nc, nil
 }
 
-func connectToJetStream(url string) (jetstream.JetStream, error) {
-	nc, err := connectToNATS(url)
+func connectToJetStream(url string, opts ...nats.Option) (jetstream.JetStream, error) {
+	nc, err := connectToNATS(url, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -32,29 +28,3 @@ func connectToJetStream(url string) (jetstream.JetStream, error) {
 
 	return js, nil
 }
-
-func GetKeyFromKV(ctx context.Context, kv kv.Bucket, key string, obj any) error {
-	val, err := kv.Get(ctx, key)
-	if err != nil {
-		return errors.Wrap(err, "failed to get key-value")
-	}
-
-	if err := json.Unmarshal(val, &obj); err != nil {
-		return errors.Wrap(err, "failed to unmarshal key-value")
-	}
-
-	return nil
-}
-
-func SetKeyToKV(ctx context.Context, kv kv.Bucket, key string, obj any) error {
-	val, err := json.Marshal(obj)
-	if err != nil {
-		return errors.Wrap(err, "failed to marshal key-value")
-	}
-
-	if err := kv.Set(ctx, key, val); err != nil {
-		return errors.Wrap(err, "failed to set key-value")
-	}
-
-	return nil
-}
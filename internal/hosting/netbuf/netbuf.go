@@ -0,0 +1,281 @@
+// Package netbuf batches the writes to proxied connections. Writers copy
+// what is written into pooled buffers and write them from their own
+// goroutine, so the packets written while the previous write is in flight go
+// out together, in one system call with writev on TCP connections.
+//
+// The bytes queued per connection are limited, writes to a full queue wait
+// for it to drain, which slows down reading from the backend, and fail once
+// they waited too long.
+package netbuf
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var (
+	bufferGets  = metrics.NewCounterVec("gate_net_buffer_gets_total", "Write buffers taken from the pool, miss is a new allocation.", "result")
+	batchBytes  = metrics.NewHistogramVec("gate_net_write_batch_bytes", "Bytes written to a connection at once.", []float64{256, 1024, 4096, 16384, 65536, 262144})
+	pooledBytes = metrics.NewGaugeVec("gate_net_buffer_pool_bytes", "Bytes of the buffers kept in the pool.")
+	queuedBytes = metrics.NewGaugeVec("gate_write_queue_bytes", "Bytes queued for all connections.")
+	queueDepth  = metrics.NewHistogramVec("gate_write_queue_depth_bytes", "Bytes queued for a connection when its writes are flushed.", []float64{0, 4096, 65536, 262144, 1 << 20, 4 << 20, 16 << 20})
+	queueFull   = metrics.NewCounterVec("gate_write_queue_full_total", "Writes to a full queue, dropped if the connection was closed because of it.", "result")
+)
+
+// ErrQueueFull is returned once a write waited Options.Wait for the queue
+// of its connection to drain.
+var ErrQueueFull = errors.New("write queue is full")
+
+type Options struct {
+	// BufferSize is the size of every buffer.
+	BufferSize int
+	// PoolSize is how many free buffers are kept, the others are left to
+	// the garbage collector.
+	PoolSize int
+	// Batch is the most bytes written to a connection at once.
+	Batch int
+	// Limit is the most bytes queued per connection, 0 doesn't limit them.
+	// A single larger write is still queued if nothing else is.
+	Limit int
+	// Wait is how long a write waits for a full queue, 0 fails right away.
+	Wait time.Duration
+}
+
+// Pool keeps free buffers for the writers, it is shared by all connections.
+type Pool struct {
+	opts Options
+	free chan []byte
+}
+
+func New(opts Options) *Pool {
+	return &Pool{opts: opts, free: make(chan []byte, opts.PoolSize)}
+}
+
+func (p *Pool) get() []byte {
+	select {
+	case b := <-p.free:
+		bufferGets.Inc("hit")
+		pooledBytes.Add(-int64(cap(b)))
+
+		return b
+	default:
+		bufferGets.Inc("miss")
+
+		return make([]byte, 0, p.opts.BufferSize)
+	}
+}
+
+func (p *Pool) put(b []byte) {
+	select {
+	case p.free <- b[:0]:
+		pooledBytes.Add(int64(cap(b)))
+	default:
+	}
+}
+
+// Writer writes to w from its own goroutine until it is closed. A failed
+// write drops everything queued and is returned by the following writes.
+type Writer struct {
+	w    io.Writer
+	pool *Pool
+
+	// bufs are queued, the last one may still be appended to
+	bufs [][]byte
+	// batch are the buffers being written
+	batch  [][]byte
+	queued int
+	err    error
+	closed bool
+	done   chan struct{}
+	m      sync.Mutex
+	cond   *sync.Cond
+}
+
+func (p *Pool) Writer(w io.Writer) *Writer {
+	wr := &Writer{w: w, pool: p, done: make(chan struct{})}
+	wr.cond = sync.NewCond(&wr.m)
+
+	go wr.run()
+
+	return wr
+}
+
+// Write queues a copy of b, b can be reused once it returns.
+func (w *Writer) Write(b []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.closed {
+		return 0, net.ErrClosed
+	}
+
+	if w.full(len(b)) {
+		if err := w.wait(len(b)); err != nil {
+			return 0, err
+		}
+	}
+
+	n := len(b)
+	for len(b) > 0 {
+		if len(w.bufs) == 0 || len(w.bufs[len(w.bufs)-1]) == cap(w.bufs[len(w.bufs)-1]) {
+			w.bufs = append(w.bufs, w.pool.get())
+		}
+
+		last := &w.bufs[len(w.bufs)-1]
+		c := min(len(b), cap(*last)-len(*last))
+		*last = append(*last, b[:c]...)
+		b = b[c:]
+	}
+
+	w.queued += n
+	queuedBytes.Add(int64(n))
+	w.cond.Broadcast()
+
+	return n, nil
+}
+
+func (w *Writer) full(n int) bool {
+	return w.pool.opts.Limit > 0 && w.queued > 0 && w.queued+n > w.pool.opts.Limit
+}
+
+// wait waits until n bytes fit into the queue. A queue that doesn't drain in
+// time is dropped, the connection is closed after the error anyway.
+func (w *Writer) wait(n int) error {
+	expired := false
+	if w.pool.opts.Wait > 0 {
+		t := time.AfterFunc(w.pool.opts.Wait, func() {
+			w.m.Lock()
+			defer w.m.Unlock()
+
+			expired = true
+			w.cond.Broadcast()
+		})
+		defer t.Stop()
+	} else {
+		expired = true
+	}
+
+	for w.err == nil && !w.closed && w.full(n) {
+		if expired {
+			queueFull.Inc("dropped")
+
+			w.err = ErrQueueFull
+			w.drop()
+
+			return w.err
+		}
+
+		w.cond.Wait()
+	}
+
+	queueFull.Inc("throttled")
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.closed {
+		return net.ErrClosed
+	}
+
+	return nil
+}
+
+// drop releases the queued buffers, those being written are released by run.
+func (w *Writer) drop() {
+	dropped := 0
+	for _, b := range w.bufs {
+		dropped += len(b)
+		w.pool.put(b)
+	}
+
+	w.bufs = nil
+	w.queued -= dropped
+	queuedBytes.Add(-int64(dropped))
+}
+
+// Queued returns the bytes waiting to be written.
+func (w *Writer) Queued() int {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.queued
+}
+
+// Close writes what is queued and stops the writer. It waits for the
+// pending writes, a write deadline on the connection bounds them.
+func (w *Writer) Close() error {
+	w.m.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.m.Unlock()
+
+	<-w.done
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.err
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	for {
+		for len(w.bufs) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+
+		if len(w.bufs) == 0 {
+			return
+		}
+
+		// Take at least one buffer and at most a batch
+		n, size := 0, 0
+		for n < len(w.bufs) && (n == 0 || size+len(w.bufs[n]) <= w.pool.opts.Batch) {
+			size += len(w.bufs[n])
+			n++
+		}
+
+		queueDepth.Observe(float64(w.queued))
+
+		w.batch = append(w.batch[:0], w.bufs[:n]...)
+		w.bufs = w.bufs[n:]
+		w.m.Unlock()
+
+		// WriteTo consumes the slice, batch keeps the buffers for the pool
+		bufs := net.Buffers(w.batch)
+		_, err := bufs.WriteTo(w.w)
+		batchBytes.Observe(float64(size))
+
+		for _, b := range w.batch {
+			w.pool.put(b)
+		}
+
+		w.m.Lock()
+		w.queued -= size
+		queuedBytes.Add(-int64(size))
+
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+
+		if w.err != nil {
+			w.drop()
+		}
+
+		w.cond.Broadcast()
+	}
+}
@@ -0,0 +1,176 @@
+package netbuf
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the calls to Write, it blocks them while held.
+type recorder struct {
+	buf    bytes.Buffer
+	writes int
+	err    error
+	hold   sync.Mutex
+	m      sync.Mutex
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.hold.Lock()
+	defer r.hold.Unlock()
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.writes++
+
+	return r.buf.Write(b)
+}
+
+func TestWriterBatches(t *testing.T) {
+	p := New(Options{BufferSize: 64, PoolSize: 8, Batch: 1 << 20})
+	r := &recorder{}
+	w := p.Writer(r)
+
+	// Everything written while the connection is blocked goes out at once
+	r.hold.Lock()
+	for _, s := range []string{"hello", " ", "world"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.hold.Unlock()
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.buf.String() != "hello world" {
+		t.Fatalf("expected hello world, got %q", r.buf.String())
+	}
+
+	// At most the first write went out alone
+	if r.writes > 2 {
+		t.Fatalf("expected the writes to be batched, got %d", r.writes)
+	}
+
+	if len(p.free) == 0 {
+		t.Fatal("expected the buffers to be back in the pool")
+	}
+
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Fatal("expected writing to a closed writer to fail")
+	}
+}
+
+func TestWriterSplits(t *testing.T) {
+	p := New(Options{BufferSize: 4, PoolSize: 8, Batch: 8})
+	r := &recorder{}
+	w := p.Writer(r)
+
+	data := []byte("a packet larger than a buffer")
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(r.buf.Bytes(), data) {
+		t.Fatalf("expected %q, got %q", data, r.buf.Bytes())
+	}
+}
+
+func TestWriterFails(t *testing.T) {
+	p := New(Options{BufferSize: 16, PoolSize: 8, Batch: 1 << 20})
+	errBroken := errors.New("broken pipe")
+	r := &recorder{err: errBroken}
+	w := p.Writer(r)
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); !errors.Is(err, errBroken) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+
+	if w.Queued() != 0 {
+		t.Fatalf("expected nothing to be queued, got %d", w.Queued())
+	}
+}
+
+func TestWriterLimit(t *testing.T) {
+	p := New(Options{BufferSize: 16, PoolSize: 8, Batch: 1 << 20, Limit: 16, Wait: time.Second})
+	r := &recorder{}
+	w := p.Writer(r)
+
+	// The first write may be in flight, together they fill the queue
+	r.hold.Lock()
+	for _, s := range []string{"12345678", "12345678"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The next one waits for the queue to drain
+	written := make(chan error)
+	go func() {
+		_, err := w.Write([]byte("abc"))
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		t.Fatalf("expected the write to wait for the full queue, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.hold.Unlock()
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.buf.String() != "1234567812345678abc" {
+		t.Fatalf("unexpected data %q", r.buf.String())
+	}
+}
+
+func TestWriterDropsFullQueue(t *testing.T) {
+	p := New(Options{BufferSize: 16, PoolSize: 8, Batch: 1 << 20, Limit: 16, Wait: 10 * time.Millisecond})
+	r := &recorder{}
+	w := p.Writer(r)
+
+	r.hold.Lock()
+	for _, s := range []string{"12345678", "12345678"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := w.Write([]byte("abc")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	r.hold.Unlock()
+	_ = w.Close()
+
+	if w.Queued() != 0 {
+		t.Fatalf("expected nothing to be queued, got %d", w.Queued())
+	}
+
+	if _, err := w.Write([]byte("abc")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected writes after a full queue to fail, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package hosting
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+var (
+	networkLogins  = metrics.NewCounterVec("gate_network_logins_total", "Logins by the network they joined.", "network")
+	networkPlayers = metrics.NewGaugeVec("gate_network_players", "Players on this proxy by network.", "network")
+)
+
+// NetworkConfig is configured through the NETWORKS environment variable as a
+// JSON list. Players join the first network with one of their virtual host's
+// patterns, e.g. *.example.com, or the network of their listener. Everyone
+// else joins the network of CSMC_NETWORK.
+type NetworkConfig struct {
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts"`
+}
+
+// Network is a logical network served by this proxy. Its buckets are named
+// like those of the CSMC_NETWORK network with its own name, and it can only
+// open those.
+type Network struct {
+	Name  string
+	Hosts []string
+	Info  *PodInfo
+	kv    *kv.Prefixed
+	// primary is the network of CSMC_NETWORK
+	primary bool
+}
+
+// KV only opens the buckets of the network.
+func (n *Network) KV() kv.Client {
+	return n.kv
+}
+
+func (n *Network) Primary() bool {
+	return n.primary
+}
+
+// ServerPrefix is prepended to the names of the servers of the network when
+// they are registered with Gate, empty for the primary network.
+func (n *Network) ServerPrefix() string {
+	if n.primary {
+		return ""
+	}
+
+	return n.Name + "/"
+}
+
+func (n *Network) matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range n.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+type networks struct {
+	byName map[string]*Network
+	names  []string
+	// assigned are the networks of the players on this proxy
+	assigned map[uuid.UUID]string
+	m        sync.Mutex
+}
+
+func (n *Hosting) initNetworks(raw string) error {
+	cfgs := make([]NetworkConfig, 0)
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfgs); err != nil {
+			return fmt.Errorf("invalid NETWORKS: %w", err)
+		}
+	}
+
+	n.nw.byName = make(map[string]*Network)
+	n.nw.assigned = make(map[uuid.UUID]string)
+
+	add := func(name string, hosts []string) {
+		if nw, ok := n.nw.byName[name]; ok {
+			nw.Hosts = append(nw.Hosts, hosts...)
+			return
+		}
+
+		info := *n.Info
+		info.Network = name
+
+		n.nw.byName[name] = &Network{
+			Name:    name,
+			Hosts:   hosts,
+			Info:    &info,
+			kv:      kv.WithPrefix(n.kv, info.KVNetworkKey()+"_"),
+			primary: name == n.Info.Network,
+		}
+		n.nw.names = append(n.nw.names, name)
+	}
+
+	add(n.Info.Network, nil)
+
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || strings.ContainsAny(cfg.Name, "_/ ") {
+			return fmt.Errorf("invalid network name %q", cfg.Name)
+		}
+
+		add(cfg.Name, cfg.Hosts)
+	}
+
+	return nil
+}
+
+// Networks returns the networks of this proxy, the primary one first.
+func (n *Hosting) Networks() []*Network {
+	networks := make([]*Network, 0, len(n.nw.names))
+	for _, name := range n.nw.names {
+		networks = append(networks, n.nw.byName[name])
+	}
+
+	return networks
+}
+
+func (n *Hosting) Network(name string) (*Network, bool) {
+	nw, ok := n.nw.byName[name]
+	return nw, ok
+}
+
+// PrimaryNetwork is the network of CSMC_NETWORK.
+func (n *Hosting) PrimaryNetwork() *Network {
+	return n.nw.byName[n.Info.Network]
+}
+
+// NetworkForHost returns the network whose host patterns match the virtual
+// host, or the primary one.
+func (n *Hosting) NetworkForHost(host string) *Network {
+	for _, nw := range n.Networks() {
+		if nw.matches(host) {
+			return nw
+		}
+	}
+
+	return n.PrimaryNetwork()
+}
+
+// AssignNetwork puts the player into the named network, e.g. by the listener
+// they connected through. It has to happen before the PostLoginEvent.
+func (n *Hosting) AssignNetwork(player uuid.UUID, name string) error {
+	if _, ok := n.nw.byName[name]; !ok {
+		return fmt.Errorf("unknown network %s", name)
+	}
+
+	n.nw.m.Lock()
+	defer n.nw.m.Unlock()
+
+	n.nw.assigned[player] = name
+
+	return nil
+}
+
+// JoinNetwork resolves the network of a player that logged in, from an
+// assignment or their virtual host, and counts them towards it.
+func (n *Hosting) JoinNetwork(player proxy.Player) *Network {
+	n.nw.m.Lock()
+	defer n.nw.m.Unlock()
+
+	nw := n.PrimaryNetwork()
+	if name, ok := n.nw.assigned[player.ID()]; ok {
+		nw = n.nw.byName[name]
+	} else if vh := player.VirtualHost(); vh != nil {
+		host, _, err := net.SplitHostPort(vh.String())
+		if err != nil {
+			host = vh.String()
+		}
+
+		nw = n.NetworkForHost(host)
+	}
+
+	n.nw.assigned[player.ID()] = nw.Name
+
+	networkLogins.Inc(nw.Name)
+	networkPlayers.Add(1, nw.Name)
+
+	return nw
+}
+
+// LeaveNetwork forgets the network of a player that disconnected.
+func (n *Hosting) LeaveNetwork(player uuid.UUID) {
+	n.nw.m.Lock()
+	defer n.nw.m.Unlock()
+
+	if name, ok := n.nw.assigned[player]; ok {
+		networkPlayers.Add(-1, name)
+		delete(n.nw.assigned, player)
+	}
+}
+
+// PlayerNetwork returns the network a player joined, or the primary one.
+func (n *Hosting) PlayerNetwork(player uuid.UUID) *Network {
+	n.nw.m.Lock()
+	defer n.nw.m.Unlock()
+
+	if name, ok := n.nw.assigned[player]; ok {
+		return n.nw.byName[name]
+	}
+
+	return n.PrimaryNetwork()
+}
+
+type networkState struct {
+	Name    string   `json:"name"`
+	Primary bool     `json:"primary"`
+	Hosts   []string `json:"hosts"`
+	Prefix  string   `json:"prefix"`
+	Players int      `json:"players"`
+}
+
+func (n *Hosting) handleGetNetworks(w http.ResponseWriter, r *http.Request) {
+	n.nw.m.Lock()
+	players := make(map[string]int)
+	for _, name := range n.nw.assigned {
+		players[name]++
+	}
+	n.nw.m.Unlock()
+
+	states := make([]networkState, 0, len(n.nw.names))
+	for _, nw := range n.Networks() {
+		states = append(states, networkState{
+			Name:    nw.Name,
+			Primary: nw.primary,
+			Hosts:   slices.Clone(nw.Hosts),
+			Prefix:  nw.kv.Prefix(),
+			Players: players[nw.Name],
+		})
+	}
+
+	api.WriteJSON(w, http.StatusOK, states)
+}
@@ -0,0 +1,52 @@
+package object
+
+import (
+	"context"
+	"io"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/faults"
+)
+
+var _ Store = &Faulty{}
+
+// Faulty injects the faults of f into every operation of s.
+type Faulty struct {
+	s Store
+	f *faults.Injector
+}
+
+func WithFaults(s Store, f *faults.Injector) *Faulty {
+	return &Faulty{s: s, f: f}
+}
+
+func (s *Faulty) Put(ctx context.Context, name string, r io.Reader) error {
+	if err := s.f.Before(ctx, "put "+name); err != nil {
+		return err
+	}
+
+	return s.s.Put(ctx, name, r)
+}
+
+func (s *Faulty) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := s.f.Before(ctx, "get "+name); err != nil {
+		return nil, err
+	}
+
+	return s.s.Get(ctx, name)
+}
+
+func (s *Faulty) Delete(ctx context.Context, name string) error {
+	if err := s.f.Before(ctx, "delete "+name); err != nil {
+		return err
+	}
+
+	return s.s.Delete(ctx, name)
+}
+
+func (s *Faulty) List(ctx context.Context, prefix string) ([]Info, error) {
+	if err := s.f.Before(ctx, "list "+prefix); err != nil {
+		return nil, err
+	}
+
+	return s.s.List(ctx, prefix)
+}
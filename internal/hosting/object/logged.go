@@ -0,0 +1,61 @@
+package object
+
+import (
+	"context"
+	"io"
+	"log"
+)
+
+var _ Store = &Logged{}
+
+type Logged struct {
+	s Store
+}
+
+func WithLogger(s Store) *Logged {
+	return &Logged{s: s}
+}
+
+func (l *Logged) Put(ctx context.Context, name string, r io.Reader) error {
+	err := l.s.Put(ctx, name, r)
+	if err != nil {
+		log.Printf("ERROR: Put object %s: %v", name, err)
+	} else {
+		log.Printf("INFO: Put object %s", name)
+	}
+
+	return err
+}
+
+func (l *Logged) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := l.s.Get(ctx, name)
+	if err != nil {
+		log.Printf("ERROR: Get object %s: %v", name, err)
+	} else {
+		log.Printf("INFO: Get object %s", name)
+	}
+
+	return r, err
+}
+
+func (l *Logged) Delete(ctx context.Context, name string) error {
+	err := l.s.Delete(ctx, name)
+	if err != nil {
+		log.Printf("ERROR: Delete object %s: %v", name, err)
+	} else {
+		log.Printf("INFO: Delete object %s", name)
+	}
+
+	return err
+}
+
+func (l *Logged) List(ctx context.Context, prefix string) ([]Info, error) {
+	infos, err := l.s.List(ctx, prefix)
+	if err != nil {
+		log.Printf("ERROR: List objects %s: %v", prefix, err)
+	} else {
+		log.Printf("INFO: List objects %s: %d", prefix, len(infos))
+	}
+
+	return infos, err
+}
@@ -0,0 +1,85 @@
+package object
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Store = &Memory{}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+type Memory struct {
+	objects map[string]memoryObject
+	m       sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]memoryObject)}
+}
+
+func (s *Memory) Put(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.objects[name] = memoryObject{data: data, modTime: time.Now()}
+	s.m.Unlock()
+
+	return nil
+}
+
+func (s *Memory) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.m.RLock()
+	o, ok := s.objects[name]
+	s.m.RUnlock()
+
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(o.data)), nil
+}
+
+func (s *Memory) Delete(ctx context.Context, name string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.objects[name]; !ok {
+		return ErrObjectNotFound
+	}
+
+	delete(s.objects, name)
+
+	return nil
+}
+
+func (s *Memory) List(ctx context.Context, prefix string) ([]Info, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	infos := make([]Info, 0)
+	for name, o := range s.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		infos = append(infos, Info{Name: name, Size: int64(len(o.data)), ModTime: o.modTime})
+	}
+
+	slices.SortFunc(infos, func(a, b Info) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return infos, nil
+}
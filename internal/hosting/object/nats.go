@@ -0,0 +1,86 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var _ Store = &NATS{}
+
+type NATSOptions struct {
+	URL    string `json:"url"`
+	Bucket string `json:"bucket"`
+}
+
+// NATS stores objects in a JetStream object store, which chunks them so they
+// are not limited by the maximum message size.
+type NATS struct {
+	obs jetstream.ObjectStore
+}
+
+func NewNATS(ctx context.Context, js jetstream.JetStream, bucket string) (*NATS, error) {
+	obs, err := js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: bucket})
+	if err != nil {
+		obs, err = js.ObjectStore(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &NATS{obs: obs}, nil
+}
+
+func (s *NATS) Put(ctx context.Context, name string, r io.Reader) error {
+	_, err := s.obs.Put(ctx, jetstream.ObjectMeta{Name: name}, r)
+
+	return err
+}
+
+func (s *NATS) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	res, err := s.obs.Get(ctx, name)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, ErrObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *NATS) Delete(ctx context.Context, name string) error {
+	err := s.obs.Delete(ctx, name)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return ErrObjectNotFound
+	}
+
+	return err
+}
+
+func (s *NATS) List(ctx context.Context, prefix string) ([]Info, error) {
+	objects, err := s.obs.List(ctx)
+	if errors.Is(err, jetstream.ErrNoObjectsFound) {
+		return make([]Info, 0), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	infos := make([]Info, 0, len(objects))
+	for _, o := range objects {
+		if o.Deleted || !strings.HasPrefix(o.Name, prefix) {
+			continue
+		}
+
+		infos = append(infos, Info{Name: o.Name, Size: int64(o.Size), ModTime: o.ModTime})
+	}
+
+	slices.SortFunc(infos, func(a, b Info) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return infos, nil
+}
@@ -0,0 +1,30 @@
+// Package object stores large blobs (resource packs, schematics, backups, log
+// archives) that don't belong into KV values.
+package object
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrObjectNotFound = errors.New("object not found")
+)
+
+type Info struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+type Store interface {
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Get returns ErrObjectNotFound if the object does not exist. The caller
+	// has to close the reader.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+	// List returns the objects whose name starts with prefix, sorted by name.
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
@@ -0,0 +1,131 @@
+package hosting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+)
+
+// ErrNotDecoded is returned for a connected player whose packets aren't
+// decoded, because they are encrypted or not on an additional listener.
+var ErrNotDecoded = errors.New("packets of the player can't be decoded, only offline listener connections can")
+
+// Packets captures the packets of connections that plugins tap, e.g. those
+// of the additional listeners.
+func (n *Hosting) Packets() *packets.Inspector {
+	return n.pkt
+}
+
+// PacketsDecoded reports whether the packets of the player can be captured
+// or recorded. Only players connected to this proxy are known, others may
+// still join through an offline listener.
+func (n *Hosting) PacketsDecoded(player string) bool {
+	prx := n.prx.Load()
+	if prx == nil || prx.PlayerByName(player) == nil {
+		return true
+	}
+
+	return n.pkt.Decodes(player)
+}
+
+func (n *Hosting) CapturePackets(ctx context.Context, actor string, f packets.Filter) error {
+	if f.Player != "" && !n.PacketsDecoded(f.Player) {
+		return fmt.Errorf("%s: %w", f.Player, ErrNotDecoded)
+	}
+
+	n.pkt.Start(f)
+
+	ids := make([]string, 0, len(f.IDs))
+	for _, id := range f.IDs {
+		ids = append(ids, fmt.Sprintf("0x%02X", id))
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "packets.capture",
+		Target:  f.Player,
+		Details: map[string]string{"ids": strings.Join(ids, ","), "direction": string(f.Direction)},
+	})
+}
+
+func (n *Hosting) StopPackets(ctx context.Context, actor string) error {
+	n.pkt.Stop()
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "packets.stop"})
+}
+
+// DumpPackets stores the captured packets as JSON lines in the object store
+// and returns the name of the object.
+func (n *Hosting) DumpPackets(ctx context.Context) (string, error) {
+	buf := bytes.Buffer{}
+	if err := n.pkt.Dump(&buf); err != nil {
+		return "", err
+	}
+
+	name := "debug/packets/" + n.Info.PodName + "-" + strconv.FormatInt(time.Now().Unix(), 10) + ".jsonl"
+
+	return name, n.obj.Put(ctx, name, &buf)
+}
+
+type packetsResponse struct {
+	Capturing bool             `json:"capturing"`
+	Filter    packets.Filter   `json:"filter"`
+	Packets   []packets.Packet `json:"packets"`
+}
+
+func (n *Hosting) handleGetPackets(w http.ResponseWriter, r *http.Request) {
+	f, ok := n.pkt.Filter()
+
+	api.WriteJSON(w, http.StatusOK, packetsResponse{Capturing: ok, Filter: f, Packets: n.pkt.Packets()})
+}
+
+func (n *Hosting) handleCapturePackets(w http.ResponseWriter, r *http.Request) {
+	f := packets.Filter{}
+	if err := api.ReadJSON(r, &f); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if f.Direction != "" && f.Direction != packets.Serverbound && f.Direction != packets.Clientbound {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid direction %q", f.Direction))
+		return
+	}
+
+	if err := n.CapturePackets(r.Context(), "api", f); errors.Is(err, ErrNotDecoded) {
+		api.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, f)
+}
+
+func (n *Hosting) handleStopPackets(w http.ResponseWriter, r *http.Request) {
+	if err := n.StopPackets(r.Context(), "api"); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Hosting) handleDumpPackets(w http.ResponseWriter, r *http.Request) {
+	name, err := n.DumpPackets(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]string{"name": name})
+}
@@ -0,0 +1,145 @@
+package packets
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"sync"
+)
+
+var errVarInt = errors.New("varint is too big")
+
+// readVarInt returns the value and its length, n is 0 if b ends before the
+// varint does.
+func readVarInt(b []byte) (v int, n int, err error) {
+	var u uint32
+	for i := 0; i < 5; i++ {
+		if i >= len(b) {
+			return 0, 0, nil
+		}
+
+		u |= uint32(b[i]&0x7F) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return int(int32(u)), i + 1, nil
+		}
+	}
+
+	return 0, 0, errVarInt
+}
+
+// readString reads a string prefixed with its length as a varint.
+func readString(b []byte) (string, int, bool) {
+	l, n, err := readVarInt(b)
+	if err != nil || n == 0 || l < 0 || n+l > len(b) {
+		return "", 0, false
+	}
+
+	return string(b[n : n+l]), n + l, true
+}
+
+// decoder keeps what is left of the frames of one direction of a
+// connection. It is fed the bytes as they are read or written, frames may
+// span several calls.
+type decoder struct {
+	// buf is the start of a frame that isn't complete yet
+	buf []byte
+	// skip is the rest of a frame that is passed through
+	skip int
+}
+
+// zlibReaders are reused, every new one allocates its window.
+var zlibReaders sync.Pool
+
+func inflate(src io.Reader) (io.ReadCloser, error) {
+	if r, ok := zlibReaders.Get().(io.ReadCloser); ok {
+		if err := r.(zlib.Resetter).Reset(src, nil); err != nil {
+			return nil, err
+		}
+
+		return r, nil
+	}
+
+	return zlib.NewReader(src)
+}
+
+// peekID reads the packet ID from the start of a frame, false if head ends
+// before it. Compressed packets are inflated until the ID, which needs the
+// whole frame.
+func peekID(head []byte, l int, compressed bool) (int, bool) {
+	if compressed {
+		dl, n, err := readVarInt(head)
+		if err != nil || n == 0 {
+			return 0, false
+		}
+		head = head[n:]
+
+		if dl > 0 {
+			if len(head) < l-n {
+				return 0, false
+			}
+
+			r, err := inflate(bytes.NewReader(head))
+			if err != nil {
+				return 0, false
+			}
+			defer zlibReaders.Put(r)
+
+			var id [5]byte
+			read := 0
+			for read < len(id) {
+				if _, err := r.Read(id[read : read+1]); err != nil {
+					break
+				}
+				read++
+
+				if id[read-1]&0x80 == 0 {
+					break
+				}
+			}
+			head = id[:read]
+		}
+	}
+
+	id, n, err := readVarInt(head)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// uncompress returns the packet of a frame, which starts with the length
+// of the uncompressed packet once compression is enabled, 0 if the packet is
+// not compressed.
+func uncompress(frame []byte, compressed bool) ([]byte, error) {
+	if !compressed {
+		return frame, nil
+	}
+
+	l, n, err := readVarInt(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if l == 0 {
+		return frame[n:], nil
+	}
+
+	r, err := inflate(bytes.NewReader(frame[n:]))
+	if err != nil {
+		return nil, err
+	}
+	defer zlibReaders.Put(r)
+
+	packet := make([]byte, l)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
@@ -0,0 +1,481 @@
+// Package packets decodes the packets of proxied connections for debugging.
+// The inspector keeps the packets matching a filter, e.g. of one player or
+// packet ID, in a ring buffer that can be read or dumped at runtime, and
+// hands the packets of the players they want to observers like recorders.
+//
+// Connections are decoded from their bytes on the wire, so packets can only
+// be seen until the connection enables encryption, i.e. for offline mode
+// connections throughout and for online mode ones until login.
+package packets
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Direction string
+
+const (
+	Serverbound Direction = "serverbound"
+	Clientbound Direction = "clientbound"
+)
+
+type State string
+
+const (
+	Handshake State = "handshake"
+	Status    State = "status"
+	Login     State = "login"
+	// Game covers configuration and play, telling them apart needs the
+	// packet IDs of every version.
+	Game State = "game"
+)
+
+// maxBuffered drops connections whose frames can't be made sense of.
+const maxBuffered = 4 << 20
+
+// maxReused is the largest buffer kept for the next frames of a connection.
+const maxReused = 64 << 10
+
+type Packet struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Player    string    `json:"player,omitempty"`
+	Protocol  int       `json:"protocol,omitempty"`
+	Direction Direction `json:"direction"`
+	State     State     `json:"state"`
+	ID        int       `json:"id"`
+	// Length of the packet, Data may be cut short.
+	Length int    `json:"length"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+type Filter struct {
+	// Player is matched case-insensitively, "" matches every connection.
+	Player    string    `json:"player,omitempty"`
+	IDs       []int     `json:"ids,omitempty"`
+	Direction Direction `json:"direction,omitempty"`
+}
+
+func (f Filter) matchesConn(player string) bool {
+	return f.Player == "" || strings.EqualFold(f.Player, player)
+}
+
+func (f Filter) matches(p Packet) bool {
+	return f.matchesConn(p.Player) &&
+		(f.Direction == "" || f.Direction == p.Direction) &&
+		(len(f.IDs) == 0 || slices.Contains(f.IDs, p.ID))
+}
+
+// Observer is handed every packet of the players it wants, with all of its
+// data. It is called on the connection of the player and must not block.
+type Observer interface {
+	Wants(player string) bool
+	Observe(p Packet)
+}
+
+type Inspector struct {
+	filter *Filter
+	// passthrough is replaced as a whole, never modified
+	passthrough []Filter
+	ring        []Packet
+	next        int
+	size        int
+	maxData     int
+	observers   []Observer
+	m           sync.RWMutex
+
+	// conns are the open connections, for Decodes
+	conns  map[*Conn]struct{}
+	connsM sync.Mutex
+}
+
+// New keeps the last size packets, with at most maxData bytes of each.
+func New(size, maxData int) *Inspector {
+	return &Inspector{size: size, maxData: maxData, conns: make(map[*Conn]struct{})}
+}
+
+// Decodes reports whether the game packets of the player are decoded, i.e.
+// whether they are on a tapped connection that isn't encrypted. Players
+// that aren't connected through one aren't decoded.
+func (i *Inspector) Decodes(player string) bool {
+	i.connsM.Lock()
+	conns := make([]*Conn, 0, len(i.conns))
+	for c := range i.conns {
+		conns = append(conns, c)
+	}
+	i.connsM.Unlock()
+
+	for _, c := range conns {
+		c.m.Lock()
+		ok := strings.EqualFold(c.player, player) && c.state == Game && !c.done
+		c.m.Unlock()
+
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Start captures the packets matching the filter, replacing the previous
+// capture.
+func (i *Inspector) Start(f Filter) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.filter = &f
+	i.ring = make([]Packet, 0, i.size)
+	i.next = 0
+}
+
+// Stop stops capturing, the captured packets are kept until the next Start.
+func (i *Inspector) Stop() {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.filter = nil
+}
+
+// Filter returns the filter of the capture, false if nothing is captured.
+func (i *Inspector) Filter() (Filter, bool) {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	if i.filter == nil {
+		return Filter{}, false
+	}
+
+	return *i.filter, true
+}
+
+// SetPassthrough passes the game packets matching one of the filters
+// through without decoding them, so they are neither captured nor observed.
+// Filters without IDs don't need the packet to be read at all, the others
+// read its ID.
+func (i *Inspector) SetPassthrough(filters []Filter) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.passthrough = filters
+}
+
+func (i *Inspector) passthroughFilters() []Filter {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	return i.passthrough
+}
+
+// Observe adds an observer, for the lifetime of the inspector.
+func (i *Inspector) Observe(o Observer) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.observers = append(i.observers, o)
+}
+
+// wants reports whether packets of the player may have to be captured or
+// observed.
+func (i *Inspector) wants(player string) bool {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	if i.filter != nil && i.filter.matchesConn(player) {
+		return true
+	}
+
+	for _, o := range i.observers {
+		if o.Wants(player) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i *Inspector) record(p Packet) {
+	i.m.RLock()
+	observers := i.observers
+	i.m.RUnlock()
+
+	for _, o := range observers {
+		if o.Wants(p.Player) {
+			observed := p
+			observed.Data = slices.Clone(p.Data)
+			o.Observe(observed)
+		}
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if i.filter == nil || !i.filter.matches(p) {
+		return
+	}
+
+	if len(p.Data) > i.maxData {
+		p.Data = p.Data[:i.maxData]
+	}
+	p.Data = slices.Clone(p.Data)
+
+	if len(i.ring) < i.size {
+		i.ring = append(i.ring, p)
+		return
+	}
+
+	i.ring[i.next] = p
+	i.next = (i.next + 1) % i.size
+}
+
+// Packets returns the captured packets, oldest first.
+func (i *Inspector) Packets() []Packet {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	packets := make([]Packet, 0, len(i.ring))
+	packets = append(packets, i.ring[i.next:]...)
+
+	return append(packets, i.ring[:i.next]...)
+}
+
+// Dump writes the captured packets as JSON lines.
+func (i *Inspector) Dump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, p := range i.Packets() {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Conn decodes the packets of a connection. Serverbound and Clientbound are
+// fed what the proxy reads from and writes to the client.
+type Conn struct {
+	in     *Inspector
+	remote string
+
+	protocol   int
+	player     string
+	state      State
+	compressed bool
+	// done is set once the connection is encrypted or can't be decoded
+	done bool
+	dec  map[Direction]*decoder
+	m    sync.Mutex
+}
+
+// Conn starts decoding a connection, it must be closed with it.
+func (i *Inspector) Conn(remote string) *Conn {
+	c := &Conn{
+		in:     i,
+		remote: remote,
+		state:  Handshake,
+		dec:    map[Direction]*decoder{Serverbound: {}, Clientbound: {}},
+	}
+
+	i.connsM.Lock()
+	i.conns[c] = struct{}{}
+	i.connsM.Unlock()
+
+	return c
+}
+
+// Close stops decoding the connection.
+func (c *Conn) Close() {
+	c.m.Lock()
+	c.done = true
+	c.m.Unlock()
+
+	c.in.connsM.Lock()
+	delete(c.in.conns, c)
+	c.in.connsM.Unlock()
+}
+
+func (c *Conn) Serverbound(b []byte) {
+	c.feed(Serverbound, b)
+}
+
+func (c *Conn) Clientbound(b []byte) {
+	c.feed(Clientbound, b)
+}
+
+func (c *Conn) feed(dir Direction, b []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.done {
+		return
+	}
+
+	d := c.dec[dir]
+
+	// The rest of a frame that is passed through
+	n := min(d.skip, len(b))
+	d.skip -= n
+	b = b[n:]
+
+	// Complete frames are read from b directly, only a frame that isn't
+	// complete yet is buffered
+	data := b
+	if len(d.buf) > 0 {
+		d.buf = append(d.buf, b...)
+		data = d.buf
+	}
+
+	for !c.done && len(data) > 0 {
+		l, n, err := readVarInt(data)
+		if err != nil || l < 0 {
+			c.done = true
+			break
+		}
+
+		if n == 0 {
+			break
+		}
+
+		if c.passes(dir, data[n:min(len(data), n+l)], l) {
+			if n+l > len(data) {
+				d.skip = n + l - len(data)
+				data = nil
+				break
+			}
+
+			data = data[n+l:]
+			continue
+		}
+
+		if n+l > len(data) {
+			break
+		}
+
+		c.decode(dir, data[n:n+l])
+		data = data[n+l:]
+	}
+
+	if c.done || len(data) > maxBuffered {
+		c.done = true
+		d.buf = nil
+		return
+	}
+
+	// The buffer is reused unless it grew with a large frame
+	if len(data) == 0 && cap(d.buf) > maxReused {
+		d.buf = nil
+		return
+	}
+
+	d.buf = append(d.buf[:0], data...)
+}
+
+// passes reports whether a frame of length l is passed through without
+// being decoded, head is as much of it as was read. Frames in the game state
+// are only decoded while they are captured or observed and don't match the
+// passthrough filters.
+func (c *Conn) passes(dir Direction, head []byte, l int) bool {
+	if c.state != Game {
+		return false
+	}
+
+	if !c.in.wants(c.player) {
+		return true
+	}
+
+	byID := false
+	for _, f := range c.in.passthroughFilters() {
+		if !f.matchesConn(c.player) || (f.Direction != "" && f.Direction != dir) {
+			continue
+		}
+
+		if len(f.IDs) == 0 {
+			return true
+		}
+
+		byID = true
+	}
+
+	if !byID {
+		return false
+	}
+
+	id, ok := peekID(head, l, c.compressed)
+
+	return ok && slices.ContainsFunc(c.in.passthroughFilters(), func(f Filter) bool {
+		return f.matches(Packet{Player: c.player, Direction: dir, ID: id}) && len(f.IDs) > 0
+	})
+}
+
+// decode records a frame and follows the state of the connection.
+func (c *Conn) decode(dir Direction, frame []byte) {
+	packet, err := uncompress(frame, c.compressed)
+	if err != nil {
+		c.done = true
+		return
+	}
+
+	id, n, err := readVarInt(packet)
+	if err != nil || n == 0 {
+		c.done = true
+		return
+	}
+
+	p := Packet{
+		Time:      time.Now(),
+		Remote:    c.remote,
+		Player:    c.player,
+		Protocol:  c.protocol,
+		Direction: dir,
+		State:     c.state,
+		ID:        id,
+		Length:    len(packet),
+		Data:      packet[n:],
+	}
+
+	c.advance(dir, id, packet[n:])
+	if p.Player == "" {
+		p.Player = c.player
+	}
+
+	c.in.record(p)
+}
+
+// advance follows the connection through the handshake and login.
+func (c *Conn) advance(dir Direction, id int, data []byte) {
+	switch {
+	case c.state == Handshake && dir == Serverbound && id == 0x00:
+		protocol, n, err := readVarInt(data)
+		if err != nil || n == 0 {
+			return
+		}
+		c.protocol = protocol
+
+		_, l, ok := readString(data[n:])
+		if !ok || len(data) < n+l+2 {
+			return
+		}
+
+		next, _, _ := readVarInt(data[n+l+2:])
+		if next == 1 {
+			c.state = Status
+		} else {
+			c.state = Login
+		}
+	case c.state == Login && dir == Serverbound && id == 0x00:
+		c.player, _, _ = readString(data)
+	case c.state == Login && dir == Clientbound && id == 0x01:
+		// Encryption request, the client encrypts everything after its
+		// response
+		c.done = true
+	case c.state == Login && dir == Clientbound && id == 0x02:
+		c.state = Game
+	case c.state == Login && dir == Clientbound && id == 0x03:
+		c.compressed = true
+	}
+}
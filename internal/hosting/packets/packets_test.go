@@ -0,0 +1,302 @@
+package packets
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+)
+
+func varInt(v int) []byte {
+	var b []byte
+	u := uint32(v)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+
+	return append(b, byte(u))
+}
+
+func str(s string) []byte {
+	return append(varInt(len(s)), s...)
+}
+
+// frame builds a frame of the packet, compressed like the proxy would once
+// compression is enabled.
+func frame(id int, data []byte, compressed bool) []byte {
+	packet := append(varInt(id), data...)
+
+	if compressed {
+		buf := bytes.Buffer{}
+		w := zlib.NewWriter(&buf)
+		_, _ = w.Write(packet)
+		_ = w.Close()
+
+		packet = append(varInt(len(packet)), buf.Bytes()...)
+	}
+
+	return append(varInt(len(packet)), packet...)
+}
+
+func handshake(protocol, next int) []byte {
+	data := append(varInt(protocol), str("play.example.com")...)
+	data = append(data, 0x63, 0xDD)
+
+	return frame(0x00, append(data, varInt(next)...), false)
+}
+
+func TestConnLogin(t *testing.T) {
+	in := New(10, 16)
+	in.Start(Filter{Player: "notch"})
+
+	c := in.Conn("127.0.0.1:50000")
+
+	// Frames split at arbitrary points
+	stream := append(handshake(767, 2), frame(0x00, str("Notch"), false)...)
+	c.Serverbound(stream[:3])
+	c.Serverbound(stream[3:])
+
+	c.Clientbound(frame(0x03, varInt(256), false))
+	c.Clientbound(frame(0x02, []byte{1, 2, 3}, true))
+	c.Serverbound(frame(0x03, nil, true))
+	c.Clientbound(frame(0x27, bytes.Repeat([]byte{7}, 100), true))
+
+	// The handshake comes before the name, so it doesn't match the filter
+	packets := in.Packets()
+	if len(packets) != 5 {
+		t.Fatalf("expected 5 packets, got %d: %+v", len(packets), packets)
+	}
+
+	want := []struct {
+		dir   Direction
+		state State
+		id    int
+	}{
+		{Serverbound, Login, 0x00},
+		{Clientbound, Login, 0x03},
+		{Clientbound, Login, 0x02},
+		{Serverbound, Game, 0x03},
+		{Clientbound, Game, 0x27},
+	}
+
+	for i, w := range want {
+		p := packets[i]
+		if p.Direction != w.dir || p.State != w.state || p.ID != w.id {
+			t.Errorf("packet %d: expected %s %s 0x%02X, got %s %s 0x%02X", i, w.dir, w.state, w.id, p.Direction, p.State, p.ID)
+		}
+
+		if p.Player != "Notch" || p.Protocol != 767 {
+			t.Errorf("packet %d: expected Notch on 767, got %q on %d", i, p.Player, p.Protocol)
+		}
+	}
+
+	last := packets[4]
+	if last.Length != 101 || len(last.Data) != 16 {
+		t.Fatalf("expected the data cut to 16 of 101 bytes, got %d of %d", len(last.Data), last.Length)
+	}
+}
+
+func TestConnEncrypted(t *testing.T) {
+	in := New(10, 16)
+	in.Start(Filter{})
+
+	c := in.Conn("127.0.0.1:50000")
+	c.Serverbound(append(handshake(767, 2), frame(0x00, str("Notch"), false)...))
+	c.Clientbound(frame(0x01, []byte{0, 0}, false))
+	c.Serverbound([]byte{0xDE, 0xAD, 0xBE, 0xEF})
+
+	if n := len(in.Packets()); n != 3 {
+		t.Fatalf("expected decoding to stop at the encryption request, got %d packets", n)
+	}
+}
+
+func TestFilterAndRing(t *testing.T) {
+	in := New(2, 16)
+	in.Start(Filter{Player: "Notch", IDs: []int{0x10}, Direction: Serverbound})
+
+	notch := in.Conn("127.0.0.1:50000")
+	notch.Serverbound(append(handshake(767, 2), frame(0x00, str("Notch"), false)...))
+	notch.Clientbound(frame(0x02, nil, false))
+
+	jeb := in.Conn("127.0.0.1:50001")
+	jeb.Serverbound(append(handshake(767, 2), frame(0x00, str("jeb_"), false)...))
+	jeb.Clientbound(frame(0x02, nil, false))
+
+	for i := byte(0); i < 3; i++ {
+		notch.Serverbound(frame(0x10, []byte{i}, false))
+		notch.Serverbound(frame(0x11, []byte{i}, false))
+		notch.Clientbound(frame(0x10, []byte{i}, false))
+		jeb.Serverbound(frame(0x10, []byte{i}, false))
+	}
+
+	packets := in.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("expected the ring to hold 2 packets, got %d", len(packets))
+	}
+
+	for i, p := range packets {
+		if p.Player != "Notch" || p.ID != 0x10 || p.Direction != Serverbound || p.Data[0] != byte(i+1) {
+			t.Errorf("unexpected packet %d: %+v", i, p)
+		}
+	}
+
+	in.Stop()
+	notch.Serverbound(frame(0x10, []byte{9}, false))
+
+	if len(in.Packets()) != 2 {
+		t.Fatal("expected no packets to be captured after Stop")
+	}
+
+	if _, ok := in.Filter(); ok {
+		t.Fatal("expected no filter after Stop")
+	}
+}
+
+// noise doesn't compress, so frames keep their size.
+func noise(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*i + i>>8)
+	}
+
+	return b
+}
+
+// blocks compresses like chunk data, runs of a few different values.
+func blocks(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i / 64 % 7)
+	}
+
+	return b
+}
+
+// small builds a frame below the compression threshold.
+func small(id int, data []byte) []byte {
+	packet := append(varInt(0), append(varInt(id), data...)...)
+
+	return append(varInt(len(packet)), packet...)
+}
+
+// login returns a connection of Notch in the game state, with compression.
+func login(in *Inspector) *Conn {
+	c := in.Conn("127.0.0.1:50000")
+	c.Serverbound(append(handshake(767, 2), frame(0x00, str("Notch"), false)...))
+	c.Clientbound(frame(0x03, varInt(256), false))
+	c.Clientbound(frame(0x02, nil, true))
+
+	return c
+}
+
+func TestPassthrough(t *testing.T) {
+	in := New(10, 16)
+	in.SetPassthrough([]Filter{{Direction: Clientbound, IDs: []int{0x27}}, {Direction: Serverbound}})
+	in.Start(Filter{})
+
+	c := login(in)
+	before := len(in.Packets())
+
+	// A passed through frame split across writes doesn't throw off the
+	// frames after it
+	chunk := frame(0x27, noise(1000), true)
+	c.Clientbound(chunk[:10])
+	c.Clientbound(append(chunk[10:], frame(0x28, []byte{1}, true)...))
+	c.Clientbound(append(small(0x27, []byte{2}), small(0x29, []byte{3})...))
+	c.Serverbound(frame(0x10, []byte{4}, true))
+
+	packets := in.Packets()[before:]
+	if len(packets) != 2 || packets[0].ID != 0x28 || packets[1].ID != 0x29 {
+		t.Fatalf("expected only 0x28 and 0x29 to be decoded, got %+v", packets)
+	}
+}
+
+func TestPassthroughUncaptured(t *testing.T) {
+	in := New(10, 16)
+	c := login(in)
+
+	// Frames of connections nobody looks at aren't buffered
+	chunk := frame(0x27, noise(1000), true)
+	c.Clientbound(chunk[:500])
+
+	if d := c.dec[Clientbound]; len(d.buf) != 0 || d.skip != len(chunk)-500 {
+		t.Fatalf("expected the rest of the frame to be skipped, got %d buffered and %d to skip", len(d.buf), d.skip)
+	}
+
+	c.Clientbound(chunk[500:])
+	in.Start(Filter{})
+	c.Clientbound(frame(0x28, nil, true))
+
+	if packets := in.Packets(); len(packets) != 1 || packets[0].ID != 0x28 {
+		t.Fatalf("expected the frame after the skipped one to be decoded, got %+v", packets)
+	}
+}
+
+// BenchmarkConnGame feeds chunk-sized game frames, decoded for a capture
+// and passed through by direction, by ID and for connections nobody looks
+// at.
+func BenchmarkConnGame(b *testing.B) {
+	chunk := frame(0x27, blocks(64<<10), true)
+
+	benchmarks := []struct {
+		name        string
+		capture     bool
+		passthrough []Filter
+	}{
+		{"decoded", true, nil},
+		{"passthrough-direction", true, []Filter{{Direction: Clientbound}}},
+		{"passthrough-id", true, []Filter{{IDs: []int{0x27}}}},
+		{"uncaptured", false, nil},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			in := New(10, 16)
+			in.SetPassthrough(bm.passthrough)
+			if bm.capture {
+				in.Start(Filter{IDs: []int{0x00}})
+			}
+
+			c := login(in)
+
+			b.SetBytes(int64(len(chunk)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			// Written in parts like the proxy does
+			for i := 0; i < b.N; i++ {
+				c.Clientbound(chunk[:len(chunk)/2])
+				c.Clientbound(chunk[len(chunk)/2:])
+			}
+		})
+	}
+}
+
+func TestDecodes(t *testing.T) {
+	in := New(10, 16)
+
+	offline := in.Conn("127.0.0.1:50000")
+	offline.Serverbound(append(handshake(767, 2), frame(0x00, str("Notch"), false)...))
+	offline.Clientbound(frame(0x02, []byte{1, 2, 3}, false))
+
+	online := in.Conn("127.0.0.1:50001")
+	online.Serverbound(append(handshake(767, 2), frame(0x00, str("jeb_"), false)...))
+	online.Clientbound(frame(0x01, []byte{0, 0}, false))
+
+	if !in.Decodes("notch") {
+		t.Fatal("expected the offline connection to be decoded")
+	}
+
+	if in.Decodes("jeb_") {
+		t.Fatal("expected the encrypted connection not to be decoded")
+	}
+
+	if in.Decodes("Dinnerbone") {
+		t.Fatal("expected a player without a tapped connection not to be decoded")
+	}
+
+	offline.Close()
+	if in.Decodes("Notch") {
+		t.Fatal("expected a closed connection not to be decoded")
+	}
+}
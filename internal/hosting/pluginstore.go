@@ -0,0 +1,125 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+type pluginStores struct {
+	quota  kv.Quota
+	stores map[string]*kv.QuotaBucket
+	m      sync.Mutex
+}
+
+// PluginStore returns the bucket of a plugin, limited by PLUGIN_STORE_MAX_KEYS
+// and PLUGIN_STORE_MAX_BYTES. Every plugin gets a bucket of its own, so it
+// can't flood the buckets of others and its data can be wiped on its own.
+func (n *Hosting) PluginStore(ctx context.Context, plugin string) (*kv.QuotaBucket, error) {
+	name := strings.ToLower(plugin)
+	if !pluginNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid plugin store name %q", plugin)
+	}
+
+	n.ps.m.Lock()
+	defer n.ps.m.Unlock()
+
+	if s, ok := n.ps.stores[name]; ok {
+		return s, nil
+	}
+
+	b, err := n.kv.Bucket(ctx, n.Info.KVPluginKey(name))
+	if err != nil {
+		return nil, err
+	}
+
+	s := kv.WithQuota(b, n.ps.quota)
+	n.ps.stores[name] = s
+
+	return s, nil
+}
+
+// WipePluginStore deletes all data of a plugin and returns how many keys
+// were deleted.
+func (n *Hosting) WipePluginStore(ctx context.Context, actor, plugin string) (int, error) {
+	s, err := n.PluginStore(ctx, plugin)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := s.Wipe(ctx)
+	if err != nil {
+		return deleted, err
+	}
+
+	return deleted, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "pluginstore.wipe",
+		Target:  plugin,
+		Details: map[string]string{"keys": strconv.Itoa(deleted)},
+	})
+}
+
+type pluginStoreResponse struct {
+	Plugin string   `json:"plugin"`
+	Usage  kv.Usage `json:"usage"`
+	Quota  kv.Quota `json:"quota"`
+}
+
+// handleListPluginStores lists the stores opened on this proxy.
+func (n *Hosting) handleListPluginStores(w http.ResponseWriter, r *http.Request) {
+	n.ps.m.Lock()
+	names := make([]string, 0, len(n.ps.stores))
+	for name := range n.ps.stores {
+		names = append(names, name)
+	}
+	n.ps.m.Unlock()
+
+	slices.Sort(names)
+
+	res := make([]pluginStoreResponse, 0, len(names))
+	for _, name := range names {
+		s, err := n.PluginStore(r.Context(), name)
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		usage, err := s.Usage(r.Context())
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		res = append(res, pluginStoreResponse{Plugin: name, Usage: usage, Quota: s.Quota()})
+	}
+
+	api.WriteJSON(w, http.StatusOK, res)
+}
+
+func (n *Hosting) handleWipePluginStore(w http.ResponseWriter, r *http.Request) {
+	plugin := r.PathValue("plugin")
+	if !pluginNamePattern.MatchString(strings.ToLower(plugin)) {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid plugin store name %q", plugin))
+		return
+	}
+
+	deleted, err := n.WipePluginStore(r.Context(), "api", plugin)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
@@ -10,6 +10,9 @@ type PodInfo struct {
 	Network      string
 	PodName      string
 	PodNamespace string
+	// Region is where the proxy runs, e.g. eu, "" if the network has no
+	// regions.
+	Region string
 }
 
 func ParsePodInfo() *PodInfo {
@@ -17,6 +20,7 @@ func ParsePodInfo() *PodInfo {
 		Network:      os.Getenv("CSMC_NETWORK"),
 		PodName:      os.Getenv("POD_NAME"),
 		PodNamespace: os.Getenv("POD_NAMESPACE"),
+		Region:       os.Getenv("CSMC_REGION"),
 	}
 
 	if info.Network == "" {
@@ -41,8 +45,55 @@ func (p PodInfo) RPCNetworkSubject() string {
 	return fmt.Sprintf("csmc.%s.%s", p.PodNamespace, p.Network)
 }
 
+func (p PodInfo) MatchmakingSlotsSubject() string {
+	return fmt.Sprintf("%s.matchmaking.slots", p.RPCNetworkSubject())
+}
+
+// BridgeSubject carries plugin messages for players on another proxy.
+func (p PodInfo) BridgeSubject() string {
+	return fmt.Sprintf("%s.bridge", p.RPCNetworkSubject())
+}
+
+// BridgeReplySubject carries the responses to bridge requests of a proxy.
+func (p PodInfo) BridgeReplySubject(pod string) string {
+	return fmt.Sprintf("%s.replies.%s", p.BridgeSubject(), pod)
+}
+
+// ClusterSubject carries the restart coordination messages for a proxy.
+func (p PodInfo) ClusterSubject(pod string) string {
+	return fmt.Sprintf("%s.cluster.%s", p.RPCNetworkSubject(), pod)
+}
+
+// BungeeSubject carries bungeecord plugin messages for players on another
+// proxy.
+func (p PodInfo) BungeeSubject() string {
+	return fmt.Sprintf("%s.bungee", p.RPCNetworkSubject())
+}
+
+// AnalyticsSubject carries the analytics events of players, one subject per
+// event type below it.
+func (p PodInfo) AnalyticsSubject() string {
+	return fmt.Sprintf("%s.analytics", p.RPCNetworkSubject())
+}
+
+// PermissionsSubject carries the group changes of players.
+func (p PodInfo) PermissionsSubject() string {
+	return fmt.Sprintf("%s.permissions", p.RPCNetworkSubject())
+}
+
+// MailSubject carries the players that got mail, for the proxy they are on.
+func (p PodInfo) MailSubject() string {
+	return fmt.Sprintf("%s.mail", p.RPCNetworkSubject())
+}
+
+// RestartsSubject carries changes to the scheduled restarts and the restarts
+// the leader finished.
+func (p PodInfo) RestartsSubject() string {
+	return fmt.Sprintf("%s.restarts", p.RPCNetworkSubject())
+}
+
 func (p PodInfo) DebugString() string {
-	return fmt.Sprintf("PodInfo{Network: %s, PodName: %s, PodNamespace: %s}", p.Network, p.PodName, p.PodNamespace)
+	return fmt.Sprintf("PodInfo{Network: %s, PodName: %s, PodNamespace: %s, Region: %s}", p.Network, p.PodName, p.PodNamespace, p.Region)
 }
 
 func (p PodInfo) KVNetworkKey() string {
@@ -53,6 +104,89 @@ func (p PodInfo) KVGamemodesKey() string {
 	return fmt.Sprintf("%s_gamemodes", p.KVNetworkKey())
 }
 
+func (p PodInfo) KVModerationKey() string {
+	return fmt.Sprintf("%s_moderation", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVRoutingKey() string {
+	return fmt.Sprintf("%s_routing", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVExperimentsKey() string {
+	return fmt.Sprintf("%s_experiments", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVFlagsKey() string {
+	return fmt.Sprintf("%s_flags", p.KVNetworkKey())
+}
+
+// KVFaviconsKey keeps the favicon sets.
+func (p PodInfo) KVFaviconsKey() string {
+	return fmt.Sprintf("%s_favicons", p.KVNetworkKey())
+}
+
+// KVFiltersKey keeps the packet filter rules.
+func (p PodInfo) KVFiltersKey() string {
+	return fmt.Sprintf("%s_filters", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVExposuresKey() string {
+	return fmt.Sprintf("%s_exposures", p.KVNetworkKey())
+}
+
+// KVWebhooksKey keeps the outbound webhooks.
+func (p PodInfo) KVWebhooksKey() string {
+	return fmt.Sprintf("%s_webhooks", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVAuditKey() string {
+	return fmt.Sprintf("%s_audit", p.KVNetworkKey())
+}
+
+// KVChatLogKey keeps the chat messages of players if CHAT_LOG is on.
+func (p PodInfo) KVChatLogKey() string {
+	return fmt.Sprintf("%s_chatlog", p.KVNetworkKey())
+}
+
+// KVGDPRKey keeps the keyring that signs data export and erasure reports.
+func (p PodInfo) KVGDPRKey() string {
+	return fmt.Sprintf("%s_gdpr", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVThemesKey() string {
+	return fmt.Sprintf("%s_themes", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVForwardingKey() string {
+	return fmt.Sprintf("%s_forwarding", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVSessionsKey() string {
+	return fmt.Sprintf("%s_sessions", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVClusterKey() string {
+	return fmt.Sprintf("%s_cluster", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVRegionsKey() string {
+	return fmt.Sprintf("%s_regions", p.KVNetworkKey())
+}
+
+// KVMigrationsKey keeps the applied migrations and the migration locks.
+func (p PodInfo) KVMigrationsKey() string {
+	return fmt.Sprintf("%s_migrations", p.KVNetworkKey())
+}
+
+func (p PodInfo) KVProfilesKey() string {
+	return fmt.Sprintf("%s_profiles", p.KVNetworkKey())
+}
+
+// csmc_<namespace>_<network>_plugin_<name>, see Hosting.PluginStore
+func (p PodInfo) KVPluginKey(name string) string {
+	return fmt.Sprintf("%s_plugin_%s", p.KVNetworkKey(), name)
+}
+
 // csmc_<namespace>_<network>_instances<Container hostname, InstanceInfo>
 func (p PodInfo) KVInstancesKey() string {
 	return fmt.Sprintf("%s_instances", p.KVNetworkKey())
@@ -62,4 +196,32 @@ type InstanceInfo struct {
 	Gamemode string `json:"gamemode"`
 	Address  string `json:"address"`
 	Port     int    `json:"port"`
+	// Canary instances only receive players through the gamemode's
+	// CanaryConfig.
+	Canary bool `json:"canary,omitempty"`
+	// Tags are arbitrary labels like region=eu or version=1.21 that
+	// registry selectors match on.
+	Tags map[string]string `json:"tags,omitempty"`
+	// MaxPlayers and Online are announced by the backend. MaxPlayers 0
+	// falls back to SERVER_MAX_PLAYERS.
+	MaxPlayers int `json:"maxPlayers,omitempty"`
+	Online     int `json:"online,omitempty"`
+}
+
+// Labels are the instance's tags plus the name, gamemode and canary labels.
+func (i InstanceInfo) Labels(name string) map[string]string {
+	labels := make(map[string]string, len(i.Tags)+3)
+	for k, v := range i.Tags {
+		labels[k] = v
+	}
+
+	labels["name"] = name
+	if i.Gamemode != "" {
+		labels["gamemode"] = i.Gamemode
+	}
+	if i.Canary {
+		labels["canary"] = "true"
+	}
+
+	return labels
 }
@@ -0,0 +1,366 @@
+// Package profiles resolves Minecraft names, UUIDs and skins through the
+// Mojang API, cached in KV so every proxy shares the results.
+package profiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var (
+	ErrProfileNotFound = errors.New("profile not found")
+	ErrRateLimited     = errors.New("mojang api rate limit reached")
+)
+
+var lookups = metrics.NewCounterVec("gate_profile_lookups_total", "Profile lookups, by where the result came from.", "source")
+
+type Property struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Profile of a player. ID is the undashed UUID, Properties hold the signed
+// textures of the skin and cape.
+type Profile struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Properties []Property `json:"properties,omitempty"`
+	Fetched    time.Time  `json:"fetched"`
+}
+
+// Textures returns the signed textures property, if the profile has one.
+func (p Profile) Textures() (Property, bool) {
+	for _, prop := range p.Properties {
+		if prop.Name == "textures" {
+			return prop, true
+		}
+	}
+
+	return Property{}, false
+}
+
+// Options of the cache. The URLs default to the Mojang API.
+type Options struct {
+	NamesURL    string
+	ProfilesURL string
+	// TTL is how long a cached profile is used before it is refreshed,
+	// stale profiles are still returned when the API is unavailable.
+	TTL time.Duration
+	// NotFoundTTL is how long unknown names are remembered.
+	NotFoundTTL time.Duration
+	// Requests per Window to the API, Mojang allows around 600 per 10
+	// minutes per IP.
+	Requests int
+	Window   time.Duration
+}
+
+type call struct {
+	wg      sync.WaitGroup
+	profile Profile
+	err     error
+}
+
+// Cache resolves profiles from KV and falls back to the API, concurrent
+// lookups of the same key share one request.
+type Cache struct {
+	kv   kv.Bucket
+	opts Options
+	http *http.Client
+
+	calls map[string]*call
+	// window and requests count the API requests of the current window,
+	// blockedUntil is set by 429 responses.
+	window       time.Time
+	requests     int
+	blockedUntil time.Time
+	m            sync.Mutex
+}
+
+func New(bucket kv.Bucket, opts Options) *Cache {
+	if opts.NamesURL == "" {
+		opts.NamesURL = "https://api.mojang.com/users/profiles/minecraft/"
+	}
+	if opts.ProfilesURL == "" {
+		opts.ProfilesURL = "https://sessionserver.mojang.com/session/minecraft/profile/"
+	}
+
+	return &Cache{
+		kv:    bucket,
+		opts:  opts,
+		http:  &http.Client{Timeout: 10 * time.Second},
+		calls: make(map[string]*call),
+	}
+}
+
+func nameKey(name string) string {
+	return "name." + strings.ToLower(name)
+}
+
+func idKey(id string) string {
+	return "id." + id
+}
+
+func normalize(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+// do runs fn once for all concurrent callers with the same key.
+func (c *Cache) do(key string, fn func() (Profile, error)) (Profile, error) {
+	c.m.Lock()
+	if cl, ok := c.calls[key]; ok {
+		c.m.Unlock()
+		cl.wg.Wait()
+
+		lookups.Inc("coalesced")
+
+		return cl.profile, cl.err
+	}
+
+	cl := &call{}
+	cl.wg.Add(1)
+	c.calls[key] = cl
+	c.m.Unlock()
+
+	cl.profile, cl.err = fn()
+	cl.wg.Done()
+
+	c.m.Lock()
+	delete(c.calls, key)
+	c.m.Unlock()
+
+	return cl.profile, cl.err
+}
+
+// allow reserves a request to the API if the rate limit permits it.
+func (c *Cache) allow(now time.Time) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if now.Before(c.blockedUntil) {
+		return false
+	}
+
+	if now.Sub(c.window) >= c.opts.Window {
+		c.window = now
+		c.requests = 0
+	}
+
+	if c.opts.Requests > 0 && c.requests >= c.opts.Requests {
+		return false
+	}
+
+	c.requests++
+
+	return true
+}
+
+func (c *Cache) fetch(ctx context.Context, url string, v any) error {
+	if !c.allow(time.Now()) {
+		return ErrRateLimited
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotFound:
+		return ErrProfileNotFound
+	case res.StatusCode == http.StatusTooManyRequests:
+		wait := time.Minute
+		if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(s) * time.Second
+		}
+
+		c.m.Lock()
+		c.blockedUntil = time.Now().Add(wait)
+		c.m.Unlock()
+
+		return ErrRateLimited
+	case res.StatusCode >= 300:
+		return fmt.Errorf("mojang api: %s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (c *Cache) cached(ctx context.Context, key string) (Profile, bool, error) {
+	raw, err := c.kv.Get(ctx, key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return Profile{}, false, nil
+	} else if err != nil {
+		return Profile{}, false, err
+	}
+
+	p := Profile{}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Profile{}, false, err
+	}
+
+	return p, true, nil
+}
+
+// nameEntry maps a name to a UUID, an empty ID means the name is unknown.
+type nameEntry struct {
+	ID      string    `json:"id,omitempty"`
+	Name    string    `json:"name"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func (c *Cache) setJSON(ctx context.Context, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.kv.Set(ctx, key, raw)
+}
+
+func (c *Cache) store(ctx context.Context, p Profile) error {
+	if err := c.setJSON(ctx, idKey(p.ID), p); err != nil {
+		return err
+	}
+
+	return c.setJSON(ctx, nameKey(p.Name), nameEntry{ID: p.ID, Name: p.Name, Fetched: p.Fetched})
+}
+
+// profile returns the cached profile of a name entry, or one without
+// textures if the UUID was never looked up.
+func (c *Cache) profile(ctx context.Context, e nameEntry) (Profile, error) {
+	p, ok, err := c.cached(ctx, idKey(e.ID))
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if !ok {
+		return Profile{ID: e.ID, Name: e.Name}, nil
+	}
+
+	p.Name = e.Name
+
+	return p, nil
+}
+
+// ByUUID returns the profile including skin textures. A cached profile
+// older than the TTL is refreshed, but still returned if that fails.
+func (c *Cache) ByUUID(ctx context.Context, id string) (Profile, error) {
+	id = normalize(id)
+
+	return c.do(idKey(id), func() (Profile, error) {
+		cached, ok, err := c.cached(ctx, idKey(id))
+		if err != nil {
+			return Profile{}, err
+		}
+
+		if ok && time.Since(cached.Fetched) < c.opts.TTL {
+			lookups.Inc("cache")
+			return cached, nil
+		}
+
+		p := Profile{}
+		if err := c.fetch(ctx, c.opts.ProfilesURL+id+"?unsigned=false", &p); err != nil {
+			if ok && !errors.Is(err, ErrProfileNotFound) {
+				lookups.Inc("stale")
+				return cached, nil
+			}
+
+			return Profile{}, err
+		}
+
+		lookups.Inc("api")
+
+		p.ID = normalize(p.ID)
+		p.Fetched = time.Now()
+
+		return p, c.store(ctx, p)
+	})
+}
+
+// Cached returns the cached profile of a UUID, also one older than the TTL,
+// without ever asking Mojang. It is meant for listing many players at once.
+func (c *Cache) Cached(ctx context.Context, id string) (Profile, bool, error) {
+	return c.cached(ctx, idKey(normalize(id)))
+}
+
+// ByName resolves a name to a profile. Unknown names are remembered for
+// NotFoundTTL, so typos don't use up the rate limit.
+func (c *Cache) ByName(ctx context.Context, name string) (Profile, error) {
+	key := nameKey(name)
+
+	return c.do(key, func() (Profile, error) {
+		entry := nameEntry{}
+		raw, err := c.kv.Get(ctx, key)
+		cached := err == nil && json.Unmarshal(raw, &entry) == nil
+		if err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return Profile{}, err
+		}
+
+		ttl := c.opts.TTL
+		if entry.ID == "" {
+			ttl = c.opts.NotFoundTTL
+		}
+
+		if cached && time.Since(entry.Fetched) < ttl {
+			lookups.Inc("cache")
+
+			if entry.ID == "" {
+				return Profile{}, ErrProfileNotFound
+			}
+
+			return c.profile(ctx, entry)
+		}
+
+		resolved := Profile{}
+		if err := c.fetch(ctx, c.opts.NamesURL+name, &resolved); errors.Is(err, ErrProfileNotFound) {
+			if err := c.setJSON(ctx, key, nameEntry{Name: name, Fetched: time.Now()}); err != nil {
+				return Profile{}, err
+			}
+
+			return Profile{}, ErrProfileNotFound
+		} else if err != nil {
+			if cached && entry.ID != "" {
+				lookups.Inc("stale")
+				return c.profile(ctx, entry)
+			}
+
+			return Profile{}, err
+		}
+
+		lookups.Inc("api")
+
+		entry = nameEntry{ID: normalize(resolved.ID), Name: resolved.Name, Fetched: time.Now()}
+		if err := c.setJSON(ctx, key, entry); err != nil {
+			return Profile{}, err
+		}
+
+		return c.profile(ctx, entry)
+	})
+}
+
+// ID resolves a name to an undashed UUID.
+func (c *Cache) ID(ctx context.Context, name string) (string, error) {
+	p, err := c.ByName(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return p.ID, nil
+}
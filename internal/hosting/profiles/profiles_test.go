@@ -0,0 +1,225 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+const id = "069a79f444e94726a5befca90e38aaf5"
+
+type mojang struct {
+	requests atomic.Int32
+	status   atomic.Int32
+}
+
+func (m *mojang) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.requests.Add(1)
+
+	if status := int(m.status.Load()); status != 0 {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(status)
+		return
+	}
+
+	switch {
+	case strings.EqualFold(r.URL.Path, "/names/Notch"):
+		w.Write([]byte(`{"id":"` + id + `","name":"Notch"}`))
+	case r.URL.Path == "/profiles/"+id:
+		w.Write([]byte(`{"id":"` + id + `","name":"Notch","properties":[{"name":"textures","value":"e30=","signature":"sig"}]}`))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newCache(t *testing.T, opts Options) (*Cache, *mojang) {
+	t.Helper()
+
+	m := &mojang{}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+
+	client, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := client.Bucket(context.Background(), "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.NamesURL = srv.URL + "/names/"
+	opts.ProfilesURL = srv.URL + "/profiles/"
+
+	return New(bucket, opts), m
+}
+
+func TestByName(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{TTL: time.Hour, NotFoundTTL: time.Hour})
+
+	for range 3 {
+		got, err := c.ID(ctx, "notch")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != id {
+			t.Fatalf("expected %s, got %s", id, got)
+		}
+	}
+
+	if n := m.requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestByNameNotFound(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{TTL: time.Hour, NotFoundTTL: time.Hour})
+
+	for range 2 {
+		if _, err := c.ByName(ctx, "nobody"); !errors.Is(err, ErrProfileNotFound) {
+			t.Fatalf("expected ErrProfileNotFound, got %v", err)
+		}
+	}
+
+	if n := m.requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestByUUID(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{TTL: time.Hour})
+
+	p, err := c.ByUUID(ctx, "069a79f4-44e9-4726-a5be-fca90e38aaf5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if textures, ok := p.Textures(); !ok || textures.Signature != "sig" {
+		t.Fatalf("expected signed textures, got %+v", p.Properties)
+	}
+
+	// The name is cached by the UUID lookup
+	if _, err := c.ByName(ctx, "Notch"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := m.requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCached(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{TTL: time.Hour})
+
+	if _, ok, err := c.Cached(ctx, id); err != nil || ok {
+		t.Fatalf("expected no cached profile, got %t %v", ok, err)
+	}
+
+	if _, err := c.ByUUID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok, err := c.Cached(ctx, "069a79f4-44e9-4726-a5be-fca90e38aaf5")
+	if err != nil || !ok || p.Name != "Notch" {
+		t.Fatalf("expected the cached profile of Notch, got %+v %t %v", p, ok, err)
+	}
+
+	if n := m.requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{TTL: time.Hour})
+
+	wg := sync.WaitGroup{}
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := c.ByUUID(ctx, id); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := m.requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{Requests: 2, Window: time.Hour})
+
+	for i := range 3 {
+		_, err := c.ByName(ctx, "player"+strings.Repeat("x", i))
+		if i < 2 && !errors.Is(err, ErrProfileNotFound) {
+			t.Fatalf("expected ErrProfileNotFound, got %v", err)
+		}
+
+		if i == 2 && !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("expected ErrRateLimited, got %v", err)
+		}
+	}
+
+	if n := m.requests.Load(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestTooManyRequests(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{})
+
+	m.status.Store(http.StatusTooManyRequests)
+
+	for range 2 {
+		if _, err := c.ByUUID(ctx, id); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("expected ErrRateLimited, got %v", err)
+		}
+	}
+
+	// The second lookup waits for Retry-After instead of asking again
+	if n := m.requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestStale(t *testing.T) {
+	ctx := context.Background()
+	c, m := newCache(t, Options{})
+
+	if _, err := c.ByUUID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	m.status.Store(http.StatusInternalServerError)
+
+	p, err := c.ByUUID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "Notch" {
+		t.Fatalf("expected the stale profile, got %+v", p)
+	}
+}
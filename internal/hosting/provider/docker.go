@@ -0,0 +1,294 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	_ Provider = &Docker{}
+	_ Powered  = &Docker{}
+)
+
+type DockerOptions struct {
+	// Host is the Docker daemon, unix:///var/run/docker.sock by default or
+	// e.g. tcp://docker:2375
+	Host string `json:"host"`
+	// Network is the Docker network the servers join. The proxy has to be on
+	// it as well, and reaches servers by their container name.
+	Network string `json:"network"`
+}
+
+// Docker runs servers as containers through the Docker Engine API.
+type Docker struct {
+	opts    DockerOptions
+	network string
+	base    string
+	client  *http.Client
+}
+
+func NewDocker(network string, opts DockerOptions) (*Docker, error) {
+	if opts.Host == "" {
+		opts.Host = "unix:///var/run/docker.sock"
+	}
+
+	u, err := url.Parse(opts.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Docker{opts: opts, network: network}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		d.base = "http://docker"
+		d.client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+	case "tcp", "http":
+		d.base = "http://" + u.Host
+		d.client = http.DefaultClient
+	case "https":
+		d.base = "https://" + u.Host
+		d.client = http.DefaultClient
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %s", opts.Host)
+	}
+
+	return d, nil
+}
+
+// do sends the request with body encoded as JSON and decodes the response into
+// out, if not nil.
+func (d *Docker) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	u := d.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrServerNotFound
+	case res.StatusCode == http.StatusConflict && method == http.MethodPost && path == "/containers/create":
+		return ErrServerExists
+	case res.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Docker %s %s: %s: %s", method, path, res.Status, bytes.TrimSpace(msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+type dockerCreate struct {
+	Image        string              `json:"Image"`
+	Env          []string            `json:"Env"`
+	Labels       map[string]string   `json:"Labels"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	HostConfig   struct {
+		NetworkMode   string `json:"NetworkMode,omitempty"`
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+	} `json:"HostConfig"`
+}
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type dockerInspect struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Status string `json:"Status"`
+	} `json:"State"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+	} `json:"NetworkSettings"`
+}
+
+func dockerStatus(state string) Status {
+	switch state {
+	case "created", "restarting":
+		return StatusStarting
+	case "running":
+		return StatusRunning
+	case "removing", "paused":
+		return StatusStopping
+	case "exited", "dead":
+		return StatusStopped
+	default:
+		return StatusUnknown
+	}
+}
+
+func (d *Docker) address(name string, labels map[string]string, ip string) string {
+	port := labels[LabelServer+".port"]
+	if port == "" {
+		port = "25565"
+	}
+
+	if d.opts.Network != "" {
+		return net.JoinHostPort(name, port)
+	} else if ip != "" {
+		return net.JoinHostPort(ip, port)
+	}
+
+	return ""
+}
+
+func (d *Docker) CreateServer(ctx context.Context, spec Spec) (Server, error) {
+	l := labels(spec, d.network)
+	l[LabelServer+".port"] = strconv.Itoa(spec.port())
+
+	body := dockerCreate{
+		Image:        spec.Image,
+		Env:          spec.env(),
+		Labels:       l,
+		ExposedPorts: map[string]struct{}{strconv.Itoa(spec.port()) + "/tcp": {}},
+	}
+	body.HostConfig.NetworkMode = d.opts.Network
+	body.HostConfig.RestartPolicy.Name = "unless-stopped"
+
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	if err := d.do(ctx, http.MethodPost, "/containers/create", url.Values{"name": {spec.Name}}, body, &created); err != nil {
+		return Server{}, err
+	}
+
+	if err := d.do(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil); err != nil {
+		return Server{}, err
+	}
+
+	return d.inspect(ctx, created.ID)
+}
+
+func (d *Docker) inspect(ctx context.Context, name string) (Server, error) {
+	c := dockerInspect{}
+	if err := d.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil, &c); err != nil {
+		return Server{}, err
+	}
+
+	// Containers of other networks or not created by the proxy don't exist
+	// as far as it's concerned
+	if c.Config.Labels[LabelNetwork] != d.network {
+		return Server{}, ErrServerNotFound
+	}
+
+	return Server{
+		Name:    strings.TrimPrefix(c.Name, "/"),
+		ID:      c.ID,
+		Status:  dockerStatus(c.State.Status),
+		Address: d.address(strings.TrimPrefix(c.Name, "/"), c.Config.Labels, c.NetworkSettings.IPAddress),
+		Labels:  c.Config.Labels,
+	}, nil
+}
+
+func (d *Docker) DeleteServer(ctx context.Context, name string) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+
+	return d.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(name), url.Values{"force": {"true"}}, nil, nil)
+}
+
+func (d *Docker) ListServers(ctx context.Context) ([]Server, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {LabelNetwork + "=" + d.network}})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]dockerContainer, 0)
+	if err := d.do(ctx, http.MethodGet, "/containers/json", url.Values{"all": {"true"}, "filters": {string(filters)}}, nil, &containers); err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, 0, len(containers))
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+
+		name := strings.TrimPrefix(c.Names[0], "/")
+		servers = append(servers, Server{
+			Name:    name,
+			ID:      c.ID,
+			Status:  dockerStatus(c.State),
+			Address: d.address(name, c.Labels, ""),
+			Labels:  c.Labels,
+		})
+	}
+	sortServers(servers)
+
+	return servers, nil
+}
+
+func (d *Docker) ServerStatus(ctx context.Context, name string) (Status, error) {
+	s, err := d.inspect(ctx, name)
+	if err != nil {
+		return StatusUnknown, err
+	}
+
+	return s.Status, nil
+}
+
+func (d *Docker) StartServer(ctx context.Context, name string) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+
+	return d.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/start", nil, nil, nil)
+}
+
+func (d *Docker) StopServer(ctx context.Context, name string) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+
+	return d.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/stop", nil, nil, nil)
+}
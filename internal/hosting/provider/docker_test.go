@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDocker implements the few Engine API endpoints the provider uses.
+type fakeDocker struct {
+	containers map[string]dockerInspect
+	m          sync.Mutex
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == "/containers/create":
+		name := r.URL.Query().Get("name")
+		if _, exists := f.containers[name]; exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		body := dockerCreate{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c := dockerInspect{ID: "id-" + name, Name: "/" + name}
+		c.State.Status = "created"
+		c.Config.Labels = body.Labels
+		f.containers[name] = c
+
+		json.NewEncoder(w).Encode(map[string]string{"Id": c.ID})
+
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/start"):
+		for name, c := range f.containers {
+			if "/containers/"+c.ID+"/start" == path {
+				c.State.Status = "running"
+				f.containers[name] = c
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	case r.Method == http.MethodGet && path == "/containers/json":
+		list := make([]dockerContainer, 0)
+		for _, c := range f.containers {
+			list = append(list, dockerContainer{ID: c.ID, Names: []string{c.Name}, State: c.State.Status, Labels: c.Config.Labels})
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/json"):
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+		for _, c := range f.containers {
+			if c.ID == name || c.Name == "/"+name {
+				json.NewEncoder(w).Encode(c)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	case r.Method == http.MethodDelete:
+		name := strings.TrimPrefix(path, "/containers/")
+		if _, exists := f.containers[name]; !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.containers, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDocker(t *testing.T) {
+	ctx := context.Background()
+
+	fake := &fakeDocker{containers: make(map[string]dockerInspect)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	d, err := NewDocker("csmc", DockerOptions{Host: srv.URL, Network: "minecraft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := d.CreateServer(ctx, Spec{Name: "lobby-1", Image: "itzg/minecraft-server", Env: map[string]string{"EULA": "TRUE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Status != StatusRunning || s.Address != "lobby-1:25565" {
+		t.Fatalf("unexpected server %+v", s)
+	}
+
+	if _, err := d.CreateServer(ctx, Spec{Name: "lobby-1"}); !errors.Is(err, ErrServerExists) {
+		t.Fatalf("expected ErrServerExists, got %v", err)
+	}
+
+	// Containers of another network are invisible
+	other, err := NewDocker("other", DockerOptions{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.ServerStatus(ctx, "lobby-1"); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected ErrServerNotFound, got %v", err)
+	}
+
+	servers, err := d.ListServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 1 || servers[0].Name != "lobby-1" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+
+	if err := d.DeleteServer(ctx, "lobby-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.ServerStatus(ctx, "lobby-1"); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected ErrServerNotFound, got %v", err)
+	}
+}
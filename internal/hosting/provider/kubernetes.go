@@ -0,0 +1,291 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var _ Provider = &Kubernetes{}
+
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+type KubernetesOptions struct {
+	// APIServer defaults to the in-cluster address
+	APIServer string `json:"apiServer"`
+	// Namespace, Token and CAFile default to those of the pod's service
+	// account. It needs to create, list and delete pods.
+	Namespace string `json:"namespace"`
+	Token     string `json:"token"`
+	CAFile    string `json:"caFile"`
+	// ServiceAccount is the service account of the server pods
+	ServiceAccount string `json:"serviceAccount"`
+	// Resources is copied into the server container, e.g.
+	// {"requests":{"memory":"2Gi"},"limits":{"memory":"2Gi"}}
+	Resources json.RawMessage `json:"resources"`
+}
+
+// Kubernetes runs servers as pods in the namespace of the proxy. Pods are
+// reached by their IP, so no service is created for them.
+type Kubernetes struct {
+	opts    KubernetesOptions
+	network string
+	client  *http.Client
+}
+
+func NewKubernetes(network string, opts KubernetesOptions) (*Kubernetes, error) {
+	if opts.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("Kubernetes API server is required outside of a cluster")
+		}
+		opts.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+	opts.APIServer = strings.TrimSuffix(opts.APIServer, "/")
+
+	if opts.Namespace == "" {
+		raw, err := os.ReadFile(serviceAccount + "namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes namespace: %w", err)
+		}
+		opts.Namespace = strings.TrimSpace(string(raw))
+	}
+
+	if opts.Token == "" {
+		if raw, err := os.ReadFile(serviceAccount + "token"); err == nil {
+			opts.Token = strings.TrimSpace(string(raw))
+		}
+	}
+
+	if opts.CAFile == "" {
+		if _, err := os.Stat(serviceAccount + "ca.crt"); err == nil {
+			opts.CAFile = serviceAccount + "ca.crt"
+		}
+	}
+
+	client := http.DefaultClient
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", opts.CAFile)
+		}
+
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	}
+
+	return &Kubernetes{opts: opts, network: network, client: client}, nil
+}
+
+func (k *Kubernetes) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	u := k.opts.APIServer + "/api/v1/namespaces/" + url.PathEscape(k.opts.Namespace) + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if k.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.opts.Token)
+	}
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrServerNotFound
+	case res.StatusCode == http.StatusConflict:
+		return ErrServerExists
+	case res.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Kubernetes %s %s: %s: %s", method, path, res.Status, bytes.TrimSpace(msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+type kubernetesEnv struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type kubernetesPort struct {
+	Name          string `json:"name"`
+	ContainerPort int    `json:"containerPort"`
+}
+
+type kubernetesContainer struct {
+	Name      string           `json:"name"`
+	Image     string           `json:"image"`
+	Env       []kubernetesEnv  `json:"env,omitempty"`
+	Resources json.RawMessage  `json:"resources,omitempty"`
+	Ports     []kubernetesPort `json:"ports,omitempty"`
+}
+
+type kubernetesPod struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Metadata   struct {
+		Name              string            `json:"name"`
+		UID               string            `json:"uid,omitempty"`
+		Labels            map[string]string `json:"labels,omitempty"`
+		DeletionTimestamp string            `json:"deletionTimestamp,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		ServiceAccountName string                `json:"serviceAccountName,omitempty"`
+		RestartPolicy      string                `json:"restartPolicy,omitempty"`
+		Containers         []kubernetesContainer `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase      string `json:"phase,omitempty"`
+		PodIP      string `json:"podIP,omitempty"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+func (p *kubernetesPod) status() Status {
+	if p.Metadata.DeletionTimestamp != "" {
+		return StatusStopping
+	}
+
+	switch p.Status.Phase {
+	case "Pending":
+		return StatusStarting
+	case "Running":
+		// Running but not ready yet is still starting
+		for _, c := range p.Status.Conditions {
+			if c.Type == "Ready" && c.Status != "True" {
+				return StatusStarting
+			}
+		}
+		return StatusRunning
+	case "Succeeded", "Failed":
+		return StatusStopped
+	default:
+		return StatusUnknown
+	}
+}
+
+func (p *kubernetesPod) server() Server {
+	s := Server{Name: p.Metadata.Name, ID: p.Metadata.UID, Status: p.status(), Labels: p.Metadata.Labels}
+
+	if p.Status.PodIP != "" && len(p.Spec.Containers) > 0 && len(p.Spec.Containers[0].Ports) > 0 {
+		s.Address = net.JoinHostPort(p.Status.PodIP, strconv.Itoa(p.Spec.Containers[0].Ports[0].ContainerPort))
+	}
+
+	return s
+}
+
+func (k *Kubernetes) CreateServer(ctx context.Context, spec Spec) (Server, error) {
+	pod := kubernetesPod{APIVersion: "v1", Kind: "Pod"}
+	pod.Metadata.Name = spec.Name
+	pod.Metadata.Labels = labels(spec, k.network)
+	pod.Spec.ServiceAccountName = k.opts.ServiceAccount
+	pod.Spec.RestartPolicy = "Always"
+
+	c := kubernetesContainer{
+		Name:      "server",
+		Image:     spec.Image,
+		Resources: k.opts.Resources,
+		Ports:     []kubernetesPort{{Name: "minecraft", ContainerPort: spec.port()}},
+	}
+	for _, kv := range spec.env() {
+		name, value, _ := strings.Cut(kv, "=")
+		c.Env = append(c.Env, kubernetesEnv{Name: name, Value: value})
+	}
+	pod.Spec.Containers = []kubernetesContainer{c}
+
+	created := kubernetesPod{}
+	if err := k.do(ctx, http.MethodPost, "/pods", nil, pod, &created); err != nil {
+		return Server{}, err
+	}
+
+	return created.server(), nil
+}
+
+func (k *Kubernetes) pod(ctx context.Context, name string) (*kubernetesPod, error) {
+	pod := kubernetesPod{}
+	if err := k.do(ctx, http.MethodGet, "/pods/"+url.PathEscape(name), nil, nil, &pod); err != nil {
+		return nil, err
+	}
+
+	if pod.Metadata.Labels[LabelNetwork] != k.network {
+		return nil, ErrServerNotFound
+	}
+
+	return &pod, nil
+}
+
+func (k *Kubernetes) DeleteServer(ctx context.Context, name string) error {
+	if _, err := k.pod(ctx, name); err != nil {
+		return err
+	}
+
+	return k.do(ctx, http.MethodDelete, "/pods/"+url.PathEscape(name), nil, nil, nil)
+}
+
+func (k *Kubernetes) ListServers(ctx context.Context) ([]Server, error) {
+	list := struct {
+		Items []kubernetesPod `json:"items"`
+	}{}
+	if err := k.do(ctx, http.MethodGet, "/pods", url.Values{"labelSelector": {LabelNetwork + "=" + k.network}}, nil, &list); err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, 0, len(list.Items))
+	for i := range list.Items {
+		servers = append(servers, list.Items[i].server())
+	}
+	sortServers(servers)
+
+	return servers, nil
+}
+
+func (k *Kubernetes) ServerStatus(ctx context.Context, name string) (Status, error) {
+	pod, err := k.pod(ctx, name)
+	if err != nil {
+		return StatusUnknown, err
+	}
+
+	return pod.status(), nil
+}
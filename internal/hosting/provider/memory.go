@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	_ Provider = &Memory{}
+	_ Powered  = &Memory{}
+)
+
+// Memory only keeps track of servers in memory, for tests and local
+// development. Created servers are running immediately.
+type Memory struct {
+	servers map[string]Server
+	m       sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{servers: make(map[string]Server)}
+}
+
+func (p *Memory) CreateServer(ctx context.Context, spec Spec) (Server, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if _, exists := p.servers[spec.Name]; exists {
+		return Server{}, ErrServerExists
+	}
+
+	s := Server{Name: spec.Name, ID: spec.Name, Status: StatusRunning, Labels: spec.Labels}
+	p.servers[spec.Name] = s
+
+	return s, nil
+}
+
+func (p *Memory) DeleteServer(ctx context.Context, name string) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if _, exists := p.servers[name]; !exists {
+		return ErrServerNotFound
+	}
+
+	delete(p.servers, name)
+
+	return nil
+}
+
+func (p *Memory) ListServers(ctx context.Context) ([]Server, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	servers := make([]Server, 0, len(p.servers))
+	for _, s := range p.servers {
+		servers = append(servers, s)
+	}
+	sortServers(servers)
+
+	return servers, nil
+}
+
+func (p *Memory) ServerStatus(ctx context.Context, name string) (Status, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	s, exists := p.servers[name]
+	if !exists {
+		return StatusUnknown, ErrServerNotFound
+	}
+
+	return s.Status, nil
+}
+
+func (p *Memory) setStatus(name string, status Status) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	s, exists := p.servers[name]
+	if !exists {
+		return ErrServerNotFound
+	}
+
+	s.Status = status
+	p.servers[name] = s
+
+	return nil
+}
+
+func (p *Memory) StartServer(ctx context.Context, name string) error {
+	return p.setStatus(name, StatusRunning)
+}
+
+func (p *Memory) StopServer(ctx context.Context, name string) error {
+	return p.setStatus(name, StatusStopped)
+}
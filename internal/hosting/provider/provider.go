@@ -0,0 +1,123 @@
+// Package provider creates and deletes backend servers on the platform they
+// are hosted on, so the proxy can start instances when they are needed and
+// stop them when they aren't.
+package provider
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrServerNotFound = errors.New("server not found")
+	ErrServerExists   = errors.New("server already exists")
+	ErrUnsupported    = errors.New("not supported by the server provider")
+)
+
+// Status is the lifecycle state of a server, mapped from the states of the
+// platform.
+type Status string
+
+const (
+	StatusStarting Status = "starting"
+	StatusRunning  Status = "running"
+	StatusStopping Status = "stopping"
+	StatusStopped  Status = "stopped"
+	StatusUnknown  Status = "unknown"
+)
+
+// Spec describes a server to create. Not every provider uses every field,
+// Pterodactyl for example takes the image from the egg.
+type Spec struct {
+	Name  string            `json:"name"`
+	Image string            `json:"image,omitempty"`
+	Env   map[string]string `json:"env,omitempty"`
+	// Port is the Minecraft port inside the server, 25565 by default
+	Port   int               `json:"port,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (s Spec) port() int {
+	if s.Port == 0 {
+		return 25565
+	}
+
+	return s.Port
+}
+
+// env returns the environment as sorted KEY=VALUE pairs.
+func (s Spec) env() []string {
+	env := make([]string, 0, len(s.Env))
+	for k, v := range s.Env {
+		env = append(env, k+"="+v)
+	}
+	slices.Sort(env)
+
+	return env
+}
+
+type Server struct {
+	Name string `json:"name"`
+	// ID is the identifier of the platform, e.g. the container ID
+	ID     string `json:"id,omitempty"`
+	Status Status `json:"status"`
+	// Address is where the proxy reaches the server, empty until the
+	// platform assigned one
+	Address string            `json:"address,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Provider manages the servers of one network. ListServers only returns the
+// servers it created for that network.
+type Provider interface {
+	// CreateServer creates and starts the server. It returns ErrServerExists
+	// if there already is one with that name.
+	CreateServer(ctx context.Context, spec Spec) (Server, error)
+	// DeleteServer stops and removes the server, or returns ErrServerNotFound.
+	DeleteServer(ctx context.Context, name string) error
+	// ListServers returns the servers sorted by name.
+	ListServers(ctx context.Context) ([]Server, error)
+	// ServerStatus returns ErrServerNotFound if the server does not exist.
+	ServerStatus(ctx context.Context, name string) (Status, error)
+}
+
+// Powered is implemented by providers that can stop servers and start them
+// again without deleting them.
+type Powered interface {
+	StartServer(ctx context.Context, name string) error
+	StopServer(ctx context.Context, name string) error
+}
+
+// Console is implemented by providers that can run commands on the console of
+// a running server.
+type Console interface {
+	SendCommand(ctx context.Context, name, command string) error
+}
+
+const (
+	// LabelNetwork marks the servers created for a network
+	LabelNetwork = "csmc.network"
+	// LabelServer is the name of the server, for platforms that rename them
+	LabelServer = "csmc.server"
+)
+
+// labels returns the labels of spec with those marking it as created by the
+// provider of network.
+func labels(spec Spec, network string) map[string]string {
+	l := make(map[string]string, len(spec.Labels)+2)
+	for k, v := range spec.Labels {
+		l[k] = v
+	}
+	l[LabelNetwork] = network
+	l[LabelServer] = spec.Name
+
+	return l
+}
+
+func sortServers(servers []Server) {
+	slices.SortFunc(servers, func(a, b Server) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
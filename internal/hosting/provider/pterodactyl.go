@@ -0,0 +1,372 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	_ Provider = &Pterodactyl{}
+	_ Powered  = &Pterodactyl{}
+	_ Console  = &Pterodactyl{}
+)
+
+type PterodactylOptions struct {
+	// URL of the panel, e.g. https://panel.example.com. Pelican panels
+	// speak the same API.
+	URL string `json:"url"`
+	// ApplicationKey is an application API key with read and write access
+	// to servers, used to create, list and delete them
+	ApplicationKey string `json:"applicationKey"`
+	// ClientKey is a client API key of a user with access to the servers,
+	// needed for their power state, to start and stop them and to send
+	// console commands
+	ClientKey string `json:"clientKey"`
+
+	// User owns the created servers
+	User int `json:"user"`
+	Egg  int `json:"egg"`
+	// DockerImage and Startup default to those of the egg
+	DockerImage string `json:"dockerImage"`
+	Startup     string `json:"startup"`
+	// Environment are the egg variables, the environment of a Spec is added
+	Environment map[string]string `json:"environment"`
+	// Locations the panel picks a node with a free allocation from
+	Locations []int `json:"locations"`
+	// Memory and Disk are in MiB, CPU in percent of a core, 0 is unlimited
+	Memory int `json:"memory"`
+	Disk   int `json:"disk"`
+	CPU    int `json:"cpu"`
+}
+
+// Pterodactyl creates servers on a Pterodactyl or Pelican panel. The panel
+// only knows their names as display names, the proxy finds its servers by
+// their external ID "<network>:<name>".
+type Pterodactyl struct {
+	opts    PterodactylOptions
+	network string
+	client  *http.Client
+}
+
+func NewPterodactyl(network string, opts PterodactylOptions) (*Pterodactyl, error) {
+	if opts.URL == "" || opts.ApplicationKey == "" {
+		return nil, fmt.Errorf("Pterodactyl url and applicationKey are required")
+	}
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+
+	return &Pterodactyl{opts: opts, network: network, client: http.DefaultClient}, nil
+}
+
+func (p *Pterodactyl) externalID(name string) string {
+	return p.network + ":" + name
+}
+
+// do sends a request to the application API if key is the application key,
+// or the client API otherwise.
+func (p *Pterodactyl) do(ctx context.Context, method, key, path string, query url.Values, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	u := p.opts.URL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.pterodactyl.v1+json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrServerNotFound
+	case res.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Pterodactyl %s %s: %s: %s", method, path, res.Status, bytes.TrimSpace(msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+type pterodactylServer struct {
+	Attributes struct {
+		ID         int    `json:"id"`
+		ExternalID string `json:"external_id"`
+		Identifier string `json:"identifier"`
+		Name       string `json:"name"`
+		// Status is null once installed, or installing, install_failed,
+		// reinstall_failed, suspended or restoring_backup
+		Status        *string `json:"status"`
+		Suspended     bool    `json:"suspended"`
+		Allocation    int     `json:"allocation"`
+		Relationships struct {
+			Allocations struct {
+				Data []struct {
+					Attributes struct {
+						ID    int    `json:"id"`
+						IP    string `json:"ip"`
+						Alias string `json:"ip_alias"`
+						Port  int    `json:"port"`
+					} `json:"attributes"`
+				} `json:"data"`
+			} `json:"allocations"`
+		} `json:"relationships"`
+	} `json:"attributes"`
+}
+
+func (s *pterodactylServer) address() string {
+	for _, a := range s.Attributes.Relationships.Allocations.Data {
+		if a.Attributes.ID != s.Attributes.Allocation {
+			continue
+		}
+
+		host := a.Attributes.Alias
+		if host == "" {
+			host = a.Attributes.IP
+		}
+
+		return net.JoinHostPort(host, strconv.Itoa(a.Attributes.Port))
+	}
+
+	return ""
+}
+
+func (p *Pterodactyl) server(s *pterodactylServer, status Status) Server {
+	return Server{
+		Name:    strings.TrimPrefix(s.Attributes.ExternalID, p.network+":"),
+		ID:      s.Attributes.Identifier,
+		Status:  status,
+		Address: s.address(),
+	}
+}
+
+// installStatus maps the install status of the application API, the power
+// state needs the client API.
+func (s *pterodactylServer) installStatus() (Status, bool) {
+	if s.Attributes.Suspended {
+		return StatusStopped, true
+	}
+
+	if s.Attributes.Status == nil {
+		return StatusUnknown, false
+	}
+
+	switch *s.Attributes.Status {
+	case "installing", "restoring_backup":
+		return StatusStarting, true
+	default:
+		return StatusStopped, true
+	}
+}
+
+func (p *Pterodactyl) find(ctx context.Context, name string) (*pterodactylServer, error) {
+	s := pterodactylServer{}
+	path := "/api/application/servers/external/" + url.PathEscape(p.externalID(name))
+	if err := p.do(ctx, http.MethodGet, p.opts.ApplicationKey, path, url.Values{"include": {"allocations"}}, nil, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (p *Pterodactyl) CreateServer(ctx context.Context, spec Spec) (Server, error) {
+	if _, err := p.find(ctx, spec.Name); err == nil {
+		return Server{}, ErrServerExists
+	} else if err != ErrServerNotFound {
+		return Server{}, err
+	}
+
+	env := make(map[string]string, len(p.opts.Environment)+len(spec.Env))
+	for k, v := range p.opts.Environment {
+		env[k] = v
+	}
+	for k, v := range spec.Env {
+		env[k] = v
+	}
+
+	image := p.opts.DockerImage
+	if spec.Image != "" {
+		image = spec.Image
+	}
+
+	body := map[string]any{
+		"name":         spec.Name,
+		"external_id":  p.externalID(spec.Name),
+		"description":  "Created by the proxy of network " + p.network,
+		"user":         p.opts.User,
+		"egg":          p.opts.Egg,
+		"docker_image": image,
+		"startup":      p.opts.Startup,
+		"environment":  env,
+		"limits": map[string]int{
+			"memory": p.opts.Memory,
+			"swap":   0,
+			"disk":   p.opts.Disk,
+			"io":     500,
+			"cpu":    p.opts.CPU,
+		},
+		"feature_limits": map[string]int{"databases": 0, "allocations": 1, "backups": 0},
+		"deploy": map[string]any{
+			"locations":    p.opts.Locations,
+			"dedicated_ip": false,
+			"port_range":   []string{},
+		},
+		"start_on_completion": true,
+	}
+
+	created := pterodactylServer{}
+	if err := p.do(ctx, http.MethodPost, p.opts.ApplicationKey, "/api/application/servers", url.Values{"include": {"allocations"}}, body, &created); err != nil {
+		return Server{}, err
+	}
+
+	return p.server(&created, StatusStarting), nil
+}
+
+func (p *Pterodactyl) DeleteServer(ctx context.Context, name string) error {
+	s, err := p.find(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return p.do(ctx, http.MethodDelete, p.opts.ApplicationKey, "/api/application/servers/"+strconv.Itoa(s.Attributes.ID), nil, nil, nil)
+}
+
+func (p *Pterodactyl) ListServers(ctx context.Context) ([]Server, error) {
+	servers := make([]Server, 0)
+
+	for page := 1; ; page++ {
+		list := struct {
+			Data []pterodactylServer `json:"data"`
+			Meta struct {
+				Pagination struct {
+					TotalPages int `json:"total_pages"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}{}
+
+		q := url.Values{"include": {"allocations"}, "per_page": {"100"}, "page": {strconv.Itoa(page)}}
+		if err := p.do(ctx, http.MethodGet, p.opts.ApplicationKey, "/api/application/servers", q, nil, &list); err != nil {
+			return nil, err
+		}
+
+		for i := range list.Data {
+			s := &list.Data[i]
+			if !strings.HasPrefix(s.Attributes.ExternalID, p.network+":") {
+				continue
+			}
+
+			status, err := p.status(ctx, s)
+			if err != nil {
+				return nil, err
+			}
+
+			servers = append(servers, p.server(s, status))
+		}
+
+		if page >= list.Meta.Pagination.TotalPages {
+			break
+		}
+	}
+	sortServers(servers)
+
+	return servers, nil
+}
+
+func (p *Pterodactyl) status(ctx context.Context, s *pterodactylServer) (Status, error) {
+	if status, ok := s.installStatus(); ok {
+		return status, nil
+	}
+
+	if p.opts.ClientKey == "" {
+		return StatusUnknown, nil
+	}
+
+	res := struct {
+		Attributes struct {
+			CurrentState string `json:"current_state"`
+		} `json:"attributes"`
+	}{}
+	if err := p.do(ctx, http.MethodGet, p.opts.ClientKey, "/api/client/servers/"+s.Attributes.Identifier+"/resources", nil, nil, &res); err != nil {
+		return StatusUnknown, err
+	}
+
+	switch res.Attributes.CurrentState {
+	case "offline":
+		return StatusStopped, nil
+	case "starting":
+		return StatusStarting, nil
+	case "running":
+		return StatusRunning, nil
+	case "stopping":
+		return StatusStopping, nil
+	default:
+		return StatusUnknown, nil
+	}
+}
+
+func (p *Pterodactyl) ServerStatus(ctx context.Context, name string) (Status, error) {
+	s, err := p.find(ctx, name)
+	if err != nil {
+		return StatusUnknown, err
+	}
+
+	return p.status(ctx, s)
+}
+
+// clientAction sends a request to the client API for the server, which is addressed
+// by its short identifier.
+func (p *Pterodactyl) clientAction(ctx context.Context, name, action string, body any) error {
+	if p.opts.ClientKey == "" {
+		return fmt.Errorf("Pterodactyl clientKey is required to %s servers", action)
+	}
+
+	s, err := p.find(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return p.do(ctx, http.MethodPost, p.opts.ClientKey, "/api/client/servers/"+s.Attributes.Identifier+"/"+action, nil, body, nil)
+}
+
+func (p *Pterodactyl) StartServer(ctx context.Context, name string) error {
+	return p.clientAction(ctx, name, "power", map[string]string{"signal": "start"})
+}
+
+func (p *Pterodactyl) StopServer(ctx context.Context, name string) error {
+	return p.clientAction(ctx, name, "power", map[string]string{"signal": "stop"})
+}
+
+// SendCommand runs the command on the console, the panel refuses it while the
+// server is offline.
+func (p *Pterodactyl) SendCommand(ctx context.Context, name, command string) error {
+	return p.clientAction(ctx, name, "command", map[string]string{"command": command})
+}
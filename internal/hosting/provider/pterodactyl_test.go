@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPterodactylPower(t *testing.T) {
+	ctx := context.Background()
+
+	var commands []string
+	state := "offline"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/application/servers/external/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer app" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.PathValue("id") != "csmc:lobby-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"attributes":{"id":7,"external_id":"csmc:lobby-1","identifier":"abcd1234","status":null,"allocation":3,
+			"relationships":{"allocations":{"data":[{"attributes":{"id":3,"ip":"10.0.0.5","ip_alias":"","port":25570}}]}}}}`))
+	})
+	mux.HandleFunc("GET /api/client/servers/abcd1234/resources", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"attributes": map[string]string{"current_state": state}})
+	})
+	mux.HandleFunc("POST /api/client/servers/abcd1234/power", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer client" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["signal"] == "start" {
+			state = "running"
+		} else {
+			state = "offline"
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /api/client/servers/abcd1234/command", func(w http.ResponseWriter, r *http.Request) {
+		if state != "running" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		commands = append(commands, body["command"])
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p, err := NewPterodactyl("csmc", PterodactylOptions{URL: srv.URL, ApplicationKey: "app", ClientKey: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, err := p.ServerStatus(ctx, "lobby-1"); err != nil || status != StatusStopped {
+		t.Fatalf("expected stopped, got %s %v", status, err)
+	}
+
+	if err := p.SendCommand(ctx, "lobby-1", "say hi"); err == nil {
+		t.Fatal("expected the command to fail while offline")
+	}
+
+	if err := p.StartServer(ctx, "lobby-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, err := p.ServerStatus(ctx, "lobby-1"); err != nil || status != StatusRunning {
+		t.Fatalf("expected running, got %s %v", status, err)
+	}
+
+	if err := p.SendCommand(ctx, "lobby-1", "say hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commands) != 1 || commands[0] != "say hi" {
+		t.Fatalf("unexpected commands %v", commands)
+	}
+
+	if err := p.StopServer(ctx, "lobby-2"); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected ErrServerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/provider"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+var ErrNoProvider = errors.New("no server provider configured")
+
+// initProvider returns nil without a SERVER_PROVIDER, servers are then only
+// managed outside of the proxy.
+func initProvider(network string) (provider.Provider, error) {
+	backend := util.EnvWithDefault("SERVER_PROVIDER", "")
+	backendOptions := util.EnvWithDefault("SERVER_PROVIDER_OPTIONS", "{}")
+
+	var prv provider.Provider
+	var err error
+
+	switch backend {
+	case "":
+		return nil, nil
+
+	case "memory":
+		log.Println("Using memory as server provider")
+
+		prv = provider.NewMemory()
+
+	case "docker":
+		log.Println("Using Docker as server provider")
+
+		opts := provider.DockerOptions{}
+		if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+			return nil, err
+		}
+
+		prv, err = provider.NewDocker(network, opts)
+
+	case "kubernetes":
+		log.Println("Using Kubernetes as server provider")
+
+		opts := provider.KubernetesOptions{}
+		if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+			return nil, err
+		}
+
+		prv, err = provider.NewKubernetes(network, opts)
+
+	case "pterodactyl":
+		log.Println("Using Pterodactyl as server provider")
+
+		opts := provider.PterodactylOptions{}
+		if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+			return nil, err
+		}
+		if opts.ApplicationKey == "" {
+			opts.ApplicationKey = os.Getenv("PTERODACTYL_APPLICATION_KEY")
+		}
+		if opts.ClientKey == "" {
+			opts.ClientKey = os.Getenv("PTERODACTYL_CLIENT_KEY")
+		}
+
+		prv, err = provider.NewPterodactyl(network, opts)
+
+	default:
+		return nil, fmt.Errorf("unknown server provider: %s", backend)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return prv, nil
+}
+
+// Provider creates and deletes backend servers, nil if SERVER_PROVIDER isn't
+// set.
+func (n *Hosting) Provider() provider.Provider {
+	return n.prv
+}
+
+func (n *Hosting) CreateServer(ctx context.Context, actor string, spec provider.Spec) (provider.Server, error) {
+	if n.prv == nil {
+		return provider.Server{}, ErrNoProvider
+	}
+
+	s, err := n.prv.CreateServer(ctx, spec)
+	if err != nil {
+		return provider.Server{}, err
+	}
+
+	return s, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "provider.create",
+		Target:  spec.Name,
+		Details: map[string]string{"image": spec.Image},
+	})
+}
+
+func (n *Hosting) DeleteServer(ctx context.Context, actor, name string) error {
+	if n.prv == nil {
+		return ErrNoProvider
+	}
+
+	if err := n.prv.DeleteServer(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "provider.delete", Target: name})
+}
+
+// PowerServer starts or stops the server without deleting it.
+func (n *Hosting) PowerServer(ctx context.Context, actor, name string, start bool) error {
+	powered, ok := n.prv.(provider.Powered)
+	if !ok {
+		return provider.ErrUnsupported
+	}
+
+	action, power := "provider.stop", powered.StopServer
+	if start {
+		action, power = "provider.start", powered.StartServer
+	}
+
+	if err := power(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: action, Target: name})
+}
+
+// ServerCommand runs the command on the console of the server.
+func (n *Hosting) ServerCommand(ctx context.Context, actor, name, command string) error {
+	console, ok := n.prv.(provider.Console)
+	if !ok {
+		return provider.ErrUnsupported
+	}
+
+	if err := console.SendCommand(ctx, name, command); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "provider.command",
+		Target:  name,
+		Details: map[string]string{"command": command},
+	})
+}
+
+func providerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, provider.ErrServerNotFound):
+		api.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, provider.ErrServerExists):
+		api.WriteError(w, http.StatusConflict, err)
+	case errors.Is(err, provider.ErrUnsupported):
+		api.WriteError(w, http.StatusNotImplemented, err)
+	default:
+		api.WriteError(w, http.StatusBadGateway, err)
+	}
+}
+
+func (n *Hosting) handleListProviderServers(w http.ResponseWriter, r *http.Request) {
+	servers, err := n.prv.ListServers(r.Context())
+	if err != nil {
+		providerError(w, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, servers)
+}
+
+func (n *Hosting) handleCreateProviderServer(w http.ResponseWriter, r *http.Request) {
+	spec := provider.Spec{}
+	if err := api.ReadJSON(r, &spec); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if spec.Name == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+
+	s, err := n.CreateServer(r.Context(), "api", spec)
+	if err != nil {
+		providerError(w, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusCreated, s)
+}
+
+func (n *Hosting) handleGetProviderServer(w http.ResponseWriter, r *http.Request) {
+	status, err := n.prv.ServerStatus(r.Context(), r.PathValue("name"))
+	if err != nil {
+		providerError(w, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]provider.Status{"status": status})
+}
+
+func (n *Hosting) handleDeleteProviderServer(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteServer(r.Context(), "api", r.PathValue("name")); err != nil {
+		providerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Hosting) handlePowerProviderServer(start bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := n.PowerServer(r.Context(), "api", r.PathValue("name"), start); err != nil {
+			providerError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type commandRequest struct {
+	Command string `json:"command"`
+}
+
+func (n *Hosting) handleProviderServerCommand(w http.ResponseWriter, r *http.Request) {
+	req := commandRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Command == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("command is required"))
+		return
+	}
+
+	if err := n.ServerCommand(r.Context(), "api", r.PathValue("name"), req.Command); err != nil {
+		providerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
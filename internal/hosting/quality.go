@@ -0,0 +1,54 @@
+package hosting
+
+import (
+	"context"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/quality"
+)
+
+var (
+	pingSeconds    = metrics.NewHistogramVec("gate_player_ping_seconds", "Sampled ping of connected players.", []float64{0.01, 0.025, 0.05, 0.1, 0.15, 0.25, 0.5, 1, 2.5})
+	stalledPlayers = metrics.NewGaugeVec("gate_stalled_players", "Players that missed at least two keep-alives in a row.")
+)
+
+// Quality tracks the connection quality of the players on this proxy.
+func (n *Hosting) Quality() *quality.Tracker {
+	return n.qlt
+}
+
+func (n *Hosting) sampleQuality(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			prx := n.prx.Load()
+			if prx == nil {
+				continue
+			}
+
+			stalled := 0
+			for _, player := range prx.Players() {
+				ping := player.Ping()
+				// Gate reports a negative ping until the first keep-alive
+				if ping < 0 {
+					continue
+				}
+
+				n.qlt.Observe(player.ID(), ping, now)
+				pingSeconds.Observe(ping.Seconds())
+
+				if s, _ := n.qlt.Stats(player.ID(), now); s.Stalled >= 2*n.qlt.KeepAlive() {
+					stalled++
+				}
+			}
+
+			stalledPlayers.Set(int64(stalled))
+		}
+	}
+}
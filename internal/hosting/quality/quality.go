@@ -0,0 +1,173 @@
+// Package quality keeps recent ping samples of connected players to estimate
+// their connection quality.
+package quality
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+type sample struct {
+	ping time.Duration
+	at   time.Time
+}
+
+type conn struct {
+	since   time.Time
+	samples []sample
+	// changed is when the ping last changed, i.e. the last keep-alive
+	// response arrived
+	changed time.Time
+}
+
+// Stats of a player's connection over the sampling window.
+type Stats struct {
+	Player    uuid.UUID
+	Ping      time.Duration
+	AvgPing   time.Duration
+	Jitter    time.Duration
+	Loss      float64
+	Connected time.Time
+	Age       time.Duration
+	// Stalled is how long no keep-alive response arrived. Clients that
+	// can't keep up with the data sent to them answer late, because the
+	// response is only sent after everything before it was processed.
+	Stalled time.Duration
+}
+
+// Tracker collects ping samples per player. Gate only updates a player's
+// ping when a keep-alive response arrives, so samples that repeat the
+// previous value for longer than the keep-alive interval are counted as
+// lost keep-alives.
+type Tracker struct {
+	window    int
+	keepAlive time.Duration
+	conns     map[uuid.UUID]*conn
+	m         sync.Mutex
+}
+
+// New keeps the last window samples of every player.
+func New(window int, keepAlive time.Duration) *Tracker {
+	return &Tracker{window: max(window, 2), keepAlive: keepAlive, conns: make(map[uuid.UUID]*conn)}
+}
+
+// KeepAlive is the interval keep-alive responses are expected in.
+func (t *Tracker) KeepAlive() time.Duration {
+	return t.keepAlive
+}
+
+func (t *Tracker) Connect(player uuid.UUID, at time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.conns[player] = &conn{since: at}
+}
+
+func (t *Tracker) Disconnect(player uuid.UUID) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	delete(t.conns, player)
+}
+
+// Observe adds a sample. Players that were not connected are tracked from
+// the first sample on.
+func (t *Tracker) Observe(player uuid.UUID, ping time.Duration, at time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	c, ok := t.conns[player]
+	if !ok {
+		c = &conn{since: at}
+		t.conns[player] = c
+	}
+
+	if n := len(c.samples); n == 0 || c.samples[n-1].ping != ping {
+		c.changed = at
+	}
+
+	c.samples = append(c.samples, sample{ping: ping, at: at})
+	if len(c.samples) > t.window {
+		c.samples = slices.Delete(c.samples, 0, len(c.samples)-t.window)
+	}
+}
+
+func (t *Tracker) Stats(player uuid.UUID, now time.Time) (Stats, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	c, ok := t.conns[player]
+	if !ok {
+		return Stats{}, false
+	}
+
+	s := Stats{Player: player, Connected: c.since, Age: now.Sub(c.since)}
+	if len(c.samples) == 0 {
+		return s, true
+	}
+
+	s.Ping = c.samples[len(c.samples)-1].ping
+	s.Stalled = now.Sub(c.changed)
+
+	var sum time.Duration
+	for _, smp := range c.samples {
+		sum += smp.ping
+	}
+	s.AvgPing = sum / time.Duration(len(c.samples))
+
+	var variance float64
+	for _, smp := range c.samples {
+		d := float64(smp.ping - s.AvgPing)
+		variance += d * d
+	}
+	s.Jitter = time.Duration(math.Sqrt(variance / float64(len(c.samples))))
+
+	s.Loss = t.loss(c.samples)
+
+	return s, true
+}
+
+// loss compares the keep-alives that should have arrived during the samples
+// with the number of times the ping changed.
+func (t *Tracker) loss(samples []sample) float64 {
+	if t.keepAlive <= 0 || len(samples) < 2 {
+		return 0
+	}
+
+	expected := float64(samples[len(samples)-1].at.Sub(samples[0].at)) / float64(t.keepAlive)
+	if expected < 1 {
+		return 0
+	}
+
+	changes := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].ping != samples[i-1].ping {
+			changes++
+		}
+	}
+
+	return max(0, min(1, 1-float64(changes)/math.Floor(expected)))
+}
+
+// All returns the stats of every tracked player.
+func (t *Tracker) All(now time.Time) []Stats {
+	t.m.Lock()
+	players := make([]uuid.UUID, 0, len(t.conns))
+	for id := range t.conns {
+		players = append(players, id)
+	}
+	t.m.Unlock()
+
+	all := make([]Stats, 0, len(players))
+	for _, id := range players {
+		if s, ok := t.Stats(id, now); ok {
+			all = append(all, s)
+		}
+	}
+
+	return all
+}
@@ -0,0 +1,71 @@
+package quality
+
+import (
+	"testing"
+	"time"
+
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+func TestStats(t *testing.T) {
+	tr := New(10, 10*time.Second)
+	player := uuid.UUID{1}
+	start := time.Unix(0, 0)
+
+	tr.Connect(player, start)
+
+	// One keep-alive every 10s, but the one at 30s never arrives
+	pings := []time.Duration{40, 60, 60, 60, 40}
+	for i, ping := range pings {
+		tr.Observe(player, ping*time.Millisecond, start.Add(time.Duration(i)*10*time.Second))
+	}
+
+	s, ok := tr.Stats(player, start.Add(time.Minute))
+	if !ok {
+		t.Fatal("expected stats of connected player")
+	}
+
+	if s.Ping != 40*time.Millisecond {
+		t.Errorf("expected ping 40ms, got %s", s.Ping)
+	}
+
+	if s.AvgPing != 52*time.Millisecond {
+		t.Errorf("expected average ping 52ms, got %s", s.AvgPing)
+	}
+
+	if s.Jitter <= 0 {
+		t.Errorf("expected jitter, got %s", s.Jitter)
+	}
+
+	if s.Loss != 0.5 {
+		t.Errorf("expected loss 0.5, got %f", s.Loss)
+	}
+
+	if s.Age != time.Minute {
+		t.Errorf("expected age 1m, got %s", s.Age)
+	}
+
+	if s.Stalled != 20*time.Second {
+		t.Errorf("expected stalled for 20s, got %s", s.Stalled)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	tr := New(3, 0)
+	player := uuid.UUID{1}
+
+	for i := range 5 {
+		tr.Observe(player, time.Duration(i)*time.Millisecond, time.Unix(int64(i), 0))
+	}
+
+	s, _ := tr.Stats(player, time.Unix(5, 0))
+	if s.AvgPing != 3*time.Millisecond {
+		t.Errorf("expected average of the last 3 samples, got %s", s.AvgPing)
+	}
+
+	tr.Disconnect(player)
+
+	if _, ok := tr.Stats(player, time.Unix(5, 0)); ok {
+		t.Fatal("expected no stats after disconnect")
+	}
+}
@@ -0,0 +1,309 @@
+// Package recordings records the packets of selected players, e.g. while
+// they are under investigation, into gzipped JSON lines in the object store.
+// Recordings are cut into segments by size and age, and deleted once they
+// are older than the retention.
+package recordings
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+)
+
+// Prefix of the recordings in the object store,
+// recordings/<player>/<start unix ms>-<pod>.jsonl.gz.
+const Prefix = "recordings/"
+
+// idle ends segments of players that left, the recorder doesn't see
+// disconnects.
+const idle = time.Minute
+
+// Target is a player to record, stored under the lowercase name. Players
+// are matched by name because that is what connections send at login.
+type Target struct {
+	Player string `json:"player"`
+	Reason string `json:"reason,omitempty"`
+	By     string `json:"by,omitempty"`
+	// Until ends the recording, zero records until the target is removed.
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (t Target) active(now time.Time) bool {
+	return t.Until.IsZero() || now.Before(t.Until)
+}
+
+type Options struct {
+	// MaxBytes is the size of the recorded JSON at which a segment is
+	// stored, compressed segments are a fraction of it.
+	MaxBytes int
+	// Segment is the longest a segment runs before it is stored.
+	Segment time.Duration
+	// Retention is how long segments are kept.
+	Retention time.Duration
+}
+
+type segment struct {
+	player  string
+	started time.Time
+	last    time.Time
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	enc     *json.Encoder
+	// size is written before compression, the gzip writer buffers so the
+	// buffer doesn't grow with every packet
+	size int
+}
+
+func (s *segment) Write(p []byte) (int, error) {
+	n, err := s.gz.Write(p)
+	s.size += n
+
+	return n, err
+}
+
+func newSegment(player string, now time.Time) *segment {
+	s := &segment{player: player, started: now, last: now}
+	s.gz = gzip.NewWriter(&s.buf)
+	s.enc = json.NewEncoder(s)
+
+	return s
+}
+
+type Recorder struct {
+	kv   kv.Bucket
+	obj  object.Store
+	pod  string
+	opts Options
+
+	targets map[string]Target
+	active  map[string]*segment
+	// done segments wait for Flush to store them
+	done []*segment
+	m    sync.Mutex
+}
+
+func New(ctx context.Context, bucket kv.Bucket, obj object.Store, pod string, opts Options) (*Recorder, error) {
+	r := &Recorder{kv: bucket, obj: obj, pod: pod, opts: opts, targets: make(map[string]Target), active: make(map[string]*segment)}
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Recorder) Reload(ctx context.Context) error {
+	keys, err := r.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets := make(map[string]Target)
+	for _, key := range keys {
+		raw, err := r.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		t := Target{}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			log.Printf("Failed to unmarshal recording target %s: %v", key, err)
+			continue
+		}
+
+		targets[key] = t
+	}
+
+	r.m.Lock()
+	r.targets = targets
+	r.m.Unlock()
+
+	return nil
+}
+
+// HandleChange applies a change of the bucket, for kv.Watch.
+func (r *Recorder) HandleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		t := Target{}
+		if err := json.Unmarshal(v.Value, &t); err != nil {
+			log.Printf("Failed to unmarshal recording target %s: %v", v.Key, err)
+			return
+		}
+
+		r.targets[v.Key] = t
+
+	case kv.Delete:
+		delete(r.targets, v.Key)
+	}
+}
+
+func (r *Recorder) Targets() []Target {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	targets := make([]Target, 0, len(r.targets))
+	for _, t := range r.targets {
+		targets = append(targets, t)
+	}
+
+	return targets
+}
+
+func (r *Recorder) Add(ctx context.Context, t Target) error {
+	if t.Player == "" {
+		return errors.New("player is required")
+	}
+
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	if err := r.kv.Set(ctx, strings.ToLower(t.Player), raw); err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	r.targets[strings.ToLower(t.Player)] = t
+	r.m.Unlock()
+
+	return nil
+}
+
+// Remove stops recording the player, what was recorded is stored by the
+// next Flush.
+func (r *Recorder) Remove(ctx context.Context, player string) error {
+	if err := r.kv.Delete(ctx, strings.ToLower(player)); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+
+	r.m.Lock()
+	delete(r.targets, strings.ToLower(player))
+	r.m.Unlock()
+
+	return nil
+}
+
+func (r *Recorder) Wants(player string) bool {
+	if player == "" {
+		return false
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	t, ok := r.targets[strings.ToLower(player)]
+
+	return ok && t.active(time.Now())
+}
+
+func (r *Recorder) Observe(p packets.Packet) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	key := strings.ToLower(p.Player)
+
+	s, ok := r.active[key]
+	if !ok {
+		s = newSegment(key, p.Time)
+		r.active[key] = s
+	}
+
+	if err := s.enc.Encode(p); err != nil {
+		log.Printf("Failed to record a packet of %s: %v", p.Player, err)
+		return
+	}
+	s.last = p.Time
+
+	if s.size >= r.opts.MaxBytes {
+		delete(r.active, key)
+		r.done = append(r.done, s)
+	}
+}
+
+// Flush stores the segments that are full, older than the segment length,
+// idle or whose target was removed. With all set it stores every segment,
+// e.g. on shutdown.
+func (r *Recorder) Flush(ctx context.Context, now time.Time, all bool) error {
+	r.m.Lock()
+	for key, s := range r.active {
+		t, ok := r.targets[key]
+		if all || !ok || !t.active(now) || now.Sub(s.started) >= r.opts.Segment || now.Sub(s.last) >= idle {
+			delete(r.active, key)
+			r.done = append(r.done, s)
+		}
+	}
+
+	done := r.done
+	r.done = nil
+	r.m.Unlock()
+
+	var errs []error
+	for _, s := range done {
+		if err := s.gz.Close(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		name := fmt.Sprintf("%s%s/%d-%s.jsonl.gz", Prefix, s.player, s.started.UnixMilli(), r.pod)
+		if err := r.obj.Put(ctx, name, &s.buf); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Recordings lists the stored segments of the player, of all players if
+// player is "".
+func (r *Recorder) Recordings(ctx context.Context, player string) ([]object.Info, error) {
+	prefix := Prefix
+	if player != "" {
+		prefix += strings.ToLower(player) + "/"
+	}
+
+	return r.obj.List(ctx, prefix)
+}
+
+// Prune deletes the segments older than the retention and returns how many.
+func (r *Recorder) Prune(ctx context.Context, now time.Time) (int, error) {
+	infos, err := r.obj.List(ctx, Prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, info := range infos {
+		if now.Sub(info.ModTime) < r.opts.Retention {
+			continue
+		}
+
+		if err := r.obj.Delete(ctx, info.Name); err != nil && !errors.Is(err, object.ErrObjectNotFound) {
+			return pruned, err
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,159 @@
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newRecorder(t *testing.T, opts Options) (*Recorder, *object.Memory) {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := object.NewMemory()
+
+	r, err := New(context.Background(), bucket, obj, "proxy-0", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r, obj
+}
+
+func packet(player string, at time.Time, dir packets.Direction, state packets.State, id int, data string) packets.Packet {
+	return packets.Packet{Time: at, Remote: "127.0.0.1:50000", Player: player, Protocol: 767, Direction: dir, State: state, ID: id, Length: len(data) + 1, Data: []byte(data)}
+}
+
+func TestRecordAndTimeline(t *testing.T) {
+	ctx := context.Background()
+	r, obj := newRecorder(t, Options{MaxBytes: 1 << 20, Segment: time.Hour, Retention: time.Hour})
+
+	if err := r.Add(ctx, Target{Player: "Notch", Reason: "x-ray report"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Wants("notch") || r.Wants("jeb_") || r.Wants("") {
+		t.Fatal("expected only Notch to be wanted")
+	}
+
+	start := time.Now()
+	r.Observe(packet("Notch", start, packets.Serverbound, packets.Login, 0x00, "\x05Notch"))
+	r.Observe(packet("Notch", start.Add(1500*time.Millisecond), packets.Serverbound, packets.Game, 0x06, "\x0bhello world"))
+
+	// Nothing is due yet
+	if err := r.Flush(ctx, start.Add(2*time.Second), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if infos, _ := r.Recordings(ctx, "Notch"); len(infos) != 0 {
+		t.Fatalf("expected no stored segment yet, got %d", len(infos))
+	}
+
+	if err := r.Remove(ctx, "Notch"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the target ends its segment
+	if err := r.Flush(ctx, start.Add(3*time.Second), false); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := r.Recordings(ctx, "notch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 1 || !strings.HasPrefix(infos[0].Name, "recordings/notch/") || !strings.HasSuffix(infos[0].Name, "-proxy-0.jsonl.gz") {
+		t.Fatalf("unexpected segments %+v", infos)
+	}
+
+	rc, err := obj.Get(ctx, infos[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	out := bytes.Buffer{}
+	if err := Timeline(rc, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 packets, got:\n%s", out.String())
+	}
+
+	if !strings.Contains(lines[1], "C->S login") || !strings.Contains(lines[1], "login start") || !strings.Contains(lines[1], `"Notch"`) {
+		t.Errorf("unexpected login line %q", lines[1])
+	}
+
+	if !strings.HasPrefix(lines[2], "+1.5s") || !strings.Contains(lines[2], `"hello world"`) {
+		t.Errorf("unexpected chat line %q", lines[2])
+	}
+}
+
+func TestSegments(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newRecorder(t, Options{MaxBytes: 1024, Segment: time.Minute, Retention: time.Hour})
+
+	if err := r.Add(ctx, Target{Player: "Notch"}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		r.Observe(packet("Notch", start.Add(time.Duration(i)*time.Millisecond), packets.Clientbound, packets.Game, 0x27, strings.Repeat("chunk", 20)))
+	}
+
+	if err := r.Flush(ctx, start.Add(time.Second), false); err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := r.Recordings(ctx, "Notch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(full) < 2 {
+		t.Fatalf("expected the size limit to cut several segments, got %d", len(full))
+	}
+
+	if err := r.Flush(ctx, start.Add(2*time.Minute), true); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := r.Prune(ctx, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if left, _ := r.Recordings(ctx, ""); pruned < len(full) || len(left) != 0 {
+		t.Fatalf("expected every segment to be pruned, pruned %d, %d left", pruned, len(left))
+	}
+}
+
+func TestExpiredTarget(t *testing.T) {
+	r, _ := newRecorder(t, Options{MaxBytes: 1 << 20, Segment: time.Hour, Retention: time.Hour})
+
+	if err := r.Add(context.Background(), Target{Player: "Notch", Until: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Wants("Notch") {
+		t.Fatal("expected an expired target not to be recorded")
+	}
+}
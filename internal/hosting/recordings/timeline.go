@@ -0,0 +1,119 @@
+package recordings
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+)
+
+// names of the packets whose IDs don't change between versions.
+var names = map[packets.State]map[packets.Direction]map[int]string{
+	packets.Handshake: {packets.Serverbound: {0x00: "handshake"}},
+	packets.Status: {
+		packets.Serverbound: {0x00: "status request", 0x01: "ping"},
+		packets.Clientbound: {0x00: "status response", 0x01: "pong"},
+	},
+	packets.Login: {
+		packets.Serverbound: {0x00: "login start", 0x01: "encryption response", 0x02: "plugin response", 0x03: "login acknowledged", 0x04: "cookie response"},
+		packets.Clientbound: {0x00: "disconnect", 0x01: "encryption request", 0x02: "login success", 0x03: "set compression", 0x04: "plugin request", 0x05: "cookie request"},
+	},
+}
+
+// minText is the shortest run of printable characters shown, shorter ones
+// are mostly coordinates and IDs that happen to be printable.
+const minText = 4
+
+// text returns the printable runs of data like strings(1), which shows the
+// chat messages, commands and names in a packet.
+func text(data []byte) []string {
+	var runs []string
+
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		printable := i < len(data) && data[i] >= 0x20 && data[i] < 0x7F
+		if printable && start < 0 {
+			start = i
+		} else if !printable && start >= 0 {
+			if i-start >= minText {
+				runs = append(runs, string(data[start:i]))
+			}
+			start = -1
+		}
+	}
+
+	return runs
+}
+
+// Timeline writes a recording as one line per packet, with the time since
+// the first packet, direction, state, ID and name if known, length and the
+// text in the packet.
+func Timeline(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	var start time.Time
+	for {
+		p := packets.Packet{}
+		if err := dec.Decode(&p); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if start.IsZero() {
+			start = p.Time
+			fmt.Fprintf(out, "%s: %s from %s, protocol %d, %s\n", p.Time.Format(time.RFC3339), p.Player, p.Remote, p.Protocol, minecraftVersion(p.Protocol))
+		}
+
+		arrow := "C->S"
+		if p.Direction == packets.Clientbound {
+			arrow = "S->C"
+		}
+
+		line := fmt.Sprintf("+%-11s %s %-9s 0x%02X", p.Time.Sub(start).Round(time.Millisecond), arrow, p.State, p.ID)
+		if name, ok := names[p.State][p.Direction][p.ID]; ok {
+			line += " " + name
+		}
+
+		line += " (" + strconv.Itoa(p.Length) + " B)"
+		if runs := text(p.Data); len(runs) > 0 {
+			line += " " + strconv.Quote(strings.Join(runs, " "))
+		}
+
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+}
+
+func minecraftVersion(protocol int) string {
+	switch {
+	case protocol >= 769:
+		return "1.21.4+"
+	case protocol >= 768:
+		return "1.21.2"
+	case protocol >= 767:
+		return "1.21"
+	case protocol >= 766:
+		return "1.20.5"
+	case protocol >= 764:
+		return "1.20.2"
+	default:
+		return "before 1.20.2"
+	}
+}
@@ -0,0 +1,115 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/reporting"
+)
+
+var pluginPanics = metrics.NewCounterVec("gate_plugin_panics_total", "Panics recovered from plugin handlers and goroutines.", "plugin")
+
+// Guard wraps an event handler of the named plugin. A panic in the handler is
+// recovered and counted against the plugin instead of going unattributed, and
+// the handler is skipped once the plugin is disabled.
+func Guard[E any](n *Hosting, plugin string, handler func(E)) func(E) {
+	// The state of the plugin is looked up once, so events of different
+	// plugins don't contend for the lifecycle lock
+	n.lc.m.Lock()
+	p := n.lc.plugin(plugin)
+	n.lc.m.Unlock()
+
+	return func(e E) {
+		if p.disabled.Load() {
+			return
+		}
+
+		defer n.Recover(plugin)
+
+		handler(e)
+	}
+}
+
+// Go runs fn in a goroutine with the plugin's context. If fn panics it is
+// restarted after a second, unless the plugin was disabled in the meantime.
+func (n *Hosting) Go(plugin string, fn func(ctx context.Context)) {
+	go func() {
+		for {
+			ctx := n.PluginContext(plugin)
+
+			if !n.runGuarded(plugin, ctx, fn) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+
+			log.Printf("Restarting crashed goroutine of plugin %s", plugin)
+		}
+	}()
+}
+
+// runGuarded reports whether fn panicked.
+func (n *Hosting) runGuarded(plugin string, ctx context.Context, fn func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			n.handlePanic(plugin, r)
+			panicked = true
+		}
+	}()
+
+	fn(ctx)
+
+	return false
+}
+
+// Recover must be deferred directly. It logs and counts a panic of the named
+// plugin and disables the plugin if it keeps crashing.
+func (n *Hosting) Recover(plugin string) {
+	if r := recover(); r != nil {
+		n.handlePanic(plugin, r)
+	}
+}
+
+func (n *Hosting) handlePanic(plugin string, r any) {
+	stack := debug.Stack()
+	log.Printf("ERROR: Plugin %s panicked: %v\n%s", plugin, r, stack)
+	pluginPanics.Inc(plugin)
+	n.rep.Panic(plugin, r, stack, reporting.Context{})
+
+	limit, window := n.lc.panicLimit, n.lc.panicWindow
+	if limit <= 0 {
+		return
+	}
+
+	n.lc.m.Lock()
+	p := n.lc.plugin(plugin)
+	now := time.Now()
+	p.panics = append(p.panics, now)
+	for len(p.panics) > 0 && now.Sub(p.panics[0]) > window {
+		p.panics = p.panics[1:]
+	}
+	crashing := len(p.panics) >= limit
+	n.lc.m.Unlock()
+
+	if !crashing || !n.DisablePlugin(plugin) {
+		return
+	}
+
+	if err := n.adt.Record(context.Background(), audit.Entry{
+		Actor:   "system",
+		Action:  "plugin.disable",
+		Target:  plugin,
+		Details: map[string]string{"reason": fmt.Sprintf("%d panics within %s", limit, window)},
+	}); err != nil {
+		log.Printf("Failed to record audit entry: %v", err)
+	}
+}
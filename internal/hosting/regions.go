@@ -0,0 +1,172 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/regions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+// initGeoIP loads the country CSV of GEOIP_FILE, nil without one. A nil
+// GeoIP knows no countries.
+func initGeoIP() (*regions.GeoIP, error) {
+	path := util.EnvWithDefault("GEOIP_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GEOIP_FILE: %w", err)
+	}
+	defer f.Close()
+
+	geo, err := regions.LoadGeoIP(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GEOIP_FILE: %w", err)
+	}
+
+	return geo, nil
+}
+
+// GeoIP looks up the countries of players, it knows none without
+// GEOIP_FILE.
+func (n *Hosting) GeoIP() *regions.GeoIP {
+	return n.geo
+}
+
+// Regions lists the regions of the network and the proxies that are up in
+// them.
+func (n *Hosting) Regions() *regions.Directory {
+	return n.reg
+}
+
+func (n *Hosting) SetRegion(ctx context.Context, actor string, r regions.Region) error {
+	if err := n.reg.SetRegion(ctx, r); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "region.set", Target: r.Name})
+}
+
+func (n *Hosting) DeleteRegion(ctx context.Context, actor, name string) error {
+	if err := n.reg.DeleteRegion(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "region.delete", Target: name})
+}
+
+// announceRegion keeps this proxy listed in its region until ctx is done.
+func (n *Hosting) announceRegion(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	announce := func(now time.Time) {
+		players := 0
+		if prx := n.prx.Load(); prx != nil {
+			players = prx.PlayerCount()
+		}
+
+		if err := n.reg.Announce(ctx, regions.Proxy{Name: n.Info.PodName, Region: n.Info.Region, Players: players, Seen: now}); err != nil {
+			log.Printf("Failed to announce the proxy in region %s: %v", n.Info.Region, err)
+		}
+	}
+
+	announce(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			if err := n.reg.Withdraw(context.Background(), n.Info.PodName); err != nil {
+				log.Printf("Failed to withdraw the proxy from region %s: %v", n.Info.Region, err)
+			}
+			return
+		case now := <-ticker.C:
+			announce(now)
+		}
+	}
+}
+
+// preferRegion narrows instances down to those tagged with the region of the
+// proxy, if there are any, so players stay close to the proxy they are on.
+func (m *InstanceManager) preferRegion(instances []instance) []instance {
+	if m.region == "" {
+		return instances
+	}
+
+	sel := registry.Selector{{Key: "region", Operator: registry.Equals, Value: m.region}}
+
+	var local []instance
+	for _, i := range instances {
+		if sel.Matches(i.info.Labels(i.server.ServerInfo().Name())) {
+			local = append(local, i)
+		}
+	}
+
+	if len(local) == 0 {
+		return instances
+	}
+
+	return local
+}
+
+type regionsResponse struct {
+	Regions []regions.Region `json:"regions"`
+	Proxies []regions.Proxy  `json:"proxies"`
+}
+
+func (n *Hosting) handleListRegions(w http.ResponseWriter, r *http.Request) {
+	res := regionsResponse{}
+
+	var err error
+	if res.Regions, err = n.reg.Regions(r.Context()); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if res.Proxies, err = n.reg.Proxies(r.Context(), time.Now()); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, res)
+}
+
+func (n *Hosting) handleSetRegion(w http.ResponseWriter, r *http.Request) {
+	region := regions.Region{Port: 25565}
+	if err := api.ReadJSON(r, &region); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	region.Name = r.PathValue("name")
+
+	if err := region.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetRegion(r.Context(), "api", region); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, region)
+}
+
+func (n *Hosting) handleDeleteRegion(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteRegion(r.Context(), "api", r.PathValue("name")); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
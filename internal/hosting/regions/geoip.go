@@ -0,0 +1,93 @@
+package regions
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+type ipRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// GeoIP looks up the country of an address in a list of ranges, like the
+// free country CSVs of DB-IP or IP2Location: one start,end,country line per
+// range, IPv4 and IPv6 mixed.
+type GeoIP struct {
+	ranges []ipRange
+}
+
+// LoadGeoIP reads a range CSV. Ranges must not overlap.
+func LoadGeoIP(r io.Reader) (*GeoIP, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	g := &GeoIP{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %q: expected start,end,country", strings.Join(record, ","))
+		}
+
+		start, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("invalid range %s-%s", start, end)
+		}
+
+		// ZZ is used for private and unassigned ranges
+		if country := strings.ToUpper(record[2]); country != "" && country != "ZZ" {
+			g.ranges = append(g.ranges, ipRange{start: start, end: end, country: country})
+		}
+	}
+
+	slices.SortFunc(g.ranges, func(a, b ipRange) int {
+		return a.start.Compare(b.start)
+	})
+
+	return g, nil
+}
+
+// Country returns the ISO 3166 code of the address, "" if it is unknown.
+func (g *GeoIP) Country(addr netip.Addr) string {
+	if g == nil {
+		return ""
+	}
+
+	addr = addr.Unmap()
+
+	// The last range starting at or before addr is the only one that can
+	// contain it
+	i, found := slices.BinarySearchFunc(g.ranges, addr, func(r ipRange, a netip.Addr) int {
+		return r.start.Compare(a)
+	})
+	if !found {
+		i--
+	}
+
+	if i < 0 || g.ranges[i].end.Less(addr) || g.ranges[i].start.Is4() != addr.Is4() {
+		return ""
+	}
+
+	return g.ranges[i].country
+}
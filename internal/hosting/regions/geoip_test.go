@@ -0,0 +1,59 @@
+package regions
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const ranges = `# start,end,country
+1.0.0.0,1.0.0.255,AU
+10.0.0.0,10.255.255.255,ZZ
+5.1.0.0,5.1.255.255,de
+2001:db8::,2001:db8::ffff,FR
+`
+
+func TestGeoIP(t *testing.T) {
+	g, err := LoadGeoIP(strings.NewReader(ranges))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for addr, want := range map[string]string{
+		"1.0.0.0":          "AU",
+		"1.0.0.255":        "AU",
+		"1.0.1.0":          "",
+		"5.1.2.3":          "DE",
+		"::ffff:5.1.2.3":   "DE",
+		"10.1.2.3":         "",
+		"0.0.0.1":          "",
+		"2001:db8::1":      "FR",
+		"2001:db8::1:0":    "",
+		"255.255.255.255":  "",
+		"2001:db7:ffff::1": "",
+	} {
+		if got := g.Country(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: expected %q, got %q", addr, want, got)
+		}
+	}
+}
+
+func TestGeoIPInvalid(t *testing.T) {
+	for _, csv := range []string{
+		"1.0.0.0,AU\n",
+		"1.0.0.255,1.0.0.0,AU\n",
+		"1.0.0.0,2001:db8::,AU\n",
+		"nope,1.0.0.0,AU\n",
+	} {
+		if _, err := LoadGeoIP(strings.NewReader(csv)); err == nil {
+			t.Errorf("%q: expected an error", csv)
+		}
+	}
+}
+
+func TestGeoIPNil(t *testing.T) {
+	var g *GeoIP
+	if got := g.Country(netip.MustParseAddr("1.0.0.0")); got != "" {
+		t.Fatalf("expected no country without a database, got %q", got)
+	}
+}
@@ -0,0 +1,233 @@
+// Package regions knows the regions of a network, where players connect to
+// reach each of them and which proxies are up in them. Proxies announce
+// themselves every few seconds, a region without a live proxy isn't offered
+// to players.
+package regions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+const (
+	// region.<name> holds a Region
+	regionKeyPrefix = "region."
+	// proxy.<pod> holds the Proxy of a pod
+	proxyKeyPrefix = "proxy."
+)
+
+var ErrRegionNotFound = errors.New("region not found")
+
+type Region struct {
+	Name string `json:"name"`
+	// Host and Port are what clients connect to for the region, e.g. the
+	// load balancer in front of its proxies.
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Countries are the ISO 3166 codes of the countries the region is
+	// closest to, e.g. DE.
+	Countries []string `json:"countries,omitempty"`
+}
+
+func (r Region) Validate() error {
+	if r.Name == "" || strings.ContainsAny(r.Name, ". ") {
+		return fmt.Errorf("invalid region name %q", r.Name)
+	}
+
+	if r.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if r.Port <= 0 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d", r.Port)
+	}
+
+	return nil
+}
+
+// Proxy is what a proxy announces about itself.
+type Proxy struct {
+	Name    string    `json:"name"`
+	Region  string    `json:"region"`
+	Players int       `json:"players"`
+	Seen    time.Time `json:"seen"`
+}
+
+type Directory struct {
+	kv kv.Bucket
+	// ttl is how long a proxy counts as live after its last announcement.
+	ttl time.Duration
+}
+
+func New(bucket kv.Bucket, ttl time.Duration) *Directory {
+	return &Directory{kv: bucket, ttl: ttl}
+}
+
+func (d *Directory) list(ctx context.Context, prefix string, each func(raw []byte) error) error {
+	keys, err := d.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		raw, err := d.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := each(raw); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Directory) set(ctx context.Context, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return d.kv.Set(ctx, key, raw)
+}
+
+// Regions returns the regions sorted by name.
+func (d *Directory) Regions(ctx context.Context) ([]Region, error) {
+	var regions []Region
+	err := d.list(ctx, regionKeyPrefix, func(raw []byte) error {
+		r := Region{}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+
+		regions = append(regions, r)
+		return nil
+	})
+
+	slices.SortFunc(regions, func(a, b Region) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return regions, err
+}
+
+func (d *Directory) Region(ctx context.Context, name string) (Region, error) {
+	raw, err := d.kv.Get(ctx, regionKeyPrefix+name)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return Region{}, ErrRegionNotFound
+	} else if err != nil {
+		return Region{}, err
+	}
+
+	r := Region{}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return Region{}, err
+	}
+
+	return r, nil
+}
+
+func (d *Directory) SetRegion(ctx context.Context, r Region) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	return d.set(ctx, regionKeyPrefix+r.Name, r)
+}
+
+func (d *Directory) DeleteRegion(ctx context.Context, name string) error {
+	if err := d.kv.Delete(ctx, regionKeyPrefix+name); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *Directory) Announce(ctx context.Context, p Proxy) error {
+	return d.set(ctx, proxyKeyPrefix+p.Name, p)
+}
+
+// Withdraw removes the proxy, e.g. when it shuts down, so it isn't counted
+// until its announcement expires.
+func (d *Directory) Withdraw(ctx context.Context, name string) error {
+	if err := d.kv.Delete(ctx, proxyKeyPrefix+name); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// Proxies returns the proxies that announced themselves within the TTL
+// before now, sorted by name.
+func (d *Directory) Proxies(ctx context.Context, now time.Time) ([]Proxy, error) {
+	var proxies []Proxy
+	err := d.list(ctx, proxyKeyPrefix, func(raw []byte) error {
+		p := Proxy{}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+
+		if now.Sub(p.Seen) <= d.ttl {
+			proxies = append(proxies, p)
+		}
+		return nil
+	})
+
+	slices.SortFunc(proxies, func(a, b Proxy) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return proxies, err
+}
+
+// Live returns the regions with at least one live proxy.
+func (d *Directory) Live(ctx context.Context, now time.Time) ([]Region, error) {
+	regions, err := d.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies, err := d.Proxies(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(regions, func(r Region) bool {
+		return !slices.ContainsFunc(proxies, func(p Proxy) bool { return p.Region == r.Name })
+	}), nil
+}
+
+// Closest returns the live region listing the country, false if there is
+// none.
+func (d *Directory) Closest(ctx context.Context, country string, now time.Time) (Region, bool, error) {
+	if country == "" {
+		return Region{}, false, nil
+	}
+
+	regions, err := d.Live(ctx, now)
+	if err != nil {
+		return Region{}, false, err
+	}
+
+	for _, r := range regions {
+		if slices.ContainsFunc(r.Countries, func(c string) bool { return strings.EqualFold(c, country) }) {
+			return r, true, nil
+		}
+	}
+
+	return Region{}, false, nil
+}
@@ -0,0 +1,113 @@
+package regions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func newDirectory(t *testing.T) *Directory {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "regions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(bucket, 45*time.Second)
+}
+
+func TestRegions(t *testing.T) {
+	ctx := context.Background()
+	d := newDirectory(t)
+
+	if err := d.SetRegion(ctx, Region{Name: "eu", Host: "eu.example.com", Port: 25565, Countries: []string{"DE", "FR"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SetRegion(ctx, Region{Name: "us", Host: "us.example.com", Port: 25565, Countries: []string{"US"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SetRegion(ctx, Region{Name: "bad.name", Host: "x", Port: 1}); err == nil {
+		t.Fatal("expected an error for a name with a dot")
+	}
+
+	regions, err := d.Regions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(regions) != 2 || regions[0].Name != "eu" || regions[1].Name != "us" {
+		t.Fatalf("unexpected regions %+v", regions)
+	}
+
+	if err := d.DeleteRegion(ctx, "us"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Region(ctx, "us"); !errors.Is(err, ErrRegionNotFound) {
+		t.Fatalf("expected ErrRegionNotFound, got %v", err)
+	}
+}
+
+func TestClosest(t *testing.T) {
+	ctx := context.Background()
+	d := newDirectory(t)
+
+	for _, r := range []Region{
+		{Name: "eu", Host: "eu.example.com", Port: 25565, Countries: []string{"DE", "FR"}},
+		{Name: "us", Host: "us.example.com", Port: 25565, Countries: []string{"US"}},
+	} {
+		if err := d.SetRegion(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.Announce(ctx, Proxy{Name: "proxy-eu-0", Region: "eu", Seen: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Announced too long ago to count
+	if err := d.Announce(ctx, Proxy{Name: "proxy-us-0", Region: "us", Seen: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok, err := d.Closest(ctx, "de", now); err != nil || !ok || r.Name != "eu" {
+		t.Fatalf("expected eu for DE, got %+v %v %v", r, ok, err)
+	}
+
+	if _, ok, err := d.Closest(ctx, "US", now); err != nil || ok {
+		t.Fatalf("expected no live region for US, got %v %v", ok, err)
+	}
+
+	if err := d.Announce(ctx, Proxy{Name: "proxy-us-0", Region: "us", Seen: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok, err := d.Closest(ctx, "US", now); err != nil || !ok || r.Name != "us" {
+		t.Fatalf("expected us once its proxy announced, got %+v %v %v", r, ok, err)
+	}
+
+	if err := d.Withdraw(ctx, "proxy-eu-0"); err != nil {
+		t.Fatal(err)
+	}
+
+	proxies, err := d.Proxies(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proxies) != 1 || proxies[0].Name != "proxy-us-0" {
+		t.Fatalf("unexpected proxies %+v", proxies)
+	}
+}
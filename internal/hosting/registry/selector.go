@@ -0,0 +1,130 @@
+// Package registry selects servers by their labels.
+//
+// A selector is a comma separated list of requirements that all have to
+// match, e.g. "type=lobby,region=eu,version!=1.20":
+//
+//	key=value   the label is set to value
+//	key!=value  the label is not set to value (or not set at all)
+//	key         the label is set
+//	!key        the label is not set
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidSelector = errors.New("invalid selector")
+
+type Operator string
+
+const (
+	Equals    Operator = "="
+	NotEquals Operator = "!="
+	Exists    Operator = "exists"
+	NotExists Operator = "!exists"
+)
+
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Value    string
+}
+
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+
+	switch r.Operator {
+	case Equals:
+		return ok && v == r.Value
+	case NotEquals:
+		return !ok || v != r.Value
+	case Exists:
+		return ok
+	case NotExists:
+		return !ok
+	default:
+		return false
+	}
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case NotExists:
+		return "!" + r.Key
+	default:
+		return r.Key + string(r.Operator) + r.Value
+	}
+}
+
+// Selector matches labels that satisfy all of its requirements. The empty
+// selector matches everything.
+type Selector []Requirement
+
+func Parse(s string) (Selector, error) {
+	sel := make(Selector, 0)
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r := Requirement{}
+		if k, v, ok := strings.Cut(part, "!="); ok {
+			r = Requirement{Key: k, Operator: NotEquals, Value: v}
+		} else if k, v, ok := strings.Cut(part, "="); ok {
+			r = Requirement{Key: k, Operator: Equals, Value: v}
+		} else if k, ok := strings.CutPrefix(part, "!"); ok {
+			r = Requirement{Key: k, Operator: NotExists}
+		} else {
+			r = Requirement{Key: part, Operator: Exists}
+		}
+
+		r.Key, r.Value = strings.TrimSpace(r.Key), strings.TrimSpace(r.Value)
+		if r.Key == "" {
+			return nil, fmt.Errorf("%w: %q has no key", ErrInvalidSelector, part)
+		}
+
+		sel = append(sel, r)
+	}
+
+	return sel, nil
+}
+
+// MustParse is Parse for selectors known at compile time.
+func MustParse(s string) Selector {
+	sel, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return sel
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// And returns a selector that requires both s and other.
+func (s Selector) And(other Selector) Selector {
+	return append(append(make(Selector, 0, len(s)+len(other)), s...), other...)
+}
+
+func (s Selector) String() string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		parts = append(parts, r.String())
+	}
+
+	return strings.Join(parts, ",")
+}
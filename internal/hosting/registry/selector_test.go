@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"type": "lobby", "region": "eu", "version": "1.21"}
+
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"type=lobby", true},
+		{"type=lobby,region=eu", true},
+		{"type=lobby, region=us", false},
+		{"version!=1.20", true},
+		{"version!=1.21", false},
+		{"missing!=x", true},
+		{"region", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!region", false},
+	}
+
+	for _, test := range tests {
+		sel, err := Parse(test.selector)
+		if err != nil {
+			t.Fatalf("%q: %v", test.selector, err)
+		}
+
+		if got := sel.Matches(labels); got != test.matches {
+			t.Errorf("%q: expected %t, got %t", test.selector, test.matches, got)
+		}
+	}
+}
+
+func TestSelectorInvalid(t *testing.T) {
+	for _, s := range []string{"=lobby", "!", "type=lobby,!=eu"} {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("%q: expected ErrInvalidSelector, got %v", s, err)
+		}
+	}
+}
+
+func TestSelectorString(t *testing.T) {
+	s := "type=lobby,version!=1.20,region,!canary"
+
+	if got := MustParse(s).String(); got != s {
+		t.Fatalf("expected %q, got %q", s, got)
+	}
+
+	if got := MustParse("type=lobby").And(MustParse("region=eu")).String(); got != "type=lobby,region=eu" {
+		t.Fatalf("unexpected combined selector %q", got)
+	}
+}
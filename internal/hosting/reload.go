@@ -0,0 +1,87 @@
+package hosting
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+)
+
+type reloaders struct {
+	fns   map[string]func(ctx context.Context) error
+	names []string
+	m     sync.Mutex
+}
+
+// OnReload registers fn to be called when a reload of all plugin state is
+// requested through POST /reload.
+func (n *Hosting) OnReload(plugin string, fn func(ctx context.Context) error) {
+	n.rl.m.Lock()
+	defer n.rl.m.Unlock()
+
+	if n.rl.fns == nil {
+		n.rl.fns = make(map[string]func(ctx context.Context) error)
+	}
+
+	if _, ok := n.rl.fns[plugin]; !ok {
+		n.rl.names = append(n.rl.names, plugin)
+		slices.Sort(n.rl.names)
+	}
+
+	n.rl.fns[plugin] = fn
+}
+
+// Reload calls every registered reload function and returns the errors by
+// plugin name.
+func (n *Hosting) Reload(ctx context.Context) map[string]error {
+	n.rl.m.Lock()
+	names := slices.Clone(n.rl.names)
+	fns := make([]func(ctx context.Context) error, len(names))
+	for i, name := range names {
+		fns[i] = n.rl.fns[name]
+	}
+	n.rl.m.Unlock()
+
+	errs := make(map[string]error)
+	for i, name := range names {
+		log.Printf("Reloading %s", name)
+
+		errs[name] = fns[i](ctx)
+		if errs[name] != nil {
+			log.Printf("Failed to reload %s: %v", name, errs[name])
+		}
+	}
+
+	return errs
+}
+
+type reloadResult struct {
+	Plugin string `json:"plugin"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (n *Hosting) handleReload(w http.ResponseWriter, r *http.Request) {
+	errs := n.Reload(r.Context())
+
+	status := http.StatusOK
+	results := make([]reloadResult, 0, len(errs))
+	for name, err := range errs {
+		res := reloadResult{Plugin: name}
+		if err != nil {
+			res.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+
+		results = append(results, res)
+	}
+
+	slices.SortFunc(results, func(a, b reloadResult) int {
+		return strings.Compare(a.Plugin, b.Plugin)
+	})
+
+	api.WriteJSON(w, status, results)
+}
@@ -0,0 +1,95 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/reporting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// errorReportingOptions are the options of both sinks, ERROR_REPORTING_OPTIONS
+// holds them next to those of reporting.Options.
+type errorReportingOptions struct {
+	reporting.Options
+	reporting.SentryOptions
+	reporting.HTTPOptions
+}
+
+// initReporter returns nil without ERROR_REPORTING, errors are then only
+// logged.
+func initReporter(proxy string) (*reporting.Reporter, error) {
+	backend := util.EnvWithDefault("ERROR_REPORTING", "")
+	backendOptions := util.EnvWithDefault("ERROR_REPORTING_OPTIONS", "{}")
+
+	opts := errorReportingOptions{Options: reporting.Options{SampleRate: 1, PerMinute: 60}}
+	if err := json.Unmarshal([]byte(backendOptions), &opts); err != nil {
+		return nil, err
+	}
+
+	var sink reporting.Sink
+	var err error
+
+	switch backend {
+	case "":
+		return nil, nil
+
+	case "sentry":
+		log.Println("Reporting errors to Sentry")
+
+		if opts.DSN == "" {
+			opts.DSN = os.Getenv("SENTRY_DSN")
+		}
+
+		sink, err = reporting.NewSentry(opts.SentryOptions)
+
+	case "http":
+		log.Println("Reporting errors over HTTP")
+
+		sink, err = reporting.NewHTTP(opts.HTTPOptions)
+
+	default:
+		return nil, fmt.Errorf("unknown error reporting backend: %s", backend)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reporting.New(sink, proxy, opts.Options), nil
+}
+
+// ReportError reports an error of the plugin that needs attention, if error
+// reporting is set up. The correlation ID of ctx is added to c.
+func (n *Hosting) ReportError(ctx context.Context, plugin string, err error, c reporting.Context) {
+	if c.CorrelationID == "" {
+		c.CorrelationID = correlation.ID(ctx)
+	}
+
+	n.rep.Error(plugin, err, c)
+}
+
+// PlayerReport is the context of an error that happened to the player.
+func (n *Hosting) PlayerReport(player proxy.Player) reporting.Context {
+	c := reporting.Context{
+		CorrelationID: n.ConnectionID(player.RemoteAddr()),
+		Player:        player.ID().String(),
+		PlayerName:    player.Username(),
+	}
+
+	if host, _, err := net.SplitHostPort(player.RemoteAddr().String()); err == nil {
+		c.IP = host
+	}
+
+	if s := player.CurrentServer(); s != nil {
+		c.Server = s.Server().ServerInfo().Name()
+	}
+
+	return c
+}
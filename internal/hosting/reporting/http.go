@@ -0,0 +1,58 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type HTTPOptions struct {
+	URL string `json:"url"`
+	// Headers are sent with every event, e.g. Authorization
+	Headers map[string]string `json:"headers"`
+}
+
+// HTTP posts every event as JSON to a URL.
+type HTTP struct {
+	opts   HTTPOptions
+	client *http.Client
+}
+
+func NewHTTP(opts HTTPOptions) (*HTTP, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("error reporting sink needs a url")
+	}
+
+	return &HTTP{opts: opts, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (h *HTTP) Send(ctx context.Context, e Event) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.opts.URL, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("error reporting sink responded with %s", res.Status)
+	}
+
+	return nil
+}
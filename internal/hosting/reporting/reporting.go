@@ -0,0 +1,273 @@
+// Package reporting sends panics and significant plugin errors to Sentry or
+// an HTTP endpoint. Reports are sampled, rate limited and scrubbed of the
+// player and server context the operator doesn't want to leave the network.
+package reporting
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	mrand "math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var reportsTotal = metrics.NewCounterVec("gate_error_reports_total", "Error reports by what happened to them.", "result")
+
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelPanic Level = "panic"
+)
+
+// Context is what the error happened to, every field is optional.
+type Context struct {
+	CorrelationID string `json:"correlationId,omitempty"`
+	Player        string `json:"player,omitempty"`
+	PlayerName    string `json:"playerName,omitempty"`
+	Server        string `json:"server,omitempty"`
+	IP            string `json:"ip,omitempty"`
+}
+
+type Event struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Level       Level     `json:"level"`
+	Plugin      string    `json:"plugin"`
+	Message     string    `json:"message"`
+	Stack       string    `json:"stack,omitempty"`
+	Proxy       string    `json:"proxy,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Release     string    `json:"release,omitempty"`
+	Context
+}
+
+// Sink delivers events, e.g. to Sentry.
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+const (
+	ScrubIP     = "ip"
+	ScrubPlayer = "player"
+	ScrubServer = "server"
+)
+
+type Options struct {
+	// SampleRate is the share of errors that are reported, from 0 to 1.
+	// Panics are always reported.
+	SampleRate float64 `json:"sampleRate"`
+	// PerMinute limits the reports per minute, further ones are dropped
+	PerMinute int `json:"perMinute"`
+	// Scrub lists the context to remove before sending, ip, player and
+	// server. Players are replaced by a hash of their UUID, reports of one
+	// player can still be told apart. Defaults to ip and player.
+	Scrub       []string `json:"scrub"`
+	Environment string   `json:"environment"`
+	Release     string   `json:"release"`
+}
+
+// Reporter sends events to a sink in the background. A nil Reporter drops
+// everything, so callers don't need to check whether reporting is set up.
+type Reporter struct {
+	sink  Sink
+	opts  Options
+	proxy string
+
+	queue chan Event
+	done  chan struct{}
+
+	tokens float64
+	last   time.Time
+	closed bool
+	m      sync.Mutex
+}
+
+func New(sink Sink, proxy string, opts Options) *Reporter {
+	if opts.Scrub == nil {
+		opts.Scrub = []string{ScrubIP, ScrubPlayer}
+	}
+
+	r := &Reporter{
+		sink:   sink,
+		opts:   opts,
+		proxy:  proxy,
+		queue:  make(chan Event, 64),
+		done:   make(chan struct{}),
+		tokens: float64(opts.PerMinute),
+		last:   time.Now(),
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+
+	for e := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := r.sink.Send(ctx, e); err != nil {
+			reportsTotal.Inc("failed")
+			log.Printf("Failed to send error report %s: %v", e.ID, err)
+		} else {
+			reportsTotal.Inc("sent")
+		}
+		cancel()
+	}
+}
+
+// Close sends the queued events and stops the reporter, giving up when ctx
+// is done.
+func (r *Reporter) Close(ctx context.Context) {
+	if r == nil {
+		return
+	}
+
+	r.m.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.m.Unlock()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+	}
+}
+
+// Panic reports a recovered panic of the plugin.
+func (r *Reporter) Panic(plugin string, v any, stack []byte, c Context) {
+	if r == nil {
+		return
+	}
+
+	r.report(Event{Level: LevelPanic, Plugin: plugin, Message: fmt.Sprint(v), Stack: string(stack), Context: c})
+}
+
+// Error reports an error of the plugin that needs attention, not one that
+// is part of normal operation like a player typing a wrong command.
+func (r *Reporter) Error(plugin string, err error, c Context) {
+	if r == nil {
+		return
+	}
+
+	if r.opts.SampleRate < 1 && mrand.Float64() >= r.opts.SampleRate {
+		reportsTotal.Inc("sampled")
+		return
+	}
+
+	r.report(Event{Level: LevelError, Plugin: plugin, Message: err.Error(), Context: c})
+}
+
+func (r *Reporter) report(e Event) {
+	e.ID = newID()
+	e.Time = time.Now()
+	e.Proxy = r.proxy
+	e.Environment = r.opts.Environment
+	e.Release = r.opts.Release
+	r.scrub(&e)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	if !r.allow(e.Time) {
+		reportsTotal.Inc("limited")
+		return
+	}
+
+	select {
+	case r.queue <- e:
+	default:
+		reportsTotal.Inc("dropped")
+	}
+}
+
+// allow takes a token of the bucket, which refills PerMinute tokens every
+// minute. PerMinute 0 means no limit. It must be called with the lock held.
+func (r *Reporter) allow(now time.Time) bool {
+	if r.opts.PerMinute <= 0 {
+		return true
+	}
+
+	limit := float64(r.opts.PerMinute)
+	r.tokens = min(limit, r.tokens+now.Sub(r.last).Minutes()*limit)
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+
+	r.tokens--
+	return true
+}
+
+var (
+	ipPattern   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b|\[[0-9a-fA-F:]+\](?::\d+)?`)
+	uuidPattern = regexp.MustCompile(`\b[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}\b`)
+)
+
+func (r *Reporter) scrub(e *Event) {
+	text := []*string{&e.Message, &e.Stack}
+
+	if slices.Contains(r.opts.Scrub, ScrubIP) {
+		e.IP = ""
+		for _, t := range text {
+			*t = ipPattern.ReplaceAllString(*t, "[ip]")
+		}
+	}
+
+	if slices.Contains(r.opts.Scrub, ScrubPlayer) {
+		hashed := ""
+		if e.Player != "" {
+			hashed = hashPlayer(e.Player)
+		}
+
+		for _, t := range text {
+			if e.PlayerName != "" {
+				*t = strings.ReplaceAll(*t, e.PlayerName, "[player]")
+			}
+			*t = uuidPattern.ReplaceAllString(*t, "[uuid]")
+		}
+
+		e.Player, e.PlayerName = hashed, ""
+	}
+
+	if slices.Contains(r.opts.Scrub, ScrubServer) {
+		if e.Server != "" {
+			for _, t := range text {
+				*t = strings.ReplaceAll(*t, e.Server, "[server]")
+			}
+		}
+		e.Server = ""
+	}
+}
+
+func hashPlayer(player string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.ReplaceAll(player, "-", ""))))
+	return hex.EncodeToString(sum[:6])
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,96 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	events []Event
+	m      sync.Mutex
+}
+
+func (r *recorder) Send(ctx context.Context, e Event) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestScrub(t *testing.T) {
+	sink := &recorder{}
+	r := New(sink, "proxy-0", Options{SampleRate: 1})
+
+	r.Error("Core", errors.New("Notch (069a79f4-44e9-4726-a5be-fca90e38aaf5) from 10.0.0.7:53412 failed to join lobby-1"), Context{
+		Player:     "069a79f444e94726a5befca90e38aaf5",
+		PlayerName: "Notch",
+		Server:     "lobby-1",
+		IP:         "10.0.0.7",
+	})
+	r.Close(context.Background())
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(sink.events))
+	}
+
+	e := sink.events[0]
+	if e.IP != "" || e.PlayerName != "" || e.Player == "" || strings.Contains(e.Player, "069a") {
+		t.Fatalf("expected the player hashed and the IP removed, got %+v", e.Context)
+	}
+
+	if e.Message != "[player] ([uuid]) from [ip] failed to join lobby-1" {
+		t.Fatalf("unexpected message %q", e.Message)
+	}
+
+	if e.Server != "lobby-1" || e.Proxy != "proxy-0" || e.Level != LevelError {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestSampleAndLimit(t *testing.T) {
+	sink := &recorder{}
+	r := New(sink, "proxy-0", Options{SampleRate: 0, PerMinute: 2})
+
+	r.Error("Core", errors.New("sampled out"), Context{})
+	for range 3 {
+		r.Panic("Core", "boom", []byte("stack"), Context{})
+	}
+	r.Close(context.Background())
+
+	if len(sink.events) != 2 {
+		t.Fatalf("expected 2 panics within the limit, got %d", len(sink.events))
+	}
+
+	if sink.events[0].Level != LevelPanic || sink.events[0].Stack != "stack" {
+		t.Fatalf("unexpected event %+v", sink.events[0])
+	}
+
+	// The bucket refills over the minute
+	if !r.allow(time.Now().Add(time.Minute)) {
+		t.Fatal("expected a token after a minute")
+	}
+}
+
+func TestNilReporter(t *testing.T) {
+	var r *Reporter
+	r.Error("Core", errors.New("ignored"), Context{})
+	r.Panic("Core", "ignored", nil, Context{})
+	r.Close(context.Background())
+}
+
+func TestClosed(t *testing.T) {
+	sink := &recorder{}
+	r := New(sink, "proxy-0", Options{SampleRate: 1})
+	r.Close(context.Background())
+	r.Close(context.Background())
+
+	r.Panic("Core", "after shutdown", nil, Context{})
+	if len(sink.events) != 0 {
+		t.Fatalf("expected no events after Close, got %d", len(sink.events))
+	}
+}
@@ -0,0 +1,125 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SentryOptions struct {
+	// DSN of the project, https://<key>@<host>/<project>
+	DSN string `json:"dsn"`
+}
+
+// Sentry sends events to the store endpoint of Sentry, which self-hosted
+// Sentry and compatible services like GlitchTip implement as well.
+type Sentry struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+func NewSentry(opts SentryOptions) (*Sentry, error) {
+	dsn, err := url.Parse(opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sentry DSN: %w", err)
+	}
+
+	project := strings.Trim(dsn.Path, "/")
+	if dsn.User == nil || dsn.User.Username() == "" || project == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN, expected https://<key>@<host>/<project>")
+	}
+
+	// Projects of a DSN with a path prefix live below it
+	prefix := ""
+	if i := strings.LastIndexByte(project, '/'); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+
+	return &Sentry{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", dsn.Scheme, dsn.Host, prefix, project),
+		auth:     "Sentry sentry_version=7, sentry_client=csmc-proxy/1.0, sentry_key=" + dsn.User.Username(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	Message     string            `json:"message"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	User        *sentryUser       `json:"user,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+type sentryUser struct {
+	ID        string `json:"id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+func (s *Sentry) Send(ctx context.Context, e Event) error {
+	ev := sentryEvent{
+		EventID:     e.ID,
+		Timestamp:   e.Time.UTC().Format(time.RFC3339),
+		Level:       "error",
+		Logger:      e.Plugin,
+		Platform:    "go",
+		Message:     e.Message,
+		ServerName:  e.Proxy,
+		Environment: e.Environment,
+		Release:     e.Release,
+		Tags:        map[string]string{"plugin": e.Plugin},
+	}
+	if e.Level == LevelPanic {
+		ev.Level = "fatal"
+	}
+
+	if e.Server != "" {
+		ev.Tags["server"] = e.Server
+	}
+	if e.CorrelationID != "" {
+		ev.Tags["correlation_id"] = e.CorrelationID
+	}
+	if e.Player != "" || e.PlayerName != "" || e.IP != "" {
+		ev.User = &sentryUser{ID: e.Player, Username: e.PlayerName, IPAddress: e.IP}
+	}
+	if e.Stack != "" {
+		ev.Extra = map[string]string{"stack": e.Stack}
+	}
+
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("sentry responded with %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSentry(t *testing.T) {
+	var got sentryEvent
+	var auth, path string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("X-Sentry-Auth"), r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	s, err := NewSentry(SentryOptions{DSN: strings.Replace(srv.URL, "http://", "http://key@", 1) + "/sentry/42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Send(context.Background(), Event{
+		ID:      "abc",
+		Time:    time.Now(),
+		Level:   LevelPanic,
+		Plugin:  "Core",
+		Message: "boom",
+		Stack:   "goroutine 1",
+		Context: Context{Player: "hash", CorrelationID: "3f2a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/sentry/api/42/store/" || !strings.Contains(auth, "sentry_key=key") {
+		t.Fatalf("unexpected request to %s with %q", path, auth)
+	}
+
+	if got.Level != "fatal" || got.Tags["correlation_id"] != "3f2a" || got.User == nil || got.User.ID != "hash" || got.Extra["stack"] != "goroutine 1" {
+		t.Fatalf("unexpected event %+v", got)
+	}
+
+	if _, err := NewSentry(SentryOptions{DSN: "https://sentry.io/42"}); err == nil {
+		t.Fatal("expected a DSN without a key to fail")
+	}
+}
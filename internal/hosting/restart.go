@@ -0,0 +1,325 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"go.minekube.com/common/minecraft/component"
+)
+
+var (
+	ErrNoLeader       = errors.New("no live proxy to lead the restart")
+	ErrRolloutRunning = errors.New("a rolling restart is already running")
+)
+
+const (
+	RolloutRunning = "running"
+	RolloutDone    = "done"
+	RolloutFailed  = "failed"
+)
+
+// Rollout is the progress of a rolling restart, kept by the leader running
+// it.
+type Rollout struct {
+	By      string    `json:"by"`
+	Started time.Time `json:"started"`
+	// Order is the proxies in the order they restart, the leader is last
+	Order []string `json:"order"`
+	// Done are the proxies that were replaced by a ready one
+	Done     []string  `json:"done"`
+	Current  string    `json:"current,omitempty"`
+	State    string    `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Finished time.Time `json:"finished"`
+}
+
+type rollouts struct {
+	current *Rollout
+	m       sync.Mutex
+}
+
+const (
+	clusterRollout = "rollout"
+	clusterRestart = "restart"
+)
+
+// clusterMessage is sent on the cluster subject of a proxy, asking the
+// leader to run a rollout or a proxy to drain and restart.
+type clusterMessage struct {
+	Action string `json:"action"`
+	By     string `json:"by"`
+}
+
+// Draining reports whether this proxy is draining for a restart. It fails
+// its readiness check meanwhile, so no new players are routed to it.
+func (n *Hosting) Draining() bool {
+	return n.draining.Load()
+}
+
+// RestartCluster asks the leader to restart every proxy, one at a time, and
+// returns the name of the leader.
+func (n *Hosting) RestartCluster(ctx context.Context, actor string) (string, error) {
+	instances, err := n.cls.Instances(ctx, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	leader := cluster.Leader(instances)
+	if leader == "" {
+		return "", ErrNoLeader
+	}
+
+	if leader == n.Info.PodName {
+		return leader, n.startRollout(ctx, actor, instances)
+	}
+
+	return leader, n.sendCluster(ctx, leader, clusterMessage{Action: clusterRollout, By: actor})
+}
+
+// Rollout returns the rolling restart this proxy ran last, if it led one.
+func (n *Hosting) Rollout() (Rollout, bool) {
+	n.ro.m.Lock()
+	defer n.ro.m.Unlock()
+
+	if n.ro.current == nil {
+		return Rollout{}, false
+	}
+
+	r := *n.ro.current
+	r.Order, r.Done = slices.Clone(r.Order), slices.Clone(r.Done)
+
+	return r, true
+}
+
+func (n *Hosting) sendCluster(ctx context.Context, pod string, m clusterMessage) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return n.msg.Publish(ctx, n.Info.ClusterSubject(pod), raw)
+}
+
+func (n *Hosting) onClusterMessage(msg messaging.Message) {
+	defer n.Recover("Hosting")
+
+	m := clusterMessage{}
+	if err := json.Unmarshal(msg.Data, &m); err != nil {
+		log.Printf("Failed to unmarshal cluster message: %v", err)
+		return
+	}
+
+	switch m.Action {
+	case clusterRollout:
+		ctx, cancel := context.WithTimeout(n.Context(), 5*time.Second)
+		defer cancel()
+
+		// The sender picked this proxy as the leader, it runs the rollout
+		// even if it sees another one by now so the request can't bounce
+		instances, err := n.cls.Instances(ctx, time.Now())
+		if err == nil {
+			err = n.startRollout(ctx, m.By, instances)
+		}
+
+		if err != nil {
+			log.Printf("Failed to start the rolling restart requested by %s: %v", m.By, err)
+		}
+	case clusterRestart:
+		go n.drain(m.By)
+	default:
+		log.Printf("Ignoring unknown cluster action %q", m.Action)
+	}
+}
+
+func (n *Hosting) startRollout(ctx context.Context, actor string, instances []cluster.Instance) error {
+	order := make([]string, 0, len(instances))
+	// ready is the capacity every replacement has to restore, proxies that
+	// weren't ready to begin with don't count
+	ready := 0
+	for _, i := range instances {
+		if i.Live && i.Name != n.Info.PodName {
+			order = append(order, i.Name)
+		}
+
+		if i.Live && i.Ready {
+			ready++
+		}
+	}
+	order = append(order, n.Info.PodName)
+
+	n.ro.m.Lock()
+	if n.ro.current != nil && n.ro.current.State == RolloutRunning {
+		n.ro.m.Unlock()
+		return ErrRolloutRunning
+	}
+	n.ro.current = &Rollout{By: actor, Started: time.Now(), Order: order, Done: make([]string, 0), State: RolloutRunning}
+	n.ro.m.Unlock()
+
+	log.Printf("%s started a rolling restart of %v", actor, order)
+
+	if err := n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "cluster.restart", Target: n.Info.Network}); err != nil {
+		log.Printf("Failed to audit the rolling restart: %v", err)
+	}
+
+	go n.runRollout(n.Context(), actor, order, ready)
+
+	return nil
+}
+
+func (n *Hosting) updateRollout(fn func(r *Rollout)) {
+	n.ro.m.Lock()
+	defer n.ro.m.Unlock()
+
+	fn(n.ro.current)
+}
+
+// runRollout restarts the proxies in order and waits for each to be
+// replaced before the next, so capacity drops by one proxy at most. A
+// replacement that doesn't become ready within the restart timeout stops
+// the rollout, the rest keeps running the old version.
+func (n *Hosting) runRollout(ctx context.Context, by string, order []string, size int) {
+	defer n.Recover("Hosting")
+
+	for _, name := range order {
+		n.updateRollout(func(r *Rollout) { r.Current = name })
+
+		if name == n.Info.PodName {
+			// The replacement of the leader can't be waited for, the
+			// rollout is done once the others are
+			n.updateRollout(func(r *Rollout) {
+				r.State, r.Current, r.Finished = RolloutDone, "", time.Now()
+				r.Done = append(r.Done, name)
+			})
+
+			log.Printf("Rolling restart done, restarting %s", name)
+			n.drain(by)
+			return
+		}
+
+		if err := n.restartInstance(ctx, by, name, size); err != nil {
+			log.Printf("Rolling restart stopped at %s: %v", name, err)
+			n.updateRollout(func(r *Rollout) {
+				r.State, r.Error, r.Finished = RolloutFailed, err.Error(), time.Now()
+			})
+			return
+		}
+
+		log.Printf("Rolling restart replaced %s", name)
+		n.updateRollout(func(r *Rollout) { r.Done = append(r.Done, name) })
+	}
+}
+
+// restartInstance asks the proxy to restart and waits until it is gone and
+// size proxies are ready again.
+func (n *Hosting) restartInstance(ctx context.Context, by, name string, size int) error {
+	instances, err := n.cls.Instances(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(instances, func(i cluster.Instance) bool { return i.Name == name })
+	if i < 0 {
+		return fmt.Errorf("proxy %s left the cluster", name)
+	}
+	started := instances[i].Started
+
+	if err := n.sendCluster(ctx, name, clusterMessage{Action: clusterRestart, By: by}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.restartTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("proxy %s wasn't replaced within %s", name, n.restartTimeout)
+		case now := <-ticker.C:
+			instances, err := n.cls.Instances(ctx, now)
+			if err != nil {
+				log.Printf("Failed to check on the restart of %s: %v", name, err)
+				continue
+			}
+
+			ready, old := 0, false
+			for _, i := range instances {
+				if i.Name == name && i.Started.Equal(started) && i.Live {
+					old = true
+				}
+
+				if i.Live && i.Ready {
+					ready++
+				}
+			}
+
+			if !old && ready >= size {
+				return nil
+			}
+		}
+	}
+}
+
+// drain stops routing players to this proxy, waits for them to leave for up
+// to the drain timeout and shuts down, disconnecting the rest. The
+// orchestrator starts the replacement.
+func (n *Hosting) drain(by string) {
+	if !n.draining.CompareAndSwap(false, true) {
+		return
+	}
+
+	log.Printf("Draining for a restart requested by %s", by)
+
+	prx := n.prx.Load()
+	if prx == nil {
+		return
+	}
+
+	for _, player := range prx.Players() {
+		_ = player.SendMessage(&component.Text{Content: "This proxy is restarting, you will be asked to reconnect shortly."})
+	}
+
+	deadline := time.Now().Add(n.drainTimeout)
+	for prx.PlayerCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+	}
+
+	prx.Shutdown(&component.Text{Content: "This proxy is restarting, please reconnect."})
+}
+
+func (n *Hosting) handleRestartCluster(w http.ResponseWriter, r *http.Request) {
+	leader, err := n.RestartCluster(r.Context(), "api")
+	switch {
+	case errors.Is(err, ErrNoLeader):
+		api.WriteError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, ErrRolloutRunning):
+		api.WriteError(w, http.StatusConflict, err)
+	case err != nil:
+		api.WriteError(w, http.StatusInternalServerError, err)
+	default:
+		api.WriteJSON(w, http.StatusAccepted, map[string]string{"leader": leader})
+	}
+}
+
+func (n *Hosting) handleGetRollout(w http.ResponseWriter, r *http.Request) {
+	rollout, ok := n.Rollout()
+	if !ok {
+		api.WriteError(w, http.StatusNotFound, errors.New("this proxy didn't lead a rolling restart"))
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, rollout)
+}
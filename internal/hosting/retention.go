@@ -0,0 +1,162 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/retention"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+type retainedLog struct {
+	name   string
+	kv     kv.Bucket
+	policy retention.Policy
+}
+
+// retentions are the logs pruned by the leader and the result of their last
+// run on this proxy.
+type retentions struct {
+	logs []retainedLog
+	last map[string]retention.Result
+	m    sync.Mutex
+}
+
+type retentionStatus struct {
+	Log    string            `json:"log"`
+	Policy retention.Policy  `json:"policy"`
+	Last   *retention.Result `json:"last,omitempty"`
+}
+
+// RetentionPolicy reads the policy of a log from <prefix>_RETENTION_MAX_AGE,
+// <prefix>_RETENTION_MAX_BYTES and <prefix>_RETENTION_ARCHIVE. Logs are kept
+// forever by default.
+func RetentionPolicy(prefix string) retention.Policy {
+	return retention.Policy{
+		MaxAge:   util.EnvDurationWithDefault(prefix+"_RETENTION_MAX_AGE", 0),
+		MaxBytes: int64(util.EnvIntWithDefault(prefix+"_RETENTION_MAX_BYTES", 0)),
+		Archive:  util.EnvBoolWithDefault(prefix+"_RETENTION_ARCHIVE", true),
+	}
+}
+
+// RetainLog has the leader prune the log stored in b by the policy. The keys
+// of the log have to start with the zero padded UnixNano of their entry.
+func (n *Hosting) RetainLog(name string, b kv.Bucket, p retention.Policy) {
+	n.ret.m.Lock()
+	defer n.ret.m.Unlock()
+
+	n.ret.logs = append(n.ret.logs, retainedLog{name: name, kv: b, policy: p})
+}
+
+// PruneLogs applies the retention policies now, regardless of which proxy
+// leads.
+func (n *Hosting) PruneLogs(ctx context.Context, actor string) ([]retention.Result, error) {
+	n.ret.m.Lock()
+	logs := append([]retainedLog(nil), n.ret.logs...)
+	n.ret.m.Unlock()
+
+	results := make([]retention.Result, 0, len(logs))
+	var errs []error
+	for _, l := range logs {
+		res, err := retention.Prune(ctx, l.name, l.kv, n.obj, l.policy, time.Now())
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		n.ret.m.Lock()
+		if n.ret.last == nil {
+			n.ret.last = make(map[string]retention.Result)
+		}
+		n.ret.last[l.name] = res
+		n.ret.m.Unlock()
+
+		results = append(results, res)
+
+		if res.Pruned == 0 {
+			continue
+		}
+
+		log.Printf("Pruned %d entries (%d bytes) of the %s log, archived to %s", res.Pruned, res.Bytes, l.name, strings.Join(res.Archive, ", "))
+
+		if err := n.adt.Record(ctx, audit.Entry{
+			Actor:  actor,
+			Action: "retention.prune",
+			Target: l.name,
+			Details: map[string]string{
+				"pruned":   strconv.Itoa(res.Pruned),
+				"bytes":    strconv.FormatInt(res.Bytes, 10),
+				"archives": strings.Join(res.Archive, ","),
+			},
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// pruneLogs applies the retention policies every interval while this proxy
+// leads the cluster.
+func (n *Hosting) pruneLogs(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		instances, err := n.cls.Instances(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to list the cluster for log retention: %v", err)
+			continue
+		}
+
+		if cluster.Leader(instances) != n.Info.PodName {
+			continue
+		}
+
+		if _, err := n.PruneLogs(ctx, "retention"); err != nil {
+			log.Printf("Failed to prune logs: %v", err)
+		}
+	}
+}
+
+func (n *Hosting) handleGetRetention(w http.ResponseWriter, r *http.Request) {
+	n.ret.m.Lock()
+	defer n.ret.m.Unlock()
+
+	statuses := make([]retentionStatus, 0, len(n.ret.logs))
+	for _, l := range n.ret.logs {
+		s := retentionStatus{Log: l.name, Policy: l.policy}
+		if res, ok := n.ret.last[l.name]; ok {
+			s.Last = &res
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	api.WriteJSON(w, http.StatusOK, statuses)
+}
+
+func (n *Hosting) handlePruneLogs(w http.ResponseWriter, r *http.Request) {
+	results, err := n.PruneLogs(r.Context(), "api")
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,196 @@
+// Package retention prunes logs whose KV keys start with the zero padded
+// nanosecond time of their entry, like the audit and chat logs. Entries older
+// than the policy allows, or the oldest ones once the log outgrows its size,
+// are archived to the object store as gzipped JSONL, one object per UTC day,
+// and only deleted once their archive is stored.
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+)
+
+const (
+	// ArchivePrefix is where archives are stored, as
+	// <prefix><log>/<day>-<first key>.jsonl.gz
+	ArchivePrefix = "archives/"
+	timeKeyLength = 20
+)
+
+var (
+	prunedTotal   = metrics.NewCounterVec("gate_retention_pruned_total", "Log entries deleted by the retention policy.", "log")
+	archivedTotal = metrics.NewCounterVec("gate_retention_archives_total", "Archives of pruned log entries by result.", "log", "result")
+)
+
+type Policy struct {
+	// MaxAge is how long entries are kept, 0 keeps them regardless of age
+	MaxAge time.Duration `json:"maxAge"`
+	// MaxBytes caps the size of the values of the log, the oldest entries
+	// are pruned first. 0 doesn't limit it.
+	MaxBytes int64 `json:"maxBytes"`
+	// Archive exports the entries to the object store before they are
+	// deleted
+	Archive bool `json:"archive"`
+}
+
+func (p Policy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxBytes > 0
+}
+
+type Result struct {
+	Log     string    `json:"log"`
+	Time    time.Time `json:"time"`
+	Kept    int       `json:"kept"`
+	Pruned  int       `json:"pruned"`
+	Bytes   int64     `json:"bytes"`
+	Archive []string  `json:"archives,omitempty"`
+}
+
+type entry struct {
+	key   string
+	time  time.Time
+	value []byte
+}
+
+// Prune applies the policy to the log stored in b. Days whose archive fails
+// to upload are kept, so the next run retries them.
+func Prune(ctx context.Context, name string, b kv.Bucket, store object.Store, p Policy, now time.Time) (Result, error) {
+	res := Result{Log: name, Time: now}
+	if !p.Enabled() {
+		return res, nil
+	}
+
+	keys, err := b.ListKeys(ctx)
+	if err != nil {
+		return res, err
+	}
+	slices.Sort(keys)
+
+	entries := make([]entry, 0, len(keys))
+	size := int64(0)
+	for _, key := range keys {
+		t, ok := keyTime(key)
+		if !ok {
+			continue
+		}
+
+		v, err := b.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return res, err
+		}
+
+		entries = append(entries, entry{key: key, time: t, value: v})
+		size += int64(len(v))
+	}
+
+	// Entries are sorted oldest first, so the pruned ones are a prefix
+	cut := 0
+	for cut < len(entries) {
+		e := entries[cut]
+		tooOld := p.MaxAge > 0 && now.Sub(e.time) > p.MaxAge
+		tooBig := p.MaxBytes > 0 && size > p.MaxBytes
+		if !tooOld && !tooBig {
+			break
+		}
+
+		size -= int64(len(e.value))
+		cut++
+	}
+
+	res.Kept = len(entries) - cut
+
+	for _, day := range days(entries[:cut]) {
+		if p.Archive {
+			stored, err := archive(ctx, store, name, day)
+			if err != nil {
+				archivedTotal.Inc(name, "failed")
+				res.Kept = len(entries) - res.Pruned
+				return res, fmt.Errorf("failed to archive %s: %w", name, err)
+			}
+
+			archivedTotal.Inc(name, "stored")
+			res.Archive = append(res.Archive, stored)
+		}
+
+		for _, e := range day {
+			if err := b.Delete(ctx, e.key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+				return res, err
+			}
+
+			res.Pruned++
+			res.Bytes += int64(len(e.value))
+			prunedTotal.Inc(name)
+		}
+	}
+
+	return res, nil
+}
+
+// days groups entries by their UTC day, keeping their order.
+func days(entries []entry) [][]entry {
+	var grouped [][]entry
+	for i, e := range entries {
+		if i == 0 || e.time.UTC().Format(time.DateOnly) != entries[i-1].time.UTC().Format(time.DateOnly) {
+			grouped = append(grouped, nil)
+		}
+
+		grouped[len(grouped)-1] = append(grouped[len(grouped)-1], e)
+	}
+
+	return grouped
+}
+
+// archive stores the entries of one day as a gzipped JSONL object and returns
+// its name.
+func archive(ctx context.Context, store object.Store, log string, day []entry) (string, error) {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+
+	for _, e := range day {
+		if _, err := gz.Write(bytes.TrimSpace(e.value)); err != nil {
+			return "", err
+		}
+
+		if _, err := gz.Write([]byte{'\n'}); err != nil {
+			return "", err
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s%s/%s-%s.jsonl.gz", ArchivePrefix, log, day[0].time.UTC().Format(time.DateOnly), day[0].key)
+	if err := store.Put(ctx, name, &buf); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// keyTime parses the time a key starts with. Keys may carry a suffix after
+// it, e.g. the proxy that wrote them.
+func keyTime(key string) (time.Time, bool) {
+	if len(key) < timeKeyLength {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(key[:timeKeyLength], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos), true
+}
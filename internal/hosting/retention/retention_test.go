@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+var now = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func newLog(t *testing.T, ages ...time.Duration) kv.Bucket {
+	t.Helper()
+
+	client, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := client.Bucket(context.Background(), "network_audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, age := range ages {
+		key := fmt.Sprintf("%020d", now.Add(-age).UnixNano())
+		if err := b.Set(context.Background(), key, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Not a time key, left alone
+	if err := b.Set(context.Background(), "schema", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func lines(t *testing.T, store object.Store, name string) []string {
+	t.Helper()
+
+	r, err := store.Get(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	s := bufio.NewScanner(gz)
+	for s.Scan() {
+		got = append(got, s.Text())
+	}
+
+	return got
+}
+
+func TestPruneAge(t *testing.T) {
+	day := 24 * time.Hour
+	b := newLog(t, 3*day, 3*day-time.Hour, 2*day, time.Hour)
+	store := object.NewMemory()
+
+	res, err := Prune(context.Background(), "audit", b, store, Policy{MaxAge: 36 * time.Hour, Archive: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Pruned != 3 || res.Kept != 1 || len(res.Archive) != 2 {
+		t.Fatalf("expected 3 entries in 2 archives to be pruned, got %+v", res)
+	}
+
+	if got := lines(t, store, res.Archive[0]); !slices.Equal(got, []string{`{"n":0}`, `{"n":1}`}) {
+		t.Fatalf("expected the first day to be archived, got %v", got)
+	}
+
+	if got := lines(t, store, res.Archive[1]); !slices.Equal(got, []string{`{"n":2}`}) {
+		t.Fatalf("expected the second day to be archived, got %v", got)
+	}
+
+	keys, err := b.ListKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("expected the newest entry and the schema key to be kept, got %v", keys)
+	}
+}
+
+func TestPruneSize(t *testing.T) {
+	// Every value is 7 bytes
+	b := newLog(t, 4*time.Hour, 3*time.Hour, 2*time.Hour, time.Hour)
+
+	res, err := Prune(context.Background(), "audit", b, object.NewMemory(), Policy{MaxBytes: 15}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Pruned != 2 || res.Bytes != 14 || res.Archive != nil {
+		t.Fatalf("expected the 2 oldest entries to be pruned without archives, got %+v", res)
+	}
+}
+
+type failingStore struct {
+	object.Store
+}
+
+func (failingStore) Put(ctx context.Context, name string, r io.Reader) error {
+	return errors.New("unavailable")
+}
+
+func TestPruneArchiveFailure(t *testing.T) {
+	b := newLog(t, 48*time.Hour, time.Hour)
+
+	res, err := Prune(context.Background(), "audit", b, failingStore{object.NewMemory()}, Policy{MaxAge: 24 * time.Hour, Archive: true}, now)
+	if err == nil {
+		t.Fatal("expected the archive to fail")
+	}
+
+	if res.Pruned != 0 || res.Kept != 2 {
+		t.Fatalf("expected nothing to be deleted, got %+v", res)
+	}
+}
@@ -28,6 +28,19 @@ type TransferPlayerResponse struct {
 	Status Status `json:"status"`
 }
 
+// GameSlot is published by backends on the matchmaking slots subject whenever
+// a game has room for players. Every announcement replaces the previous one
+// with the same ID, announcing Free 0 withdraws the slot.
+type GameSlot struct {
+	ID       string `json:"id"`
+	Gamemode string `json:"gamemode"`
+	Server   string `json:"server"`
+	Free     int    `json:"free"`
+	// TTL in seconds until the slot expires unless it is announced again,
+	// defaults to 30.
+	TTL int `json:"ttl,omitempty"`
+}
+
 type Status string
 
 const (
@@ -0,0 +1,195 @@
+package hosting
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/netbuf"
+)
+
+var (
+	heapBytes   = metrics.NewGaugeVec("gate_go_heap_alloc_bytes", "Bytes of allocated heap objects.")
+	heapObjects = metrics.NewGaugeVec("gate_go_heap_objects", "Number of allocated heap objects.")
+	allocBytes  = metrics.NewGaugeVec("gate_go_alloc_bytes_total", "Bytes allocated since the proxy started, including freed ones.")
+	gcCycles    = metrics.NewGaugeVec("gate_go_gc_cycles_total", "Completed garbage collection cycles.")
+	gcPause     = metrics.NewGaugeVec("gate_go_gc_pause_nanoseconds_total", "Time the garbage collector stopped the world.")
+	goroutines  = metrics.NewGaugeVec("gate_go_goroutines", "Number of goroutines.")
+
+	processStart = time.Now()
+)
+
+// Buffers pools the write buffers of the connections that plugins wrap,
+// e.g. those of the additional listeners, and batches their writes.
+func (n *Hosting) Buffers() *netbuf.Pool {
+	return n.nb
+}
+
+// sampleRuntime exposes the memory and GC statistics of the process, so
+// allocation work and GOGC or GOMEMLIMIT changes can be measured.
+func (n *Hosting) sampleRuntime(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stats := &runtime.MemStats{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runtime.ReadMemStats(stats)
+
+			heapBytes.Set(int64(stats.HeapAlloc))
+			heapObjects.Set(int64(stats.HeapObjects))
+			allocBytes.Set(int64(stats.TotalAlloc))
+			gcCycles.Set(int64(stats.NumGC))
+			gcPause.Set(int64(stats.PauseTotalNs))
+			goroutines.Set(int64(runtime.NumGoroutine()))
+		}
+	}
+}
+
+// registerPprof serves the profiles of net/http/pprof behind the token, the
+// package's own routes on http.DefaultServeMux aren't served anywhere.
+func registerPprof(apiS *api.Server) {
+	apiS.HandleFunc("GET /debug/pprof/", pprof.Index)
+	apiS.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	apiS.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	apiS.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	apiS.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	apiS.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+}
+
+type RuntimeStats struct {
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	GoVersion     string `json:"goVersion"`
+	Goroutines    int    `json:"goroutines"`
+	// GOGC is -1 if the collector is off, MemoryLimit is 0 without a
+	// GOMEMLIMIT
+	GOGC        int    `json:"gogc"`
+	MemoryLimit uint64 `json:"memoryLimit"`
+
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapIdle     uint64 `json:"heapIdle"`
+	HeapReleased uint64 `json:"heapReleased"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	StackInuse   uint64 `json:"stackInuse"`
+	Sys          uint64 `json:"sys"`
+	TotalAlloc   uint64 `json:"totalAlloc"`
+	NextGC       uint64 `json:"nextGC"`
+
+	NumGC      uint32    `json:"numGC"`
+	LastGC     time.Time `json:"lastGC"`
+	PauseTotal string    `json:"pauseTotal"`
+	// RecentPauses are the last GC pauses, most recent first
+	RecentPauses []string `json:"recentPauses"`
+}
+
+// Runtime returns the memory and GC statistics of the process. Reading them
+// stops the world briefly.
+func (n *Hosting) Runtime() RuntimeStats {
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+
+	gc := debug.GCStats{}
+	debug.ReadGCStats(&gc)
+
+	stats := RuntimeStats{
+		UptimeSeconds: int64(time.Since(processStart).Seconds()),
+		GoVersion:     runtime.Version(),
+		Goroutines:    runtime.NumGoroutine(),
+		GOGC:          100,
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		HeapIdle:      mem.HeapIdle,
+		HeapReleased:  mem.HeapReleased,
+		HeapObjects:   mem.HeapObjects,
+		StackInuse:    mem.StackInuse,
+		Sys:           mem.Sys,
+		TotalAlloc:    mem.TotalAlloc,
+		NextGC:        mem.NextGC,
+		NumGC:         mem.NumGC,
+		LastGC:        gc.LastGC,
+		PauseTotal:    gc.PauseTotal.String(),
+		RecentPauses:  make([]string, 0, 10),
+	}
+
+	if v := os.Getenv("GOGC"); v == "off" {
+		stats.GOGC = -1
+	} else if gogc, err := strconv.Atoi(v); err == nil {
+		stats.GOGC = gogc
+	}
+
+	// A negative limit only reads it
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		stats.MemoryLimit = uint64(limit)
+	}
+
+	for _, p := range gc.Pause[:min(10, len(gc.Pause))] {
+		stats.RecentPauses = append(stats.RecentPauses, p.String())
+	}
+
+	return stats
+}
+
+// DumpProfiles stores a heap profile and the goroutines of the process in
+// the object store under debug/profiles/, and returns the object names. The
+// .pprof files are for go tool pprof, goroutines.txt has every stack.
+func (n *Hosting) DumpProfiles(ctx context.Context) ([]string, error) {
+	prefix := "debug/profiles/" + n.Info.PodName + "-" + strconv.FormatInt(time.Now().Unix(), 10) + "-"
+
+	// The heap profile is as of the last GC, without one it misses the
+	// recent allocations
+	runtime.GC()
+
+	profiles := []struct {
+		profile string
+		debug   int
+		name    string
+	}{
+		{"heap", 0, "heap.pprof"},
+		{"goroutine", 0, "goroutine.pprof"},
+		{"goroutine", 2, "goroutines.txt"},
+	}
+
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		buf := bytes.Buffer{}
+		if err := rpprof.Lookup(p.profile).WriteTo(&buf, p.debug); err != nil {
+			return names, err
+		}
+
+		if err := n.obj.Put(ctx, prefix+p.name, &buf); err != nil {
+			return names, err
+		}
+
+		names = append(names, prefix+p.name)
+	}
+
+	return names, nil
+}
+
+func (n *Hosting) handleGetRuntime(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.Runtime())
+}
+
+func (n *Hosting) handleDumpProfiles(w http.ResponseWriter, r *http.Request) {
+	names, err := n.DumpProfiles(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string][]string{"names": names})
+}
@@ -0,0 +1,233 @@
+// Package secrets keeps versioned secrets of a network in KV, like the
+// Velocity forwarding secret or the keys that sign session tokens. After a
+// rotation the previous secret stays accepted for a window, so whoever still
+// uses it, e.g. a proxy that started before, isn't rejected in the meantime.
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+var ErrNoKeyring = errors.New("no keyring")
+
+type Secret struct {
+	Version int       `json:"version"`
+	Value   string    `json:"value"`
+	Created time.Time `json:"created"`
+}
+
+type Keyring struct {
+	Current Secret `json:"current"`
+	// Previous stays accepted until AcceptUntil, for the proxies that
+	// started before the rotation.
+	Previous    *Secret   `json:"previous,omitempty"`
+	AcceptUntil time.Time `json:"acceptUntil,omitempty"`
+}
+
+// Accepted returns the secrets backends must accept at now.
+func (k Keyring) Accepted(now time.Time) []Secret {
+	if k.Previous != nil && now.Before(k.AcceptUntil) {
+		return []Secret{k.Current, *k.Previous}
+	}
+
+	return []Secret{k.Current}
+}
+
+// Accepts reports whether backends accept the secret version at now.
+func (k Keyring) Accepts(version int, now time.Time) bool {
+	for _, s := range k.Accepted(now) {
+		if s.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Generate returns a random secret of 32 bytes.
+func Generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Keyrings is the keyring stored under key in the bucket. Every rotation is
+// created once under key.v<version>, so of the proxies racing to rotate only
+// one wins and the others read its secret. The key itself follows the latest
+// version for backends and may lag behind it for a moment.
+type Keyrings struct {
+	kv  kv.Bucket
+	key string
+}
+
+func New(bucket kv.Bucket, key string) *Keyrings {
+	return &Keyrings{kv: bucket, key: key}
+}
+
+func (k *Keyrings) versionKey(version int) string {
+	return k.key + ".v" + strconv.Itoa(version)
+}
+
+func (k *Keyrings) get(ctx context.Context, key string) (Keyring, error) {
+	raw, err := k.kv.Get(ctx, key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return Keyring{}, ErrNoKeyring
+	} else if err != nil {
+		return Keyring{}, err
+	}
+
+	keyring := Keyring{}
+	if err := json.Unmarshal(raw, &keyring); err != nil {
+		return Keyring{}, err
+	}
+
+	return keyring, nil
+}
+
+// Keyring returns the latest keyring. A key that lags behind a rotation is
+// moved up to it.
+func (k *Keyrings) Keyring(ctx context.Context) (Keyring, error) {
+	keyring, err := k.get(ctx, k.key)
+	if err != nil {
+		return Keyring{}, err
+	}
+
+	lagging := false
+	for {
+		next, err := k.get(ctx, k.versionKey(keyring.Current.Version+1))
+		if errors.Is(err, ErrNoKeyring) {
+			break
+		} else if err != nil {
+			return Keyring{}, err
+		}
+
+		keyring, lagging = next, true
+	}
+
+	if lagging {
+		if err := k.set(ctx, keyring); err != nil {
+			return Keyring{}, err
+		}
+	}
+
+	return keyring, nil
+}
+
+func (k *Keyrings) set(ctx context.Context, keyring Keyring) error {
+	raw, err := json.Marshal(keyring)
+	if err != nil {
+		return err
+	}
+
+	return k.kv.Set(ctx, k.key, raw)
+}
+
+// Ensure returns the keyring, creating it with the seed as version 1 if
+// there is none. An empty seed generates the secret. Of the proxies that
+// start together before the keyring exists, one creates it and the others
+// read its secret.
+func (k *Keyrings) Ensure(ctx context.Context, seed string, now time.Time) (Keyring, error) {
+	keyring, err := k.Keyring(ctx)
+	if !errors.Is(err, ErrNoKeyring) {
+		return keyring, err
+	}
+
+	if seed == "" {
+		if seed, err = Generate(); err != nil {
+			return Keyring{}, err
+		}
+	}
+
+	keyring = Keyring{Current: Secret{Version: 1, Value: seed, Created: now}}
+	raw, err := json.Marshal(keyring)
+	if err != nil {
+		return Keyring{}, err
+	}
+
+	if err := kv.Create(ctx, k.kv, k.key, raw); errors.Is(err, kv.ErrKeyExists) {
+		return k.Keyring(ctx)
+	} else if err != nil {
+		return Keyring{}, err
+	}
+
+	return keyring, nil
+}
+
+// Rotate generates the next secret. The current one stays accepted for the
+// window, e.g. long enough to restart every proxy. If another proxy rotated
+// to the same version meanwhile, its keyring is returned instead.
+func (k *Keyrings) Rotate(ctx context.Context, window time.Duration, now time.Time) (Keyring, error) {
+	keyring, err := k.Keyring(ctx)
+	if err != nil {
+		return Keyring{}, err
+	}
+
+	keyring, _, err = k.rotate(ctx, keyring, window, now)
+
+	return keyring, err
+}
+
+// rotate creates the version after keyring and reports whether this call
+// did, rather than another proxy.
+func (k *Keyrings) rotate(ctx context.Context, keyring Keyring, window time.Duration, now time.Time) (Keyring, bool, error) {
+	value, err := Generate()
+	if err != nil {
+		return Keyring{}, false, err
+	}
+
+	previous := keyring.Current
+	keyring = Keyring{
+		Current:     Secret{Version: previous.Version + 1, Value: value, Created: now},
+		Previous:    &previous,
+		AcceptUntil: now.Add(window),
+	}
+
+	raw, err := json.Marshal(keyring)
+	if err != nil {
+		return Keyring{}, false, err
+	}
+
+	if err := kv.Create(ctx, k.kv, k.versionKey(keyring.Current.Version), raw); errors.Is(err, kv.ErrKeyExists) {
+		keyring, err := k.get(ctx, k.versionKey(keyring.Current.Version))
+		return keyring, false, err
+	} else if err != nil {
+		return Keyring{}, false, err
+	}
+
+	if err := k.set(ctx, keyring); err != nil {
+		return Keyring{}, false, err
+	}
+
+	// The key is at this version now, readers no longer need the previous one
+	if err := k.kv.Delete(ctx, k.versionKey(previous.Version)); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return Keyring{}, false, err
+	}
+
+	return keyring, true, nil
+}
+
+// RotateIfDue rotates the secret once it is older than interval and reports
+// whether this call rotated it.
+func (k *Keyrings) RotateIfDue(ctx context.Context, interval, window time.Duration, now time.Time) (Keyring, bool, error) {
+	keyring, err := k.Keyring(ctx)
+	if err != nil {
+		return Keyring{}, false, err
+	}
+
+	if now.Sub(keyring.Current.Created) < interval {
+		return keyring, false, nil
+	}
+
+	return k.rotate(ctx, keyring, window, now)
+}
@@ -0,0 +1,193 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newKeyrings(t *testing.T) *Keyrings {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "forwarding")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(bucket, "keyring")
+}
+
+func TestEnsure(t *testing.T) {
+	ctx := context.Background()
+	keyrings := newKeyrings(t)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := keyrings.Keyring(ctx); !errors.Is(err, ErrNoKeyring) {
+		t.Fatalf("expected ErrNoKeyring, got %v", err)
+	}
+
+	keyring, err := keyrings.Ensure(ctx, "static", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Current.Version != 1 || keyring.Current.Value != "static" {
+		t.Fatalf("expected the seed as version 1, got %+v", keyring.Current)
+	}
+
+	// Later proxies get the existing keyring, not their seed
+	keyring, err = keyrings.Ensure(ctx, "other", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Current.Value != "static" {
+		t.Fatalf("expected the existing secret, got %q", keyring.Current.Value)
+	}
+}
+
+func TestEnsureGenerates(t *testing.T) {
+	keyring, err := newKeyrings(t).Ensure(context.Background(), "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keyring.Current.Value) != 43 {
+		t.Fatalf("expected a generated secret of 32 bytes, got %q", keyring.Current.Value)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	keyrings := newKeyrings(t)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := keyrings.Ensure(ctx, "static", now); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := keyrings.Rotate(ctx, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Current.Version != 2 || keyring.Current.Value == "static" {
+		t.Fatalf("expected a new version 2, got %+v", keyring.Current)
+	}
+
+	if !keyring.Accepts(1, now.Add(30*time.Minute)) || !keyring.Accepts(2, now.Add(30*time.Minute)) {
+		t.Fatal("expected both secrets to be accepted during the window")
+	}
+
+	if keyring.Accepts(1, now.Add(time.Hour)) {
+		t.Fatal("expected the previous secret to expire with the window")
+	}
+
+	if got := len(keyring.Accepted(now.Add(2 * time.Hour))); got != 1 {
+		t.Fatalf("expected 1 accepted secret after the window, got %d", got)
+	}
+}
+
+func TestRotateIfDue(t *testing.T) {
+	ctx := context.Background()
+	keyrings := newKeyrings(t)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := keyrings.Ensure(ctx, "static", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, rotated, err := keyrings.RotateIfDue(ctx, 24*time.Hour, time.Hour, now.Add(time.Hour)); err != nil || rotated {
+		t.Fatalf("expected no rotation before the interval, got %v, %v", rotated, err)
+	}
+
+	keyring, rotated, err := keyrings.RotateIfDue(ctx, 24*time.Hour, time.Hour, now.Add(25*time.Hour))
+	if err != nil || !rotated {
+		t.Fatalf("expected a rotation after the interval, got %v, %v", rotated, err)
+	}
+
+	if keyring.Current.Version != 2 || keyring.Previous == nil || keyring.Previous.Version != 1 {
+		t.Fatalf("unexpected keyring %+v", keyring)
+	}
+}
+
+func TestRotateRace(t *testing.T) {
+	ctx := context.Background()
+	keyrings := newKeyrings(t)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	first, err := keyrings.Ensure(ctx, "static", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both proxies read version 1, the second one to rotate loses
+	won, rotated, err := keyrings.rotate(ctx, first, time.Hour, now)
+	if err != nil || !rotated {
+		t.Fatalf("expected the first rotation to win, got %v, %v", rotated, err)
+	}
+
+	lost, rotated, err := keyrings.rotate(ctx, first, time.Hour, now)
+	if err != nil || rotated {
+		t.Fatalf("expected the second rotation to lose, got %v, %v", rotated, err)
+	}
+
+	if lost.Current != won.Current {
+		t.Fatalf("expected the loser to get the winning secret, got %+v and %+v", lost.Current, won.Current)
+	}
+
+	keyring, err := keyrings.Keyring(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Current != won.Current {
+		t.Fatalf("expected the winning secret to be stored, got %+v", keyring.Current)
+	}
+}
+
+func TestKeyringFollowsRotation(t *testing.T) {
+	ctx := context.Background()
+	keyrings := newKeyrings(t)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	first, err := keyrings.Ensure(ctx, "static", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _, err := keyrings.rotate(ctx, first, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A proxy that won a rotation but stored the key late moved it back
+	if err := keyrings.set(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := keyrings.Keyring(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Current != rotated.Current {
+		t.Fatalf("expected version 2, got %+v", keyring.Current)
+	}
+
+	stored, err := keyrings.get(ctx, keyrings.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Current.Version != 2 {
+		t.Fatalf("expected the key to be moved up to version 2, got %d", stored.Current.Version)
+	}
+}
@@ -0,0 +1,94 @@
+package hosting
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/sessions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/transfer"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+func (n *Hosting) initSessions(ctx context.Context, bucket kv.Bucket) (*secrets.Keyrings, error) {
+	keys := secrets.New(bucket, "keyring")
+	if _, err := keys.Ensure(ctx, "", time.Now()); err != nil {
+		return nil, err
+	}
+
+	n.ses = sessions.NewSigner(keys, util.EnvDurationWithDefault("SESSION_TTL", 5*time.Minute))
+
+	return keys, nil
+}
+
+// Sessions signs the session tokens of transfers, nil unless SESSION_TOKENS
+// is set.
+func (n *Hosting) Sessions() *sessions.Signer {
+	return n.ses
+}
+
+// rotateSessions rotates the signing key once it is older than interval.
+// Signers read the keyring for every token, so unlike forwarding secrets the
+// previous key only has to outlive the tokens signed with it.
+func (n *Hosting) rotateSessions(ctx context.Context, keys *secrets.Keyrings, interval time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			keyring, rotated, err := keys.RotateIfDue(ctx, interval, 2*n.ses.TTL(), now)
+			if err != nil {
+				log.Printf("Failed to rotate the session key: %v", err)
+				continue
+			}
+
+			if !rotated {
+				continue
+			}
+
+			log.Printf("Rotated the session key to v%d", keyring.Current.Version)
+
+			if err := n.adt.Record(ctx, audit.Entry{Actor: "scheduler", Action: "sessions.rotate", Target: "v" + strconv.Itoa(keyring.Current.Version)}); err != nil {
+				log.Printf("Failed to record session key rotation: %v", err)
+			}
+		}
+	}
+}
+
+// Transfer hands the player to another proxy like transfer.Send. With
+// session tokens, the player's server and party go along in a signed cookie
+// so the proxy it arrives at can restore them.
+func (m *InstanceManager) Transfer(ctx context.Context, player proxy.Player, host string, port int, cookies map[string][]byte) error {
+	if m.sessions == nil || player.CurrentServer() == nil {
+		return transfer.Send(player, host, port, cookies)
+	}
+
+	party, err := m.StickyKey(ctx, player.ID())
+	if err != nil {
+		return err
+	}
+
+	token, err := m.sessions.Sign(ctx, sessions.Session{
+		Player: player.ID(),
+		Server: player.CurrentServer().Server().ServerInfo().Name(),
+		Party:  party,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	withSession := map[string][]byte{sessions.Cookie: []byte(token)}
+	for k, v := range cookies {
+		withSession[k] = v
+	}
+
+	return transfer.Send(player, host, port, withSession)
+}
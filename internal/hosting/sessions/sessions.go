@@ -0,0 +1,137 @@
+// Package sessions signs the session a player carries in a cookie when it
+// is transferred to another proxy, so the proxy it arrives at can restore
+// the session without asking KV who the player was with. Cookies come from
+// the client, so tokens are signed with the keys of a secrets keyring and
+// expire shortly after the transfer.
+package sessions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Cookie is the key the token is stored under on the client.
+const Cookie = "csmc:session"
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpired      = errors.New("session token expired")
+)
+
+type Session struct {
+	Player uuid.UUID `json:"player"`
+	// Server is the server the player was on before the transfer.
+	Server string `json:"server,omitempty"`
+	// Party is the sticky key of the player, see InstanceManager.StickyKey.
+	Party   string    `json:"party,omitempty"`
+	Issued  time.Time `json:"issued"`
+	Expires time.Time `json:"expires"`
+}
+
+type Signer struct {
+	keys *secrets.Keyrings
+	ttl  time.Duration
+}
+
+// NewSigner signs with the current key of the keyring, tokens are valid for
+// ttl after they are signed.
+func NewSigner(keys *secrets.Keyrings, ttl time.Duration) *Signer {
+	return &Signer{keys: keys, ttl: ttl}
+}
+
+// TTL is how long tokens are valid, a transfer must complete within it.
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign sets Issued and Expires of the session and returns its token,
+// v<key version>.<payload>.<signature>.
+func (s *Signer) Sign(ctx context.Context, session Session, now time.Time) (string, error) {
+	keyring, err := s.keys.Keyring(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	session.Issued = now
+	session.Expires = now.Add(s.ttl)
+
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	signed := "v" + strconv.Itoa(keyring.Current.Version) + "." + base64.RawURLEncoding.EncodeToString(raw)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac(keyring.Current, signed)), nil
+}
+
+// Verify returns the session of a token signed with a key the keyring still
+// accepts at now.
+func (s *Signer) Verify(ctx context.Context, token string, now time.Time) (Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "v") {
+		return Session{}, ErrInvalidToken
+	}
+
+	version, err := strconv.Atoi(parts[0][1:])
+	if err != nil {
+		return Session{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Session{}, ErrInvalidToken
+	}
+
+	keyring, err := s.keys.Keyring(ctx)
+	if err != nil {
+		return Session{}, err
+	}
+
+	signed := parts[0] + "." + parts[1]
+	valid := false
+	for _, key := range keyring.Accepted(now) {
+		if key.Version == version && hmac.Equal(signature, mac(key, signed)) {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return Session{}, ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Session{}, ErrInvalidToken
+	}
+
+	session := Session{}
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return Session{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if now.After(session.Expires) {
+		return Session{}, ErrExpired
+	}
+
+	return session, nil
+}
+
+func mac(key secrets.Secret, signed string) []byte {
+	m := hmac.New(sha256.New, []byte(key.Value))
+	m.Write([]byte(signed))
+
+	return m.Sum(nil)
+}
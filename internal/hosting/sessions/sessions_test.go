@@ -0,0 +1,114 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/secrets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+var now = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func newSigner(t *testing.T) (*Signer, *secrets.Keyrings) {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := secrets.New(bucket, "keyring")
+	if _, err := keys.Ensure(context.Background(), "", now); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSigner(keys, 5*time.Minute), keys
+}
+
+func TestSignVerify(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := newSigner(t)
+	player := uuid.New()
+
+	token, err := signer.Sign(ctx, Session{Player: player, Server: "lobby-1", Party: "party-1"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := signer.Verify(ctx, token, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session.Player != player || session.Server != "lobby-1" || session.Party != "party-1" {
+		t.Fatalf("unexpected session %+v", session)
+	}
+
+	if !session.Expires.Equal(now.Add(5 * time.Minute)) {
+		t.Fatalf("expected expiry after the TTL, got %s", session.Expires)
+	}
+
+	if _, err := signer.Verify(ctx, token, now.Add(6*time.Minute)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	ctx := context.Background()
+	signer, _ := newSigner(t)
+
+	token, err := signer.Sign(ctx, Session{Player: uuid.New(), Server: "lobby-1"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := signer.Sign(ctx, Session{Player: uuid.New(), Server: "staff-1"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+
+	for _, tampered := range []string{
+		"",
+		"garbage",
+		parts[0] + "." + otherParts[1] + "." + parts[2],
+		"v2." + parts[1] + "." + parts[2],
+		parts[0] + "." + parts[1] + ".AAAA",
+	} {
+		if _, err := signer.Verify(ctx, tampered, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%q: expected ErrInvalidToken, got %v", tampered, err)
+		}
+	}
+}
+
+func TestVerifyAfterRotation(t *testing.T) {
+	ctx := context.Background()
+	signer, keys := newSigner(t)
+
+	token, err := signer.Sign(ctx, Session{Player: uuid.New()}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keys.Rotate(ctx, time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := signer.Verify(ctx, token, now.Add(30*time.Second)); err != nil {
+		t.Fatalf("expected the previous key to be accepted, got %v", err)
+	}
+
+	if _, err := signer.Verify(ctx, token, now.Add(2*time.Minute)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken once the previous key expired, got %v", err)
+	}
+}
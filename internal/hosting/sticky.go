@@ -0,0 +1,312 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+const (
+	// sticky.<gamemode>.<key> holds a StickyRecord
+	stickyKeyPrefix = "sticky."
+	// sticky-player.<uuid> holds the player's stickyPlayer
+	stickyPlayerKeyPrefix = "sticky-player."
+)
+
+// StickyRecord pins a routing key, e.g. a party or guild ID, to an instance
+// of a gamemode. Every player routed with the key extends it.
+type StickyRecord struct {
+	Key      string    `json:"key"`
+	Gamemode string    `json:"gamemode"`
+	Server   string    `json:"server"`
+	Expires  time.Time `json:"expires"`
+}
+
+type stickyPlayer struct {
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+func stickyKey(gamemode, key string) string {
+	return stickyKeyPrefix + gamemode + "." + key
+}
+
+// SetStickyKey groups the player with everyone else that has the same key,
+// they are routed to the same instance of a gamemode until ttl passes.
+func (m *InstanceManager) SetStickyKey(ctx context.Context, player uuid.UUID, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = m.stickyTTL
+	}
+
+	return kv.Typed[stickyPlayer](m.routingKV, stickyPlayerKeyPrefix+player.String()).Set(ctx, stickyPlayer{Key: key, Expires: time.Now().Add(ttl)})
+}
+
+// StickyKey returns the player's routing key, or "" if it has none.
+func (m *InstanceManager) StickyKey(ctx context.Context, player uuid.UUID) (string, error) {
+	sp, err := kv.Typed[stickyPlayer](m.routingKV, stickyPlayerKeyPrefix+player.String()).Get(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Unset keys expired at the zero time
+	if time.Now().After(sp.Expires) {
+		return "", nil
+	}
+
+	return sp.Key, nil
+}
+
+func (m *InstanceManager) stickyRecord(ctx context.Context, gamemode, key string) (*StickyRecord, error) {
+	rec, ok, err := kv.Typed[StickyRecord](m.routingKV, stickyKey(gamemode, key)).Lookup(ctx)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if time.Now().After(rec.Expires) {
+		return nil, nil
+	}
+
+	return &rec, nil
+}
+
+func (m *InstanceManager) pin(ctx context.Context, gamemode, key, server string) (*StickyRecord, error) {
+	rec := &StickyRecord{Key: key, Gamemode: gamemode, Server: server, Expires: time.Now().Add(m.stickyTTL)}
+
+	if err := kv.Typed[StickyRecord](m.routingKV, stickyKey(gamemode, key)).Set(ctx, *rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// chooseSticky keeps the key on its pinned server as long as that server is
+// still one of the candidates, otherwise it pins the key to a new one.
+func (m *InstanceManager) chooseSticky(ctx context.Context, gamemode, key string, servers []proxy.RegisteredServer) (proxy.RegisteredServer, error) {
+	rec, err := m.stickyRecord(ctx, gamemode, key)
+	if err != nil {
+		return nil, err
+	}
+
+	server := servers[m.rnd.Intn(len(servers))]
+	if rec != nil {
+		i := slices.IndexFunc(servers, func(s proxy.RegisteredServer) bool {
+			return s.ServerInfo().Name() == rec.Server
+		})
+		if i >= 0 {
+			server = servers[i]
+		}
+	}
+
+	if _, err := m.pin(ctx, gamemode, key, server.ServerInfo().Name()); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Colocate pins key to server, or to the current or a random stable instance
+// if server is empty, and gives every player the key.
+func (m *InstanceManager) Colocate(ctx context.Context, gamemode, key, server string, players []uuid.UUID) (*StickyRecord, error) {
+	if server == "" {
+		rec, err := m.stickyRecord(ctx, gamemode, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if rec != nil && m.server(rec.Server) != nil {
+			server = rec.Server
+		}
+	}
+
+	if server == "" {
+		instances, err := m.instancesOfGamemode(ctx, gamemode)
+		if err != nil {
+			return nil, err
+		}
+
+		instances = slices.DeleteFunc(instances, func(i instance) bool { return i.info.Canary })
+		if len(instances) == 0 {
+			return nil, ErrNoServersAvailable
+		}
+
+		server = instances[m.rnd.Intn(len(instances))].server.ServerInfo().Name()
+	} else if s := m.server(server); s != nil {
+		server = s.ServerInfo().Name()
+	} else {
+		return nil, fmt.Errorf("server %s: %w", server, ErrNoServersAvailable)
+	}
+
+	rec, err := m.pin(ctx, gamemode, key, server)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, player := range players {
+		if err := m.SetStickyKey(ctx, player, key, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+func (n *Hosting) StickyRecords(ctx context.Context) ([]StickyRecord, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]StickyRecord, 0)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, stickyKeyPrefix) {
+			continue
+		}
+
+		rec, ok, err := kv.Typed[StickyRecord](n.rt, key).Lookup(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok || time.Now().After(rec.Expires) {
+			continue
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// pruneSticky deletes expired stickiness records every interval. Every proxy
+// runs it, deleting a record that another proxy already removed is harmless.
+func (n *Hosting) pruneSticky(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		keys, err := n.rt.ListKeys(ctx)
+		if err != nil {
+			log.Printf("Failed to list routing keys: %v", err)
+			continue
+		}
+
+		for _, key := range keys {
+			if !strings.HasPrefix(key, stickyKeyPrefix) && !strings.HasPrefix(key, stickyPlayerKeyPrefix) {
+				continue
+			}
+
+			// Both record types store their expiry in the same field
+			rec, ok, err := kv.Typed[stickyPlayer](n.rt, key).Lookup(ctx)
+			if err != nil || !ok || time.Now().Before(rec.Expires) {
+				continue
+			}
+
+			if err := n.rt.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+				log.Printf("Failed to delete expired routing key %s: %v", key, err)
+			}
+		}
+	}
+}
+
+type colocateRequest struct {
+	Server  string   `json:"server,omitempty"`
+	Players []string `json:"players"`
+}
+
+func (n *Hosting) handleListSticky(w http.ResponseWriter, r *http.Request) {
+	records, err := n.StickyRecords(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, records)
+}
+
+// handleColocate is used by matchmakers to put a group of players on the same
+// instance. Players are routed there the next time they join the gamemode,
+// the response names the server so they can also be transferred right away.
+func (n *Hosting) handleColocate(w http.ResponseWriter, r *http.Request) {
+	gamemode, key := r.PathValue("gamemode"), r.PathValue("key")
+
+	req := colocateRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	players := make([]uuid.UUID, 0, len(req.Players))
+	for _, raw := range req.Players {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("player %s: %w", raw, err))
+			return
+		}
+
+		players = append(players, id)
+	}
+
+	prx := n.prx.Load()
+	if prx == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, errors.New("proxy is not running yet"))
+		return
+	}
+
+	mgr, err := n.InstanceManager(r.Context(), prx)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rec, err := mgr.Colocate(r.Context(), gamemode, key, req.Server, players)
+	if errors.Is(err, ErrNoServersAvailable) {
+		api.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := n.adt.Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "routing.colocate",
+		Target:  gamemode + "/" + key,
+		Details: map[string]string{"server": rec.Server, "players": strings.Join(req.Players, ",")},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, rec)
+}
+
+func (n *Hosting) handleDeleteSticky(w http.ResponseWriter, r *http.Request) {
+	key := stickyKey(r.PathValue("gamemode"), r.PathValue("key"))
+
+	if err := n.rt.Delete(r.Context(), key); errors.Is(err, kv.ErrKeyNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
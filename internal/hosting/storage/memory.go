@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"sync"
 )
 
 var _ Storage = &Memory{}
 
 type Memory struct {
 	data map[string][]byte
+	m    sync.RWMutex
 }
 
 func NewMemory() *Memory {
@@ -19,7 +21,10 @@ func NewMemory() *Memory {
 }
 
 func (m *Memory) Read(ctx context.Context, key string) ([]byte, error) {
+	m.m.RLock()
 	v, exists := m.data[key]
+	m.m.RUnlock()
+
 	if !exists {
 		return nil, ErrKeyNotFound
 	}
@@ -39,7 +44,10 @@ func (m *Memory) ReadStreaming(ctx context.Context, key string) (io.ReadCloser,
 }
 
 func (m *Memory) Save(ctx context.Context, key string, content []byte) error {
+	m.m.Lock()
 	m.data[key] = content
+	m.m.Unlock()
+
 	return nil
 }
 
@@ -54,7 +62,10 @@ func (m *Memory) SaveStreaming(ctx context.Context, key string) (io.WriteCloser,
 }
 
 func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.m.Lock()
 	delete(m.data, key)
+	m.m.Unlock()
+
 	return nil
 }
 
@@ -65,6 +76,5 @@ type writeCloser struct {
 }
 
 func (w *writeCloser) Close() error {
-	w.m.data[w.key] = w.Bytes()
-	return nil
+	return w.m.Save(context.Background(), w.key, w.Bytes())
 }
@@ -0,0 +1,236 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/themes"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Themes holds the event season themes, h.Themes().Current() returns the
+// active one.
+func (n *Hosting) Themes() *themes.Themes {
+	return n.thm
+}
+
+func (n *Hosting) SetTheme(ctx context.Context, actor string, theme themes.Theme) error {
+	if err := n.thm.Set(ctx, theme); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "theme.set", Target: theme.Name})
+}
+
+func (n *Hosting) DeleteTheme(ctx context.Context, actor, name string) error {
+	if err := n.thm.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "theme.delete", Target: name})
+}
+
+// ActivateTheme switches every proxy to the theme, "" deactivates themes.
+func (n *Hosting) ActivateTheme(ctx context.Context, actor, name string) error {
+	if err := n.thm.Activate(ctx, themes.Active{Theme: name, Updated: time.Now()}); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "theme.activate", Target: name})
+}
+
+func (n *Hosting) SetThemeSchedule(ctx context.Context, actor string, s themes.Schedule) error {
+	if err := n.thm.SetSchedule(ctx, s); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "theme.schedule",
+		Target:  s.ID,
+		Details: map[string]string{"theme": s.Theme, "start": s.Start.Format(time.RFC3339), "end": s.End.Format(time.RFC3339)},
+	})
+}
+
+func (n *Hosting) DeleteThemeSchedule(ctx context.Context, actor, id string) error {
+	if err := n.thm.DeleteSchedule(ctx, id); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "theme.unschedule", Target: id})
+}
+
+// scheduleThemes applies the theme schedules. Every proxy runs it, they all
+// write the same active value so it doesn't matter which one is first.
+func (n *Hosting) scheduleThemes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			active, changed, err := n.thm.Tick(ctx, now)
+			if err != nil {
+				log.Printf("Failed to apply theme schedules: %v", err)
+				continue
+			}
+
+			if !changed {
+				continue
+			}
+
+			log.Printf("Theme schedule %s activated theme %q", active.Schedule, active.Theme)
+
+			if err := n.adt.Record(ctx, audit.Entry{Actor: "scheduler", Action: "theme.activate", Target: active.Theme, Details: map[string]string{"schedule": active.Schedule}}); err != nil {
+				log.Printf("Failed to record theme activation: %v", err)
+			}
+		}
+	}
+}
+
+// pick chooses one of the servers at random, weighted by the active theme.
+func (m *InstanceManager) pick(gamemode string, servers []proxy.RegisteredServer, instances []instance) proxy.RegisteredServer {
+	theme, ok := m.themes.Current()
+	if !ok || len(theme.Weights[gamemode]) == 0 {
+		return servers[m.rnd.Intn(len(servers))]
+	}
+
+	labels := make(map[string]map[string]string, len(instances))
+	for _, i := range instances {
+		name := i.server.ServerInfo().Name()
+		labels[name] = i.info.Labels(name)
+	}
+
+	weights := make([]int, len(servers))
+	total := 0
+	for i, s := range servers {
+		weights[i] = theme.Weight(gamemode, labels[s.ServerInfo().Name()])
+		total += weights[i]
+	}
+
+	// A theme that weights every instance 0 doesn't get to take the gamemode
+	// offline
+	if total == 0 {
+		return servers[m.rnd.Intn(len(servers))]
+	}
+
+	n := m.rnd.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return servers[i]
+		}
+
+		n -= w
+	}
+
+	return servers[len(servers)-1]
+}
+
+func (n *Hosting) handleListThemes(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.thm.List())
+}
+
+func (n *Hosting) handleSetTheme(w http.ResponseWriter, r *http.Request) {
+	theme := themes.Theme{}
+	if err := api.ReadJSON(r, &theme); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	theme.Name = r.PathValue("name")
+
+	if err := theme.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetTheme(r.Context(), "api", theme); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, theme)
+}
+
+func (n *Hosting) handleDeleteTheme(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteTheme(r.Context(), "api", r.PathValue("name")); errors.Is(err, themes.ErrThemeNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Hosting) handleGetActiveTheme(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.thm.Active())
+}
+
+type activateThemeRequest struct {
+	Theme string `json:"theme"`
+}
+
+func (n *Hosting) handleActivateTheme(w http.ResponseWriter, r *http.Request) {
+	req := activateThemeRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.ActivateTheme(r.Context(), "api", req.Theme); errors.Is(err, themes.ErrThemeNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, n.thm.Active())
+}
+
+func (n *Hosting) handleListThemeSchedules(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.thm.Schedules())
+}
+
+func (n *Hosting) handleSetThemeSchedule(w http.ResponseWriter, r *http.Request) {
+	s := themes.Schedule{}
+	if err := api.ReadJSON(r, &s); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.ID = r.PathValue("id")
+
+	if err := s.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetThemeSchedule(r.Context(), "api", s); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, s)
+}
+
+func (n *Hosting) handleDeleteThemeSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteThemeSchedule(r.Context(), "api", r.PathValue("id")); errors.Is(err, themes.ErrScheduleNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
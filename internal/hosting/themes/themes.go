@@ -0,0 +1,390 @@
+// Package themes switches the look of the network between event seasons. A
+// theme bundles MOTDs, the tab list, the join message and routing weights,
+// one KV value selects the active theme on every proxy.
+package themes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+)
+
+const (
+	activeKey      = "active"
+	themePrefix    = "theme."
+	schedulePrefix = "schedule."
+)
+
+var (
+	ErrThemeNotFound    = errors.New("theme not found")
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// Weight makes instances matching Selector Weight times as likely to be
+// picked, instances without a matching weight count 1.
+type Weight struct {
+	Selector string `json:"selector"`
+	Weight   int    `json:"weight"`
+}
+
+type Theme struct {
+	Name string `json:"name"`
+	// MOTDs are picked at random for every server list ping, with & color
+	// codes and \n between the two lines.
+	MOTDs     []string `json:"motds,omitempty"`
+	TabHeader string   `json:"tabHeader,omitempty"`
+	TabFooter string   `json:"tabFooter,omitempty"`
+	// JoinMessage is sent to players when they join, {player} is replaced
+	// with their name.
+	JoinMessage string `json:"joinMessage,omitempty"`
+	// Weights by gamemode, e.g. to send most players to the decorated lobby.
+	Weights map[string][]Weight `json:"weights,omitempty"`
+}
+
+func (t Theme) Validate() error {
+	if t.Name == "" {
+		return errors.New("theme name is required")
+	}
+
+	for gamemode, weights := range t.Weights {
+		for _, w := range weights {
+			if _, err := registry.Parse(w.Selector); err != nil {
+				return fmt.Errorf("weight of %s: %w", gamemode, err)
+			}
+
+			if w.Weight < 0 {
+				return fmt.Errorf("weight of %s: %d is negative", gamemode, w.Weight)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Weight returns how likely an instance of the gamemode with the labels is
+// picked, relative to the others.
+func (t Theme) Weight(gamemode string, labels map[string]string) int {
+	for _, w := range t.Weights[gamemode] {
+		if sel, err := registry.Parse(w.Selector); err == nil && sel.Matches(labels) {
+			return w.Weight
+		}
+	}
+
+	return 1
+}
+
+// Schedule activates a theme between Start and End.
+type Schedule struct {
+	ID    string    `json:"id"`
+	Theme string    `json:"theme"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (s Schedule) Validate() error {
+	if s.ID == "" || s.Theme == "" {
+		return errors.New("schedule id and theme are required")
+	}
+
+	if !s.End.After(s.Start) {
+		return errors.New("schedule must end after it starts")
+	}
+
+	return nil
+}
+
+func (s Schedule) covers(now time.Time) bool {
+	return !now.Before(s.Start) && now.Before(s.End)
+}
+
+// Active is the value of the active key. Schedule is set if a schedule
+// activated the theme, so it can be deactivated again when the schedule ends.
+type Active struct {
+	Theme    string    `json:"theme"`
+	Schedule string    `json:"schedule,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Themes keeps the themes, schedules and active theme of a bucket in memory.
+type Themes struct {
+	kv        kv.Bucket
+	themes    map[string]Theme
+	schedules map[string]Schedule
+	active    Active
+	m         sync.RWMutex
+}
+
+func New(ctx context.Context, bucket kv.Bucket) (*Themes, error) {
+	t := &Themes{kv: bucket, themes: make(map[string]Theme), schedules: make(map[string]Schedule)}
+
+	if err := t.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *Themes) Reload(ctx context.Context) error {
+	keys, err := t.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	themes := make(map[string]Theme)
+	schedules := make(map[string]Schedule)
+	active := Active{}
+	for _, key := range keys {
+		raw, err := t.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := decode(key, raw, themes, schedules, &active); err != nil {
+			log.Printf("Failed to unmarshal theme key %s: %v", key, err)
+		}
+	}
+
+	t.m.Lock()
+	t.themes, t.schedules, t.active = themes, schedules, active
+	t.m.Unlock()
+
+	return nil
+}
+
+func decode(key string, raw []byte, themes map[string]Theme, schedules map[string]Schedule, active *Active) error {
+	if name, ok := strings.CutPrefix(key, themePrefix); ok {
+		theme := Theme{}
+		if err := json.Unmarshal(raw, &theme); err != nil {
+			return err
+		}
+
+		themes[name] = theme
+	} else if id, ok := strings.CutPrefix(key, schedulePrefix); ok {
+		schedule := Schedule{}
+		if err := json.Unmarshal(raw, &schedule); err != nil {
+			return err
+		}
+
+		schedules[id] = schedule
+	} else if key == activeKey {
+		return json.Unmarshal(raw, active)
+	}
+
+	return nil
+}
+
+// Watch keeps the themes in sync with the bucket until ctx is done.
+func (t *Themes) Watch(ctx context.Context) {
+	kv.Watch(ctx, t.kv, t.handleChange, t.Reload)
+}
+
+func (t *Themes) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		if err := decode(v.Key, v.Value, t.themes, t.schedules, &t.active); err != nil {
+			log.Printf("Failed to unmarshal theme key %s: %v", v.Key, err)
+		}
+
+	case kv.Delete:
+		if name, ok := strings.CutPrefix(v.Key, themePrefix); ok {
+			delete(t.themes, name)
+		} else if id, ok := strings.CutPrefix(v.Key, schedulePrefix); ok {
+			delete(t.schedules, id)
+		} else if v.Key == activeKey {
+			t.active = Active{}
+		}
+	}
+}
+
+// Current returns the active theme, false if there is none or it doesn't
+// exist.
+func (t *Themes) Current() (Theme, bool) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	theme, ok := t.themes[t.active.Theme]
+
+	return theme, ok
+}
+
+func (t *Themes) Active() Active {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	return t.active
+}
+
+func (t *Themes) setJSON(ctx context.Context, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return t.kv.Set(ctx, key, raw)
+}
+
+// Activate makes the theme active on every proxy, an empty Theme deactivates
+// themes.
+func (t *Themes) Activate(ctx context.Context, active Active) error {
+	if active.Theme != "" {
+		t.m.RLock()
+		_, ok := t.themes[active.Theme]
+		t.m.RUnlock()
+
+		if !ok {
+			return ErrThemeNotFound
+		}
+	}
+
+	if err := t.setJSON(ctx, activeKey, active); err != nil {
+		return err
+	}
+
+	t.m.Lock()
+	t.active = active
+	t.m.Unlock()
+
+	return nil
+}
+
+// Tick activates the theme of the schedule that covers now and deactivates
+// it once the schedule ends. A schedule only takes over if the active theme
+// was set before it started, so a theme picked by hand during a schedule is
+// kept. Returns the new active value if it changed.
+func (t *Themes) Tick(ctx context.Context, now time.Time) (Active, bool, error) {
+	t.m.RLock()
+	active := t.active
+
+	var due *Schedule
+	for _, s := range t.schedules {
+		if s.covers(now) && (due == nil || s.Start.After(due.Start)) {
+			due = &s
+		}
+	}
+
+	current, running := t.schedules[active.Schedule]
+	t.m.RUnlock()
+
+	switch {
+	case active.Schedule != "" && !(running && current.covers(now)):
+		// Without Updated, another schedule that covers now takes over on
+		// the next tick
+		return Active{}, true, t.Activate(ctx, Active{})
+
+	case due != nil && active.Schedule != due.ID && active.Updated.Before(due.Start):
+		next := Active{Theme: due.Theme, Schedule: due.ID, Updated: now}
+		return next, true, t.Activate(ctx, next)
+	}
+
+	return active, false, nil
+}
+
+func (t *Themes) List() []Theme {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	list := make([]Theme, 0, len(t.themes))
+	for _, theme := range t.themes {
+		list = append(list, theme)
+	}
+
+	slices.SortFunc(list, func(a, b Theme) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (t *Themes) Set(ctx context.Context, theme Theme) error {
+	if err := theme.Validate(); err != nil {
+		return err
+	}
+
+	if err := t.setJSON(ctx, themePrefix+theme.Name, theme); err != nil {
+		return err
+	}
+
+	t.m.Lock()
+	t.themes[theme.Name] = theme
+	t.m.Unlock()
+
+	return nil
+}
+
+func (t *Themes) Delete(ctx context.Context, name string) error {
+	if err := t.kv.Delete(ctx, themePrefix+name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrThemeNotFound
+	} else if err != nil {
+		return err
+	}
+
+	t.m.Lock()
+	delete(t.themes, name)
+	t.m.Unlock()
+
+	return nil
+}
+
+func (t *Themes) Schedules() []Schedule {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	list := make([]Schedule, 0, len(t.schedules))
+	for _, s := range t.schedules {
+		list = append(list, s)
+	}
+
+	slices.SortFunc(list, func(a, b Schedule) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	return list
+}
+
+func (t *Themes) SetSchedule(ctx context.Context, s Schedule) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	if err := t.setJSON(ctx, schedulePrefix+s.ID, s); err != nil {
+		return err
+	}
+
+	t.m.Lock()
+	t.schedules[s.ID] = s
+	t.m.Unlock()
+
+	return nil
+}
+
+func (t *Themes) DeleteSchedule(ctx context.Context, id string) error {
+	if err := t.kv.Delete(ctx, schedulePrefix+id); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrScheduleNotFound
+	} else if err != nil {
+		return err
+	}
+
+	t.m.Lock()
+	delete(t.schedules, id)
+	t.m.Unlock()
+
+	return nil
+}
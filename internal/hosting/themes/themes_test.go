@@ -0,0 +1,131 @@
+package themes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newThemes(t *testing.T) *Themes {
+	ctx := context.Background()
+
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(ctx, "themes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	themes, err := New(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"halloween", "winter"} {
+		if err := themes.Set(ctx, Theme{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return themes
+}
+
+func TestActivate(t *testing.T) {
+	ctx := context.Background()
+	themes := newThemes(t)
+
+	if _, ok := themes.Current(); ok {
+		t.Fatal("expected no active theme")
+	}
+
+	if err := themes.Activate(ctx, Active{Theme: "missing"}); !errors.Is(err, ErrThemeNotFound) {
+		t.Fatalf("expected ErrThemeNotFound, got %v", err)
+	}
+
+	if err := themes.Activate(ctx, Active{Theme: "halloween", Updated: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another proxy loads the active theme from KV
+	if err := themes.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if theme, ok := themes.Current(); !ok || theme.Name != "halloween" {
+		t.Fatalf("expected halloween, got %+v", theme)
+	}
+}
+
+func TestTick(t *testing.T) {
+	ctx := context.Background()
+	themes := newThemes(t)
+
+	start := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	if err := themes.SetSchedule(ctx, Schedule{ID: "halloween-2026", Theme: "halloween", Start: start, End: start.Add(14 * 24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, changed, err := themes.Tick(ctx, start.Add(-time.Minute)); err != nil || changed {
+		t.Fatalf("expected no change before the schedule, got %v %v", changed, err)
+	}
+
+	active, changed, err := themes.Tick(ctx, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || active.Theme != "halloween" {
+		t.Fatalf("expected halloween to be activated, got %+v", active)
+	}
+
+	// Picking a theme by hand during the schedule sticks
+	if err := themes.Activate(ctx, Active{Theme: "winter", Updated: start.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, changed, err := themes.Tick(ctx, start.Add(2*time.Hour)); err != nil || changed {
+		t.Fatalf("expected the manual theme to stay, got %v %v", changed, err)
+	}
+
+	if err := themes.Activate(ctx, Active{Theme: "halloween", Schedule: "halloween-2026", Updated: start.Add(3 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	active, changed, err = themes.Tick(ctx, start.Add(15*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || active.Theme != "" {
+		t.Fatalf("expected the theme to be deactivated, got %+v", active)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	theme := Theme{Name: "halloween", Weights: map[string][]Weight{
+		"lobby": {{Selector: "theme=halloween", Weight: 5}, {Selector: "", Weight: 0}},
+	}}
+
+	if err := theme.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := theme.Weight("lobby", map[string]string{"theme": "halloween"}); w != 5 {
+		t.Fatalf("expected 5, got %d", w)
+	}
+
+	if w := theme.Weight("lobby", map[string]string{}); w != 0 {
+		t.Fatalf("expected 0, got %d", w)
+	}
+
+	if w := theme.Weight("survival", map[string]string{}); w != 1 {
+		t.Fatalf("expected 1, got %d", w)
+	}
+}
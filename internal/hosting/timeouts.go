@@ -0,0 +1,153 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const timeoutsKeyPrefix = "timeouts."
+
+// TimeoutConfig overrides the timeouts of the instances of a gamemode, 0
+// keeps the default. ConnectSeconds covers connecting to and logging into
+// the backend, e.g. servers sending large datapacks need longer.
+//
+// LoginSeconds and ReadSeconds replace Gate's read timeout of the client
+// connections that plugins wrap, e.g. those of the additional listeners.
+// LoginSeconds applies while the player joins a server of the gamemode,
+// ReadSeconds once the player is on it.
+type TimeoutConfig struct {
+	ConnectSeconds int `json:"connectSeconds"`
+	LoginSeconds   int `json:"loginSeconds"`
+	ReadSeconds    int `json:"readSeconds"`
+}
+
+func (c TimeoutConfig) validate() error {
+	if c.ConnectSeconds < 0 || c.LoginSeconds < 0 || c.ReadSeconds < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+
+	return nil
+}
+
+func (m *InstanceManager) GroupTimeouts(ctx context.Context, gamemode string) (TimeoutConfig, error) {
+	return kv.Typed[TimeoutConfig](m.routingKV, timeoutsKeyPrefix+gamemode).Get(ctx)
+}
+
+// ServerTimeouts returns the timeouts of the gamemode of the server, all 0
+// for servers without one.
+func (m *InstanceManager) ServerTimeouts(ctx context.Context, server proxy.RegisteredServer) TimeoutConfig {
+	info, err := kv.Typed[InstanceInfo](m.instancesKV, m.instanceKey(server.ServerInfo().Name())).Get(ctx)
+	if err != nil || info.Gamemode == "" {
+		return TimeoutConfig{}
+	}
+
+	cfg, err := m.GroupTimeouts(ctx, info.Gamemode)
+	if err != nil {
+		return TimeoutConfig{}
+	}
+
+	return cfg
+}
+
+// ConnectTimeout returns how long connecting a player to the server may take.
+func (m *InstanceManager) ConnectTimeout(ctx context.Context, server proxy.RegisteredServer) time.Duration {
+	cfg := m.ServerTimeouts(ctx, server)
+	if cfg.ConnectSeconds == 0 {
+		return m.connectTimeout
+	}
+
+	return time.Duration(cfg.ConnectSeconds) * time.Second
+}
+
+// Connect connects the player to the server within the connect timeout of
+// its gamemode.
+func (m *InstanceManager) Connect(ctx context.Context, player proxy.Player, server proxy.RegisteredServer) (proxy.ServerConnectionResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.ConnectTimeout(ctx, server))
+	defer cancel()
+
+	return player.CreateConnectionRequest(server).Connect(ctx)
+}
+
+func (n *Hosting) GroupTimeouts(ctx context.Context) (map[string]TimeoutConfig, error) {
+	keys, err := n.rt.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts := make(map[string]TimeoutConfig)
+	for _, key := range keys {
+		gamemode, ok := strings.CutPrefix(key, timeoutsKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		cfg, err := kv.Typed[TimeoutConfig](n.rt, key).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		timeouts[gamemode] = cfg
+	}
+
+	return timeouts, nil
+}
+
+func (n *Hosting) SetGroupTimeouts(ctx context.Context, actor, gamemode string, cfg TimeoutConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	if err := kv.Typed[TimeoutConfig](n.rt, timeoutsKeyPrefix+gamemode).Set(ctx, cfg); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "routing.timeouts",
+		Target: gamemode,
+		Details: map[string]string{
+			"connectSeconds": strconv.Itoa(cfg.ConnectSeconds),
+			"loginSeconds":   strconv.Itoa(cfg.LoginSeconds),
+			"readSeconds":    strconv.Itoa(cfg.ReadSeconds),
+		},
+	})
+}
+
+func (n *Hosting) handleGetTimeouts(w http.ResponseWriter, r *http.Request) {
+	timeouts, err := n.GroupTimeouts(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, timeouts)
+}
+
+func (n *Hosting) handleSetTimeouts(w http.ResponseWriter, r *http.Request) {
+	cfg := TimeoutConfig{}
+	if err := api.ReadJSON(r, &cfg); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := cfg.validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := n.SetGroupTimeouts(r.Context(), "api", r.PathValue("gamemode"), cfg); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cfg)
+}
@@ -0,0 +1,204 @@
+package hosting
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+)
+
+var ErrNotTraced = errors.New("player is not traced")
+
+// Trace makes every decision about a player get logged with its ID, so the
+// lines of one support ticket can be found among those of everyone else.
+type Trace struct {
+	ID     string `json:"id"`
+	Player string `json:"player"`
+	// UUID is empty if the name couldn't be resolved, the trace then only
+	// matches by name
+	UUID  string    `json:"uuid,omitempty"`
+	Until time.Time `json:"until"`
+}
+
+type traces struct {
+	// byKey holds every trace under the lowercase name and the undashed UUID
+	byKey map[string]*Trace
+	m     sync.RWMutex
+}
+
+// TracePlayer traces the player for d. Players don't need to be online, so
+// failed logins can be traced as well.
+func (n *Hosting) TracePlayer(ctx context.Context, actor, name string, d time.Duration) (Trace, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Trace{}, err
+	}
+
+	t := &Trace{ID: hex.EncodeToString(id), Player: name, Until: time.Now().Add(d)}
+	if playerID, err := n.prf.ID(ctx, name); err == nil {
+		t.UUID = uuid.Normalize(playerID)
+	} else {
+		log.Printf("Tracing %s by name only, failed to resolve their UUID: %v", name, err)
+	}
+
+	n.tr.m.Lock()
+	if n.tr.byKey == nil {
+		n.tr.byKey = make(map[string]*Trace)
+	}
+	n.untrace(name)
+	n.tr.byKey[strings.ToLower(name)] = t
+	if t.UUID != "" {
+		n.tr.byKey[t.UUID] = t
+	}
+	n.tr.m.Unlock()
+
+	log.Printf("TRACE %s %s: tracing until %s", t.ID, t.Player, t.Until.Format(time.RFC3339))
+
+	return *t, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "trace.start",
+		Target:  name,
+		Details: map[string]string{"id": t.ID, "duration": d.String()},
+	})
+}
+
+// untrace must be called with the lock held.
+func (n *Hosting) untrace(name string) *Trace {
+	t, ok := n.tr.byKey[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+
+	delete(n.tr.byKey, strings.ToLower(t.Player))
+	delete(n.tr.byKey, t.UUID)
+
+	return t
+}
+
+// TraceDuration is how long players are traced by default, TRACE_DURATION.
+func (n *Hosting) TraceDuration() time.Duration {
+	return n.traceDuration
+}
+
+func (n *Hosting) UntracePlayer(ctx context.Context, actor, name string) error {
+	n.tr.m.Lock()
+	t := n.untrace(name)
+	n.tr.m.Unlock()
+
+	if t == nil {
+		return ErrNotTraced
+	}
+
+	log.Printf("TRACE %s %s: stopped tracing", t.ID, t.Player)
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "trace.stop", Target: name, Details: map[string]string{"id": t.ID}})
+}
+
+// Traced returns the running trace of the player, given by name or UUID.
+func (n *Hosting) Traced(player string) (Trace, bool) {
+	n.tr.m.RLock()
+	defer n.tr.m.RUnlock()
+
+	if len(n.tr.byKey) == 0 {
+		return Trace{}, false
+	}
+
+	t, ok := n.tr.byKey[strings.ToLower(player)]
+	if !ok {
+		t, ok = n.tr.byKey[uuid.Normalize(player)]
+	}
+
+	if !ok || time.Now().After(t.Until) {
+		return Trace{}, false
+	}
+
+	return *t, true
+}
+
+// Tracef logs a decision about the player, given by name or UUID, if they
+// are traced.
+func (n *Hosting) Tracef(player string, format string, args ...any) {
+	t, ok := n.Traced(player)
+	if !ok {
+		return
+	}
+
+	log.Printf("TRACE %s %s: %s", t.ID, t.Player, fmt.Sprintf(format, args...))
+}
+
+// Traces returns the running traces sorted by player.
+func (n *Hosting) Traces() []Trace {
+	n.tr.m.RLock()
+	defer n.tr.m.RUnlock()
+
+	now := time.Now()
+	traces := make([]Trace, 0)
+	for key, t := range n.tr.byKey {
+		if key == strings.ToLower(t.Player) && now.Before(t.Until) {
+			traces = append(traces, *t)
+		}
+	}
+
+	slices.SortFunc(traces, func(a, b Trace) int {
+		return strings.Compare(a.Player, b.Player)
+	})
+
+	return traces
+}
+
+type traceRequest struct {
+	// For is how long to trace, TRACE_DURATION by default
+	For string `json:"for"`
+}
+
+func (n *Hosting) handleListTraces(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.Traces())
+}
+
+func (n *Hosting) handleTracePlayer(w http.ResponseWriter, r *http.Request) {
+	req := traceRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	d := n.traceDuration
+	if req.For != "" {
+		var err error
+		if d, err = time.ParseDuration(req.For); err != nil || d <= 0 {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", req.For))
+			return
+		}
+	}
+
+	t, err := n.TracePlayer(r.Context(), "api", r.PathValue("player"), d)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, t)
+}
+
+func (n *Hosting) handleUntracePlayer(w http.ResponseWriter, r *http.Request) {
+	if err := n.UntracePlayer(r.Context(), "api", r.PathValue("player")); errors.Is(err, ErrNotTraced) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
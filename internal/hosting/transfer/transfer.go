@@ -0,0 +1,135 @@
+// Package transfer hands players to another proxy or region with the
+// transfer packet of 1.20.5, so the client reconnects on its own instead of
+// being kicked. Cookies stored before the transfer go along with the client.
+//
+// Gate has no API for either packet, so they are encoded here and written to
+// the player's connection directly.
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// MinProtocol is 1.20.5, the first version with transfers.
+const MinProtocol = 766
+
+// MaxCookieSize is the largest payload clients store.
+const MaxCookieSize = 5120
+
+var (
+	ErrUnsupported = errors.New("client does not support transfers")
+	ErrNotPlaying  = errors.New("player is not connected to a server")
+)
+
+// packetIDs of the clientbound play packets, by protocol.
+type packetIDs struct {
+	storeCookie int
+	transfer    int
+}
+
+var playPackets = map[int]packetIDs{
+	766: {storeCookie: 0x6B, transfer: 0x73}, // 1.20.5, 1.20.6
+	767: {storeCookie: 0x6B, transfer: 0x73}, // 1.21, 1.21.1
+	768: {storeCookie: 0x72, transfer: 0x7A}, // 1.21.2, 1.21.3
+	769: {storeCookie: 0x72, transfer: 0x7A}, // 1.21.4
+}
+
+// conn is implemented by Gate's player connection, Write takes a packet ID
+// followed by its data and handles framing, compression and encryption.
+type conn interface {
+	Write(payload []byte) error
+}
+
+// Supported reports whether the client of the player can be transferred.
+func Supported(player proxy.Player) bool {
+	_, ok := playPackets[player.Protocol()]
+	_, isConn := player.(conn)
+
+	return ok && isConn
+}
+
+// Send stores the cookies on the client of the player and transfers it to
+// host:port. A target that supports cookies can request them during login;
+// they come from the client, so anything that must not be forged belongs in
+// KV or has to be signed.
+func Send(player proxy.Player, host string, port int, cookies map[string][]byte) error {
+	ids, ok := playPackets[player.Protocol()]
+	if !ok {
+		if player.Protocol() < MinProtocol {
+			return ErrUnsupported
+		}
+
+		return fmt.Errorf("%w: protocol %d is not known yet", ErrUnsupported, player.Protocol())
+	}
+
+	c, ok := player.(conn)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	// Outside of play, e.g. while switching servers, the client is in the
+	// configuration state where the packet IDs differ
+	if player.CurrentServer() == nil {
+		return ErrNotPlaying
+	}
+
+	for k, payload := range cookies {
+		p, err := storeCookie(ids.storeCookie, k, payload)
+		if err != nil {
+			return err
+		}
+
+		if err := c.Write(p); err != nil {
+			return err
+		}
+	}
+
+	return c.Write(transferPacket(ids.transfer, host, port))
+}
+
+func storeCookie(id int, key string, payload []byte) ([]byte, error) {
+	if !strings.Contains(key, ":") {
+		return nil, fmt.Errorf("cookie key %q must be namespaced", key)
+	}
+
+	if len(payload) > MaxCookieSize {
+		return nil, fmt.Errorf("cookie %s is larger than %d bytes", key, MaxCookieSize)
+	}
+
+	buf := bytes.Buffer{}
+	writeVarInt(&buf, id)
+	writeString(&buf, key)
+	writeVarInt(&buf, len(payload))
+	buf.Write(payload)
+
+	return buf.Bytes(), nil
+}
+
+func transferPacket(id int, host string, port int) []byte {
+	buf := bytes.Buffer{}
+	writeVarInt(&buf, id)
+	writeString(&buf, host)
+	writeVarInt(&buf, port)
+
+	return buf.Bytes()
+}
+
+func writeVarInt(buf *bytes.Buffer, v int) {
+	u := uint32(v)
+	for u >= 0x80 {
+		buf.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+
+	buf.WriteByte(byte(u))
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeVarInt(buf, len(s))
+	buf.WriteString(s)
+}
@@ -0,0 +1,59 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVarInt(t *testing.T) {
+	for v, want := range map[int][]byte{
+		0:      {0x00},
+		1:      {0x01},
+		127:    {0x7F},
+		128:    {0x80, 0x01},
+		25565:  {0xDD, 0xC7, 0x01},
+		-1:     {0xFF, 0xFF, 0xFF, 0xFF, 0x0F},
+		0x7A:   {0x7A},
+		0x1FFF: {0xFF, 0x3F},
+	} {
+		buf := bytes.Buffer{}
+		writeVarInt(&buf, v)
+
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("varint %d: expected %x, got %x", v, want, buf.Bytes())
+		}
+	}
+}
+
+func TestTransferPacket(t *testing.T) {
+	got := transferPacket(0x73, "eu.example.com", 25565)
+	want := append([]byte{0x73, 14}, []byte("eu.example.com")...)
+	want = append(want, 0xDD, 0xC7, 0x01)
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected %x, got %x", want, got)
+	}
+}
+
+func TestStoreCookie(t *testing.T) {
+	got, err := storeCookie(0x6B, "csmc:handoff", []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := append([]byte{0x6B, 12}, []byte("csmc:handoff")...)
+	want = append(want, 3, 1, 2, 3)
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected %x, got %x", want, got)
+	}
+
+	if _, err := storeCookie(0x6B, "handoff", nil); err == nil {
+		t.Fatal("expected an error for a key without namespace")
+	}
+
+	if _, err := storeCookie(0x6B, "csmc:big", []byte(strings.Repeat("x", MaxCookieSize+1))); err == nil {
+		t.Fatal("expected an error for a payload over the limit")
+	}
+}
@@ -0,0 +1,241 @@
+package hosting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+// WarmupPolicy decides what happens when a warmup doesn't load in time.
+type WarmupPolicy string
+
+const (
+	// WarmupFailOpen accepts logins and keeps loading in the background
+	WarmupFailOpen WarmupPolicy = "open"
+	// WarmupFailClosed denies logins until the data loaded
+	WarmupFailClosed WarmupPolicy = "closed"
+	// WarmupFailStart aborts the startup
+	WarmupFailStart WarmupPolicy = "start"
+)
+
+const (
+	WarmupPending = "pending"
+	WarmupLoaded  = "loaded"
+	WarmupFailed  = "failed"
+)
+
+type WarmupState struct {
+	Name     string       `json:"name"`
+	Policy   WarmupPolicy `json:"policy"`
+	State    string       `json:"state"`
+	Error    string       `json:"error,omitempty"`
+	Attempts int          `json:"attempts"`
+	Duration string       `json:"duration,omitempty"`
+}
+
+type warmer struct {
+	load  func(ctx context.Context) error
+	state WarmupState
+	done  chan struct{}
+}
+
+type warmups struct {
+	warmers map[string]*warmer
+	names   []string
+	started bool
+	m       sync.Mutex
+}
+
+// Warmup registers load to run before the proxy accepts connections, so early
+// joiners aren't evaluated against data that hasn't loaded yet. The policy
+// can be overridden through WARMUP_POLICIES, e.g. {"whitelist":"open"}.
+func (n *Hosting) Warmup(name string, policy WarmupPolicy, load func(ctx context.Context) error) {
+	n.wu.m.Lock()
+	defer n.wu.m.Unlock()
+
+	if n.wu.warmers == nil {
+		n.wu.warmers = make(map[string]*warmer)
+	}
+
+	if _, ok := n.wu.warmers[name]; !ok {
+		n.wu.names = append(n.wu.names, name)
+		slices.Sort(n.wu.names)
+	}
+
+	if override, ok := warmupPolicies()[name]; ok {
+		policy = override
+	}
+
+	n.wu.warmers[name] = &warmer{
+		load:  load,
+		state: WarmupState{Name: name, Policy: policy, State: WarmupPending},
+		done:  make(chan struct{}),
+	}
+}
+
+func warmupPolicies() map[string]WarmupPolicy {
+	policies := make(map[string]WarmupPolicy)
+
+	raw := util.EnvWithDefault("WARMUP_POLICIES", "")
+	if raw == "" {
+		return policies
+	}
+
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		log.Printf("Ignoring invalid WARMUP_POLICIES: %v", err)
+		return map[string]WarmupPolicy{}
+	}
+
+	for name, policy := range policies {
+		switch policy {
+		case WarmupFailOpen, WarmupFailClosed, WarmupFailStart:
+		default:
+			log.Printf("Ignoring unknown warmup policy %q for %s", policy, name)
+			delete(policies, name)
+		}
+	}
+
+	return policies
+}
+
+// WarmUp runs every registered warmup and waits up to WARMUP_TIMEOUT for them
+// to load. Warmups that didn't load keep retrying in the background, unless
+// their policy is WarmupFailStart, which makes WarmUp return an error.
+func (n *Hosting) WarmUp(ctx context.Context) error {
+	n.wu.m.Lock()
+	if n.wu.started {
+		n.wu.m.Unlock()
+		return nil
+	}
+	n.wu.started = true
+
+	warmers := make([]*warmer, 0, len(n.wu.names))
+	for _, name := range n.wu.names {
+		warmers = append(warmers, n.wu.warmers[name])
+	}
+	n.wu.m.Unlock()
+
+	timeout := util.EnvDurationWithDefault("WARMUP_TIMEOUT", 30*time.Second)
+	retry := util.EnvDurationWithDefault("WARMUP_RETRY_INTERVAL", 5*time.Second)
+
+	for _, w := range warmers {
+		go n.runWarmer(n.Context(), w, retry)
+	}
+
+	deadline := time.After(timeout)
+
+	var failed []string
+	for _, w := range warmers {
+		select {
+		case <-w.done:
+			continue
+		case <-deadline:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// Past the deadline, report the ones still pending without waiting
+		select {
+		case <-w.done:
+			continue
+		default:
+		}
+
+		n.wu.m.Lock()
+		s := w.state
+		n.wu.m.Unlock()
+
+		switch s.Policy {
+		case WarmupFailStart:
+			failed = append(failed, s.Name)
+		case WarmupFailClosed:
+			log.Printf("Warmup %s didn't load within %s, denying logins until it does: %s", s.Name, timeout, s.Error)
+		default:
+			log.Printf("Warmup %s didn't load within %s, accepting logins without it: %s", s.Name, timeout, s.Error)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("warmup of %s didn't load within %s", strings.Join(failed, ", "), timeout)
+	}
+
+	return nil
+}
+
+func (n *Hosting) runWarmer(ctx context.Context, w *warmer, retry time.Duration) {
+	start := time.Now()
+
+	for {
+		err := w.load(ctx)
+
+		n.wu.m.Lock()
+		w.state.Attempts++
+		if err == nil {
+			w.state.State = WarmupLoaded
+			w.state.Error = ""
+			w.state.Duration = time.Since(start).Round(time.Millisecond).String()
+		} else {
+			w.state.State = WarmupFailed
+			w.state.Error = err.Error()
+		}
+		name := w.state.Name
+		n.wu.m.Unlock()
+
+		if err == nil {
+			log.Printf("Warmup %s loaded in %s", name, time.Since(start).Round(time.Millisecond))
+			close(w.done)
+			return
+		}
+
+		log.Printf("Warmup %s failed, retrying in %s: %v", name, retry, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// WarmupBlocking returns the fail-closed warmups that haven't loaded yet.
+// Logins are denied while there are any.
+func (n *Hosting) WarmupBlocking() []string {
+	n.wu.m.Lock()
+	defer n.wu.m.Unlock()
+
+	var blocking []string
+	for _, name := range n.wu.names {
+		s := n.wu.warmers[name].state
+		if s.Policy == WarmupFailClosed && s.State != WarmupLoaded {
+			blocking = append(blocking, name)
+		}
+	}
+
+	return blocking
+}
+
+// WarmupStates returns the state of every registered warmup, sorted by name.
+func (n *Hosting) WarmupStates() []WarmupState {
+	n.wu.m.Lock()
+	defer n.wu.m.Unlock()
+
+	states := make([]WarmupState, 0, len(n.wu.names))
+	for _, name := range n.wu.names {
+		states = append(states, n.wu.warmers[name].state)
+	}
+
+	return states
+}
+
+func (n *Hosting) handleGetWarmup(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, n.WarmupStates())
+}
@@ -0,0 +1,126 @@
+package hosting
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+var (
+	watchdogCleanups = metrics.NewCounterVec("gate_watchdog_cleanups_total", "Leftovers the watchdog cleaned up, by kind.", "kind")
+	ghostPlayers     = metrics.NewCounterVec("gate_watchdog_ghost_players_total", "Players announced by dead proxies when the watchdog removed them.")
+)
+
+// watchdog cleans up what missed events leave behind until ctx is done.
+// Network blips can take a connection down without a disconnect event, and
+// a proxy that dies keeps its players announced, so counts drift otherwise.
+func (n *Hosting) watchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.watchSessions(now)
+			n.watchConnections(now)
+			n.watchProxies(ctx, now)
+		}
+	}
+}
+
+// watchSessions disconnects players that sent nothing for the session
+// timeout and forgets the connection quality of players that are gone.
+func (n *Hosting) watchSessions(now time.Time) {
+	prx := n.prx.Load()
+	if prx == nil {
+		return
+	}
+
+	online := make(map[uuid.UUID]bool)
+	for _, player := range prx.Players() {
+		online[player.ID()] = true
+
+		s, ok := n.qlt.Stats(player.ID(), now)
+		if !ok || n.sessionTimeout <= 0 {
+			continue
+		}
+
+		// Without a keep-alive response since the login there is no sample
+		idle := s.Stalled
+		if s.Ping == 0 && s.Stalled == 0 {
+			idle = s.Age
+		}
+
+		if idle > n.sessionTimeout {
+			log.Printf("Watchdog disconnecting %s, nothing received for %s", player.Username(), idle.Round(time.Second))
+
+			watchdogCleanups.Inc("session")
+			player.Disconnect(&component.Text{Content: "Your connection timed out, please reconnect."})
+		}
+	}
+
+	for _, s := range n.qlt.All(now) {
+		if !online[s.Player] {
+			n.qlt.Disconnect(s.Player)
+			watchdogCleanups.Inc("quality")
+		}
+	}
+}
+
+// watchConnections forgets connections that are stuck in the login phase
+// and those of players that are gone. Gate closes the connections itself,
+// only their entries are left.
+func (n *Hosting) watchConnections(now time.Time) {
+	prx := n.prx.Load()
+	if prx == nil {
+		return
+	}
+
+	online := make(map[string]bool)
+	for _, player := range prx.Players() {
+		online[player.RemoteAddr().String()] = true
+	}
+
+	n.conns.m.Lock()
+	defer n.conns.m.Unlock()
+
+	for addr, c := range n.conns.byAddr {
+		switch {
+		case !c.joined && n.loginTimeout > 0 && now.Sub(c.created) > n.loginTimeout:
+			log.Printf("Watchdog forgetting connection %s from %s, stuck logging in for %s", c.id, addr, now.Sub(c.created).Round(time.Second))
+			watchdogCleanups.Inc("login")
+		case c.joined && !online[addr]:
+			log.Printf("Watchdog forgetting connection %s from %s, the player is gone", c.id, addr)
+			watchdogCleanups.Inc("connection")
+		default:
+			continue
+		}
+
+		delete(n.conns.byAddr, addr)
+	}
+}
+
+// watchProxies removes the proxies that stopped heartbeating from the
+// cluster and cleans up what they owned. Every proxy does, so the cleanup
+// may run more than once.
+func (n *Hosting) watchProxies(ctx context.Context, now time.Time) {
+	dead, err := n.cls.Prune(ctx, now, n.proxyTimeout)
+	if err != nil {
+		log.Printf("Watchdog failed to prune dead proxies: %v", err)
+		return
+	}
+
+	for _, i := range dead {
+		log.Printf("Watchdog removed dead proxy %s, last seen %s with %d players", i.Name, i.Seen.Format(time.RFC3339), i.Players)
+
+		watchdogCleanups.Inc("proxy")
+		ghostPlayers.Add(int64(i.Players))
+		n.instanceDead(ctx, i.Name)
+	}
+}
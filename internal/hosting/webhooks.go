@@ -0,0 +1,115 @@
+package hosting
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/webhooks"
+)
+
+// Webhooks pushes events to external services, e.g.
+// h.Webhooks().Deliver("punishment.appeal", appeal). Every audit entry is
+// delivered as audit.<action>.
+func (n *Hosting) Webhooks() *webhooks.Webhooks {
+	return n.whk
+}
+
+// deliverAudit passes audit entries on to the webhooks subscribed to them.
+func (n *Hosting) deliverAudit(e audit.Entry) {
+	if err := n.whk.Deliver("audit."+e.Action, e); err != nil {
+		log.Printf("Failed to deliver audit entry %s to webhooks: %v", e.Action, err)
+	}
+}
+
+func (n *Hosting) SetWebhook(ctx context.Context, actor string, hook webhooks.Hook) (webhooks.Hook, error) {
+	if prev, ok := n.whk.Get(hook.ID); ok {
+		hook.Created = prev.Created
+		if hook.Secret == "" {
+			hook.Secret = prev.Secret
+		}
+	} else {
+		hook.Created = time.Now()
+	}
+	hook.Actor = actor
+
+	if err := n.whk.Set(ctx, hook); err != nil {
+		return webhooks.Hook{}, err
+	}
+
+	return hook, n.adt.Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "webhook.set",
+		Target:  hook.ID,
+		Details: map[string]string{"url": hook.URL, "events": strings.Join(hook.Events, ",")},
+	})
+}
+
+func (n *Hosting) DeleteWebhook(ctx context.Context, actor, id string) error {
+	if err := n.whk.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	return n.adt.Record(ctx, audit.Entry{Actor: actor, Action: "webhook.delete", Target: id})
+}
+
+func (n *Hosting) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks := n.whk.List()
+	for i := range hooks {
+		hooks[i] = hooks[i].Redacted()
+	}
+
+	api.WriteJSON(w, http.StatusOK, hooks)
+}
+
+func (n *Hosting) handleSetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := webhooks.Hook{}
+	if err := api.ReadJSON(r, &hook); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hook.ID = r.PathValue("id")
+
+	if err := hook.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hook, err := n.SetWebhook(r.Context(), "api", hook)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, hook.Redacted())
+}
+
+func (n *Hosting) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := n.DeleteWebhook(r.Context(), "api", r.PathValue("id")); errors.Is(err, webhooks.ErrHookNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Hosting) handlePingWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := n.whk.Ping(r.PathValue("id")); errors.Is(err, webhooks.ErrHookNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,450 @@
+// Package webhooks pushes events of the network to external services. Hooks
+// subscribe a URL to event types and live in KV, deliveries are signed with
+// the hook's secret and retried with backoff until they succeed or run out of
+// attempts.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+var (
+	ErrHookNotFound = errors.New("webhook not found")
+
+	deliveriesTotal  = metrics.NewCounterVec("gate_webhook_deliveries_total", "Webhook delivery attempts by hook and what happened to them.", "hook", "result")
+	deliverySeconds  = metrics.NewHistogramVec("gate_webhook_delivery_seconds", "Duration of webhook delivery attempts.", []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "hook")
+	deliveriesQueued = metrics.NewGaugeVec("gate_webhook_deliveries_queued", "Webhook deliveries waiting for an attempt.")
+)
+
+// Hook delivers the events it subscribes to to a URL.
+type Hook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the deliveries, see Sign
+	Secret string `json:"secret,omitempty"`
+	// Events are the event types, a trailing * matches every type with
+	// the prefix, e.g. audit.punishment.*
+	Events   []string  `json:"events"`
+	Disabled bool      `json:"disabled,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+func (h Hook) Validate() error {
+	if h.ID == "" || strings.ContainsAny(h.ID, ". *>") {
+		return errors.New("webhook id is required and must not contain dots, spaces or wildcards")
+	}
+
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+
+	if len(h.Events) == 0 {
+		return errors.New("at least one event is required")
+	}
+
+	return nil
+}
+
+// Matches reports whether the hook subscribes to the event type.
+func (h Hook) Matches(event string) bool {
+	if h.Disabled {
+		return false
+	}
+
+	return slices.ContainsFunc(h.Events, func(e string) bool {
+		if prefix, ok := strings.CutSuffix(e, "*"); ok {
+			return strings.HasPrefix(event, prefix)
+		}
+
+		return e == event
+	})
+}
+
+// Redacted is the hook without its secret, for listing.
+func (h Hook) Redacted() Hook {
+	if h.Secret != "" {
+		h.Secret = "redacted"
+	}
+
+	return h
+}
+
+// Delivery is the body POSTed to the URL.
+type Delivery struct {
+	ID    string          `json:"id"`
+	Event string          `json:"event"`
+	Time  time.Time       `json:"time"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Sign returns the signature of a delivery, the hex HMAC-SHA256 of the
+// timestamp, a dot and the body. It is sent as X-Webhook-Signature:
+// sha256=<signature> next to X-Webhook-Timestamp, so receivers can reject
+// replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type Options struct {
+	// Attempts a delivery gets before it is dropped
+	Attempts int
+	// Backoff is the wait after the first failed attempt, doubled after
+	// every further one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Timeout    time.Duration
+	// Workers deliver concurrently
+	Workers int
+	// Queue is how many deliveries may wait, further ones are dropped
+	Queue int
+}
+
+type job struct {
+	hook     string
+	delivery Delivery
+	body     []byte
+	attempt  int
+}
+
+// Webhooks keeps the hooks of a bucket in memory and delivers to them.
+type Webhooks struct {
+	kv     kv.Bucket
+	opts   Options
+	client *http.Client
+	queue  chan job
+
+	hooks map[string]Hook
+	m     sync.RWMutex
+}
+
+func New(ctx context.Context, bucket kv.Bucket, opts Options) (*Webhooks, error) {
+	w := &Webhooks{
+		kv:     bucket,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		queue:  make(chan job, max(opts.Queue, 1)),
+		hooks:  make(map[string]Hook),
+	}
+
+	if err := w.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Webhooks) Reload(ctx context.Context) error {
+	keys, err := w.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	hooks := make(map[string]Hook, len(keys))
+	for _, key := range keys {
+		raw, err := w.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		hook := Hook{}
+		if err := json.Unmarshal(raw, &hook); err != nil {
+			log.Printf("Failed to unmarshal webhook %s: %v", key, err)
+			continue
+		}
+
+		hooks[key] = hook
+	}
+
+	w.m.Lock()
+	w.hooks = hooks
+	w.m.Unlock()
+
+	return nil
+}
+
+// Watch keeps the hooks in sync with the bucket until ctx is done.
+func (w *Webhooks) Watch(ctx context.Context) {
+	kv.Watch(ctx, w.kv, w.handleChange, w.Reload)
+}
+
+func (w *Webhooks) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		hook := Hook{}
+		if err := json.Unmarshal(v.Value, &hook); err != nil {
+			log.Printf("Failed to unmarshal webhook %s: %v", v.Key, err)
+			return
+		}
+
+		w.hooks[v.Key] = hook
+
+	case kv.Delete:
+		delete(w.hooks, v.Key)
+	}
+}
+
+func (w *Webhooks) List() []Hook {
+	w.m.RLock()
+	defer w.m.RUnlock()
+
+	list := make([]Hook, 0, len(w.hooks))
+	for _, hook := range w.hooks {
+		list = append(list, hook)
+	}
+
+	slices.SortFunc(list, func(a, b Hook) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return list
+}
+
+func (w *Webhooks) Get(id string) (Hook, bool) {
+	w.m.RLock()
+	defer w.m.RUnlock()
+
+	hook, ok := w.hooks[id]
+	return hook, ok
+}
+
+func (w *Webhooks) Set(ctx context.Context, hook Hook) error {
+	if err := hook.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	if err := w.kv.Set(ctx, hook.ID, raw); err != nil {
+		return err
+	}
+
+	w.m.Lock()
+	w.hooks[hook.ID] = hook
+	w.m.Unlock()
+
+	return nil
+}
+
+func (w *Webhooks) Delete(ctx context.Context, id string) error {
+	if err := w.kv.Delete(ctx, id); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrHookNotFound
+	} else if err != nil {
+		return err
+	}
+
+	w.m.Lock()
+	delete(w.hooks, id)
+	w.m.Unlock()
+
+	return nil
+}
+
+// Deliver queues the event for every hook that subscribes to it. data is
+// marshalled to JSON once, a failed delivery to one hook doesn't hold up the
+// others.
+func (w *Webhooks) Deliver(event string, data any) error {
+	w.m.RLock()
+	hooks := make([]string, 0)
+	for id, hook := range w.hooks {
+		if hook.Matches(event) {
+			hooks = append(hooks, id)
+		}
+	}
+	w.m.RUnlock()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range hooks {
+		if err := w.queueFor(id, event, raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ping queues a ping event for the hook whatever it subscribes to, to test
+// that the receiver gets and verifies deliveries.
+func (w *Webhooks) Ping(id string) error {
+	if _, ok := w.Get(id); !ok {
+		return ErrHookNotFound
+	}
+
+	return w.queueFor(id, "ping", json.RawMessage("{}"))
+}
+
+func (w *Webhooks) queueFor(hook, event string, data json.RawMessage) error {
+	d := Delivery{ID: newID(), Event: event, Time: time.Now(), Data: data}
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	w.enqueue(job{hook: hook, delivery: d, body: body, attempt: 1})
+	return nil
+}
+
+func (w *Webhooks) enqueue(j job) {
+	select {
+	case w.queue <- j:
+		deliveriesQueued.Add(1)
+	default:
+		deliveriesTotal.Inc(j.hook, "dropped")
+		log.Printf("Dropped webhook delivery %s of %s to %s, the queue is full", j.delivery.ID, j.delivery.Event, j.hook)
+	}
+}
+
+// Run delivers queued events until ctx is done.
+func (w *Webhooks) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for range max(w.opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *Webhooks) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-w.queue:
+			deliveriesQueued.Add(-1)
+			w.attempt(ctx, j)
+		}
+	}
+}
+
+func (w *Webhooks) attempt(ctx context.Context, j job) {
+	hook, ok := w.Get(j.hook)
+	if !ok || hook.Disabled {
+		// Removed or disabled since the event was queued
+		return
+	}
+
+	start := time.Now()
+	retry, err := w.send(ctx, hook, j)
+	deliverySeconds.Observe(time.Since(start).Seconds(), j.hook)
+
+	if err == nil {
+		deliveriesTotal.Inc(j.hook, "delivered")
+		return
+	}
+
+	if !retry || j.attempt >= w.opts.Attempts {
+		deliveriesTotal.Inc(j.hook, "failed")
+		log.Printf("Failed to deliver webhook %s of %s to %s after %d attempts: %v", j.delivery.ID, j.delivery.Event, j.hook, j.attempt, err)
+		return
+	}
+
+	deliveriesTotal.Inc(j.hook, "retried")
+
+	wait := w.backoff(j.attempt)
+	j.attempt++
+	time.AfterFunc(wait, func() {
+		if ctx.Err() == nil {
+			w.enqueue(j)
+		}
+	})
+}
+
+func (w *Webhooks) backoff(attempt int) time.Duration {
+	wait := w.opts.Backoff
+	for i := 1; i < attempt && wait < w.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, w.opts.MaxBackoff)
+}
+
+// send reports whether a failed delivery is worth retrying. Requests the
+// receiver rejects won't be accepted the next time either, except when it
+// was busy.
+func (w *Webhooks) send(ctx context.Context, hook Hook, j job) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", j.delivery.ID)
+	req.Header.Set("X-Webhook-Event", j.delivery.Event)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(j.attempt))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+Sign(hook.Secret, timestamp, j.body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("webhook responded with %s", res.Status)
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newWebhooks(t *testing.T) *Webhooks {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(context.Background(), bucket, Options{
+		Attempts:   3,
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		Timeout:    time.Second,
+		Workers:    1,
+		Queue:      16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func TestMatches(t *testing.T) {
+	hook := Hook{Events: []string{"audit.punishment.*", "incident"}}
+
+	for event, want := range map[string]bool{
+		"audit.punishment.ban": true,
+		"audit.flag.set":       false,
+		"incident":             true,
+		"incident.bundle":      false,
+	} {
+		if got := hook.Matches(event); got != want {
+			t.Fatalf("expected %s to match %t, got %t", event, want, got)
+		}
+	}
+
+	hook.Disabled = true
+	if hook.Matches("incident") {
+		t.Fatal("expected a disabled hook to match nothing")
+	}
+}
+
+func TestDeliverSignsAndRetries(t *testing.T) {
+	attempts := atomic.Int32{}
+	delivered := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 2 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		delivered <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	w := newWebhooks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	if err := w.Set(ctx, Hook{ID: "website", URL: srv.URL, Secret: "s3cret", Events: []string{"audit.*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Deliver("audit.flag.set", map[string]string{"target": "new-queue"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-delivered:
+		body := <-bodies
+
+		if r.Header.Get("X-Webhook-Attempt") != "2" {
+			t.Fatalf("expected the second attempt to succeed, got %s", r.Header.Get("X-Webhook-Attempt"))
+		}
+
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+Sign("s3cret", r.Header.Get("X-Webhook-Timestamp"), body) {
+			t.Fatal("expected a valid signature")
+		}
+
+		d := Delivery{}
+		if err := json.Unmarshal(body, &d); err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Event != "audit.flag.set" || string(d.Data) != `{"target":"new-queue"}` {
+			t.Fatalf("unexpected delivery %+v", d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the delivery to be retried")
+	}
+}
+
+func TestRejectedIsNotRetried(t *testing.T) {
+	attempts := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := newWebhooks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	if err := w.Set(ctx, Hook{ID: "website", URL: srv.URL, Events: []string{"*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Deliver("incident", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("expected 1 attempt, got %d", n)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	w := &Webhooks{opts: Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := w.backoff(attempt); got != want {
+			t.Fatalf("expected a backoff of %s after attempt %d, got %s", want, attempt, got)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package console
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errNotTerminal
+}
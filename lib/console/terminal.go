@@ -0,0 +1,238 @@
+// Package console is a small line editor for the proxy console with history
+// and tab completion. When the input is not a terminal it falls back to
+// reading plain lines.
+package console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var errNotTerminal = errors.New("not a terminal")
+
+const maxHistory = 500
+
+type Terminal struct {
+	in     *bufio.Reader
+	out    io.Writer
+	prompt string
+	// Complete returns the candidates for the word at the end of line.
+	Complete func(line string) []string
+
+	raw     bool
+	restore func() error
+	history []string
+}
+
+// New puts fd into raw mode if it is a terminal. Close restores it.
+func New(in *os.File, out io.Writer, prompt string) *Terminal {
+	t := &Terminal{in: bufio.NewReader(in), out: out, prompt: prompt}
+
+	restore, err := makeRaw(int(in.Fd()))
+	if err == nil {
+		t.raw = true
+		t.restore = restore
+	}
+
+	return t
+}
+
+// NewPlain reads plain lines from r, e.g. a socket connection.
+func NewPlain(r io.Reader, out io.Writer, prompt string) *Terminal {
+	return &Terminal{in: bufio.NewReader(r), out: out, prompt: prompt}
+}
+
+func (t *Terminal) Close() error {
+	if t.restore != nil {
+		return t.restore()
+	}
+
+	return nil
+}
+
+// ReadLine returns io.EOF once the input is closed or Ctrl-D is pressed on an
+// empty line.
+func (t *Terminal) ReadLine() (string, error) {
+	fmt.Fprint(t.out, t.prompt)
+
+	if !t.raw {
+		line, err := t.in.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	line := []rune{}
+	pos := 0
+	hist := len(t.history)
+
+	redraw := func() {
+		fmt.Fprintf(t.out, "\r\x1b[K%s%s", t.prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(t.out, "\x1b[%dD", back)
+		}
+	}
+
+	for {
+		r, _, err := t.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(t.out, "\r\n")
+			s := string(line)
+			t.remember(s)
+			return s, nil
+
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(t.out, "\r\n")
+				return "", io.EOF
+			}
+
+		case 127, 8: // Backspace
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+				redraw()
+			}
+
+		case '\t':
+			line, pos = t.complete(line, pos)
+			redraw()
+
+		case 27: // Escape sequence
+			seq := t.readEscape()
+			switch seq {
+			case "[A": // Up
+				if hist > 0 {
+					hist--
+					line = []rune(t.history[hist])
+					pos = len(line)
+					redraw()
+				}
+			case "[B": // Down
+				if hist < len(t.history) {
+					hist++
+					line = line[:0]
+					if hist < len(t.history) {
+						line = []rune(t.history[hist])
+					}
+					pos = len(line)
+					redraw()
+				}
+			case "[C": // Right
+				if pos < len(line) {
+					pos++
+					redraw()
+				}
+			case "[D": // Left
+				if pos > 0 {
+					pos--
+					redraw()
+				}
+			case "[H", "OH":
+				pos = 0
+				redraw()
+			case "[F", "OF":
+				pos = len(line)
+				redraw()
+			}
+
+		default:
+			if r < 32 || r == utf8.RuneError {
+				continue
+			}
+
+			line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+			pos++
+			redraw()
+		}
+	}
+}
+
+func (t *Terminal) readEscape() string {
+	seq := strings.Builder{}
+
+	for i := 0; i < 4; i++ {
+		r, _, err := t.in.ReadRune()
+		if err != nil {
+			break
+		}
+
+		seq.WriteRune(r)
+		// Sequences end with a letter or ~
+		if i > 0 && (r == '~' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')) {
+			break
+		}
+	}
+
+	return seq.String()
+}
+
+func (t *Terminal) remember(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if n := len(t.history); n > 0 && t.history[n-1] == line {
+		return
+	}
+
+	t.history = append(t.history, line)
+	if len(t.history) > maxHistory {
+		t.history = t.history[1:]
+	}
+}
+
+// complete only looks at the text before the cursor. A single candidate
+// replaces the last word, several are listed and their common prefix is
+// filled in.
+func (t *Terminal) complete(line []rune, pos int) ([]rune, int) {
+	if t.Complete == nil {
+		return line, pos
+	}
+
+	before := string(line[:pos])
+	candidates := t.Complete(before)
+	if len(candidates) == 0 {
+		return line, pos
+	}
+
+	start := strings.LastIndex(before, " ") + 1
+	word := before[start:]
+
+	replacement := candidates[0]
+	if len(candidates) > 1 {
+		fmt.Fprintf(t.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		replacement = commonPrefix(candidates)
+		if len(replacement) < len(word) {
+			return line, pos
+		}
+	} else {
+		replacement += " "
+	}
+
+	head := []rune(before[:start] + replacement)
+	return append(head, line[pos:]...), len(head)
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,345 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"time"
+)
+
+var ErrEncryption = errors.New("encryption requested, the player isn't allowed to join offline")
+
+// DisconnectError is returned when the other side disconnects the client.
+type DisconnectError struct {
+	// Reason is the plain text of the reason, see Text.
+	Reason string
+}
+
+func (e *DisconnectError) Error() string {
+	return "disconnected: " + e.Reason
+}
+
+type Options struct {
+	// Host and Port are sent in the handshake, they default to the address
+	// dialed.
+	Host string
+	Port uint16
+	// ProxyProtocol sends a PROXY protocol v1 header first.
+	ProxyProtocol bool
+	// Timeout limits dialing and the login, 0 is no limit.
+	Timeout time.Duration
+	// OnChat is called with the data of every chat packet the client
+	// receives, on the goroutine reading the connection.
+	OnChat func(data []byte)
+}
+
+func dial(ctx context.Context, addr string, opts *Options) (*Conn, error) {
+	d := net.Dialer{Timeout: opts.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ProxyProtocol {
+		if _, err := io.WriteString(nc, ProxyHeader(nc)); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	if opts.Host == "" {
+		host, port, _ := net.SplitHostPort(addr)
+		p, _ := strconv.ParseUint(port, 10, 16)
+		opts.Host, opts.Port = host, uint16(p)
+	}
+
+	return NewConn(nc), nil
+}
+
+// Ping runs a status ping and returns the status JSON.
+func Ping(ctx context.Context, addr string, opts Options) (string, error) {
+	c, err := dial(ctx, addr, &opts)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	if opts.Timeout > 0 {
+		_ = c.c.SetDeadline(time.Now().Add(opts.Timeout))
+	}
+
+	if err := c.Handshake(opts.Host, opts.Port, 1); err != nil {
+		return "", err
+	}
+
+	if err := c.Write(StatusRequest, nil); err != nil {
+		return "", err
+	}
+
+	id, r, err := c.Read()
+	if err != nil {
+		return "", err
+	} else if id != StatusResponse {
+		return "", fmt.Errorf("unexpected status packet 0x%02X", id)
+	}
+
+	status, err := ReadString(r)
+	if err != nil {
+		return "", err
+	}
+
+	payload := binary.BigEndian.AppendUint64(nil, rand.Uint64())
+	if err := c.Write(StatusPing, payload); err != nil {
+		return "", err
+	}
+
+	if id, r, err = c.Read(); err != nil {
+		return "", err
+	}
+
+	if id != StatusPing || !bytes.Equal(Rest(r), payload) {
+		return "", errors.New("invalid pong")
+	}
+
+	return status, nil
+}
+
+// Client is an offline player. It answers keep-alives, pings, cookie and
+// resource pack requests on its own and follows the switches between
+// configuration and play.
+type Client struct {
+	Name string
+
+	c      *Conn
+	onChat func(data []byte)
+	joined chan struct{}
+	done   chan struct{}
+	err    error
+}
+
+// Connect logs in as name and returns once the login succeeded, the client
+// then joins a server in the background.
+func Connect(ctx context.Context, addr, name string, opts Options) (*Client, error) {
+	c, err := dial(ctx, addr, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cl := &Client{Name: name, c: c, onChat: opts.OnChat, joined: make(chan struct{}, 1), done: make(chan struct{})}
+
+	if opts.Timeout > 0 {
+		_ = c.c.SetDeadline(time.Now().Add(opts.Timeout))
+	}
+
+	if err := cl.login(opts.Host, opts.Port); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	_ = c.c.SetDeadline(time.Time{})
+
+	go func() {
+		cl.err = cl.read()
+		close(cl.done)
+	}()
+
+	return cl, nil
+}
+
+func (c *Client) login(host string, port uint16) error {
+	if err := c.c.Handshake(host, port, 2); err != nil {
+		return err
+	}
+
+	id := OfflineUUID(c.Name)
+	if err := c.c.Write(LoginStart, append(AppendString(nil, c.Name), id[:]...)); err != nil {
+		return err
+	}
+
+	for {
+		id, r, err := c.c.Read()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case LoginDisconnect:
+			reason, _ := ReadString(r)
+			return &DisconnectError{Reason: reason}
+		case LoginEncryption:
+			return ErrEncryption
+		case LoginCompression:
+			threshold, err := ReadVarInt(r)
+			if err != nil {
+				return err
+			}
+
+			c.c.SetThreshold(threshold)
+		case LoginPluginRequest:
+			msg, err := ReadVarInt(r)
+			if err != nil {
+				return err
+			}
+
+			if err := c.c.Write(LoginPluginResponse, append(AppendVarInt(nil, msg), 0)); err != nil {
+				return err
+			}
+		case LoginCookieRequest:
+			if err := c.cookie(r, LoginCookieResponse); err != nil {
+				return err
+			}
+		case LoginSuccess:
+			return c.c.Write(LoginAcknowledged, nil)
+		}
+	}
+}
+
+// Joined receives every join of a server, one at a time. Joins nobody waits
+// for are dropped.
+func (c *Client) Joined() <-chan struct{} {
+	return c.joined
+}
+
+// Done is closed when the connection ended, Err returns why.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) Err() error {
+	<-c.done
+
+	return c.err
+}
+
+// WaitJoin waits for the next join of a server.
+func (c *Client) WaitJoin(timeout time.Duration) error {
+	select {
+	case <-c.joined:
+		return nil
+	case <-c.done:
+		return c.err
+	case <-time.After(timeout):
+		return errors.New("timed out joining a server")
+	}
+}
+
+// DropJoin forgets a join nobody waited for, e.g. before switching.
+func (c *Client) DropJoin() {
+	select {
+	case <-c.joined:
+	default:
+	}
+}
+
+func (c *Client) Close() error {
+	err := c.c.Close()
+	<-c.done
+
+	return err
+}
+
+func (c *Client) read() error {
+	play := false
+
+	for {
+		id, r, err := c.c.Read()
+		if err != nil {
+			return err
+		}
+
+		if !play {
+			switch id {
+			case ConfigDisconnect:
+				return &DisconnectError{Reason: Text(Rest(r))}
+			case ConfigFinish:
+				play = true
+				err = c.c.Write(ConfigFinishAck, nil)
+			case ConfigKeepAlive:
+				err = c.c.Write(ConfigKeepAliveReply, Rest(r))
+			case ConfigPing:
+				err = c.c.Write(ConfigPong, Rest(r))
+			case ConfigKnownPacks:
+				err = c.c.Write(ConfigKnownPacksReply, AppendVarInt(nil, 0))
+			case ConfigCookieRequest:
+				err = c.cookie(r, ConfigCookieResponse)
+			case ConfigResourcePack:
+				err = c.resourcePack(r, ConfigResourcePackAck)
+			}
+		} else {
+			switch id {
+			case PlayDisconnect:
+				return &DisconnectError{Reason: Text(Rest(r))}
+			case PlayLogin:
+				select {
+				case c.joined <- struct{}{}:
+				default:
+				}
+			case PlayStartConfig:
+				play = false
+				err = c.c.Write(PlayStartConfigAck, nil)
+			case PlayKeepAlive:
+				err = c.c.Write(PlayKeepAliveReply, Rest(r))
+			case PlayPing:
+				err = c.c.Write(PlayPong, Rest(r))
+			case PlayResourcePack:
+				err = c.resourcePack(r, PlayResourcePackAck)
+			case PlayPlayerChat, PlaySystemChat:
+				if c.onChat != nil {
+					c.onChat(Rest(r))
+				}
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) cookie(r *bytes.Reader, reply int) error {
+	key, err := ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	return c.c.Write(reply, append(AppendString(nil, key), 0))
+}
+
+// resourcePack accepts and "loads" every pack, skipping the download.
+func (c *Client) resourcePack(r *bytes.Reader, reply int) error {
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(r, id); err != nil {
+		return err
+	}
+
+	if err := c.c.Write(reply, AppendVarInt(id, 3)); err != nil {
+		return err
+	}
+
+	return c.c.Write(reply, AppendVarInt(id, 0))
+}
+
+// Chat sends an unsigned chat message.
+func (c *Client) Chat(text string) error {
+	data := AppendString(nil, text)
+	data = binary.BigEndian.AppendUint64(data, uint64(time.Now().UnixMilli()))
+	data = binary.BigEndian.AppendUint64(data, rand.Uint64())
+	// No signature, no acknowledged messages
+	data = append(data, 0)
+	data = AppendVarInt(data, 0)
+	data = append(data, 0, 0, 0)
+
+	return c.c.Write(PlayChatMessage, data)
+}
+
+// Command sends a command without the leading slash. Chat and Command may
+// be called from any goroutine.
+func (c *Client) Command(command string) error {
+	return c.c.Write(PlayChatCommand, AppendString(nil, command))
+}
@@ -0,0 +1,143 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// maxFrame is the largest frame vanilla accepts.
+const maxFrame = 1 << 21
+
+// Conn frames packets, compressed once a threshold is set. Writes may come
+// from several goroutines, reads only from one.
+type Conn struct {
+	c         net.Conn
+	r         *bufio.Reader
+	threshold int
+	m         sync.Mutex
+}
+
+func NewConn(c net.Conn) *Conn {
+	return &Conn{c: c, r: bufio.NewReader(c), threshold: -1}
+}
+
+func (c *Conn) NetConn() net.Conn {
+	return c.c
+}
+
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+// SetThreshold turns on compression for packets of at least n bytes, like
+// the login packet that announces it. It must not race with Write.
+func (c *Conn) SetThreshold(n int) {
+	c.threshold = n
+}
+
+func (c *Conn) Write(id int, data []byte) error {
+	body := append(AppendVarInt(nil, id), data...)
+
+	if c.threshold >= 0 {
+		if len(body) < c.threshold {
+			body = append([]byte{0}, body...)
+		} else {
+			buf := bytes.Buffer{}
+			w := zlib.NewWriter(&buf)
+			if _, err := w.Write(body); err != nil {
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+
+			body = append(AppendVarInt(nil, len(body)), buf.Bytes()...)
+		}
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	_, err := c.c.Write(append(AppendVarInt(nil, len(body)), body...))
+
+	return err
+}
+
+// Read returns the ID of the next packet and a reader of its data.
+func (c *Conn) Read() (int, *bytes.Reader, error) {
+	n, err := ReadVarInt(c.r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if n <= 0 || n > maxFrame {
+		return 0, nil, fmt.Errorf("invalid frame length %d", n)
+	}
+
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(c.r, frame); err != nil {
+		return 0, nil, err
+	}
+
+	r := bytes.NewReader(frame)
+	if c.threshold >= 0 {
+		size, err := ReadVarInt(r)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if size > maxFrame {
+			return 0, nil, fmt.Errorf("invalid packet length %d", size)
+		}
+
+		if size > 0 {
+			zr, err := zlib.NewReader(r)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			data := make([]byte, size)
+			if _, err := io.ReadFull(zr, data); err != nil {
+				return 0, nil, err
+			}
+
+			r = bytes.NewReader(data)
+		}
+	}
+
+	id, err := ReadVarInt(r)
+
+	return id, r, err
+}
+
+// Handshake starts a connection, next is 1 for status and 2 for login.
+func (c *Conn) Handshake(host string, port uint16, next int) error {
+	data := AppendVarInt(nil, Version)
+	data = AppendString(data, host)
+	data = binary.BigEndian.AppendUint16(data, port)
+
+	return c.Write(Handshake, AppendVarInt(data, next))
+}
+
+// ProxyHeader is a PROXY protocol v1 header for c, for listeners that
+// require one.
+func ProxyHeader(c net.Conn) string {
+	local, _ := c.LocalAddr().(*net.TCPAddr)
+	remote, _ := c.RemoteAddr().(*net.TCPAddr)
+	if local == nil || remote == nil {
+		return "PROXY UNKNOWN\r\n"
+	}
+
+	family := "TCP4"
+	if local.IP.To4() == nil {
+		family = "TCP6"
+	}
+
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, local.IP, remote.IP, local.Port, remote.Port)
+}
@@ -0,0 +1,159 @@
+// Package protocol speaks just enough of the Minecraft 1.21 protocol
+// (767) to join a proxy or server as an offline player and to pretend to be
+// a server, for load tests and end-to-end tests. Packets are framed and
+// compressed, but never encrypted.
+package protocol
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version is the only protocol version spoken.
+const Version = 767
+
+// Packet IDs, named after the state, direction and packet. Serverbound
+// packets are sent by the client.
+const (
+	Handshake = 0x00
+
+	StatusRequest  = 0x00
+	StatusResponse = 0x00
+	StatusPing     = 0x01
+
+	LoginStart          = 0x00
+	LoginDisconnect     = 0x00
+	LoginEncryption     = 0x01
+	LoginSuccess        = 0x02
+	LoginCompression    = 0x03
+	LoginPluginRequest  = 0x04
+	LoginCookieRequest  = 0x05
+	LoginPluginResponse = 0x02
+	LoginAcknowledged   = 0x03
+	LoginCookieResponse = 0x04
+
+	ConfigCookieRequest   = 0x00
+	ConfigDisconnect      = 0x02
+	ConfigFinish          = 0x03
+	ConfigKeepAlive       = 0x04
+	ConfigPing            = 0x05
+	ConfigResourcePack    = 0x09
+	ConfigKnownPacks      = 0x0E
+	ConfigCookieResponse  = 0x01
+	ConfigFinishAck       = 0x03
+	ConfigKeepAliveReply  = 0x04
+	ConfigPong            = 0x05
+	ConfigResourcePackAck = 0x06
+	ConfigKnownPacksReply = 0x07
+
+	PlayDisconnect      = 0x1D
+	PlayKeepAlive       = 0x26
+	PlayLogin           = 0x2B
+	PlayPing            = 0x35
+	PlayPlayerChat      = 0x39
+	PlayResourcePack    = 0x46
+	PlayStartConfig     = 0x69
+	PlaySystemChat      = 0x6C
+	PlayChatCommand     = 0x04
+	PlayChatMessage     = 0x06
+	PlayStartConfigAck  = 0x0C
+	PlayKeepAliveReply  = 0x18
+	PlayPong            = 0x27
+	PlayResourcePackAck = 0x2B
+)
+
+func AppendVarInt(b []byte, v int) []byte {
+	u := uint32(v)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+
+	return append(b, byte(u))
+}
+
+func AppendString(b []byte, s string) []byte {
+	return append(AppendVarInt(b, len(s)), s...)
+}
+
+// AppendText appends s as a text component in network NBT, a bare string
+// tag, as used by disconnect and chat packets since 1.20.3.
+func AppendText(b []byte, s string) []byte {
+	b = append(b, 0x08, byte(len(s)>>8), byte(len(s)))
+
+	return append(b, s...)
+}
+
+func ReadVarInt(r io.ByteReader) (int, error) {
+	v := uint32(0)
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		v |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int(int32(v)), nil
+		}
+	}
+
+	return 0, errors.New("varint too long")
+}
+
+func ReadString(r *bytes.Reader) (string, error) {
+	n, err := ReadVarInt(r)
+	if err != nil {
+		return "", err
+	}
+
+	if n < 0 || n > r.Len() {
+		return "", fmt.Errorf("invalid string length %d", n)
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+
+	return string(b), err
+}
+
+// Rest returns what is left of a packet.
+func Rest(r *bytes.Reader) []byte {
+	b, _ := io.ReadAll(r)
+
+	return b
+}
+
+// Text returns the printable runs of an NBT text component joined by
+// spaces. That includes the tag names, but is enough to match on.
+func Text(data []byte) string {
+	var runs [][]byte
+
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		printable := i < len(data) && data[i] >= 0x20 && data[i] < 0x7F
+		if printable && start < 0 {
+			start = i
+		} else if !printable && start >= 0 {
+			if i-start >= 2 {
+				runs = append(runs, data[start:i])
+			}
+			start = -1
+		}
+	}
+
+	return string(bytes.Join(runs, []byte(" ")))
+}
+
+// OfflineUUID is the UUID of an offline player, like Java's
+// UUID.nameUUIDFromBytes of "OfflinePlayer:<name>".
+func OfflineUUID(name string) [16]byte {
+	id := md5.Sum([]byte("OfflinePlayer:" + name))
+	id[6] = id[6]&0x0F | 0x30
+	id[8] = id[8]&0x3F | 0x80
+
+	return id
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// codeAlphabet leaves out characters that are easily confused when typed by hand.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// RandomCode returns a cryptographically random, human friendly code.
+func RandomCode(length int) (string, error) {
+	buf := make([]byte, length)
+	max := big.NewInt(int64(len(codeAlphabet)))
+
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+
+		buf[i] = codeAlphabet[n.Int64()]
+	}
+
+	return string(buf), nil
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+func EnvWithDefault(key, def string) string {
+	v, exists := os.LookupEnv(key)
+	if !exists {
+		return def
+	}
+
+	return v
+}
+
+func EnvBoolWithDefault(key string, def bool) bool {
+	raw, exists := os.LookupEnv(key)
+	if !exists {
+		return def
+	}
+
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return v
+}
+
+func EnvDurationWithDefault(key string, def time.Duration) time.Duration {
+	raw, exists := os.LookupEnv(key)
+	if !exists {
+		return def
+	}
+
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return v
+}
+
+func EnvIntWithDefault(key string, def int) int {
+	raw, exists := os.LookupEnv(key)
+	if !exists {
+		return def
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return v
+}
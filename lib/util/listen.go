@@ -0,0 +1,71 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor passed by systemd socket
+// activation.
+const systemdFirstFD = 3
+
+// Listen opens a listener for addr, which is either a TCP address like
+// ":8080", "unix:<path>" for a unix socket only accessible to the proxy's
+// user, or "systemd" / "systemd:<name>" for a socket passed by systemd
+// socket activation, picked by its FileDescriptorName.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// A socket left behind by a previous run would make Listen fail
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.Chmod(path, 0o600); err != nil {
+			l.Close()
+			return nil, err
+		}
+
+		return l, nil
+	}
+
+	if addr == "systemd" || strings.HasPrefix(addr, "systemd:") {
+		return systemdListener(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":"))
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+func systemdListener(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets were passed by systemd")
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("no sockets were passed by systemd")
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := range count {
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+
+		f := os.NewFile(uintptr(systemdFirstFD+i), name)
+		defer f.Close()
+
+		return net.FileListener(f)
+	}
+
+	return nil, fmt.Errorf("systemd passed no socket named %q", name)
+}
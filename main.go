@@ -3,56 +3,51 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/dev"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bossbar"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/core"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/fallback"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/motd"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/resourcepack"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/tab"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/whitelist"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins"
 
 	"go.minekube.com/gate/cmd/gate"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 )
 
-type PluginCreator = func(h *hosting.Hosting) (proxy.Plugin, error)
-
 func main() {
+	var d *dev.Dev
+	if len(os.Args) > 1 && os.Args[1] == "dev" {
+		var args []string
+		var err error
+		if d, args, err = dev.Setup(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		defer d.Close()
+
+		os.Args = append(os.Args[:1], args...)
+	}
+
 	h, err := hosting.Init()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	perms, err := permissions.NewKVPermissions(context.Background(), h)
-	if err != nil {
-		log.Fatal(err)
+	if d != nil {
+		if err := d.Seed(context.Background(), h); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	var plugins = []PluginCreator{
-		core.New,
-		fallback.New,
-		func(_ *hosting.Hosting) (proxy.Plugin, error) {
-			return permissions.New(perms)
-		},
-		func(h *hosting.Hosting) (proxy.Plugin, error) {
-			return whitelist.New(h, perms)
-		},
-		motd.New,
-		tab.New,
-		bossbar.New,
-		resourcepack.New,
+	ps, err := plugins.All(h)
+	if err != nil {
+		log.Fatal(err)
 	}
+	proxy.Plugins = append(proxy.Plugins, ps...)
 
-	for _, create := range plugins {
-		p, err := create(h)
-		if err != nil {
+	go func() {
+		if err := h.API().ListenAndServe(); err != nil {
 			log.Fatal(err)
 		}
-		proxy.Plugins = append(proxy.Plugins, p)
-	}
+	}()
 
 	gate.Execute()
 }
@@ -0,0 +1,139 @@
+// Package analytics publishes joins, quits, server switches, kicks and chat
+// metadata to the analytics subject, see the analytics package for the
+// schema.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/analytics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/component/codec/legacy"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type Plugin struct {
+	h   *hosting.Hosting
+	pub *analytics.Publisher
+
+	// joined holds when the players on this proxy joined
+	joined map[string]time.Time
+	m      sync.Mutex
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Analytics",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			if !util.EnvBoolWithDefault("ANALYTICS", false) {
+				return nil
+			}
+
+			opts := analytics.Options{SampleRate: 1}
+			if err := json.Unmarshal([]byte(util.EnvWithDefault("ANALYTICS_OPTIONS", "{}")), &opts); err != nil {
+				return err
+			}
+
+			p := &Plugin{
+				h:      h,
+				pub:    analytics.New(h.Messaging(), h.Info.AnalyticsSubject(), h.Info.PodName, h.Info.Network, opts),
+				joined: make(map[string]time.Time),
+			}
+
+			return p.Init(prx)
+		},
+	}, nil
+}
+
+func (p *Plugin) Init(prx *proxy.Proxy) error {
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Analytics", p.onPostLogin))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Analytics", p.onDisconnect))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Analytics", p.onServerPostConnect))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Analytics", p.onKicked))
+	// Last, to see whether the chat plugins let the message through
+	event.Subscribe(prx.Event(), -100, hosting.Guard(p.h, "Analytics", p.onChat))
+
+	return nil
+}
+
+func (p *Plugin) publish(player proxy.Player, e analytics.Event) {
+	e.Player = player.ID().String()
+	e.Name = player.Username()
+
+	if host, _, err := net.SplitHostPort(player.RemoteAddr().String()); err == nil {
+		e.IP = host
+	}
+
+	if e.Server == "" {
+		if s := player.CurrentServer(); s != nil {
+			e.Server = s.Server().ServerInfo().Name()
+		}
+	}
+
+	if err := p.pub.Publish(player.Context(), e); err != nil {
+		log.Printf("Failed to publish the %s analytics event of %s: %v", e.Type, player.Username(), err)
+	}
+}
+
+func (p *Plugin) onPostLogin(e *proxy.PostLoginEvent) {
+	p.m.Lock()
+	p.joined[e.Player().ID().String()] = time.Now()
+	p.m.Unlock()
+
+	p.publish(e.Player(), analytics.Event{Type: analytics.Join})
+}
+
+func (p *Plugin) onDisconnect(e *proxy.DisconnectEvent) {
+	id := e.Player().ID().String()
+
+	p.m.Lock()
+	joined, ok := p.joined[id]
+	delete(p.joined, id)
+	p.m.Unlock()
+
+	if !ok {
+		// Never logged in
+		return
+	}
+
+	p.publish(e.Player(), analytics.Event{Type: analytics.Quit, Session: int64(time.Since(joined).Seconds())})
+}
+
+func (p *Plugin) onServerPostConnect(e *proxy.ServerPostConnectEvent) {
+	from := ""
+	if prev := e.PreviousServer(); prev != nil {
+		from = prev.ServerInfo().Name()
+	}
+
+	p.publish(e.Player(), analytics.Event{Type: analytics.Switch, From: from})
+}
+
+func (p *Plugin) onKicked(e *proxy.KickedFromServerEvent) {
+	reason := ""
+	if e.OriginalReason() != nil {
+		sb := strings.Builder{}
+		if err := (&legacy.Legacy{}).Marshal(&sb, e.OriginalReason()); err == nil {
+			reason = sb.String()
+		}
+	}
+
+	p.publish(e.Player(), analytics.Event{Type: analytics.Kick, Server: e.Server().ServerInfo().Name(), Reason: reason})
+}
+
+// onChat publishes how long the message was, never what it said.
+func (p *Plugin) onChat(e *proxy.PlayerChatEvent) {
+	p.publish(e.Player(), analytics.Event{
+		Type:    analytics.Chat,
+		Length:  utf8.RuneCountInString(e.Message()),
+		Blocked: !e.Allowed(),
+	})
+}
@@ -12,11 +12,11 @@ import (
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 )
 
-func New(_ *hosting.Hosting) (proxy.Plugin, error) {
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
 	return proxy.Plugin{
 		Name: "Bossbar",
 		Init: func(ctx context.Context, proxy *proxy.Proxy) error {
-			event.Subscribe(proxy.Event(), 0, bossbarDisplay())
+			event.Subscribe(proxy.Event(), 0, hosting.Guard(h, "Bossbar", bossbarDisplay()))
 
 			return nil
 		},
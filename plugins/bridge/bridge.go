@@ -0,0 +1,325 @@
+// Package bridge carries JSON plugin messages between the proxy and
+// co-plugins on the backends. Plugins register a named channel like
+// csmc:selector and send, request or answer on it; messages for players on
+// another proxy are forwarded there over messaging.
+//
+// Every message on a bridge channel is an envelope:
+//
+//	{"data":{...}}             one-way message
+//	{"id":7,"data":{...}}      request, answered with the same id in reply
+//	{"reply":7,"data":{...}}   response to a request
+//
+// Envelopes also carry the correlation ID of the player's connection, or of
+// the API request that led to the message, as "correlation". Co-plugins
+// should log it and send it back in their responses.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/edition/java/proxy/message"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+var (
+	ErrNoServer = errors.New("player is not connected to a server")
+	ErrTimeout  = errors.New("backend did not respond in time")
+
+	messagesTotal = metrics.NewCounterVec("gate_bridge_messages_total", "Plugin messages on bridge channels, by direction.", "channel", "direction")
+)
+
+type envelope struct {
+	ID    uint64          `json:"id,omitempty"`
+	Reply uint64          `json:"reply,omitempty"`
+	Data  json.RawMessage `json:"data"`
+	// Correlation is the correlation ID of the message
+	Correlation string `json:"correlation,omitempty"`
+}
+
+// pending is a request waiting for its response. Requests forwarded from
+// another proxy have no channel, the response is published to that proxy.
+type pending struct {
+	player uuid.UUID
+	ch     chan json.RawMessage
+	proxy  string
+	id     uint64
+	// correlation of the forwarded request, for its response
+	correlation string
+}
+
+// Bridge is shared by the plugins that talk to backends, channels can be
+// registered before and after the bridge plugin is initialized.
+type Bridge struct {
+	h       *hosting.Hosting
+	prx     *proxy.Proxy
+	timeout time.Duration
+
+	channels map[string]*Channel
+	pending  map[uint64]pending
+	next     atomic.Uint64
+	m        sync.Mutex
+}
+
+func NewBridge(h *hosting.Hosting) *Bridge {
+	return &Bridge{
+		h:        h,
+		timeout:  util.EnvDurationWithDefault("BRIDGE_TIMEOUT", 5*time.Second),
+		channels: make(map[string]*Channel),
+		pending:  make(map[uint64]pending),
+	}
+}
+
+// Message is a message a backend sent on a channel.
+type Message struct {
+	Player proxy.Player
+	Server proxy.RegisteredServer
+	Data   json.RawMessage
+	// CorrelationID is the one the backend sent, or else of the player's
+	// connection
+	CorrelationID string
+
+	channel *Channel
+	conn    proxy.ServerConnection
+	id      uint64
+}
+
+func (m Message) Decode(v any) error {
+	return json.Unmarshal(m.Data, v)
+}
+
+// Respond answers the message if the backend sent it as a request.
+func (m Message) Respond(v any) error {
+	if m.id == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return m.channel.write(m.conn, envelope{Reply: m.id, Data: data, Correlation: m.CorrelationID})
+}
+
+type Channel struct {
+	b       *Bridge
+	id      message.ChannelIdentifier
+	handler func(Message)
+}
+
+// Register adds a channel, e.g. csmc:selector. handler is called for every
+// message and request of a backend on it, it may be nil for channels the
+// proxy only sends on. Handlers run on the player's connection and should
+// hand slow work to a goroutine.
+func (b *Bridge) Register(name string, handler func(Message)) (*Channel, error) {
+	id, err := message.ChannelIdentifierFrom(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel %s: %w", name, err)
+	}
+
+	c := &Channel{b: b, id: id, handler: handler}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.channels[id.ID()]; ok {
+		return nil, fmt.Errorf("channel %s is already registered", name)
+	}
+
+	b.channels[id.ID()] = c
+	if b.prx != nil {
+		b.prx.ChannelRegistrar().Register(id)
+	}
+
+	return c, nil
+}
+
+func (c *Channel) write(conn proxy.ServerConnection, env envelope) error {
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	messagesTotal.Inc(c.id.ID(), "out")
+
+	return conn.SendPluginMessage(c.id, raw)
+}
+
+func (c *Channel) send(player proxy.Player, env envelope) error {
+	conn := player.CurrentServer()
+	if conn == nil {
+		return ErrNoServer
+	}
+
+	return c.write(conn, env)
+}
+
+// Send sends v to the backend of the player, on whichever proxy they are.
+func (c *Channel) Send(ctx context.Context, player uuid.UUID, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if p := c.b.prx.Player(player); p != nil {
+		return c.send(p, envelope{Data: data, Correlation: correlation.ID(c.b.h.PlayerContext(ctx, p))})
+	}
+
+	return c.b.forward(ctx, forward{Channel: c.id.ID(), Player: player, Data: data})
+}
+
+// Request sends v to the backend of the player and decodes the response into
+// out. It gives up with ErrTimeout after BRIDGE_TIMEOUT, also when the
+// player isn't online on any proxy.
+func (c *Channel) Request(ctx context.Context, player uuid.UUID, v, out any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.b.timeout)
+	defer cancel()
+
+	id := c.b.next.Add(1)
+	ch := make(chan json.RawMessage, 1)
+
+	c.b.m.Lock()
+	c.b.pending[id] = pending{player: player, ch: ch}
+	c.b.m.Unlock()
+
+	defer func() {
+		c.b.m.Lock()
+		delete(c.b.pending, id)
+		c.b.m.Unlock()
+	}()
+
+	if p := c.b.prx.Player(player); p != nil {
+		err = c.send(p, envelope{ID: id, Data: data, Correlation: correlation.ID(c.b.h.PlayerContext(ctx, p))})
+	} else {
+		err = c.b.forward(ctx, forward{Channel: c.id.ID(), Player: player, Proxy: c.b.h.Info.PodName, ID: id, Data: data})
+	}
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrTimeout
+		}
+
+		return ctx.Err()
+	case res := <-ch:
+		if out == nil {
+			return nil
+		}
+
+		return json.Unmarshal(res, out)
+	}
+}
+
+// resolve delivers a response of the player's backend to the request it
+// answers.
+func (b *Bridge) resolve(player uuid.UUID, id uint64, data json.RawMessage) {
+	b.m.Lock()
+	p, ok := b.pending[id]
+	// Backends only get to answer requests about their own players
+	if ok && p.player == player {
+		delete(b.pending, id)
+	}
+	b.m.Unlock()
+
+	if !ok || p.player != player {
+		return
+	}
+
+	if p.ch != nil {
+		p.ch <- data
+		return
+	}
+
+	if err := b.reply(correlation.With(b.h.Context(), p.correlation), p.proxy, player, p.id, data); err != nil {
+		log.Printf("Failed to forward bridge response to %s: %v", p.proxy, err)
+	}
+}
+
+func (b *Bridge) onPluginMessage(e *proxy.PluginMessageEvent) {
+	b.m.Lock()
+	c, ok := b.channels[e.Identifier().ID()]
+	b.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// Bridge channels are between the proxy and the backends, which also
+	// keeps clients from sending messages to the backend themselves
+	e.SetForward(false)
+
+	conn, ok := e.Source().(proxy.ServerConnection)
+	if !ok {
+		return
+	}
+
+	messagesTotal.Inc(c.id.ID(), "in")
+
+	env := envelope{}
+	if err := json.Unmarshal(e.Data(), &env); err != nil {
+		log.Printf("Invalid %s message from %s: %v", c.id.ID(), conn.Server().ServerInfo().Name(), err)
+		return
+	}
+
+	if env.Reply != 0 {
+		b.resolve(conn.Player().ID(), env.Reply, env.Data)
+		return
+	}
+
+	if c.handler == nil {
+		return
+	}
+
+	if !correlation.Valid(env.Correlation) {
+		env.Correlation = b.h.ConnectionID(conn.Player().RemoteAddr())
+	}
+
+	c.handler(Message{Player: conn.Player(), Server: conn.Server(), Data: env.Data, CorrelationID: env.Correlation, channel: c, conn: conn, id: env.ID})
+}
+
+func New(h *hosting.Hosting, b *Bridge) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Bridge",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			b.m.Lock()
+			b.prx = prx
+			for _, c := range b.channels {
+				prx.ChannelRegistrar().Register(c.id)
+			}
+			b.m.Unlock()
+
+			if err := h.Messaging().Subscribe(h.Info.BridgeSubject(), b.onForward); err != nil {
+				return err
+			}
+
+			if err := h.Messaging().Subscribe(h.Info.BridgeReplySubject(h.Info.PodName), b.onReply); err != nil {
+				return err
+			}
+
+			event.Subscribe(prx.Event(), 0, hosting.Guard(h, "Bridge", b.onPluginMessage))
+
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// forward is published to every proxy, the one the player is on delivers it.
+type forward struct {
+	Channel string    `json:"channel"`
+	Player  uuid.UUID `json:"player"`
+	// Proxy and ID are set on requests, the response goes to the reply
+	// subject of that proxy.
+	Proxy string          `json:"proxy,omitempty"`
+	ID    uint64          `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type forwardReply struct {
+	Player uuid.UUID       `json:"player"`
+	ID     uint64          `json:"id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func (b *Bridge) forward(ctx context.Context, f forward) error {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	messagesTotal.Inc(f.Channel, "forwarded")
+
+	return b.h.Messaging().Publish(ctx, b.h.Info.BridgeSubject(), raw)
+}
+
+func (b *Bridge) reply(ctx context.Context, proxy string, player uuid.UUID, id uint64, data json.RawMessage) error {
+	raw, err := json.Marshal(forwardReply{Player: player, ID: id, Data: data})
+	if err != nil {
+		return err
+	}
+
+	return b.h.Messaging().Publish(ctx, b.h.Info.BridgeReplySubject(proxy), raw)
+}
+
+func (b *Bridge) onForward(msg messaging.Message) {
+	defer b.h.Recover("Bridge")
+
+	f := forward{}
+	if err := json.Unmarshal(msg.Data, &f); err != nil {
+		log.Printf("Invalid forwarded bridge message: %v", err)
+		return
+	}
+
+	player := b.prx.Player(f.Player)
+	if player == nil {
+		return
+	}
+
+	b.m.Lock()
+	c, ok := b.channels[f.Channel]
+	b.m.Unlock()
+
+	if !ok {
+		log.Printf("Forwarded bridge message for unknown channel %s", f.Channel)
+		return
+	}
+
+	// Messages from another proxy keep the ID it sent along
+	env := envelope{Data: f.Data, Correlation: correlation.ID(b.h.PlayerContext(msg.Context, player))}
+	if f.ID != 0 {
+		// The backend answers with an ID of this proxy, which is mapped back
+		// to the request of the origin proxy
+		env.ID = b.next.Add(1)
+
+		b.m.Lock()
+		b.pending[env.ID] = pending{player: f.Player, proxy: f.Proxy, id: f.ID, correlation: env.Correlation}
+		b.m.Unlock()
+
+		time.AfterFunc(b.timeout, func() {
+			b.m.Lock()
+			delete(b.pending, env.ID)
+			b.m.Unlock()
+		})
+	}
+
+	if err := c.send(player, env); err != nil {
+		log.Printf("Failed to deliver forwarded %s message to %s: %v", f.Channel, player.Username(), err)
+	}
+}
+
+func (b *Bridge) onReply(msg messaging.Message) {
+	defer b.h.Recover("Bridge")
+
+	r := forwardReply{}
+	if err := json.Unmarshal(msg.Data, &r); err != nil {
+		log.Printf("Invalid bridge reply: %v", err)
+		return
+	}
+
+	b.resolve(r.Player, r.ID, r.Data)
+}
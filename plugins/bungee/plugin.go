@@ -0,0 +1,494 @@
+// Package bungee answers the bungeecord:main plugin messages of backend
+// plugins written for BungeeCord or Velocity. Unlike the handler built into
+// Gate it knows about the rest of the network: Connect and ConnectOther take
+// gamemodes and selectors, PlayerCount counts the players of every proxy,
+// and the messages that target a player reach them on whichever proxy they
+// are. Gate's own handler has to be turned off with
+// bungeePluginChannelEnabled: false.
+package bungee
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/common/minecraft/component/codec"
+	"go.minekube.com/common/minecraft/component/codec/legacy"
+	"go.minekube.com/common/minecraft/key"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/edition/java/proxy/message"
+)
+
+var (
+	MainChannel = &message.MinecraftChannelIdentifier{Key: key.New("bungeecord", "main")}
+	// LegacyChannel is used by backends before 1.13.
+	LegacyChannel = message.LegacyChannelIdentifier("BungeeCord")
+
+	messagesTotal = metrics.NewCounterVec("gate_bungee_messages_total", "BungeeCord plugin messages from backends, by subchannel.", "subchannel")
+
+	subchannels = map[string]struct{}{
+		"Connect": {}, "ConnectOther": {}, "IP": {}, "IPOther": {}, "PlayerCount": {}, "PlayerList": {},
+		"GetServers": {}, "GetServer": {}, "GetPlayerServer": {}, "UUID": {}, "UUIDOther": {}, "ServerIP": {},
+		"Message": {}, "MessageRaw": {}, "KickPlayer": {}, "KickPlayerRaw": {}, "Forward": {}, "ForwardToPlayer": {},
+	}
+)
+
+// forwarded is a message for a player that isn't on this proxy, published to
+// every proxy so the one they are on handles it.
+type forwarded struct {
+	Proxy   string `json:"proxy"`
+	Channel string `json:"channel"`
+	Data    []byte `json:"data"`
+}
+
+type BungeePlugin struct {
+	prx *proxy.Proxy
+	h   *hosting.Hosting
+	mgr *hosting.InstanceManager
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "BungeeCord",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			p := &BungeePlugin{prx: prx, h: h, mgr: mgr}
+
+			return p.Init()
+		},
+	}, nil
+}
+
+func (p *BungeePlugin) Init() error {
+	p.prx.ChannelRegistrar().Register(MainChannel, LegacyChannel)
+
+	if err := p.h.Messaging().Subscribe(p.h.Info.BungeeSubject(), p.onForwarded); err != nil {
+		return err
+	}
+
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "BungeeCord", p.onPluginMessage))
+
+	return nil
+}
+
+func channelOf(id string) message.ChannelIdentifier {
+	if id == LegacyChannel.ID() {
+		return LegacyChannel
+	}
+
+	return MainChannel
+}
+
+func (p *BungeePlugin) onPluginMessage(e *proxy.PluginMessageEvent) {
+	id := e.Identifier().ID()
+	if id != MainChannel.ID() && id != LegacyChannel.ID() {
+		return
+	}
+
+	// The messages are meant for the proxy, and clients must not be able to
+	// send them in place of the backend
+	e.SetForward(false)
+
+	conn, ok := e.Source().(proxy.ServerConnection)
+	if !ok {
+		return
+	}
+
+	data := append([]byte(nil), e.Data()...)
+
+	// Connecting players blocks, which must not hold up the backend
+	// connection
+	go func() {
+		defer p.h.Recover("BungeeCord")
+
+		p.handle(p.h.Context(), conn, channelOf(id), data)
+	}()
+}
+
+func respond(conn proxy.ServerConnection, channel message.ChannelIdentifier, write func(w *writer)) {
+	w := &writer{}
+	write(w)
+
+	raw, err := w.Bytes()
+	if err != nil {
+		log.Printf("Failed to encode bungeecord response: %v", err)
+		return
+	}
+
+	if err := conn.SendPluginMessage(channel, raw); err != nil {
+		log.Printf("Failed to send bungeecord response to %s: %v", conn.Server().ServerInfo().Name(), err)
+	}
+}
+
+func hostPort(addr net.Addr) (string, int) {
+	if addr == nil {
+		return "", 0
+	}
+
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String(), 0
+	}
+
+	n, _ := strconv.Atoi(port)
+
+	return host, n
+}
+
+func (p *BungeePlugin) handle(ctx context.Context, conn proxy.ServerConnection, channel message.ChannelIdentifier, data []byte) {
+	r := newReader(data)
+	sub := r.utf()
+	if r.err != nil {
+		log.Printf("Invalid bungeecord message from %s: %v", conn.Server().ServerInfo().Name(), r.err)
+		return
+	}
+
+	if _, ok := subchannels[sub]; ok {
+		messagesTotal.Inc(sub)
+	} else {
+		messagesTotal.Inc("unknown")
+	}
+
+	player := conn.Player()
+
+	switch sub {
+	case "Connect":
+		p.connect(ctx, player, r.utf())
+
+	case "IP":
+		host, port := hostPort(player.RemoteAddr())
+		respond(conn, channel, func(w *writer) {
+			w.utf("IP")
+			w.utf(host)
+			w.int(port)
+		})
+
+	case "IPOther":
+		name := r.utf()
+		if other := p.prx.PlayerByName(name); other != nil {
+			host, port := hostPort(other.RemoteAddr())
+			respond(conn, channel, func(w *writer) {
+				w.utf("IPOther")
+				w.utf(other.Username())
+				w.utf(host)
+				w.int(port)
+			})
+		}
+
+	case "PlayerCount":
+		server := r.utf()
+		destination := server
+		if server == "ALL" {
+			destination = ""
+		}
+
+		players, _, err := p.mgr.Online(ctx, destination)
+		if err != nil {
+			log.Printf("Failed to count players of %s: %v", server, err)
+			return
+		}
+
+		respond(conn, channel, func(w *writer) {
+			w.utf("PlayerCount")
+			w.utf(server)
+			w.int(players)
+		})
+
+	case "PlayerList":
+		server := r.utf()
+		names := p.playerNames(server)
+		respond(conn, channel, func(w *writer) {
+			w.utf("PlayerList")
+			w.utf(server)
+			w.utf(strings.Join(names, ", "))
+		})
+
+	case "GetServers":
+		names := make([]string, 0)
+		for _, s := range p.prx.Servers() {
+			names = append(names, s.ServerInfo().Name())
+		}
+
+		respond(conn, channel, func(w *writer) {
+			w.utf("GetServers")
+			w.utf(strings.Join(names, ", "))
+		})
+
+	case "GetServer":
+		respond(conn, channel, func(w *writer) {
+			w.utf("GetServer")
+			w.utf(conn.Server().ServerInfo().Name())
+		})
+
+	case "GetPlayerServer":
+		name := r.utf()
+		if other := p.prx.PlayerByName(name); other != nil && other.CurrentServer() != nil {
+			respond(conn, channel, func(w *writer) {
+				w.utf("GetPlayerServer")
+				w.utf(other.Username())
+				w.utf(other.CurrentServer().Server().ServerInfo().Name())
+			})
+		}
+
+	case "UUID":
+		respond(conn, channel, func(w *writer) {
+			w.utf("UUID")
+			w.utf(player.ID().Undashed())
+		})
+
+	case "UUIDOther":
+		name := r.utf()
+		if other := p.prx.PlayerByName(name); other != nil {
+			respond(conn, channel, func(w *writer) {
+				w.utf("UUIDOther")
+				w.utf(other.Username())
+				w.utf(other.ID().Undashed())
+			})
+		}
+
+	case "ServerIP":
+		name := r.utf()
+		if server := p.prx.Server(name); server != nil {
+			host, port := hostPort(server.ServerInfo().Addr())
+			respond(conn, channel, func(w *writer) {
+				w.utf("ServerIP")
+				w.utf(name)
+				w.utf(host)
+				w.short(port)
+			})
+		}
+
+	case "Forward":
+		target, subchannel, payload := r.utf(), r.utf(), r.bytes()
+		if r.err != nil {
+			break
+		}
+
+		p.forwardToServers(conn, channel, target, subchannel, payload)
+
+	case "ConnectOther", "Message", "MessageRaw", "KickPlayer", "KickPlayerRaw", "ForwardToPlayer":
+		target := r.utf()
+		if r.err != nil {
+			break
+		}
+
+		// Sent to everyone, or to a player on another proxy
+		if !p.handleTargeted(ctx, channel, sub, target, r) || target == "ALL" {
+			p.publish(ctx, channel, data)
+		}
+
+	default:
+		log.Printf("Unknown bungeecord subchannel %s from %s", sub, conn.Server().ServerInfo().Name())
+	}
+
+	if r.err != nil {
+		log.Printf("Invalid bungeecord %s message from %s: %v", sub, conn.Server().ServerInfo().Name(), r.err)
+	}
+}
+
+// handleTargeted runs the subchannels that target another player on this
+// proxy, it reports whether the player was found.
+func (p *BungeePlugin) handleTargeted(ctx context.Context, channel message.ChannelIdentifier, sub, target string, r *reader) bool {
+	if sub == "Message" || sub == "MessageRaw" {
+		msg := r.utf()
+		if r.err != nil {
+			return true
+		}
+
+		c, err := parse(sub == "MessageRaw", msg)
+		if err != nil {
+			log.Printf("Invalid bungeecord message component: %v", err)
+			return true
+		}
+
+		if target == "ALL" {
+			for _, player := range p.prx.Players() {
+				_ = player.SendMessage(c)
+			}
+
+			return true
+		}
+
+		player := p.prx.PlayerByName(target)
+		if player == nil {
+			return false
+		}
+
+		_ = player.SendMessage(c)
+
+		return true
+	}
+
+	player := p.prx.PlayerByName(target)
+	if player == nil {
+		return false
+	}
+
+	switch sub {
+	case "ConnectOther":
+		p.connect(ctx, player, r.utf())
+
+	case "KickPlayer", "KickPlayerRaw":
+		reason := r.utf()
+		if r.err != nil {
+			return true
+		}
+
+		c, err := parse(sub == "KickPlayerRaw", reason)
+		if err != nil {
+			log.Printf("Invalid bungeecord kick reason: %v", err)
+			return true
+		}
+
+		player.Disconnect(c)
+
+	case "ForwardToPlayer":
+		subchannel, payload := r.utf(), r.bytes()
+		if r.err != nil {
+			return true
+		}
+
+		conn := player.CurrentServer()
+		if conn == nil {
+			return true
+		}
+
+		respond(conn, channel, func(w *writer) {
+			w.utf(subchannel)
+			w.bytes(payload)
+		})
+	}
+
+	return true
+}
+
+// parse reads a chat component, raw ones are JSON and the others use §
+// color codes.
+func parse(raw bool, s string) (component.Component, error) {
+	if raw {
+		return (&codec.Json{}).Unmarshal([]byte(s))
+	}
+
+	return (&legacy.Legacy{Char: legacy.SectionChar}).Unmarshal([]byte(s))
+}
+
+func (p *BungeePlugin) connect(ctx context.Context, player proxy.Player, destination string) {
+	server, err := p.mgr.FindServer(ctx, destination)
+	if err != nil {
+		log.Printf("Failed to find %s for %s: %v", destination, player.Username(), err)
+		return
+	}
+
+	if _, err := p.mgr.Connect(ctx, player, server); err != nil {
+		log.Printf("Failed to connect %s to %s: %v", player.Username(), server.ServerInfo().Name(), err)
+	}
+}
+
+// playerNames lists the players of a server on this proxy, or of every
+// server for ALL.
+func (p *BungeePlugin) playerNames(server string) []string {
+	names := make([]string, 0)
+
+	if server == "ALL" {
+		for _, player := range p.prx.Players() {
+			names = append(names, player.Username())
+		}
+
+		return names
+	}
+
+	s := p.prx.Server(server)
+	if s == nil {
+		return names
+	}
+
+	s.Players().Range(func(player proxy.Player) bool {
+		names = append(names, player.Username())
+		return true
+	})
+
+	return names
+}
+
+// forwardToServers sends a Forward payload to other backends, ALL and ONLINE
+// reach every server except the sender. A plugin message needs a player to
+// travel through, so servers without players on this proxy don't get it.
+func (p *BungeePlugin) forwardToServers(conn proxy.ServerConnection, channel message.ChannelIdentifier, target, subchannel string, payload []byte) {
+	w := &writer{}
+	w.utf(subchannel)
+	w.bytes(payload)
+
+	raw, err := w.Bytes()
+	if err != nil {
+		log.Printf("Failed to encode bungeecord forward: %v", err)
+		return
+	}
+
+	for _, s := range p.prx.Servers() {
+		name := s.ServerInfo().Name()
+
+		if target == "ALL" || target == "ONLINE" {
+			if name == conn.Server().ServerInfo().Name() {
+				continue
+			}
+		} else if name != target {
+			continue
+		}
+
+		if s.Players().Len() == 0 {
+			continue
+		}
+
+		if err := s.SendPluginMessage(channel, raw); err != nil {
+			log.Printf("Failed to forward bungeecord message to %s: %v", name, err)
+		}
+	}
+}
+
+func (p *BungeePlugin) publish(ctx context.Context, channel message.ChannelIdentifier, data []byte) {
+	raw, err := json.Marshal(forwarded{Proxy: p.h.Info.PodName, Channel: channel.ID(), Data: data})
+	if err != nil {
+		log.Printf("Failed to marshal bungeecord message: %v", err)
+		return
+	}
+
+	if err := p.h.Messaging().Publish(ctx, p.h.Info.BungeeSubject(), raw); err != nil {
+		log.Printf("Failed to publish bungeecord message: %v", err)
+	}
+}
+
+// onForwarded handles the messages of other proxies.
+func (p *BungeePlugin) onForwarded(msg messaging.Message) {
+	defer p.h.Recover("BungeeCord")
+
+	f := forwarded{}
+	if err := json.Unmarshal(msg.Data, &f); err != nil {
+		log.Printf("Invalid forwarded bungeecord message: %v", err)
+		return
+	}
+
+	if f.Proxy == p.h.Info.PodName {
+		return
+	}
+
+	r := newReader(f.Data)
+	sub, target := r.utf(), r.utf()
+	if r.err != nil {
+		log.Printf("Invalid forwarded bungeecord message: %v", r.err)
+		return
+	}
+
+	p.handleTargeted(p.h.Context(), channelOf(f.Channel), sub, target, r)
+}
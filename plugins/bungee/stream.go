@@ -0,0 +1,87 @@
+package bungee
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errTooLong = errors.New("value is too long for the bungeecord format")
+
+// reader reads values in the format of Java's DataInput, which backends use
+// to build bungeecord messages. The first error sticks.
+type reader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func newReader(data []byte) *reader {
+	return &reader{r: bytes.NewReader(data)}
+}
+
+func (r *reader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.err = err
+		return nil
+	}
+
+	return b
+}
+
+func (r *reader) short() int {
+	b := r.read(2)
+	if b == nil {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint16(b))
+}
+
+// utf reads a string prefixed with its length as an unsigned short.
+func (r *reader) utf() string {
+	return string(r.read(r.short()))
+}
+
+// bytes reads a byte array prefixed with its length as a short, like
+// Forward payloads.
+func (r *reader) bytes() []byte {
+	return r.read(r.short())
+}
+
+type writer struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (w *writer) short(v int) {
+	if v > 0xFFFF {
+		w.err = errTooLong
+		return
+	}
+
+	_ = binary.Write(&w.buf, binary.BigEndian, uint16(v))
+}
+
+func (w *writer) int(v int) {
+	_ = binary.Write(&w.buf, binary.BigEndian, int32(v))
+}
+
+func (w *writer) utf(s string) {
+	w.short(len(s))
+	w.buf.WriteString(s)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.short(len(b))
+	w.buf.Write(b)
+}
+
+func (w *writer) Bytes() ([]byte, error) {
+	return w.buf.Bytes(), w.err
+}
@@ -0,0 +1,210 @@
+// Package chat runs player chat through the filters of plugins. Since 1.19
+// clients sign their messages, and a backend or another client that sees a
+// message whose content no longer matches its signature kicks the player
+// for failed chat validation. So the proxy never forwards a changed message:
+// messages no filter touches pass through with their signature, denied ones
+// are dropped, and changed ones are dropped and shown to the players of the
+// sender's server as system messages, which can't be reported.
+package chat
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var messagesTotal = metrics.NewCounterVec("gate_chat_messages_total", "Chat messages by what the filters did with them.", "result")
+
+// Filter returns the message to send instead, or false to drop it. Filters
+// run in the order they were added, each on the result of the previous one.
+type Filter func(player proxy.Player, message string) (string, bool)
+
+// Offense is told about players a filter caught breaking the rules, e.g. to
+// punish them. category groups offenses, like "chat" for blocked words.
+type Offense func(player proxy.Player, category, reason string)
+
+type filter struct {
+	name string
+	fn   Filter
+}
+
+// Chat is shared by the plugins that filter or rewrite chat.
+type Chat struct {
+	h        *hosting.Hosting
+	prx      *proxy.Proxy
+	filters  []filter
+	offenses []Offense
+	m        sync.RWMutex
+
+	// format of relayed messages, with {player} and {message} and & color
+	// codes
+	format string
+}
+
+func NewChat() *Chat {
+	return &Chat{format: util.EnvWithDefault("CHAT_FORMAT", "<{player}> {message}")}
+}
+
+// Use adds a filter, name is used in logs.
+func (c *Chat) Use(name string, fn Filter) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.filters = append(c.filters, filter{name: name, fn: fn})
+}
+
+// OnOffense adds a handler for the offenses filters report.
+func (c *Chat) OnOffense(fn Offense) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.offenses = append(c.offenses, fn)
+}
+
+// offend runs the handlers outside of the filter, which holds the lock and
+// shouldn't wait for them.
+func (c *Chat) offend(player proxy.Player, category, reason string) {
+	go func() {
+		defer c.h.Recover("Chat")
+
+		c.m.RLock()
+		handlers := c.offenses
+		c.m.RUnlock()
+
+		for _, fn := range handlers {
+			fn(player, category, reason)
+		}
+	}()
+}
+
+// Filter runs the message through the filters. changed is false if every
+// filter kept it as it was.
+func (c *Chat) Filter(player proxy.Player, message string) (result string, allowed, changed bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	result = message
+	for _, f := range c.filters {
+		next, ok := f.fn(player, result)
+		if !ok {
+			log.Printf("Chat filter %s dropped a message of %s", f.name, player.Username())
+			if c.h != nil {
+				c.h.Tracef(player.Username(), "chat: filter %s dropped %q", f.name, result)
+			}
+			return "", false, true
+		}
+
+		result = next
+	}
+
+	return result, true, result != message
+}
+
+func (c *Chat) onChat(e *proxy.PlayerChatEvent) {
+	if !e.Allowed() {
+		return
+	}
+
+	message, allowed, changed := c.Filter(e.Player(), e.Message())
+	if !changed {
+		messagesTotal.Inc("passed")
+		return
+	}
+
+	e.SetAllowed(false)
+
+	if !allowed {
+		messagesTotal.Inc("dropped")
+		return
+	}
+
+	messagesTotal.Inc("relayed")
+	c.relay(e.Player(), message)
+}
+
+// relay shows the message to the players on the server of the sender, like
+// the backend would have.
+func (c *Chat) relay(sender proxy.Player, message string) {
+	current := sender.CurrentServer()
+	if current == nil {
+		return
+	}
+
+	server := current.Server().ServerInfo().Name()
+
+	// The format may use & color codes, the message of the player may not
+	before, after, _ := strings.Cut(strings.ReplaceAll(c.format, "{player}", sender.Username()), "{message}")
+	text := util.Join(util.Text(before), &Text{Content: message}, util.Text(after))
+
+	for _, player := range c.prx.Players() {
+		if s := player.CurrentServer(); s != nil && s.Server().ServerInfo().Name() == server {
+			_ = player.SendMessage(text)
+		}
+	}
+}
+
+func New(h *hosting.Hosting, c *Chat) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Chat",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			c.h = h
+			c.prx = prx
+
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_chat")
+			if err != nil {
+				return err
+			}
+
+			// Incident mode slows chat down while it is on
+			slow := newSlowMode(h, prx, bucket, func() time.Duration {
+				state, b := h.Incident()
+				if !state.Active {
+					return 0
+				}
+
+				return time.Duration(b.SlowModeSeconds) * time.Second
+			})
+			h.Go("Chat", func(ctx context.Context) {
+				kv.Watch(ctx, bucket, slow.handleChange, slow.Reload)
+			})
+			h.Go("Chat", slow.expire)
+			h.OnReload("Chat", slow.Reload)
+			c.Use("slow-mode", slow.filter)
+
+			if words := util.EnvWithDefault("CHAT_BLOCKED_WORDS", ""); words != "" {
+				category := util.EnvWithDefault("CHAT_BLOCKED_WORDS_CATEGORY", "chat")
+				c.Use("blocked-words", blockWords(h, strings.Split(words, ","), func(player proxy.Player) {
+					if category != "" {
+						c.offend(player, category, "blocked word")
+					}
+				}))
+			}
+
+			event.Subscribe(prx.Event(), 0, hosting.Guard(h, "Chat", c.onChat))
+
+			if util.EnvBoolWithDefault("CHAT_LOG", false) {
+				cl, err := newChatLog(ctx, h)
+				if err != nil {
+					return err
+				}
+
+				event.Subscribe(prx.Event(), -100, hosting.Guard(h, "Chat", cl.onChat))
+			}
+			event.Subscribe(prx.Event(), 0, hosting.Guard(h, "Chat", slow.onDisconnect))
+			prx.Command().Register(slow.command())
+			h.API().HandleFunc("GET /chat/slowmode", slow.handleList)
+
+			return nil
+		},
+	}, nil
+}
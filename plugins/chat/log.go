@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// LogEntry is a chat message as the player sent it, whether or not the
+// filters let it through.
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Player  string    `json:"player"`
+	Name    string    `json:"name"`
+	Server  string    `json:"server,omitempty"`
+	Message string    `json:"message"`
+	Blocked bool      `json:"blocked,omitempty"`
+}
+
+// chatLog keeps the messages of the network for moderation, keyed by time
+// and proxy so concurrent proxies never overwrite each other.
+type chatLog struct {
+	h  *hosting.Hosting
+	kv kv.Bucket
+}
+
+func newChatLog(ctx context.Context, h *hosting.Hosting) (*chatLog, error) {
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVChatLogKey())
+	if err != nil {
+		return nil, err
+	}
+
+	h.RetainLog("chat", bucket, hosting.RetentionPolicy("CHAT_LOG"))
+
+	l := &chatLog{h: h, kv: bucket}
+	h.GDPR().Register("chatlog", gdpr.Subsystem{Export: l.export, Erase: l.erase})
+
+	return l, nil
+}
+
+// of returns the entries of the player by key, the log has no index by
+// player so this reads all of it.
+func (l *chatLog) of(ctx context.Context, player string) (map[string]LogEntry, error) {
+	keys, err := l.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]LogEntry)
+	for _, key := range keys {
+		raw, err := l.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		e := LogEntry{}
+		if err := json.Unmarshal(raw, &e); err != nil {
+			log.Printf("Failed to unmarshal chat log entry %s: %v", key, err)
+			continue
+		}
+
+		if e.Player == player {
+			entries[key] = e
+		}
+	}
+
+	return entries, nil
+}
+
+func (l *chatLog) export(ctx context.Context, player string) (any, error) {
+	entries, err := l.of(ctx, player)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	list := make([]LogEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	slices.SortFunc(list, func(a, b LogEntry) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return list, nil
+}
+
+func (l *chatLog) erase(ctx context.Context, player string) (gdpr.Erasure, error) {
+	entries, err := l.of(ctx, player)
+	if err != nil {
+		return gdpr.Erasure{}, err
+	}
+
+	e := gdpr.Erasure{}
+	for key := range entries {
+		if err := l.kv.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return e, err
+		}
+
+		e.Erased++
+	}
+
+	return e, nil
+}
+
+// onChat runs after the filters, so it knows whether they blocked the
+// message.
+func (l *chatLog) onChat(e *proxy.PlayerChatEvent) {
+	entry := LogEntry{
+		Time:    time.Now(),
+		Player:  e.Player().ID().Undashed(),
+		Name:    e.Player().Username(),
+		Message: e.Message(),
+		Blocked: !e.Allowed(),
+	}
+	if current := e.Player().CurrentServer(); current != nil {
+		entry.Server = current.Server().ServerInfo().Name()
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal chat log entry: %v", err)
+		return
+	}
+
+	key := fmt.Sprintf("%020d-%s", entry.Time.UnixNano(), l.h.Info.PodName)
+	if err := l.kv.Set(l.h.Context(), key, raw); err != nil {
+		log.Printf("Failed to log chat message of %s: %v", entry.Name, err)
+	}
+}
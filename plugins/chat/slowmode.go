@@ -0,0 +1,420 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+const (
+	// SlowModePermission lets staff set slow mode.
+	SlowModePermission = "csmc.chat.slowmode"
+	// SlowModeBypassPermission lets staff chat as often as they like.
+	SlowModeBypassPermission = "csmc.chat.slowmode.bypass"
+)
+
+const (
+	slowModeGlobalKey       = "slowmode.global"
+	slowModeServerKeyPrefix = "slowmode.server."
+)
+
+// SlowMode makes players wait between chat messages, on one backend or the
+// whole network.
+type SlowMode struct {
+	// Server is the backend it applies to, empty for the whole network
+	Server  string `json:"server,omitempty"`
+	Seconds int    `json:"seconds"`
+	Actor   string `json:"actor"`
+	// Until is when it ends on its own, zero if it doesn't
+	Until time.Time `json:"until"`
+}
+
+func (s SlowMode) key() string {
+	if s.Server == "" {
+		return slowModeGlobalKey
+	}
+
+	return slowModeServerKeyPrefix + s.Server
+}
+
+func (s SlowMode) expired(now time.Time) bool {
+	return !s.Until.IsZero() && !now.Before(s.Until)
+}
+
+func (s SlowMode) scope() string {
+	if s.Server == "" {
+		return "the network"
+	}
+
+	return s.Server
+}
+
+// slowMode enforces the slow modes staff set and that of incident mode,
+// whichever is the longest. The intervals are looked up for every message,
+// so they follow incident mode as it is switched.
+type slowMode struct {
+	h   *hosting.Hosting
+	prx *proxy.Proxy
+	kv  kv.Bucket
+	// incident is the interval of incident mode, 0 while it is off
+	incident func() time.Duration
+	// modes are the slow modes by key
+	modes map[string]SlowMode
+	// last is when players last chatted
+	last map[uuid.UUID]time.Time
+	// counting are the players shown a countdown right now
+	counting map[uuid.UUID]bool
+	m        sync.Mutex
+}
+
+func newSlowMode(h *hosting.Hosting, prx *proxy.Proxy, bucket kv.Bucket, incident func() time.Duration) *slowMode {
+	return &slowMode{
+		h:        h,
+		prx:      prx,
+		kv:       bucket,
+		incident: incident,
+		modes:    make(map[string]SlowMode),
+		last:     make(map[uuid.UUID]time.Time),
+		counting: make(map[uuid.UUID]bool),
+	}
+}
+
+func (s *slowMode) Reload(ctx context.Context) error {
+	keys, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	modes := make(map[string]SlowMode)
+	for _, key := range keys {
+		if key != slowModeGlobalKey && !strings.HasPrefix(key, slowModeServerKeyPrefix) {
+			continue
+		}
+
+		raw, err := s.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		mode := SlowMode{}
+		if err := json.Unmarshal(raw, &mode); err != nil {
+			log.Printf("Failed to unmarshal slow mode %s: %v", key, err)
+			continue
+		}
+
+		modes[key] = mode
+	}
+
+	s.m.Lock()
+	s.modes = modes
+	s.m.Unlock()
+
+	return nil
+}
+
+func (s *slowMode) handleChange(v *kv.Value) {
+	if v == nil || (v.Key != slowModeGlobalKey && !strings.HasPrefix(v.Key, slowModeServerKeyPrefix)) {
+		return
+	}
+
+	if v.Operation == kv.Delete {
+		s.m.Lock()
+		old, ok := s.modes[v.Key]
+		delete(s.modes, v.Key)
+		s.m.Unlock()
+
+		if ok {
+			s.announce(old.Server, &Text{Content: "Slow mode is off.", S: Style{Color: color.Green}})
+		}
+		return
+	}
+
+	mode := SlowMode{}
+	if err := json.Unmarshal(v.Value, &mode); err != nil {
+		log.Printf("Failed to unmarshal slow mode %s: %v", v.Key, err)
+		return
+	}
+
+	s.m.Lock()
+	old, ok := s.modes[v.Key]
+	s.modes[v.Key] = mode
+	s.m.Unlock()
+
+	if !ok || old.Seconds != mode.Seconds {
+		s.announce(mode.Server, &Text{Content: fmt.Sprintf("Slow mode is on, one message every %ds.", mode.Seconds), S: Style{Color: color.Gold}})
+	}
+}
+
+// announce tells the players on the server, or all of this proxy if it is
+// empty, about a change of slow mode.
+func (s *slowMode) announce(server string, msg Component) {
+	for _, player := range s.prx.Players() {
+		if server == "" {
+			_ = player.SendMessage(msg)
+			continue
+		}
+
+		if current := player.CurrentServer(); current != nil && current.Server().ServerInfo().Name() == server {
+			_ = player.SendMessage(msg)
+		}
+	}
+}
+
+// expire deletes the slow modes that ended every few seconds. Every proxy
+// does, the first one wins and the others find the key gone.
+func (s *slowMode) expire(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, mode := range s.List() {
+				if !mode.expired(now) {
+					continue
+				}
+
+				if err := s.kv.Delete(ctx, mode.key()); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+					log.Printf("Failed to end the slow mode of %s: %v", mode.scope(), err)
+				}
+			}
+		}
+	}
+}
+
+// List returns the slow modes, that of the network first.
+func (s *slowMode) List() []SlowMode {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	list := make([]SlowMode, 0, len(s.modes))
+	for _, mode := range s.modes {
+		list = append(list, mode)
+	}
+
+	slices.SortFunc(list, func(a, b SlowMode) int {
+		return strings.Compare(a.Server, b.Server)
+	})
+
+	return list
+}
+
+// Set stores the slow mode for every proxy, one of 0 seconds turns it off.
+func (s *slowMode) Set(ctx context.Context, mode SlowMode) error {
+	if mode.Seconds < 0 {
+		return errors.New("seconds must not be negative")
+	}
+
+	action := "chat.slowmode.set"
+	if mode.Seconds == 0 {
+		action = "chat.slowmode.off"
+		if err := s.kv.Delete(ctx, mode.key()); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return err
+		}
+	} else {
+		raw, err := json.Marshal(mode)
+		if err != nil {
+			return err
+		}
+
+		if err := s.kv.Set(ctx, mode.key(), raw); err != nil {
+			return err
+		}
+	}
+
+	details := map[string]string{"seconds": fmt.Sprint(mode.Seconds)}
+	if !mode.Until.IsZero() {
+		details["until"] = mode.Until.Format(time.RFC3339)
+	}
+
+	return s.h.Audit().Record(ctx, audit.Entry{Actor: mode.Actor, Action: action, Target: mode.scope(), Details: details})
+}
+
+// interval is how long the player has to wait between messages.
+func (s *slowMode) interval(player proxy.Player, now time.Time) time.Duration {
+	interval := s.incident()
+
+	keys := []string{slowModeGlobalKey}
+	if current := player.CurrentServer(); current != nil {
+		keys = append(keys, slowModeServerKeyPrefix+current.Server().ServerInfo().Name())
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, key := range keys {
+		if mode, ok := s.modes[key]; ok && !mode.expired(now) {
+			interval = max(interval, time.Duration(mode.Seconds)*time.Second)
+		}
+	}
+
+	return interval
+}
+
+func (s *slowMode) filter(player proxy.Player, message string) (string, bool) {
+	if player.HasPermission(SlowModeBypassPermission) {
+		return message, true
+	}
+
+	now := time.Now()
+	interval := s.interval(player, now)
+	if interval <= 0 {
+		return message, true
+	}
+
+	s.m.Lock()
+	next := s.last[player.ID()].Add(interval)
+	allowed := !now.Before(next)
+	if allowed {
+		s.last[player.ID()] = now
+	}
+	counting := s.counting[player.ID()]
+	if !allowed {
+		s.counting[player.ID()] = true
+	}
+	s.m.Unlock()
+
+	if allowed {
+		return message, true
+	}
+
+	_ = player.SendMessage(&Text{Content: fmt.Sprintf("Slow mode is on, one message every %s.", interval), S: Style{Color: color.Red}})
+	if !counting {
+		go s.countdown(player, next)
+	}
+
+	return "", false
+}
+
+// countdown shows the player in the action bar how long until they may chat
+// again.
+func (s *slowMode) countdown(player proxy.Player, next time.Time) {
+	defer s.h.Recover("Chat")
+	defer func() {
+		s.m.Lock()
+		delete(s.counting, player.ID())
+		s.m.Unlock()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		left := time.Until(next)
+		if left <= 0 {
+			_ = player.SendActionBar(&Text{Content: "You can chat again.", S: Style{Color: color.Green}})
+			return
+		}
+
+		_ = player.SendActionBar(&Text{Content: fmt.Sprintf("You can chat again in %s", left.Round(time.Second)), S: Style{Color: color.Gold}})
+
+		select {
+		case <-player.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *slowMode) onDisconnect(e *proxy.DisconnectEvent) {
+	s.m.Lock()
+	delete(s.last, e.Player().ID())
+	s.m.Unlock()
+}
+
+func actor(source command.Source) string {
+	if player, ok := source.(proxy.Player); ok {
+		return player.Username()
+	}
+
+	return "console"
+}
+
+// command sets slow mode: /slowmode <seconds> [server|global] [duration],
+// where server is the one of the player, global is the default and the
+// duration, like 10m, ends it on its own. 0 seconds turns it off.
+func (s *slowMode) command() brigodier.LiteralNodeBuilder {
+	set := func(c *command.Context, global bool, duration string) error {
+		if !c.Source.HasPermission(SlowModePermission) {
+			return c.Source.SendMessage(&Text{Content: "You do not have permission to set slow mode.", S: Style{Color: color.Red}})
+		}
+
+		mode := SlowMode{Seconds: max(0, c.Int("seconds")), Actor: actor(c.Source)}
+
+		if !global {
+			player, ok := c.Source.(proxy.Player)
+			if !ok || player.CurrentServer() == nil {
+				return c.Source.SendMessage(&Text{Content: "You are not on a server, use global instead.", S: Style{Color: color.Red}})
+			}
+
+			mode.Server = player.CurrentServer().Server().ServerInfo().Name()
+		}
+
+		if duration != "" {
+			d, err := time.ParseDuration(duration)
+			if err != nil || d <= 0 {
+				return c.Source.SendMessage(&Text{Content: "Invalid duration " + duration + ", use e.g. 10m.", S: Style{Color: color.Red}})
+			}
+
+			mode.Until = time.Now().Add(d)
+		}
+
+		if err := s.Set(c.Context, mode); err != nil {
+			return err
+		}
+
+		content := fmt.Sprintf("Slow mode of %s is %ds", mode.scope(), mode.Seconds)
+		if mode.Seconds == 0 {
+			content = "Slow mode of " + mode.scope() + " is off"
+		} else if !mode.Until.IsZero() {
+			content += " until " + mode.Until.Format(time.Kitchen)
+		}
+
+		return c.Source.SendMessage(&Text{Content: content + ".", S: Style{Color: color.Green}})
+	}
+
+	scope := func(name string, global bool) brigodier.LiteralNodeBuilder {
+		return brigodier.Literal(name).
+			Executes(command.Command(func(c *command.Context) error {
+				return set(c, global, "")
+			})).
+			Then(brigodier.Argument("duration", brigodier.String).
+				Executes(command.Command(func(c *command.Context) error {
+					return set(c, global, c.String("duration"))
+				})))
+	}
+
+	return brigodier.Literal("slowmode").
+		Then(brigodier.Argument("seconds", brigodier.Int).
+			Executes(command.Command(func(c *command.Context) error {
+				return set(c, true, "")
+			})).
+			Then(scope("global", true)).
+			Then(scope("server", false)))
+}
+
+func (s *slowMode) handleList(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, s.List())
+}
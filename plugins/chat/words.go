@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// blockWords masks the words with asterisks, ignoring case, and calls caught
+// with the sender. Masking is a moderation decision, so in monitor mode it is
+// only logged.
+func blockWords(h *hosting.Hosting, words []string, caught func(player proxy.Player)) Filter {
+	lower := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			lower = append(lower, w)
+		}
+	}
+
+	return func(player proxy.Player, message string) (string, bool) {
+		masked := []byte(message)
+		found := false
+
+		// Messages are matched lowercase, which keeps byte offsets for the
+		// ASCII words this is meant for
+		haystack := strings.ToLower(message)
+		if len(haystack) != len(message) {
+			return message, true
+		}
+
+		for _, w := range lower {
+			for i := 0; ; {
+				j := strings.Index(haystack[i:], w)
+				if j < 0 {
+					break
+				}
+
+				for k := i + j; k < i+j+len(w); k++ {
+					masked[k] = '*'
+				}
+
+				found = true
+				i += j + len(w)
+			}
+		}
+
+		if !found || !h.Enforce("Chat", "blocked_word", player.Username()) {
+			return message, true
+		}
+
+		caught(player)
+
+		return string(masked), true
+	}
+}
@@ -0,0 +1,238 @@
+// Package client detects the client of every player, its brand and the mods
+// it announces, for other plugins to look up. Policies block clients by
+// brand or mod, on the whole network or on the servers a selector matches,
+// e.g. known cheat clients on competitive gamemodes.
+//
+// The brand comes from the minecraft:brand channel, the mods from the
+// namespaces of the channels the client registers, which mod loaders like
+// Fabric and Forge do for every mod with networking. Mods without channels
+// and clients that hide them are not detected, so a policy is no anticheat.
+package client
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+var detected = metrics.NewCounterVec("gate_client_brands_total", "Players whose client brand was detected, by brand family.", "brand")
+
+// families are the brands counted by name in metrics, others count as other
+// so a client can't add series by sending made up brands.
+var families = []string{"vanilla", "fabric", "quilt", "forge", "neoforge", "optifine", "lunarclient", "badlion", "feather", "labymod", "geyser"}
+
+// ignored are the namespaces of channels that aren't mods.
+var ignored = []string{"minecraft", "bungeecord", "velocity", "csmc"}
+
+// Info is what is known about the client of a player.
+type Info struct {
+	Brand string `json:"brand"`
+	// Family is the lowercase brand without its version, e.g. lunarclient
+	// for lunarclient:v2.16
+	Family string `json:"family"`
+	// Loader is the mod loader of the client, empty for vanilla
+	Loader string `json:"loader,omitempty"`
+	// Mods are the sorted namespaces of the channels the client registered
+	Mods []string `json:"mods"`
+}
+
+// Stats is the distribution of the clients of the players on this proxy.
+type Stats struct {
+	Players  int            `json:"players"`
+	Families map[string]int `json:"families"`
+	Mods     map[string]int `json:"mods"`
+}
+
+// Clients is shared with the plugins that look up clients, it is filled as
+// players announce them.
+type Clients struct {
+	players map[uuid.UUID]*Info
+	m       sync.RWMutex
+}
+
+func NewClients() *Clients {
+	return &Clients{players: make(map[uuid.UUID]*Info)}
+}
+
+// Brand returns the client brand of the player, empty until the client sent
+// it.
+func (c *Clients) Brand(player proxy.Player) string {
+	info, _ := c.Info(player.ID())
+	return info.Brand
+}
+
+// Loader returns the mod loader of the client of the player, empty for
+// vanilla clients and before the client announced itself.
+func (c *Clients) Loader(player proxy.Player) string {
+	info, _ := c.Info(player.ID())
+	return info.Loader
+}
+
+// Mods returns the mods the client of the player announced.
+func (c *Clients) Mods(player proxy.Player) []string {
+	info, _ := c.Info(player.ID())
+	return info.Mods
+}
+
+// Info returns what is known about the client of the player, false if the
+// player isn't on this proxy.
+func (c *Clients) Info(id uuid.UUID) (Info, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	info, ok := c.players[id]
+	if !ok {
+		return Info{}, false
+	}
+
+	i := *info
+	i.Mods = slices.Clone(info.Mods)
+
+	return i, true
+}
+
+func (c *Clients) Stats() Stats {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	s := Stats{Players: len(c.players), Families: make(map[string]int), Mods: make(map[string]int)}
+	for _, info := range c.players {
+		family := info.Family
+		if family == "" {
+			family = "unknown"
+		}
+		s.Families[family]++
+
+		for _, mod := range info.Mods {
+			s.Mods[mod]++
+		}
+	}
+
+	return s
+}
+
+func (c *Clients) update(id uuid.UUID, fn func(info *Info)) Info {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	info, ok := c.players[id]
+	if !ok {
+		info = &Info{Mods: make([]string, 0)}
+		c.players[id] = info
+	}
+
+	fn(info)
+
+	i := *info
+	i.Mods = slices.Clone(info.Mods)
+
+	return i
+}
+
+func (c *Clients) setBrand(id uuid.UUID, brand string) Info {
+	detected.Inc(metricFamily(Family(brand)))
+
+	return c.update(id, func(info *Info) {
+		info.Brand, info.Family = brand, Family(brand)
+		info.Loader = loaderOf(info)
+	})
+}
+
+// addChannels adds the mods of the registered channels and reports whether
+// there were new ones.
+func (c *Clients) addChannels(id uuid.UUID, channels []string) (Info, bool) {
+	added := false
+
+	info := c.update(id, func(info *Info) {
+		for _, channel := range channels {
+			mod := modOf(channel)
+			if mod == "" || slices.Contains(info.Mods, mod) {
+				continue
+			}
+
+			info.Mods = append(info.Mods, mod)
+			added = true
+		}
+
+		slices.Sort(info.Mods)
+		info.Loader = loaderOf(info)
+	})
+
+	return info, added
+}
+
+func (c *Clients) remove(id uuid.UUID) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	delete(c.players, id)
+}
+
+// Family returns the lowercase brand up to its first separator, so versions
+// of a client share a family.
+func Family(brand string) string {
+	brand = strings.ToLower(strings.TrimSpace(brand))
+	if i := strings.IndexAny(brand, " :/"); i >= 0 {
+		brand = brand[:i]
+	}
+
+	return brand
+}
+
+func metricFamily(family string) string {
+	if slices.Contains(families, family) {
+		return family
+	}
+
+	return "other"
+}
+
+// loaderOf returns the loader the client names in its brand, or else the one
+// whose channels it registered.
+func loaderOf(info *Info) string {
+	switch info.Family {
+	case "forge", "neoforge", "fabric", "quilt":
+		return info.Family
+	}
+
+	switch {
+	case slices.Contains(info.Mods, "neoforge"):
+		return "neoforge"
+	case slices.Contains(info.Mods, "forge"), slices.Contains(info.Mods, "fml"):
+		return "forge"
+	case slices.Contains(info.Mods, "quilt"):
+		return "quilt"
+	case slices.Contains(info.Mods, "fabric"):
+		return "fabric"
+	}
+
+	return ""
+}
+
+// modOf returns the namespace of a channel, empty for those of the game and
+// the proxy and for legacy channels without one.
+func modOf(channel string) string {
+	namespace, _, ok := strings.Cut(strings.ToLower(channel), ":")
+	if !ok || namespace == "" || slices.Contains(ignored, namespace) {
+		return ""
+	}
+
+	return namespace
+}
+
+// parseChannels splits the payload of a register message, NUL separated
+// channel names.
+func parseChannels(data []byte) []string {
+	channels := make([]string, 0)
+	for _, channel := range strings.Split(string(data), "\x00") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
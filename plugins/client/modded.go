@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/transfer"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var (
+	moddedDenied      = metrics.NewCounterVec("gate_modded_denied_total", "Players kept off a modded group, by what their client lacked.", "reason")
+	moddedPassthrough = metrics.NewCounterVec("gate_modded_passthrough_total", "Players transferred to a modded group in passthrough mode, by result.", "result")
+)
+
+var loaderNames = map[string]string{"forge": "Forge", "neoforge": "NeoForge", "fabric": "Fabric", "quilt": "Quilt"}
+
+// incompatible returns why the client can't join a modded group of the
+// server, and the reason for metrics. Mods are only checked with checkMods,
+// clients register their channels a moment after the brand.
+func incompatible(server string, cfg hosting.ModdedConfig, info Info, checkMods bool) (string, string) {
+	loader := loaderNames[cfg.Loader]
+
+	if info.Loader == "" {
+		msg := fmt.Sprintf("%s is a modded server, please join it with %s", server, loader)
+		if len(cfg.Mods) > 0 {
+			msg += " and the mods " + strings.Join(cfg.Mods, ", ")
+		}
+
+		return msg + ".", "vanilla"
+	}
+
+	if info.Loader != cfg.Loader {
+		return fmt.Sprintf("%s needs %s, your client runs %s.", server, loader, loaderNames[info.Loader]), "loader"
+	}
+
+	if missing := cfg.Missing(info.Mods); checkMods && len(missing) > 0 {
+		return fmt.Sprintf("%s needs the mods %s, which your client doesn't have.", server, strings.Join(missing, ", ")), "mods"
+	}
+
+	return "", ""
+}
+
+// checkModded keeps players off modded groups their client doesn't match
+// and transfers those that match a passthrough group, reporting whether the
+// connection was denied.
+func (p *ClientPlugin) checkModded(e *proxy.ServerPreConnectEvent) bool {
+	player, name := e.Player(), e.Server().ServerInfo().Name()
+
+	cfg, ok, err := p.mgr.Modded(player.Context(), e.Server())
+	if err != nil {
+		log.Printf("Failed to get the modded config of %s: %v", name, err)
+		return false
+	} else if !ok {
+		return false
+	}
+
+	info, known := p.clients.Info(player.ID())
+	if !known || info.Brand == "" {
+		// The initial server is chosen before the client announces itself,
+		// onBrand checks it once it did. Passthrough needs a server to
+		// transfer from.
+		if !cfg.Passthrough() {
+			return false
+		}
+
+		e.Deny()
+		_ = player.SendMessage(&Text{Content: name + " can only be joined from another server.", S: Style{Color: color.Red}})
+		return true
+	}
+
+	if msg, reason := incompatible(name, cfg, info, true); msg != "" {
+		p.h.Tracef(player.Username(), "client: %s client can't join modded %s", reason, name)
+
+		moddedDenied.Inc(reason)
+		e.Deny()
+		_ = player.SendMessage(&Text{Content: msg, S: Style{Color: color.Red}})
+		return true
+	}
+
+	if !cfg.Passthrough() {
+		return false
+	}
+
+	e.Deny()
+	go p.passthrough(player, name, cfg)
+
+	return true
+}
+
+// passthrough transfers the player to the modded backend, Gate can't relay
+// the loader handshake.
+func (p *ClientPlugin) passthrough(player proxy.Player, server string, cfg hosting.ModdedConfig) {
+	defer p.h.Recover("Client")
+
+	ctx, cancel := context.WithTimeout(player.Context(), 5*time.Second)
+	defer cancel()
+
+	p.h.Tracef(player.Username(), "client: passing through to %s at %s:%d", server, cfg.Host, cfg.Port)
+
+	err := p.mgr.Transfer(ctx, player, cfg.Host, cfg.Port, nil)
+	switch {
+	case errors.Is(err, transfer.ErrUnsupported):
+		moddedPassthrough.Inc("unsupported")
+		_ = player.SendMessage(&Text{Content: server + " needs Minecraft 1.20.5 or newer.", S: Style{Color: color.Red}})
+	case err != nil:
+		log.Printf("Failed to transfer %s to modded %s: %v", player.Username(), server, err)
+		moddedPassthrough.Inc("failed")
+		_ = player.SendMessage(&Text{Content: "Failed to connect you to " + server + ", please try again later.", S: Style{Color: color.Red}})
+	default:
+		moddedPassthrough.Inc("transferred")
+	}
+}
+
+// checkCurrent disconnects the player if their client can't be on the
+// modded group of the current server, e.g. a vanilla client that was sent
+// there as the initial server.
+func (p *ClientPlugin) checkCurrent(player proxy.Player, info Info) bool {
+	s := player.CurrentServer()
+	if s == nil {
+		return false
+	}
+
+	name := s.Server().ServerInfo().Name()
+	cfg, ok, err := p.mgr.Modded(player.Context(), s.Server())
+	if err != nil {
+		log.Printf("Failed to get the modded config of %s: %v", name, err)
+		return false
+	} else if !ok {
+		return false
+	}
+
+	msg, reason := incompatible(name, cfg, info, false)
+	if msg == "" {
+		return false
+	}
+
+	moddedDenied.Inc(reason)
+	go player.Disconnect(&Text{Content: msg, S: Style{Color: color.Red}})
+
+	return true
+}
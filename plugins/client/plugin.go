@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/common/minecraft/key"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/edition/java/proxy/message"
+)
+
+var blocked = metrics.NewCounterVec("gate_client_blocked_total", "Players a client policy rule blocked, by whether they were disconnected or denied a server.", "result")
+
+var (
+	// RegisterChannel is where clients since 1.13 register their channels.
+	RegisterChannel = &message.MinecraftChannelIdentifier{Key: key.New("minecraft", "register")}
+	// LegacyRegisterChannel is used by clients before 1.13.
+	LegacyRegisterChannel = message.LegacyChannelIdentifier("REGISTER")
+)
+
+type ClientPlugin struct {
+	prx     *proxy.Proxy
+	h       *hosting.Hosting
+	mgr     *hosting.InstanceManager
+	clients *Clients
+	key     *kv.TypedKey[*Policy]
+
+	policy *Policy
+	m      sync.RWMutex
+}
+
+func New(h *hosting.Hosting, clients *Clients) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Client",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_clients")
+			if err != nil {
+				return err
+			}
+
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			p := &ClientPlugin{
+				prx:     prx,
+				h:       h,
+				mgr:     mgr,
+				clients: clients,
+				key:     kv.Typed[*Policy](bucket, policyKey).Default(defaultPolicy).Validate((*Policy).compile),
+				policy:  defaultPolicy(),
+			}
+
+			return p.Init()
+		},
+	}, nil
+}
+
+func (p *ClientPlugin) Init() error {
+	p.h.Go("Client", func(ctx context.Context) {
+		p.key.Watch(ctx, p.setPolicy)
+	})
+
+	p.prx.ChannelRegistrar().Register(RegisterChannel, LegacyRegisterChannel)
+
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Client", p.onBrand))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Client", p.onPluginMessage))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Client", p.onServerPreConnect))
+	// Last, so other plugins can still look up the client on disconnect
+	event.Subscribe(p.prx.Event(), -1, hosting.Guard(p.h, "Client", p.onDisconnect))
+
+	p.h.API().HandleFunc("GET /clients", p.handleStats)
+	p.h.API().HandleFunc("GET /clients/policy", p.handleGetPolicy)
+	p.h.API().HandleFunc("PUT /clients/policy", p.handleSetPolicy)
+	p.h.API().HandleFunc("GET /clients/{player}", p.handleGet)
+
+	return nil
+}
+
+func (p *ClientPlugin) setPolicy(policy *Policy) {
+	// A stored null decodes to nil
+	if policy == nil {
+		policy = defaultPolicy()
+	}
+
+	p.m.Lock()
+	p.policy = policy
+	p.m.Unlock()
+}
+
+func (p *ClientPlugin) Policy() *Policy {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.policy
+}
+
+func (p *ClientPlugin) onBrand(e *proxy.PlayerClientBrandEvent) {
+	info := p.clients.setBrand(e.Player().ID(), e.Brand())
+	p.h.Tracef(e.Player().Username(), "client: brand %q", e.Brand())
+
+	if p.checkCurrent(e.Player(), info) {
+		return
+	}
+
+	p.check(e.Player(), info)
+}
+
+func (p *ClientPlugin) onPluginMessage(e *proxy.PluginMessageEvent) {
+	id := e.Identifier().ID()
+	if id != RegisterChannel.ID() && id != LegacyRegisterChannel.ID() {
+		return
+	}
+
+	// Only what the client registers tells about its mods, the backend
+	// registers channels too
+	player, ok := e.Source().(proxy.Player)
+	if !ok {
+		return
+	}
+
+	info, added := p.clients.addChannels(player.ID(), parseChannels(e.Data()))
+	if !added {
+		return
+	}
+
+	p.h.Tracef(player.Username(), "client: mods %v", info.Mods)
+	p.check(player, info)
+}
+
+// check disconnects the player if a rule blocks its client on the current
+// server, or on the network. Brands and mods arrive after the player joined
+// a server, so that's the earliest they can be blocked.
+func (p *ClientPlugin) check(player proxy.Player, info Info) {
+	labels := map[string]string{}
+	if s := player.CurrentServer(); s != nil {
+		var err error
+		if labels, err = p.mgr.Labels(player.Context(), s.Server().ServerInfo().Name()); err != nil {
+			log.Printf("Failed to get labels of %s: %v", s.Server().ServerInfo().Name(), err)
+		}
+	}
+
+	r, ok := p.Policy().Blocks(info, labels)
+	if !ok {
+		return
+	}
+
+	log.Printf("Client of %s is blocked, brand %q, mods %v", player.Username(), info.Brand, info.Mods)
+
+	if !p.h.Enforce("Client", "policy", player.Username()) {
+		return
+	}
+
+	blocked.Inc("disconnected")
+	go player.Disconnect(&Text{Content: r.message(), S: Style{Color: color.Red}})
+}
+
+func (p *ClientPlugin) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
+	if !e.Allowed() || e.Server() == nil || p.checkModded(e) {
+		return
+	}
+
+	info, ok := p.clients.Info(e.Player().ID())
+	if !ok {
+		return
+	}
+
+	name := e.Server().ServerInfo().Name()
+	labels, err := p.mgr.Labels(e.Player().Context(), name)
+	if err != nil {
+		log.Printf("Failed to get labels of %s: %v", name, err)
+		return
+	}
+
+	r, ok := p.Policy().Blocks(info, labels)
+	if !ok {
+		return
+	}
+
+	p.h.Tracef(e.Player().Username(), "client: blocked from %s", name)
+
+	if !p.h.Enforce("Client", "policy", e.Player().Username()) {
+		return
+	}
+
+	blocked.Inc("denied")
+	e.Deny()
+	_ = e.Player().SendMessage(&Text{Content: r.message(), S: Style{Color: color.Red}})
+}
+
+func (p *ClientPlugin) onDisconnect(e *proxy.DisconnectEvent) {
+	p.clients.remove(e.Player().ID())
+}
+
+func (p *ClientPlugin) handleStats(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.clients.Stats())
+}
+
+func (p *ClientPlugin) handleGet(w http.ResponseWriter, r *http.Request) {
+	player := p.prx.PlayerByName(r.PathValue("player"))
+	if player == nil {
+		api.WriteError(w, http.StatusNotFound, errors.New("player is not on this proxy"))
+		return
+	}
+
+	info, _ := p.clients.Info(player.ID())
+	api.WriteJSON(w, http.StatusOK, info)
+}
+
+func (p *ClientPlugin) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.Policy())
+}
+
+func (p *ClientPlugin) handleSetPolicy(w http.ResponseWriter, r *http.Request) {
+	policy := &Policy{}
+	if err := api.ReadJSON(r, policy); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := policy.compile(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.key.Set(r.Context(), policy); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	p.setPolicy(policy)
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "clients.policy", Target: policyKey}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, policy)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+)
+
+const policyKey = "policy"
+
+// Rule blocks clients whose lowercase brand matches Brand or that announce a
+// mod matching Mod, path.Match patterns like lunarclient* or
+// wurst. Selector limits it to servers whose labels match, e.g.
+// gamemode=bedwars, without one it applies to the whole network.
+type Rule struct {
+	Brand    string `json:"brand,omitempty"`
+	Mod      string `json:"mod,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	// Message is shown to blocked players
+	Message string `json:"message,omitempty"`
+
+	sel registry.Selector
+}
+
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+func defaultPolicy() *Policy {
+	return &Policy{Rules: make([]Rule, 0)}
+}
+
+func (p *Policy) compile() error {
+	for i, r := range p.Rules {
+		if r.Brand == "" && r.Mod == "" {
+			return fmt.Errorf("rule %d: brand or mod is required", i)
+		}
+
+		for _, pattern := range []string{r.Brand, r.Mod} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid pattern %q", i, pattern)
+			}
+		}
+
+		sel, err := registry.Parse(r.Selector)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		p.Rules[i].sel = sel
+	}
+
+	return nil
+}
+
+// Blocks returns the first rule that blocks the client on a server with the
+// labels.
+func (p *Policy) Blocks(info Info, labels map[string]string) (Rule, bool) {
+	for _, r := range p.Rules {
+		if r.matches(info) && r.sel.Matches(labels) {
+			return r, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+func (r Rule) matches(info Info) bool {
+	if r.Brand != "" && info.Brand != "" {
+		if ok, _ := path.Match(r.Brand, strings.ToLower(info.Brand)); ok {
+			return true
+		}
+	}
+
+	if r.Mod != "" {
+		for _, mod := range info.Mods {
+			if ok, _ := path.Match(r.Mod, mod); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (r Rule) message() string {
+	if r.Message != "" {
+		return r.Message
+	}
+
+	return "Your client is not allowed here."
+}
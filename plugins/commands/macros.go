@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+const macroKeyPrefix = "macro."
+
+var ErrMacroNotFound = errors.New("macro not found")
+
+type StepType string
+
+const (
+	// StepCommand runs a command as the player, on the proxy if it has the
+	// command and on the backend otherwise. The command policy applies like
+	// to a typed command.
+	StepCommand StepType = "command"
+	// StepSend connects the player to a server, selector or gamemode.
+	StepSend StepType = "send"
+	// StepMessage sends a message with & color codes to the player.
+	StepMessage StepType = "message"
+	// StepBroadcast sends a message with & color codes to everyone on
+	// this proxy.
+	StepBroadcast StepType = "broadcast"
+	// StepTabHeader sets the tab list header of everyone on this proxy and
+	// clears the footer.
+	StepTabHeader StepType = "tabheader"
+)
+
+type Step struct {
+	Type  StepType `json:"type"`
+	Value string   `json:"value"`
+}
+
+// Macro is a command defined in KV. A macro with a single command step is an
+// alias. Step values expand {player}, {uuid}, {server}, {ping}, {args}, {1},
+// {2}, ... and {experiment:<name>}.
+type Macro struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Permission  string `json:"permission,omitempty"`
+	Steps       []Step `json:"steps"`
+}
+
+func (m Macro) Validate() error {
+	if m.Name == "" || strings.ContainsAny(m.Name, " /:") {
+		return fmt.Errorf("invalid macro name %q", m.Name)
+	}
+
+	if len(m.Steps) == 0 {
+		return errors.New("macro has no steps")
+	}
+
+	for i, s := range m.Steps {
+		switch s.Type {
+		case StepCommand, StepSend, StepMessage, StepBroadcast, StepTabHeader:
+		default:
+			return fmt.Errorf("step %d: unknown type %q", i, s.Type)
+		}
+	}
+
+	return nil
+}
+
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// expand replaces the placeholders of a step value. vars holds the fixed
+// placeholders, experiment expands {experiment:<name>}.
+func expand(s string, vars map[string]string, args []string, experiment func(name string) string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		key := m[1 : len(m)-1]
+
+		if v, ok := vars[key]; ok {
+			return v
+		}
+
+		if key == "args" {
+			return strings.Join(args, " ")
+		}
+
+		if n, err := strconv.Atoi(key); err == nil {
+			if n >= 1 && n <= len(args) {
+				return args[n-1]
+			}
+
+			return ""
+		}
+
+		if name, ok := strings.CutPrefix(key, "experiment:"); ok {
+			return experiment(name)
+		}
+
+		return m
+	})
+}
+
+// Macros keeps the macros of the commands bucket in memory.
+type Macros struct {
+	kv     kv.Bucket
+	macros map[string]Macro
+	m      sync.RWMutex
+}
+
+func NewMacros(bucket kv.Bucket) *Macros {
+	return &Macros{kv: bucket, macros: make(map[string]Macro)}
+}
+
+func (m *Macros) Reload(ctx context.Context) error {
+	keys, err := m.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	macros := make(map[string]Macro)
+	for _, key := range keys {
+		name, ok := strings.CutPrefix(key, macroKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		raw, err := m.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		macro := Macro{}
+		if err := json.Unmarshal(raw, &macro); err != nil {
+			log.Printf("Failed to unmarshal macro %s: %v", key, err)
+			continue
+		}
+
+		macros[name] = macro
+	}
+
+	m.m.Lock()
+	m.macros = macros
+	m.m.Unlock()
+
+	return nil
+}
+
+func (m *Macros) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	name, ok := strings.CutPrefix(v.Key, macroKeyPrefix)
+	if !ok {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		macro := Macro{}
+		if err := json.Unmarshal(v.Value, &macro); err != nil {
+			log.Printf("Failed to unmarshal macro %s: %v", v.Key, err)
+			return
+		}
+
+		m.macros[name] = macro
+
+	case kv.Delete:
+		delete(m.macros, name)
+	}
+}
+
+func (m *Macros) Get(name string) (Macro, bool) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	macro, ok := m.macros[name]
+
+	return macro, ok
+}
+
+func (m *Macros) List() []Macro {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	list := make([]Macro, 0, len(m.macros))
+	for _, macro := range m.macros {
+		list = append(list, macro)
+	}
+
+	slices.SortFunc(list, func(a, b Macro) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (m *Macros) Set(ctx context.Context, macro Macro) error {
+	if err := macro.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(macro)
+	if err != nil {
+		return err
+	}
+
+	if err := m.kv.Set(ctx, macroKeyPrefix+macro.Name, raw); err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	m.macros[macro.Name] = macro
+	m.m.Unlock()
+
+	return nil
+}
+
+func (m *Macros) Delete(ctx context.Context, name string) error {
+	if err := m.kv.Delete(ctx, macroKeyPrefix+name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrMacroNotFound
+	} else if err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	delete(m.macros, name)
+	m.m.Unlock()
+
+	return nil
+}
@@ -0,0 +1,340 @@
+// Package commands decides which player commands the proxy handles, which
+// are forwarded to backends and which are blocked, and runs the aliases and
+// macros defined in KV.
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var decisions = metrics.NewCounterVec("gate_command_policy_decisions_total", "Player commands a policy rule applied to, by action.", "action")
+
+type CommandsPlugin struct {
+	prx      *proxy.Proxy
+	h        *hosting.Hosting
+	mgr      *hosting.InstanceManager
+	policies *Policies
+	macros   *Macros
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Commands",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_commands")
+			if err != nil {
+				return err
+			}
+
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			p := &CommandsPlugin{prx: prx, h: h, mgr: mgr, policies: NewPolicies(bucket), macros: NewMacros(bucket)}
+
+			return p.Init(bucket)
+		},
+	}, nil
+}
+
+func (p *CommandsPlugin) Init(bucket kv.Bucket) error {
+	p.h.Go("Commands", func(ctx context.Context) {
+		kv.Watch(ctx, bucket, p.handleChange, p.reload)
+	})
+
+	p.h.OnReload("Commands", p.reload)
+	p.h.Warmup("commands", hosting.WarmupFailOpen, p.reload)
+
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Commands", p.onCommand))
+
+	p.h.API().HandleFunc("GET /commands/policy", p.handleGetPolicy)
+	p.h.API().HandleFunc("PUT /commands/policy", p.handleSetPolicy)
+	p.h.API().HandleFunc("GET /commands/macros", p.handleListMacros)
+	p.h.API().HandleFunc("PUT /commands/macros/{name}", p.handleSetMacro)
+	p.h.API().HandleFunc("DELETE /commands/macros/{name}", p.handleDeleteMacro)
+
+	return nil
+}
+
+func (p *CommandsPlugin) reload(ctx context.Context) error {
+	if err := p.policies.Reload(ctx); err != nil {
+		return err
+	}
+
+	return p.macros.Reload(ctx)
+}
+
+func (p *CommandsPlugin) handleChange(v *kv.Value) {
+	p.policies.handleChange(v)
+	p.macros.handleChange(v)
+}
+
+func (p *CommandsPlugin) onCommand(e *proxy.CommandExecuteEvent) {
+	player, ok := e.Source().(proxy.Player)
+	if !ok || !e.Allowed() {
+		return
+	}
+
+	if macro, ok := p.macros.Get(commandName(e.Command())); ok {
+		e.SetAllowed(false)
+		go p.runMacro(player, macro, e.Command())
+		return
+	}
+
+	action := p.policies.Policy().Decide(e.Command(), p.labels(player))
+	if action == "" {
+		return
+	}
+
+	decisions.Inc(string(action))
+
+	switch action {
+	case ActionDeny:
+		e.SetAllowed(false)
+		p.deny(player, e.Command())
+	case ActionForward:
+		e.SetForward(true)
+	case ActionProxy:
+		e.SetForward(false)
+	}
+}
+
+// labels are the labels of the player's current server, which the rules of
+// the policy select on.
+func (p *CommandsPlugin) labels(player proxy.Player) map[string]string {
+	labels := map[string]string{}
+	if s := player.CurrentServer(); s != nil {
+		var err error
+		if labels, err = p.mgr.Labels(player.Context(), s.Server().ServerInfo().Name()); err != nil {
+			log.Printf("Failed to get labels of %s: %v", s.Server().ServerInfo().Name(), err)
+		}
+	}
+
+	return labels
+}
+
+func (p *CommandsPlugin) deny(player proxy.Player, command string) {
+	log.Printf("Blocked command /%s of %s", command, player.Username())
+
+	_ = player.SendMessage(&Text{Content: "This command is not allowed.", S: Style{Color: color.Red}})
+}
+
+// macroDepth limits macros that run other macros, so a macro calling itself
+// ends.
+const macroDepth = 5
+
+// errMacroDenied stops a macro and the macros running it once the player was
+// told that a step isn't allowed.
+var errMacroDenied = errors.New("macro step denied")
+
+func (p *CommandsPlugin) runMacro(player proxy.Player, macro Macro, command string) {
+	defer p.h.Recover("Commands")
+
+	if err := p.run(player, macro, arguments(command), 0); errors.Is(err, errMacroDenied) {
+		return
+	} else if err != nil {
+		log.Printf("Failed to run macro %s of %s: %v", macro.Name, player.Username(), err)
+		_ = player.SendMessage(&Text{Content: "The command failed, please try again later.", S: Style{Color: color.Red}})
+	}
+}
+
+func (p *CommandsPlugin) run(player proxy.Player, macro Macro, args []string, depth int) error {
+	if macro.Permission != "" && !player.HasPermission(macro.Permission) {
+		_ = player.SendMessage(&Text{Content: "You don't have the permission to do that!", S: Style{Color: color.Red}})
+		return errMacroDenied
+	}
+
+	if depth >= macroDepth {
+		return fmt.Errorf("macros nested deeper than %d", macroDepth)
+	}
+
+	server := ""
+	if s := player.CurrentServer(); s != nil {
+		server = s.Server().ServerInfo().Name()
+	}
+
+	vars := map[string]string{
+		"player": player.Username(),
+		"uuid":   player.ID().String(),
+		"server": server,
+		"ping":   strconv.FormatInt(player.Ping().Milliseconds(), 10),
+	}
+
+	experiment := func(name string) string {
+		return p.h.Experiments().Variant(player.ID().String(), name)
+	}
+
+	for _, step := range macro.Steps {
+		value := expand(step.Value, vars, args, experiment)
+
+		switch step.Type {
+		case StepCommand:
+			value = strings.TrimPrefix(value, "/")
+
+			// Other macros run inline, everything else is routed like the
+			// player typing it. Neither the proxy's dispatcher nor the
+			// backend apply the policy, so it is applied here.
+			if next, ok := p.macros.Get(commandName(value)); ok {
+				if err := p.run(player, next, arguments(value), depth+1); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			action := p.policies.Policy().Decide(value, p.labels(player))
+			if action != "" {
+				decisions.Inc(string(action))
+			}
+
+			switch routeStep(action, p.prx.Command().Has(commandName(value))) {
+			case routeDeny:
+				p.deny(player, value)
+				return errMacroDenied
+			case routeProxy:
+				if err := p.prx.Command().Do(player.Context(), player, value); err != nil {
+					return err
+				}
+			case routeBackend:
+				if err := player.SpoofChatInput("/" + value); err != nil {
+					return err
+				}
+			}
+
+		case StepSend:
+			target, err := p.mgr.FindServer(player.Context(), value)
+			if err != nil {
+				return err
+			}
+
+			if _, err := p.mgr.Connect(player.Context(), player, target); err != nil {
+				return err
+			}
+
+		case StepMessage:
+			if err := player.SendMessage(util.Text(value)); err != nil {
+				return err
+			}
+
+		case StepBroadcast:
+			msg := util.Text(value)
+			for _, other := range p.prx.Players() {
+				_ = other.SendMessage(msg)
+			}
+
+		case StepTabHeader:
+			header := util.Text(value)
+			for _, other := range p.prx.Players() {
+				_ = other.TabList().SetHeaderFooter(header, &Text{})
+			}
+		}
+	}
+
+	return nil
+}
+
+// arguments returns the words of a command after its name.
+func arguments(command string) []string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return fields[1:]
+}
+
+func (p *CommandsPlugin) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.policies.Policy())
+}
+
+func (p *CommandsPlugin) handleSetPolicy(w http.ResponseWriter, r *http.Request) {
+	policy := &Policy{}
+	if err := api.ReadJSON(r, policy); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := policy.compile(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.policies.Set(r.Context(), policy); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "commands.policy", Target: policyKey}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, policy)
+}
+
+func (p *CommandsPlugin) handleListMacros(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.macros.List())
+}
+
+func (p *CommandsPlugin) handleSetMacro(w http.ResponseWriter, r *http.Request) {
+	macro := Macro{}
+	if err := api.ReadJSON(r, &macro); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	macro.Name = r.PathValue("name")
+	if err := macro.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.macros.Set(r.Context(), macro); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "commands.macro.set", Target: macro.Name}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, macro)
+}
+
+func (p *CommandsPlugin) handleDeleteMacro(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if err := p.macros.Delete(r.Context(), name); errors.Is(err, ErrMacroNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "commands.macro.delete", Target: name}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+const policyKey = "policy"
+
+type Action string
+
+const (
+	// ActionForward sends the command to the backend even if the proxy has
+	// a command of the same name.
+	ActionForward Action = "forward"
+	// ActionProxy only lets the proxy handle the command, it is never
+	// forwarded.
+	ActionProxy Action = "proxy"
+	ActionDeny  Action = "deny"
+)
+
+// Rule applies to a command, without namespace and leading slash, or to
+// every command with "*". Selector limits it to players on servers whose
+// labels match, e.g. type=minigame.
+type Rule struct {
+	Command  string `json:"command"`
+	Selector string `json:"selector,omitempty"`
+	Action   Action `json:"action"`
+
+	sel registry.Selector
+}
+
+// Policy decides for commands of players, console commands are never
+// affected. The first matching rule wins; without a match Gate's default
+// applies, proxy commands are handled and everything else is forwarded.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+func (p *Policy) compile() error {
+	for i, r := range p.Rules {
+		switch r.Action {
+		case ActionForward, ActionProxy, ActionDeny:
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i, r.Action)
+		}
+
+		if r.Command == "" {
+			return fmt.Errorf("rule %d: command is required", i)
+		}
+
+		sel, err := registry.Parse(r.Selector)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		p.Rules[i].sel = sel
+		p.Rules[i].Command = commandName(r.Command)
+	}
+
+	return nil
+}
+
+// Decide returns the action for the command, or "" if no rule matches.
+func (p *Policy) Decide(command string, labels map[string]string) Action {
+	name := commandName(command)
+
+	for _, r := range p.Rules {
+		if r.Command != "*" && r.Command != name {
+			continue
+		}
+
+		if !r.sel.Matches(labels) {
+			continue
+		}
+
+		return r.Action
+	}
+
+	return ""
+}
+
+type route int
+
+const (
+	routeDeny route = iota
+	routeProxy
+	routeBackend
+)
+
+// routeStep decides where a command step of a macro runs, given the action
+// of the policy and whether the proxy has the command. It mirrors Gate's
+// handling of a typed command: proxy commands run on the proxy and the rest
+// is forwarded, unless a rule says otherwise.
+func routeStep(action Action, onProxy bool) route {
+	switch action {
+	case ActionDeny:
+		return routeDeny
+	case ActionProxy:
+		return routeProxy
+	case ActionForward:
+		return routeBackend
+	}
+
+	if onProxy {
+		return routeProxy
+	}
+
+	return routeBackend
+}
+
+// commandName strips arguments, the leading slash and namespaces, so
+// "/minecraft:op Notch" becomes "op".
+func commandName(command string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(command), "/"), " ")
+
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return strings.ToLower(name)
+}
+
+// defaultPolicy blocks commands that must never reach a backend from a
+// player, even an opped one, until a policy is stored in KV.
+func defaultPolicy() *Policy {
+	p := &Policy{Rules: make([]Rule, 0)}
+
+	for _, c := range strings.Split(util.EnvWithDefault("COMMAND_BLOCKLIST", "op,deop,stop,restart,reload"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			p.Rules = append(p.Rules, Rule{Command: c, Action: ActionDeny})
+		}
+	}
+
+	if err := p.compile(); err != nil {
+		log.Fatalf("invalid COMMAND_BLOCKLIST: %v", err)
+	}
+
+	return p
+}
+
+// Policies keeps the policy of the commands bucket in memory.
+type Policies struct {
+	key    *kv.TypedKey[*Policy]
+	policy *Policy
+	m      sync.RWMutex
+}
+
+// NewPolicies starts out with the default policy until the "commands" warmup
+// loaded the stored one.
+func NewPolicies(bucket kv.Bucket) *Policies {
+	return &Policies{
+		key:    kv.Typed[*Policy](bucket, policyKey).Default(defaultPolicy).Validate((*Policy).compile),
+		policy: defaultPolicy(),
+	}
+}
+
+func (p *Policies) Reload(ctx context.Context) error {
+	policy, err := p.key.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.m.Lock()
+	p.policy = policy
+	p.m.Unlock()
+
+	return nil
+}
+
+func (p *Policies) handleChange(v *kv.Value) {
+	if v == nil || v.Key != policyKey {
+		return
+	}
+
+	if err := p.Reload(context.Background()); err != nil {
+		log.Printf("Failed to reload command policy: %v", err)
+	}
+}
+
+func (p *Policies) Policy() *Policy {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.policy
+}
+
+func (p *Policies) Set(ctx context.Context, policy *Policy) error {
+	if err := p.key.Set(ctx, policy); err != nil {
+		return err
+	}
+
+	p.m.Lock()
+	p.policy = policy
+	p.m.Unlock()
+
+	return nil
+}
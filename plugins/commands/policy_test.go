@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestMacroStepRoute(t *testing.T) {
+	policy := defaultPolicy()
+	policy.Rules = append(policy.Rules,
+		Rule{Command: "kill", Selector: "type=minigame", Action: ActionDeny},
+		Rule{Command: "list", Action: ActionForward},
+	)
+	if err := policy.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	noExperiment := func(string) string { return "" }
+
+	tests := []struct {
+		step    string
+		args    []string
+		labels  map[string]string
+		onProxy bool
+		route   route
+	}{
+		// Blocked like typed commands, namespaced or not
+		{"op {1}", []string{"Notch"}, nil, false, routeDeny},
+		{"minecraft:op {player}", nil, nil, false, routeDeny},
+		{"/deop {args}", []string{"Notch"}, nil, false, routeDeny},
+		{"kill {player}", nil, map[string]string{"type": "minigame"}, false, routeDeny},
+		{"kill {player}", nil, map[string]string{"type": "lobby"}, false, routeBackend},
+		// Proxy commands run on the proxy, the rest on the backend
+		{"server {1}", []string{"lobby"}, nil, true, routeProxy},
+		{"spawn", nil, nil, false, routeBackend},
+		{"list", nil, nil, true, routeBackend},
+	}
+
+	for _, test := range tests {
+		command := expand(test.step, map[string]string{"player": "Steve"}, test.args, noExperiment)
+		action := policy.Decide(command, test.labels)
+
+		if got := routeStep(action, test.onProxy); got != test.route {
+			t.Errorf("%q (%q): expected route %d, got %d", test.step, command, test.route, got)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/console"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/permission"
+)
+
+// ConsolePlugin runs the in-game commands from stdin and, if CONSOLE_SOCKET is
+// set, from connections to that unix socket.
+type ConsolePlugin struct {
+	prx *proxy.Proxy
+	h   *hosting.Hosting
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Console",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			p := &ConsolePlugin{prx: prx, h: h}
+
+			return p.Init()
+		},
+	}, nil
+}
+
+func (p *ConsolePlugin) Init() error {
+	if util.EnvBoolWithDefault("CONSOLE_ENABLED", true) {
+		p.h.Go("Console", p.runStdin)
+	}
+
+	if path := os.Getenv("CONSOLE_SOCKET"); path != "" {
+		addr := path
+		if !strings.HasPrefix(addr, "systemd") {
+			addr = "unix:" + path
+		}
+
+		l, err := util.Listen(addr)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Console listening on %s", path)
+
+		p.h.Go("Console", func(ctx context.Context) {
+			p.serve(ctx, l)
+		})
+	}
+
+	return nil
+}
+
+func (p *ConsolePlugin) runStdin(ctx context.Context) {
+	t := console.New(os.Stdin, os.Stdout, "> ")
+	defer t.Close()
+
+	go func() {
+		<-ctx.Done()
+		t.Close()
+	}()
+
+	p.run(ctx, t, &source{out: os.Stdout})
+}
+
+func (p *ConsolePlugin) serve(ctx context.Context, l net.Listener) {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to accept console connection: %v", err)
+			}
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			p.run(ctx, console.NewPlain(conn, conn, "> "), &source{out: conn})
+		}()
+	}
+}
+
+func (p *ConsolePlugin) run(ctx context.Context, t *console.Terminal, src *source) {
+	t.Complete = func(line string) []string {
+		suggestions, err := p.prx.Command().OfferSuggestions(ctx, src, line)
+		if err != nil {
+			return nil
+		}
+
+		return suggestions
+	}
+
+	for {
+		line, err := t.ReadLine()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Printf("Failed to read console input: %v", err)
+			}
+			return
+		}
+
+		line = strings.TrimPrefix(strings.TrimSpace(line), "/")
+		if line == "" {
+			continue
+		}
+
+		log.Printf("Console command: %s", line)
+
+		if err := p.prx.Command().Do(ctx, src, line); err != nil {
+			fmt.Fprintf(src.out, "Error: %v\n", err)
+		}
+	}
+}
+
+var _ command.Source = &source{}
+
+// source has every permission, commands check it through
+// permissions.SourceHasPermission.
+type source struct {
+	out io.Writer
+}
+
+func (s *source) HasPermission(permission string) bool {
+	return true
+}
+
+func (s *source) PermissionValue(string) permission.TriState {
+	return permission.True
+}
+
+func (s *source) SendMessage(msg component.Component, _ ...command.MessageOption) error {
+	_, err := fmt.Fprintln(s.out, plain(msg))
+
+	return err
+}
+
+// plain drops all styling, the console has no use for it.
+func plain(c component.Component) string {
+	sb := strings.Builder{}
+
+	var walk func(c component.Component)
+	walk = func(c component.Component) {
+		if c == nil {
+			return
+		}
+
+		switch t := c.(type) {
+		case *component.Text:
+			sb.WriteString(t.Content)
+		case *component.Translation:
+			sb.WriteString(t.Key)
+		}
+
+		for _, child := range c.Children() {
+			walk(child)
+		}
+	}
+
+	walk(c)
+
+	return sb.String()
+}
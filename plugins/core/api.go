@@ -0,0 +1,283 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/provider"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/transfer"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+type playerInfo struct {
+	UUID     string `json:"uuid"`
+	Username string `json:"username"`
+	Server   string `json:"server,omitempty"`
+	PingMs   int64  `json:"pingMs"`
+	// AvgPingMs, JitterMs, Loss and ConnectedSeconds are sampled by the
+	// proxy and stay 0 until the first sample.
+	AvgPingMs        int64   `json:"avgPingMs"`
+	JitterMs         int64   `json:"jitterMs"`
+	Loss             float64 `json:"loss"`
+	ConnectedSeconds int64   `json:"connectedSeconds"`
+	// CorrelationID is in the proxy's log lines about the connection
+	CorrelationID string `json:"correlationId"`
+	// Group is the gamemode of the server
+	Group string `json:"group,omitempty"`
+	// Country is empty without GEOIP_FILE
+	Country     string    `json:"country,omitempty"`
+	Protocol    int       `json:"protocol"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+type serverInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Players int    `json:"players"`
+	// Instance is nil for servers that were not registered through the
+	// instances bucket, e.g. from the Gate config.
+	Instance *hosting.InstanceInfo `json:"instance,omitempty"`
+	// Provider is set for servers the SERVER_PROVIDER has one of the same
+	// name of
+	Provider *provider.Server `json:"provider,omitempty"`
+}
+
+func (p *CorePlugin) registerAPI() {
+	p.h.API().HandleFunc("GET /players", p.handlePlayers)
+	p.h.API().HandleFunc("GET /players/query", p.handleQueryPlayers)
+	p.h.API().HandleFunc("POST /players/{player}/transfer", p.handleTransfer)
+	p.h.API().HandleFunc("GET /servers", p.handleServers)
+	p.h.API().HandleFunc("PUT /servers/{name}", p.handleSetServer)
+	p.h.API().HandleFunc("DELETE /servers/{name}", p.handleDeleteServer)
+}
+
+func (p *CorePlugin) playerInfo(ctx context.Context, player proxy.Player, now time.Time) playerInfo {
+	info := playerInfo{
+		UUID:          player.ID().String(),
+		Username:      player.Username(),
+		PingMs:        player.Ping().Milliseconds(),
+		CorrelationID: p.h.ConnectionID(player.RemoteAddr()),
+		Country:       p.h.GeoIP().Country(remoteAddr(player.RemoteAddr())),
+		Protocol:      player.Protocol(),
+	}
+
+	if q, ok := p.h.Quality().Stats(player.ID(), now); ok {
+		info.AvgPingMs = q.AvgPing.Milliseconds()
+		info.JitterMs = q.Jitter.Milliseconds()
+		info.Loss = q.Loss
+		info.ConnectedSeconds = int64(q.Age.Seconds())
+	}
+
+	if at, ok := p.h.ConnectedAt(player.RemoteAddr()); ok {
+		info.ConnectedAt = at
+	}
+
+	if s := player.CurrentServer(); s != nil {
+		info.Server = s.Server().ServerInfo().Name()
+
+		group, err := p.manager(player).Gamemode(ctx, s.Server())
+		if err != nil {
+			log.Printf("Failed to get the gamemode of %s: %v", info.Server, err)
+		}
+		info.Group = group
+	}
+
+	return info
+}
+
+func (p *CorePlugin) handlePlayers(w http.ResponseWriter, r *http.Request) {
+	players := make([]playerInfo, 0)
+	now := time.Now()
+
+	for _, player := range p.prx.Players() {
+		players = append(players, p.playerInfo(r.Context(), player, now))
+	}
+
+	slices.SortFunc(players, func(a, b playerInfo) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+
+	api.WriteJSON(w, http.StatusOK, players)
+}
+
+type transferRequest struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Cookies are stored on the client before the transfer, keyed by a
+	// namespaced key like csmc:handoff.
+	Cookies map[string][]byte `json:"cookies,omitempty"`
+}
+
+// handleTransfer hands a player of this proxy to host:port, the player is
+// given by UUID or name.
+func (p *CorePlugin) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	req := transferRequest{Port: 25565}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Host == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("host is required"))
+		return
+	}
+
+	var player proxy.Player
+	if id, err := uuid.Parse(r.PathValue("player")); err == nil {
+		player = p.prx.Player(id)
+	} else {
+		player = p.prx.PlayerByName(r.PathValue("player"))
+	}
+
+	if player == nil {
+		api.WriteError(w, http.StatusNotFound, errors.New("player is not on this proxy"))
+		return
+	}
+
+	if err := p.mgr.Transfer(r.Context(), player, req.Host, req.Port, req.Cookies); errors.Is(err, transfer.ErrUnsupported) || errors.Is(err, transfer.ErrNotPlaying) {
+		api.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "player.transfer",
+		Target:  player.ID().String(),
+		Details: map[string]string{"host": req.Host, "port": strconv.Itoa(req.Port)},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleServers lists all servers, or those matching ?selector=.
+func (p *CorePlugin) handleServers(w http.ResponseWriter, r *http.Request) {
+	sel, err := registry.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	selected, err := p.mgr.Select(r.Context(), sel)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	provided := make(map[string]provider.Server)
+	if prv := p.h.Provider(); prv != nil {
+		list, err := prv.ListServers(r.Context())
+		if err != nil {
+			// The panel being down shouldn't hide the servers themselves
+			log.Printf("Failed to list servers of the provider: %v", err)
+		}
+
+		for _, s := range list {
+			provided[s.Name] = s
+		}
+	}
+
+	servers := make([]serverInfo, 0)
+
+	for _, s := range selected {
+		info := serverInfo{
+			Name:    s.ServerInfo().Name(),
+			Address: s.ServerInfo().Addr().String(),
+			Players: s.Players().Len(),
+		}
+
+		raw, err := p.instancesKV.Get(r.Context(), info.Name)
+		if err == nil {
+			instance := &hosting.InstanceInfo{}
+			if err := json.Unmarshal(raw, instance); err == nil {
+				info.Instance = instance
+			}
+		} else if !errors.Is(err, kv.ErrKeyNotFound) {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if ps, ok := provided[info.Name]; ok {
+			info.Provider = &ps
+		}
+
+		servers = append(servers, info)
+	}
+
+	slices.SortFunc(servers, func(a, b serverInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	api.WriteJSON(w, http.StatusOK, servers)
+}
+
+// handleSetServer writes the instance into the instances bucket. Every proxy
+// then registers it through its watcher, including this one.
+func (p *CorePlugin) handleSetServer(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	info := hosting.InstanceInfo{}
+	if err := api.ReadJSON(r, &info); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if info.Address == "" || info.Port == 0 || info.Gamemode == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("gamemode, address and port are required"))
+		return
+	}
+
+	if err := kv.Typed[hosting.InstanceInfo](p.instancesKV, name).Set(r.Context(), info); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "server.set",
+		Target:  name,
+		Details: map[string]string{"gamemode": info.Gamemode, "address": info.Address, "canary": strconv.FormatBool(info.Canary)},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, info)
+}
+
+func (p *CorePlugin) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if err := p.instancesKV.Delete(r.Context(), name); errors.Is(err, kv.ErrKeyNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "server.delete", Target: name}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
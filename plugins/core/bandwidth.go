@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/bandwidth"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// bandwidthCommand lists the players using the most bandwidth and the
+// bytes by backend server.
+func (p *CorePlugin) bandwidthCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("bandwidth").
+		Executes(command.Command(func(c *command.Context) error {
+			if !c.Source.HasPermission("csmc.bandwidth") {
+				return c.Source.SendMessage(&Text{Content: "You do not have permission to see the bandwidth.", S: Style{Color: color.Red}})
+			}
+
+			lines := []Component{&Text{Content: "Top players", S: Style{Color: color.Aqua}}}
+
+			usage := p.h.Bandwidth().Usage()
+			if len(usage) > 10 {
+				usage = usage[:10]
+			}
+			for _, u := range usage {
+				name := u.Player
+				if name == "" {
+					name = u.Remote
+				}
+
+				lines = append(lines, &Text{
+					Content: fmt.Sprintf("\n %s: %s in, %s out (%s total)", name, bandwidth.FormatRate(u.InRate), bandwidth.FormatRate(u.OutRate), bandwidth.FormatBytes(u.In+u.Out)),
+					S:       Style{Color: color.Gray},
+				})
+			}
+
+			lines = append(lines, &Text{Content: "\nBackends", S: Style{Color: color.Aqua}})
+			for _, b := range p.h.Bandwidth().Backends() {
+				lines = append(lines, &Text{
+					Content: fmt.Sprintf("\n %s: %s in, %s out", b.Server, bandwidth.FormatBytes(b.In), bandwidth.FormatBytes(b.Out)),
+					S:       Style{Color: color.Gray},
+				})
+			}
+
+			return c.Source.SendMessage(&Text{Extra: lines})
+		}))
+}
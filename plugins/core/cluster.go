@@ -0,0 +1,32 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// clusterCommand coordinates the proxies of the network, /cluster restart
+// has the leader drain and restart them one at a time.
+func (p *CorePlugin) clusterCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("cluster").
+		Then(brigodier.Literal("restart").
+			Executes(command.Command(func(c *command.Context) error {
+				if !c.Source.HasPermission("csmc.cluster.restart") {
+					return c.Source.SendMessage(&Text{Content: "You do not have permission to restart the cluster.", S: Style{Color: color.Red}})
+				}
+
+				leader, err := p.h.RestartCluster(c.Context, actor(c.Source))
+				if errors.Is(err, hosting.ErrRolloutRunning) {
+					return c.Source.SendMessage(&Text{Content: "A rolling restart is already running.", S: Style{Color: color.Red}})
+				} else if err != nil {
+					return err
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Rolling restart led by " + leader + " started, proxies restart one at a time.", S: Style{Color: color.Green}})
+			})))
+}
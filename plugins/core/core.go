@@ -1,17 +1,23 @@
 package core
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/registry"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/rpc"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
 	"github.com/robinbraemer/event"
 	"go.minekube.com/brigodier"
 	"go.minekube.com/common/minecraft/color"
@@ -21,73 +27,66 @@ import (
 )
 
 type CorePlugin struct {
-	prx         *proxy.Proxy
-	h           *hosting.Hosting
+	prx *proxy.Proxy
+	h   *hosting.Hosting
+	// mgr and instancesKV are those of the primary network
 	mgr         *hosting.InstanceManager
 	instancesKV kv.Bucket
+	networks    map[string]*networkServers
+}
+
+// networkServers registers the instances of a network with Gate.
+type networkServers struct {
+	mgr         *hosting.InstanceManager
+	instancesKV kv.Bucket
+	// registered is only touched from the instances watch goroutine.
+	registered map[string]struct{}
 }
 
 func New(h *hosting.Hosting) (proxy.Plugin, error) {
 	return proxy.Plugin{
 		Name: "Core",
 		Init: func(ctx context.Context, prx *proxy.Proxy) error {
-			instancesKV, err := h.KV().Bucket(ctx, h.Info.KVInstancesKey())
-			if err != nil {
-				return err
-			}
+			networks := make(map[string]*networkServers)
+			for _, nw := range h.Networks() {
+				instancesKV, err := nw.KV().Bucket(ctx, nw.Info.KVInstancesKey())
+				if err != nil {
+					return err
+				}
 
-			mgr, err := h.InstanceManager(ctx, prx)
-			if err != nil {
-				return err
+				mgr, err := h.NetworkInstanceManager(ctx, prx, nw)
+				if err != nil {
+					return err
+				}
+
+				networks[nw.Name] = &networkServers{mgr: mgr, instancesKV: instancesKV, registered: make(map[string]struct{})}
 			}
 
-			p := &CorePlugin{prx: prx, h: h, instancesKV: instancesKV, mgr: mgr}
+			primary := networks[h.PrimaryNetwork().Name]
+			p := &CorePlugin{prx: prx, h: h, instancesKV: primary.instancesKV, mgr: primary.mgr, networks: networks}
 
 			return p.Init(ctx)
 		},
 	}, nil
 }
 
-func (p *CorePlugin) Init(ctx context.Context) error {
-	go func() {
-		watcher, err := p.instancesKV.WatchAll(ctx)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for key := range watcher.Changes() {
-			if key == nil {
-				log.Println("Replayed keys for all instances")
-				continue
-			}
-
-			podName := key.Key
-
-			switch key.Operation {
-			case kv.Put:
-				info := hosting.InstanceInfo{}
-				if err := json.Unmarshal(key.Value, &info); err != nil {
-					log.Printf("Failed to unmarshal instance info: %v", err)
-					continue
-				}
-
-				log.Printf("Parsed pod info for %s: %+v", podName, info)
-
-				if err := p.mgr.Register(ctx, podName, info); err != nil {
-					log.Printf("Failed to register server %s: %v", podName, err)
-				}
-
-			case kv.Delete:
-				log.Printf("Deleted pod info for %s", podName)
+// manager returns the instance manager of the player's network.
+func (p *CorePlugin) manager(player proxy.Player) *hosting.InstanceManager {
+	if ns, ok := p.networks[p.h.PlayerNetwork(player.ID()).Name]; ok {
+		return ns.mgr
+	}
 
-				if err := p.mgr.Unregister(ctx, podName); err != nil {
-					log.Printf("Failed to unregister server %s: %v", podName, err)
-				}
+	return p.mgr
+}
 
-				continue
-			}
-		}
-	}()
+func (p *CorePlugin) Init(ctx context.Context) error {
+	for _, ns := range p.networks {
+		p.h.Go("Core", func(ctx context.Context) {
+			kv.Watch(ctx, ns.instancesKV, func(key *kv.Value) {
+				ns.handleInstanceChange(ctx, key)
+			}, ns.pruneInstances)
+		})
+	}
 
 	{
 		errorReqRes, err := json.Marshal(&rpc.TransferPlayerResponse{Status: rpc.StatusError})
@@ -103,75 +102,64 @@ func (p *CorePlugin) Init(ctx context.Context) error {
 		}
 
 		err = p.h.Messaging().Subscribe(p.h.Info.RPCNetworkSubject(), func(msg messaging.Message) {
-			log.Printf("Received raw request on transfers queue: %s", string(msg.Data))
+			id := correlation.ID(msg.Context)
+			correlation.Logf(id, "Received raw request on transfers queue: %s", string(msg.Data))
 
 			payload := &rpc.Request{}
 			if err := json.Unmarshal(msg.Data, payload); err != nil {
-				log.Printf("Failed to unmarshal payload: %v", err)
+				correlation.Logf(id, "Failed to unmarshal payload: %v", err)
 				return
 			}
 
 			if payload.Type != rpc.TypeTransferPlayer {
-				log.Printf("Invalid payload type: %s", payload.Type)
+				correlation.Logf(id, "Invalid payload type: %s", payload.Type)
 				msg.Nak()
 				return
 			}
 
 			req := &rpc.TransferPlayerRequest{}
 			if err := json.Unmarshal([]byte(payload.Data), req); err != nil {
-				log.Printf("Failed to unmarshal transfer player request: %v", err)
+				correlation.Logf(id, "Failed to unmarshal transfer player request: %v", err)
 				msg.Nak()
 				return
 			}
-			log.Printf("Transfer player request: %v", req)
+			correlation.Logf(id, "Transfer player request: %v", req)
 
 			player := p.prx.Player(req.UUID)
 			if player == nil {
-				log.Printf("Player %s not found", req.UUID)
+				correlation.Logf(id, "Player %s not found", req.UUID)
 				msg.Nak()
 				return
 			}
 
-			var newServer proxy.RegisteredServer
-			for _, s := range p.prx.Servers() {
-				sName := s.ServerInfo().Name()
-
-				if sName == req.Destination {
-					newServer = s
-					break
-				}
-
-				if strings.HasPrefix(sName, req.Destination+"-") {
-					newServer = s
-					break
-				}
-			}
-			if newServer == nil {
-				log.Printf("Server %s not found", req.Destination)
+			newServer, err := p.mgr.FindServer(p.h.Context(), req.Destination)
+			if err != nil {
+				correlation.Logf(id, "Server %s not found: %v", req.Destination, err)
 				msg.Nak()
 				return
 			}
 
-			c, err := player.CreateConnectionRequest(newServer).Connect(msg.Context)
+			c, err := p.mgr.Connect(p.h.PlayerContext(msg.Context, player), player, newServer)
 			if err != nil {
-				log.Printf("Failed to connect player %s to server %s: %v", req.UUID, req.Destination, err)
+				correlation.Logf(id, "Failed to connect player %s to server %s: %v", req.UUID, req.Destination, err)
+				p.h.ReportError(msg.Context, "Core", fmt.Errorf("transfer to %s: %w", req.Destination, err), p.h.PlayerReport(player))
 
 				if err := msg.Respond(errorRes); err != nil {
-					log.Printf("Failed to respond to transfer player request: %v", err)
+					correlation.Logf(id, "Failed to respond to transfer player request: %v", err)
 				}
 
 				return
 			}
 
 			if c.Status() == proxy.AlreadyConnectedConnectionStatus {
-				log.Printf("Player %s is already connected to server %s", req.UUID, req.Destination)
+				correlation.Logf(id, "Player %s is already connected to server %s", req.UUID, req.Destination)
 				msg.Ack()
 				return
 			} else if c.Status() != proxy.SuccessConnectionStatus {
-				log.Printf("Failed to connect player %s to server %s: %v: %v", req.UUID, req.Destination, c.Status(), c.Reason())
+				correlation.Logf(id, "Failed to connect player %s to server %s: %v: %v", req.UUID, req.Destination, c.Status(), c.Reason())
 
 				if err := msg.Respond(errorRes); err != nil {
-					log.Printf("Failed to respond to transfer player request: %v", err)
+					correlation.Logf(id, "Failed to respond to transfer player request: %v", err)
 				}
 
 				return
@@ -179,10 +167,10 @@ func (p *CorePlugin) Init(ctx context.Context) error {
 
 			reqRes, err := json.Marshal(&rpc.TransferPlayerResponse{Status: rpc.StatusOk})
 			if err != nil {
-				log.Printf("Failed to marshal transfer player response: %v", err)
+				correlation.Logf(id, "Failed to marshal transfer player response: %v", err)
 
 				if err := msg.Respond(errorRes); err != nil {
-					log.Printf("Failed to respond to transfer player request: %v", err)
+					correlation.Logf(id, "Failed to respond to transfer player request: %v", err)
 				}
 
 				return
@@ -190,20 +178,20 @@ func (p *CorePlugin) Init(ctx context.Context) error {
 
 			res, err := json.Marshal(&rpc.Response{Type: payload.Type, Data: string(reqRes)})
 			if err != nil {
-				log.Printf("Failed to marshal response: %v", err)
+				correlation.Logf(id, "Failed to marshal response: %v", err)
 
 				if err := msg.Respond(errorRes); err != nil {
-					log.Printf("Failed to respond to transfer player request: %v", err)
+					correlation.Logf(id, "Failed to respond to transfer player request: %v", err)
 				}
 
 				return
 			}
 
 			if err := msg.Respond(res); err != nil {
-				log.Printf("Failed to respond to transfer player request: %v", err)
+				correlation.Logf(id, "Failed to respond to transfer player request: %v", err)
 			}
 
-			log.Printf("Player %s transferred to server %s", req.UUID, req.Destination)
+			correlation.Logf(id, "Player %s transferred to server %s", req.UUID, req.Destination)
 		})
 		if err != nil {
 			log.Printf("Failed to subscribe to transfers: %v", err)
@@ -211,43 +199,175 @@ func (p *CorePlugin) Init(ctx context.Context) error {
 		}
 	}
 
-	p.prx.Command().Register(brigodier.Literal("ping").
-		Executes(command.Command(func(c *command.Context) error {
-			player, ok := c.Source.(proxy.Player)
-			if !ok {
-				return c.Source.SendMessage(&Text{Content: "Pong!"})
-			}
+	p.prx.Command().Register(p.pingCommand())
+	p.prx.Command().Register(p.serversCommand())
+	p.prx.Command().Register(p.packetsCommand())
+	p.prx.Command().Register(p.debugPlayerCommand())
+	p.prx.Command().Register(p.proxyCommand())
+	p.prx.Command().Register(p.clusterCommand())
+	p.prx.Command().Register(p.bandwidthCommand())
+	p.prx.Command().Register(p.lockdownCommand())
 
-			return player.SendMessage(&Text{
-				Content: fmt.Sprintf("Pong! Your ping is %s", player.Ping()),
-				S:       Style{Color: color.Green},
-			})
-		})),
-	)
+	p.registerAPI()
+	p.registerGraphQL()
+
+	event.Subscribe(p.prx.Event(), 0, func(*proxy.PreShutdownEvent) {
+		p.h.Shutdown()
+	})
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", p.onServerSwitch))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", p.onChooseServer))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", p.onServerPreConnect))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", func(e *proxy.PostLoginEvent) {
+		p.h.JoinConnection(e.Player())
+		p.h.JoinNetwork(e.Player())
+		p.h.Quality().Connect(e.Player().ID(), time.Now())
+	}))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", p.sendJoinMessage))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", p.onForwardingRejected))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Core", func(e *proxy.DisconnectEvent) {
+		p.h.Quality().Disconnect(e.Player().ID())
+		p.h.LeaveNetwork(e.Player().ID())
+		p.h.EndConnection(e.Player().RemoteAddr())
+	}))
+
+	return nil
+}
+
+// sendJoinMessage greets players with the join message of the active theme.
+func (p *CorePlugin) sendJoinMessage(e *proxy.PostLoginEvent) {
+	theme, ok := p.h.Themes().Current()
+	if !ok || theme.JoinMessage == "" {
+		return
+	}
+
+	_ = e.Player().SendMessage(util.Text(strings.ReplaceAll(theme.JoinMessage, "{player}", e.Player().Username())))
+}
+
+func (p *networkServers) handleInstanceChange(ctx context.Context, key *kv.Value) {
+	if key == nil {
+		log.Printf("Replayed keys for all instances of network %s", p.mgr.Network().Name)
+		return
+	}
+
+	podName := key.Key
+
+	switch key.Operation {
+	case kv.Put:
+		info := hosting.InstanceInfo{}
+		if err := json.Unmarshal(key.Value, &info); err != nil {
+			log.Printf("Failed to unmarshal instance info: %v", err)
+			return
+		}
+
+		log.Printf("Parsed pod info for %s: %+v", podName, info)
+
+		if err := p.mgr.Register(ctx, podName, info); err != nil {
+			log.Printf("Failed to register server %s: %v", podName, err)
+			return
+		}
+
+		p.registered[podName] = struct{}{}
+
+	case kv.Delete:
+		log.Printf("Deleted pod info for %s", podName)
+
+		if err := p.mgr.Unregister(ctx, podName); err != nil {
+			log.Printf("Failed to unregister server %s: %v", podName, err)
+		}
+
+		delete(p.registered, podName)
+	}
+}
 
-	event.Subscribe(p.prx.Event(), 0, p.onServerSwitch)
-	event.Subscribe(p.prx.Event(), 0, p.onChooseServer)
+// pruneInstances unregisters servers whose instance was deleted while the
+// watcher was disconnected. Instances that still exist are re-registered by
+// the replay that follows.
+func (p *networkServers) pruneInstances(ctx context.Context) error {
+	keys, err := p.instancesKV.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for podName := range p.registered {
+		if slices.Contains(keys, podName) {
+			continue
+		}
+
+		log.Printf("Instance %s disappeared while disconnected", podName)
+
+		if err := p.mgr.Unregister(ctx, podName); err != nil {
+			log.Printf("Failed to unregister server %s: %v", podName, err)
+			continue
+		}
+
+		delete(p.registered, podName)
+	}
 
 	return nil
 }
 
 func (p *CorePlugin) onChooseServer(e *proxy.PlayerChooseInitialServerEvent) {
-	server, err := p.mgr.GetRandomServerOfGamemode(e.Player().Context(), "lobby")
+	id := p.h.ConnectionID(e.Player().RemoteAddr())
+
+	server, err := p.manager(e.Player()).ChooseServer(e.Player().Context(), "lobby", e.Player())
+	if err != nil {
+		p.h.Tracef(e.Player().Username(), "routing: no initial server: %v", err)
+	}
+
 	if errors.Is(err, hosting.ErrNoServersAvailable) {
-		log.Printf("No servers available for player %s", e.Player().ID())
+		correlation.Logf(id, "No servers available for player %s", e.Player().ID())
+		return
+	} else if errors.Is(err, hosting.ErrServersFull) {
+		correlation.Logf(id, "All lobbies are full for player %s", e.Player().ID())
+		e.Player().Disconnect(&Text{
+			Content: "All lobbies are full right now, please try again in a minute.",
+			S:       Style{Color: color.Yellow},
+		})
 		return
 	} else if err != nil {
-		log.Printf("Failed to get servers of gamemode lobby: %v", err)
+		correlation.Logf(id, "Failed to get servers of gamemode lobby: %v", err)
+		p.h.ReportError(e.Player().Context(), "Core", fmt.Errorf("choose initial server: %w", err), p.h.PlayerReport(e.Player()))
 		// Fallback to default
 		e.SetInitialServer(p.prx.Server("lobby-0"))
 		return
 	}
 
-	log.Printf("Chose server %s for player %s", server.ServerInfo().Name(), e.Player().ID())
+	correlation.Logf(id, "Chose server %s for player %s", server.ServerInfo().Name(), e.Player().ID())
+	p.h.Tracef(e.Player().Username(), "routing: chose initial server %s", server.ServerInfo().Name())
 
 	e.SetInitialServer(server)
 }
 
+// onServerPreConnect enforces capacity limits for every connection, including
+// transfers and matchmaking, which requeues players that were denied.
+func (p *CorePlugin) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
+	if !e.Allowed() || e.Server() == nil || p.checkLockdown(e) {
+		return
+	}
+
+	ok, err := p.manager(e.Player()).CanJoin(e.Player().Context(), e.Player(), e.Server())
+	if err != nil {
+		log.Printf("Failed to check capacity of %s: %v", e.Server().ServerInfo().Name(), err)
+		return
+	}
+
+	p.h.Tracef(e.Player().Username(), "routing: capacity of %s allows joining: %t", e.Server().ServerInfo().Name(), ok)
+
+	if ok {
+		return
+	}
+
+	e.Deny()
+
+	_ = e.Player().SendMessage(&Text{
+		S: Style{Color: color.Yellow},
+		Extra: []Component{
+			&Text{Content: e.Server().ServerInfo().Name(), S: Style{Color: color.Gold}},
+			&Text{Content: " is full, please try again in a moment."},
+		},
+	})
+}
+
 func (p *CorePlugin) onServerSwitch(e *proxy.ServerPostConnectEvent) {
 	s := e.Player().CurrentServer()
 	if s == nil {
@@ -265,3 +385,90 @@ func (p *CorePlugin) onServerSwitch(e *proxy.ServerPostConnectEvent) {
 		},
 	})
 }
+
+// serversCommand lists the servers matching an optional registry selector,
+// e.g. /servers type=lobby,region=eu.
+func (p *CorePlugin) serversCommand() brigodier.LiteralNodeBuilder {
+	list := func(c *command.Context, selector string) error {
+		if !c.Source.HasPermission("csmc.servers") {
+			return c.Source.SendMessage(&Text{Content: "You do not have permission to list servers.", S: Style{Color: color.Red}})
+		}
+
+		sel, err := registry.Parse(selector)
+		if err != nil {
+			return c.Source.SendMessage(&Text{Content: err.Error(), S: Style{Color: color.Red}})
+		}
+
+		servers, err := p.mgr.Select(c, sel)
+		if err != nil {
+			log.Printf("Failed to select servers %s: %v", selector, err)
+			return c.Source.SendMessage(&Text{Content: "Failed to list servers.", S: Style{Color: color.Red}})
+		}
+
+		slices.SortFunc(servers, func(a, b proxy.RegisteredServer) int {
+			return cmp.Compare(a.ServerInfo().Name(), b.ServerInfo().Name())
+		})
+
+		lines := []Component{&Text{Content: fmt.Sprintf("%d servers match", len(servers)), S: Style{Color: color.Aqua}}}
+		for _, s := range servers {
+			lines = append(lines,
+				&Text{Content: "\n - " + s.ServerInfo().Name(), S: Style{Color: color.Yellow}},
+				&Text{Content: fmt.Sprintf(" (%d players)", s.Players().Len()), S: Style{Color: color.Gray}},
+			)
+		}
+
+		return c.Source.SendMessage(&Text{Extra: lines})
+	}
+
+	return brigodier.Literal("servers").
+		Then(brigodier.
+			Argument("selector", brigodier.StringPhrase).
+			Executes(command.Command(func(c *command.Context) error {
+				return list(c, c.String("selector"))
+			}))).
+		Executes(command.Command(func(c *command.Context) error {
+			return list(c, "")
+		}))
+}
+
+func (p *CorePlugin) pingCommand() brigodier.LiteralNodeBuilder {
+	show := func(c *command.Context, player proxy.Player) error {
+		s, ok := p.h.Quality().Stats(player.ID(), time.Now())
+		if !ok {
+			return c.Source.SendMessage(&Text{
+				Content: fmt.Sprintf("Ping of %s is %s", player.Username(), player.Ping()),
+				S:       Style{Color: color.Green},
+			})
+		}
+
+		return c.Source.SendMessage(&Text{Extra: []Component{
+			&Text{Content: fmt.Sprintf("Ping of %s is %s", player.Username(), s.Ping.Round(time.Millisecond)), S: Style{Color: color.Green}},
+			&Text{Content: fmt.Sprintf("\n average %s, jitter %s, %.0f%% keep-alives lost, connected for %s",
+				s.AvgPing.Round(time.Millisecond), s.Jitter.Round(time.Millisecond), s.Loss*100, s.Age.Round(time.Second)), S: Style{Color: color.Gray}},
+		}})
+	}
+
+	return brigodier.Literal("ping").
+		Then(brigodier.
+			Argument("player", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				if !c.Source.HasPermission("csmc.ping.others") {
+					return c.Source.SendMessage(&Text{Content: "You do not have permission to see the ping of others.", S: Style{Color: color.Red}})
+				}
+
+				player := p.prx.PlayerByName(c.String("player"))
+				if player == nil {
+					return c.Source.SendMessage(&Text{Content: "Player not found.", S: Style{Color: color.Red}})
+				}
+
+				return show(c, player)
+			}))).
+		Executes(command.Command(func(c *command.Context) error {
+			player, ok := c.Source.(proxy.Player)
+			if !ok {
+				return c.Source.SendMessage(&Text{Content: "Pong!"})
+			}
+
+			return show(c, player)
+		}))
+}
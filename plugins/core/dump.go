@@ -0,0 +1,29 @@
+package core
+
+import (
+	"strings"
+
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// proxyCommand has the diagnostics of this proxy, /proxy dump stores heap
+// and goroutine profiles in the object store.
+func (p *CorePlugin) proxyCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("proxy").
+		Then(brigodier.Literal("dump").
+			Executes(command.Command(func(c *command.Context) error {
+				if !c.Source.HasPermission("csmc.debug.dump") {
+					return c.Source.SendMessage(&Text{Content: "You do not have permission to dump profiles.", S: Style{Color: color.Red}})
+				}
+
+				names, err := p.h.DumpProfiles(c.Context)
+				if err != nil {
+					return err
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Stored the profiles of " + p.h.Info.PodName + " as " + strings.Join(names, ", ") + ".", S: Style{Color: color.Green}})
+			})))
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"log"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"go.minekube.com/common/minecraft/component/codec/legacy"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var forwardingRejected = metrics.NewCounterVec("gate_forwarding_rejected_total", "Logins backends rejected because of the forwarding data.", "server")
+
+// forwardingReasons are kick messages of backends that can't verify the
+// forwarding data, as Paper and FabricProxy-Lite word them.
+var forwardingReasons = []string{
+	"unable to verify player details",
+	"this server requires you to connect with velocity",
+}
+
+// onForwardingRejected explains the kick of a backend that doesn't accept the
+// forwarding secret of this proxy instead of leaving only "Unable to verify
+// player details" in the logs.
+func (p *CorePlugin) onForwardingRejected(e *proxy.KickedFromServerEvent) {
+	if !e.KickedDuringServerConnect() || e.OriginalReason() == nil {
+		return
+	}
+
+	sb := strings.Builder{}
+	if err := (&legacy.Legacy{}).Marshal(&sb, e.OriginalReason()); err != nil {
+		return
+	}
+
+	reason := strings.ToLower(sb.String())
+	for _, r := range forwardingReasons {
+		if !strings.Contains(reason, r) {
+			continue
+		}
+
+		name := e.Server().ServerInfo().Name()
+		forwardingRejected.Inc(name)
+
+		if v := p.h.ForwardingVersion(); v > 0 {
+			log.Printf("Backend %s rejected the forwarding data of %s: it must accept forwarding secret v%d of the keyring in KV", name, e.Player().Username(), v)
+		} else {
+			log.Printf("Backend %s rejected the forwarding data of %s: its forwarding secret doesn't match the one of the proxy", name, e.Player().Username())
+		}
+
+		return
+	}
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/graphql"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/profiles"
+	utiluuid "github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// registerGraphQL adds the players of the proxy to the GraphQL schema:
+// player(uuid|name) finds one, online or not, players lists those online
+// here.
+func (p *CorePlugin) registerGraphQL() {
+	s := p.h.GraphQL()
+	player := s.Object("Player")
+
+	s.Query().Field("player", graphql.Field{
+		Type:        player,
+		Args:        []string{"uuid", "name"},
+		Description: "A player by UUID or name, null if Mojang doesn't know them",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			return p.graphQLPlayer(ctx, args.String("uuid"), args.String("name"))
+		},
+	})
+
+	s.Query().Field("players", graphql.Field{
+		Type:        player,
+		List:        true,
+		Args:        []string{"server", "group", "limit"},
+		Description: "The players on this proxy, sorted by name",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			q := playerQuery{limit: min(args.Int("limit", defaultQueryLimit), maxQueryLimit)}
+			if server := args.String("server"); server != "" {
+				q.servers = []string{server}
+			}
+			if group := args.String("group"); group != "" {
+				q.groups = []string{group}
+			}
+
+			now := time.Now()
+			players := make([]hosting.GraphQLPlayer, 0)
+			for _, pl := range p.prx.Players() {
+				if q.matches(p.playerInfo(ctx, pl, now)) {
+					players = append(players, hosting.GraphQLPlayer{UUID: utiluuid.Normalize(pl.ID().String()), Name: pl.Username(), Player: pl})
+				}
+			}
+
+			slices.SortFunc(players, func(a, b hosting.GraphQLPlayer) int {
+				return strings.Compare(a.Name, b.Name)
+			})
+
+			return players[:min(q.limit, len(players))], nil
+		},
+	})
+
+	player.Field("uuid", graphql.Field{})
+	player.Field("name", graphql.Field{})
+	player.Field("online", graphql.Field{
+		Description: "Whether the player is on this proxy",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			return source.(hosting.GraphQLPlayer).Player != nil, nil
+		},
+	})
+	player.Field("location", graphql.Field{
+		Type:        s.Object("Location"),
+		Description: "Where the player is, null if they aren't on this proxy",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			pl := source.(hosting.GraphQLPlayer).Player
+			if pl == nil {
+				return nil, nil
+			}
+
+			info := p.playerInfo(ctx, pl, time.Now())
+			return map[string]any{"proxy": p.h.Info.PodName, "server": info.Server, "group": info.Group, "country": info.Country}, nil
+		},
+	})
+	player.Field("stats", graphql.Field{
+		Type:        s.Object("ConnectionStats"),
+		Description: "The sampled connection of the player, null if they aren't on this proxy",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			pl := source.(hosting.GraphQLPlayer).Player
+			if pl == nil {
+				return nil, nil
+			}
+
+			return p.playerInfo(ctx, pl, time.Now()), nil
+		},
+	})
+
+	for _, name := range []string{"proxy", "server", "group", "country"} {
+		s.Object("Location").Field(name, graphql.Field{})
+	}
+
+	for _, name := range []string{"protocol", "connectedAt", "pingMs", "avgPingMs", "jitterMs", "loss", "connectedSeconds", "correlationId"} {
+		s.Object("ConnectionStats").Field(name, graphql.Field{})
+	}
+}
+
+func (p *CorePlugin) graphQLPlayer(ctx context.Context, id, name string) (any, error) {
+	if id == "" && name == "" {
+		return nil, errors.New("uuid or name is required")
+	}
+
+	if id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil, errors.New("invalid uuid")
+		}
+
+		if pl := p.prx.Player(parsed); pl != nil {
+			return hosting.GraphQLPlayer{UUID: utiluuid.Normalize(id), Name: pl.Username(), Player: pl}, nil
+		}
+
+		// Cached only, so listing offline players doesn't use up the
+		// Mojang rate limit
+		profile, _, err := p.h.Profiles().Cached(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return hosting.GraphQLPlayer{UUID: utiluuid.Normalize(id), Name: profile.Name}, nil
+	}
+
+	if pl := p.prx.PlayerByName(name); pl != nil {
+		return hosting.GraphQLPlayer{UUID: utiluuid.Normalize(pl.ID().String()), Name: pl.Username(), Player: pl}, nil
+	}
+
+	profile, err := p.h.Profiles().ByName(ctx, name)
+	if errors.Is(err, profiles.ErrProfileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return hosting.GraphQLPlayer{UUID: profile.ID, Name: profile.Name}, nil
+}
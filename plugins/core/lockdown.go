@@ -0,0 +1,87 @@
+package core
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// checkLockdown keeps players off gamemodes in lockdown, reporting whether
+// the connection was denied.
+func (p *CorePlugin) checkLockdown(e *proxy.ServerPreConnectEvent) bool {
+	cfg, locked, err := p.manager(e.Player()).LockedDown(e.Player().Context(), e.Player(), e.Server())
+	if err != nil {
+		log.Printf("Failed to check the lockdown of %s: %v", e.Server().ServerInfo().Name(), err)
+		return false
+	} else if !locked {
+		return false
+	}
+
+	p.h.Tracef(e.Player().Username(), "routing: %s is in lockdown since %s", e.Server().ServerInfo().Name(), cfg.Since)
+	e.Deny()
+
+	if cfg.Message != "" {
+		_ = e.Player().SendMessage(util.Text(cfg.Message))
+		return true
+	}
+
+	_ = e.Player().SendMessage(&Text{
+		S: Style{Color: color.Yellow},
+		Extra: []Component{
+			&Text{Content: e.Server().ServerInfo().Name(), S: Style{Color: color.Gold}},
+			&Text{Content: " is closed for maintenance right now."},
+		},
+	})
+
+	return true
+}
+
+// lockdownCommand closes a gamemode to new connections: /lockdown <group> on
+// [message] and /lockdown <group> off.
+func (p *CorePlugin) lockdownCommand() brigodier.LiteralNodeBuilder {
+	lock := func(c *command.Context, message string) error {
+		if !c.Source.HasPermission("csmc.lockdown") {
+			return c.Source.SendMessage(&Text{Content: "You do not have permission to lock down groups.", S: Style{Color: color.Red}})
+		}
+
+		group := c.String("group")
+		if _, err := p.h.SetGroupLockdown(c.Context, actor(c.Source), group, message); err != nil {
+			return err
+		}
+
+		return c.Source.SendMessage(&Text{Content: group + " is in lockdown, players on it stay.", S: Style{Color: color.Green}})
+	}
+
+	return brigodier.Literal("lockdown").
+		Then(brigodier.Argument("group", brigodier.String).
+			Then(brigodier.Literal("on").
+				Executes(command.Command(func(c *command.Context) error {
+					return lock(c, "")
+				})).
+				Then(brigodier.Argument("message", brigodier.StringPhrase).
+					Executes(command.Command(func(c *command.Context) error {
+						return lock(c, c.String("message"))
+					})))).
+			Then(brigodier.Literal("off").
+				Executes(command.Command(func(c *command.Context) error {
+					if !c.Source.HasPermission("csmc.lockdown") {
+						return c.Source.SendMessage(&Text{Content: "You do not have permission to lock down groups.", S: Style{Color: color.Red}})
+					}
+
+					group := c.String("group")
+					if err := p.h.DeleteGroupLockdown(c.Context, actor(c.Source), group); errors.Is(err, kv.ErrKeyNotFound) {
+						return c.Source.SendMessage(&Text{Content: group + " is not in lockdown.", S: Style{Color: color.Red}})
+					} else if err != nil {
+						return err
+					}
+
+					return c.Source.SendMessage(&Text{Content: group + " is open again.", S: Style{Color: color.Green}})
+				}))))
+}
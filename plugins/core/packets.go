@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+func actor(source command.Source) string {
+	if player, ok := source.(proxy.Player); ok {
+		return player.Username()
+	}
+
+	return "console"
+}
+
+// packetsCommand captures the packets of a player, /packets off stops and
+// /packets dump stores what was captured in the object store.
+func (p *CorePlugin) packetsCommand() brigodier.LiteralNodeBuilder {
+	allowed := func(c *command.Context) bool {
+		if c.Source.HasPermission("csmc.debug.packets") {
+			return true
+		}
+
+		_ = c.Source.SendMessage(&Text{Content: "You do not have permission to capture packets.", S: Style{Color: color.Red}})
+		return false
+	}
+
+	return brigodier.Literal("packets").
+		Then(brigodier.Literal("off").
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				if err := p.h.StopPackets(c.Context, actor(c.Source)); err != nil {
+					return err
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Stopped capturing packets.", S: Style{Color: color.Green}})
+			}))).
+		Then(brigodier.Literal("dump").
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				name, err := p.h.DumpPackets(c.Context)
+				if err != nil {
+					return err
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Stored the captured packets as " + name + ".", S: Style{Color: color.Green}})
+			}))).
+		Then(brigodier.
+			Argument("player", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				name := c.String("player")
+				if err := p.h.CapturePackets(c.Context, actor(c.Source), packets.Filter{Player: name}); errors.Is(err, hosting.ErrNotDecoded) {
+					return c.Source.SendMessage(&Text{Content: name + " is encrypted or not on an offline listener, their packets can't be captured.", S: Style{Color: color.Red}})
+				} else if err != nil {
+					return err
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Capturing the packets of " + name + " on the additional listeners.", S: Style{Color: color.Green}})
+			})))
+}
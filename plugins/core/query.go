@@ -0,0 +1,230 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// playerFields are what ?fields= may select, the JSON names of playerInfo.
+var playerFields = []string{
+	"uuid", "username", "server", "group", "country", "protocol", "connectedAt",
+	"pingMs", "avgPingMs", "jitterMs", "loss", "connectedSeconds", "correlationId",
+}
+
+// playerQuery filters the players of the proxy. Every filter is optional,
+// those that take lists match any of their values.
+type playerQuery struct {
+	servers   []string
+	groups    []string
+	countries []string
+	protocols []int
+	// The player must have connected in [after, before)
+	after  time.Time
+	before time.Time
+	fields []string
+	limit  int
+	// cursor is the username the previous page ended with
+	cursor string
+}
+
+func list(values url.Values, key string) []string {
+	var items []string
+	for _, v := range values[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
+
+// parseTime takes an RFC 3339 time or a duration before now, e.g. 30m.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func parsePlayerQuery(values url.Values, now time.Time) (playerQuery, error) {
+	q := playerQuery{
+		servers:   list(values, "server"),
+		groups:    list(values, "group"),
+		countries: list(values, "country"),
+		fields:    list(values, "fields"),
+		limit:     defaultQueryLimit,
+		cursor:    values.Get("cursor"),
+	}
+
+	for _, v := range list(values, "protocol") {
+		protocol, err := strconv.Atoi(v)
+		if err != nil {
+			return playerQuery{}, fmt.Errorf("invalid protocol %q", v)
+		}
+		q.protocols = append(q.protocols, protocol)
+	}
+
+	for key, t := range map[string]*time.Time{"connectedAfter": &q.after, "connectedBefore": &q.before} {
+		if v := values.Get(key); v != "" {
+			parsed, err := parseTime(v, now)
+			if err != nil {
+				return playerQuery{}, fmt.Errorf("invalid %s %q, expected an RFC 3339 time or a duration", key, v)
+			}
+			*t = parsed
+		}
+	}
+
+	for _, f := range q.fields {
+		if !slices.Contains(playerFields, f) {
+			return playerQuery{}, fmt.Errorf("unknown field %q", f)
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxQueryLimit {
+			return playerQuery{}, fmt.Errorf("limit must be between 1 and %d", maxQueryLimit)
+		}
+		q.limit = limit
+	}
+
+	return q, nil
+}
+
+func (q playerQuery) matches(info playerInfo) bool {
+	if len(q.servers) > 0 && !slices.Contains(q.servers, info.Server) {
+		return false
+	}
+
+	if len(q.groups) > 0 && !slices.Contains(q.groups, info.Group) {
+		return false
+	}
+
+	if len(q.countries) > 0 && !slices.ContainsFunc(q.countries, func(c string) bool { return strings.EqualFold(c, info.Country) }) {
+		return false
+	}
+
+	if len(q.protocols) > 0 && !slices.Contains(q.protocols, info.Protocol) {
+		return false
+	}
+
+	if !q.after.IsZero() && info.ConnectedAt.Before(q.after) {
+		return false
+	}
+
+	return q.before.IsZero() || info.ConnectedAt.Before(q.before)
+}
+
+// selected is the info with only the fields of the query, all without
+// ?fields=.
+func (q playerQuery) selected(info playerInfo) (any, error) {
+	if len(q.fields) == 0 {
+		return info, nil
+	}
+
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]any)
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]any, len(q.fields))
+	for _, f := range q.fields {
+		if v, ok := all[f]; ok {
+			selected[f] = v
+		}
+	}
+
+	return selected, nil
+}
+
+type playerPage struct {
+	Players []any `json:"players"`
+	// Total is how many players matched, across all pages
+	Total int `json:"total"`
+	// Next is the cursor of the next page, empty on the last one
+	Next string `json:"next,omitempty"`
+}
+
+// handleQueryPlayers lists the players of this proxy matching the filters
+// of the query, a page at a time, sorted by username.
+func (p *CorePlugin) handleQueryPlayers(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	q, err := parsePlayerQuery(r.URL.Query(), now)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	matched := make([]playerInfo, 0)
+	for _, player := range p.prx.Players() {
+		if info := p.playerInfo(r.Context(), player, now); q.matches(info) {
+			matched = append(matched, info)
+		}
+	}
+
+	slices.SortFunc(matched, func(a, b playerInfo) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+
+	page := playerPage{Players: make([]any, 0), Total: len(matched)}
+
+	start := 0
+	if q.cursor != "" {
+		start, _ = slices.BinarySearchFunc(matched, q.cursor, func(info playerInfo, cursor string) int {
+			if info.Username <= cursor {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	end := min(start+q.limit, len(matched))
+	for _, info := range matched[start:end] {
+		selected, err := q.selected(info)
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		page.Players = append(page.Players, selected)
+	}
+
+	if end < len(matched) {
+		page.Next = matched[end-1].Username
+	}
+
+	api.WriteJSON(w, http.StatusOK, page)
+}
+
+func remoteAddr(addr net.Addr) netip.Addr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		a, _ := netip.AddrFromSlice(tcp.IP)
+		return a
+	}
+
+	a, _ := netip.ParseAddrPort(addr.String())
+	return a.Addr()
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// debugPlayerCommand traces a player: /debugplayer <name> on [minutes] logs
+// every decision about them with a trace ID, /debugplayer <name> off stops.
+func (p *CorePlugin) debugPlayerCommand() brigodier.LiteralNodeBuilder {
+	allowed := func(c *command.Context) bool {
+		if c.Source.HasPermission("csmc.debug.players") {
+			return true
+		}
+
+		_ = c.Source.SendMessage(&Text{Content: "You do not have permission to trace players.", S: Style{Color: color.Red}})
+		return false
+	}
+
+	on := func(c *command.Context, d time.Duration) error {
+		if !allowed(c) {
+			return nil
+		}
+
+		t, err := p.h.TracePlayer(c.Context, actor(c.Source), c.String("player"), d)
+		if err != nil {
+			return err
+		}
+
+		return c.Source.SendMessage(&Text{
+			S: Style{Color: color.Green},
+			Extra: []Component{
+				&Text{Content: "Tracing " + t.Player + " until " + t.Until.Format(time.TimeOnly) + ", grep the logs for "},
+				&Text{
+					Content: "TRACE " + t.ID,
+					S:       Style{Color: color.Yellow, ClickEvent: CopyToClipboard(t.ID), HoverEvent: ShowText(&Text{Content: "Click to copy"})},
+				},
+				&Text{Content: "."},
+			},
+		})
+	}
+
+	return brigodier.Literal("debugplayer").
+		Then(brigodier.Argument("player", brigodier.String).
+			Then(brigodier.Literal("on").
+				Executes(command.Command(func(c *command.Context) error {
+					return on(c, p.h.TraceDuration())
+				})).
+				Then(brigodier.Argument("minutes", brigodier.Int).
+					Executes(command.Command(func(c *command.Context) error {
+						return on(c, time.Duration(max(1, c.Int("minutes")))*time.Minute)
+					})))).
+			Then(brigodier.Literal("off").
+				Executes(command.Command(func(c *command.Context) error {
+					if !allowed(c) {
+						return nil
+					}
+
+					name := c.String("player")
+					if err := p.h.UntracePlayer(c.Context, actor(c.Source), name); errors.Is(err, hosting.ErrNotTraced) {
+						return c.Source.SendMessage(&Text{Content: name + " is not traced.", S: Style{Color: color.Red}})
+					} else if err != nil {
+						return err
+					}
+
+					return c.Source.SendMessage(&Text{Content: "Stopped tracing " + name + ".", S: Style{Color: color.Green}})
+				}))))
+}
@@ -0,0 +1,82 @@
+package discordsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+const (
+	discordAPI       = "https://discord.com/api/v10"
+	membersPageLimit = 1000
+)
+
+type discordUser struct {
+	ID  string `json:"id"`
+	Bot bool   `json:"bot"`
+}
+
+type guildMember struct {
+	User  discordUser `json:"user"`
+	Roles []string    `json:"roles"`
+}
+
+type discordClient struct {
+	token string
+	http  *http.Client
+}
+
+// membersWithRole pages through all guild members and returns the IDs of those
+// holding the role. The bot needs the GUILD_MEMBERS privileged intent.
+func (d *discordClient) membersWithRole(ctx context.Context, guildID string, roleID string) ([]string, error) {
+	ids := make([]string, 0)
+	after := "0"
+
+	for {
+		q := url.Values{}
+		q.Set("limit", strconv.Itoa(membersPageLimit))
+		q.Set("after", after)
+
+		members := make([]guildMember, 0)
+		if err := d.get(ctx, fmt.Sprintf("/guilds/%s/members?%s", guildID, q.Encode()), &members); err != nil {
+			return nil, err
+		}
+
+		for _, m := range members {
+			if !m.User.Bot && slices.Contains(m.Roles, roleID) {
+				ids = append(ids, m.User.ID)
+			}
+		}
+
+		if len(members) < membersPageLimit {
+			return ids, nil
+		}
+
+		after = members[len(members)-1].User.ID
+	}
+}
+
+func (d *discordClient) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discordAPI+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bot "+d.token)
+
+	res, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord api: %s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
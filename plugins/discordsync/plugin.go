@@ -0,0 +1,78 @@
+package discordsync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/link"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/whitelist"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+func optionsFromEnv() Options {
+	return Options{
+		Token:    util.EnvWithDefault("DISCORD_BOT_TOKEN", ""),
+		GuildID:  util.EnvWithDefault("DISCORD_GUILD_ID", ""),
+		RoleID:   util.EnvWithDefault("DISCORD_WHITELIST_ROLE_ID", ""),
+		Interval: util.EnvDurationWithDefault("DISCORD_SYNC_INTERVAL", 15*time.Minute),
+		DryRun:   util.EnvBoolWithDefault("DISCORD_SYNC_DRY_RUN", false),
+	}
+}
+
+func New(h *hosting.Hosting, links *link.Links, whitelist *whitelist.Whitelist) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Discord Sync",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			opts := optionsFromEnv()
+			if opts.Token == "" || opts.GuildID == "" || opts.RoleID == "" {
+				log.Println("Discord whitelist sync is disabled")
+				return nil
+			}
+
+			syncer, err := NewSyncer(ctx, h, opts, links, whitelist)
+			if err != nil {
+				return err
+			}
+
+			h.API().HandleFunc("POST /discord/sync", syncer.handleSync)
+
+			h.Go("Discord Sync", syncer.Run)
+
+			return nil
+		},
+	}, nil
+}
+
+// handleSync lets the Discord bot trigger a sync when roles change instead of
+// waiting for the next tick. Pass ?dryRun=true to only compute the diff, which
+// works on any proxy, a sync that changes the whitelist only on the leader.
+func (s *Syncer) handleSync(w http.ResponseWriter, r *http.Request) {
+	dryRun := s.opts.DryRun
+	if raw := r.URL.Query().Get("dryRun"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		dryRun = v
+	}
+
+	diff, err := s.Sync(r.Context(), dryRun)
+	if errors.Is(err, ErrNotLeader) {
+		api.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, diff)
+}
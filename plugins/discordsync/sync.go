@@ -0,0 +1,221 @@
+package discordsync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/link"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/whitelist"
+)
+
+// ErrNotLeader is returned when a sync that changes the whitelist is
+// requested from a proxy that isn't the cluster leader.
+var ErrNotLeader = errors.New("only the cluster leader syncs the whitelist")
+
+type Options struct {
+	Token    string
+	GuildID  string
+	RoleID   string
+	Interval time.Duration
+	DryRun   bool
+}
+
+type Diff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	DryRun  bool     `json:"dryRun"`
+}
+
+// Syncer reconciles the whitelist with the linked members of a Discord role.
+// It only ever removes players it added itself, manually whitelisted players
+// are left alone. Only the cluster leader syncs, so proxies don't race each
+// other over the whitelist.
+type Syncer struct {
+	h         *hosting.Hosting
+	opts      Options
+	discord   *discordClient
+	links     *link.Links
+	whitelist *whitelist.Whitelist
+	audit     *audit.Log
+	kv        kv.Bucket
+	m         sync.Mutex
+}
+
+func NewSyncer(ctx context.Context, h *hosting.Hosting, opts Options, links *link.Links, whitelist *whitelist.Whitelist) (*Syncer, error) {
+	kv, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_discord_sync")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Syncer{
+		h:         h,
+		opts:      opts,
+		discord:   &discordClient{token: opts.Token, http: &http.Client{Timeout: 30 * time.Second}},
+		links:     links,
+		whitelist: whitelist,
+		audit:     h.Audit(),
+		kv:        kv,
+	}, nil
+}
+
+func (s *Syncer) managed(ctx context.Context) ([]string, error) {
+	return kv.Typed[[]string](s.kv, "managed").Default(func() []string { return make([]string, 0) }).Get(ctx)
+}
+
+// saveManaged stores the players the sync whitelisted, it is saved after
+// every change so a failed sync still removes those it added later.
+func (s *Syncer) saveManaged(ctx context.Context, managed []string) error {
+	managed = slices.Clone(managed)
+	slices.Sort(managed)
+
+	return kv.Typed[[]string](s.kv, "managed").Set(ctx, slices.Compact(managed))
+}
+
+// leader reports whether this proxy is the cluster leader.
+func (s *Syncer) leader(ctx context.Context) (bool, error) {
+	instances, err := s.h.Cluster().Instances(ctx, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	return cluster.Leader(instances) == s.h.Info.PodName, nil
+}
+
+func (s *Syncer) Sync(ctx context.Context, dryRun bool) (*Diff, error) {
+	if !dryRun {
+		if leader, err := s.leader(ctx); err != nil {
+			return nil, err
+		} else if !leader {
+			return nil, ErrNotLeader
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	members, err := s.discord.membersWithRole(ctx, s.opts.GuildID, s.opts.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make([]string, 0, len(members))
+	for _, discordID := range members {
+		id, err := s.links.PlayerByDiscord(ctx, discordID)
+		if errors.Is(err, link.ErrNotLinked) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		desired = append(desired, id)
+	}
+
+	managed, err := s.managed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{Added: make([]string, 0), Removed: make([]string, 0), DryRun: dryRun}
+
+	for _, id := range desired {
+		if !s.whitelist.Contains(id) {
+			diff.Added = append(diff.Added, id)
+		}
+	}
+
+	for _, id := range managed {
+		if !slices.Contains(desired, id) && s.whitelist.Contains(id) {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		return diff, nil
+	}
+
+	action := "discord.sync"
+	if dryRun {
+		action = "discord.sync.dryrun"
+	}
+
+	if err := s.audit.Record(ctx, audit.Entry{
+		Actor:  "discord-sync",
+		Action: action,
+		Target: s.opts.RoleID,
+		Details: map[string]string{
+			"added":   strings.Join(diff.Added, ","),
+			"removed": strings.Join(diff.Removed, ","),
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return diff, nil
+	}
+
+	for _, id := range diff.Added {
+		if err := s.whitelist.Add(id); err != nil {
+			return nil, err
+		}
+
+		managed = append(managed, id)
+		if err := s.saveManaged(ctx, managed); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range diff.Removed {
+		if err := s.whitelist.Remove(id); err != nil {
+			return nil, err
+		}
+
+		managed = slices.DeleteFunc(managed, func(m string) bool { return m == id })
+		if err := s.saveManaged(ctx, managed); err != nil {
+			return nil, err
+		}
+	}
+
+	// Forget those that left the role after someone else removed them
+	managed = slices.DeleteFunc(managed, func(id string) bool {
+		return !slices.Contains(desired, id)
+	})
+
+	if err := s.saveManaged(ctx, managed); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		diff, err := s.Sync(ctx, s.opts.DryRun)
+		switch {
+		case errors.Is(err, ErrNotLeader):
+		case err != nil:
+			log.Printf("Failed to sync whitelist with Discord: %v", err)
+		default:
+			log.Printf("Synced whitelist with Discord: %d added, %d removed (dry run: %t)", len(diff.Added), len(diff.Removed), diff.DryRun)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
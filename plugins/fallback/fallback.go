@@ -36,7 +36,7 @@ func New(h *hosting.Hosting) (proxy.Plugin, error) {
 }
 
 func (p *FallbackPlugin) Init(ctx context.Context) error {
-	event.Subscribe(p.prx.Event(), 0, p.onServerDisconnect)
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Fallback", p.onServerDisconnect))
 
 	return nil
 }
@@ -44,7 +44,7 @@ func (p *FallbackPlugin) Init(ctx context.Context) error {
 func (p *FallbackPlugin) onServerDisconnect(e *proxy.KickedFromServerEvent) {
 	fmt.Println("Kicked from server!")
 
-	server, err := p.mgr.GetRandomServerOfGamemode(e.Player().Context(), "lobby")
+	server, err := p.mgr.ChooseServer(e.Player().Context(), "lobby", e.Player())
 	if errors.Is(err, hosting.ErrNoServersAvailable) {
 		log.Printf("No servers available for player %s", e.Player().ID())
 		return
@@ -0,0 +1,168 @@
+package incident
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var ageDenied = metrics.NewCounterVec("gate_account_age_denied_total", "Connections to a gamemode denied because the account was too new.", "gamemode")
+
+type external struct {
+	created time.Time
+	known   bool
+	expires time.Time
+}
+
+// ages estimates when accounts were created. Mojang doesn't tell, so the
+// estimate is when the account first joined the network, or what an
+// external source like a shared ban list reports if that is earlier.
+type ages struct {
+	p *Plugin
+	// url has {uuid} replaced by the undashed UUID and answers with
+	// {"created": "<RFC 3339>"}, empty to only use the first join
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	cache  map[string]external
+	m      sync.Mutex
+}
+
+func newAges(p *Plugin) *ages {
+	return &ages{
+		p:      p,
+		url:    util.EnvWithDefault("ACCOUNT_AGE_URL", ""),
+		ttl:    util.EnvDurationWithDefault("ACCOUNT_AGE_CACHE_TTL", time.Hour),
+		client: &http.Client{Timeout: 5 * time.Second},
+		cache:  make(map[string]external),
+	}
+}
+
+// Created returns the estimate of when the account was created, false if
+// there is none.
+func (a *ages) Created(ctx context.Context, id string) (time.Time, bool, error) {
+	created, known, err := a.p.firstJoin(id).Lookup(ctx)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if a.url == "" {
+		return created, known, nil
+	}
+
+	ext, err := a.external(ctx, id)
+	if err != nil {
+		// The first join is still an estimate
+		log.Printf("Failed to look up the account age of %s: %v", id, err)
+		return created, known, nil
+	}
+
+	if ext.known && (!known || ext.created.Before(created)) {
+		return ext.created, true, nil
+	}
+
+	return created, known, nil
+}
+
+func (a *ages) external(ctx context.Context, id string) (external, error) {
+	now := time.Now()
+
+	a.m.Lock()
+	ext, ok := a.cache[id]
+	a.m.Unlock()
+
+	if ok && now.Before(ext.expires) {
+		return ext, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(a.url, "{uuid}", id), nil)
+	if err != nil {
+		return external{}, err
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return external{}, err
+	}
+	defer res.Body.Close()
+
+	ext = external{expires: now.Add(a.ttl)}
+	switch res.StatusCode {
+	case http.StatusOK:
+		body := struct {
+			Created time.Time `json:"created"`
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return external{}, err
+		}
+
+		ext.created, ext.known = body.Created, !body.Created.IsZero()
+	case http.StatusNotFound:
+	default:
+		return external{}, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	a.m.Lock()
+	a.cache[id] = ext
+	a.m.Unlock()
+
+	return ext, nil
+}
+
+// onServerPreConnect keeps accounts off the gamemodes that require them to
+// be older.
+func (p *Plugin) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
+	if !e.Allowed() || e.Server() == nil || e.Player().HasPermission(Permission) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(e.Player().Context(), 5*time.Second)
+	defer cancel()
+
+	cfg, ok, err := p.mgr.AccountAge(ctx, e.Server())
+	if err != nil {
+		log.Printf("Failed to get the account age config of %s: %v", e.Server().ServerInfo().Name(), err)
+		return
+	} else if !ok {
+		return
+	}
+
+	if state, _ := p.h.Incident(); cfg.DuringIncident && !state.Active {
+		return
+	}
+
+	created, known, err := p.ages.Created(ctx, uuid.Normalize(e.Player().ID().String()))
+	if err != nil {
+		log.Printf("Failed to estimate the account age of %s: %v", e.Player().Username(), err)
+		return
+	}
+
+	if cfg.Admits(created, known, time.Now()) {
+		return
+	}
+
+	gamemode, _ := p.mgr.Gamemode(ctx, e.Server())
+	p.h.Tracef(e.Player().Username(), "incident: account too new for %s, created %s", gamemode, created)
+	if !p.h.Enforce("Incident", "account_age", e.Player().Username()) {
+		return
+	}
+
+	ageDenied.Inc(gamemode)
+	e.Deny()
+
+	msg := cfg.Message
+	if msg == "" {
+		msg = "&cYour account is too new to join " + e.Server().ServerInfo().Name() + " right now."
+	}
+	_ = e.Player().SendMessage(util.Text(msg))
+}
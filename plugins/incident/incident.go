@@ -0,0 +1,250 @@
+// Package incident is the in-game switch of incident mode: /incident on
+// applies the bundle stored in KV, like tighter Shield rate limits and chat
+// slow mode, on every proxy, and /incident off reverts it. While it is on,
+// accounts that first joined recently are turned away, so a raid with fresh
+// accounts can't get in. Gamemodes can require old enough accounts on their
+// own, always or during incidents.
+package incident
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Permission lets staff switch incident mode and tells them when it is.
+const Permission = "csmc.incident"
+
+const firstJoinKeyPrefix = "first."
+
+var deniedTotal = metrics.NewCounterVec("gate_incident_denied_total", "Logins of new accounts denied in incident mode.")
+
+type Plugin struct {
+	h    *hosting.Hosting
+	prx  *proxy.Proxy
+	mgr  *hosting.InstanceManager
+	kv   kv.Bucket
+	ages *ages
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Incident",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_incident")
+			if err != nil {
+				return err
+			}
+
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			p := &Plugin{h: h, prx: prx, mgr: mgr, kv: bucket}
+			p.ages = newAges(p)
+
+			return p.Init(prx)
+		},
+	}, nil
+}
+
+func (p *Plugin) Init(prx *proxy.Proxy) error {
+	p.h.OnIncident(p.notify)
+
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Incident", p.onLogin))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Incident", p.onPostLogin))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Incident", p.onServerPreConnect))
+	prx.Command().Register(p.command())
+
+	return nil
+}
+
+func (p *Plugin) firstJoin(id string) *kv.TypedKey[time.Time] {
+	return kv.Typed[time.Time](p.kv, firstJoinKeyPrefix+id)
+}
+
+// notify tells the staff on this proxy that incident mode was switched,
+// every proxy does so for its own.
+func (p *Plugin) notify(state hosting.IncidentState) {
+	if _, b := p.h.Incident(); !b.Notify {
+		return
+	}
+
+	content, c := "Incident mode was turned off by "+state.Actor+".", color.Green
+	if state.Active {
+		content, c = "Incident mode was turned on by "+state.Actor, color.Red
+		if state.Reason != "" {
+			content += ": " + state.Reason
+		}
+		content += "."
+	}
+
+	msg := &Text{Content: content, S: Style{Color: c}}
+	for _, player := range p.prx.Players() {
+		if player.HasPermission(Permission) {
+			_ = player.SendMessage(msg)
+		}
+	}
+}
+
+// onLogin turns away accounts estimated to be newer than the new account
+// minutes of the bundle.
+func (p *Plugin) onLogin(e *proxy.LoginEvent) {
+	state, b := p.h.Incident()
+	if !e.Allowed() || !state.Active || b.NewAccountMinutes == 0 || e.Player().HasPermission(Permission) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(e.Player().Context(), 5*time.Second)
+	defer cancel()
+
+	created, ok, err := p.ages.Created(ctx, uuid.Normalize(e.Player().ID().String()))
+	if err != nil {
+		// Known players shouldn't be locked out because KV is slow
+		log.Printf("Failed to estimate the account age of %s: %v", e.Player().Username(), err)
+		return
+	}
+
+	if ok && time.Since(created) >= time.Duration(b.NewAccountMinutes)*time.Minute {
+		return
+	}
+
+	p.h.Tracef(e.Player().Username(), "incident: new account, created %s", created)
+	if p.h.Enforce("Incident", "new_account", e.Player().Username()) {
+		deniedTotal.Inc()
+		e.Deny(util.Text(b.Message))
+	}
+}
+
+// onPostLogin records when players first joined.
+func (p *Plugin) onPostLogin(e *proxy.PostLoginEvent) {
+	ctx, cancel := context.WithTimeout(p.h.Context(), 5*time.Second)
+	defer cancel()
+
+	key := p.firstJoin(uuid.Normalize(e.Player().ID().String()))
+	if _, ok, err := key.Lookup(ctx); err != nil || ok {
+		return
+	}
+
+	if err := key.Set(ctx, time.Now()); err != nil {
+		log.Printf("Failed to record the first join of %s: %v", e.Player().Username(), err)
+	}
+}
+
+func allowed(c *command.Context) bool {
+	if c.Source.HasPermission(Permission) {
+		return true
+	}
+
+	_ = c.Source.SendMessage(&Text{Content: "You do not have permission to switch incident mode.", S: Style{Color: color.Red}})
+	return false
+}
+
+func actor(source command.Source) string {
+	if player, ok := source.(proxy.Player); ok {
+		return player.Username()
+	}
+
+	return "console"
+}
+
+// command switches incident mode: /incident on [reason], /incident off, and
+// /incident shows whether it is on.
+func (p *Plugin) command() brigodier.LiteralNodeBuilder {
+	set := func(c *command.Context, active bool, reason string) error {
+		state, err := p.h.SetIncident(c.Context, actor(c.Source), active, reason)
+		if err != nil {
+			return err
+		}
+
+		// Players with the permission were told by the notification
+		if _, b := p.h.Incident(); b.Notify {
+			if _, ok := c.Source.(proxy.Player); ok {
+				return nil
+			}
+		}
+
+		return c.Source.SendMessage(&Text{Content: "Incident mode is " + onOff(state.Active) + ".", S: Style{Color: color.Green}})
+	}
+
+	return brigodier.Literal("incident").
+		Executes(command.Command(func(c *command.Context) error {
+			if !allowed(c) {
+				return nil
+			}
+
+			state, b := p.h.Incident()
+			if !state.Active {
+				return c.Source.SendMessage(&Text{Content: "Incident mode is off.", S: Style{Color: color.Green}})
+			}
+
+			return c.Source.SendMessage(&Text{
+				Content: "Incident mode is on since " + state.Since.Format(time.RFC1123) + " by " + state.Actor + ": " +
+					describe(b) + ".",
+				S: Style{Color: color.Red},
+			})
+		})).
+		Then(brigodier.Literal("on").
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				return set(c, true, "")
+			})).
+			Then(brigodier.Argument("reason", brigodier.StringPhrase).
+				Executes(command.Command(func(c *command.Context) error {
+					if !allowed(c) {
+						return nil
+					}
+
+					return set(c, true, c.String("reason"))
+				})))).
+		Then(brigodier.Literal("off").
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				if state, _ := p.h.Incident(); !state.Active {
+					return c.Source.SendMessage(&Text{Content: "Incident mode is already off.", S: Style{Color: color.Red}})
+				}
+
+				return set(c, false, "")
+			})))
+}
+
+func onOff(active bool) string {
+	if active {
+		return "on"
+	}
+
+	return "off"
+}
+
+// describe lists what the bundle changes.
+func describe(b hosting.IncidentBundle) string {
+	s := fmt.Sprintf("%d%% of the rate limits", b.RateLimitPercent)
+	if b.SlowModeSeconds > 0 {
+		s += fmt.Sprintf(", %ds slow mode", b.SlowModeSeconds)
+	}
+	if b.NewAccountMinutes > 0 {
+		s += ", no accounts newer than " + (time.Duration(b.NewAccountMinutes) * time.Minute).String()
+	}
+
+	return s
+}
@@ -0,0 +1,256 @@
+package link
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+)
+
+const (
+	codeLength    = 6
+	codeExpiresIn = 10 * time.Minute
+	// markerGrace keeps redeemed markers past the expiry of their code, a
+	// redeem that checked the code just before it expired still finds them.
+	markerGrace = time.Hour
+)
+
+var (
+	ErrNotLinked    = errors.New("account is not linked")
+	ErrCodeNotFound = errors.New("code not found")
+	ErrCodeExpired  = errors.New("code expired")
+)
+
+type pendingLink struct {
+	UUID      string    `json:"uuid"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Links stores the mapping between Minecraft accounts and Discord accounts.
+// Both directions are stored so lookups never have to scan the bucket.
+type Links struct {
+	kv    kv.Bucket
+	codes kv.Bucket
+	audit *audit.Log
+}
+
+func NewKVLinks(ctx context.Context, h *hosting.Hosting) (*Links, error) {
+	links, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_links")
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_link_codes")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Links{
+		kv:    links,
+		codes: codes,
+		audit: h.Audit(),
+	}, nil
+}
+
+func playerKey(id string) string {
+	return "player." + uuid.Normalize(id)
+}
+
+func discordKey(id string) string {
+	return "discord." + id
+}
+
+// RequestCode creates a short lived code the player redeems on the Discord bot.
+func (l *Links) RequestCode(ctx context.Context, playerUUID string, username string) (string, error) {
+	code, err := util.RandomCode(codeLength)
+	if err != nil {
+		return "", err
+	}
+
+	pending := pendingLink{
+		UUID:      uuid.Normalize(playerUUID),
+		Username:  username,
+		ExpiresAt: time.Now().Add(codeExpiresIn),
+	}
+
+	if err := kv.Typed[pendingLink](l.codes, code).Set(ctx, pending); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// redeemedKey marks a code as redeemed. Creating it is what consumes the code,
+// so of two concurrent redeems only one succeeds. It names the expiry too, a
+// later code with the same letters is a different one.
+func redeemedKey(code string, pending pendingLink) string {
+	return "redeemed." + code + "." + strconv.FormatInt(pending.ExpiresAt.UnixNano(), 10)
+}
+
+// Prune deletes expired codes and the redeemed markers of codes that expired
+// more than markerGrace ago. Every proxy prunes, deleting a key that is
+// already gone is harmless.
+func (l *Links) Prune(ctx context.Context, now time.Time) (int, error) {
+	keys, err := l.codes.ListKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range keys {
+		expired := false
+		if rest, ok := strings.CutPrefix(key, "redeemed."); ok {
+			_, ts, _ := strings.Cut(rest, ".")
+			nanos, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			expired = now.After(time.Unix(0, nanos).Add(markerGrace))
+		} else {
+			pending, ok, err := kv.Typed[pendingLink](l.codes, key).Lookup(ctx)
+			if err != nil {
+				log.Printf("Failed to read link code %s: %v", key, err)
+				continue
+			}
+
+			expired = ok && now.After(pending.ExpiresAt)
+		}
+
+		if !expired {
+			continue
+		}
+
+		if err := l.codes.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// Redeem links the Discord account to the player that requested the code and
+// returns the player's normalized UUID.
+func (l *Links) Redeem(ctx context.Context, code string, discordID string) (string, error) {
+	pending, ok, err := kv.Typed[pendingLink](l.codes, code).Lookup(ctx)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", ErrCodeNotFound
+	}
+
+	if time.Now().After(pending.ExpiresAt) {
+		if err := l.codes.Delete(ctx, code); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return "", err
+		}
+
+		return "", ErrCodeExpired
+	}
+
+	if err := kv.Create(ctx, l.codes, redeemedKey(code, pending), []byte(discordID)); errors.Is(err, kv.ErrKeyExists) {
+		return "", ErrCodeNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := l.Link(ctx, pending.UUID, discordID); err != nil {
+		// Nothing was linked, the code can be used again
+		if err := l.codes.Delete(ctx, redeemedKey(code, pending)); err != nil {
+			log.Printf("Failed to release link code %s: %v", code, err)
+		}
+
+		return "", err
+	}
+
+	if err := l.codes.Delete(ctx, code); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return "", err
+	}
+
+	if err := l.audit.Record(ctx, audit.Entry{
+		Actor:  "discord:" + discordID,
+		Action: "link.redeem",
+		Target: pending.UUID,
+		Details: map[string]string{
+			"username": pending.Username,
+		},
+	}); err != nil {
+		return "", err
+	}
+
+	return pending.UUID, nil
+}
+
+// Link stores the mapping, replacing any previous link of either account.
+func (l *Links) Link(ctx context.Context, playerUUID string, discordID string) error {
+	playerUUID = uuid.Normalize(playerUUID)
+
+	if err := l.Unlink(ctx, playerUUID); err != nil && !errors.Is(err, ErrNotLinked) {
+		return err
+	}
+
+	if previous, err := l.PlayerByDiscord(ctx, discordID); err == nil {
+		if err := l.Unlink(ctx, previous); err != nil && !errors.Is(err, ErrNotLinked) {
+			return err
+		}
+	} else if !errors.Is(err, ErrNotLinked) {
+		return err
+	}
+
+	if err := l.kv.Set(ctx, playerKey(playerUUID), []byte(discordID)); err != nil {
+		return err
+	}
+
+	return l.kv.Set(ctx, discordKey(discordID), []byte(playerUUID))
+}
+
+func (l *Links) Unlink(ctx context.Context, playerUUID string) error {
+	discordID, err := l.DiscordByPlayer(ctx, playerUUID)
+	if err != nil {
+		return err
+	}
+
+	if err := l.kv.Delete(ctx, playerKey(playerUUID)); err != nil {
+		return err
+	}
+
+	if err := l.kv.Delete(ctx, discordKey(discordID)); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// DiscordByPlayer returns the Discord user ID linked to the player.
+func (l *Links) DiscordByPlayer(ctx context.Context, playerUUID string) (string, error) {
+	v, err := l.kv.Get(ctx, playerKey(playerUUID))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return "", ErrNotLinked
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(v), nil
+}
+
+// PlayerByDiscord returns the normalized UUID of the player linked to the Discord user.
+func (l *Links) PlayerByDiscord(ctx context.Context, discordID string) (string, error) {
+	v, err := l.kv.Get(ctx, discordKey(discordID))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return "", ErrNotLinked
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(v), nil
+}
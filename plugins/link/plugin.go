@@ -0,0 +1,225 @@
+package link
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type LinkPlugin struct {
+	links *Links
+	h     *hosting.Hosting
+}
+
+func NewPlugin(h *hosting.Hosting, links *Links) (*LinkPlugin, error) {
+	return &LinkPlugin{
+		links: links,
+		h:     h,
+	}, nil
+}
+
+func New(h *hosting.Hosting, links *Links) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Link",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			plugin, err := NewPlugin(h, links)
+			if err != nil {
+				return err
+			}
+
+			return plugin.Init(prx)
+		},
+	}, nil
+}
+
+func (p *LinkPlugin) Init(prx *proxy.Proxy) error {
+	prx.Command().Register(p.linkCommand())
+	prx.Command().Register(p.unlinkCommand())
+
+	p.h.API().HandleFunc("POST /link/redeem", p.handleRedeem)
+	p.h.API().HandleFunc("GET /link/discord/{id}", p.handleByDiscord)
+	p.h.API().HandleFunc("GET /link/player/{uuid}", p.handleByPlayer)
+	p.h.API().HandleFunc("DELETE /link/player/{uuid}", p.handleUnlink)
+
+	p.h.GDPR().Register("links", gdpr.Subsystem{
+		Export: func(ctx context.Context, player string) (any, error) {
+			discordID, err := p.links.DiscordByPlayer(ctx, player)
+			if errors.Is(err, ErrNotLinked) {
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+
+			return map[string]string{"discord": discordID}, nil
+		},
+		Erase: func(ctx context.Context, player string) (gdpr.Erasure, error) {
+			if err := p.links.Unlink(ctx, player); errors.Is(err, ErrNotLinked) {
+				return gdpr.Erasure{}, nil
+			} else if err != nil {
+				return gdpr.Erasure{}, err
+			}
+
+			return gdpr.Erasure{Erased: 1}, nil
+		},
+	})
+
+	p.h.Go("Link", p.prune)
+
+	return nil
+}
+
+// prune deletes expired codes and their redeemed markers.
+func (p *LinkPlugin) prune(ctx context.Context) {
+	ticker := time.NewTicker(codeExpiresIn)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := p.links.Prune(ctx, now); err != nil {
+				log.Printf("Failed to prune link codes: %v", err)
+			}
+		}
+	}
+}
+
+func (p *LinkPlugin) linkCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("link").
+		Executes(command.Command(func(c *command.Context) error {
+			player, ok := c.Source.(proxy.Player)
+			if !ok {
+				return c.SendMessage(&component.Text{Content: "Only players can link accounts", S: component.Style{Color: color.Red}})
+			}
+
+			code, err := p.links.RequestCode(c.Context, player.ID().String(), player.Username())
+			if err != nil {
+				return err
+			}
+
+			return c.SendMessage(util.Join(
+				&component.Text{Content: "Send ", S: component.Style{Color: color.Green}},
+				&component.Text{
+					Content: "/link " + code,
+					S: component.Style{
+						Color:      color.Yellow,
+						Bold:       component.True,
+						ClickEvent: component.CopyToClipboard(code),
+						HoverEvent: component.ShowText(&component.Text{Content: "Click to copy"}),
+					},
+				},
+				&component.Text{Content: fmt.Sprintf(" to our Discord bot within %s.", codeExpiresIn), S: component.Style{Color: color.Green}},
+			))
+		}))
+}
+
+func (p *LinkPlugin) unlinkCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("unlink").
+		Executes(command.Command(func(c *command.Context) error {
+			player, ok := c.Source.(proxy.Player)
+			if !ok {
+				return c.SendMessage(&component.Text{Content: "Only players can unlink accounts", S: component.Style{Color: color.Red}})
+			}
+
+			if err := p.links.Unlink(c.Context, player.ID().String()); errors.Is(err, ErrNotLinked) {
+				return c.SendMessage(&component.Text{Content: "Your account is not linked", S: component.Style{Color: color.Red}})
+			} else if err != nil {
+				return err
+			}
+
+			return c.SendMessage(&component.Text{Content: "Unlinked your Discord account", S: component.Style{Color: color.Green}})
+		}))
+}
+
+type redeemRequest struct {
+	Code      string `json:"code"`
+	DiscordID string `json:"discordId"`
+}
+
+type linkResponse struct {
+	UUID      string `json:"uuid"`
+	DiscordID string `json:"discordId"`
+}
+
+func (p *LinkPlugin) handleRedeem(w http.ResponseWriter, r *http.Request) {
+	req := redeemRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Code == "" || req.DiscordID == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("code and discordId are required"))
+		return
+	}
+
+	id, err := p.links.Redeem(r.Context(), req.Code, req.DiscordID)
+	if errors.Is(err, ErrCodeNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if errors.Is(err, ErrCodeExpired) {
+		api.WriteError(w, http.StatusGone, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, linkResponse{UUID: id, DiscordID: req.DiscordID})
+}
+
+func (p *LinkPlugin) handleByDiscord(w http.ResponseWriter, r *http.Request) {
+	discordID := r.PathValue("id")
+
+	id, err := p.links.PlayerByDiscord(r.Context(), discordID)
+	if errors.Is(err, ErrNotLinked) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, linkResponse{UUID: id, DiscordID: discordID})
+}
+
+func (p *LinkPlugin) handleByPlayer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("uuid")
+
+	discordID, err := p.links.DiscordByPlayer(r.Context(), id)
+	if errors.Is(err, ErrNotLinked) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, linkResponse{UUID: id, DiscordID: discordID})
+}
+
+func (p *LinkPlugin) handleUnlink(w http.ResponseWriter, r *http.Request) {
+	if err := p.links.Unlink(r.Context(), r.PathValue("uuid")); errors.Is(err, ErrNotLinked) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,288 @@
+package listeners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var (
+	ErrAccountNotFound = errors.New("offline account not found")
+
+	offlineLogins = metrics.NewCounterVec("gate_offline_logins_total", "Logins of offline test accounts, by listener.", "listener")
+
+	accountName = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+)
+
+// OfflineAccount may join without Mojang authentication on listeners with
+// Offline set, from the OFFLINE_ALLOWED_CIDRS networks only.
+type OfflineAccount struct {
+	Name    string    `json:"name"`
+	Comment string    `json:"comment,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+// OfflineAccounts keeps the accounts of the offline bucket in memory, keyed
+// by lowercase name.
+type OfflineAccounts struct {
+	kv       kv.Bucket
+	accounts map[string]OfflineAccount
+	networks []*net.IPNet
+	m        sync.RWMutex
+}
+
+func NewKVOfflineAccounts(ctx context.Context, bucket kv.Bucket) (*OfflineAccounts, error) {
+	networks := make([]*net.IPNet, 0)
+	for _, cidr := range strings.Split(util.EnvWithDefault("OFFLINE_ALLOWED_CIDRS", "127.0.0.0/8,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OFFLINE_ALLOWED_CIDRS: %w", err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	a := &OfflineAccounts{kv: bucket, accounts: make(map[string]OfflineAccount), networks: networks}
+
+	if err := a.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *OfflineAccounts) Reload(ctx context.Context) error {
+	keys, err := a.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	accounts := make(map[string]OfflineAccount)
+	for _, key := range keys {
+		raw, err := a.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		account := OfflineAccount{}
+		if err := json.Unmarshal(raw, &account); err != nil {
+			log.Printf("Failed to unmarshal offline account %s: %v", key, err)
+			continue
+		}
+
+		accounts[key] = account
+	}
+
+	a.m.Lock()
+	a.accounts = accounts
+	a.m.Unlock()
+
+	return nil
+}
+
+func (a *OfflineAccounts) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		account := OfflineAccount{}
+		if err := json.Unmarshal(v.Value, &account); err != nil {
+			log.Printf("Failed to unmarshal offline account %s: %v", v.Key, err)
+			return
+		}
+
+		a.accounts[v.Key] = account
+
+	case kv.Delete:
+		delete(a.accounts, v.Key)
+	}
+}
+
+// Allowed reports whether the name may join in offline mode from addr.
+func (a *OfflineAccounts) Allowed(name string, addr net.Addr) bool {
+	a.m.RLock()
+	_, ok := a.accounts[strings.ToLower(name)]
+	a.m.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && slices.ContainsFunc(a.networks, func(n *net.IPNet) bool {
+		return n.Contains(ip)
+	})
+}
+
+func (a *OfflineAccounts) List() []OfflineAccount {
+	a.m.RLock()
+	defer a.m.RUnlock()
+
+	list := make([]OfflineAccount, 0, len(a.accounts))
+	for _, account := range a.accounts {
+		list = append(list, account)
+	}
+
+	slices.SortFunc(list, func(a, b OfflineAccount) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (a *OfflineAccounts) Add(ctx context.Context, account OfflineAccount) error {
+	if !accountName.MatchString(account.Name) {
+		return fmt.Errorf("invalid account name %q", account.Name)
+	}
+
+	raw, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToLower(account.Name)
+	if err := a.kv.Set(ctx, key, raw); err != nil {
+		return err
+	}
+
+	a.m.Lock()
+	a.accounts[key] = account
+	a.m.Unlock()
+
+	return nil
+}
+
+func (a *OfflineAccounts) Remove(ctx context.Context, name string) error {
+	key := strings.ToLower(name)
+
+	if err := a.kv.Delete(ctx, key); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrAccountNotFound
+	} else if err != nil {
+		return err
+	}
+
+	a.m.Lock()
+	delete(a.accounts, key)
+	a.m.Unlock()
+
+	return nil
+}
+
+func (p *ListenersPlugin) onPreLogin(e *proxy.PreLoginEvent) {
+	if !e.Allowed() {
+		return
+	}
+
+	l, ok := p.listener(e.Conn().RemoteAddr())
+	if !ok || !l.Offline || !p.offline.Allowed(e.Username(), e.Conn().RemoteAddr()) {
+		return
+	}
+
+	e.ForceOfflineMode()
+	offlineLogins.Inc(l.Name)
+
+	log.Printf("WARNING: offline account %s joins without authentication from %s on listener %s", e.Username(), e.Conn().RemoteAddr(), l.Name)
+
+	ctx, cancel := context.WithTimeout(p.h.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   e.Username(),
+		Action:  "offline.login",
+		Target:  l.Name,
+		Details: map[string]string{"address": e.Conn().RemoteAddr().String()},
+	}); err != nil {
+		log.Printf("Failed to record offline login of %s: %v", e.Username(), err)
+	}
+}
+
+func (p *ListenersPlugin) handleListOffline(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.offline.List())
+}
+
+type offlineRequest struct {
+	Comment string `json:"comment"`
+}
+
+func (p *ListenersPlugin) handleAddOffline(w http.ResponseWriter, r *http.Request) {
+	req := offlineRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	account := OfflineAccount{Name: r.PathValue("name"), Comment: req.Comment, Added: time.Now()}
+	if !accountName.MatchString(account.Name) {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid account name %q", account.Name))
+		return
+	}
+
+	if err := p.offline.Add(r.Context(), account); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "offline.add",
+		Target:  account.Name,
+		Details: map[string]string{"comment": account.Comment},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, account)
+}
+
+func (p *ListenersPlugin) handleRemoveOffline(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if err := p.offline.Remove(r.Context(), name); errors.Is(err, ErrAccountNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "offline.remove", Target: name}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,375 @@
+// Package listeners opens Minecraft listeners in addition to Gate's own bind
+// address, each with its own MOTD, forced hosts, PROXY protocol setting, join
+// permission and offline test accounts.
+package listeners
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/bandwidth"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/netbuf"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var connections = metrics.NewGaugeVec("gate_listener_connections", "Open connections of an additional listener.", "listener")
+
+// Listener is configured through the LISTENERS environment variable as a
+// JSON list.
+type Listener struct {
+	Name string `json:"name"`
+	Bind string `json:"bind"`
+	// MOTD replaces the description of server list pings, with & color
+	// codes.
+	MOTD string `json:"motd,omitempty"`
+	// Permission is required to join through this listener.
+	Permission string `json:"permission,omitempty"`
+	// ProxyProtocol expects a PROXY protocol v1 or v2 header on every
+	// connection, e.g. from HAProxy.
+	ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+	// ForcedHosts maps the host players connect with to a server, selector
+	// or gamemode.
+	ForcedHosts map[string]string `json:"forcedHosts,omitempty"`
+	// Offline lets the offline test accounts join through this listener
+	// without Mojang authentication.
+	Offline bool `json:"offline,omitempty"`
+	// Network puts the players of this listener into one of the NETWORKS,
+	// its forced hosts resolve to the servers of that network.
+	Network string `json:"network,omitempty"`
+}
+
+// conn replays bytes buffered while reading the PROXY header and reports the
+// client address from that header. Its packets are fed to the inspector
+// and its bytes to the bandwidth meter, writes are batched by w.
+type conn struct {
+	net.Conn
+	listener  *Listener
+	r         *bufio.Reader
+	w         *netbuf.Writer
+	remote    net.Addr
+	close     sync.Once
+	closed    func()
+	packets   *packets.Conn
+	bandwidth *bandwidth.Conn
+	// readTimeout replaces the read timeout Gate sets, 0 keeps it
+	readTimeout atomic.Int64
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if n > 0 {
+		c.packets.Serverbound(b[:n])
+		c.bandwidth.Read(n)
+	}
+
+	return n, err
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.packets.Clientbound(b)
+
+	n, err := c.w.Write(b)
+	c.bandwidth.Wrote(n)
+
+	return n, err
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// closeTimeout bounds writing what is queued on close, e.g. the reason of a
+// disconnect.
+const closeTimeout = 5 * time.Second
+
+func (c *conn) Close() error {
+	c.close.Do(func() {
+		c.closed()
+
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+		_ = c.w.Close()
+	})
+
+	return c.Conn.Close()
+}
+
+type ListenersPlugin struct {
+	prx *proxy.Proxy
+	h   *hosting.Hosting
+	mgr *hosting.InstanceManager
+	// mgrs are the instance managers of the networks of the listeners
+	mgrs      map[string]*hosting.InstanceManager
+	listeners []Listener
+	offline   *OfflineAccounts
+
+	// conns are the open connections by their remote address, connections
+	// of Gate's own listener are not in it.
+	conns map[string]*conn
+	m     sync.RWMutex
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	listeners := make([]Listener, 0)
+	if raw := os.Getenv("LISTENERS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &listeners); err != nil {
+			return proxy.Plugin{}, fmt.Errorf("invalid LISTENERS: %w", err)
+		}
+	}
+
+	return proxy.Plugin{
+		Name: "Listeners",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_offline")
+			if err != nil {
+				return err
+			}
+
+			offline, err := NewKVOfflineAccounts(ctx, bucket)
+			if err != nil {
+				return err
+			}
+
+			mgrs := make(map[string]*hosting.InstanceManager)
+			for _, l := range listeners {
+				if l.Network == "" || mgrs[l.Network] != nil {
+					continue
+				}
+
+				nw, ok := h.Network(l.Network)
+				if !ok {
+					return fmt.Errorf("listener %s: unknown network %s", l.Name, l.Network)
+				}
+
+				if mgrs[l.Network], err = h.NetworkInstanceManager(ctx, prx, nw); err != nil {
+					return err
+				}
+			}
+
+			p := &ListenersPlugin{prx: prx, h: h, mgr: mgr, mgrs: mgrs, listeners: listeners, offline: offline, conns: make(map[string]*conn)}
+
+			return p.Init(bucket)
+		},
+	}, nil
+}
+
+func (p *ListenersPlugin) Init(bucket kv.Bucket) error {
+	for i := range p.listeners {
+		l := &p.listeners[i]
+
+		if l.Name == "" || l.Bind == "" {
+			return errors.New("listeners need a name and a bind address")
+		}
+
+		hosts := make(map[string]string, len(l.ForcedHosts))
+		for host, destination := range l.ForcedHosts {
+			hosts[strings.ToLower(host)] = destination
+		}
+		l.ForcedHosts = hosts
+
+		ln, err := util.Listen(l.Bind)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+
+		log.Printf("Listener %s listening on %s", l.Name, l.Bind)
+
+		p.h.Go("Listeners", func(ctx context.Context) {
+			p.serve(ctx, l, ln)
+		})
+	}
+
+	// Run after the MOTD and core plugins so the listener settings win
+	event.Subscribe(p.prx.Event(), -1, hosting.Guard(p.h, "Listeners", p.onPing))
+	event.Subscribe(p.prx.Event(), -1, hosting.Guard(p.h, "Listeners", p.onChooseServer))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Listeners", p.onLogin))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Listeners", p.onPreLogin))
+	// After the plugins that pick or deny the server
+	event.Subscribe(p.prx.Event(), -2, hosting.Guard(p.h, "Listeners", p.onServerPreConnect))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Listeners", p.onServerPostConnect))
+
+	p.h.Go("Listeners", func(ctx context.Context) {
+		kv.Watch(ctx, bucket, p.offline.handleChange, p.offline.Reload)
+	})
+	p.h.OnReload("Listeners", p.offline.Reload)
+
+	p.h.API().HandleFunc("GET /offline/accounts", p.handleListOffline)
+	p.h.API().HandleFunc("PUT /offline/accounts/{name}", p.handleAddOffline)
+	p.h.API().HandleFunc("DELETE /offline/accounts/{name}", p.handleRemoveOffline)
+
+	return nil
+}
+
+func (p *ListenersPlugin) serve(ctx context.Context, l *Listener, ln net.Listener) {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		raw, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Listener %s stopped accepting: %v", l.Name, err)
+			}
+			return
+		}
+
+		go p.handle(l, raw)
+	}
+}
+
+func (p *ListenersPlugin) handle(l *Listener, raw net.Conn) {
+	defer p.h.Recover("Listeners")
+
+	c := &conn{Conn: raw, listener: l, r: bufio.NewReader(raw), remote: raw.RemoteAddr()}
+
+	if l.ProxyProtocol {
+		// Connections that don't send the header in time are not from the
+		// load balancer
+		_ = raw.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		addr, err := readProxyHeader(c.r)
+		if err != nil {
+			log.Printf("Listener %s: dropping %s: %v", l.Name, raw.RemoteAddr(), err)
+			raw.Close()
+			return
+		}
+
+		_ = raw.SetReadDeadline(time.Time{})
+
+		if addr == nil {
+			raw.Close()
+			return
+		}
+
+		c.remote = addr
+	}
+
+	key := c.remote.String()
+	c.w = p.h.Buffers().Writer(raw)
+	c.packets = p.h.Packets().Conn(key)
+	c.bandwidth = p.h.Bandwidth().Conn(key, time.Now())
+	c.closed = func() {
+		p.h.Bandwidth().Close(key)
+		c.packets.Close()
+
+		p.m.Lock()
+		delete(p.conns, key)
+		p.m.Unlock()
+
+		connections.Add(-1, l.Name)
+	}
+
+	p.m.Lock()
+	p.conns[key] = c
+	p.m.Unlock()
+
+	connections.Add(1, l.Name)
+
+	p.prx.HandleConn(c)
+}
+
+func (p *ListenersPlugin) conn(addr net.Addr) (*conn, bool) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	c, ok := p.conns[addr.String()]
+
+	return c, ok
+}
+
+func (p *ListenersPlugin) listener(addr net.Addr) (*Listener, bool) {
+	c, ok := p.conn(addr)
+	if !ok {
+		return nil, false
+	}
+
+	return c.listener, true
+}
+
+// manager returns the instance manager of the network of the listener.
+func (p *ListenersPlugin) manager(l *Listener) *hosting.InstanceManager {
+	if l.Network != "" {
+		return p.mgrs[l.Network]
+	}
+
+	return p.mgr
+}
+
+func (p *ListenersPlugin) onPing(e *proxy.PingEvent) {
+	l, ok := p.listener(e.Connection().RemoteAddr())
+	if !ok || l.MOTD == "" {
+		return
+	}
+
+	e.Ping().Description = &Text{Extra: []Component{util.Text(l.MOTD)}}
+}
+
+func (p *ListenersPlugin) onLogin(e *proxy.LoginEvent) {
+	l, ok := p.listener(e.Player().RemoteAddr())
+	if !ok {
+		return
+	}
+
+	if l.Network != "" {
+		if err := p.h.AssignNetwork(e.Player().ID(), l.Network); err != nil {
+			log.Printf("Listener %s: %v", l.Name, err)
+		}
+	}
+
+	if l.Permission == "" || e.Player().HasPermission(l.Permission) {
+		return
+	}
+
+	if p.h.Enforce("Listeners", "permission", e.Player().Username()) {
+		e.Deny(&Text{Content: "You can't join through this address.", S: Style{Color: color.Red}})
+	}
+}
+
+func (p *ListenersPlugin) onChooseServer(e *proxy.PlayerChooseInitialServerEvent) {
+	l, ok := p.listener(e.Player().RemoteAddr())
+	if !ok || len(l.ForcedHosts) == 0 || e.Player().VirtualHost() == nil {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(e.Player().VirtualHost().String())
+	if err != nil {
+		host = e.Player().VirtualHost().String()
+	}
+
+	destination, ok := l.ForcedHosts[strings.ToLower(host)]
+	if !ok {
+		return
+	}
+
+	server, err := p.manager(l).FindServer(e.Player().Context(), destination)
+	if err != nil {
+		log.Printf("Listener %s: no server for forced host %s: %v", l.Name, host, err)
+		return
+	}
+
+	e.SetInitialServer(server)
+}
@@ -0,0 +1,70 @@
+package listeners
+
+import (
+	"context"
+	"time"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// SetReadDeadline moves the deadlines Gate sets to the read timeout of the
+// gamemode the player is on or joins, if it has one.
+func (c *conn) SetReadDeadline(t time.Time) error {
+	if d := time.Duration(c.readTimeout.Load()); d > 0 && !t.IsZero() {
+		t = time.Now().Add(d)
+	}
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// setReadTimeout applies from the next read on, the pending one keeps its
+// deadline.
+func (c *conn) setReadTimeout(seconds int) {
+	c.readTimeout.Store(int64(time.Duration(seconds) * time.Second))
+}
+
+// onServerPreConnect applies the login timeout of the gamemode the player
+// joins first, the backend login and configuration keep the client waiting.
+// Players switching servers keep playing on the previous one meanwhile.
+func (p *ListenersPlugin) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
+	if !e.Allowed() || e.Server() == nil || e.Player().CurrentServer() != nil {
+		return
+	}
+
+	c, ok := p.conn(e.Player().RemoteAddr())
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(e.Player().Context(), 5*time.Second)
+	defer cancel()
+
+	c.setReadTimeout(p.manager(c.listener).ServerTimeouts(ctx, e.Server()).LoginSeconds)
+}
+
+// onServerPostConnect applies the read timeout of the gamemode the player
+// is on now.
+func (p *ListenersPlugin) onServerPostConnect(e *proxy.ServerPostConnectEvent) {
+	c, ok := p.conn(e.Player().RemoteAddr())
+	if !ok {
+		return
+	}
+
+	server := e.Player().CurrentServer()
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(e.Player().Context(), 5*time.Second)
+	defer cancel()
+
+	c.setReadTimeout(p.manager(c.listener).ServerTimeouts(ctx, server.Server()).ReadSeconds)
+}
@@ -0,0 +1,333 @@
+// Package mail keeps a mailbox per player where plugins and the store leave
+// messages and rewards. Players claim them with /mail, rewards are handed to
+// a handler on the proxy or to the co-plugin of the backend the player is on.
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Channel the proxy delivers rewards without a handler on, as a request
+// {"item":{...}}. The co-plugin answers {"delivered":true}, or with an error
+// to keep the item in the mailbox, e.g. because the inventory is full.
+const Channel = "csmc:mail"
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrNotDelivered = errors.New("reward was not delivered")
+
+	itemsTotal = metrics.NewCounterVec("gate_mail_items_total", "Mailbox items, by what happened to them.", "result")
+)
+
+// Reward is what claiming an item gives, Type picks the handler.
+type Reward struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type Item struct {
+	ID     string `json:"id"`
+	Player string `json:"player"`
+	// From is who left the item, e.g. store or a plugin
+	From    string    `json:"from"`
+	Message string    `json:"message"`
+	Reward  *Reward   `json:"reward,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func (i Item) key() string {
+	return i.Player + "." + i.ID
+}
+
+// Handler delivers a reward on the proxy, to the player claiming it.
+type Handler func(ctx context.Context, player proxy.Player, item Item) error
+
+type deliverRequest struct {
+	Item Item `json:"item"`
+}
+
+type deliverResponse struct {
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Mailbox is shared by the plugins that leave items, handlers can be added
+// and items deposited before and after the mail plugin is initialized.
+type Mailbox struct {
+	h      *hosting.Hosting
+	kv     kv.Bucket
+	bridge *bridge.Bridge
+	// channel is registered when the mail plugin is initialized
+	channel *bridge.Channel
+	// expiry is how long items wait to be claimed by default
+	expiry time.Duration
+
+	handlers map[string]Handler
+	// claiming serializes the claims of a player on this proxy
+	claiming sync.Mutex
+	m        sync.Mutex
+}
+
+func NewKVMailbox(ctx context.Context, h *hosting.Hosting, b *bridge.Bridge) (*Mailbox, error) {
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_mail")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mailbox{
+		h:        h,
+		kv:       bucket,
+		bridge:   b,
+		expiry:   util.EnvDurationWithDefault("MAIL_EXPIRY", 30*24*time.Hour),
+		handlers: make(map[string]Handler),
+	}, nil
+}
+
+func (m *Mailbox) registerChannel() error {
+	channel, err := m.bridge.Register(Channel, nil)
+	if err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.channel = channel
+
+	return nil
+}
+
+// Handle delivers rewards of the type on the proxy instead of the backend.
+func (m *Mailbox) Handle(rewardType string, handler Handler) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.handlers[rewardType] = handler
+}
+
+// Deposit leaves the item in the mailbox of the player, by undashed UUID. It
+// fills in the ID and times, and tells the player if they are online.
+func (m *Mailbox) Deposit(ctx context.Context, item Item) (Item, error) {
+	if item.Player == "" || item.Message == "" && item.Reward == nil {
+		return Item{}, errors.New("an item needs a player and a message or reward")
+	}
+
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Item{}, err
+	}
+
+	now := time.Now().UTC()
+	item.ID, item.Created = hex.EncodeToString(id), now
+	if item.Expires.IsZero() {
+		item.Expires = now.Add(m.expiry)
+	}
+
+	if err := kv.Typed[Item](m.kv, item.key()).Set(ctx, item); err != nil {
+		return Item{}, err
+	}
+
+	itemsTotal.Inc("deposited")
+
+	if err := m.h.Messaging().Publish(ctx, m.h.Info.MailSubject(), []byte(item.Player)); err != nil {
+		log.Printf("Failed to announce mail for %s: %v", item.Player, err)
+	}
+
+	return item, nil
+}
+
+// all returns every item by key, the mailboxes have no index so this reads
+// all of them.
+func (m *Mailbox) all(ctx context.Context, prefix string) ([]Item, error) {
+	keys, err := m.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		item, ok, err := kv.Typed[Item](m.kv, key).Lookup(ctx)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			items = append(items, item)
+		}
+	}
+
+	slices.SortFunc(items, func(a, b Item) int {
+		return a.Created.Compare(b.Created)
+	})
+
+	return items, nil
+}
+
+// Items returns the unexpired items of the player, oldest first.
+func (m *Mailbox) Items(ctx context.Context, player string) ([]Item, error) {
+	items, err := m.all(ctx, player+".")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return slices.DeleteFunc(items, func(i Item) bool {
+		return !now.Before(i.Expires)
+	}), nil
+}
+
+// Delete takes the item out of the mailbox of the player without claiming it.
+func (m *Mailbox) Delete(ctx context.Context, player, id string) error {
+	key := player + "." + id
+	if _, ok, err := kv.Typed[Item](m.kv, key).Lookup(ctx); err != nil {
+		return err
+	} else if !ok {
+		return ErrItemNotFound
+	}
+
+	return m.kv.Delete(ctx, key)
+}
+
+// Claim hands the item to the player. The item leaves the mailbox first and
+// goes back if the delivery fails.
+func (m *Mailbox) Claim(ctx context.Context, player proxy.Player, id string) (Item, error) {
+	m.claiming.Lock()
+	defer m.claiming.Unlock()
+
+	item, ok, err := kv.Typed[Item](m.kv, player.ID().Undashed()+"."+id).Lookup(ctx)
+	if err != nil {
+		return Item{}, err
+	} else if !ok || !time.Now().Before(item.Expires) {
+		return Item{}, ErrItemNotFound
+	}
+
+	if err := m.kv.Delete(ctx, item.key()); err != nil {
+		return Item{}, err
+	}
+
+	if err := m.deliver(ctx, player, item); err != nil {
+		itemsTotal.Inc("failed")
+
+		if err := kv.Typed[Item](m.kv, item.key()).Set(ctx, item); err != nil {
+			log.Printf("Failed to put back item %s of %s: %v", item.ID, player.Username(), err)
+		}
+
+		return Item{}, err
+	}
+
+	itemsTotal.Inc("claimed")
+
+	details := map[string]string{"id": item.ID, "from": item.From}
+	if item.Reward != nil {
+		details["reward"] = item.Reward.Type
+	}
+
+	return item, m.h.Audit().Record(ctx, audit.Entry{Actor: player.Username(), Action: "mail.claim", Target: item.Player, Details: details})
+}
+
+func (m *Mailbox) deliver(ctx context.Context, player proxy.Player, item Item) error {
+	if item.Reward == nil {
+		return nil
+	}
+
+	m.m.Lock()
+	handler, ok := m.handlers[item.Reward.Type]
+	channel := m.channel
+	m.m.Unlock()
+
+	if ok {
+		return handler(ctx, player, item)
+	}
+
+	if channel == nil {
+		return fmt.Errorf("%w: the mail plugin isn't initialized", ErrNotDelivered)
+	}
+
+	res := deliverResponse{}
+	if err := channel.Request(ctx, player.ID(), deliverRequest{Item: item}, &res); err != nil {
+		return err
+	}
+
+	if !res.Delivered {
+		if res.Error != "" {
+			return fmt.Errorf("%w: %s", ErrNotDelivered, res.Error)
+		}
+
+		return ErrNotDelivered
+	}
+
+	return nil
+}
+
+// Expire deletes the items nobody claimed in time and returns how many.
+func (m *Mailbox) Expire(ctx context.Context, now time.Time) (int, error) {
+	items, err := m.all(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, item := range items {
+		if now.Before(item.Expires) {
+			continue
+		}
+
+		if err := m.kv.Delete(ctx, item.key()); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return expired, err
+		}
+
+		expired++
+		itemsTotal.Inc("expired")
+	}
+
+	return expired, nil
+}
+
+func (m *Mailbox) export(ctx context.Context, player string) (any, error) {
+	items, err := m.all(ctx, player+".")
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (m *Mailbox) erase(ctx context.Context, player string) (gdpr.Erasure, error) {
+	items, err := m.all(ctx, player+".")
+	if err != nil {
+		return gdpr.Erasure{}, err
+	}
+
+	e := gdpr.Erasure{}
+	for _, item := range items {
+		if err := m.kv.Delete(ctx, item.key()); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return e, err
+		}
+
+		e.Erased++
+	}
+
+	return e, nil
+}
@@ -0,0 +1,321 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
+)
+
+type MailPlugin struct {
+	prx  *proxy.Proxy
+	h    *hosting.Hosting
+	mail *Mailbox
+}
+
+func New(h *hosting.Hosting, mail *Mailbox) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Mail",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			if err := mail.registerChannel(); err != nil {
+				return err
+			}
+
+			p := &MailPlugin{prx: prx, h: h, mail: mail}
+
+			return p.Init(util.EnvDurationWithDefault("MAIL_SWEEP_INTERVAL", 10*time.Minute))
+		},
+	}, nil
+}
+
+func (p *MailPlugin) Init(sweep time.Duration) error {
+	if err := p.h.Messaging().Subscribe(p.h.Info.MailSubject(), p.onMail); err != nil {
+		return err
+	}
+
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Mail", p.onServerPostConnect))
+
+	p.prx.Command().Register(p.mailCommand())
+
+	p.h.API().HandleFunc("GET /mail/{player}", p.handleList)
+	p.h.API().HandleFunc("POST /mail/{player}", p.handleDeposit)
+	p.h.API().HandleFunc("DELETE /mail/{player}/{id}", p.handleDelete)
+
+	p.h.GDPR().Register("mail", gdpr.Subsystem{Export: p.mail.export, Erase: p.mail.erase})
+
+	p.h.Go("Mail", func(ctx context.Context) {
+		p.sweepExpired(ctx, sweep)
+	})
+
+	return nil
+}
+
+// sweepExpired deletes what nobody claimed on the leader.
+func (p *MailPlugin) sweepExpired(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			instances, err := p.h.Cluster().Instances(ctx, now)
+			if err != nil {
+				log.Printf("Failed to list the cluster for mail expiry: %v", err)
+				continue
+			}
+
+			if cluster.Leader(instances) != p.h.Info.PodName {
+				continue
+			}
+
+			if n, err := p.mail.Expire(ctx, now); err != nil {
+				log.Printf("Failed to expire mail: %v", err)
+			} else if n > 0 {
+				log.Printf("Expired %d unclaimed mailbox items", n)
+			}
+		}
+	}
+}
+
+// notify tells the player how much mail waits for them.
+func (p *MailPlugin) notify(ctx context.Context, player proxy.Player) {
+	items, err := p.mail.Items(ctx, player.ID().Undashed())
+	if err != nil {
+		log.Printf("Failed to get the mail of %s: %v", player.Username(), err)
+		return
+	} else if len(items) == 0 {
+		return
+	}
+
+	msg := "You have 1 unclaimed item in your mailbox."
+	if len(items) > 1 {
+		msg = fmt.Sprintf("You have %d unclaimed items in your mailbox.", len(items))
+	}
+
+	if err := player.SendMessage(&Text{
+		Extra: []Component{
+			&Text{Content: "ᴍᴀɪʟ ", S: Style{Color: color.Gold, Bold: True}},
+			&Text{Content: msg + " ", S: Style{Color: color.Yellow}},
+			&Text{Content: "[Open]", S: Style{
+				Color:      color.Aqua,
+				ClickEvent: RunCommand("/mail"),
+				HoverEvent: ShowText(&Text{Content: "/mail"}),
+			}},
+		},
+	}); err != nil {
+		log.Printf("Failed to tell %s about their mail: %v", player.Username(), err)
+	}
+}
+
+func (p *MailPlugin) onServerPostConnect(e *proxy.ServerPostConnectEvent) {
+	if e.PreviousServer() != nil {
+		return
+	}
+
+	player := e.Player()
+	go func() {
+		defer p.h.Recover("Mail")
+
+		p.notify(p.h.Context(), player)
+	}()
+}
+
+// onMail tells the player that got mail if they are on this proxy.
+func (p *MailPlugin) onMail(msg messaging.Message) {
+	defer p.h.Recover("Mail")
+
+	id, err := guuid.Parse(string(msg.Data))
+	if err != nil {
+		log.Printf("Invalid mail announcement %q: %v", msg.Data, err)
+		return
+	}
+
+	if player := p.prx.Player(id); player != nil {
+		p.notify(msg.Context, player)
+	}
+}
+
+func (p *MailPlugin) mailCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("mail").
+		Executes(command.Command(func(c *command.Context) error {
+			player, ok := c.Source.(proxy.Player)
+			if !ok {
+				return c.Source.SendMessage(&Text{Content: "Only players have a mailbox.", S: Style{Color: color.Red}})
+			}
+
+			return p.list(c.Context, player)
+		})).
+		Then(brigodier.Literal("claim").
+			Then(brigodier.Argument("id", brigodier.StringWord).
+				Executes(command.Command(func(c *command.Context) error {
+					player, ok := c.Source.(proxy.Player)
+					if !ok {
+						return c.Source.SendMessage(&Text{Content: "Only players have a mailbox.", S: Style{Color: color.Red}})
+					}
+
+					return p.claim(c.Context, player, c.String("id"))
+				}))))
+}
+
+func (p *MailPlugin) list(ctx context.Context, player proxy.Player) error {
+	items, err := p.mail.Items(ctx, player.ID().Undashed())
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return player.SendMessage(&Text{Content: "Your mailbox is empty.", S: Style{Color: color.Gray}})
+	}
+
+	lines := []Component{&Text{Content: fmt.Sprintf("Mailbox (%d)", len(items)), S: Style{Color: color.Gold, Bold: True}}}
+	for _, item := range items {
+		claim := "/mail claim " + item.ID
+		lines = append(lines,
+			&Text{Content: "\n"},
+			&Text{Content: "[Claim] ", S: Style{
+				Color:      color.Green,
+				ClickEvent: RunCommand(claim),
+				HoverEvent: ShowText(&Text{Content: claim}),
+			}},
+			&Text{Content: item.Message, S: Style{Color: color.White}},
+			&Text{Content: fmt.Sprintf(" from %s, expires %s", item.From, item.Expires.Local().Format(time.DateOnly)), S: Style{Color: color.Gray}},
+		)
+	}
+
+	if len(items) > 1 {
+		lines = append(lines, &Text{Content: "\n"}, &Text{Content: "[Claim all]", S: Style{
+			Color:      color.Aqua,
+			ClickEvent: RunCommand("/mail claim all"),
+			HoverEvent: ShowText(&Text{Content: "/mail claim all"}),
+		}})
+	}
+
+	return player.SendMessage(&Text{Extra: lines})
+}
+
+func (p *MailPlugin) claim(ctx context.Context, player proxy.Player, id string) error {
+	ids := []string{id}
+	if id == "all" {
+		items, err := p.mail.Items(ctx, player.ID().Undashed())
+		if err != nil {
+			return err
+		}
+
+		ids = make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+	}
+
+	if len(ids) == 0 {
+		return player.SendMessage(&Text{Content: "Your mailbox is empty.", S: Style{Color: color.Gray}})
+	}
+
+	for _, id := range ids {
+		item, err := p.mail.Claim(ctx, player, id)
+		if errors.Is(err, ErrItemNotFound) {
+			return player.SendMessage(&Text{Content: "That item is no longer in your mailbox.", S: Style{Color: color.Red}})
+		} else if err != nil {
+			log.Printf("Failed to claim mail %s of %s: %v", id, player.Username(), err)
+
+			// The rest likely fails the same way, e.g. with a full inventory
+			return player.SendMessage(&Text{Content: "Your item could not be delivered, try again later.", S: Style{Color: color.Red}})
+		}
+
+		if err := player.SendMessage(&Text{Content: "Claimed: " + item.Message, S: Style{Color: color.Green}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *MailPlugin) handleList(w http.ResponseWriter, r *http.Request) {
+	items, err := p.mail.Items(r.Context(), uuid.Normalize(r.PathValue("player")))
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, items)
+}
+
+type depositRequest struct {
+	From    string     `json:"from"`
+	Message string     `json:"message"`
+	Reward  *Reward    `json:"reward"`
+	Expires *time.Time `json:"expires"`
+}
+
+func (p *MailPlugin) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	req := depositRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	player := uuid.Normalize(r.PathValue("player"))
+	if len(player) != 32 {
+		api.WriteError(w, http.StatusBadRequest, errors.New("player must be a UUID"))
+		return
+	}
+
+	item := Item{Player: player, From: req.From, Message: req.Message, Reward: req.Reward}
+	if item.From == "" {
+		item.From = "api"
+	}
+	if req.Expires != nil {
+		item.Expires = *req.Expires
+	}
+
+	item, err := p.mail.Deposit(r.Context(), item)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "mail.deposit", Target: player, Details: map[string]string{"id": item.ID}}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusCreated, item)
+}
+
+func (p *MailPlugin) handleDelete(w http.ResponseWriter, r *http.Request) {
+	player, id := uuid.Normalize(r.PathValue("player")), r.PathValue("id")
+	if err := p.mail.Delete(r.Context(), player, id); errors.Is(err, ErrItemNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "mail.delete", Target: player, Details: map[string]string{"id": id}}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
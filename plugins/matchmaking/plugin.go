@@ -0,0 +1,348 @@
+// Package matchmaking queues players for minigames and places them into game
+// slots that backends announce over messaging.
+//
+// Slots are broadcast to every proxy, so two proxies can fill the same slot
+// at the same time. The backend stays authoritative: it rejects players it
+// has no room for, which puts their group back at the front of the queue.
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/rpc"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var (
+	queuedPlayers = metrics.NewGaugeVec("gate_matchmaking_queued_players", "Players waiting in the matchmaking queue.", "gamemode")
+	matches       = metrics.NewCounterVec("gate_matchmaking_matches_total", "Groups placed into game slots.", "gamemode", "result")
+	timeouts      = metrics.NewCounterVec("gate_matchmaking_timeouts_total", "Groups that waited too long and were removed from the queue.", "gamemode")
+)
+
+type MatchmakingPlugin struct {
+	prx     *proxy.Proxy
+	h       *hosting.Hosting
+	mgr     *hosting.InstanceManager
+	timeout time.Duration
+	q       *queue
+	m       sync.Mutex
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Matchmaking",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			p := &MatchmakingPlugin{
+				prx:     prx,
+				h:       h,
+				mgr:     mgr,
+				timeout: util.EnvDurationWithDefault("MATCHMAKING_QUEUE_TIMEOUT", 5*time.Minute),
+				q:       newQueue(),
+			}
+
+			return p.Init(ctx)
+		},
+	}, nil
+}
+
+func (p *MatchmakingPlugin) Init(ctx context.Context) error {
+	if err := p.h.Messaging().Subscribe(p.h.Info.MatchmakingSlotsSubject(), p.onSlot); err != nil {
+		return err
+	}
+
+	p.h.Go("Matchmaking", p.tick)
+
+	p.prx.Command().Register(p.command())
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Matchmaking", p.onDisconnect))
+	p.h.API().HandleFunc("GET /matchmaking", p.handleStatus)
+
+	return nil
+}
+
+func (p *MatchmakingPlugin) onSlot(msg messaging.Message) {
+	defer p.h.Recover("Matchmaking")
+
+	s := rpc.GameSlot{}
+	if err := json.Unmarshal(msg.Data, &s); err != nil {
+		log.Printf("Failed to unmarshal game slot: %v", err)
+		return
+	}
+
+	if s.ID == "" || s.Gamemode == "" || s.Server == "" {
+		log.Printf("Ignoring incomplete game slot %+v", s)
+		return
+	}
+
+	p.m.Lock()
+	p.q.announce(s, time.Now())
+	found := p.q.match(s.Gamemode)
+	p.m.Unlock()
+
+	p.place(found)
+}
+
+// tick expires slots and groups that waited too long.
+func (p *MatchmakingPlugin) tick(ctx context.Context) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		p.m.Lock()
+		expired := p.q.expire(time.Now(), p.timeout)
+		p.updateGauges()
+		p.m.Unlock()
+
+		for _, g := range expired {
+			timeouts.Inc(g.gamemode)
+
+			for _, player := range g.players {
+				_ = player.SendMessage(&Text{
+					Content: fmt.Sprintf("No %s game was found in time, you left the queue.", g.gamemode),
+					S:       Style{Color: color.Red},
+				})
+			}
+		}
+	}
+}
+
+// updateGauges must be called with the lock held.
+func (p *MatchmakingPlugin) updateGauges() {
+	for gamemode, groups := range p.q.groups {
+		n := 0
+		for _, g := range groups {
+			n += len(g.players)
+		}
+
+		queuedPlayers.Set(int64(n), gamemode)
+	}
+}
+
+func (p *MatchmakingPlugin) place(found []match) {
+	for _, m := range found {
+		go p.transfer(m)
+	}
+}
+
+// transfer connects every player of the group to the slot's server. Players
+// that could not be connected are requeued at the front.
+func (p *MatchmakingPlugin) transfer(m match) {
+	defer p.h.Recover("Matchmaking")
+
+	server := p.prx.Server(m.slot.Server)
+
+	failed := make([]proxy.Player, 0)
+	for _, player := range m.group.players {
+		if server == nil {
+			failed = append(failed, player)
+			continue
+		}
+
+		res, err := p.mgr.Connect(player.Context(), player, server)
+
+		if err != nil || (res.Status() != proxy.SuccessConnectionStatus && res.Status() != proxy.AlreadyConnectedConnectionStatus) {
+			log.Printf("Failed to send player %s to game %s on %s: %v", player.ID(), m.slot.ID, m.slot.Server, err)
+
+			// Players that left in the meantime are not requeued
+			if player.Active() {
+				failed = append(failed, player)
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		matches.Inc(m.group.gamemode, "ok")
+		return
+	}
+
+	matches.Inc(m.group.gamemode, "requeued")
+
+	g := &group{gamemode: m.group.gamemode, players: failed, since: m.group.since}
+
+	p.m.Lock()
+	p.q.push(g, true)
+	found := p.q.match(g.gamemode)
+	p.m.Unlock()
+
+	for _, player := range failed {
+		_ = player.SendMessage(&Text{Content: "The game was full, you are back in the queue.", S: Style{Color: color.Yellow}})
+	}
+
+	p.place(found)
+}
+
+// party returns everyone online that shares the player's sticky routing key,
+// or only the player if it has none.
+func (p *MatchmakingPlugin) party(ctx context.Context, player proxy.Player) ([]proxy.Player, error) {
+	key, err := p.mgr.StickyKey(ctx, player.ID())
+	if err != nil || key == "" {
+		return []proxy.Player{player}, err
+	}
+
+	party := []proxy.Player{player}
+	for _, other := range p.prx.Players() {
+		if other.ID() == player.ID() {
+			continue
+		}
+
+		otherKey, err := p.mgr.StickyKey(ctx, other.ID())
+		if err != nil {
+			return nil, err
+		}
+
+		if otherKey == key {
+			party = append(party, other)
+		}
+	}
+
+	return party, nil
+}
+
+func (p *MatchmakingPlugin) Queue(ctx context.Context, player proxy.Player, gamemode string) (int, error) {
+	players, err := p.party(ctx, player)
+	if err != nil {
+		return 0, err
+	}
+
+	p.m.Lock()
+	for _, member := range players {
+		if g := p.q.leave(member.ID()); g != nil {
+			log.Printf("Player %s switched queue from %s to %s", member.ID(), g.gamemode, gamemode)
+		}
+	}
+
+	p.q.push(&group{gamemode: gamemode, players: players, since: time.Now()}, false)
+	found := p.q.match(gamemode)
+	p.updateGauges()
+	p.m.Unlock()
+
+	p.place(found)
+
+	return len(players), nil
+}
+
+func (p *MatchmakingPlugin) Leave(player proxy.Player) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	g := p.q.leave(player.ID())
+	p.updateGauges()
+
+	return g != nil
+}
+
+func (p *MatchmakingPlugin) onDisconnect(e *proxy.DisconnectEvent) {
+	p.Leave(e.Player())
+}
+
+func (p *MatchmakingPlugin) command() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("play").
+		Then(brigodier.
+			Argument("gamemode", brigodier.StringWord).
+			Suggests(command.SuggestFunc(func(c *command.Context, b *brigodier.SuggestionsBuilder) *brigodier.Suggestions {
+				p.m.Lock()
+				defer p.m.Unlock()
+
+				for _, s := range p.q.slots {
+					b.Suggest(s.Gamemode)
+				}
+				return b.Build()
+			})).
+			Executes(p.playCommand())).
+		Executes(p.leaveCommand())
+}
+
+func (p *MatchmakingPlugin) playCommand() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		player, ok := c.Source.(proxy.Player)
+		if !ok {
+			return c.SendMessage(&Text{Content: "Only players can queue.", S: Style{Color: color.Red}})
+		}
+
+		gamemode := c.String("gamemode")
+
+		n, err := p.Queue(player.Context(), player, gamemode)
+		if err != nil {
+			log.Printf("Failed to queue player %s for %s: %v", player.ID(), gamemode, err)
+			return c.SendMessage(&Text{Content: "Could not join the queue, try again later.", S: Style{Color: color.Red}})
+		}
+
+		msg := fmt.Sprintf("You joined the %s queue.", gamemode)
+		if n > 1 {
+			msg = fmt.Sprintf("Your party of %d joined the %s queue.", n, gamemode)
+		}
+
+		return c.SendMessage(&Text{Content: msg + " Run /play again to leave it.", S: Style{Color: color.Green}})
+	})
+}
+
+func (p *MatchmakingPlugin) leaveCommand() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		player, ok := c.Source.(proxy.Player)
+		if !ok || !p.Leave(player) {
+			return c.SendMessage(&Text{Content: "Usage: /play <gamemode>", S: Style{Color: color.Red}})
+		}
+
+		return c.SendMessage(&Text{Content: "You left the queue.", S: Style{Color: color.Yellow}})
+	})
+}
+
+type queueStatus struct {
+	Gamemode string   `json:"gamemode"`
+	Players  []string `json:"players"`
+	Waiting  string   `json:"waiting"`
+}
+
+type status struct {
+	Queue []queueStatus  `json:"queue"`
+	Slots []rpc.GameSlot `json:"slots"`
+}
+
+func (p *MatchmakingPlugin) handleStatus(w http.ResponseWriter, r *http.Request) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	s := status{Queue: make([]queueStatus, 0), Slots: make([]rpc.GameSlot, 0)}
+	for gamemode, groups := range p.q.groups {
+		for _, g := range groups {
+			players := make([]string, 0, len(g.players))
+			for _, id := range g.ids() {
+				players = append(players, id.String())
+			}
+
+			s.Queue = append(s.Queue, queueStatus{Gamemode: gamemode, Players: players, Waiting: time.Since(g.since).Round(time.Second).String()})
+		}
+	}
+
+	for _, slot := range p.q.slots {
+		s.Slots = append(s.Slots, slot.GameSlot)
+	}
+
+	api.WriteJSON(w, http.StatusOK, s)
+}
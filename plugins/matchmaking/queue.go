@@ -0,0 +1,164 @@
+package matchmaking
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/rpc"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+const defaultSlotTTL = 30 * time.Second
+
+// group is queued and placed as a whole, either a single player or everyone
+// online that shares the player's party (sticky routing key).
+type group struct {
+	gamemode string
+	players  []proxy.Player
+	since    time.Time
+}
+
+func (g *group) ids() []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(g.players))
+	for _, p := range g.players {
+		ids = append(ids, p.ID())
+	}
+
+	return ids
+}
+
+type slot struct {
+	rpc.GameSlot
+	expires time.Time
+}
+
+type match struct {
+	group *group
+	slot  rpc.GameSlot
+}
+
+// queue is not safe for concurrent use, the plugin guards it with its mutex.
+type queue struct {
+	groups map[string][]*group
+	slots  map[string]*slot
+	queued map[uuid.UUID]*group
+}
+
+func newQueue() *queue {
+	return &queue{
+		groups: make(map[string][]*group),
+		slots:  make(map[string]*slot),
+		queued: make(map[uuid.UUID]*group),
+	}
+}
+
+func (q *queue) announce(s rpc.GameSlot, now time.Time) {
+	if s.Free <= 0 {
+		delete(q.slots, s.ID)
+		return
+	}
+
+	ttl := defaultSlotTTL
+	if s.TTL > 0 {
+		ttl = time.Duration(s.TTL) * time.Second
+	}
+
+	q.slots[s.ID] = &slot{GameSlot: s, expires: now.Add(ttl)}
+}
+
+// push adds g to the back of its gamemode queue, or the front when it is
+// requeued after a failed transfer.
+func (q *queue) push(g *group, front bool) {
+	if front {
+		q.groups[g.gamemode] = slices.Insert(q.groups[g.gamemode], 0, g)
+	} else {
+		q.groups[g.gamemode] = append(q.groups[g.gamemode], g)
+	}
+
+	for _, p := range g.players {
+		q.queued[p.ID()] = g
+	}
+}
+
+func (q *queue) remove(g *group) {
+	q.groups[g.gamemode] = slices.DeleteFunc(q.groups[g.gamemode], func(g2 *group) bool { return g2 == g })
+
+	for _, p := range g.players {
+		if q.queued[p.ID()] == g {
+			delete(q.queued, p.ID())
+		}
+	}
+}
+
+// leave removes the player from its group, the rest of the group stays
+// queued.
+func (q *queue) leave(id uuid.UUID) *group {
+	g, ok := q.queued[id]
+	if !ok {
+		return nil
+	}
+
+	delete(q.queued, id)
+	g.players = slices.DeleteFunc(g.players, func(p proxy.Player) bool { return p.ID() == id })
+
+	if len(g.players) == 0 {
+		q.remove(g)
+	}
+
+	return g
+}
+
+// expire drops expired slots and returns the groups that waited longer than
+// timeout, which are removed from the queue.
+func (q *queue) expire(now time.Time, timeout time.Duration) []*group {
+	for id, s := range q.slots {
+		if now.After(s.expires) {
+			delete(q.slots, id)
+		}
+	}
+
+	var expired []*group
+	for _, groups := range q.groups {
+		for _, g := range groups {
+			if now.Sub(g.since) > timeout {
+				expired = append(expired, g)
+			}
+		}
+	}
+
+	for _, g := range expired {
+		q.remove(g)
+	}
+
+	return expired
+}
+
+// match fills the gamemode's slots with queued groups in order. A group that
+// does not fit into any slot does not block smaller groups behind it.
+func (q *queue) match(gamemode string) []match {
+	var matches []match
+
+	for _, s := range q.slots {
+		if s.Gamemode != gamemode {
+			continue
+		}
+
+		for _, g := range slices.Clone(q.groups[gamemode]) {
+			if len(g.players) > s.Free {
+				continue
+			}
+
+			q.remove(g)
+			s.Free -= len(g.players)
+			matches = append(matches, match{group: g, slot: s.GameSlot})
+
+			if s.Free == 0 {
+				delete(q.slots, s.ID)
+				break
+			}
+		}
+	}
+
+	return matches
+}
@@ -0,0 +1,122 @@
+package menus
+
+import (
+	"fmt"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Item describes an item independent of the Minecraft version. The backend
+// co-plugin builds the item stack for the viewer's protocol, NBT before 1.20.5
+// and data components after.
+type Item struct {
+	// Material is a namespaced item id, e.g. minecraft:compass.
+	Material string `json:"material"`
+	// Name and Lore use & color codes.
+	Name            string   `json:"name,omitempty"`
+	Lore            []string `json:"lore,omitempty"`
+	Amount          int      `json:"amount,omitempty"`
+	Glow            bool     `json:"glow,omitempty"`
+	SkullOwner      string   `json:"skullOwner,omitempty"`
+	CustomModelData int      `json:"customModelData,omitempty"`
+}
+
+type ClickType string
+
+const (
+	LeftClick   ClickType = "left"
+	RightClick  ClickType = "right"
+	ShiftClick  ClickType = "shift"
+	MiddleClick ClickType = "middle"
+)
+
+type Click struct {
+	Player proxy.Player
+	Slot   int
+	Type   ClickType
+	Menu   *Menu
+
+	menus *Menus
+}
+
+// Open replaces the clicked menu with another one.
+func (c Click) Open(menu *Menu) error {
+	return c.menus.Open(c.Player, menu)
+}
+
+func (c Click) Close() error {
+	return c.menus.Close(c.Player)
+}
+
+type Button struct {
+	Item    Item
+	OnClick func(Click)
+}
+
+// Menu is a chest inventory of 1 to 6 rows. Players can't move items in or
+// out of it, clicks only call the OnClick of the button in the slot.
+type Menu struct {
+	Title   string
+	Rows    int
+	Buttons map[int]Button
+	OnClose func(proxy.Player)
+}
+
+func NewMenu(title string, rows int) *Menu {
+	return &Menu{Title: title, Rows: min(max(rows, 1), 6), Buttons: make(map[int]Button)}
+}
+
+func (m *Menu) Set(slot int, button Button) *Menu {
+	if slot >= 0 && slot < m.Rows*9 {
+		m.Buttons[slot] = button
+	}
+
+	return m
+}
+
+var (
+	previousItem = Item{Material: "minecraft:arrow", Name: "&ePrevious page"}
+	nextItem     = Item{Material: "minecraft:arrow", Name: "&eNext page"}
+)
+
+// Paginate spreads buttons over as many menus as needed. The last row of
+// every page is kept free for the previous and next page buttons, extra
+// buttons in that row are set with the controls callback.
+func Paginate(title string, rows int, buttons []Button, controls func(page *Menu)) []*Menu {
+	rows = min(max(rows, 2), 6)
+	perPage := (rows - 1) * 9
+
+	count := max((len(buttons)+perPage-1)/perPage, 1)
+	pages := make([]*Menu, count)
+
+	for i := range pages {
+		pageTitle := title
+		if count > 1 {
+			pageTitle = fmt.Sprintf("%s (%d/%d)", title, i+1, count)
+		}
+
+		pages[i] = NewMenu(pageTitle, rows)
+
+		for slot, button := range buttons[i*perPage : min((i+1)*perPage, len(buttons))] {
+			pages[i].Set(slot, button)
+		}
+	}
+
+	for i, page := range pages {
+		if i > 0 {
+			previous := pages[i-1]
+			page.Set(perPage, Button{Item: previousItem, OnClick: func(c Click) { _ = c.Open(previous) }})
+		}
+
+		if i < count-1 {
+			next := pages[i+1]
+			page.Set(perPage+8, Button{Item: nextItem, OnClick: func(c Click) { _ = c.Open(next) }})
+		}
+
+		if controls != nil {
+			controls(page)
+		}
+	}
+
+	return pages
+}
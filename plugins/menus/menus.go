@@ -0,0 +1,196 @@
+// Package menus opens chest menus that are defined on the proxy. The menu is
+// sent to a co-plugin on the player's backend over the csmc:menu bridge
+// channel, which shows it and reports clicks back. Other plugins get the
+// shared Menus to build server selectors, punishment menus and the like.
+package menus
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+const Channel = "csmc:menu"
+
+var ErrNoServer = bridge.ErrNoServer
+
+// The data of the messages on the channel.
+type (
+	openMessage struct {
+		Type string `json:"type"`
+		ID   uint64 `json:"id"`
+		// Title uses & color codes.
+		Title string `json:"title"`
+		Rows  int    `json:"rows"`
+		// Protocol of the player, for backends that build items per
+		// version, e.g. behind ViaVersion.
+		Protocol int          `json:"protocol"`
+		Items    map[int]Item `json:"items"`
+	}
+
+	closeMessage struct {
+		Type string `json:"type"`
+		ID   uint64 `json:"id"`
+	}
+
+	// clientMessage is sent by the co-plugin, Type is click or close.
+	clientMessage struct {
+		Type  string    `json:"type"`
+		ID    uint64    `json:"id"`
+		Slot  int       `json:"slot"`
+		Click ClickType `json:"click"`
+	}
+)
+
+type session struct {
+	id   uint64
+	menu *Menu
+}
+
+// Menus tracks the open menu of every player.
+type Menus struct {
+	h        *hosting.Hosting
+	bridge   *bridge.Bridge
+	channel  *bridge.Channel
+	sessions map[uuid.UUID]session
+	next     atomic.Uint64
+	m        sync.Mutex
+}
+
+func NewMenus(h *hosting.Hosting, b *bridge.Bridge) *Menus {
+	return &Menus{h: h, bridge: b, sessions: make(map[uuid.UUID]session)}
+}
+
+func (m *Menus) send(player proxy.Player, v any) error {
+	if player.CurrentServer() == nil {
+		return ErrNoServer
+	}
+
+	return m.channel.Send(m.h.Context(), player.ID(), v)
+}
+
+// Open shows the menu to the player, replacing the one they have open.
+func (m *Menus) Open(player proxy.Player, menu *Menu) error {
+	id := m.next.Add(1)
+
+	items := make(map[int]Item, len(menu.Buttons))
+	for slot, button := range menu.Buttons {
+		items[slot] = button.Item
+	}
+
+	m.m.Lock()
+	m.sessions[player.ID()] = session{id: id, menu: menu}
+	m.m.Unlock()
+
+	return m.send(player, openMessage{Type: "open", ID: id, Title: menu.Title, Rows: menu.Rows, Protocol: player.Protocol(), Items: items})
+}
+
+func (m *Menus) Close(player proxy.Player) error {
+	m.m.Lock()
+	s, ok := m.sessions[player.ID()]
+	delete(m.sessions, player.ID())
+	m.m.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return m.send(player, closeMessage{Type: "close", ID: s.id})
+}
+
+// Current returns the menu the player has open.
+func (m *Menus) Current(player proxy.Player) (*Menu, bool) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	s, ok := m.sessions[player.ID()]
+
+	return s.menu, ok
+}
+
+// drop forgets the menu of the player without telling the backend, e.g.
+// because they left it.
+func (m *Menus) drop(player proxy.Player) (session, bool) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	s, ok := m.sessions[player.ID()]
+	delete(m.sessions, player.ID())
+
+	return s, ok
+}
+
+func (m *Menus) onMessage(bm bridge.Message) {
+	msg := clientMessage{}
+	if err := bm.Decode(&msg); err != nil {
+		log.Printf("Invalid menu message from %s: %v", bm.Server.ServerInfo().Name(), err)
+		return
+	}
+
+	player := bm.Player
+
+	m.m.Lock()
+	s, ok := m.sessions[player.ID()]
+	m.m.Unlock()
+
+	// Clicks of a menu that was replaced in the meantime
+	if !ok || s.id != msg.ID {
+		return
+	}
+
+	switch msg.Type {
+	case "click":
+		button, ok := s.menu.Buttons[msg.Slot]
+		if !ok || button.OnClick == nil {
+			return
+		}
+
+		// Handlers may connect the player or open other menus, which must
+		// not block the backend connection
+		go func() {
+			defer m.h.Recover("Menus")
+
+			button.OnClick(Click{Player: player, Slot: msg.Slot, Type: msg.Click, Menu: s.menu, menus: m})
+		}()
+
+	case "close":
+		if _, ok := m.drop(player); ok && s.menu.OnClose != nil {
+			go func() {
+				defer m.h.Recover("Menus")
+
+				s.menu.OnClose(player)
+			}()
+		}
+	}
+}
+
+func New(h *hosting.Hosting, menus *Menus) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Menus",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			channel, err := menus.bridge.Register(Channel, menus.onMessage)
+			if err != nil {
+				return err
+			}
+
+			menus.channel = channel
+
+			// Menus don't survive a server switch
+			event.Subscribe(prx.Event(), 0, hosting.Guard(h, "Menus", func(e *proxy.ServerConnectedEvent) {
+				menus.drop(e.Player())
+			}))
+			event.Subscribe(prx.Event(), 0, hosting.Guard(h, "Menus", func(e *proxy.DisconnectEvent) {
+				menus.drop(e.Player())
+			}))
+
+			return nil
+		},
+	}, nil
+}
@@ -2,6 +2,8 @@ package motd
 
 import (
 	"context"
+	"math/rand"
+	"time"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
@@ -27,7 +29,7 @@ func New(h *hosting.Hosting) (proxy.Plugin, error) {
 }
 
 func (p *Plugin) Init(prx *proxy.Proxy) error {
-	event.Subscribe(prx.Event(), 0, p.onPingEvent())
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "MOTD", p.onPingEvent()))
 
 	return nil
 }
@@ -35,6 +37,21 @@ func (p *Plugin) Init(prx *proxy.Proxy) error {
 func (p *Plugin) onPingEvent() func(e *proxy.PingEvent) {
 	return func(e *proxy.PingEvent) {
 		ping := e.Ping()
+		ping.Players.Max = ping.Players.Online + 1
+
+		// An icon not cached yet is loaded from the object store, a slow
+		// store leaves Gate's favicon
+		ctx, cancel := context.WithTimeout(p.h.Context(), time.Second)
+		if icon, ok := p.h.Favicon(ctx, e.Connection()); ok {
+			ping.Favicon = icon
+		}
+		cancel()
+
+		if theme, ok := p.h.Themes().Current(); ok && len(theme.MOTDs) > 0 {
+			ping.Description = &Text{Extra: []Component{util.Text(theme.MOTDs[rand.Intn(len(theme.MOTDs))])}}
+			return
+		}
+
 		ping.Description = &Text{
 			Extra: []Component{
 				&Text{Content: "  ᴄѕᴍᴄ ", S: Style{Color: color.Green, Bold: True}},
@@ -44,6 +61,5 @@ func (p *Plugin) onPingEvent() func(e *proxy.PingEvent) {
 				&Text{Content: util.Latinize(p.h.Info.PodName), S: Style{Color: color.LightPurple, Bold: True}},
 			},
 		}
-		ping.Players.Max = ping.Players.Online + 1
 	}
 }
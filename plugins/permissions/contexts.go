@@ -0,0 +1,215 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// The contexts the proxy resolves for players. Nodes may name others, like
+// world, those are left to the backends and never apply on the proxy.
+const (
+	ContextServer = "server"
+	ContextGroup  = "group"
+)
+
+// Contexts are where a permission is checked, e.g. server=build.
+type Contexts map[string]string
+
+func (c Contexts) String() string {
+	if len(c) == 0 {
+		return "global"
+	}
+
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + c[k]
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// ParseContexts parses "server=build group=creative", commas work as well.
+func ParseContexts(raw string) (Contexts, error) {
+	c := make(Contexts)
+	for _, pair := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' }) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("context %q is not key=value", pair)
+		}
+
+		c[strings.ToLower(k)] = v
+	}
+
+	return c, nil
+}
+
+// Node is a granted permission, optionally limited to contexts. Stored as
+// "server=build,server=test,group=creative:worldedit.use", it applies where
+// the server is build or test and the group is creative.
+type Node struct {
+	Permission string
+	Contexts   map[string][]string
+}
+
+func ParseNode(raw string) Node {
+	n := Node{Permission: strings.TrimSpace(raw)}
+
+	before, after, ok := strings.Cut(raw, ":")
+	if !ok || !strings.Contains(before, "=") {
+		return n
+	}
+
+	n.Permission = strings.TrimSpace(after)
+	n.Contexts = make(map[string][]string)
+	for _, pair := range strings.Split(before, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		n.Contexts[k] = append(n.Contexts[k], strings.TrimSpace(v))
+	}
+
+	return n
+}
+
+// Grants reports whether the node grants the permission, ignoring its
+// contexts. "a.*" grants a and everything below it.
+func (n Node) Grants(permission string) bool {
+	if n.Permission == permission {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(n.Permission, ".*")
+	return ok && !strings.Contains(prefix, ".") && strings.HasPrefix(permission+".", prefix+".")
+}
+
+// Applies returns "" if the node applies in the contexts, or why it doesn't.
+func (n Node) Applies(c Contexts) string {
+	keys := make([]string, 0, len(n.Contexts))
+	for k := range n.Contexts {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		v, ok := c[k]
+		if !ok {
+			return fmt.Sprintf("needs %s=%s, which isn't known here", k, strings.Join(n.Contexts[k], "|"))
+		}
+
+		if !slices.Contains(n.Contexts[k], v) {
+			return fmt.Sprintf("needs %s=%s, not %s", k, strings.Join(n.Contexts[k], "|"), v)
+		}
+	}
+
+	return ""
+}
+
+// Considered is a node that grants the permission of a check, with where it
+// came from and why it didn't apply if it didn't.
+type Considered struct {
+	Node string `json:"node"`
+	// Source is "user" or "group <name>"
+	Source string `json:"source"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type CheckResult struct {
+	Permission string       `json:"permission"`
+	Contexts   Contexts     `json:"contexts"`
+	Allowed    bool         `json:"allowed"`
+	Considered []Considered `json:"considered"`
+}
+
+// Check explains whether the player, by undashed UUID, has the permission in
+// the contexts. Nodes without contexts apply everywhere, nodes and groups
+// that ran out nowhere, even before the sweep removed them.
+func (p *Permissions) Check(player, permission string, c Contexts) CheckResult {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	r := CheckResult{Permission: permission, Contexts: c, Considered: make([]Considered, 0)}
+	now := time.Now()
+
+	// expired is why the node doesn't count no matter the contexts, if it
+	// or its group ran out
+	consider := func(source string, raw string, expired string) {
+		n := ParseNode(raw)
+		if !n.Grants(permission) {
+			return
+		}
+
+		reason := expired
+		if reason == "" {
+			reason = n.Applies(c)
+		}
+		r.Considered = append(r.Considered, Considered{Node: raw, Source: source, Reason: reason})
+		r.Allowed = r.Allowed || reason == ""
+	}
+
+	user, ok := p.Users[player]
+	if !ok {
+		return r
+	}
+
+	for _, raw := range user.Permissions {
+		consider("user", raw, expiredReason(user.PermissionExpiry[raw], now))
+	}
+	for _, name := range user.Groups {
+		group, exists := p.Groups[name]
+		if !exists {
+			log.Printf("WARN: Group %s does not exist", name)
+			continue
+		}
+
+		expired := expiredReason(user.GroupExpiry[name], now)
+		if expired != "" {
+			expired = "group " + expired
+		}
+
+		for _, raw := range group.Permissions {
+			consider("group "+name, raw, expired)
+		}
+	}
+
+	return r
+}
+
+// PlayerContexts resolves the contexts of the player on this proxy.
+func (p *Permissions) PlayerContexts(ctx context.Context, player proxy.Player) Contexts {
+	c := make(Contexts)
+
+	current := player.CurrentServer()
+	if current == nil {
+		return c
+	}
+
+	c[ContextServer] = current.Server().ServerInfo().Name()
+
+	p.m.RLock()
+	mgr := p.mgr
+	p.m.RUnlock()
+
+	if mgr == nil {
+		return c
+	}
+
+	group, err := mgr.Gamemode(ctx, current.Server())
+	if err != nil {
+		log.Printf("Failed to get the gamemode of %s: %v", c[ContextServer], err)
+	} else if group != "" {
+		c[ContextGroup] = group
+	}
+
+	return c
+}
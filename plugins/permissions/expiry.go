@@ -0,0 +1,273 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"go.minekube.com/common/minecraft/color"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
+)
+
+const (
+	KindGroup      = "group"
+	KindPermission = "permission"
+)
+
+// Temporary is a group membership or node of a player that runs out.
+type Temporary struct {
+	Player string `json:"player"`
+	// Kind is KindGroup or KindPermission
+	Kind  string    `json:"kind"`
+	Name  string    `json:"name"`
+	Until time.Time `json:"until"`
+}
+
+func (t Temporary) String() string {
+	if t.Kind == KindGroup {
+		return "rank " + t.Name
+	}
+
+	return "permission " + t.Name
+}
+
+// extend sets when the entry of a player runs out, keeping it only ever
+// longer: permanent entries stay permanent and the later time wins. It
+// reports whether anything changed.
+func extend(expiry map[string]time.Time, key string, member bool, until time.Time) (map[string]time.Time, bool) {
+	current, temporary := expiry[key]
+	if member && (!temporary || !until.IsZero() && !until.After(current)) {
+		return expiry, false
+	}
+
+	if until.IsZero() {
+		delete(expiry, key)
+		return expiry, true
+	}
+
+	if expiry == nil {
+		expiry = make(map[string]time.Time)
+	}
+	expiry[key] = until
+
+	return expiry, true
+}
+
+// expiredReason is why a node counts no longer, or "" while it does.
+func expiredReason(until time.Time, now time.Time) string {
+	if until.IsZero() || now.Before(until) {
+		return ""
+	}
+
+	return "expired " + until.Format(time.DateTime)
+}
+
+// ParseDuration is time.ParseDuration that also takes days, e.g. 30d.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return d, nil
+}
+
+// formatRemaining rounds to the two largest units, e.g. 29d 23h or 5m.
+func formatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return "less than a minute"
+	}
+
+	days, hours, minutes := int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// Temporaries returns the groups and nodes of the player that run out,
+// soonest first.
+func (p *Permissions) Temporaries(player string) []Temporary {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return temporaries(player, p.Users[player])
+}
+
+func temporaries(player string, user PermissionUser) []Temporary {
+	list := make([]Temporary, 0, len(user.GroupExpiry)+len(user.PermissionExpiry))
+	for name, until := range user.GroupExpiry {
+		list = append(list, Temporary{Player: player, Kind: KindGroup, Name: name, Until: until})
+	}
+	for name, until := range user.PermissionExpiry {
+		list = append(list, Temporary{Player: player, Kind: KindPermission, Name: name, Until: until})
+	}
+
+	slices.SortFunc(list, func(a, b Temporary) int {
+		return a.Until.Compare(b.Until)
+	})
+
+	return list
+}
+
+// Expire removes the groups and nodes that ran out by now from every player
+// and returns them.
+func (p *Permissions) Expire(ctx context.Context, now time.Time) ([]Temporary, error) {
+	p.m.Lock()
+
+	var expired []Temporary
+	for id, user := range p.Users {
+		changed := false
+		for _, t := range temporaries(id, user) {
+			if now.Before(t.Until) {
+				continue
+			}
+
+			if t.Kind == KindGroup {
+				user.Groups = slices.DeleteFunc(user.Groups, func(s string) bool { return s == t.Name })
+				delete(user.GroupExpiry, t.Name)
+			} else {
+				user.Permissions = slices.DeleteFunc(user.Permissions, func(s string) bool { return s == t.Name })
+				delete(user.PermissionExpiry, t.Name)
+			}
+
+			expired = append(expired, t)
+			changed = true
+		}
+
+		if changed {
+			p.Users[id] = user
+		}
+	}
+
+	p.m.Unlock()
+
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	return expired, p.saveUsers(ctx)
+}
+
+// sweepExpired removes what ran out on the leader, so a save happens once
+// for the network.
+func (p *PermissionsPlugin) sweepExpired(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			p.warnExpiring(now)
+
+			instances, err := p.permissions.h.Cluster().Instances(ctx, now)
+			if err != nil {
+				log.Printf("Failed to list the cluster for permission expiry: %v", err)
+				continue
+			}
+
+			if cluster.Leader(instances) != p.permissions.h.Info.PodName {
+				continue
+			}
+
+			expired, err := p.permissions.Expire(ctx, now)
+			if err != nil {
+				log.Printf("Failed to expire permissions: %v", err)
+				continue
+			}
+
+			for _, e := range expired {
+				log.Printf("The %s of %s expired", e, e.Player)
+
+				if err := p.permissions.h.Audit().Record(ctx, audit.Entry{
+					Actor:   "scheduler",
+					Action:  "permissions.expire",
+					Target:  e.Player,
+					Details: map[string]string{"kind": e.Kind, "name": e.Name, "until": e.Until.Format(time.RFC3339)},
+				}); err != nil {
+					log.Printf("Failed to record permission expiry: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// warnExpiring tells our players once per connection that a rank or node
+// runs out within the warning window, and again once it did.
+func (p *PermissionsPlugin) warnExpiring(now time.Time) {
+	for _, player := range p.prx.Players() {
+		id := player.ID()
+		for _, t := range p.permissions.Temporaries(id.Undashed()) {
+			if t.Until.Sub(now) > p.warning {
+				break
+			}
+
+			expired := !now.Before(t.Until)
+			key := t.Kind + " " + t.Name + " " + strconv.FormatBool(expired)
+			if !p.markWarned(id, key) {
+				continue
+			}
+
+			msg := fmt.Sprintf("Your %s expires in %s.", t, formatRemaining(t.Until.Sub(now)))
+			if expired {
+				msg = fmt.Sprintf("Your %s has expired.", t)
+			}
+
+			if err := player.SendMessage(&component.Text{
+				Extra: []component.Component{
+					&component.Text{Content: "ᴘᴇʀᴍѕ ", S: component.Style{Color: color.Green, Bold: component.True}},
+					&component.Text{Content: msg, S: component.Style{Color: color.Yellow}},
+				},
+			}); err != nil {
+				log.Printf("Failed to warn %s about their %s: %v", player.Username(), t, err)
+			}
+		}
+	}
+}
+
+// markWarned reports whether the player wasn't warned about key yet.
+func (p *PermissionsPlugin) markWarned(player guuid.UUID, key string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.warned[player] == nil {
+		p.warned[player] = make(map[string]bool)
+	}
+
+	if p.warned[player][key] {
+		return false
+	}
+
+	p.warned[player][key] = true
+
+	return true
+}
+
+func (p *PermissionsPlugin) onDisconnect(e *proxy.DisconnectEvent) {
+	p.m.Lock()
+	delete(p.warned, e.Player().ID())
+	p.m.Unlock()
+}
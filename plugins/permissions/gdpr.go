@@ -0,0 +1,33 @@
+package permissions
+
+import (
+	"context"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+)
+
+func (p *Permissions) exportUser(ctx context.Context, player string) (any, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	user, ok := p.Users[player]
+	if !ok {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+// eraseUser drops the groups and permissions granted to the player.
+func (p *Permissions) eraseUser(ctx context.Context, player string) (gdpr.Erasure, error) {
+	p.m.Lock()
+	_, ok := p.Users[player]
+	delete(p.Users, player)
+	p.m.Unlock()
+
+	if !ok {
+		return gdpr.Erasure{}, nil
+	}
+
+	return gdpr.Erasure{Erased: 1}, p.saveUsers(ctx)
+}
@@ -3,21 +3,27 @@ package permissions
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"log"
 	"slices"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
 )
 
 type PermissionUser struct {
 	Groups      []string `json:"groups"`
 	Permissions []string `json:"permissions"`
+	// GroupExpiry and PermissionExpiry are when temporary groups and nodes
+	// run out, permanent ones have no entry
+	GroupExpiry      map[string]time.Time `json:"groupExpiry,omitempty"`
+	PermissionExpiry map[string]time.Time `json:"permissionExpiry,omitempty"`
 }
 
 type PermissionGroup struct {
@@ -32,10 +38,17 @@ type Permissions struct {
 	m      sync.RWMutex
 	h      *hosting.Hosting
 	kv     kv.Bucket
+	// mgr resolves the group context of players, set once the proxy runs
+	mgr *hosting.InstanceManager
+	// saved are the groups of every user as last loaded or saved, to tell
+	// what a save changed
+	saved map[string][]string
 }
 
+// NewKVPermissions loads the permissions bucket and keeps it in sync until the
+// Permissions plugin is disabled.
 func NewKVPermissions(ctx context.Context, h *hosting.Hosting) (*Permissions, error) {
-	kv, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_permissions")
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_permissions")
 	if err != nil {
 		return nil, err
 	}
@@ -44,82 +57,97 @@ func NewKVPermissions(ctx context.Context, h *hosting.Hosting) (*Permissions, er
 		Users:  make(map[string]PermissionUser),
 		Groups: make(map[string]PermissionGroup),
 		h:      h,
-		kv:     kv,
+		kv:     bucket,
 	}
 
-	watcher, err := kv.WatchAll(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	go func() {
-		for key := range watcher.Changes() {
-			if key == nil {
-				continue
-			}
-
-			switch key.Key {
-			case "users":
-				log.Printf("Users key changed: %s", key.Value)
+	h.Go("Permissions", func(ctx context.Context) {
+		kv.Watch(ctx, w.kv, w.handleChange, w.Reload)
+	})
+	h.Warmup("permissions", hosting.WarmupFailOpen, w.Reload)
+	h.GDPR().Register("permissions", gdpr.Subsystem{Export: w.exportUser, Erase: w.eraseUser})
 
-				w.m.Lock()
+	return w, nil
+}
 
-				if err := json.Unmarshal(key.Value, &w.Users); err != nil {
-					w.m.Unlock()
-					log.Printf("Failed to unmarshal users key: %v", err)
-				}
+func (w *Permissions) handleChange(key *kv.Value) {
+	if key == nil {
+		return
+	}
 
-				w.m.Unlock()
+	w.m.Lock()
+	defer w.m.Unlock()
 
-			case "groups":
-				log.Printf("Groups key changed: %s", key.Value)
+	switch key.Key {
+	case "users":
+		log.Printf("Users key changed: %s", key.Value)
 
-				w.m.Lock()
+		if err := json.Unmarshal(key.Value, &w.Users); err != nil {
+			log.Printf("Failed to unmarshal users key: %v", err)
+		}
+		w.saved = snapshotGroups(w.Users)
 
-				if err := json.Unmarshal(key.Value, &w.Groups); err != nil {
-					w.m.Unlock()
-					log.Printf("Failed to unmarshal groups key: %v", err)
-				}
+	case "groups":
+		log.Printf("Groups key changed: %s", key.Value)
 
-				w.m.Unlock()
-			}
+		if err := json.Unmarshal(key.Value, &w.Groups); err != nil {
+			log.Printf("Failed to unmarshal groups key: %v", err)
 		}
-	}()
-
-	return w, nil
+	}
 }
 
 func (w *Permissions) Reload(ctx context.Context) error {
 	w.m.Lock()
 	defer w.m.Unlock()
 
-	if err := hosting.GetKeyFromKV(ctx, w.kv, "users", &w.Users); errors.Is(errors.Unwrap(err), kv.ErrKeyNotFound) {
-		w.Users = make(map[string]PermissionUser)
-	} else if err != nil {
+	users, err := w.users().Get(ctx)
+	if err != nil {
 		return err
 	}
 
-	if err := hosting.GetKeyFromKV(ctx, w.kv, "groups", &w.Groups); errors.Is(errors.Unwrap(err), kv.ErrKeyNotFound) {
-		w.Groups = make(map[string]PermissionGroup)
-	} else if err != nil {
+	groups, err := w.groups().Get(ctx)
+	if err != nil {
 		return err
 	}
 
+	w.Users, w.Groups = users, groups
+	w.saved = snapshotGroups(users)
+
 	return nil
 }
 
+// saveUsers stores the users and publishes the groups that changed since
+// they were last loaded or saved.
 func (w *Permissions) saveUsers(ctx context.Context) error {
 	w.m.Lock()
-	defer w.m.Unlock()
+	if err := w.users().Set(ctx, w.Users); err != nil {
+		w.m.Unlock()
+		return err
+	}
+	changes := w.groupChanges()
+	w.m.Unlock()
 
-	return hosting.SetKeyToKV(ctx, w.kv, "users", w.Users)
+	w.publishChanges(ctx, changes)
+
+	return nil
+}
+
+func (w *Permissions) users() *kv.TypedKey[map[string]PermissionUser] {
+	return kv.Typed[map[string]PermissionUser](w.kv, "users").Default(func() map[string]PermissionUser {
+		return make(map[string]PermissionUser)
+	})
+}
+
+func (w *Permissions) groups() *kv.TypedKey[map[string]PermissionGroup] {
+	return kv.Typed[map[string]PermissionGroup](w.kv, "groups").Default(func() map[string]PermissionGroup {
+		return make(map[string]PermissionGroup)
+	})
 }
 
 func (w *Permissions) saveGroups(ctx context.Context) error {
 	w.m.Lock()
 	defer w.m.Unlock()
 
-	return hosting.SetKeyToKV(ctx, w.kv, "groups", w.Groups)
+	return w.groups().Set(ctx, w.Groups)
 }
 
 func (p *Permissions) GroupNames() []string {
@@ -153,6 +181,8 @@ func (p *Permissions) UserGroups(name string) ([]string, bool) {
 	return user.Groups, true
 }
 
+// GroupHasPermission reports whether the group grants the permission
+// everywhere, nodes limited to contexts don't count.
 func (p *Permissions) GroupHasPermission(name string, permission string) bool {
 	group, exists := p.GetGroup(name)
 	if !exists {
@@ -160,12 +190,8 @@ func (p *Permissions) GroupHasPermission(name string, permission string) bool {
 		return false
 	}
 
-	for _, _permission := range group.Permissions {
-		if _permission == permission {
-			return true
-		}
-
-		if strings.Split(_permission, ".")[0] == strings.Split(permission, ".")[0] && strings.Split(_permission, ".")[1] == "*" {
+	for _, raw := range group.Permissions {
+		if n := ParseNode(raw); n.Grants(permission) && n.Applies(nil) == "" {
 			return true
 		}
 	}
@@ -173,39 +199,55 @@ func (p *Permissions) GroupHasPermission(name string, permission string) bool {
 	return false
 }
 
-func (p *Permissions) UserHasPermission(player string, permission string) bool {
-	player = uuid.Normalize(player)
-
-	user, ok := p.Users[player]
+// SourceHasPermission checks players against their permissions in the
+// contexts they are in. Any other command source, like the console, has
+// every permission.
+func (p *Permissions) SourceHasPermission(src command.Source, permission string) bool {
+	player, ok := src.(proxy.Player)
 	if !ok {
-		log.Printf("DBG: User %s does not exist", player)
-		return false
+		return true
 	}
 
-	for _, userPermission := range user.Permissions {
-		if userPermission == permission {
-			return true
-		}
+	return p.UserHasPermissionIn(player.ID().String(), permission, p.PlayerContexts(p.h.Context(), player))
+}
 
-		if strings.Split(userPermission, ".")[0] == strings.Split(permission, ".")[0] && strings.Split(userPermission, ".")[1] == "*" {
-			return true
-		}
-	}
+// UserHasPermission checks the permissions of the player that apply
+// everywhere.
+func (p *Permissions) UserHasPermission(player string, permission string) bool {
+	return p.UserHasPermissionIn(player, permission, nil)
+}
 
-	for _, userGroup := range user.Groups {
-		if p.GroupHasPermission(userGroup, permission) {
-			return true
-		}
-	}
+func (p *Permissions) UserHasPermissionIn(player string, permission string, c Contexts) bool {
+	player = uuid.Normalize(player)
 
-	return false
+	has := p.Check(player, permission, c).Allowed
+	p.h.Tracef(player, "permissions: %s in %s %t", permission, c, has)
+
+	return has
 }
 
 func (p *Permissions) UserAddPermission(ctx context.Context, UUID string, permission string) error {
+	return p.UserAddPermissionUntil(ctx, UUID, permission, time.Time{})
+}
+
+// UserAddPermissionUntil grants the node until the time, or for good if it is
+// zero. Granting a node the player already has only ever extends it.
+func (p *Permissions) UserAddPermissionUntil(ctx context.Context, UUID string, permission string, until time.Time) error {
 	p.m.Lock()
 	UUID = uuid.Normalize(UUID)
 	user := p.Users[UUID]
-	user.Permissions = append(user.Permissions, permission)
+	member := slices.Contains(user.Permissions, permission)
+
+	expiry, changed := extend(user.PermissionExpiry, permission, member, until)
+	if !changed {
+		p.m.Unlock()
+		return nil
+	}
+
+	if !member {
+		user.Permissions = append(user.Permissions, permission)
+	}
+	user.PermissionExpiry = expiry
 	p.Users[UUID] = user
 	p.m.Unlock()
 
@@ -230,6 +272,7 @@ func (p *Permissions) UserRemovePermission(ctx context.Context, UUID string, per
 	user.Permissions = slices.DeleteFunc(user.Permissions, func(s string) bool {
 		return s == permission
 	})
+	delete(user.PermissionExpiry, permission)
 
 	p.Users[UUID] = user
 	p.m.Unlock()
@@ -250,3 +293,55 @@ func (p *Permissions) GroupRemovePermission(ctx context.Context, name string, pe
 
 	return p.saveGroups(ctx)
 }
+
+// UserAddGroup makes the player a member of the group for good, it returns
+// false if they already were.
+func (p *Permissions) UserAddGroup(ctx context.Context, UUID string, group string) (bool, error) {
+	return p.UserAddGroupUntil(ctx, UUID, group, time.Time{})
+}
+
+// UserAddGroupUntil makes the player a member of the group until the time, or
+// for good if it is zero. Memberships are only ever extended, it returns
+// false if the player stays a member as long as before.
+func (p *Permissions) UserAddGroupUntil(ctx context.Context, UUID string, group string, until time.Time) (bool, error) {
+	p.m.Lock()
+	UUID = uuid.Normalize(UUID)
+	user := p.Users[UUID]
+	member := slices.Contains(user.Groups, group)
+
+	expiry, changed := extend(user.GroupExpiry, group, member, until)
+	if !changed {
+		p.m.Unlock()
+		return false, nil
+	}
+
+	if !member {
+		user.Groups = append(user.Groups, group)
+	}
+	user.GroupExpiry = expiry
+	p.Users[UUID] = user
+	p.m.Unlock()
+
+	return true, p.saveUsers(ctx)
+}
+
+// UserRemoveGroup takes the player out of the group, it returns false if
+// they weren't a member.
+func (p *Permissions) UserRemoveGroup(ctx context.Context, UUID string, group string) (bool, error) {
+	p.m.Lock()
+	UUID = uuid.Normalize(UUID)
+	user := p.Users[UUID]
+	if !slices.Contains(user.Groups, group) {
+		p.m.Unlock()
+		return false, nil
+	}
+
+	user.Groups = slices.DeleteFunc(user.Groups, func(s string) bool {
+		return s == group
+	})
+	delete(user.GroupExpiry, group)
+	p.Users[UUID] = user
+	p.m.Unlock()
+
+	return true, p.saveUsers(ctx)
+}
@@ -0,0 +1,201 @@
+package permissions
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+)
+
+// luckPermsExport mirrors the JSON written by `/lp export <file>`.
+// Tracks and metadata are not used by the proxy.
+type luckPermsExport struct {
+	Groups map[string]luckPermsHolder `json:"groups"`
+	Users  map[string]luckPermsHolder `json:"users"`
+}
+
+type luckPermsHolder struct {
+	Username     string          `json:"username"`
+	PrimaryGroup string          `json:"primaryGroup"`
+	Nodes        []luckPermsNode `json:"nodes"`
+}
+
+type luckPermsNode struct {
+	Type    string         `json:"type"`
+	Key     string         `json:"key"`
+	Value   bool           `json:"value"`
+	Expiry  int64          `json:"expiry"`
+	Context map[string]any `json:"context"`
+}
+
+// key is the node as stored by the proxy, with its contexts in front. A
+// context is either a value or a list of them.
+func (n luckPermsNode) key() string {
+	if len(n.Context) == 0 {
+		return n.Key
+	}
+
+	keys := make([]string, 0, len(n.Context))
+	for k := range n.Context {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		switch v := n.Context[k].(type) {
+		case string:
+			pairs = append(pairs, k+"="+v)
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					pairs = append(pairs, k+"="+s)
+				}
+			}
+		}
+	}
+
+	return strings.Join(pairs, ",") + ":" + n.Key
+}
+
+type ImportResult struct {
+	Groups  int `json:"groups"`
+	Users   int `json:"users"`
+	Nodes   int `json:"nodes"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportLuckPerms merges a LuckPerms JSON export (optionally gzipped) into the
+// permissions. Negated nodes have no equivalent yet and are skipped, contexts
+// are kept on permission nodes and expiry on the nodes of users.
+func (p *Permissions) ImportLuckPerms(ctx context.Context, r io.Reader) (*ImportResult, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		r = gz
+	} else {
+		r = br
+	}
+
+	export := luckPermsExport{}
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{}
+
+	p.m.Lock()
+
+	now := time.Now()
+	for name, holder := range export.Groups {
+		group := p.Groups[name]
+
+		// Only the nodes of users can run out
+		for _, node := range holder.Nodes {
+			if !node.Value || (len(node.Context) > 0 && node.Type != "permission") || node.Expiry > 0 {
+				res.Skipped++
+				continue
+			}
+
+			switch node.Type {
+			case "permission":
+				if key := node.key(); !slices.Contains(group.Permissions, key) {
+					group.Permissions = append(group.Permissions, key)
+				}
+			case "prefix":
+				// prefix.<priority>.<value>
+				if parts := strings.SplitN(node.Key, ".", 3); len(parts) == 3 {
+					group.Prefix = parts[2]
+				}
+			case "weight":
+				if w, err := strconv.Atoi(strings.TrimPrefix(node.Key, "weight.")); err == nil {
+					group.Weight = uint8(min(max(w, 0), math.MaxUint8))
+				}
+			default:
+				res.Skipped++
+				continue
+			}
+
+			res.Nodes++
+		}
+
+		p.Groups[name] = group
+		res.Groups++
+	}
+
+	for id, holder := range export.Users {
+		id = uuid.Normalize(id)
+		user := p.Users[id]
+
+		if holder.PrimaryGroup != "" && holder.PrimaryGroup != "default" && !slices.Contains(user.Groups, holder.PrimaryGroup) {
+			user.Groups = append(user.Groups, holder.PrimaryGroup)
+		}
+
+		for _, node := range holder.Nodes {
+			until := time.Time{}
+			if node.Expiry > 0 {
+				until = time.Unix(node.Expiry, 0)
+			}
+
+			if !node.Value || (len(node.Context) > 0 && node.Type != "permission") || expiredReason(until, now) != "" {
+				res.Skipped++
+				continue
+			}
+
+			switch node.Type {
+			case "permission":
+				key := node.key()
+				member := slices.Contains(user.Permissions, key)
+				if user.PermissionExpiry, _ = extend(user.PermissionExpiry, key, member, until); !member {
+					user.Permissions = append(user.Permissions, key)
+				}
+			case "inheritance":
+				group := strings.TrimPrefix(node.Key, "group.")
+				if group == "default" {
+					break
+				}
+
+				member := slices.Contains(user.Groups, group)
+				if user.GroupExpiry, _ = extend(user.GroupExpiry, group, member, until); !member {
+					user.Groups = append(user.Groups, group)
+				}
+			default:
+				res.Skipped++
+				continue
+			}
+
+			res.Nodes++
+		}
+
+		p.Users[id] = user
+		res.Users++
+	}
+
+	p.m.Unlock()
+
+	log.Printf("Imported %d groups, %d users and %d nodes from LuckPerms (%d skipped)", res.Groups, res.Users, res.Nodes, res.Skipped)
+
+	if err := p.saveGroups(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.saveUsers(ctx); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
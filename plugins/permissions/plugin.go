@@ -4,24 +4,42 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	"github.com/robinbraemer/event"
 	"go.minekube.com/brigodier"
 	"go.minekube.com/common/minecraft/color"
 	"go.minekube.com/common/minecraft/component"
 	"go.minekube.com/gate/pkg/command"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
 )
 
 type PermissionsPlugin struct {
 	prx         *proxy.Proxy
 	permissions *Permissions
+	bridge      *bridge.Bridge
+	channel     *bridge.Channel
+
+	// warning is how long before a rank or node runs out players are told
+	warning time.Duration
+	warned  map[guuid.UUID]map[string]bool
+	m       sync.Mutex
 }
 
-func NewPlugin(prx *proxy.Proxy, permissions *Permissions) (*PermissionsPlugin, error) {
+func NewPlugin(prx *proxy.Proxy, permissions *Permissions, b *bridge.Bridge) (*PermissionsPlugin, error) {
 	return &PermissionsPlugin{
 		prx:         prx,
 		permissions: permissions,
+		bridge:      b,
+		warning:     util.EnvDurationWithDefault("PERMISSIONS_EXPIRY_WARNING", 72*time.Hour),
+		warned:      make(map[guuid.UUID]map[string]bool),
 	}, nil
 }
 
@@ -30,7 +48,36 @@ func (p *PermissionsPlugin) Init() error {
 		return err
 	}
 
-	p.prx.Command().Register(p.command())
+	// Resolves the group context, without it nodes limited to groups never
+	// apply
+	mgr, err := p.permissions.h.InstanceManager(context.Background(), p.prx)
+	if err != nil {
+		return err
+	}
+	p.permissions.m.Lock()
+	p.permissions.mgr = mgr
+	p.permissions.m.Unlock()
+
+	channel, err := p.bridge.Register(Channel, p.onMessage)
+	if err != nil {
+		return err
+	}
+	p.channel = channel
+
+	if err := p.permissions.h.Messaging().Subscribe(p.permissions.h.Info.PermissionsSubject(), p.onGroupChange); err != nil {
+		return err
+	}
+
+	p.permissions.h.API().HandleFunc("GET /permissions/players/{player}", p.handleGetPlayer)
+
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.permissions.h, "Permissions", p.onDisconnect))
+	p.permissions.h.Go("Permissions", func(ctx context.Context) {
+		p.sweepExpired(ctx, util.EnvDurationWithDefault("PERMISSIONS_EXPIRY_INTERVAL", time.Minute))
+	})
+
+	p.prx.Command().Register(p.command("permissions"))
+	p.prx.Command().Register(p.command("perm"))
+	p.permissions.h.OnReload("Permissions", p.permissions.Reload)
 
 	return nil
 }
@@ -43,11 +90,11 @@ func (p *PermissionsPlugin) Reload() error {
 	return nil
 }
 
-func New(permissions *Permissions) (proxy.Plugin, error) {
+func New(permissions *Permissions, b *bridge.Bridge) (proxy.Plugin, error) {
 	return proxy.Plugin{
 		Name: "Permissions",
 		Init: func(ctx context.Context, prx *proxy.Proxy) error {
-			plugin, err := NewPlugin(prx, permissions)
+			plugin, err := NewPlugin(prx, permissions, b)
 			if err != nil {
 				return err
 			}
@@ -57,8 +104,8 @@ func New(permissions *Permissions) (proxy.Plugin, error) {
 	}, nil
 }
 
-func (p *PermissionsPlugin) command() brigodier.LiteralNodeBuilder {
-	return brigodier.Literal("permissions").
+func (p *PermissionsPlugin) command(name string) brigodier.LiteralNodeBuilder {
+	return brigodier.Literal(name).
 		Then(brigodier.
 			Literal("user").
 			Then(brigodier.
@@ -73,7 +120,12 @@ func (p *PermissionsPlugin) command() brigodier.LiteralNodeBuilder {
 				Then(brigodier.Literal("info").
 					Executes(p.InfoCommand(PermissionTypeUser))).
 				Then(brigodier.Literal("remove").Then(brigodier.Argument("permission", brigodier.String).Executes(p.removeCommand(PermissionTypeUser)))).
-				Then(brigodier.Literal("add").Then(brigodier.Argument("permission", brigodier.String).Executes(p.addCommand(PermissionTypeUser)))),
+				Then(brigodier.Literal("add").Then(brigodier.Argument("permission", brigodier.String).Executes(p.addCommand(PermissionTypeUser)).
+					Then(brigodier.Argument("duration", brigodier.StringWord).Executes(p.addCommand(PermissionTypeUser))))).
+				Then(brigodier.Literal("group").
+					Then(brigodier.Literal("add").Then(brigodier.Argument("group", brigodier.String).Executes(p.groupCommand(true)).
+						Then(brigodier.Argument("duration", brigodier.StringWord).Executes(p.groupCommand(true))))).
+					Then(brigodier.Literal("remove").Then(brigodier.Argument("group", brigodier.String).Executes(p.groupCommand(false))))),
 			),
 		).
 		Then(brigodier.
@@ -88,6 +140,14 @@ func (p *PermissionsPlugin) command() brigodier.LiteralNodeBuilder {
 				Then(brigodier.Literal("add").Then(brigodier.Argument("permission", brigodier.String).Executes(p.addCommand(PermissionTypeGroup)))),
 			).
 			Executes(p.helpCommand())).
+		Then(brigodier.
+			Literal("check").
+			Then(brigodier.
+				Argument("name", brigodier.String).
+				Then(brigodier.Argument("permission", brigodier.String).
+					Executes(p.checkCommand()).
+					Then(brigodier.Argument("contexts", brigodier.StringPhrase).Executes(p.checkCommand()))),
+			)).
 		Then(brigodier.
 			Literal("reload").
 			Executes(p.reloadCommand())).
@@ -103,14 +163,14 @@ const (
 
 func (p *PermissionsPlugin) InfoCommand(_type PermissionListType) brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "permissions.info") {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.info") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
 		name := c.String("name")
 
 		switch _type {
 		case PermissionTypeUser:
-			UUID, err := uuid.UsernameToUUID(name)
+			UUID, err := p.permissions.h.Profiles().ID(c.Context, name)
 			if err != nil {
 				return c.SendMessage(&component.Text{
 					Content: "Error while connecting to Mojang Servers! (maybe they are off)",
@@ -128,11 +188,17 @@ func (p *PermissionsPlugin) InfoCommand(_type PermissionListType) brigodier.Comm
 				&component.Text{Content: " " + name + " doesn't have any permissions set.", S: component.Style{Color: color.White}},
 			}
 
+			expiry := make(map[string]time.Time)
+			for _, t := range p.permissions.Temporaries(UUID) {
+				expiry[t.Kind+" "+t.Name] = t.Until
+			}
+
 			groups, ok := p.permissions.UserGroups(UUID)
 
 			if ok {
 				for _, group := range groups {
-					groupsMsg = append(groupsMsg, &component.Text{Content: "\n > ", S: component.Style{Color: color.Yellow}}, &component.Text{Content: group, S: component.Style{Color: color.White}})
+					until, temporary := expiry[KindGroup+" "+group]
+					groupsMsg = append(groupsMsg, &component.Text{Content: "\n > ", S: component.Style{Color: color.Yellow}}, &component.Text{Content: group, S: component.Style{Color: color.White}}, expiryText(until, temporary))
 				}
 			}
 
@@ -142,7 +208,8 @@ func (p *PermissionsPlugin) InfoCommand(_type PermissionListType) brigodier.Comm
 				permissionMsg = []component.Component{&component.Text{Content: "\nPermissions: ", S: component.Style{Color: color.Yellow}}}
 
 				for _, permission := range permissions {
-					permissionMsg = append(permissionMsg, &component.Text{Content: "\n > ", S: component.Style{Color: color.Yellow}}, &component.Text{Content: permission, S: component.Style{Color: color.White}})
+					until, temporary := expiry[KindPermission+" "+permission]
+					permissionMsg = append(permissionMsg, &component.Text{Content: "\n > ", S: component.Style{Color: color.Yellow}}, &component.Text{Content: permission, S: component.Style{Color: color.White}}, expiryText(until, temporary))
 				}
 			}
 
@@ -203,9 +270,85 @@ func (p *PermissionsPlugin) InfoCommand(_type PermissionListType) brigodier.Comm
 	})
 }
 
+// checkCommand explains why a player has a permission or not, in the
+// contexts the player is in, or those given after the permission.
+func (p *PermissionsPlugin) checkCommand() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.check") {
+			return PermissionMissingCommand().Run(c.CommandContext)
+		}
+
+		name, permission := c.String("name"), c.String("permission")
+
+		var (
+			UUID     string
+			contexts Contexts
+		)
+		if player := p.prx.PlayerByName(name); player != nil {
+			UUID = uuid.Normalize(player.ID().String())
+			contexts = p.permissions.PlayerContexts(c.Context, player)
+		} else {
+			id, err := p.permissions.h.Profiles().ID(c.Context, name)
+			if err != nil {
+				return err
+			}
+
+			UUID = uuid.Normalize(id)
+		}
+
+		if raw := c.String("contexts"); raw != "" {
+			given, err := ParseContexts(raw)
+			if err != nil {
+				return c.SendMessage(&component.Text{Content: err.Error(), S: component.Style{Color: color.Red}})
+			}
+
+			contexts = given
+		}
+
+		r := p.permissions.Check(UUID, permission, contexts)
+
+		result := &component.Text{Content: "denied", S: component.Style{Color: color.Red}}
+		if r.Allowed {
+			result = &component.Text{Content: "allowed", S: component.Style{Color: color.Green}}
+		}
+
+		nodes := []component.Component{&component.Text{Content: "\nNodes: ", S: component.Style{Color: color.Yellow}}}
+		if len(r.Considered) == 0 {
+			nodes = append(nodes, &component.Text{Content: "none grant it", S: component.Style{Color: color.White}})
+		}
+
+		for _, n := range r.Considered {
+			applies := &component.Text{Content: " applies", S: component.Style{Color: color.Green}}
+			if n.Reason != "" {
+				applies = &component.Text{Content: " " + n.Reason, S: component.Style{Color: color.Gray}}
+			}
+
+			nodes = append(nodes,
+				&component.Text{Content: "\n > ", S: component.Style{Color: color.Yellow}},
+				&component.Text{Content: n.Node, S: component.Style{Color: color.White}},
+				&component.Text{Content: " from " + n.Source, S: component.Style{Color: color.Gray}},
+				applies,
+			)
+		}
+
+		return c.SendMessage(&component.Text{
+			Extra: []component.Component{
+				&component.Text{Content: "\n"},
+				&component.Text{Content: "Check: ", S: component.Style{Color: color.Yellow}},
+				&component.Text{Content: permission + " for " + name + "\n", S: component.Style{Color: color.White}},
+				&component.Text{Content: "Contexts: ", S: component.Style{Color: color.Yellow}},
+				&component.Text{Content: contexts.String() + "\n", S: component.Style{Color: color.White}},
+				&component.Text{Content: "Result: ", S: component.Style{Color: color.Yellow}},
+				result,
+				&component.Text{Extra: nodes},
+			},
+		})
+	})
+}
+
 func (p *PermissionsPlugin) helpCommand() brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "permissions.help") {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.help") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
 		return c.SendMessage(&component.Text{
@@ -216,8 +359,12 @@ func (p *PermissionsPlugin) helpCommand() brigodier.Command {
 				&component.Text{Content: "> ", S: component.Style{Color: color.Blue, Bold: component.False}},
 				&component.Text{Content: "/permissions user\n", S: component.Style{Color: color.LightPurple, Bold: component.False}},
 				&component.Text{Content: "> ", S: component.Style{Color: color.Blue, Bold: component.False}},
+				&component.Text{Content: "/permissions user <name> group add|remove <group> [duration]\n", S: component.Style{Color: color.LightPurple, Bold: component.False}},
+				&component.Text{Content: "> ", S: component.Style{Color: color.Blue, Bold: component.False}},
 				&component.Text{Content: "/permissions group\n", S: component.Style{Color: color.LightPurple, Bold: component.False}},
 				&component.Text{Content: "> ", S: component.Style{Color: color.Blue, Bold: component.False}},
+				&component.Text{Content: "/permissions check <player> <permission> [contexts]\n", S: component.Style{Color: color.LightPurple, Bold: component.False}},
+				&component.Text{Content: "> ", S: component.Style{Color: color.Blue, Bold: component.False}},
 				&component.Text{Content: "/permissions reload", S: component.Style{Color: color.LightPurple, Bold: component.False}},
 			},
 		})
@@ -226,13 +373,18 @@ func (p *PermissionsPlugin) helpCommand() brigodier.Command {
 
 func (p *PermissionsPlugin) addCommand(_type PermissionListType) brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "permissions.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
 
 		permission := c.Arguments["permission"].Result.(string)
 		name := c.Arguments["name"].Result.(string)
 
+		until, err := untilArg(c)
+		if err != nil {
+			return c.SendMessage(&component.Text{Content: err.Error() + ", use e.g. 30d or 12h.", S: component.Style{Color: color.Red}})
+		}
+
 		errorMsg := &component.Text{
 			Extra: []component.Component{
 				&component.Text{Content: "ᴘᴇʀᴍѕ ", S: component.Style{Color: color.Green, Bold: component.True}},
@@ -245,18 +397,19 @@ func (p *PermissionsPlugin) addCommand(_type PermissionListType) brigodier.Comma
 
 		switch _type {
 		case PermissionTypeUser:
-			UUID, err := uuid.UsernameToUUID(name)
+			UUID, err := p.permissions.h.Profiles().ID(c.Context, name)
 			if err != nil {
 				return err
 			}
 
+			// Temporary nodes may extend one the player already has
 			UUID = uuid.Normalize(UUID)
 			res := p.permissions.UserHasPermission(UUID, permission)
-			if res {
+			if res && until.IsZero() {
 				return c.SendMessage(errorMsg)
 			}
 
-			p.permissions.UserAddPermission(c.Context, UUID, permission)
+			p.permissions.UserAddPermissionUntil(c.Context, UUID, permission, until)
 		case PermissionTypeGroup:
 			res := p.permissions.GroupHasPermission(name, permission)
 			if res {
@@ -273,6 +426,7 @@ func (p *PermissionsPlugin) addCommand(_type PermissionListType) brigodier.Comma
 				&component.Text{Content: permission, S: component.Style{Color: color.LightPurple}},
 				&component.Text{Content: " for ", S: component.Style{Color: color.Green}},
 				&component.Text{Content: name, S: component.Style{Color: color.LightPurple}},
+				untilText(until),
 			},
 		})
 	})
@@ -280,7 +434,7 @@ func (p *PermissionsPlugin) addCommand(_type PermissionListType) brigodier.Comma
 
 func (p *PermissionsPlugin) removeCommand(_type PermissionListType) brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "permissions.remove") {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.remove") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
 
@@ -299,21 +453,22 @@ func (p *PermissionsPlugin) removeCommand(_type PermissionListType) brigodier.Co
 
 		switch _type {
 		case PermissionTypeUser:
-			UUID, err := uuid.UsernameToUUID(name)
+			UUID, err := p.permissions.h.Profiles().ID(c.Context, name)
 			if err != nil {
 				return err
 			}
 
+			// Nodes with contexts are removed as they were added
 			UUID = uuid.Normalize(UUID)
-			res := p.permissions.UserHasPermission(UUID, permission)
-			if !res {
+			permissions, _ := p.permissions.UserPermissions(UUID)
+			if !slices.Contains(permissions, permission) {
 				return c.SendMessage(errorMsg)
 			}
 
 			p.permissions.UserRemovePermission(c.Context, UUID, permission)
 		case PermissionTypeGroup:
-			res := p.permissions.GroupHasPermission(name, permission)
-			if !res {
+			group, _ := p.permissions.GetGroup(name)
+			if !slices.Contains(group.Permissions, permission) {
 				return c.SendMessage(errorMsg)
 			}
 
@@ -332,9 +487,115 @@ func (p *PermissionsPlugin) removeCommand(_type PermissionListType) brigodier.Co
 	})
 }
 
+// groupCommand adds the user to the group, or removes them from it.
+func (p *PermissionsPlugin) groupCommand(add bool) brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.group") {
+			return PermissionMissingCommand().Run(c.CommandContext)
+		}
+
+		name, group := c.String("name"), c.String("group")
+
+		until, err := untilArg(c)
+		if err != nil {
+			return c.SendMessage(&component.Text{Content: err.Error() + ", use e.g. 30d or 12h.", S: component.Style{Color: color.Red}})
+		}
+
+		UUID, err := p.permissions.h.Profiles().ID(c.Context, name)
+		if err != nil {
+			return err
+		}
+
+		if _, exists := p.permissions.GetGroup(group); add && !exists {
+			return c.SendMessage(&component.Text{
+				Extra: []component.Component{
+					&component.Text{Content: "ᴘᴇʀᴍѕ ", S: component.Style{Color: color.Green, Bold: component.True}},
+					&component.Text{Content: "This group doesn't exist!", S: component.Style{Color: color.Red}},
+				},
+			})
+		}
+
+		var (
+			changed bool
+			done    = "Added "
+			into    = " to "
+			failed  = " is already in "
+		)
+		if add {
+			changed, err = p.permissions.UserAddGroupUntil(c.Context, UUID, group, until)
+		} else {
+			changed, err = p.permissions.UserRemoveGroup(c.Context, UUID, group)
+			done, into, failed = "Removed ", " from ", " isn't in "
+		}
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			return c.SendMessage(&component.Text{
+				Extra: []component.Component{
+					&component.Text{Content: "ᴘᴇʀᴍѕ ", S: component.Style{Color: color.Green, Bold: component.True}},
+					&component.Text{Content: name, S: component.Style{Color: color.LightPurple}},
+					&component.Text{Content: failed, S: component.Style{Color: color.Red}},
+					&component.Text{Content: group, S: component.Style{Color: color.LightPurple}},
+				},
+			})
+		}
+
+		return c.SendMessage(&component.Text{
+			Extra: []component.Component{
+				&component.Text{Content: "ᴘᴇʀᴍѕ ", S: component.Style{Color: color.Green, Bold: component.True}},
+				&component.Text{Content: done, S: component.Style{Color: color.Green}},
+				&component.Text{Content: name, S: component.Style{Color: color.LightPurple}},
+				&component.Text{Content: into, S: component.Style{Color: color.Green}},
+				&component.Text{Content: group, S: component.Style{Color: color.LightPurple}},
+				untilText(until),
+			},
+		})
+	})
+}
+
+// untilArg is when the optional duration argument, like 30d, runs out from
+// now, or zero without one.
+func untilArg(c *command.Context) (time.Time, error) {
+	raw := c.String("duration")
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	d, err := ParseDuration(raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(d), nil
+}
+
+func untilText(until time.Time) component.Component {
+	if until.IsZero() {
+		return &component.Text{}
+	}
+
+	return &component.Text{Content: " until " + until.Format(time.DateTime), S: component.Style{Color: color.Green}}
+}
+
+// expiryText is the time left of a temporary group or node in /perm info.
+func expiryText(until time.Time, temporary bool) component.Component {
+	if !temporary {
+		return &component.Text{}
+	}
+
+	left := time.Until(until)
+	if left <= 0 {
+		return &component.Text{Content: " (expired)", S: component.Style{Color: color.Red}}
+	}
+
+	return &component.Text{Content: " (expires in " + formatRemaining(left) + ")", S: component.Style{Color: color.Gray}}
+}
+
 func (p *PermissionsPlugin) reloadCommand() brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "permissions.reload") {
+		if !p.permissions.SourceHasPermission(c.Source, "permissions.reload") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
 		if err := p.permissions.Reload(c.Context); err != nil {
@@ -0,0 +1,279 @@
+package permissions
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Channel backend permission plugins resync on. The proxy sends a
+// GroupChange when the groups of a player on the backend change, and answers
+// a dataRequest, e.g. {"player":"<uuid>","permission":"worldedit.use"}, with
+// the PlayerData of the player, the player of the connection by default.
+const Channel = "csmc:permissions"
+
+// GroupChange is published on PermissionsSubject by the proxy that saved it,
+// and sent on Channel to the backend of the player.
+type GroupChange struct {
+	Player  string    `json:"player"`
+	Groups  []string  `json:"groups"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	Proxy   string    `json:"proxy"`
+	Time    time.Time `json:"time"`
+}
+
+// GrantedNode is a node of a player, with where it came from.
+type GrantedNode struct {
+	Node string `json:"node"`
+	// Source is "user" or "group <name>"
+	Source string `json:"source"`
+	// Expires is when a temporary node of the user runs out
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// PlayerData is what the proxy knows about the permissions of a player,
+// backends should treat it as the source of truth.
+type PlayerData struct {
+	Player string   `json:"player"`
+	Groups []string `json:"groups"`
+	// GroupExpiry is when the temporary groups run out
+	GroupExpiry map[string]time.Time `json:"groupExpiry,omitempty"`
+	Prefix      string               `json:"prefix,omitempty"`
+	Nodes       []GrantedNode        `json:"nodes"`
+	// Contexts are those the proxy resolves for the player, if online here
+	Contexts Contexts `json:"contexts,omitempty"`
+	// Check is the result for the permission of the request, if it named
+	// one
+	Check *CheckResult `json:"check,omitempty"`
+}
+
+type dataRequest struct {
+	Player     string   `json:"player"`
+	Permission string   `json:"permission"`
+	Contexts   Contexts `json:"contexts"`
+}
+
+func snapshotGroups(users map[string]PermissionUser) map[string][]string {
+	groups := make(map[string][]string, len(users))
+	for id, user := range users {
+		groups[id] = slices.Clone(user.Groups)
+	}
+
+	return groups
+}
+
+// groupChanges diffs the groups of the users against those last saved, the
+// caller holds the lock.
+func (p *Permissions) groupChanges() []GroupChange {
+	now := time.Now()
+	current := snapshotGroups(p.Users)
+
+	var changes []GroupChange
+	diff := func(id string) {
+		before, after := p.saved[id], current[id]
+
+		c := GroupChange{Player: id, Groups: make([]string, 0, len(after)), Proxy: p.h.Info.PodName, Time: now}
+		c.Groups = append(c.Groups, after...)
+		for _, g := range after {
+			if !slices.Contains(before, g) {
+				c.Added = append(c.Added, g)
+			}
+		}
+		for _, g := range before {
+			if !slices.Contains(after, g) {
+				c.Removed = append(c.Removed, g)
+			}
+		}
+
+		if len(c.Added)+len(c.Removed) > 0 {
+			changes = append(changes, c)
+		}
+	}
+
+	for id := range current {
+		diff(id)
+	}
+	for id := range p.saved {
+		if _, ok := current[id]; !ok {
+			diff(id)
+		}
+	}
+
+	p.saved = current
+
+	return changes
+}
+
+func (p *Permissions) publishChanges(ctx context.Context, changes []GroupChange) {
+	for _, c := range changes {
+		raw, err := json.Marshal(c)
+		if err != nil {
+			log.Printf("Failed to marshal the group change of %s: %v", c.Player, err)
+			continue
+		}
+
+		if err := p.h.Messaging().Publish(ctx, p.h.Info.PermissionsSubject(), raw); err != nil {
+			log.Printf("Failed to publish the group change of %s: %v", c.Player, err)
+		}
+	}
+}
+
+// Data returns the groups and nodes of the player, by undashed UUID, without
+// those that ran out.
+func (p *Permissions) Data(player string) PlayerData {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	d := PlayerData{Player: player, Groups: make([]string, 0), Nodes: make([]GrantedNode, 0)}
+
+	user, ok := p.Users[player]
+	if !ok {
+		return d
+	}
+
+	now := time.Now()
+	for _, node := range user.Permissions {
+		until, temporary := user.PermissionExpiry[node]
+		if expiredReason(until, now) != "" {
+			continue
+		}
+
+		g := GrantedNode{Node: node, Source: "user"}
+		if temporary {
+			g.Expires = &until
+		}
+		d.Nodes = append(d.Nodes, g)
+	}
+
+	weight := -1
+	for _, name := range user.Groups {
+		until, temporary := user.GroupExpiry[name]
+		if expiredReason(until, now) != "" {
+			continue
+		}
+
+		d.Groups = append(d.Groups, name)
+		if temporary {
+			if d.GroupExpiry == nil {
+				d.GroupExpiry = make(map[string]time.Time)
+			}
+			d.GroupExpiry[name] = until
+		}
+
+		group, exists := p.Groups[name]
+		if !exists {
+			continue
+		}
+
+		if int(group.Weight) > weight && group.Prefix != "" {
+			d.Prefix, weight = group.Prefix, int(group.Weight)
+		}
+
+		for _, node := range group.Permissions {
+			d.Nodes = append(d.Nodes, GrantedNode{Node: node, Source: "group " + name})
+		}
+	}
+
+	return d
+}
+
+// onGroupChange tells the backends of our players that their groups changed.
+func (p *PermissionsPlugin) onGroupChange(msg messaging.Message) {
+	defer p.permissions.h.Recover("Permissions")
+
+	c := GroupChange{}
+	if err := json.Unmarshal(msg.Data, &c); err != nil {
+		log.Printf("Invalid group change: %v", err)
+		return
+	}
+
+	id, err := guuid.Parse(c.Player)
+	if err != nil {
+		log.Printf("Invalid group change of %s: %v", c.Player, err)
+		return
+	}
+
+	// Every proxy gets the change, the one the player is on delivers it
+	if p.prx.Player(id) == nil {
+		return
+	}
+
+	if err := p.channel.Send(msg.Context, id, c); err != nil {
+		log.Printf("Failed to send the group change of %s to their backend: %v", c.Player, err)
+	}
+}
+
+func (p *PermissionsPlugin) onMessage(msg bridge.Message) {
+	req := dataRequest{}
+	if err := msg.Decode(&req); err != nil {
+		log.Printf("Invalid permissions request from %s: %v", msg.Server.ServerInfo().Name(), err)
+		return
+	}
+
+	player := uuid.Normalize(req.Player)
+	if player == "" {
+		player = msg.Player.ID().Undashed()
+	}
+
+	// Resolving the group context may take a KV read
+	go func() {
+		defer p.permissions.h.Recover("Permissions")
+
+		d := p.permissions.Data(player)
+		if player == msg.Player.ID().Undashed() {
+			d.Contexts = p.permissions.PlayerContexts(p.permissions.h.Context(), msg.Player)
+		}
+
+		if req.Permission != "" {
+			c := req.Contexts
+			if c == nil {
+				c = d.Contexts
+			}
+
+			r := p.permissions.Check(player, req.Permission, c)
+			d.Check = &r
+		}
+
+		if err := msg.Respond(d); err != nil {
+			log.Printf("Failed to answer the permissions request from %s: %v", msg.Server.ServerInfo().Name(), err)
+		}
+	}()
+}
+
+func (p *PermissionsPlugin) handleGetPlayer(w http.ResponseWriter, r *http.Request) {
+	id, err := guuid.Parse(r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	d := p.permissions.Data(id.Undashed())
+	if player := p.prx.Player(id); player != nil {
+		d.Contexts = p.permissions.PlayerContexts(r.Context(), player)
+	}
+
+	if permission := r.URL.Query().Get("permission"); permission != "" {
+		c := d.Contexts
+		if raw := r.URL.Query().Get("contexts"); raw != "" {
+			if c, err = ParseContexts(raw); err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		res := p.permissions.Check(d.Player, permission, c)
+		d.Check = &res
+	}
+
+	api.WriteJSON(w, http.StatusOK, d)
+}
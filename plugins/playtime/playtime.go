@@ -0,0 +1,179 @@
+// Package playtime counts how long players play on the network and fires
+// playtime.reached when they pass a milestone, e.g. to promote them to a
+// group or leave a reward in their mailbox.
+package playtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/mail"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
+)
+
+// Event is what milestones are delivered to webhooks as.
+const Event = "playtime.reached"
+
+// Record is the playtime of a player.
+type Record struct {
+	Seconds int64 `json:"seconds"`
+	// Reached is when the player passed each milestone, by name
+	Reached map[string]time.Time `json:"reached,omitempty"`
+	Updated time.Time            `json:"updated"`
+}
+
+func (r Record) Total() time.Duration {
+	return time.Duration(r.Seconds) * time.Second
+}
+
+// Milestone is a playtime to react to. Name defaults to After, e.g. 24h.
+type Milestone struct {
+	Name  string `json:"name"`
+	After string `json:"after"`
+	// Group is added to the player, e.g. regular
+	Group string `json:"group,omitempty"`
+	// Message and Reward are left in the mailbox of the player
+	Message string       `json:"message,omitempty"`
+	Reward  *mail.Reward `json:"reward,omitempty"`
+
+	after time.Duration
+}
+
+// ParseMilestones parses a JSON list of milestones, sorted by playtime.
+func ParseMilestones(raw string) ([]Milestone, error) {
+	milestones := make([]Milestone, 0)
+	if err := json.Unmarshal([]byte(raw), &milestones); err != nil {
+		return nil, err
+	}
+
+	for i, m := range milestones {
+		d, err := permissions.ParseDuration(m.After)
+		if err != nil {
+			return nil, fmt.Errorf("milestone %d: %w", i, err)
+		}
+
+		milestones[i].after = d
+		if m.Name == "" {
+			milestones[i].Name = m.After
+		}
+	}
+
+	slices.SortFunc(milestones, func(a, b Milestone) int {
+		return int(a.after - b.after)
+	})
+
+	return milestones, nil
+}
+
+// Reached is the playtime.reached event.
+type Reached struct {
+	Player    string `json:"player"`
+	Username  string `json:"username"`
+	Milestone string `json:"milestone"`
+	Seconds   int64  `json:"seconds"`
+	// Group is the group the player was promoted to, if any
+	Group string    `json:"group,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Playtime keeps the records and the hooks other plugins react to
+// milestones with.
+type Playtime struct {
+	h  *hosting.Hosting
+	kv kv.Bucket
+
+	hooks []func(context.Context, Reached)
+	m     sync.RWMutex
+}
+
+func NewKVPlaytime(ctx context.Context, h *hosting.Hosting) (*Playtime, error) {
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_playtime")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Playtime{h: h, kv: bucket}, nil
+}
+
+// OnReached calls fn on the proxy of the player whenever they pass a
+// milestone, after its group and mail were handed out.
+func (p *Playtime) OnReached(fn func(context.Context, Reached)) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.hooks = append(p.hooks, fn)
+}
+
+func (p *Playtime) fire(ctx context.Context, e Reached) {
+	p.m.RLock()
+	hooks := slices.Clone(p.hooks)
+	p.m.RUnlock()
+
+	for _, fn := range hooks {
+		fn(ctx, e)
+	}
+}
+
+// Get returns the record of the player by undashed UUID, empty if they
+// never played.
+func (p *Playtime) Get(ctx context.Context, player string) (Record, error) {
+	r, _, err := kv.Typed[Record](p.kv, player).Lookup(ctx)
+	return r, err
+}
+
+// add counts the time to the playtime of the player and returns the
+// milestones they passed with it. A player is on one proxy at a time, so
+// only that proxy writes their record.
+func (p *Playtime) add(ctx context.Context, player string, played time.Duration, milestones []Milestone, now time.Time) (Record, []Milestone, error) {
+	r, err := p.Get(ctx, player)
+	if err != nil {
+		return Record{}, nil, err
+	}
+
+	r.Seconds += int64(played / time.Second)
+	r.Updated = now.UTC()
+
+	var passed []Milestone
+	for _, m := range milestones {
+		if _, ok := r.Reached[m.Name]; ok || r.Total() < m.after {
+			continue
+		}
+
+		if r.Reached == nil {
+			r.Reached = make(map[string]time.Time)
+		}
+		r.Reached[m.Name] = now.UTC()
+		passed = append(passed, m)
+	}
+
+	return r, passed, kv.Typed[Record](p.kv, player).Set(ctx, r)
+}
+
+func (p *Playtime) export(ctx context.Context, player string) (any, error) {
+	r, ok, err := kv.Typed[Record](p.kv, player).Lookup(ctx)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (p *Playtime) erase(ctx context.Context, player string) (gdpr.Erasure, error) {
+	if _, ok, err := kv.Typed[Record](p.kv, player).Lookup(ctx); err != nil || !ok {
+		return gdpr.Erasure{}, err
+	}
+
+	if err := p.kv.Delete(ctx, player); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return gdpr.Erasure{}, err
+	}
+
+	return gdpr.Erasure{Erased: 1}, nil
+}
@@ -0,0 +1,252 @@
+package playtime
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/mail"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
+)
+
+var reachedTotal = metrics.NewCounterVec("gate_playtime_milestones_total", "Playtime milestones players reached, by milestone.", "milestone")
+
+type PlaytimePlugin struct {
+	prx      *proxy.Proxy
+	h        *hosting.Hosting
+	playtime *Playtime
+	perms    *permissions.Permissions
+	mail     *mail.Mailbox
+
+	milestones []Milestone
+
+	// counted is up to when the playtime of our players was counted
+	counted map[guuid.UUID]time.Time
+	m       sync.Mutex
+}
+
+func New(h *hosting.Hosting, pt *Playtime, perms *permissions.Permissions, mb *mail.Mailbox) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Playtime",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			milestones, err := ParseMilestones(util.EnvWithDefault("PLAYTIME_MILESTONES", `[{"after":"1h"},{"after":"10h"},{"after":"24h"},{"after":"100h"}]`))
+			if err != nil {
+				return fmt.Errorf("PLAYTIME_MILESTONES: %w", err)
+			}
+
+			p := &PlaytimePlugin{
+				prx:        prx,
+				h:          h,
+				playtime:   pt,
+				perms:      perms,
+				mail:       mb,
+				milestones: milestones,
+				counted:    make(map[guuid.UUID]time.Time),
+			}
+
+			return p.Init(util.EnvDurationWithDefault("PLAYTIME_INTERVAL", time.Minute))
+		},
+	}, nil
+}
+
+func (p *PlaytimePlugin) Init(interval time.Duration) error {
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Playtime", p.onPostLogin))
+	event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Playtime", p.onDisconnect))
+
+	p.prx.Command().Register(p.playtimeCommand())
+
+	p.h.API().HandleFunc("GET /playtime/{player}", p.handleGet)
+
+	p.h.GDPR().Register("playtime", gdpr.Subsystem{Export: p.playtime.export, Erase: p.playtime.erase})
+
+	p.h.Go("Playtime", func(ctx context.Context) {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				for _, player := range p.prx.Players() {
+					p.count(ctx, player, now)
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func (p *PlaytimePlugin) onPostLogin(e *proxy.PostLoginEvent) {
+	p.m.Lock()
+	p.counted[e.Player().ID()] = time.Now()
+	p.m.Unlock()
+}
+
+func (p *PlaytimePlugin) onDisconnect(e *proxy.DisconnectEvent) {
+	player, now := e.Player(), time.Now()
+
+	// Taken off right away, so a quick rejoin starts a new session
+	p.m.Lock()
+	since, ok := p.counted[player.ID()]
+	delete(p.counted, player.ID())
+	p.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	go func() {
+		defer p.h.Recover("Playtime")
+
+		p.add(p.h.Context(), player, now.Sub(since).Truncate(time.Second), now)
+	}()
+}
+
+// count adds the time since the playtime of the player was last counted,
+// in whole seconds so the rest counts next time.
+func (p *PlaytimePlugin) count(ctx context.Context, player proxy.Player, now time.Time) {
+	p.m.Lock()
+	since, ok := p.counted[player.ID()]
+	played := now.Sub(since).Truncate(time.Second)
+	if ok {
+		p.counted[player.ID()] = since.Add(played)
+	}
+	p.m.Unlock()
+
+	if ok {
+		p.add(ctx, player, played, now)
+	}
+}
+
+func (p *PlaytimePlugin) add(ctx context.Context, player proxy.Player, played time.Duration, now time.Time) {
+	if played <= 0 {
+		return
+	}
+
+	r, passed, err := p.playtime.add(ctx, player.ID().Undashed(), played, p.milestones, now)
+	if err != nil {
+		log.Printf("Failed to count the playtime of %s: %v", player.Username(), err)
+		return
+	}
+
+	for _, m := range passed {
+		p.reached(ctx, player, m, r, now)
+	}
+}
+
+// reached hands out what the milestone gives and tells everyone listening.
+func (p *PlaytimePlugin) reached(ctx context.Context, player proxy.Player, m Milestone, r Record, now time.Time) {
+	id := player.ID().Undashed()
+	e := Reached{Player: id, Username: player.Username(), Milestone: m.Name, Seconds: r.Seconds, Time: now.UTC()}
+
+	if m.Group != "" {
+		if _, exists := p.perms.GetGroup(m.Group); !exists {
+			log.Printf("Playtime milestone %s promotes to %s, which doesn't exist", m.Name, m.Group)
+		} else if added, err := p.perms.UserAddGroup(ctx, id, m.Group); err != nil {
+			log.Printf("Failed to promote %s to %s for %s of playtime: %v", player.Username(), m.Group, m.Name, err)
+		} else if added {
+			e.Group = m.Group
+		}
+	}
+
+	if m.Message != "" || m.Reward != nil {
+		message := m.Message
+		if message == "" {
+			message = m.Name + " of playtime"
+		}
+
+		if _, err := p.mail.Deposit(ctx, mail.Item{Player: id, From: "playtime", Message: message, Reward: m.Reward}); err != nil {
+			log.Printf("Failed to leave the %s playtime reward of %s: %v", m.Name, player.Username(), err)
+		}
+	}
+
+	reachedTotal.Inc(m.Name)
+
+	msg := "You have played for " + m.Name + ", thank you!"
+	if e.Group != "" {
+		msg = "You have played for " + m.Name + " and are now " + e.Group + ", thank you!"
+	}
+	_ = player.SendMessage(&Text{Content: msg, S: Style{Color: color.Green}})
+
+	details := map[string]string{"milestone": m.Name}
+	if e.Group != "" {
+		details["group"] = e.Group
+	}
+	if err := p.h.Audit().Record(ctx, audit.Entry{Actor: "playtime", Action: "playtime.reached", Target: id, Details: details}); err != nil {
+		log.Printf("Failed to record the %s playtime milestone of %s: %v", m.Name, player.Username(), err)
+	}
+
+	if err := p.h.Webhooks().Deliver(Event, e); err != nil {
+		log.Printf("Failed to deliver the %s playtime milestone of %s: %v", m.Name, player.Username(), err)
+	}
+
+	p.playtime.fire(ctx, e)
+}
+
+// formatPlaytime rounds to minutes, e.g. 3d 4h 12m.
+func formatPlaytime(d time.Duration) string {
+	days, hours, minutes := int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+func (p *PlaytimePlugin) playtimeCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("playtime").
+		Executes(command.Command(func(c *command.Context) error {
+			player, ok := c.Source.(proxy.Player)
+			if !ok {
+				return c.Source.SendMessage(&Text{Content: "Only players have a playtime.", S: Style{Color: color.Red}})
+			}
+
+			// Count the current session first, so it shows
+			p.count(c.Context, player, time.Now())
+
+			r, err := p.playtime.Get(c.Context, player.ID().Undashed())
+			if err != nil {
+				return err
+			}
+
+			return c.Source.SendMessage(&Text{
+				Extra: []Component{
+					&Text{Content: "You have played for ", S: Style{Color: color.Gray}},
+					&Text{Content: formatPlaytime(r.Total()), S: Style{Color: color.Gold}},
+					&Text{Content: ".", S: Style{Color: color.Gray}},
+				},
+			})
+		}))
+}
+
+func (p *PlaytimePlugin) handleGet(w http.ResponseWriter, r *http.Request) {
+	record, err := p.playtime.Get(r.Context(), uuid.Normalize(r.PathValue("player")))
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, record)
+}
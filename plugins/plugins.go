@@ -0,0 +1,156 @@
+// Package plugins assembles the plugins of the proxy, shared by the proxy
+// itself and the end-to-end tests.
+package plugins
+
+import (
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/analytics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bossbar"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bungee"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/chat"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/client"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/commands"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/console"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/core"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/discordsync"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/fallback"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/incident"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/link"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/listeners"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/mail"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/matchmaking"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/menus"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/motd"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/playtime"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/punishments"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/recorder"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/regions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/resourcepack"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/restarts"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/selector"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/sessions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/shield"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/skins"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/store"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/tab"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/waitingroom"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/warmup"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/whitelist"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type PluginCreator = func(h *hosting.Hosting) (proxy.Plugin, error)
+
+// All creates every plugin in the order they initialize, wrapped with
+// h.Track.
+func All(h *hosting.Hosting) ([]proxy.Plugin, error) {
+	perms, err := permissions.NewKVPermissions(h.Context(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := link.NewKVLinks(h.Context(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	wl, err := whitelist.NewKVWhitelist(h.Context(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	brg := bridge.NewBridge(h)
+	mnu := menus.NewMenus(h, brg)
+
+	mb, err := mail.NewKVMailbox(h.Context(), h, brg)
+	if err != nil {
+		return nil, err
+	}
+
+	pt, err := playtime.NewKVPlaytime(h.Context(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	cht := chat.NewChat()
+	clt := client.NewClients()
+
+	creators := []PluginCreator{
+		shield.New,
+		core.New,
+		fallback.New,
+		matchmaking.New,
+		commands.New,
+		listeners.New,
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return client.New(h, clt)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return chat.New(h, cht)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return punishments.New(h, cht)
+		},
+		incident.New,
+		bungee.New,
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return bridge.New(h, brg)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return menus.New(h, mnu)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return selector.New(h, brg, mnu)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return sessions.New(h, brg)
+		},
+		regions.New,
+		recorder.New,
+		analytics.New,
+		func(_ *hosting.Hosting) (proxy.Plugin, error) {
+			return permissions.New(perms, brg)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return whitelist.New(h, wl, perms)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return store.New(h, perms, wl, mb)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return mail.New(h, mb)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return playtime.New(h, pt, perms, mb)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return link.New(h, links)
+		},
+		func(h *hosting.Hosting) (proxy.Plugin, error) {
+			return discordsync.New(h, links, wl)
+		},
+		motd.New,
+		tab.New,
+		bossbar.New,
+		restarts.New,
+		resourcepack.New,
+		skins.New,
+		console.New,
+		waitingroom.New,
+		// Last, it waits for the warmups the others registered
+		warmup.New,
+	}
+
+	plugins := make([]proxy.Plugin, 0, len(creators))
+	for _, create := range creators {
+		p, err := create(h)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, h.Track(p))
+	}
+
+	return plugins, nil
+}
@@ -0,0 +1,231 @@
+package punishments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+)
+
+type issueRequest struct {
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+	// Report is the ID of the report the punishment resolves
+	Report string `json:"report"`
+	// Override is issued instead of the step of the ladder
+	Override *Step `json:"override"`
+}
+
+type warnRequest struct {
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+	// Points overrides what the warning is worth
+	Points float64 `json:"points"`
+}
+
+type warnResponse struct {
+	Warning Warning `json:"warning"`
+	// Punishment is set if the warning crossed the threshold
+	Punishment *Punishment `json:"punishment,omitempty"`
+}
+
+func (p *PunishmentsPlugin) registerAPI() {
+	p.h.API().HandleFunc("GET /punishments/ladders", p.handleListLadders)
+	p.h.API().HandleFunc("PUT /punishments/ladders/{category}", p.handleSetLadder)
+	p.h.API().HandleFunc("DELETE /punishments/ladders/{category}", p.handleDeleteLadder)
+	p.h.API().HandleFunc("GET /punishments/active", p.handleListActive)
+	p.h.API().HandleFunc("GET /punishments/players/{player}", p.handleListPunishments)
+	p.h.API().HandleFunc("POST /punishments/players/{player}", p.handleIssue)
+	p.h.API().HandleFunc("DELETE /punishments/players/{player}/{id}", p.handleLift)
+	p.h.API().HandleFunc("GET /punishments/players/{player}/warnings", p.handleListWarnings)
+	p.h.API().HandleFunc("POST /punishments/players/{player}/warnings", p.handleWarn)
+	p.h.API().HandleFunc("GET /punishments/notes", p.handleSearchNotes)
+	p.h.API().HandleFunc("GET /punishments/players/{player}/notes", p.handleListNotes)
+	p.h.API().HandleFunc("POST /punishments/players/{player}/notes", p.handleAddNote)
+	p.h.API().HandleFunc("POST /punishments/players/{player}/notes/{id}/pin", p.handlePinNote(true))
+	p.h.API().HandleFunc("POST /punishments/players/{player}/notes/{id}/unpin", p.handlePinNote(false))
+	p.h.API().HandleFunc("GET /punishments/appeals", p.handleListAppeals)
+	p.h.API().HandleFunc("POST /punishments/appeals", p.handleCreateAppeal)
+	p.h.API().HandleFunc("GET /punishments/appeals/{id}", p.handleGetAppeal)
+	p.h.API().HandleFunc("POST /punishments/appeals/{id}/comments", p.handleCommentAppeal)
+	p.h.API().HandleFunc("POST /punishments/appeals/{id}/approve", p.handleDecideAppeal(AppealApproved))
+	p.h.API().HandleFunc("POST /punishments/appeals/{id}/deny", p.handleDecideAppeal(AppealDenied))
+}
+
+func (p *PunishmentsPlugin) handleListLadders(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.store.Ladders())
+}
+
+func (p *PunishmentsPlugin) handleSetLadder(w http.ResponseWriter, r *http.Request) {
+	l := Ladder{}
+	if err := api.ReadJSON(r, &l); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	l.Category = parseCategory(r.PathValue("category"))
+
+	if err := l.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.store.SetLadder(r.Context(), l); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "punishment.ladder.set", Target: l.Category}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, l)
+}
+
+func (p *PunishmentsPlugin) handleDeleteLadder(w http.ResponseWriter, r *http.Request) {
+	category := parseCategory(r.PathValue("category"))
+
+	if err := p.store.DeleteLadder(r.Context(), category); errors.Is(err, ErrLadderNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "punishment.ladder.delete", Target: category}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PunishmentsPlugin) handleListActive(w http.ResponseWriter, r *http.Request) {
+	kind := Kind(r.URL.Query().Get("kind"))
+	if kind != "" && kind != KindMute && kind != KindBan {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid kind %q, expected mute or ban", kind))
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, p.store.AllActive(kind, time.Now()))
+}
+
+func (p *PunishmentsPlugin) handleListPunishments(w http.ResponseWriter, r *http.Request) {
+	id, _, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, p.store.Of(id))
+}
+
+// handleIssue is how report tools resolve a report, with its ID and
+// category.
+func (p *PunishmentsPlugin) handleIssue(w http.ResponseWriter, r *http.Request) {
+	req := issueRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	category := parseCategory(req.Category)
+	if err := validateCategory(category); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Override != nil {
+		if err := req.Override.Validate(); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	id, name, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	issued, err := p.Issue(r.Context(), "api", Punishment{
+		Player:   id,
+		Name:     name,
+		Category: category,
+		Reason:   req.Reason,
+		Report:   req.Report,
+	}, req.Override)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, issued)
+}
+
+func (p *PunishmentsPlugin) handleLift(w http.ResponseWriter, r *http.Request) {
+	id, _, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	lifted, err := p.Lift(r.Context(), "api", id, r.PathValue("id"))
+	if errors.Is(err, ErrPunishmentNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, lifted)
+}
+
+func (p *PunishmentsPlugin) handleListWarnings(w http.ResponseWriter, r *http.Request) {
+	id, _, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, p.store.Warnings(id))
+}
+
+func (p *PunishmentsPlugin) handleWarn(w http.ResponseWriter, r *http.Request) {
+	req := warnRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	category := parseCategory(req.Category)
+	if err := validateCategory(category); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, name, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	warned, issued, err := p.Warn(r.Context(), "api", Warning{Player: id, Name: name, Category: category, Reason: req.Reason, Points: req.Points})
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := warnResponse{Warning: warned}
+	if issued.ID != "" {
+		res.Punishment = &issued
+	}
+
+	api.WriteJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,394 @@
+package punishments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const (
+	appealKeyPrefix = "appeal."
+	// decisionKeyPrefix marks an appeal as decided. Creating the marker is
+	// what decides it, so of two concurrent decisions only one succeeds.
+	decisionKeyPrefix = "decision."
+)
+
+var (
+	ErrAppealNotFound  = errors.New("appeal not found")
+	ErrAppealDecided   = errors.New("appeal is already decided")
+	ErrAppealPending   = errors.New("punishment already has a pending appeal")
+	ErrNotAppealable   = errors.New("punishment is not active")
+	ErrInvalidDecision = errors.New("decision must be approved or denied")
+)
+
+const (
+	AppealPending  = "pending"
+	AppealApproved = "approved"
+	AppealDenied   = "denied"
+)
+
+// decisionActions are the audit actions of the decisions.
+var decisionActions = map[string]string{AppealApproved: "approve", AppealDenied: "deny"}
+
+type Comment struct {
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	At     time.Time `json:"at"`
+}
+
+// Appeal asks to lift a punishment. Players appeal with the code their ban
+// or mute message shows, the ID of the punishment.
+type Appeal struct {
+	ID         string `json:"id"`
+	Punishment string `json:"punishment"`
+	// Player is the undashed UUID
+	Player   string    `json:"player"`
+	Name     string    `json:"name"`
+	Message  string    `json:"message"`
+	State    string    `json:"state"`
+	Comments []Comment `json:"comments"`
+	Created  time.Time `json:"created"`
+	// DecidedBy and Decided are set once the appeal is approved or denied
+	DecidedBy string    `json:"decidedBy,omitempty"`
+	Decided   time.Time `json:"decided"`
+	// Notified is set once the player was told about the decision
+	Notified bool `json:"notified,omitempty"`
+}
+
+type decision struct {
+	State     string    `json:"state"`
+	DecidedBy string    `json:"decidedBy"`
+	Decided   time.Time `json:"decided"`
+}
+
+// putAppeal must be called with the lock held.
+func (s *Store) putAppeal(a Appeal) {
+	s.appeals[a.ID] = a
+}
+
+func (s *Store) Appeal(id string) (Appeal, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	a, ok := s.appeals[id]
+	return a, ok
+}
+
+// Appeals returns the appeals in the state, all of them if it is empty,
+// oldest first.
+func (s *Store) Appeals(state string) []Appeal {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Appeal, 0)
+	for _, a := range s.appeals {
+		if state == "" || a.State == state {
+			list = append(list, a)
+		}
+	}
+
+	slices.SortFunc(list, func(a, b Appeal) int {
+		return a.Created.Compare(b.Created)
+	})
+
+	return list
+}
+
+func (s *Store) saveAppeal(ctx context.Context, a Appeal) error {
+	raw, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	if err := s.kv.Set(ctx, appealKeyPrefix+a.ID, raw); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.putAppeal(a)
+	s.m.Unlock()
+
+	return nil
+}
+
+// CreateAppeal opens an appeal against the active punishment with the code
+// if it belongs to the player, given by undashed UUID.
+func (p *PunishmentsPlugin) CreateAppeal(ctx context.Context, player, code, message string) (Appeal, error) {
+	s := p.store
+
+	s.m.RLock()
+	punishment, ok := s.byPlayer[player][code]
+	s.m.RUnlock()
+
+	if !ok {
+		return Appeal{}, ErrPunishmentNotFound
+	}
+
+	if !punishment.Active(time.Now()) {
+		return Appeal{}, ErrNotAppealable
+	}
+
+	for _, a := range s.Appeals(AppealPending) {
+		if a.Punishment == code {
+			return Appeal{}, ErrAppealPending
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Appeal{}, err
+	}
+
+	a := Appeal{
+		ID:         id,
+		Punishment: code,
+		Player:     player,
+		Name:       punishment.Name,
+		Message:    message,
+		State:      AppealPending,
+		Comments:   make([]Comment, 0),
+		Created:    time.Now(),
+	}
+
+	if err := s.saveAppeal(ctx, a); err != nil {
+		return Appeal{}, err
+	}
+
+	return a, p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   punishment.Name,
+		Action:  "punishment.appeal.create",
+		Target:  player,
+		Details: map[string]string{"id": a.ID, "punishment": code},
+	})
+}
+
+func (p *PunishmentsPlugin) CommentAppeal(ctx context.Context, id string, comment Comment) (Appeal, error) {
+	a, ok := p.store.Appeal(id)
+	if !ok {
+		return Appeal{}, ErrAppealNotFound
+	}
+
+	comment.At = time.Now()
+	a.Comments = append(a.Comments, comment)
+
+	if err := p.store.saveAppeal(ctx, a); err != nil {
+		return Appeal{}, err
+	}
+
+	return a, p.h.Audit().Record(ctx, audit.Entry{Actor: comment.Author, Action: "punishment.appeal.comment", Target: a.Player, Details: map[string]string{"id": id}})
+}
+
+// DecideAppeal approves or denies the appeal. Approving lifts the punishment,
+// the player learns about either on their next join.
+func (p *PunishmentsPlugin) DecideAppeal(ctx context.Context, actor, id, state string) (Appeal, error) {
+	if state != AppealApproved && state != AppealDenied {
+		return Appeal{}, ErrInvalidDecision
+	}
+
+	a, ok := p.store.Appeal(id)
+	if !ok {
+		return Appeal{}, ErrAppealNotFound
+	}
+
+	if a.State != AppealPending {
+		return Appeal{}, ErrAppealDecided
+	}
+
+	a.State = state
+	a.DecidedBy = actor
+	a.Decided = time.Now()
+
+	marker, err := json.Marshal(decision{State: a.State, DecidedBy: a.DecidedBy, Decided: a.Decided})
+	if err != nil {
+		return Appeal{}, err
+	}
+
+	if err := kv.Create(ctx, p.store.kv, decisionKeyPrefix+id, marker); errors.Is(err, kv.ErrKeyExists) {
+		return Appeal{}, ErrAppealDecided
+	} else if err != nil {
+		return Appeal{}, err
+	}
+
+	if err := p.decide(ctx, actor, a); err != nil {
+		// The decision wasn't saved, it can be made again
+		if err := p.store.kv.Delete(ctx, decisionKeyPrefix+id); err != nil {
+			log.Printf("Failed to release the decision of appeal %s: %v", id, err)
+		}
+
+		return Appeal{}, err
+	}
+
+	log.Printf("%s %s the appeal %s of %s", actor, state, a.ID, a.Name)
+
+	return a, p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "punishment.appeal." + decisionActions[state],
+		Target:  a.Player,
+		Details: map[string]string{"id": id, "punishment": a.Punishment},
+	})
+}
+
+// decide lifts the punishment of an approved appeal and saves the decision.
+func (p *PunishmentsPlugin) decide(ctx context.Context, actor string, a Appeal) error {
+	if a.State == AppealApproved {
+		if _, err := p.Lift(ctx, actor, a.Player, a.Punishment); err != nil && !errors.Is(err, ErrPunishmentNotFound) {
+			return err
+		}
+	}
+
+	return p.store.saveAppeal(ctx, a)
+}
+
+// onPostLogin tells the player about their decided appeals.
+func (p *PunishmentsPlugin) onPostLogin(e *proxy.PostLoginEvent) {
+	player := uuid.Normalize(e.Player().ID().String())
+
+	for _, a := range p.store.Appeals("") {
+		if a.Player != player || a.State == AppealPending || a.Notified {
+			continue
+		}
+
+		content, c := "Your appeal was approved, your punishment is lifted.", color.Green
+		if a.State == AppealDenied {
+			content, c = "Your appeal was denied.", color.Red
+		}
+		_ = e.Player().SendMessage(&Text{Content: content, S: Style{Color: c}})
+
+		a.Notified = true
+
+		ctx, cancel := context.WithTimeout(p.h.Context(), 5*time.Second)
+		if err := p.store.saveAppeal(ctx, a); err != nil {
+			log.Printf("Failed to mark the appeal %s as notified: %v", a.ID, err)
+		}
+		cancel()
+	}
+}
+
+type appealRequest struct {
+	// Player is a username or UUID, it must match the punishment
+	Player string `json:"player"`
+	// Code is the ID of the punishment shown to the player
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type decisionRequest struct {
+	// Actor is the staff member deciding, "api" by default
+	Actor   string `json:"actor"`
+	Comment string `json:"comment"`
+}
+
+func (p *PunishmentsPlugin) handleListAppeals(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.store.Appeals(r.URL.Query().Get("state")))
+}
+
+func (p *PunishmentsPlugin) handleGetAppeal(w http.ResponseWriter, r *http.Request) {
+	a, ok := p.store.Appeal(r.PathValue("id"))
+	if !ok {
+		api.WriteError(w, http.StatusNotFound, ErrAppealNotFound)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, a)
+}
+
+// handleCreateAppeal is called by the website players appeal on.
+func (p *PunishmentsPlugin) handleCreateAppeal(w http.ResponseWriter, r *http.Request) {
+	req := appealRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, _, err := p.resolve(r.Context(), req.Player)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	a, err := p.CreateAppeal(r.Context(), id, strings.ToLower(strings.TrimSpace(req.Code)), req.Message)
+	switch {
+	case errors.Is(err, ErrPunishmentNotFound):
+		api.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrNotAppealable), errors.Is(err, ErrAppealPending):
+		api.WriteError(w, http.StatusConflict, err)
+	case err != nil:
+		api.WriteError(w, http.StatusInternalServerError, err)
+	default:
+		api.WriteJSON(w, http.StatusCreated, a)
+	}
+}
+
+func (p *PunishmentsPlugin) handleCommentAppeal(w http.ResponseWriter, r *http.Request) {
+	comment := Comment{}
+	if err := api.ReadJSON(r, &comment); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if comment.Author == "" || comment.Text == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("author and text are required"))
+		return
+	}
+
+	a, err := p.CommentAppeal(r.Context(), r.PathValue("id"), comment)
+	if errors.Is(err, ErrAppealNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, a)
+}
+
+func (p *PunishmentsPlugin) handleDecideAppeal(state string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := decisionRequest{}
+		if err := api.ReadJSON(r, &req); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if req.Actor == "" {
+			req.Actor = "api"
+		}
+
+		id := r.PathValue("id")
+		if req.Comment != "" {
+			if _, err := p.CommentAppeal(r.Context(), id, Comment{Author: req.Actor, Text: req.Comment}); errors.Is(err, ErrAppealNotFound) {
+				api.WriteError(w, http.StatusNotFound, err)
+				return
+			} else if err != nil {
+				api.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		a, err := p.DecideAppeal(r.Context(), req.Actor, id, state)
+		switch {
+		case errors.Is(err, ErrAppealNotFound):
+			api.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrAppealDecided):
+			api.WriteError(w, http.StatusConflict, err)
+		case err != nil:
+			api.WriteError(w, http.StatusInternalServerError, err)
+		default:
+			api.WriteJSON(w, http.StatusOK, a)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package punishments
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+func actor(source command.Source) string {
+	if player, ok := source.(proxy.Player); ok {
+		return player.Username()
+	}
+
+	return "console"
+}
+
+func allowed(c *command.Context) bool {
+	if c.Source.HasPermission("csmc.punish") {
+		return true
+	}
+
+	_ = c.Source.SendMessage(&Text{Content: "You do not have permission to punish players.", S: Style{Color: color.Red}})
+	return false
+}
+
+// punishCommand issues the next step of the category's ladder:
+// /punish <player> <category>, or instead /punish <player> <category> mute
+// <minutes> and /punish <player> <category> ban [minutes].
+func (p *PunishmentsPlugin) punishCommand() brigodier.LiteralNodeBuilder {
+	punish := func(c *command.Context, override *Step) error {
+		if !allowed(c) {
+			return nil
+		}
+
+		id, name, err := p.resolve(c.Context, c.String("player"))
+		if err != nil {
+			return c.Source.SendMessage(&Text{Content: "Unknown player " + c.String("player") + ".", S: Style{Color: color.Red}})
+		}
+
+		category := parseCategory(c.String("category"))
+		if err := validateCategory(category); err != nil {
+			return c.Source.SendMessage(&Text{Content: err.Error(), S: Style{Color: color.Red}})
+		}
+
+		issued, err := p.Issue(c.Context, actor(c.Source), Punishment{Player: id, Name: name, Category: category}, override)
+		if err != nil {
+			return err
+		}
+
+		return c.Source.SendMessage(&Text{Content: "Issued a " + string(issued.Kind) + " to " + name + " " + until(issued) + " (" + issued.ID + ").", S: Style{Color: color.Green}})
+	}
+
+	return brigodier.Literal("punish").
+		Then(brigodier.Argument("player", brigodier.String).
+			Then(brigodier.Argument("category", brigodier.String).
+				Executes(command.Command(func(c *command.Context) error {
+					return punish(c, nil)
+				})).
+				Then(brigodier.Literal("mute").
+					Then(brigodier.Argument("minutes", brigodier.Int).
+						Executes(command.Command(func(c *command.Context) error {
+							return punish(c, &Step{Kind: KindMute, Minutes: max(1, c.Int("minutes"))})
+						})))).
+				Then(brigodier.Literal("ban").
+					Executes(command.Command(func(c *command.Context) error {
+						return punish(c, &Step{Kind: KindBan})
+					})).
+					Then(brigodier.Argument("minutes", brigodier.Int).
+						Executes(command.Command(func(c *command.Context) error {
+							return punish(c, &Step{Kind: KindBan, Minutes: max(1, c.Int("minutes"))})
+						}))))))
+}
+
+// unpunishCommand lifts the active punishments of a player.
+func (p *PunishmentsPlugin) unpunishCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("unpunish").
+		Then(brigodier.Argument("player", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				id, name, err := p.resolve(c.Context, c.String("player"))
+				if err != nil {
+					return c.Source.SendMessage(&Text{Content: "Unknown player " + c.String("player") + ".", S: Style{Color: color.Red}})
+				}
+
+				lifted := 0
+				for _, punishment := range p.store.Of(id) {
+					if !punishment.Active(time.Now()) {
+						continue
+					}
+
+					if _, err := p.Lift(c.Context, actor(c.Source), id, punishment.ID); err != nil {
+						return err
+					}
+					lifted++
+				}
+
+				if lifted == 0 {
+					return c.Source.SendMessage(&Text{Content: name + " has no active punishments.", S: Style{Color: color.Red}})
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Lifted the punishments of " + name + ".", S: Style{Color: color.Green}})
+			})))
+}
+
+// warnCommand warns a player: /warn <player> <category> <reason>.
+func (p *PunishmentsPlugin) warnCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("warn").
+		Then(brigodier.Argument("player", brigodier.String).
+			Then(brigodier.Argument("category", brigodier.String).
+				Then(brigodier.Argument("reason", brigodier.StringPhrase).
+					Executes(command.Command(func(c *command.Context) error {
+						if !allowed(c) {
+							return nil
+						}
+
+						id, name, err := p.resolve(c.Context, c.String("player"))
+						if err != nil {
+							return c.Source.SendMessage(&Text{Content: "Unknown player " + c.String("player") + ".", S: Style{Color: color.Red}})
+						}
+
+						category := parseCategory(c.String("category"))
+						if err := validateCategory(category); err != nil {
+							return c.Source.SendMessage(&Text{Content: err.Error(), S: Style{Color: color.Red}})
+						}
+
+						_, issued, err := p.Warn(c.Context, actor(c.Source), Warning{Player: id, Name: name, Category: category, Reason: c.String("reason")})
+						if err != nil {
+							return err
+						}
+
+						points := p.store.Points(id, category, time.Now())
+						content := fmt.Sprintf("Warned %s, %.1f of %.1f points in %s.", name, points, p.store.Ladder(category).threshold(), category)
+						if issued.ID != "" {
+							content = fmt.Sprintf("Warned %s and issued a %s %s for reaching the threshold of %s.", name, issued.Kind, until(issued), category)
+						}
+
+						return c.Source.SendMessage(&Text{Content: content, S: Style{Color: color.Green}})
+					})))))
+}
+
+// historyLimit is how many punishments, warnings and notes /history shows,
+// the most recent ones.
+const historyLimit = 10
+
+// historyCommand shows the punishments, warnings and notes of a player and
+// their points per category.
+func (p *PunishmentsPlugin) historyCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("history").
+		Then(brigodier.Argument("player", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				if !allowed(c) {
+					return nil
+				}
+
+				id, name, err := p.resolve(c.Context, c.String("player"))
+				if err != nil {
+					return c.Source.SendMessage(&Text{Content: "Unknown player " + c.String("player") + ".", S: Style{Color: color.Red}})
+				}
+
+				now := time.Now()
+				punishments, warnings, notes := p.store.Of(id), p.store.Warnings(id), p.store.Notes(id)
+				if len(punishments) == 0 && len(warnings) == 0 && len(notes) == 0 {
+					return c.Source.SendMessage(&Text{Content: name + " has a clean history.", S: Style{Color: color.Green}})
+				}
+
+				lines := []Component{&Text{Content: "History of " + name + ":", S: Style{Color: color.Gold}}}
+
+				// Pinned notes come first and are always shown
+				pinned := 0
+				for pinned < len(notes) && notes[pinned].Pinned {
+					lines = append(lines, noteLine(notes[pinned]))
+					pinned++
+				}
+				notes = notes[pinned:]
+				for _, n := range notes[max(0, len(notes)-historyLimit):] {
+					lines = append(lines, noteLine(n))
+				}
+
+				for _, punishment := range punishments[max(0, len(punishments)-historyLimit):] {
+					state := "over"
+					if punishment.Lifted {
+						state = "lifted"
+					} else if punishment.Active(now) {
+						state = "active"
+					}
+
+					line := fmt.Sprintf("\n%s %s for %s by %s (%s)", punishment.Issued.Format(time.DateOnly), punishment.Kind, punishment.Category, punishment.Actor, state)
+					if punishment.Reason != "" {
+						line += ": " + punishment.Reason
+					}
+					lines = append(lines, &Text{Content: line, S: Style{Color: color.Red}})
+				}
+
+				for _, w := range warnings[max(0, len(warnings)-historyLimit):] {
+					lines = append(lines, &Text{
+						Content: fmt.Sprintf("\n%s warning for %s by %s: %s", w.Issued.Format(time.DateOnly), w.Category, w.Actor, w.Reason),
+						S:       Style{Color: color.Yellow},
+					})
+				}
+				categories := make([]string, 0)
+				for _, w := range warnings {
+					if !slices.Contains(categories, w.Category) {
+						categories = append(categories, w.Category)
+					}
+				}
+
+				slices.Sort(categories)
+				for _, category := range categories {
+					lines = append(lines, &Text{
+						Content: fmt.Sprintf("\n%.1f of %.1f points in %s", p.store.Points(id, category, now), p.store.Ladder(category).threshold(), category),
+						S:       Style{Color: color.Gray},
+					})
+				}
+
+				return c.Source.SendMessage(&Text{Extra: lines})
+			})))
+}
@@ -0,0 +1,111 @@
+package punishments
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+type playerRecords struct {
+	Punishments []Punishment `json:"punishments,omitempty"`
+	Warnings    []Warning    `json:"warnings,omitempty"`
+	Appeals     []Appeal     `json:"appeals,omitempty"`
+	Notes       []Note       `json:"notes,omitempty"`
+}
+
+// registerGDPR exports and erases the records of a player. Erasing keeps
+// punishments that are still in force, or were issued within legalHold, and
+// their appeals, those are kept to enforce and defend them.
+func (p *PunishmentsPlugin) registerGDPR(legalHold time.Duration) {
+	p.h.GDPR().Register("punishments", gdpr.Subsystem{
+		Export: func(ctx context.Context, player string) (any, error) {
+			r := playerRecords{
+				Punishments: p.store.Of(player),
+				Warnings:    p.store.Warnings(player),
+				Appeals:     p.store.appealsOf(player),
+				Notes:       p.store.Notes(player),
+			}
+			if len(r.Punishments)+len(r.Warnings)+len(r.Appeals)+len(r.Notes) == 0 {
+				return nil, nil
+			}
+
+			return r, nil
+		},
+		Erase: func(ctx context.Context, player string) (gdpr.Erasure, error) {
+			return p.store.erase(ctx, player, func(pun Punishment, now time.Time) string {
+				if pun.Active(now) {
+					return "punishment is in force"
+				}
+
+				if until := pun.Issued.Add(legalHold); now.Before(until) {
+					return "legal hold until " + until.Format(time.DateOnly)
+				}
+
+				return ""
+			})
+		},
+	})
+}
+
+func (s *Store) appealsOf(player string) []Appeal {
+	list := make([]Appeal, 0)
+	for _, a := range s.Appeals("") {
+		if a.Player == player {
+			list = append(list, a)
+		}
+	}
+
+	return list
+}
+
+// erase deletes the records of the player. Punishments held returns a reason
+// for are kept, and so are their appeals.
+func (s *Store) erase(ctx context.Context, player string, held func(p Punishment, now time.Time) string) (gdpr.Erasure, error) {
+	now := time.Now()
+	e := gdpr.Erasure{}
+
+	var keys []string
+	kept := make(map[string]bool)
+	for _, p := range s.Of(player) {
+		if reason := held(p, now); reason != "" {
+			e.Kept = append(e.Kept, gdpr.Hold{ID: "punishment." + p.ID, Reason: reason})
+			kept[p.ID] = true
+			continue
+		}
+
+		keys = append(keys, p.key())
+	}
+
+	for _, a := range s.appealsOf(player) {
+		if kept[a.Punishment] {
+			e.Kept = append(e.Kept, gdpr.Hold{ID: "appeal." + a.ID, Reason: "appeal of a kept punishment"})
+			continue
+		}
+
+		keys = append(keys, appealKeyPrefix+a.ID, decisionKeyPrefix+a.ID)
+	}
+
+	for _, w := range s.Warnings(player) {
+		keys = append(keys, w.key())
+	}
+
+	for _, n := range s.Notes(player) {
+		keys = append(keys, n.key())
+	}
+
+	for _, key := range keys {
+		if err := s.kv.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return e, err
+		}
+
+		// Deletes of other proxies come through the watch, ours are applied
+		// right away
+		s.handleChange(&kv.Value{Key: key, Operation: kv.Delete})
+		e.Erased++
+	}
+
+	return e, nil
+}
@@ -0,0 +1,60 @@
+package punishments
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/graphql"
+)
+
+// registerGraphQL adds the punishments, warnings and notes of a player to
+// the Player object of the GraphQL schema.
+func (p *PunishmentsPlugin) registerGraphQL() {
+	s := p.h.GraphQL()
+	player := s.Object("Player")
+
+	player.Field("punishments", graphql.Field{
+		Type:        s.Object("Punishment"),
+		List:        true,
+		Args:        []string{"active"},
+		Description: "The punishments of the player, only those in effect with active: true",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			punishments := p.store.Of(source.(hosting.GraphQLPlayer).UUID)
+			if args.Bool("active") {
+				now := time.Now()
+				punishments = slices.DeleteFunc(punishments, func(pun Punishment) bool { return !pun.Active(now) })
+			}
+
+			return punishments, nil
+		},
+	})
+	player.Field("warnings", graphql.Field{
+		Type: s.Object("Warning"),
+		List: true,
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			return p.store.Warnings(source.(hosting.GraphQLPlayer).UUID), nil
+		},
+	})
+	player.Field("notes", graphql.Field{
+		Type:        s.Object("Note"),
+		List:        true,
+		Description: "The staff notes of the player, pinned first",
+		Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			return p.store.Notes(source.(hosting.GraphQLPlayer).UUID), nil
+		},
+	})
+
+	for _, name := range []string{"id", "category", "kind", "reason", "actor", "report", "issued", "until", "permanent", "lifted"} {
+		s.Object("Punishment").Field(name, graphql.Field{})
+	}
+
+	for _, name := range []string{"id", "category", "reason", "actor", "points", "issued", "spent"} {
+		s.Object("Warning").Field(name, graphql.Field{})
+	}
+
+	for _, name := range []string{"id", "author", "text", "pinned", "created"} {
+		s.Object("Note").Field(name, graphql.Field{})
+	}
+}
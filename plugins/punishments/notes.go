@@ -0,0 +1,359 @@
+package punishments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+const noteKeyPrefix = "note."
+
+var ErrNoteNotFound = errors.New("note not found")
+
+const (
+	// NotesOnJoinPinned shows staff the pinned notes of players joining
+	NotesOnJoinPinned = "pinned"
+	// NotesOnJoinAll shows staff every note of players joining
+	NotesOnJoinAll = "all"
+	NotesOnJoinOff = "off"
+)
+
+// Note is what staff want each other to know about a player, like a
+// suspicion that doesn't warrant a warning yet. Pinned notes come first.
+type Note struct {
+	ID string `json:"id"`
+	// Player is the undashed UUID
+	Player  string    `json:"player"`
+	Name    string    `json:"name"`
+	Author  string    `json:"author"`
+	Text    string    `json:"text"`
+	Pinned  bool      `json:"pinned,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func (n Note) key() string {
+	return noteKeyPrefix + n.Player + "." + n.ID
+}
+
+// Matches reports whether the text, name or author of the note contain the
+// query, ignoring case.
+func (n Note) Matches(query string) bool {
+	query = strings.ToLower(query)
+
+	for _, field := range []string{n.Text, n.Name, n.Author} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// putNote must be called with the lock held.
+func (s *Store) putNote(n Note) {
+	if s.notes[n.Player] == nil {
+		s.notes[n.Player] = make(map[string]Note)
+	}
+
+	s.notes[n.Player][n.ID] = n
+}
+
+func sortNotes(list []Note) {
+	slices.SortFunc(list, func(a, b Note) int {
+		if a.Pinned != b.Pinned {
+			if a.Pinned {
+				return -1
+			}
+			return 1
+		}
+
+		return a.Created.Compare(b.Created)
+	})
+}
+
+// Notes returns the notes of the player, pinned ones first, oldest first.
+func (s *Store) Notes(player string) []Note {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Note, 0, len(s.notes[player]))
+	for _, n := range s.notes[player] {
+		list = append(list, n)
+	}
+	sortNotes(list)
+
+	return list
+}
+
+// SearchNotes returns the notes of all players matching the query, pinned
+// ones first. An empty query matches every note.
+func (s *Store) SearchNotes(query string) []Note {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Note, 0)
+	for _, notes := range s.notes {
+		for _, n := range notes {
+			if n.Matches(query) {
+				list = append(list, n)
+			}
+		}
+	}
+	sortNotes(list)
+
+	return list
+}
+
+func (s *Store) saveNote(ctx context.Context, n Note) error {
+	raw, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	if err := s.kv.Set(ctx, n.key(), raw); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.putNote(n)
+	s.m.Unlock()
+
+	return nil
+}
+
+// AddNote stores a note about the player by the actor.
+func (p *PunishmentsPlugin) AddNote(ctx context.Context, actor string, n Note) (Note, error) {
+	if strings.TrimSpace(n.Text) == "" {
+		return Note{}, errors.New("a note needs text")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Note{}, err
+	}
+
+	n.ID, n.Author, n.Created = id, actor, time.Now()
+	if err := p.store.saveNote(ctx, n); err != nil {
+		return Note{}, err
+	}
+
+	p.h.Tracef(n.Player, "punishments: note %s by %s", n.ID, actor)
+
+	return n, p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "punishment.note",
+		Target:  n.Player,
+		Details: map[string]string{"id": n.ID, "text": n.Text},
+	})
+}
+
+// PinNote pins or unpins a note of the player.
+func (p *PunishmentsPlugin) PinNote(ctx context.Context, actor, player, id string, pinned bool) (Note, error) {
+	p.store.m.RLock()
+	n, ok := p.store.notes[player][id]
+	p.store.m.RUnlock()
+
+	if !ok {
+		return Note{}, ErrNoteNotFound
+	}
+
+	n.Pinned = pinned
+	if err := p.store.saveNote(ctx, n); err != nil {
+		return Note{}, err
+	}
+
+	action := "punishment.note.pin"
+	if !pinned {
+		action = "punishment.note.unpin"
+	}
+
+	return n, p.h.Audit().Record(ctx, audit.Entry{Actor: actor, Action: action, Target: player, Details: map[string]string{"id": id}})
+}
+
+func noteLine(n Note) Component {
+	content := fmt.Sprintf("\n%s note by %s (%s): %s", n.Created.Format(time.DateOnly), n.Author, n.ID, n.Text)
+	c := color.Aqua
+	if n.Pinned {
+		content = fmt.Sprintf("\n%s pinned note by %s (%s): %s", n.Created.Format(time.DateOnly), n.Author, n.ID, n.Text)
+		c = color.LightPurple
+	}
+
+	return &Text{Content: content, S: Style{Color: c}}
+}
+
+// showNotes tells the staff on this proxy about the notes of a player that
+// joined, the pinned ones or all of them depending on notesOnJoin.
+func (p *PunishmentsPlugin) showNotes(e *proxy.PostLoginEvent) {
+	if p.notesOnJoin == NotesOnJoinOff {
+		return
+	}
+
+	notes := p.store.Notes(uuid.Normalize(e.Player().ID().String()))
+	if p.notesOnJoin != NotesOnJoinAll {
+		notes = slices.DeleteFunc(notes, func(n Note) bool { return !n.Pinned })
+	}
+
+	if len(notes) == 0 {
+		return
+	}
+
+	lines := []Component{&Text{Content: e.Player().Username() + " joined, notes:", S: Style{Color: color.Gold}}}
+	for _, n := range notes[max(0, len(notes)-historyLimit):] {
+		lines = append(lines, noteLine(n))
+	}
+	msg := &Text{Extra: lines}
+
+	for _, staff := range p.prx.Players() {
+		if staff != e.Player() && staff.HasPermission("csmc.punish") {
+			_ = staff.SendMessage(msg)
+		}
+	}
+}
+
+// noteCommand adds notes: /note <player> <text>, and pins them: /note pin
+// <player> <id> and /note unpin <player> <id>.
+func (p *PunishmentsPlugin) noteCommand() brigodier.LiteralNodeBuilder {
+	pin := func(pinned bool) brigodier.Command {
+		return command.Command(func(c *command.Context) error {
+			if !allowed(c) {
+				return nil
+			}
+
+			id, name, err := p.resolve(c.Context, c.String("player"))
+			if err != nil {
+				return c.Source.SendMessage(&Text{Content: "Unknown player " + c.String("player") + ".", S: Style{Color: color.Red}})
+			}
+
+			if _, err := p.PinNote(c.Context, actor(c.Source), id, c.String("id"), pinned); errors.Is(err, ErrNoteNotFound) {
+				return c.Source.SendMessage(&Text{Content: name + " has no note " + c.String("id") + ".", S: Style{Color: color.Red}})
+			} else if err != nil {
+				return err
+			}
+
+			content := "Pinned the note " + c.String("id") + " of " + name + "."
+			if !pinned {
+				content = "Unpinned the note " + c.String("id") + " of " + name + "."
+			}
+
+			return c.Source.SendMessage(&Text{Content: content, S: Style{Color: color.Green}})
+		})
+	}
+
+	return brigodier.Literal("note").
+		Then(brigodier.Literal("pin").
+			Then(brigodier.Argument("player", brigodier.String).
+				Then(brigodier.Argument("id", brigodier.String).Executes(pin(true))))).
+		Then(brigodier.Literal("unpin").
+			Then(brigodier.Argument("player", brigodier.String).
+				Then(brigodier.Argument("id", brigodier.String).Executes(pin(false))))).
+		Then(brigodier.Argument("player", brigodier.String).
+			Then(brigodier.Argument("text", brigodier.StringPhrase).
+				Executes(command.Command(func(c *command.Context) error {
+					if !allowed(c) {
+						return nil
+					}
+
+					id, name, err := p.resolve(c.Context, c.String("player"))
+					if err != nil {
+						return c.Source.SendMessage(&Text{Content: "Unknown player " + c.String("player") + ".", S: Style{Color: color.Red}})
+					}
+
+					n, err := p.AddNote(c.Context, actor(c.Source), Note{Player: id, Name: name, Text: c.String("text")})
+					if err != nil {
+						return err
+					}
+
+					return c.Source.SendMessage(&Text{Content: "Added the note " + n.ID + " to " + name + ".", S: Style{Color: color.Green}})
+				}))))
+}
+
+type noteRequest struct {
+	// Author is the staff member writing the note, "api" by default
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+func (p *PunishmentsPlugin) handleSearchNotes(w http.ResponseWriter, r *http.Request) {
+	notes := p.store.SearchNotes(r.URL.Query().Get("q"))
+	if r.URL.Query().Get("pinned") == "true" {
+		notes = slices.DeleteFunc(notes, func(n Note) bool { return !n.Pinned })
+	}
+
+	api.WriteJSON(w, http.StatusOK, notes)
+}
+
+func (p *PunishmentsPlugin) handleListNotes(w http.ResponseWriter, r *http.Request) {
+	id, _, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, p.store.Notes(id))
+}
+
+func (p *PunishmentsPlugin) handleAddNote(w http.ResponseWriter, r *http.Request) {
+	req := noteRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.TrimSpace(req.Text) == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("a note needs text"))
+		return
+	}
+
+	if req.Author == "" {
+		req.Author = "api"
+	}
+
+	id, name, err := p.resolve(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	n, err := p.AddNote(r.Context(), req.Author, Note{Player: id, Name: name, Text: req.Text})
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, n)
+}
+
+func (p *PunishmentsPlugin) handlePinNote(pinned bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _, err := p.resolve(r.Context(), r.PathValue("player"))
+		if err != nil {
+			api.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+
+		n, err := p.PinNote(r.Context(), "api", id, r.PathValue("id"), pinned)
+		if errors.Is(err, ErrNoteNotFound) {
+			api.WriteError(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		api.WriteJSON(w, http.StatusOK, n)
+	}
+}
@@ -0,0 +1,252 @@
+// Package punishments mutes and bans players along escalation ladders: the
+// offenses of a category, like chat or cheating, get harsher punishments
+// the more often a player commits them. The chat filter punishes blocked
+// words on its own, staff and report tools issue through /punish and the
+// API and may pick the punishment themselves.
+package punishments
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/chat"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var issuedTotal = metrics.NewCounterVec("gate_punishments_issued_total", "Punishments issued, by kind and whether staff overrode the ladder.", "kind", "override")
+
+type PunishmentsPlugin struct {
+	h     *hosting.Hosting
+	prx   *proxy.Proxy
+	store *Store
+	// notesOnJoin is which notes staff see when a player joins, pinned, all
+	// or off
+	notesOnJoin string
+}
+
+func New(h *hosting.Hosting, c *chat.Chat) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Punishments",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_punishments")
+			if err != nil {
+				return err
+			}
+
+			p := &PunishmentsPlugin{h: h, prx: prx, notesOnJoin: strings.ToLower(util.EnvWithDefault("NOTES_ON_JOIN", NotesOnJoinPinned))}
+			p.store = NewStore(bucket, p.enforce)
+
+			return p.Init(prx, bucket, c)
+		},
+	}, nil
+}
+
+func (p *PunishmentsPlugin) Init(prx *proxy.Proxy, bucket kv.Bucket, c *chat.Chat) error {
+	p.h.Go("Punishments", func(ctx context.Context) {
+		kv.Watch(ctx, bucket, p.store.handleChange, p.store.Reload)
+	})
+
+	p.h.OnReload("Punishments", p.store.Reload)
+	p.h.Warmup("punishments", hosting.WarmupFailClosed, p.store.Reload)
+
+	c.Use("mutes", p.filterMuted)
+	c.OnOffense(p.onOffense)
+
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Punishments", p.onLogin))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Punishments", p.onPostLogin))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Punishments", p.showNotes))
+	prx.Command().Register(p.punishCommand())
+	prx.Command().Register(p.unpunishCommand())
+	prx.Command().Register(p.warnCommand())
+	prx.Command().Register(p.historyCommand())
+	prx.Command().Register(p.noteCommand())
+	p.registerAPI()
+	p.registerGraphQL()
+	p.registerGDPR(util.EnvDurationWithDefault("PUNISHMENT_LEGAL_HOLD", 0))
+
+	return nil
+}
+
+// Issue punishes the player, given by undashed UUID, for an offense of the
+// category. The step of the ladder applies unless override is set.
+func (p *PunishmentsPlugin) Issue(ctx context.Context, actor string, punishment Punishment, override *Step) (Punishment, error) {
+	step := p.store.Next(punishment.Player, punishment.Category)
+	if override != nil {
+		step = *override
+	}
+
+	punishment.Actor = actor
+	issued, err := p.store.Issue(ctx, punishment, step)
+	if err != nil {
+		return Punishment{}, err
+	}
+
+	issuedTotal.Inc(string(issued.Kind), strconv.FormatBool(override != nil))
+	log.Printf("%s issued a %s to %s for %s: %s", actor, step, issued.Name, issued.Category, issued.Reason)
+	p.h.Tracef(issued.Player, "punishments: %s for %s by %s", step, issued.Category, actor)
+	p.enforce(issued)
+
+	details := map[string]string{"id": issued.ID, "category": issued.Category, "step": step.String(), "reason": issued.Reason}
+	if override != nil {
+		details["override"] = "true"
+	}
+	if issued.Report != "" {
+		details["report"] = issued.Report
+	}
+
+	return issued, p.h.Audit().Record(ctx, audit.Entry{Actor: actor, Action: "punishment.issue", Target: issued.Player, Details: details})
+}
+
+func (p *PunishmentsPlugin) Lift(ctx context.Context, actor, player, id string) (Punishment, error) {
+	lifted, err := p.store.Lift(ctx, player, id)
+	if err != nil {
+		return Punishment{}, err
+	}
+
+	return lifted, p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   actor,
+		Action:  "punishment.lift",
+		Target:  player,
+		Details: map[string]string{"id": id, "kind": string(lifted.Kind)},
+	})
+}
+
+// player returns the online player with the undashed UUID.
+func (p *PunishmentsPlugin) player(id string) proxy.Player {
+	for _, player := range p.prx.Players() {
+		if uuid.Normalize(player.ID().String()) == id {
+			return player
+		}
+	}
+
+	return nil
+}
+
+// enforce applies a punishment to the player if they are on this proxy, it
+// runs for those of other proxies too.
+func (p *PunishmentsPlugin) enforce(punishment Punishment) {
+	player := p.player(punishment.Player)
+	if player == nil || !punishment.Active(time.Now()) {
+		return
+	}
+
+	switch punishment.Kind {
+	case KindBan:
+		if p.h.Enforce("Punishments", "banned", player.Username()) {
+			player.Disconnect(notice(punishment))
+		}
+	case KindMute:
+		_ = player.SendMessage(notice(punishment))
+	}
+}
+
+func until(punishment Punishment) string {
+	if punishment.Permanent {
+		return "permanently"
+	}
+
+	return "until " + punishment.Until.Format(time.RFC1123)
+}
+
+// notice tells the player about their punishment.
+func notice(punishment Punishment) Component {
+	content := "You are banned " + until(punishment)
+	if punishment.Kind == KindMute {
+		content = "You are muted " + until(punishment)
+	}
+
+	if punishment.Reason != "" {
+		content += ": " + punishment.Reason
+	}
+
+	return &Text{Content: content + ". Appeal with the code " + punishment.ID + ".", S: Style{Color: color.Red}}
+}
+
+func warningNotice(w Warning) Component {
+	return &Text{Content: "You were warned: " + w.Reason, S: Style{Color: color.Gold}}
+}
+
+func (p *PunishmentsPlugin) onLogin(e *proxy.LoginEvent) {
+	id := uuid.Normalize(e.Player().ID().String())
+
+	ban, ok := p.store.Active(id, KindBan, time.Now())
+	if !ok {
+		return
+	}
+
+	p.h.Tracef(e.Player().Username(), "punishments: banned %s (%s)", until(ban), ban.ID)
+	if p.h.Enforce("Punishments", "banned", e.Player().Username()) {
+		e.Deny(notice(ban))
+	}
+}
+
+// filterMuted drops the messages of muted players.
+func (p *PunishmentsPlugin) filterMuted(player proxy.Player, message string) (string, bool) {
+	mute, ok := p.store.Active(uuid.Normalize(player.ID().String()), KindMute, time.Now())
+	if !ok || !p.h.Enforce("Punishments", "muted", player.Username()) {
+		return message, true
+	}
+
+	_ = player.SendMessage(notice(mute))
+
+	return "", false
+}
+
+// onOffense punishes what the chat filters caught. Muted players can't be
+// caught again until their mute is over, one message shouldn't climb the
+// whole ladder.
+func (p *PunishmentsPlugin) onOffense(player proxy.Player, category, reason string) {
+	id := uuid.Normalize(player.ID().String())
+	if _, ok := p.store.Active(id, KindMute, time.Now()); ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.h.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := p.Issue(ctx, "chat", Punishment{Player: id, Name: player.Username(), Category: category, Reason: reason}, nil)
+	if err != nil {
+		log.Printf("Failed to punish %s for %s: %v", player.Username(), category, err)
+	}
+}
+
+// resolve returns the undashed UUID and name of a player given by name or
+// UUID, online or not.
+func (p *PunishmentsPlugin) resolve(ctx context.Context, player string) (string, string, error) {
+	if online := p.prx.PlayerByName(player); online != nil {
+		return uuid.Normalize(online.ID().String()), online.Username(), nil
+	}
+
+	if id := uuid.Normalize(player); len(id) == 32 {
+		profile, err := p.h.Profiles().ByUUID(ctx, id)
+		if err != nil {
+			return "", "", err
+		}
+
+		return id, profile.Name, nil
+	}
+
+	profile, err := p.h.Profiles().ByName(ctx, player)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uuid.Normalize(profile.ID), profile.Name, nil
+}
+
+// parseCategory lowercases the category, they are keys of the ladders.
+func parseCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
@@ -0,0 +1,592 @@
+package punishments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+const (
+	ladderKeyPrefix     = "ladder."
+	punishmentKeyPrefix = "punishment."
+	warningKeyPrefix    = "warning."
+)
+
+var keyPrefixes = []string{ladderKeyPrefix, punishmentKeyPrefix, warningKeyPrefix, appealKeyPrefix, noteKeyPrefix}
+
+var (
+	ErrLadderNotFound     = errors.New("ladder not found")
+	ErrPunishmentNotFound = errors.New("punishment not found")
+)
+
+type Kind string
+
+const (
+	KindMute Kind = "mute"
+	KindBan  Kind = "ban"
+)
+
+// Step is a rung of a ladder, or what staff issue instead of it. A step
+// without minutes lasts until it is lifted.
+type Step struct {
+	Kind    Kind `json:"kind"`
+	Minutes int  `json:"minutes,omitempty"`
+}
+
+func (s Step) Validate() error {
+	if s.Kind != KindMute && s.Kind != KindBan {
+		return fmt.Errorf("invalid kind %q, expected mute or ban", s.Kind)
+	}
+
+	if s.Minutes < 0 {
+		return errors.New("minutes must not be negative")
+	}
+
+	return nil
+}
+
+func (s Step) String() string {
+	if s.Minutes == 0 {
+		return "permanent " + string(s.Kind)
+	}
+
+	return fmt.Sprintf("%s for %s", s.Kind, time.Duration(s.Minutes)*time.Minute)
+}
+
+// defaultSteps apply to categories without a ladder of their own.
+var defaultSteps = []Step{
+	{Kind: KindMute, Minutes: 60},
+	{Kind: KindMute, Minutes: 24 * 60},
+	{Kind: KindBan, Minutes: 7 * 24 * 60},
+}
+
+// Ladder is what the offenses of a category escalate through: the first
+// offense gets the first step, the second the second and so on. Offenses
+// beyond the last step repeat it.
+type Ladder struct {
+	Category string `json:"category"`
+	Steps    []Step `json:"steps"`
+	// Points is what a warning in the category is worth, 1 by default
+	Points float64 `json:"points,omitempty"`
+	// Threshold is how many points make an offense, 3 by default
+	Threshold float64 `json:"threshold,omitempty"`
+	// DecayMinutes is how long it takes the points of a warning to fade
+	// to nothing, 30 days by default
+	DecayMinutes int `json:"decayMinutes,omitempty"`
+}
+
+// validateCategory rejects categories that can't be part of a KV key.
+func validateCategory(category string) error {
+	if category == "" || strings.ContainsAny(category, ". ") {
+		return fmt.Errorf("invalid category %q", category)
+	}
+
+	return nil
+}
+
+func (l Ladder) Validate() error {
+	if err := validateCategory(l.Category); err != nil {
+		return err
+	}
+
+	if len(l.Steps) == 0 {
+		return errors.New("a ladder needs at least one step")
+	}
+
+	if l.Points < 0 || l.Threshold < 0 || l.DecayMinutes < 0 {
+		return errors.New("points, threshold and decay must not be negative")
+	}
+
+	for i, s := range l.Steps {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// step returns the step of the offense, counting from 0.
+func (l Ladder) step(offense int) Step {
+	return l.Steps[min(offense, len(l.Steps)-1)]
+}
+
+type Punishment struct {
+	ID string `json:"id"`
+	// Player is the undashed UUID
+	Player   string `json:"player"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Kind     Kind   `json:"kind"`
+	Reason   string `json:"reason,omitempty"`
+	Actor    string `json:"actor"`
+	// Report is the ID of the report this resolved, if any
+	Report string    `json:"report,omitempty"`
+	Issued time.Time `json:"issued"`
+	// Until is ignored for permanent punishments
+	Until     time.Time `json:"until"`
+	Permanent bool      `json:"permanent,omitempty"`
+	// Lifted punishments are over and don't count towards the ladder
+	Lifted bool `json:"lifted,omitempty"`
+}
+
+func (p Punishment) Active(now time.Time) bool {
+	return !p.Lifted && (p.Permanent || now.Before(p.Until))
+}
+
+func (p Punishment) key() string {
+	return punishmentKeyPrefix + p.Player + "." + p.ID
+}
+
+// Store keeps the ladders and the punishments of all players in memory.
+// Every punishment has a key of its own, so proxies punishing the same
+// player at once don't overwrite each other.
+type Store struct {
+	kv      kv.Bucket
+	ladders map[string]Ladder
+	// byPlayer maps undashed UUIDs to the punishments by ID
+	byPlayer map[string]map[string]Punishment
+	// warnings maps undashed UUIDs to the warnings by ID
+	warnings map[string]map[string]Warning
+	appeals  map[string]Appeal
+	// notes maps undashed UUIDs to the notes by ID
+	notes map[string]map[string]Note
+	// onChange is called with punishments other proxies issued or lifted
+	onChange func(Punishment)
+	m        sync.RWMutex
+}
+
+func NewStore(bucket kv.Bucket, onChange func(Punishment)) *Store {
+	return &Store{
+		kv:       bucket,
+		ladders:  make(map[string]Ladder),
+		byPlayer: make(map[string]map[string]Punishment),
+		warnings: make(map[string]map[string]Warning),
+		appeals:  make(map[string]Appeal),
+		notes:    make(map[string]map[string]Note),
+		onChange: onChange,
+	}
+}
+
+func (s *Store) Reload(ctx context.Context) error {
+	keys, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	ladders := make(map[string]Ladder)
+	byPlayer := make(map[string]map[string]Punishment)
+	warnings := make(map[string]map[string]Warning)
+	appeals := make(map[string]Appeal)
+	notes := make(map[string]map[string]Note)
+	for _, key := range keys {
+		if !slices.ContainsFunc(keyPrefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+			continue
+		}
+
+		raw, err := s.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(key, ladderKeyPrefix) {
+			l := Ladder{}
+			if err := json.Unmarshal(raw, &l); err != nil {
+				log.Printf("Failed to unmarshal ladder %s: %v", key, err)
+				continue
+			}
+
+			ladders[l.Category] = l
+			continue
+		}
+
+		if strings.HasPrefix(key, warningKeyPrefix) {
+			w := Warning{}
+			if err := json.Unmarshal(raw, &w); err != nil {
+				log.Printf("Failed to unmarshal warning %s: %v", key, err)
+				continue
+			}
+
+			if warnings[w.Player] == nil {
+				warnings[w.Player] = make(map[string]Warning)
+			}
+			warnings[w.Player][w.ID] = w
+			continue
+		}
+
+		if strings.HasPrefix(key, appealKeyPrefix) {
+			a := Appeal{}
+			if err := json.Unmarshal(raw, &a); err != nil {
+				log.Printf("Failed to unmarshal appeal %s: %v", key, err)
+				continue
+			}
+
+			appeals[a.ID] = a
+			continue
+		}
+
+		if strings.HasPrefix(key, noteKeyPrefix) {
+			n := Note{}
+			if err := json.Unmarshal(raw, &n); err != nil {
+				log.Printf("Failed to unmarshal note %s: %v", key, err)
+				continue
+			}
+
+			if notes[n.Player] == nil {
+				notes[n.Player] = make(map[string]Note)
+			}
+			notes[n.Player][n.ID] = n
+			continue
+		}
+
+		p := Punishment{}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			log.Printf("Failed to unmarshal punishment %s: %v", key, err)
+			continue
+		}
+
+		if byPlayer[p.Player] == nil {
+			byPlayer[p.Player] = make(map[string]Punishment)
+		}
+		byPlayer[p.Player][p.ID] = p
+	}
+
+	s.m.Lock()
+	s.ladders = ladders
+	s.byPlayer = byPlayer
+	s.warnings = warnings
+	s.appeals = appeals
+	s.notes = notes
+	s.m.Unlock()
+
+	return nil
+}
+
+func (s *Store) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(v.Key, ladderKeyPrefix):
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		category := strings.TrimPrefix(v.Key, ladderKeyPrefix)
+		if v.Operation == kv.Delete {
+			delete(s.ladders, category)
+			return
+		}
+
+		l := Ladder{}
+		if err := json.Unmarshal(v.Value, &l); err != nil {
+			log.Printf("Failed to unmarshal ladder %s: %v", v.Key, err)
+			return
+		}
+
+		s.ladders[category] = l
+
+	case strings.HasPrefix(v.Key, punishmentKeyPrefix):
+		if v.Operation == kv.Delete {
+			player, id, _ := strings.Cut(strings.TrimPrefix(v.Key, punishmentKeyPrefix), ".")
+
+			s.m.Lock()
+			delete(s.byPlayer[player], id)
+			s.m.Unlock()
+			return
+		}
+
+		p := Punishment{}
+		if err := json.Unmarshal(v.Value, &p); err != nil {
+			log.Printf("Failed to unmarshal punishment %s: %v", v.Key, err)
+			return
+		}
+
+		s.m.Lock()
+		old, known := s.byPlayer[p.Player][p.ID]
+		s.put(p)
+		s.m.Unlock()
+
+		if (!known || old.Lifted != p.Lifted) && s.onChange != nil {
+			s.onChange(p)
+		}
+
+	case strings.HasPrefix(v.Key, warningKeyPrefix):
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		if v.Operation == kv.Delete {
+			player, id, _ := strings.Cut(strings.TrimPrefix(v.Key, warningKeyPrefix), ".")
+			delete(s.warnings[player], id)
+			return
+		}
+
+		w := Warning{}
+		if err := json.Unmarshal(v.Value, &w); err != nil {
+			log.Printf("Failed to unmarshal warning %s: %v", v.Key, err)
+			return
+		}
+
+		s.putWarning(w)
+
+	case strings.HasPrefix(v.Key, appealKeyPrefix):
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		if v.Operation == kv.Delete {
+			delete(s.appeals, strings.TrimPrefix(v.Key, appealKeyPrefix))
+			return
+		}
+
+		a := Appeal{}
+		if err := json.Unmarshal(v.Value, &a); err != nil {
+			log.Printf("Failed to unmarshal appeal %s: %v", v.Key, err)
+			return
+		}
+
+		s.putAppeal(a)
+
+	case strings.HasPrefix(v.Key, noteKeyPrefix):
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		if v.Operation == kv.Delete {
+			player, id, _ := strings.Cut(strings.TrimPrefix(v.Key, noteKeyPrefix), ".")
+			delete(s.notes[player], id)
+			return
+		}
+
+		n := Note{}
+		if err := json.Unmarshal(v.Value, &n); err != nil {
+			log.Printf("Failed to unmarshal note %s: %v", v.Key, err)
+			return
+		}
+
+		s.putNote(n)
+	}
+}
+
+// put must be called with the lock held.
+func (s *Store) put(p Punishment) {
+	if s.byPlayer[p.Player] == nil {
+		s.byPlayer[p.Player] = make(map[string]Punishment)
+	}
+
+	s.byPlayer[p.Player][p.ID] = p
+}
+
+// Ladder returns the ladder of the category, the default one if it has none.
+func (s *Store) Ladder(category string) Ladder {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if l, ok := s.ladders[category]; ok {
+		return l
+	}
+
+	return Ladder{Category: category, Steps: defaultSteps}
+}
+
+func (s *Store) Ladders() []Ladder {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Ladder, 0, len(s.ladders))
+	for _, l := range s.ladders {
+		list = append(list, l)
+	}
+
+	slices.SortFunc(list, func(a, b Ladder) int {
+		return strings.Compare(a.Category, b.Category)
+	})
+
+	return list
+}
+
+func (s *Store) SetLadder(ctx context.Context, l Ladder) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	if err := s.kv.Set(ctx, ladderKeyPrefix+l.Category, raw); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.ladders[l.Category] = l
+	s.m.Unlock()
+
+	return nil
+}
+
+func (s *Store) DeleteLadder(ctx context.Context, category string) error {
+	if err := s.kv.Delete(ctx, ladderKeyPrefix+category); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrLadderNotFound
+	} else if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	delete(s.ladders, category)
+	s.m.Unlock()
+
+	return nil
+}
+
+// Of returns the punishments of the player, given by undashed UUID, oldest
+// first.
+func (s *Store) Of(player string) []Punishment {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Punishment, 0, len(s.byPlayer[player]))
+	for _, p := range s.byPlayer[player] {
+		list = append(list, p)
+	}
+
+	slices.SortFunc(list, func(a, b Punishment) int {
+		return a.Issued.Compare(b.Issued)
+	})
+
+	return list
+}
+
+// Active returns the active punishment of the kind that lasts the longest.
+func (s *Store) Active(player string, kind Kind, now time.Time) (Punishment, bool) {
+	var (
+		longest Punishment
+		found   bool
+	)
+
+	for _, p := range s.Of(player) {
+		if p.Kind != kind || !p.Active(now) {
+			continue
+		}
+
+		if !found || p.Permanent || (!longest.Permanent && p.Until.After(longest.Until)) {
+			longest, found = p, true
+		}
+	}
+
+	return longest, found
+}
+
+// AllActive returns the active punishments of all players, of the kind if it
+// isn't empty, the latest first.
+func (s *Store) AllActive(kind Kind, now time.Time) []Punishment {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Punishment, 0)
+	for _, punishments := range s.byPlayer {
+		for _, p := range punishments {
+			if (kind == "" || p.Kind == kind) && p.Active(now) {
+				list = append(list, p)
+			}
+		}
+	}
+
+	slices.SortFunc(list, func(a, b Punishment) int {
+		return b.Issued.Compare(a.Issued)
+	})
+
+	return list
+}
+
+// Next returns the step the next offense of the player in the category gets.
+func (s *Store) Next(player, category string) Step {
+	offenses := 0
+	for _, p := range s.Of(player) {
+		if p.Category == category && !p.Lifted {
+			offenses++
+		}
+	}
+
+	return s.Ladder(category).step(offenses)
+}
+
+// Issue punishes the player with step. The punishment still counts as an
+// offense of its category if staff chose the step instead of the ladder.
+func (s *Store) Issue(ctx context.Context, p Punishment, step Step) (Punishment, error) {
+	if err := step.Validate(); err != nil {
+		return Punishment{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Punishment{}, err
+	}
+
+	p.ID = id
+	p.Kind = step.Kind
+	p.Issued = time.Now()
+	p.Permanent = step.Minutes == 0
+	p.Until = p.Issued.Add(time.Duration(step.Minutes) * time.Minute)
+
+	if err := s.save(ctx, p); err != nil {
+		return Punishment{}, err
+	}
+
+	return p, nil
+}
+
+// Lift ends the punishment early.
+func (s *Store) Lift(ctx context.Context, player, id string) (Punishment, error) {
+	s.m.RLock()
+	p, ok := s.byPlayer[player][id]
+	s.m.RUnlock()
+
+	if !ok {
+		return Punishment{}, ErrPunishmentNotFound
+	}
+
+	p.Lifted = true
+	if err := s.save(ctx, p); err != nil {
+		return Punishment{}, err
+	}
+
+	return p, nil
+}
+
+func newID() (string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+func (s *Store) save(ctx context.Context, p Punishment) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	if err := s.kv.Set(ctx, p.key(), raw); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.put(p)
+	s.m.Unlock()
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package punishments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+)
+
+const (
+	defaultPoints    = 1
+	defaultThreshold = 3
+	defaultDecay     = 30 * 24 * time.Hour
+)
+
+// Warning is worth the points of its category's ladder. The points fade
+// over the decay of the ladder, and once the points of a category reach its
+// threshold the player is punished along the ladder.
+type Warning struct {
+	ID string `json:"id"`
+	// Player is the undashed UUID
+	Player   string    `json:"player"`
+	Name     string    `json:"name"`
+	Category string    `json:"category"`
+	Reason   string    `json:"reason"`
+	Actor    string    `json:"actor"`
+	Points   float64   `json:"points"`
+	Issued   time.Time `json:"issued"`
+	// Spent warnings led to a punishment and are worth nothing anymore
+	Spent bool `json:"spent,omitempty"`
+}
+
+func (w Warning) key() string {
+	return warningKeyPrefix + w.Player + "." + w.ID
+}
+
+// points is what the warning is still worth after decaying for decay.
+func (w Warning) points(decay time.Duration, now time.Time) float64 {
+	if w.Spent {
+		return 0
+	}
+
+	left := 1 - float64(now.Sub(w.Issued))/float64(decay)
+
+	return w.Points * min(1, max(0, left))
+}
+
+func (l Ladder) points() float64 {
+	if l.Points == 0 {
+		return defaultPoints
+	}
+
+	return l.Points
+}
+
+func (l Ladder) threshold() float64 {
+	if l.Threshold == 0 {
+		return defaultThreshold
+	}
+
+	return l.Threshold
+}
+
+func (l Ladder) decay() time.Duration {
+	if l.DecayMinutes == 0 {
+		return defaultDecay
+	}
+
+	return time.Duration(l.DecayMinutes) * time.Minute
+}
+
+// putWarning must be called with the lock held.
+func (s *Store) putWarning(w Warning) {
+	if s.warnings[w.Player] == nil {
+		s.warnings[w.Player] = make(map[string]Warning)
+	}
+
+	s.warnings[w.Player][w.ID] = w
+}
+
+// Warnings returns the warnings of the player, oldest first.
+func (s *Store) Warnings(player string) []Warning {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	list := make([]Warning, 0, len(s.warnings[player]))
+	for _, w := range s.warnings[player] {
+		list = append(list, w)
+	}
+
+	slices.SortFunc(list, func(a, b Warning) int {
+		return a.Issued.Compare(b.Issued)
+	})
+
+	return list
+}
+
+// Points returns what the warnings of the player in the category are worth
+// now.
+func (s *Store) Points(player, category string, now time.Time) float64 {
+	decay := s.Ladder(category).decay()
+
+	total := 0.0
+	for _, w := range s.Warnings(player) {
+		if w.Category == category {
+			total += w.points(decay, now)
+		}
+	}
+
+	return total
+}
+
+// Warn stores the warning, worth the points of its ladder unless it has its
+// own.
+func (s *Store) Warn(ctx context.Context, w Warning) (Warning, error) {
+	id, err := newID()
+	if err != nil {
+		return Warning{}, err
+	}
+
+	w.ID = id
+	w.Issued = time.Now()
+	if w.Points <= 0 {
+		w.Points = s.Ladder(w.Category).points()
+	}
+
+	return w, s.saveWarning(ctx, w)
+}
+
+// spend marks the warnings of the player in the category as spent, their
+// points made an offense.
+func (s *Store) spend(ctx context.Context, player, category string) error {
+	for _, w := range s.Warnings(player) {
+		if w.Category != category || w.Spent {
+			continue
+		}
+
+		w.Spent = true
+		if err := s.saveWarning(ctx, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) saveWarning(ctx context.Context, w Warning) error {
+	raw, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	if err := s.kv.Set(ctx, w.key(), raw); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.putWarning(w)
+	s.m.Unlock()
+
+	return nil
+}
+
+// Warn warns the player and punishes them along the ladder if their points
+// in the category reach its threshold. The punishment is empty otherwise.
+func (p *PunishmentsPlugin) Warn(ctx context.Context, actor string, w Warning) (Warning, Punishment, error) {
+	w.Actor = actor
+	warned, err := p.store.Warn(ctx, w)
+	if err != nil {
+		return Warning{}, Punishment{}, err
+	}
+
+	points := p.store.Points(warned.Player, warned.Category, time.Now())
+	threshold := p.store.Ladder(warned.Category).threshold()
+
+	log.Printf("%s warned %s for %s (%.1f of %.1f points): %s", actor, warned.Name, warned.Category, points, threshold, warned.Reason)
+	p.h.Tracef(warned.Player, "punishments: warned for %s by %s, %.1f of %.1f points", warned.Category, actor, points, threshold)
+
+	if err := p.h.Audit().Record(ctx, audit.Entry{
+		Actor:  actor,
+		Action: "punishment.warn",
+		Target: warned.Player,
+		Details: map[string]string{
+			"id":       warned.ID,
+			"category": warned.Category,
+			"points":   fmt.Sprint(warned.Points),
+			"reason":   warned.Reason,
+		},
+	}); err != nil {
+		return warned, Punishment{}, err
+	}
+
+	if player := p.player(warned.Player); player != nil {
+		_ = player.SendMessage(warningNotice(warned))
+	}
+
+	if points < threshold {
+		return warned, Punishment{}, nil
+	}
+
+	if err := p.store.spend(ctx, warned.Player, warned.Category); err != nil {
+		return warned, Punishment{}, err
+	}
+
+	issued, err := p.Issue(ctx, actor, Punishment{
+		Player:   warned.Player,
+		Name:     warned.Name,
+		Category: warned.Category,
+		Reason:   fmt.Sprintf("%.0f warning points, last: %s", points, warned.Reason),
+	}, nil)
+
+	return warned, issued, err
+}
@@ -0,0 +1,194 @@
+// Package recorder records the packets of players under investigation into
+// the object store, see cmd/replay to read the recordings.
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/object"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/recordings"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type RecorderPlugin struct {
+	h   *hosting.Hosting
+	rec *recordings.Recorder
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Recorder",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			if !util.EnvBoolWithDefault("RECORDING", false) {
+				return nil
+			}
+
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_recordings")
+			if err != nil {
+				return err
+			}
+
+			rec, err := recordings.New(ctx, bucket, h.ObjectStore(), h.Info.PodName, recordings.Options{
+				MaxBytes:  util.EnvIntWithDefault("RECORDING_MAX_BYTES", 64<<20),
+				Segment:   util.EnvDurationWithDefault("RECORDING_SEGMENT", 10*time.Minute),
+				Retention: util.EnvDurationWithDefault("RECORDING_RETENTION", 30*24*time.Hour),
+			})
+			if err != nil {
+				return err
+			}
+
+			p := &RecorderPlugin{h: h, rec: rec}
+
+			return p.Init(prx, bucket)
+		},
+	}, nil
+}
+
+func (p *RecorderPlugin) Init(prx *proxy.Proxy, bucket kv.Bucket) error {
+	p.h.Packets().Observe(p.rec)
+
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Recorder", p.onPostLogin))
+
+	p.h.Go("Recorder", func(ctx context.Context) {
+		kv.Watch(ctx, bucket, p.rec.HandleChange, p.rec.Reload)
+	})
+
+	p.h.Go("Recorder", p.store)
+
+	p.h.OnReload("Recorder", p.rec.Reload)
+
+	p.h.API().HandleFunc("GET /recordings", p.handleList)
+	p.h.API().HandleFunc("PUT /recordings/players/{player}", p.handleStart)
+	p.h.API().HandleFunc("DELETE /recordings/players/{player}", p.handleStop)
+
+	return nil
+}
+
+// store flushes finished segments to the object store and prunes old ones
+// until ctx is done, then stores what is left.
+func (p *RecorderPlugin) store(ctx context.Context) {
+	flush := time.NewTicker(30 * time.Second)
+	defer flush.Stop()
+
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := p.rec.Flush(context.Background(), time.Now(), true); err != nil {
+				log.Printf("Failed to store recordings: %v", err)
+			}
+			return
+		case now := <-flush.C:
+			if err := p.rec.Flush(ctx, now, false); err != nil {
+				log.Printf("Failed to store recordings: %v", err)
+			}
+		case now := <-prune.C:
+			if n, err := p.rec.Prune(ctx, now); err != nil {
+				log.Printf("Failed to prune recordings: %v", err)
+			} else if n > 0 {
+				log.Printf("Pruned %d recordings", n)
+			}
+		}
+	}
+}
+
+// onPostLogin warns about targets that join where they can't be recorded,
+// e.g. in online mode, which is encrypted from login on.
+func (p *RecorderPlugin) onPostLogin(e *proxy.PostLoginEvent) {
+	name := e.Player().Username()
+	if !p.rec.Wants(name) || p.h.Packets().Decodes(name) {
+		return
+	}
+
+	log.Printf("Can't record %s, their connection is encrypted or not on an offline listener", name)
+	p.h.Tracef(name, "recorder: connection can't be recorded")
+}
+
+type listResponse struct {
+	Targets    []recordings.Target `json:"targets"`
+	Recordings []object.Info       `json:"recordings"`
+}
+
+type startRequest struct {
+	Reason string `json:"reason"`
+	// Hours limits the recording, 0 records until it is stopped
+	Hours int `json:"hours"`
+}
+
+func (p *RecorderPlugin) handleList(w http.ResponseWriter, r *http.Request) {
+	infos, err := p.rec.Recordings(r.Context(), r.URL.Query().Get("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, listResponse{Targets: p.rec.Targets(), Recordings: infos})
+}
+
+func (p *RecorderPlugin) handleStart(w http.ResponseWriter, r *http.Request) {
+	req := startRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Hours < 0 {
+		api.WriteError(w, http.StatusBadRequest, errors.New("hours must not be negative"))
+		return
+	}
+
+	t := recordings.Target{Player: r.PathValue("player"), Reason: req.Reason, By: "api"}
+	if !p.h.PacketsDecoded(t.Player) {
+		api.WriteError(w, http.StatusConflict, fmt.Errorf("%s: %w", t.Player, hosting.ErrNotDecoded))
+		return
+	}
+	if req.Hours > 0 {
+		t.Until = time.Now().Add(time.Duration(req.Hours) * time.Hour)
+	}
+
+	if err := p.rec.Add(r.Context(), t); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "recording.start",
+		Target:  t.Player,
+		Details: map[string]string{"reason": t.Reason, "hours": strconv.Itoa(req.Hours)},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, t)
+}
+
+func (p *RecorderPlugin) handleStop(w http.ResponseWriter, r *http.Request) {
+	player := r.PathValue("player")
+	if err := p.rec.Remove(r.Context(), player); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "recording.stop", Target: player}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
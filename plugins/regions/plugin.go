@@ -0,0 +1,247 @@
+// Package regions sends players to the region closest to them. A player
+// whose ping to this proxy is high and whose country belongs to another live
+// region is offered the transfer there, or transferred right away.
+package regions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/regions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/transfer"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type Mode string
+
+const (
+	ModeOff Mode = "off"
+	// ModeOffer tells the player about the closer region, they switch with
+	// /region.
+	ModeOffer Mode = "offer"
+	// ModeForce transfers the player without asking.
+	ModeForce Mode = "force"
+)
+
+var transfersTotal = metrics.NewCounterVec("gate_region_transfers_total", "Players transferred to another region, by region and reason.", "region", "reason")
+
+type RegionsPlugin struct {
+	prx *proxy.Proxy
+	h   *hosting.Hosting
+	mgr *hosting.InstanceManager
+	dir *regions.Directory
+	geo *regions.GeoIP
+
+	region string
+	mode   Mode
+	// minPing is the average ping from which a player counts as far away.
+	minPing time.Duration
+	// delay gives the ping time to settle after the player joined.
+	delay time.Duration
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Regions",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			if h.Info.Region == "" {
+				log.Println("CSMC_REGION is not set, region routing is disabled")
+				return nil
+			}
+
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			mode := Mode(util.EnvWithDefault("REGION_TRANSFER", string(ModeOffer)))
+			if mode != ModeOff && mode != ModeOffer && mode != ModeForce {
+				return fmt.Errorf("invalid REGION_TRANSFER %q, expected off, offer or force", mode)
+			}
+
+			p := &RegionsPlugin{
+				prx:     prx,
+				h:       h,
+				mgr:     mgr,
+				dir:     h.Regions(),
+				geo:     h.GeoIP(),
+				region:  h.Info.Region,
+				mode:    mode,
+				minPing: util.EnvDurationWithDefault("REGION_MIN_PING", 120*time.Millisecond),
+				delay:   util.EnvDurationWithDefault("REGION_CHECK_DELAY", 10*time.Second),
+			}
+
+			return p.Init()
+		},
+	}, nil
+}
+
+func (p *RegionsPlugin) Init() error {
+	p.prx.Command().Register(p.regionCommand())
+
+	if p.mode != ModeOff && p.geo != nil {
+		event.Subscribe(p.prx.Event(), 0, hosting.Guard(p.h, "Regions", p.onPostConnect))
+	}
+
+	return nil
+}
+
+func (p *RegionsPlugin) onPostConnect(e *proxy.ServerPostConnectEvent) {
+	player := e.Player()
+	if e.PreviousServer() != nil || !transfer.Supported(player) {
+		return
+	}
+
+	p.h.Go("Regions", func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.delay):
+		}
+
+		if player.CurrentServer() == nil {
+			return
+		}
+
+		if err := p.check(ctx, player); err != nil {
+			log.Printf("Failed to check the region of %s: %v", player.Username(), err)
+		}
+	})
+}
+
+func (p *RegionsPlugin) ping(player proxy.Player) time.Duration {
+	if q, ok := p.h.Quality().Stats(player.ID(), time.Now()); ok {
+		return q.AvgPing
+	}
+
+	return player.Ping()
+}
+
+// check offers or forces the transfer of a far away player to the live
+// region of their country.
+func (p *RegionsPlugin) check(ctx context.Context, player proxy.Player) error {
+	if p.ping(player) < p.minPing {
+		return nil
+	}
+
+	country := p.geo.Country(remoteAddr(player.RemoteAddr()))
+
+	region, ok, err := p.dir.Closest(ctx, country, time.Now())
+	if err != nil || !ok || region.Name == p.region {
+		return err
+	}
+
+	if p.mode == ModeForce {
+		return p.transfer(ctx, player, region, "auto")
+	}
+
+	return player.SendMessage(&Text{
+		S: Style{Color: color.Aqua},
+		Extra: []Component{
+			&Text{Content: "You are playing on "},
+			&Text{Content: p.region, S: Style{Color: color.Yellow}},
+			&Text{Content: ", but "},
+			&Text{Content: region.Name, S: Style{Color: color.Yellow}},
+			&Text{Content: " is closer to you. "},
+			&Text{
+				Content: "[Switch]",
+				S: Style{
+					Color:      color.Green,
+					ClickEvent: RunCommand("/region " + region.Name),
+					HoverEvent: ShowText(&Text{Content: "Reconnect to " + region.Name}),
+				},
+			},
+		},
+	})
+}
+
+func (p *RegionsPlugin) transfer(ctx context.Context, player proxy.Player, region regions.Region, reason string) error {
+	if err := p.mgr.Transfer(ctx, player, region.Host, region.Port, nil); err != nil {
+		return err
+	}
+
+	transfersTotal.Inc(region.Name, reason)
+	log.Printf("Transferred %s to region %s (%s)", player.Username(), region.Name, reason)
+
+	return nil
+}
+
+func remoteAddr(addr net.Addr) netip.Addr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		a, _ := netip.AddrFromSlice(tcp.IP)
+		return a
+	}
+
+	a, _ := netip.ParseAddrPort(addr.String())
+	return a.Addr()
+}
+
+// regionCommand lists the live regions, or transfers the player to one of
+// them with /region <name>.
+func (p *RegionsPlugin) regionCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("region").
+		Then(brigodier.
+			Argument("name", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				player, ok := c.Source.(proxy.Player)
+				if !ok {
+					return c.Source.SendMessage(&Text{Content: "Only players can switch regions.", S: Style{Color: color.Red}})
+				}
+
+				name := c.String("name")
+				if name == p.region {
+					return c.Source.SendMessage(&Text{Content: "You are already playing on " + name + ".", S: Style{Color: color.Red}})
+				}
+
+				region, err := p.dir.Region(c.Context, name)
+				if errors.Is(err, regions.ErrRegionNotFound) {
+					return c.Source.SendMessage(&Text{Content: "There is no region called " + name + ".", S: Style{Color: color.Red}})
+				} else if err != nil {
+					return err
+				}
+
+				if err := p.transfer(c.Context, player, region, "command"); errors.Is(err, transfer.ErrUnsupported) {
+					return c.Source.SendMessage(&Text{Content: "Your client is too old to switch regions, connect to " + region.Host + " instead.", S: Style{Color: color.Red}})
+				} else if errors.Is(err, transfer.ErrNotPlaying) {
+					return c.Source.SendMessage(&Text{Content: "You can switch regions once you're on a server.", S: Style{Color: color.Red}})
+				} else if err != nil {
+					return err
+				}
+
+				return nil
+			}))).
+		Executes(command.Command(func(c *command.Context) error {
+			live, err := p.dir.Live(c.Context, time.Now())
+			if err != nil {
+				return err
+			}
+
+			names := make([]string, 0, len(live))
+			for _, r := range live {
+				names = append(names, r.Name)
+			}
+
+			return c.Source.SendMessage(&Text{
+				S: Style{Color: color.Aqua},
+				Extra: []Component{
+					&Text{Content: "You are playing on "},
+					&Text{Content: p.region, S: Style{Color: color.Yellow}},
+					&Text{Content: ". Regions: " + strings.Join(names, ", ")},
+				},
+			})
+		}))
+}
@@ -22,11 +22,11 @@ func mustParseUUID(s string) uuid.UUID {
 	return u
 }
 
-func New(_ *hosting.Hosting) (proxy.Plugin, error) {
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
 	return proxy.Plugin{
 		Name: "Resource Pack",
 		Init: func(ctx context.Context, proxy *proxy.Proxy) error {
-			event.Subscribe(proxy.Event(), 0, resourcePackPrompt())
+			event.Subscribe(proxy.Event(), 0, hosting.Guard(h, "Resource Pack", resourcePackPrompt()))
 
 			return nil
 		},
@@ -0,0 +1,191 @@
+package restarts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+func source(s command.Source) string {
+	if player, ok := s.(proxy.Player); ok {
+		return player.Username()
+	}
+
+	return "console"
+}
+
+// schedule adds the restart and has every proxy pick it up.
+func (p *RestartsPlugin) schedule(ctx context.Context, r Restart) (Restart, error) {
+	r, err := p.restarts.Schedule(ctx, r)
+	if err != nil {
+		return Restart{}, err
+	}
+
+	p.publish(ctx, notice{Action: noticeChanged})
+
+	return r, nil
+}
+
+func (p *RestartsPlugin) cancel(ctx context.Context, actor, id string) error {
+	if err := p.restarts.Cancel(ctx, actor, id); err != nil {
+		return err
+	}
+
+	p.publish(ctx, notice{Action: noticeChanged})
+
+	return nil
+}
+
+// restartCommand schedules restarts: /restart network <in> [reason],
+// /restart group <group> <in> [reason], /restart list and
+// /restart cancel <id>.
+func (p *RestartsPlugin) restartCommand() brigodier.LiteralNodeBuilder {
+	scheduleCommand := func(c *command.Context) error {
+		if !c.Source.HasPermission("csmc.restart") {
+			return c.Source.SendMessage(&Text{Content: "You do not have permission to schedule restarts.", S: Style{Color: color.Red}})
+		}
+
+		in, err := time.ParseDuration(c.String("in"))
+		if err != nil || in < 0 {
+			return c.Source.SendMessage(&Text{Content: "Invalid time, use e.g. 10m or 1h30m.", S: Style{Color: color.Red}})
+		}
+
+		r, err := p.schedule(c.Context, Restart{Group: c.String("group"), At: time.Now().Add(in), Reason: c.String("reason"), By: source(c.Source)})
+		if err != nil {
+			return err
+		}
+
+		return c.Source.SendMessage(&Text{Content: r.Target() + " restarts in " + formatCountdown(in) + ", cancel with /restart cancel " + r.ID + ".", S: Style{Color: color.Green}})
+	}
+
+	at := func() brigodier.ArgumentNodeBuilder {
+		return brigodier.Argument("in", brigodier.StringWord).
+			Executes(command.Command(scheduleCommand)).
+			Then(brigodier.Argument("reason", brigodier.StringPhrase).Executes(command.Command(scheduleCommand)))
+	}
+
+	return brigodier.Literal("restart").
+		Then(brigodier.Literal("network").Then(at())).
+		Then(brigodier.Literal("group").
+			Then(brigodier.Argument("group", brigodier.String).Then(at()))).
+		Then(brigodier.Literal("list").
+			Executes(command.Command(func(c *command.Context) error {
+				if !c.Source.HasPermission("csmc.restart") {
+					return c.Source.SendMessage(&Text{Content: "You do not have permission to schedule restarts.", S: Style{Color: color.Red}})
+				}
+
+				list, err := p.restarts.List(c.Context)
+				if err != nil {
+					return err
+				}
+
+				if len(list) == 0 {
+					return c.Source.SendMessage(&Text{Content: "No restarts are scheduled.", S: Style{Color: color.Gray}})
+				}
+
+				lines := []Component{&Text{Content: "Scheduled restarts", S: Style{Color: color.Gold, Bold: True}}}
+				for _, r := range list {
+					cancel := "/restart cancel " + r.ID
+					lines = append(lines,
+						&Text{Content: "\n"},
+						&Text{Content: "[Cancel] ", S: Style{
+							Color:      color.Red,
+							ClickEvent: RunCommand(cancel),
+							HoverEvent: ShowText(&Text{Content: cancel}),
+						}},
+						&Text{Content: r.Target() + " in " + formatCountdown(time.Until(r.At)), S: Style{Color: color.White}},
+						&Text{Content: " by " + r.By + " " + r.Reason, S: Style{Color: color.Gray}},
+					)
+				}
+
+				return c.Source.SendMessage(&Text{Extra: lines})
+			}))).
+		Then(brigodier.Literal("cancel").
+			Then(brigodier.Argument("id", brigodier.StringWord).
+				Executes(command.Command(func(c *command.Context) error {
+					if !c.Source.HasPermission("csmc.restart") {
+						return c.Source.SendMessage(&Text{Content: "You do not have permission to schedule restarts.", S: Style{Color: color.Red}})
+					}
+
+					if err := p.cancel(c.Context, source(c.Source), c.String("id")); errors.Is(err, ErrRestartNotFound) {
+						return c.Source.SendMessage(&Text{Content: "There is no such restart scheduled.", S: Style{Color: color.Red}})
+					} else if err != nil {
+						return err
+					}
+
+					return c.Source.SendMessage(&Text{Content: "Restart cancelled.", S: Style{Color: color.Green}})
+				}))))
+}
+
+func (p *RestartsPlugin) handleList(w http.ResponseWriter, r *http.Request) {
+	list, err := p.restarts.List(r.Context())
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, list)
+}
+
+type scheduleRequest struct {
+	Group string `json:"group"`
+	// At or In is when the restart runs, In is a duration like 10m
+	At      time.Time `json:"at"`
+	In      string    `json:"in"`
+	Reason  string    `json:"reason"`
+	Proxies bool      `json:"proxies"`
+	// Actor is who scheduled the restart, "api" by default
+	Actor string `json:"actor"`
+}
+
+func (p *RestartsPlugin) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	req := scheduleRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.In != "" {
+		in, err := time.ParseDuration(req.In)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		req.At = time.Now().Add(in)
+	}
+
+	if req.Actor == "" {
+		req.Actor = "api"
+	}
+
+	restart, err := p.schedule(r.Context(), Restart{Group: req.Group, At: req.At.UTC(), Reason: req.Reason, Proxies: req.Proxies, By: req.Actor})
+	if errors.Is(err, ErrInvalidRestart) {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusCreated, restart)
+}
+
+func (p *RestartsPlugin) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if err := p.cancel(r.Context(), "api", r.PathValue("id")); errors.Is(err, ErrRestartNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,286 @@
+package restarts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/provider"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
+)
+
+// actor is who the provider and lockdown changes of a restart are audited as.
+const actor = "restarts"
+
+func (p *RestartsPlugin) leader(ctx context.Context, now time.Time) bool {
+	instances, err := p.h.Cluster().Instances(ctx, now)
+	if err != nil {
+		log.Printf("Failed to list the cluster for a restart: %v", err)
+		return false
+	}
+
+	return cluster.Leader(instances) == p.h.Info.PodName
+}
+
+// drain moves our players off the group to the lobby and remembers where
+// they were. Network restarts leave nowhere to go, those players are asked
+// to reconnect when their server stops.
+func (p *RestartsPlugin) drain(ctx context.Context, r Restart, players []proxy.Player) {
+	if r.Group == "" {
+		msg := &Text{Content: "The network is restarting now, please reconnect in a minute.", S: Style{Color: color.Yellow}}
+		for _, player := range players {
+			_ = player.SendMessage(msg)
+		}
+		return
+	}
+
+	d := drained{group: r.Group, players: make(map[guuid.UUID]string, len(players))}
+	for _, player := range players {
+		if conn := player.CurrentServer(); conn != nil {
+			d.players[player.ID()] = conn.Server().ServerInfo().Name()
+		}
+	}
+
+	p.m.Lock()
+	p.drained[r.ID] = d
+	p.m.Unlock()
+
+	for _, player := range players {
+		go func() {
+			defer p.h.Recover("Restarts")
+
+			_ = player.SendMessage(&Text{Content: r.Group + " is restarting, you will be brought back once it is up.", S: Style{Color: color.Yellow}})
+
+			lobby, err := p.mgr.ChooseServer(ctx, "lobby", player)
+			if err != nil {
+				log.Printf("No lobby to move %s to during the restart of %s: %v", player.Username(), r.Group, err)
+				return
+			}
+
+			if _, err := p.mgr.Connect(ctx, player, lobby); err != nil {
+				log.Printf("Failed to move %s off %s for its restart: %v", player.Username(), r.Group, err)
+			}
+		}()
+	}
+}
+
+// execute runs the restart on the leader and tells the proxies once it is
+// done, so they bring their players back.
+func (p *RestartsPlugin) execute(ctx context.Context, r Restart) {
+	// Cancelled just now, or a former leader runs it already
+	if err := p.restarts.claim(ctx, r.ID); err != nil {
+		if !errors.Is(err, ErrRestartNotFound) {
+			log.Printf("Failed to start the restart of %s: %v", r.Target(), err)
+		}
+		return
+	}
+
+	log.Printf("Restarting %s, scheduled by %s", r.Target(), r.By)
+
+	n := notice{Action: noticeDone, ID: r.ID}
+	if err := p.restart(ctx, r); err != nil {
+		log.Printf("Failed to restart %s: %v", r.Target(), err)
+		restartsTotal.Inc("failed")
+		n.Error = err.Error()
+	} else {
+		log.Printf("Restarted %s", r.Target())
+		restartsTotal.Inc("done")
+	}
+
+	p.publish(ctx, n)
+
+	if r.Proxies && n.Error == "" {
+		if _, err := p.h.RestartCluster(ctx, actor); err != nil {
+			log.Printf("Failed to start the rolling restart of the proxies: %v", err)
+		}
+	}
+}
+
+// restart stops the servers of the restart and starts them again through the
+// provider, and waits until they take connections. Groups are locked down
+// meanwhile, so players the lobby sends there are turned away.
+func (p *RestartsPlugin) restart(ctx context.Context, r Restart) error {
+	if p.h.Provider() == nil {
+		return hosting.ErrNoProvider
+	}
+
+	names, err := p.servers(ctx, r)
+	if err != nil {
+		return err
+	} else if len(names) == 0 {
+		return errors.New("no servers to restart")
+	}
+
+	if r.Group != "" {
+		if _, err := p.h.SetGroupLockdown(ctx, actor, r.Group, "&e"+r.Group+" is restarting, try again in a minute."); err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := p.h.DeleteGroupLockdown(p.h.Context(), actor, r.Group); err != nil {
+				log.Printf("Failed to lift the lockdown of %s after its restart: %v", r.Group, err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	for _, name := range names {
+		if err := p.h.PowerServer(ctx, actor, name, false); err != nil {
+			return fmt.Errorf("stop %s: %w", name, err)
+		}
+	}
+
+	if err := p.waitFor(ctx, names, func(name string) bool {
+		status, err := p.h.Provider().ServerStatus(ctx, name)
+		return err == nil && status == provider.StatusStopped
+	}); err != nil {
+		return fmt.Errorf("wait for the servers to stop: %w", err)
+	}
+
+	for _, name := range names {
+		if err := p.h.PowerServer(ctx, actor, name, true); err != nil {
+			return fmt.Errorf("start %s: %w", name, err)
+		}
+	}
+
+	if err := p.waitFor(ctx, names, func(name string) bool {
+		status, err := p.h.Provider().ServerStatus(ctx, name)
+		return err == nil && status == provider.StatusRunning && p.accepts(ctx, name)
+	}); err != nil {
+		return fmt.Errorf("wait for the servers to start: %w", err)
+	}
+
+	return nil
+}
+
+// servers returns the names of the servers the restart restarts, those of
+// the provider for the network.
+func (p *RestartsPlugin) servers(ctx context.Context, r Restart) ([]string, error) {
+	if r.Group == "" {
+		servers, err := p.h.Provider().ListServers(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, len(servers))
+		for i, s := range servers {
+			names[i] = s.Name
+		}
+
+		return names, nil
+	}
+
+	servers, err := p.mgr.GetServersOfGamemode(ctx, r.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(servers))
+	for i, s := range servers {
+		names[i] = s.ServerInfo().Name()
+	}
+
+	return names, nil
+}
+
+// accepts reports whether the server takes connections. A server that is
+// running may still be loading its worlds.
+func (p *RestartsPlugin) accepts(ctx context.Context, name string) bool {
+	server := p.prx.Server(name)
+	if server == nil {
+		// Not registered again yet
+		return false
+	}
+
+	d := net.Dialer{Timeout: 2 * time.Second}
+	c, err := d.DialContext(ctx, "tcp", server.ServerInfo().Addr().String())
+	if err != nil {
+		return false
+	}
+	_ = c.Close()
+
+	return true
+}
+
+func (p *RestartsPlugin) waitFor(ctx context.Context, names []string, ok func(name string) bool) error {
+	t := time.NewTicker(2 * time.Second)
+	defer t.Stop()
+
+	pending := names
+	for {
+		var left []string
+		for _, name := range pending {
+			if !ok(name) {
+				left = append(left, name)
+			}
+		}
+
+		if pending = left; len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %w", pending, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// reconnect brings the players a restart drained back to their server, or
+// another one of the group if it is gone.
+func (p *RestartsPlugin) reconnect(id, failure string) {
+	p.m.Lock()
+	d, ok := p.drained[id]
+	delete(p.drained, id)
+	p.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for playerID, name := range d.players {
+		player := p.prx.Player(playerID)
+		if player == nil {
+			continue
+		}
+
+		if conn := player.CurrentServer(); conn != nil && conn.Server().ServerInfo().Name() == name {
+			continue
+		}
+
+		go func() {
+			defer p.h.Recover("Restarts")
+
+			ctx := p.h.Context()
+			if failure != "" {
+				_ = player.SendMessage(&Text{Content: "The restart of " + d.group + " ran into a problem, trying to bring you back anyway.", S: Style{Color: color.Red}})
+			}
+
+			server := p.prx.Server(name)
+			if server == nil {
+				var err error
+				if server, err = p.mgr.ChooseServer(ctx, d.group, player); err != nil {
+					_ = player.SendMessage(&Text{Content: d.group + " is not back yet, join it again later.", S: Style{Color: color.Red}})
+					return
+				}
+			}
+
+			_ = player.SendMessage(&Text{Content: d.group + " is back, taking you there.", S: Style{Color: color.Green}})
+
+			if _, err := p.mgr.Connect(ctx, player, server); err != nil {
+				log.Printf("Failed to bring %s back to %s after its restart: %v", player.Username(), server.ServerInfo().Name(), err)
+			}
+		}()
+	}
+}
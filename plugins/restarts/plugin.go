@@ -0,0 +1,421 @@
+package restarts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/messaging"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/bossbar"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/edition/java/title"
+	guuid "go.minekube.com/gate/pkg/util/uuid"
+)
+
+const (
+	noticeChanged = "changed"
+	noticeDone    = "done"
+)
+
+// notice is sent on the restarts subject when the schedule changed or the
+// leader finished a restart.
+type notice struct {
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// countdown is the state of a scheduled restart on this proxy, owned by the
+// ticker.
+type countdown struct {
+	restart Restart
+	// warned is the shortest warning given, 0 before the first
+	warned  time.Duration
+	bar     bossbar.BossBar
+	viewers map[guuid.UUID]proxy.Player
+	started bool
+}
+
+// drained are the players a restart moved off its group, with the server
+// they were on.
+type drained struct {
+	group   string
+	players map[guuid.UUID]string
+}
+
+type RestartsPlugin struct {
+	prx      *proxy.Proxy
+	h        *hosting.Hosting
+	mgr      *hosting.InstanceManager
+	restarts *Restarts
+
+	// warnings are how long before a restart players are told, longest
+	// first
+	warnings []time.Duration
+	// bossbar and title are how long before a restart the countdown bossbar
+	// shows and warnings come with a title
+	bossbar time.Duration
+	title   time.Duration
+	// timeout is how long the servers have to stop and be back up
+	timeout time.Duration
+
+	// scheduled is the schedule as of the last reload, countdowns is what the
+	// ticker made of it
+	scheduled  []Restart
+	countdowns map[string]*countdown
+	drained    map[string]drained
+	m          sync.Mutex
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Restarts",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			restarts, err := NewKVRestarts(ctx, h)
+			if err != nil {
+				return err
+			}
+
+			warnings, err := parseWarnings(util.EnvWithDefault("RESTART_WARNINGS", "15m,10m,5m,1m,30s,10s,5s,4s,3s,2s,1s"))
+			if err != nil {
+				return fmt.Errorf("RESTART_WARNINGS: %w", err)
+			}
+
+			p := &RestartsPlugin{
+				prx:        prx,
+				h:          h,
+				mgr:        mgr,
+				restarts:   restarts,
+				warnings:   warnings,
+				bossbar:    util.EnvDurationWithDefault("RESTART_BOSSBAR", 5*time.Minute),
+				title:      util.EnvDurationWithDefault("RESTART_TITLE", time.Minute),
+				timeout:    util.EnvDurationWithDefault("RESTART_SERVER_TIMEOUT", 5*time.Minute),
+				countdowns: make(map[string]*countdown),
+				drained:    make(map[string]drained),
+			}
+
+			return p.Init(ctx)
+		},
+	}, nil
+}
+
+func (p *RestartsPlugin) Init(ctx context.Context) error {
+	if err := p.reload(ctx); err != nil {
+		return err
+	}
+
+	if err := p.h.Messaging().Subscribe(p.h.Info.RestartsSubject(), p.onNotice); err != nil {
+		return err
+	}
+
+	p.prx.Command().Register(p.restartCommand())
+
+	p.h.API().HandleFunc("GET /restarts", p.handleList)
+	p.h.API().HandleFunc("POST /restarts", p.handleSchedule)
+	p.h.API().HandleFunc("DELETE /restarts/{id}", p.handleCancel)
+
+	p.h.Go("Restarts", p.run)
+
+	return nil
+}
+
+// parseWarnings parses a comma separated list of durations, e.g. 5m,1m,10s.
+func parseWarnings(s string) ([]time.Duration, error) {
+	var warnings []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(field)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid warning %q", field)
+		}
+
+		warnings = append(warnings, d)
+	}
+
+	if len(warnings) == 0 {
+		return nil, fmt.Errorf("no warnings in %q", s)
+	}
+
+	slices.SortFunc(warnings, func(a, b time.Duration) int {
+		return int(b - a)
+	})
+
+	return slices.Compact(warnings), nil
+}
+
+// formatCountdown rounds up to the second, and to minutes from a minute on.
+func formatCountdown(d time.Duration) string {
+	secs := int(math.Ceil(d.Seconds()))
+	unit := "second"
+	if secs >= 60 {
+		secs, unit = (secs+30)/60, "minute"
+	}
+
+	if secs != 1 {
+		unit += "s"
+	}
+
+	return fmt.Sprintf("%d %s", secs, unit)
+}
+
+func (p *RestartsPlugin) reload(ctx context.Context) error {
+	list, err := p.restarts.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.m.Lock()
+	p.scheduled = list
+	p.m.Unlock()
+
+	return nil
+}
+
+func (p *RestartsPlugin) publish(ctx context.Context, n notice) {
+	raw, err := json.Marshal(n)
+	if err != nil {
+		log.Printf("Failed to marshal restart notice: %v", err)
+		return
+	}
+
+	if err := p.h.Messaging().Publish(ctx, p.h.Info.RestartsSubject(), raw); err != nil {
+		log.Printf("Failed to publish restart notice: %v", err)
+	}
+}
+
+func (p *RestartsPlugin) onNotice(msg messaging.Message) {
+	defer p.h.Recover("Restarts")
+
+	n := notice{}
+	if err := json.Unmarshal(msg.Data, &n); err != nil {
+		log.Printf("Invalid restart notice: %v", err)
+		return
+	}
+
+	switch n.Action {
+	case noticeChanged:
+		if err := p.reload(msg.Context); err != nil {
+			log.Printf("Failed to reload the scheduled restarts: %v", err)
+		}
+	case noticeDone:
+		p.reconnect(n.ID, n.Error)
+	}
+}
+
+// run counts down every second. The schedule is also reloaded every minute,
+// in case a notice was missed.
+func (p *RestartsPlugin) run(ctx context.Context) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	reloaded := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if now.Sub(reloaded) >= time.Minute {
+				if err := p.reload(ctx); err != nil {
+					log.Printf("Failed to reload the scheduled restarts: %v", err)
+				}
+				reloaded = now
+			}
+
+			p.tick(ctx, now)
+		}
+	}
+}
+
+func (p *RestartsPlugin) tick(ctx context.Context, now time.Time) {
+	p.m.Lock()
+	scheduled := slices.Clone(p.scheduled)
+	p.m.Unlock()
+
+	// Cancelled restarts and those another proxy ran leave the schedule
+	for id, c := range p.countdowns {
+		if !slices.ContainsFunc(scheduled, func(r Restart) bool { return r.ID == id }) {
+			if !c.started {
+				p.hideBar(c)
+			}
+			delete(p.countdowns, id)
+		}
+	}
+
+	gamemodes := make(map[string]string)
+	for _, r := range scheduled {
+		c, ok := p.countdowns[r.ID]
+		if !ok {
+			c = &countdown{restart: r, viewers: make(map[guuid.UUID]proxy.Player)}
+			p.countdowns[r.ID] = c
+		}
+
+		remaining := r.At.Sub(now)
+		if c.started || remaining > p.warnings[0] && remaining > p.bossbar {
+			continue
+		}
+
+		players := p.affected(ctx, r, gamemodes)
+
+		if w, ok := p.due(c, remaining); ok {
+			p.announce(r, players, remaining, w <= p.title)
+		}
+
+		if remaining > 0 {
+			if remaining <= p.bossbar {
+				p.showBar(c, players, remaining)
+			}
+			continue
+		}
+
+		c.started = true
+		p.hideBar(c)
+		p.drain(ctx, r, players)
+
+		if p.leader(ctx, now) {
+			go func() {
+				defer p.h.Recover("Restarts")
+
+				p.execute(ctx, r)
+			}()
+		}
+	}
+}
+
+// affected returns our players on the servers that restart.
+func (p *RestartsPlugin) affected(ctx context.Context, r Restart, gamemodes map[string]string) []proxy.Player {
+	players := p.prx.Players()
+	if r.Group == "" {
+		return players
+	}
+
+	return slices.DeleteFunc(players, func(player proxy.Player) bool {
+		conn := player.CurrentServer()
+		if conn == nil {
+			return true
+		}
+
+		name := conn.Server().ServerInfo().Name()
+		gamemode, ok := gamemodes[name]
+		if !ok {
+			var err error
+			if gamemode, err = p.mgr.Gamemode(ctx, conn.Server()); err != nil {
+				log.Printf("Failed to get the gamemode of %s for a restart: %v", name, err)
+			}
+			gamemodes[name] = gamemode
+		}
+
+		return gamemode != r.Group
+	})
+}
+
+// due reports whether a warning is due, the shortest one reached unless it
+// or a shorter one was given already.
+func (p *RestartsPlugin) due(c *countdown, remaining time.Duration) (time.Duration, bool) {
+	i := slices.IndexFunc(p.warnings, func(w time.Duration) bool { return w < remaining })
+	if i == 0 {
+		return 0, false
+	} else if i < 0 {
+		i = len(p.warnings)
+	}
+
+	w := p.warnings[i-1]
+	if c.warned != 0 && w >= c.warned {
+		return 0, false
+	}
+	c.warned = w
+
+	return w, true
+}
+
+func (p *RestartsPlugin) announce(r Restart, players []proxy.Player, remaining time.Duration, withTitle bool) {
+	when := "in " + formatCountdown(remaining)
+	if remaining <= 0 {
+		when = "now"
+	}
+
+	line := []Component{
+		&Text{Content: "ʀᴇѕᴛᴀʀᴛ ", S: Style{Color: color.Gold, Bold: True}},
+		&Text{Content: r.Target() + " restarts " + when + ".", S: Style{Color: color.Yellow}},
+	}
+	if r.Reason != "" {
+		line = append(line, &Text{Content: " " + r.Reason, S: Style{Color: color.Gray}})
+	}
+	msg := &Text{Extra: line}
+
+	for _, player := range players {
+		_ = player.SendMessage(msg)
+
+		if withTitle {
+			_ = title.ShowTitle(player, &title.Options{
+				Title:    &Text{Content: "Restarting " + when, S: Style{Color: color.Gold}},
+				Subtitle: &Text{Content: r.Reason, S: Style{Color: color.Gray}},
+				FadeIn:   0,
+				Stay:     2 * time.Second,
+				FadeOut:  500 * time.Millisecond,
+			})
+		}
+	}
+}
+
+func (p *RestartsPlugin) showBar(c *countdown, players []proxy.Player, remaining time.Duration) {
+	name := &Text{Content: c.restart.Target() + " restarts in " + formatCountdown(remaining), S: Style{Color: color.Yellow}}
+	percent := float32(remaining) / float32(p.bossbar)
+
+	if c.bar == nil {
+		c.bar = bossbar.New(name, percent, bossbar.RedColor, bossbar.ProgressOverlay)
+	} else {
+		c.bar.SetName(name)
+		c.bar.SetPercent(percent)
+	}
+
+	current := make(map[guuid.UUID]bool, len(players))
+	for _, player := range players {
+		current[player.ID()] = true
+		if _, ok := c.viewers[player.ID()]; ok {
+			continue
+		}
+
+		if err := c.bar.AddViewer(player); err != nil {
+			log.Printf("Failed to show the restart countdown to %s: %v", player.Username(), err)
+			continue
+		}
+		c.viewers[player.ID()] = player
+	}
+
+	// Players that left the group or the proxy
+	for id, player := range c.viewers {
+		if !current[id] {
+			_ = c.bar.RemoveViewer(player)
+			delete(c.viewers, id)
+		}
+	}
+}
+
+func (p *RestartsPlugin) hideBar(c *countdown) {
+	if c.bar == nil {
+		return
+	}
+
+	for id, player := range c.viewers {
+		_ = c.bar.RemoveViewer(player)
+		delete(c.viewers, id)
+	}
+}
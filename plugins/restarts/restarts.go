@@ -0,0 +1,153 @@
+// Package restarts schedules restarts of the backends of the network or of a
+// group. Players on the targets are warned with a countdown, moved off while
+// the servers restart through the server provider and brought back after.
+package restarts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+)
+
+const keyPrefix = "restart."
+
+var (
+	ErrRestartNotFound = errors.New("restart not found")
+	ErrInvalidRestart  = errors.New("invalid restart")
+
+	restartsTotal = metrics.NewCounterVec("gate_restarts_total", "Scheduled restarts that ran, by result.", "result")
+)
+
+// Restart is a scheduled restart. Without a Group it restarts every server of
+// the provider, and the proxies after if Proxies is set.
+type Restart struct {
+	ID      string    `json:"id"`
+	Group   string    `json:"group,omitempty"`
+	At      time.Time `json:"at"`
+	Reason  string    `json:"reason,omitempty"`
+	Proxies bool      `json:"proxies,omitempty"`
+	By      string    `json:"by"`
+	Created time.Time `json:"created"`
+}
+
+func (r Restart) Validate() error {
+	if r.At.IsZero() {
+		return fmt.Errorf("%w: at or in is required", ErrInvalidRestart)
+	}
+
+	if r.Proxies && r.Group != "" {
+		return fmt.Errorf("%w: only network restarts restart the proxies", ErrInvalidRestart)
+	}
+
+	return nil
+}
+
+// Target is what the players are told restarts.
+func (r Restart) Target() string {
+	if r.Group == "" {
+		return "The network"
+	}
+
+	return r.Group
+}
+
+type Restarts struct {
+	h  *hosting.Hosting
+	kv kv.Bucket
+}
+
+func NewKVRestarts(ctx context.Context, h *hosting.Hosting) (*Restarts, error) {
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_restarts")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Restarts{h: h, kv: bucket}, nil
+}
+
+// List returns the scheduled restarts, soonest first.
+func (r *Restarts) List(ctx context.Context) ([]Restart, error) {
+	keys, err := r.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Restart, 0, len(keys))
+	for _, key := range keys {
+		if !strings.HasPrefix(key, keyPrefix) {
+			continue
+		}
+
+		restart, ok, err := kv.Typed[Restart](r.kv, key).Lookup(ctx)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			list = append(list, restart)
+		}
+	}
+
+	slices.SortFunc(list, func(a, b Restart) int {
+		return a.At.Compare(b.At)
+	})
+
+	return list, nil
+}
+
+func (r *Restarts) Schedule(ctx context.Context, restart Restart) (Restart, error) {
+	if err := restart.Validate(); err != nil {
+		return Restart{}, err
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Restart{}, err
+	}
+	restart.ID, restart.Created = hex.EncodeToString(id), time.Now().UTC()
+
+	if err := kv.Typed[Restart](r.kv, keyPrefix+restart.ID).Set(ctx, restart); err != nil {
+		return Restart{}, err
+	}
+
+	details := map[string]string{"at": restart.At.Format(time.RFC3339), "reason": restart.Reason}
+	if restart.Group != "" {
+		details["group"] = restart.Group
+	}
+
+	return restart, r.h.Audit().Record(ctx, audit.Entry{Actor: restart.By, Action: "restarts.schedule", Target: restart.ID, Details: details})
+}
+
+func (r *Restarts) Cancel(ctx context.Context, actor, id string) error {
+	if err := r.claim(ctx, id); err != nil {
+		return err
+	}
+
+	return r.h.Audit().Record(ctx, audit.Entry{Actor: actor, Action: "restarts.cancel", Target: id})
+}
+
+// claim removes the restart, so only one proxy runs or cancels it.
+func (r *Restarts) claim(ctx context.Context, id string) error {
+	key := keyPrefix + id
+	if _, ok, err := kv.Typed[Restart](r.kv, key).Lookup(ctx); err != nil {
+		return err
+	} else if !ok {
+		return ErrRestartNotFound
+	}
+
+	if err := r.kv.Delete(ctx, key); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrRestartNotFound
+	} else if err != nil {
+		return fmt.Errorf("remove restart %s: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package selector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/menus"
+)
+
+var ErrLayoutNotFound = errors.New("layout not found")
+
+// Entry is an item of a layout. The name and lore of the item may contain
+// {players} and {servers}, the live counts of the target.
+type Entry struct {
+	Slot int        `json:"slot"`
+	Item menus.Item `json:"item"`
+	// Target is a server, selector or gamemode the player is sent to.
+	Target string `json:"target,omitempty"`
+	// Layout opens another layout instead, e.g. one per gamemode.
+	Layout string `json:"layout,omitempty"`
+	// Permission hides the entry from players without it.
+	Permission string `json:"permission,omitempty"`
+}
+
+type Layout struct {
+	Name    string  `json:"name"`
+	Title   string  `json:"title"`
+	Rows    int     `json:"rows"`
+	Entries []Entry `json:"entries"`
+}
+
+func (l Layout) Validate() error {
+	if l.Name == "" {
+		return errors.New("layout name is required")
+	}
+
+	if l.Rows < 1 || l.Rows > 6 {
+		return errors.New("rows must be between 1 and 6")
+	}
+
+	slots := make(map[int]struct{}, len(l.Entries))
+	for _, e := range l.Entries {
+		if e.Slot < 0 || e.Slot >= l.Rows*9 {
+			return fmt.Errorf("slot %d is outside of the menu", e.Slot)
+		}
+
+		if _, ok := slots[e.Slot]; ok {
+			return fmt.Errorf("slot %d is used twice", e.Slot)
+		}
+		slots[e.Slot] = struct{}{}
+
+		if e.Item.Material == "" {
+			return fmt.Errorf("entry in slot %d has no material", e.Slot)
+		}
+	}
+
+	return nil
+}
+
+// Layouts keeps the layouts of the selector bucket in memory, keyed by name.
+type Layouts struct {
+	kv      kv.Bucket
+	layouts map[string]Layout
+	m       sync.RWMutex
+}
+
+func NewKVLayouts(ctx context.Context, bucket kv.Bucket) (*Layouts, error) {
+	l := &Layouts{kv: bucket, layouts: make(map[string]Layout)}
+
+	if err := l.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Layouts) Reload(ctx context.Context) error {
+	keys, err := l.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	layouts := make(map[string]Layout)
+	for _, key := range keys {
+		raw, err := l.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		layout := Layout{}
+		if err := json.Unmarshal(raw, &layout); err != nil {
+			log.Printf("Failed to unmarshal selector layout %s: %v", key, err)
+			continue
+		}
+
+		layouts[key] = layout
+	}
+
+	l.m.Lock()
+	l.layouts = layouts
+	l.m.Unlock()
+
+	return nil
+}
+
+func (l *Layouts) handleChange(v *kv.Value) {
+	if v == nil {
+		return
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	switch v.Operation {
+	case kv.Put:
+		layout := Layout{}
+		if err := json.Unmarshal(v.Value, &layout); err != nil {
+			log.Printf("Failed to unmarshal selector layout %s: %v", v.Key, err)
+			return
+		}
+
+		l.layouts[v.Key] = layout
+
+	case kv.Delete:
+		delete(l.layouts, v.Key)
+	}
+}
+
+func (l *Layouts) Get(name string) (Layout, bool) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	layout, ok := l.layouts[name]
+
+	return layout, ok
+}
+
+func (l *Layouts) List() []Layout {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	list := make([]Layout, 0, len(l.layouts))
+	for _, layout := range l.layouts {
+		list = append(list, layout)
+	}
+
+	slices.SortFunc(list, func(a, b Layout) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+func (l *Layouts) Set(ctx context.Context, layout Layout) error {
+	if err := layout.Validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+
+	if err := l.kv.Set(ctx, layout.Name, raw); err != nil {
+		return err
+	}
+
+	l.m.Lock()
+	l.layouts[layout.Name] = layout
+	l.m.Unlock()
+
+	return nil
+}
+
+func (l *Layouts) Delete(ctx context.Context, name string) error {
+	if err := l.kv.Delete(ctx, name); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrLayoutNotFound
+	} else if err != nil {
+		return err
+	}
+
+	l.m.Lock()
+	delete(l.layouts, name)
+	l.m.Unlock()
+
+	return nil
+}
@@ -0,0 +1,359 @@
+// Package selector opens server selector menus laid out in KV, by command or
+// when a lobby backend asks for it, e.g. because the player used the compass
+// in their hotbar.
+package selector
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/menus"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Channel the backend co-plugin asks on to open a layout, with
+// {"layout":"<name>"}.
+const Channel = "csmc:selector"
+
+type openRequest struct {
+	Layout string `json:"layout"`
+}
+
+// opened is a selector menu a player has open, it is rebuilt with the
+// current player counts until the player closes it.
+type opened struct {
+	player proxy.Player
+	layout string
+	menu   *menus.Menu
+}
+
+type SelectorPlugin struct {
+	prx     *proxy.Proxy
+	h       *hosting.Hosting
+	mgr     *hosting.InstanceManager
+	bridge  *bridge.Bridge
+	menus   *menus.Menus
+	layouts *Layouts
+
+	defaultLayout string
+
+	open map[uuid.UUID]opened
+	m    sync.Mutex
+}
+
+func New(h *hosting.Hosting, b *bridge.Bridge, mnu *menus.Menus) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Selector",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_selector")
+			if err != nil {
+				return err
+			}
+
+			layouts, err := NewKVLayouts(ctx, bucket)
+			if err != nil {
+				return err
+			}
+
+			p := &SelectorPlugin{
+				prx:           prx,
+				h:             h,
+				mgr:           mgr,
+				bridge:        b,
+				menus:         mnu,
+				layouts:       layouts,
+				defaultLayout: util.EnvWithDefault("SELECTOR_DEFAULT_LAYOUT", "default"),
+				open:          make(map[uuid.UUID]opened),
+			}
+
+			return p.Init(bucket)
+		},
+	}, nil
+}
+
+func (p *SelectorPlugin) Init(bucket kv.Bucket) error {
+	if _, err := p.bridge.Register(Channel, p.onMessage); err != nil {
+		return err
+	}
+
+	p.prx.Command().Register(p.selectorCommand())
+
+	p.h.Go("Selector", func(ctx context.Context) {
+		kv.Watch(ctx, bucket, p.layouts.handleChange, p.layouts.Reload)
+	})
+	p.h.Go("Selector", func(ctx context.Context) {
+		p.refresh(ctx, util.EnvDurationWithDefault("SELECTOR_REFRESH_INTERVAL", 5*time.Second))
+	})
+	p.h.OnReload("Selector", p.layouts.Reload)
+
+	p.h.API().HandleFunc("GET /selector/layouts", p.handleList)
+	p.h.API().HandleFunc("PUT /selector/layouts/{name}", p.handleSet)
+	p.h.API().HandleFunc("DELETE /selector/layouts/{name}", p.handleDelete)
+
+	return nil
+}
+
+type count struct {
+	players, servers int
+}
+
+// build renders the layout for the player. counts caches the counts of
+// targets, so a refresh looks every target up once for all players.
+func (p *SelectorPlugin) build(ctx context.Context, player proxy.Player, layout Layout, counts map[string]count) *menus.Menu {
+	menu := menus.NewMenu(layout.Title, layout.Rows)
+
+	for _, entry := range layout.Entries {
+		if entry.Permission != "" && !player.HasPermission(entry.Permission) {
+			continue
+		}
+
+		item := entry.Item
+		if entry.Target != "" {
+			c, ok := counts[entry.Target]
+			if !ok {
+				players, servers, err := p.mgr.Online(ctx, entry.Target)
+				if err != nil {
+					log.Printf("Failed to count players of %s: %v", entry.Target, err)
+				}
+
+				c = count{players: players, servers: servers}
+				counts[entry.Target] = c
+			}
+
+			r := strings.NewReplacer("{players}", strconv.Itoa(c.players), "{servers}", strconv.Itoa(c.servers))
+			item.Name = r.Replace(item.Name)
+			item.Lore = make([]string, len(entry.Item.Lore))
+			for i, line := range entry.Item.Lore {
+				item.Lore[i] = r.Replace(line)
+			}
+		}
+
+		menu.Set(entry.Slot, menus.Button{Item: item, OnClick: func(c menus.Click) {
+			p.click(c, entry)
+		}})
+	}
+
+	menu.OnClose = func(player proxy.Player) {
+		p.m.Lock()
+		delete(p.open, player.ID())
+		p.m.Unlock()
+	}
+
+	return menu
+}
+
+func (p *SelectorPlugin) Open(ctx context.Context, player proxy.Player, name string) error {
+	layout, ok := p.layouts.Get(name)
+	if !ok {
+		return ErrLayoutNotFound
+	}
+
+	menu := p.build(ctx, player, layout, make(map[string]count))
+	if err := p.menus.Open(player, menu); err != nil {
+		return err
+	}
+
+	p.m.Lock()
+	p.open[player.ID()] = opened{player: player, layout: name, menu: menu}
+	p.m.Unlock()
+
+	return nil
+}
+
+func (p *SelectorPlugin) click(c menus.Click, entry Entry) {
+	ctx, cancel := context.WithTimeout(p.h.Context(), 10*time.Second)
+	defer cancel()
+
+	if entry.Layout != "" {
+		if err := p.Open(ctx, c.Player, entry.Layout); err != nil {
+			log.Printf("Failed to open selector layout %s for %s: %v", entry.Layout, c.Player.Username(), err)
+		}
+		return
+	}
+
+	if entry.Target == "" {
+		return
+	}
+
+	_ = c.Close()
+
+	server, err := p.mgr.FindServer(ctx, entry.Target)
+	if err != nil {
+		_ = c.Player.SendMessage(&Text{Content: "There is no server available right now.", S: Style{Color: color.Red}})
+		return
+	}
+
+	if _, err := p.mgr.Connect(ctx, c.Player, server); err != nil {
+		log.Printf("Failed to connect %s to %s: %v", c.Player.Username(), server.ServerInfo().Name(), err)
+	}
+}
+
+// refresh rebuilds open selector menus with the current player counts.
+func (p *SelectorPlugin) refresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.m.Lock()
+		open := make([]opened, 0, len(p.open))
+		for id, o := range p.open {
+			// The player opened another menu or left the server
+			if current, ok := p.menus.Current(o.player); !ok || current != o.menu {
+				delete(p.open, id)
+				continue
+			}
+
+			open = append(open, o)
+		}
+		p.m.Unlock()
+
+		counts := make(map[string]count)
+		for _, o := range open {
+			layout, ok := p.layouts.Get(o.layout)
+			if !ok {
+				continue
+			}
+
+			menu := p.build(ctx, o.player, layout, counts)
+			if err := p.menus.Open(o.player, menu); err != nil {
+				continue
+			}
+
+			p.m.Lock()
+			p.open[o.player.ID()] = opened{player: o.player, layout: o.layout, menu: menu}
+			p.m.Unlock()
+		}
+	}
+}
+
+func (p *SelectorPlugin) onMessage(msg bridge.Message) {
+	req := openRequest{}
+	if err := msg.Decode(&req); err != nil {
+		log.Printf("Invalid selector message from %s: %v", msg.Server.ServerInfo().Name(), err)
+		return
+	}
+
+	if req.Layout == "" {
+		req.Layout = p.defaultLayout
+	}
+
+	go func() {
+		defer p.h.Recover("Selector")
+
+		if err := p.Open(p.h.Context(), msg.Player, req.Layout); err != nil {
+			log.Printf("Failed to open selector layout %s for %s: %v", req.Layout, msg.Player.Username(), err)
+		}
+	}()
+}
+
+func (p *SelectorPlugin) selectorCommand() brigodier.LiteralNodeBuilder {
+	open := func(c *command.Context, name string) error {
+		player, ok := c.Source.(proxy.Player)
+		if !ok {
+			return c.Source.SendMessage(&Text{Content: "Only players can open the selector.", S: Style{Color: color.Red}})
+		}
+
+		if err := p.Open(c.Context, player, name); errors.Is(err, ErrLayoutNotFound) {
+			return c.Source.SendMessage(&Text{Content: "There is no selector called " + name + ".", S: Style{Color: color.Red}})
+		} else if errors.Is(err, menus.ErrNoServer) {
+			return c.Source.SendMessage(&Text{Content: "The selector opens once you're on a server.", S: Style{Color: color.Red}})
+		} else if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	return brigodier.Literal("selector").
+		Then(brigodier.
+			Argument("layout", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				return open(c, c.String("layout"))
+			}))).
+		Executes(command.Command(func(c *command.Context) error {
+			return open(c, p.defaultLayout)
+		}))
+}
+
+func (p *SelectorPlugin) handleList(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.layouts.List())
+}
+
+func (p *SelectorPlugin) handleSet(w http.ResponseWriter, r *http.Request) {
+	layout := Layout{}
+	if err := api.ReadJSON(r, &layout); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	layout.Name = r.PathValue("name")
+
+	if err := layout.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.layouts.Set(r.Context(), layout); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "selector.set",
+		Target:  layout.Name,
+		Details: map[string]string{"entries": strconv.Itoa(len(layout.Entries))},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, layout)
+}
+
+func (p *SelectorPlugin) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if err := p.layouts.Delete(r.Context(), name); errors.Is(err, ErrLayoutNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "selector.delete", Target: name}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+// Package sessions restores the session of players transferred from another
+// proxy. Gate can't read cookies, so the backend co-plugin reads the session
+// cookie when the player arrives and hands it over on a bridge channel.
+package sessions
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/sessions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/transfer"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/bridge"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Channel the proxy asks the backend co-plugin on for a cookie, with
+// {"cookie":"csmc:session"}. The co-plugin answers {"value":"<base64>"}, or
+// an empty value if the client has no such cookie.
+const Channel = "csmc:session"
+
+var restoredTotal = metrics.NewCounterVec("gate_sessions_restored_total", "Sessions of transferred players, by result.", "result")
+
+type cookieRequest struct {
+	Cookie string `json:"cookie"`
+}
+
+type cookieResponse struct {
+	Value string `json:"value"`
+}
+
+type SessionsPlugin struct {
+	prx     *proxy.Proxy
+	h       *hosting.Hosting
+	mgr     *hosting.InstanceManager
+	signer  *sessions.Signer
+	channel *bridge.Channel
+}
+
+func New(h *hosting.Hosting, b *bridge.Bridge) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Sessions",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			if h.Sessions() == nil {
+				log.Println("Session tokens are disabled, set SESSION_TOKENS to restore sessions after transfers")
+				return nil
+			}
+
+			mgr, err := h.InstanceManager(ctx, prx)
+			if err != nil {
+				return err
+			}
+
+			channel, err := b.Register(Channel, nil)
+			if err != nil {
+				return err
+			}
+
+			p := &SessionsPlugin{prx: prx, h: h, mgr: mgr, signer: h.Sessions(), channel: channel}
+			event.Subscribe(prx.Event(), 0, hosting.Guard(h, "Sessions", p.onPostConnect))
+
+			return nil
+		},
+	}, nil
+}
+
+// onPostConnect asks for the session cookie once the player is on its first
+// server, the co-plugin can't read cookies before.
+func (p *SessionsPlugin) onPostConnect(e *proxy.ServerPostConnectEvent) {
+	player := e.Player()
+	if e.PreviousServer() != nil || player.Protocol() < transfer.MinProtocol {
+		return
+	}
+
+	p.h.Go("Sessions", func(ctx context.Context) {
+		result := p.restore(ctx, player)
+		restoredTotal.Inc(result)
+	})
+}
+
+// restore returns the result for gate_sessions_restored_total.
+func (p *SessionsPlugin) restore(ctx context.Context, player proxy.Player) string {
+	res := cookieResponse{}
+	if err := p.channel.Request(ctx, player.ID(), cookieRequest{Cookie: sessions.Cookie}, &res); err != nil {
+		log.Printf("Failed to read the session cookie of %s: %v", player.Username(), err)
+		return "error"
+	}
+
+	if res.Value == "" {
+		return "none"
+	}
+
+	token, err := base64.StdEncoding.DecodeString(res.Value)
+	if err != nil {
+		return "invalid"
+	}
+
+	session, err := p.signer.Verify(ctx, string(token), time.Now())
+	if errors.Is(err, sessions.ErrExpired) {
+		return "expired"
+	} else if errors.Is(err, sessions.ErrInvalidToken) {
+		log.Printf("Rejected the session token of %s: %v", player.Username(), err)
+		return "invalid"
+	} else if err != nil {
+		log.Printf("Failed to verify the session token of %s: %v", player.Username(), err)
+		return "error"
+	}
+
+	// A token is only good for the player it was issued to, not whoever
+	// copied the cookie
+	if session.Player != player.ID() {
+		log.Printf("Rejected the session token of %s issued to %s", player.Username(), session.Player)
+		return "invalid"
+	}
+
+	if session.Party != "" {
+		if err := p.mgr.SetStickyKey(ctx, player.ID(), session.Party, 0); err != nil {
+			log.Printf("Failed to restore the party of %s: %v", player.Username(), err)
+		}
+	}
+
+	current := player.CurrentServer()
+	if server := p.prx.Server(session.Server); server != nil && current != nil && current.Server().ServerInfo().Name() != session.Server {
+		if _, err := p.mgr.Connect(ctx, player, server); err != nil {
+			log.Printf("Failed to reconnect %s to %s: %v", player.Username(), session.Server, err)
+		}
+	}
+
+	return "restored"
+}
@@ -0,0 +1,249 @@
+package shield
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+)
+
+const blockKeyPrefix = "block."
+
+// reasonUnavailable is the reason of the blocks returned while the blocks
+// can't be loaded and the policy is fail-closed.
+const reasonUnavailable = "unavailable"
+
+var ErrNotBlocked = errors.New("ip is not blocked")
+
+type Block struct {
+	IP     string    `json:"ip"`
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
+}
+
+// blockKey maps an IP to a KV key, KV keys can't contain the colons of IPv6
+// addresses.
+func blockKey(ip string) string {
+	return blockKeyPrefix + strings.ReplaceAll(ip, ":", "-")
+}
+
+// Blocks keeps the IP blocks of all proxies in memory.
+type Blocks struct {
+	h      *hosting.Hosting
+	kv     kv.Bucket
+	blocks map[string]Block
+	loaded bool
+	policy hosting.Availability
+	m      sync.RWMutex
+}
+
+// NewBlocks starts out empty, the blocks are loaded by the "bans" warmup.
+func NewBlocks(h *hosting.Hosting, bucket kv.Bucket) *Blocks {
+	return &Blocks{
+		h:      h,
+		kv:     bucket,
+		blocks: make(map[string]Block),
+		policy: h.Availability("Shield", hosting.AvailabilityLastKnown),
+	}
+}
+
+// warm loads the blocks, or with the last-known policy the snapshot if KV is
+// unreachable.
+func (b *Blocks) warm(ctx context.Context) error {
+	err := b.Reload(ctx)
+	if err == nil || b.policy != hosting.AvailabilityLastKnown {
+		return err
+	}
+
+	blocks := make(map[string]Block)
+	saved, snapErr := b.h.LoadSnapshot(b.kv.Name(), &blocks)
+	if snapErr != nil {
+		log.Printf("Failed to load shield snapshot: %v", snapErr)
+		return err
+	}
+
+	b.m.Lock()
+	b.blocks = blocks
+	b.m.Unlock()
+
+	log.Printf("Using the blocks snapshot from %s until KV is reachable: %v", saved.Format(time.RFC3339), err)
+
+	return nil
+}
+
+// saveSnapshot must be called with the lock held.
+func (b *Blocks) saveSnapshot() {
+	if err := b.h.SaveSnapshot(b.kv.Name(), b.blocks); err != nil {
+		log.Printf("Failed to save shield snapshot: %v", err)
+	}
+}
+
+func (b *Blocks) Reload(ctx context.Context) error {
+	keys, err := b.kv.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	blocks := make(map[string]Block)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, blockKeyPrefix) {
+			continue
+		}
+
+		raw, err := b.kv.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		block := Block{}
+		if err := json.Unmarshal(raw, &block); err != nil {
+			log.Printf("Failed to unmarshal block %s: %v", key, err)
+			continue
+		}
+
+		blocks[block.IP] = block
+	}
+
+	b.m.Lock()
+	b.blocks = blocks
+	b.loaded = true
+	b.saveSnapshot()
+	b.m.Unlock()
+
+	return nil
+}
+
+func (b *Blocks) handleChange(v *kv.Value) {
+	if v == nil {
+		// Blocks deleted while running from the snapshot aren't replayed
+		b.m.RLock()
+		loaded := b.loaded
+		b.m.RUnlock()
+
+		if !loaded {
+			if err := b.Reload(context.Background()); err != nil {
+				log.Printf("Failed to reload blocks: %v", err)
+			}
+		}
+		return
+	}
+
+	if !strings.HasPrefix(v.Key, blockKeyPrefix) {
+		return
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+	defer b.saveSnapshot()
+
+	switch v.Operation {
+	case kv.Put:
+		block := Block{}
+		if err := json.Unmarshal(v.Value, &block); err != nil {
+			log.Printf("Failed to unmarshal block %s: %v", v.Key, err)
+			return
+		}
+
+		b.blocks[block.IP] = block
+
+	case kv.Delete:
+		for ip := range b.blocks {
+			if blockKey(ip) == v.Key {
+				delete(b.blocks, ip)
+			}
+		}
+	}
+}
+
+// Blocked returns the block of the IP if it is blocked right now. While the
+// blocks aren't available the availability policy decides.
+func (b *Blocks) Blocked(ip string, now time.Time) (Block, bool) {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	if !b.loaded || !b.h.Connected(b.kv.Name()) {
+		switch b.policy {
+		case hosting.AvailabilityOpen:
+			return Block{}, false
+		case hosting.AvailabilityClosed:
+			return Block{IP: ip, Reason: reasonUnavailable, Until: now}, true
+		}
+	}
+
+	block, ok := b.blocks[ip]
+	if !ok || now.After(block.Until) {
+		return Block{}, false
+	}
+
+	return block, true
+}
+
+func (b *Blocks) List() []Block {
+	b.m.RLock()
+	defer b.m.RUnlock()
+
+	list := make([]Block, 0, len(b.blocks))
+	for _, block := range b.blocks {
+		list = append(list, block)
+	}
+
+	slices.SortFunc(list, func(a, b Block) int {
+		return a.Until.Compare(b.Until)
+	})
+
+	return list
+}
+
+func (b *Blocks) Block(ctx context.Context, block Block) error {
+	raw, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	if err := b.kv.Set(ctx, blockKey(block.IP), raw); err != nil {
+		return err
+	}
+
+	b.m.Lock()
+	b.blocks[block.IP] = block
+	b.m.Unlock()
+
+	return nil
+}
+
+func (b *Blocks) Unblock(ctx context.Context, ip string) error {
+	if err := b.kv.Delete(ctx, blockKey(ip)); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrNotBlocked
+	} else if err != nil {
+		return err
+	}
+
+	b.m.Lock()
+	delete(b.blocks, ip)
+	b.m.Unlock()
+
+	return nil
+}
+
+// prune deletes expired blocks from KV. Every proxy prunes, deleting a key
+// that is already gone is harmless.
+func (b *Blocks) prune(ctx context.Context, now time.Time) {
+	for _, block := range b.List() {
+		if now.Before(block.Until) {
+			continue
+		}
+
+		if err := b.Unblock(ctx, block.IP); err != nil && !errors.Is(err, ErrNotBlocked) {
+			log.Printf("Failed to delete expired block of %s: %v", block.IP, err)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package shield
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/filters"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/packets"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var (
+	throttledTotal = metrics.NewCounterVec("gate_shield_packets_throttled_total", "Packets dropped for going over the rate limit of their category.", "category")
+	packetKicks    = metrics.NewCounterVec("gate_shield_packet_kicks_total", "Players kicked for going over a packet rate limit for too long.", "category")
+	filteredTotal  = metrics.NewCounterVec("gate_shield_filtered_total", "Packets that violated a packet filter, by rule.", "rule")
+)
+
+const (
+	Chat    = "chat"
+	Payload = "payload"
+)
+
+// defaultPacketLimits are the packets per second of each category. Gate has
+// no event for movement packets, so movement isn't limited.
+var defaultPacketLimits = map[string]int{Chat: 5, Payload: 30}
+
+// packetRate counts the packets of a player in the current second.
+type packetRate struct {
+	ip     string
+	window time.Time
+	counts map[string]int
+	// over is how many seconds in a row each category went over its limit
+	over map[string]int
+	// drop is whether packets over the limit are dropped this second, the
+	// monitor mode is only asked once per second
+	drop map[string]bool
+	// grace raises the limits until then, after joining a server
+	grace  time.Time
+	kicked bool
+}
+
+func parsePacketLimits() (map[string]int, error) {
+	limits := make(map[string]int, len(defaultPacketLimits))
+	for category, limit := range defaultPacketLimits {
+		limits[category] = limit
+	}
+
+	raw := os.Getenv("SHIELD_PACKET_LIMITS")
+	if raw == "" {
+		return limits, nil
+	}
+
+	configured := make(map[string]int)
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		return nil, fmt.Errorf("SHIELD_PACKET_LIMITS: %w", err)
+	}
+
+	for category, limit := range configured {
+		if _, ok := defaultPacketLimits[category]; !ok {
+			return nil, fmt.Errorf("SHIELD_PACKET_LIMITS: unknown category %q", category)
+		}
+
+		limits[category] = limit
+	}
+
+	return limits, nil
+}
+
+// rate returns the rate of the player, it must be called with p.m held.
+func (p *ShieldPlugin) rate(player proxy.Player) *packetRate {
+	key := strings.ToLower(player.Username())
+
+	r, ok := p.rates[key]
+	if !ok {
+		r = &packetRate{
+			ip:     remoteIP(player.RemoteAddr()),
+			counts: make(map[string]int),
+			over:   make(map[string]int),
+			drop:   make(map[string]bool),
+		}
+		p.rates[key] = r
+	}
+
+	return r
+}
+
+// count counts a packet of the player and reports whether to drop it. A
+// player that stays over the limit for the sustain seconds is kicked.
+func (p *ShieldPlugin) count(player proxy.Player, category string, now time.Time) bool {
+	limit := p.packetLimits[category]
+	if limit <= 0 {
+		return false
+	}
+
+	p.m.Lock()
+	r := p.rate(player)
+
+	if now.Sub(r.window) >= time.Second {
+		// Seconds without a packet don't count as over the limit
+		contiguous := now.Sub(r.window) < 2*time.Second
+
+		for c := range p.packetLimits {
+			if contiguous && r.counts[c] > p.limit(r, c) {
+				r.over[c]++
+			} else {
+				r.over[c] = 0
+			}
+		}
+
+		clear(r.counts)
+		clear(r.drop)
+		r.window = now
+	}
+
+	r.counts[category]++
+	limit = p.limit(r, category)
+
+	exceeded := r.counts[category] > limit
+	first := r.counts[category] == limit+1
+	kick := exceeded && r.over[category] >= p.packetSustain-1 && !r.kicked
+	if kick {
+		r.kicked = true
+	}
+	ip := r.ip
+	p.m.Unlock()
+
+	if !exceeded {
+		return false
+	}
+
+	if first {
+		drop := p.h.Enforce("Shield", "packet_throttle", player.Username())
+
+		p.m.Lock()
+		r.drop[category] = drop
+		p.m.Unlock()
+	}
+
+	if kick {
+		go p.kick(player, ip, category, limit)
+	}
+
+	p.m.Lock()
+	drop := r.drop[category]
+	p.m.Unlock()
+
+	if drop {
+		throttledTotal.Inc(category)
+	}
+
+	return drop
+}
+
+// limit returns the limit of the category, raised during the grace period
+// and tightened in incident mode. It must be called with p.m held.
+func (p *ShieldPlugin) limit(r *packetRate, category string) int {
+	limit := p.tightened(p.packetLimits[category])
+	if time.Now().Before(r.grace) {
+		limit *= p.graceFactor
+	}
+
+	return limit
+}
+
+func (p *ShieldPlugin) kick(player proxy.Player, ip, category string, limit int) {
+	defer p.h.Recover("Shield")
+
+	log.Printf("%s (%s) sent more than %d %s packets a second for %d seconds", player.Username(), ip, limit, category, p.packetSustain)
+	p.h.Tracef(player.Username(), "shield: over the %s packet limit of %d/s for %ds", category, limit, p.packetSustain)
+
+	if !p.h.Enforce("Shield", "packet_kick", player.Username()) {
+		return
+	}
+
+	packetKicks.Inc(category)
+	player.Disconnect(&Text{Content: "You are sending too many packets.", S: Style{Color: color.Red}})
+	p.strike(ip, "packet_flood")
+}
+
+// filtered acts on a packet of the player violating the rule and reports
+// whether to drop it. Rules that kick also strike the IP of the player.
+func (p *ShieldPlugin) filtered(player proxy.Player, r filters.Rule, why string) bool {
+	filteredTotal.Inc(r.Name)
+
+	log.Printf("%s (%s) sent a packet violating filter %s: %s", player.Username(), player.RemoteAddr(), r.Name, why)
+	p.h.Tracef(player.Username(), "shield: packet violates filter %s (%s)", r.Name, why)
+
+	if !p.h.Enforce("Shield", "filter_"+r.Name, player.Username()) {
+		return false
+	}
+
+	if r.Kicks() {
+		p.m.Lock()
+		rate := p.rate(player)
+		kicked := rate.kicked
+		rate.kicked = true
+		p.m.Unlock()
+
+		if !kicked {
+			go func() {
+				defer p.h.Recover("Shield")
+
+				player.Disconnect(&Text{Content: "You sent an invalid packet.", S: Style{Color: color.Red}})
+				p.strike(remoteIP(player.RemoteAddr()), "exploit")
+			}()
+		}
+	}
+
+	return true
+}
+
+// grace raises the limits of the player for a while, clients send bursts
+// while the chunks of a new server load.
+func (p *ShieldPlugin) grace(player proxy.Player) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.rate(player).grace = time.Now().Add(p.gracePeriod)
+}
+
+func (p *ShieldPlugin) onChat(e *proxy.PlayerChatEvent) {
+	if e.Allowed() && p.count(e.Player(), Chat, time.Now()) {
+		e.SetAllowed(false)
+	}
+}
+
+func (p *ShieldPlugin) onCommand(e *proxy.CommandExecuteEvent) {
+	player, ok := e.Source().(proxy.Player)
+	if ok && p.count(player, Chat, time.Now()) {
+		e.SetAllowed(false)
+	}
+}
+
+func (p *ShieldPlugin) onPluginMessage(e *proxy.PluginMessageEvent) {
+	player, ok := e.Source().(proxy.Player)
+	if !ok || !e.Allowed() {
+		return
+	}
+
+	if r, why, ok := p.h.Filters().Payload(e.Identifier().ID(), e.Data()); ok && p.filtered(player, r, why) {
+		e.SetForward(false)
+		return
+	}
+
+	if p.count(player, Payload, time.Now()) {
+		e.SetForward(false)
+	}
+}
+
+func (p *ShieldPlugin) onServerPostConnect(e *proxy.ServerPostConnectEvent) {
+	p.grace(e.Player())
+}
+
+func (p *ShieldPlugin) onPostLogin(e *proxy.PostLoginEvent) {
+	p.grace(e.Player())
+}
+
+func (p *ShieldPlugin) onDisconnect(e *proxy.DisconnectEvent) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	delete(p.rates, strings.ToLower(e.Player().Username()))
+}
+
+// observer checks the packets decoded by the packet inspector against the
+// packet filters. Gate has no event for them and decrypts packets where
+// plugins can't reach, so only players the inspector decodes throughout are
+// covered: those on offline listeners. Online mode players are encrypted
+// from login on and never checked. Packets can't be dropped from here,
+// violations only kick.
+type observer struct {
+	p *ShieldPlugin
+}
+
+func (o observer) Wants(player string) bool {
+	return player != ""
+}
+
+func (o observer) Observe(pk packets.Packet) {
+	if pk.Direction != packets.Serverbound || pk.State != packets.Game {
+		return
+	}
+
+	r, why, violated := o.p.h.Filters().Packet(pk.Protocol, pk.ID, pk.Data)
+	if !violated {
+		return
+	}
+
+	if player := o.p.prx.PlayerByName(pk.Player); player != nil {
+		o.p.filtered(player, r, why)
+	}
+}
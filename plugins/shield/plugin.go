@@ -0,0 +1,349 @@
+// Package shield rate limits handshakes and login attempts per IP and blocks
+// IPs that keep misbehaving on every proxy for a while.
+package shield
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/correlation"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var (
+	strikesTotal = metrics.NewCounterVec("gate_shield_strikes_total", "Misbehaviour recorded per IP, by reason.", "reason")
+	blocksTotal  = metrics.NewCounterVec("gate_shield_blocks_total", "IPs blocked automatically.")
+	deniedTotal  = metrics.NewCounterVec("gate_shield_denied_total", "Logins denied because the IP is blocked.")
+)
+
+// validUsername matches the names Mojang allows, anything else in a login
+// start packet comes from a bot or a broken client.
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+
+type record struct {
+	window     time.Time
+	handshakes int
+	strikes    int
+}
+
+type ShieldPlugin struct {
+	h      *hosting.Hosting
+	prx    *proxy.Proxy
+	blocks *Blocks
+
+	// handshakes is the number of handshakes an IP may send per minute
+	handshakes int
+	// strikes within window block an IP for duration
+	strikes  int
+	window   time.Duration
+	duration time.Duration
+
+	// packetLimits are the packets per second of each category a player
+	// may send, over it packets are dropped and packetSustain seconds in a
+	// row kick. The limits are graceFactor times higher for gracePeriod
+	// after joining a server.
+	packetLimits  map[string]int
+	packetSustain int
+	graceFactor   int
+	gracePeriod   time.Duration
+
+	records map[string]*record
+	// rates are the packet rates by lowercase username
+	rates map[string]*packetRate
+	m     sync.Mutex
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Shield",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_shield")
+			if err != nil {
+				return err
+			}
+
+			limits, err := parsePacketLimits()
+			if err != nil {
+				return err
+			}
+
+			p := &ShieldPlugin{
+				h:          h,
+				prx:        prx,
+				blocks:     NewBlocks(h, bucket),
+				handshakes: util.EnvIntWithDefault("SHIELD_HANDSHAKES_PER_MINUTE", 30),
+				strikes:    util.EnvIntWithDefault("SHIELD_STRIKES", 5),
+				window:     util.EnvDurationWithDefault("SHIELD_STRIKE_WINDOW", 10*time.Minute),
+				duration:   util.EnvDurationWithDefault("SHIELD_BLOCK_DURATION", 30*time.Minute),
+
+				packetLimits:  limits,
+				packetSustain: max(1, util.EnvIntWithDefault("SHIELD_PACKET_SUSTAIN", 3)),
+				graceFactor:   max(1, util.EnvIntWithDefault("SHIELD_PACKET_GRACE_FACTOR", 4)),
+				gracePeriod:   util.EnvDurationWithDefault("SHIELD_PACKET_GRACE", 10*time.Second),
+
+				records: make(map[string]*record),
+				rates:   make(map[string]*packetRate),
+			}
+
+			return p.Init(prx, bucket)
+		},
+	}, nil
+}
+
+func (p *ShieldPlugin) Init(prx *proxy.Proxy, bucket kv.Bucket) error {
+	p.h.Go("Shield", func(ctx context.Context) {
+		kv.Watch(ctx, bucket, p.blocks.handleChange, p.blocks.Reload)
+	})
+	p.h.Go("Shield", p.prune)
+
+	p.h.OnReload("Shield", p.blocks.Reload)
+	p.h.Warmup("bans", hosting.WarmupFailClosed, p.blocks.warm)
+
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Shield", p.onHandshake))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Shield", p.onPreLogin))
+
+	// Before other plugins, so they don't handle what is dropped
+	event.Subscribe(prx.Event(), 1, hosting.Guard(p.h, "Shield", p.onChat))
+	event.Subscribe(prx.Event(), 1, hosting.Guard(p.h, "Shield", p.onCommand))
+	event.Subscribe(prx.Event(), 1, hosting.Guard(p.h, "Shield", p.onPluginMessage))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Shield", p.onPostLogin))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Shield", p.onServerPostConnect))
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Shield", p.onDisconnect))
+
+	p.h.Packets().Observe(observer{p: p})
+
+	p.h.API().HandleFunc("GET /shield/blocks", p.handleListBlocks)
+	p.h.API().HandleFunc("PUT /shield/blocks/{ip}", p.handleBlock)
+	p.h.API().HandleFunc("DELETE /shield/blocks/{ip}", p.handleUnblock)
+
+	return nil
+}
+
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+// record returns the record of the IP, starting a new window if the last one
+// is over. It must be called with p.m held.
+func (p *ShieldPlugin) record(ip string, now time.Time) *record {
+	r, ok := p.records[ip]
+	if !ok || now.Sub(r.window) > p.window {
+		r = &record{window: now}
+		p.records[ip] = r
+	}
+
+	return r
+}
+
+// strike records misbehaviour of the IP and blocks it once it reaches the
+// limit.
+func (p *ShieldPlugin) strike(ip, reason string) {
+	strikesTotal.Inc(reason)
+
+	now := time.Now()
+
+	p.m.Lock()
+	r := p.record(ip, now)
+	r.strikes++
+	block := r.strikes >= p.strikes
+	if block {
+		delete(p.records, ip)
+	}
+	p.m.Unlock()
+
+	if !block || !p.h.Enforce("Shield", "block", ip) {
+		return
+	}
+
+	if _, ok := p.blocks.Blocked(ip, now); ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.h.Context(), 5*time.Second)
+	defer cancel()
+
+	b := Block{IP: ip, Reason: reason, Until: now.Add(p.duration)}
+	if err := p.blocks.Block(ctx, b); err != nil {
+		log.Printf("Failed to block %s: %v", ip, err)
+		return
+	}
+
+	blocksTotal.Inc()
+
+	if err := p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   "shield",
+		Action:  "shield.block",
+		Target:  ip,
+		Details: map[string]string{"reason": reason, "until": b.Until.Format(time.RFC3339)},
+	}); err != nil {
+		log.Printf("Failed to record block of %s: %v", ip, err)
+	}
+
+	log.Printf("Blocked %s until %s: %s", ip, b.Until.Format(time.RFC3339), reason)
+}
+
+// tightened scales a limit by the rate limit percent of incident mode while
+// it is on, never below 1. Limits of 0 are off and stay off.
+func (p *ShieldPlugin) tightened(limit int) int {
+	state, b := p.h.Incident()
+	if !state.Active || limit <= 0 {
+		return limit
+	}
+
+	return max(1, limit*b.RateLimitPercent/100)
+}
+
+func (p *ShieldPlugin) onHandshake(e *proxy.ConnectionHandshakeEvent) {
+	ip := remoteIP(e.Connection().RemoteAddr())
+
+	p.m.Lock()
+	r := p.record(ip, time.Now())
+	r.handshakes++
+	// Every minute of the window allows the configured handshakes
+	flood := float64(r.handshakes) > float64(p.tightened(p.handshakes))*max(1, time.Since(r.window).Minutes())
+	p.m.Unlock()
+
+	if flood {
+		p.strike(ip, "handshake_flood")
+	}
+}
+
+func (p *ShieldPlugin) onPreLogin(e *proxy.PreLoginEvent) {
+	ip := remoteIP(e.Conn().RemoteAddr())
+
+	if b, ok := p.blocks.Blocked(ip, time.Now()); ok && p.h.Enforce("Shield", "blocked", ip) {
+		deniedTotal.Inc()
+
+		content := "Too many invalid connections from your network, try again later."
+		if b.Reason == reasonUnavailable {
+			content = "The proxy can't check connections right now, try again later."
+		}
+
+		e.Deny(&Text{Content: content, S: Style{Color: color.Red}})
+		correlation.Logf(p.h.ConnectionID(e.Conn().RemoteAddr()), "Denied login of %s from blocked %s (%s)", e.Username(), ip, b.Reason)
+		p.h.Tracef(e.Username(), "shield: denied login, %s is blocked (%s)", ip, b.Reason)
+		return
+	}
+
+	if !validUsername.MatchString(e.Username()) {
+		e.Deny(&Text{Content: "Invalid username."})
+		p.strike(ip, "invalid_username")
+		p.h.Tracef(e.Username(), "shield: denied login, invalid username")
+		return
+	}
+
+	p.h.Tracef(e.Username(), "shield: allowed login from %s", ip)
+}
+
+// prune forgets records of IPs whose window is over and deletes expired
+// blocks.
+func (p *ShieldPlugin) prune(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.m.Lock()
+			for ip, r := range p.records {
+				if now.Sub(r.window) > p.window {
+					delete(p.records, ip)
+				}
+			}
+			p.m.Unlock()
+
+			p.blocks.prune(ctx, now)
+		}
+	}
+}
+
+func (p *ShieldPlugin) handleListBlocks(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, p.blocks.List())
+}
+
+type blockRequest struct {
+	Reason  string `json:"reason"`
+	Minutes int    `json:"minutes"`
+}
+
+func (p *ShieldPlugin) handleBlock(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.PathValue("ip"))
+	if ip == nil {
+		api.WriteError(w, http.StatusBadRequest, errors.New("invalid ip"))
+		return
+	}
+
+	req := blockRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	duration := p.duration
+	if req.Minutes > 0 {
+		duration = time.Duration(req.Minutes) * time.Minute
+	}
+
+	b := Block{IP: ip.String(), Reason: req.Reason, Until: time.Now().Add(duration)}
+	if err := p.blocks.Block(r.Context(), b); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{
+		Actor:   "api",
+		Action:  "shield.block",
+		Target:  b.IP,
+		Details: map[string]string{"reason": b.Reason, "minutes": strconv.Itoa(int(duration.Minutes()))},
+	}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, b)
+}
+
+func (p *ShieldPlugin) handleUnblock(w http.ResponseWriter, r *http.Request) {
+	ip := r.PathValue("ip")
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+
+	if err := p.blocks.Unblock(r.Context(), ip); errors.Is(err, ErrNotBlocked) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "shield.unblock", Target: ip}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
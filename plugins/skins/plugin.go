@@ -0,0 +1,340 @@
+// Package skins applies custom skins during login and restores the skins of
+// players that join without Mojang authentication.
+package skins
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/gdpr"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/profiles"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/profile"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var applied = metrics.NewCounterVec("gate_skins_applied_total", "Skins applied at login, by source.", "source")
+
+type SkinsPlugin struct {
+	prx   *proxy.Proxy
+	h     *hosting.Hosting
+	skins *Skins
+
+	// restore gives offline players the skin of the Mojang account with
+	// their name
+	restore bool
+	// fallback is the account whose skin players get if they have none,
+	// e.g. Floodgate players
+	fallback string
+	// timeout bounds the lookups, so a slow Mojang API doesn't hold up logins
+	timeout time.Duration
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Skins",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			skins, err := NewKVSkins(ctx, h)
+			if err != nil {
+				return err
+			}
+
+			p := &SkinsPlugin{
+				prx:      prx,
+				h:        h,
+				skins:    skins,
+				restore:  util.EnvBoolWithDefault("SKINS_RESTORE_OFFLINE", true),
+				fallback: util.EnvWithDefault("SKINS_DEFAULT", ""),
+				timeout:  util.EnvDurationWithDefault("SKINS_LOOKUP_TIMEOUT", 3*time.Second),
+			}
+
+			return p.Init()
+		},
+	}, nil
+}
+
+func (p *SkinsPlugin) Init() error {
+	// Run after the profile of offline players is final
+	event.Subscribe(p.prx.Event(), -1, hosting.Guard(p.h, "Skins", p.onGameProfileRequest))
+
+	p.prx.Command().Register(p.skinCommand())
+
+	p.h.API().HandleFunc("GET /skins/{player}", p.handleGet)
+	p.h.API().HandleFunc("PUT /skins/{player}", p.handleSet)
+	p.h.API().HandleFunc("DELETE /skins/{player}", p.handleDelete)
+
+	p.h.GDPR().Register("skins", gdpr.Subsystem{
+		Export: func(ctx context.Context, player string) (any, error) {
+			skin, err := p.skins.Get(ctx, player)
+			if errors.Is(err, ErrNoSkin) {
+				return nil, nil
+			}
+
+			return skin, err
+		},
+		Erase: func(ctx context.Context, player string) (gdpr.Erasure, error) {
+			if err := p.skins.Delete(ctx, player); errors.Is(err, ErrNoSkin) {
+				return gdpr.Erasure{}, nil
+			} else if err != nil {
+				return gdpr.Erasure{}, err
+			}
+
+			return gdpr.Erasure{Erased: 1}, nil
+		},
+	})
+
+	return nil
+}
+
+// isFloodgate reports whether the UUID is one Floodgate generates for
+// Bedrock players, those have the most significant bits set to zero.
+func isFloodgate(id [16]byte) bool {
+	return id != [16]byte{} && [8]byte(id[:8]) == [8]byte{}
+}
+
+// account returns the UUID of the account whose skin the player gets, or ""
+// to keep the original profile.
+func (p *SkinsPlugin) account(ctx context.Context, original profile.GameProfile) (string, string) {
+	skin, err := p.skins.Get(ctx, original.ID.Undashed())
+	if err == nil {
+		return skin.Account, "custom"
+	} else if !errors.Is(err, ErrNoSkin) {
+		log.Printf("Failed to get skin of %s: %v", original.Name, err)
+	}
+
+	if slices.ContainsFunc(original.Properties, func(prop profile.Property) bool {
+		return prop.Name == "textures" && prop.Signature != ""
+	}) {
+		return "", ""
+	}
+
+	if p.restore && !isFloodgate(original.ID) {
+		id, err := p.h.Profiles().ID(ctx, original.Name)
+		if err == nil {
+			return id, "restored"
+		} else if !errors.Is(err, profiles.ErrProfileNotFound) {
+			log.Printf("Failed to restore skin of %s: %v", original.Name, err)
+			return "", ""
+		}
+	}
+
+	if p.fallback == "" {
+		return "", ""
+	}
+
+	id, err := p.h.Profiles().ID(ctx, p.fallback)
+	if err != nil {
+		log.Printf("Failed to resolve SKINS_DEFAULT %s: %v", p.fallback, err)
+		return "", ""
+	}
+
+	return id, "default"
+}
+
+func (p *SkinsPlugin) onGameProfileRequest(e *proxy.GameProfileRequestEvent) {
+	ctx, cancel := context.WithTimeout(p.h.Context(), p.timeout)
+	defer cancel()
+
+	original := e.GameProfile()
+
+	account, source := p.account(ctx, original)
+	if account == "" {
+		return
+	}
+
+	// The cache refreshes profiles older than PROFILE_TTL, so skins that
+	// changed on the source account are picked up on the next join
+	prof, err := p.h.Profiles().ByUUID(ctx, account)
+	if err != nil {
+		log.Printf("Failed to get skin of %s for %s: %v", account, original.Name, err)
+		return
+	}
+
+	textures, ok := prof.Textures()
+	if !ok || textures.Signature == "" {
+		return
+	}
+
+	properties := slices.DeleteFunc(slices.Clone(original.Properties), func(prop profile.Property) bool {
+		return prop.Name == "textures"
+	})
+	original.Properties = append(properties, profile.Property{Name: textures.Name, Value: textures.Value, Signature: textures.Signature})
+
+	e.SetGameProfile(original)
+	applied.Inc(source)
+}
+
+// set resolves the account and stores it as the skin of the player.
+func (p *SkinsPlugin) set(ctx context.Context, player, account, setBy string) (Skin, error) {
+	resolved, err := p.h.Profiles().ByName(ctx, account)
+	if err != nil {
+		return Skin{}, err
+	}
+
+	skin := Skin{Account: resolved.ID, Name: resolved.Name, SetBy: setBy, Updated: time.Now()}
+	if err := p.skins.Set(ctx, player, skin); err != nil {
+		return Skin{}, err
+	}
+
+	return skin, p.h.Audit().Record(ctx, audit.Entry{
+		Actor:   setBy,
+		Action:  "skins.set",
+		Target:  uuid.Normalize(player),
+		Details: map[string]string{"account": resolved.Name},
+	})
+}
+
+func (p *SkinsPlugin) skinCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("skin").
+		Then(brigodier.Literal("reset").
+			Executes(command.Command(func(c *command.Context) error {
+				player, ok := p.player(c)
+				if !ok {
+					return nil
+				}
+
+				if err := p.skins.Delete(c.Context, player.ID().Undashed()); errors.Is(err, ErrNoSkin) {
+					return c.Source.SendMessage(&Text{Content: "You don't have a custom skin.", S: Style{Color: color.Red}})
+				} else if err != nil {
+					return err
+				}
+
+				if err := p.h.Audit().Record(c.Context, audit.Entry{Actor: player.Username(), Action: "skins.reset", Target: player.ID().Undashed()}); err != nil {
+					return err
+				}
+
+				return c.Source.SendMessage(&Text{Content: "Your skin is reset, rejoin to see it.", S: Style{Color: color.Green}})
+			}))).
+		Then(brigodier.
+			Argument("account", brigodier.String).
+			Executes(command.Command(func(c *command.Context) error {
+				player, ok := p.player(c)
+				if !ok {
+					return nil
+				}
+
+				skin, err := p.set(c.Context, player.ID().Undashed(), c.String("account"), player.Username())
+				if errors.Is(err, profiles.ErrProfileNotFound) {
+					return c.Source.SendMessage(&Text{Content: "There is no Minecraft account with that name.", S: Style{Color: color.Red}})
+				} else if err != nil {
+					return err
+				}
+
+				// Gate can't change the profile of a connected player
+				return c.Source.SendMessage(&Text{Content: "You now wear the skin of " + skin.Name + ", rejoin to see it.", S: Style{Color: color.Green}})
+			})))
+}
+
+// player returns the player running the command if they may change their
+// skin.
+func (p *SkinsPlugin) player(c *command.Context) (proxy.Player, bool) {
+	player, ok := c.Source.(proxy.Player)
+	if !ok {
+		_ = c.Source.SendMessage(&Text{Content: "Only players have skins.", S: Style{Color: color.Red}})
+		return nil, false
+	}
+
+	if !player.HasPermission("csmc.skin") {
+		_ = c.Source.SendMessage(&Text{Content: "You do not have permission to change your skin.", S: Style{Color: color.Red}})
+		return nil, false
+	}
+
+	return player, true
+}
+
+// resolvePlayer accepts a dashed or undashed UUID or a username.
+func (p *SkinsPlugin) resolvePlayer(ctx context.Context, player string) (string, error) {
+	if id := uuid.Normalize(player); len(id) == 32 {
+		return id, nil
+	}
+
+	return p.h.Profiles().ID(ctx, player)
+}
+
+func (p *SkinsPlugin) handleGet(w http.ResponseWriter, r *http.Request) {
+	player, err := p.resolvePlayer(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	skin, err := p.skins.Get(r.Context(), player)
+	if errors.Is(err, ErrNoSkin) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, skin)
+}
+
+type setRequest struct {
+	Account string `json:"account"`
+}
+
+func (p *SkinsPlugin) handleSet(w http.ResponseWriter, r *http.Request) {
+	req := setRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	player, err := p.resolvePlayer(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	skin, err := p.set(r.Context(), player, req.Account, "api")
+	if errors.Is(err, profiles.ErrProfileNotFound) {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if errors.Is(err, profiles.ErrRateLimited) {
+		api.WriteError(w, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, skin)
+}
+
+func (p *SkinsPlugin) handleDelete(w http.ResponseWriter, r *http.Request) {
+	player, err := p.resolvePlayer(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := p.skins.Delete(r.Context(), player); errors.Is(err, ErrNoSkin) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.h.Audit().Record(r.Context(), audit.Entry{Actor: "api", Action: "skins.reset", Target: player}); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
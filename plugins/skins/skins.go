@@ -0,0 +1,62 @@
+package skins
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+)
+
+var ErrNoSkin = errors.New("player has no custom skin")
+
+// Skin makes a player wear the skin of another Mojang account. Only textures
+// signed by Mojang are shown by clients, so skins can't be uploaded directly.
+type Skin struct {
+	// Account is the undashed UUID of the account the skin is copied from.
+	Account string    `json:"account"`
+	Name    string    `json:"name"`
+	SetBy   string    `json:"setBy"`
+	Updated time.Time `json:"updated"`
+}
+
+// Skins stores the custom skins of players, keyed by undashed UUID.
+type Skins struct {
+	kv kv.Bucket
+}
+
+func NewKVSkins(ctx context.Context, h *hosting.Hosting) (*Skins, error) {
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_skins")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Skins{kv: bucket}, nil
+}
+
+func (s *Skins) Get(ctx context.Context, player string) (Skin, error) {
+	skin, ok, err := kv.Typed[Skin](s.kv, uuid.Normalize(player)).Lookup(ctx)
+	if err != nil {
+		return Skin{}, err
+	} else if !ok {
+		return Skin{}, ErrNoSkin
+	}
+
+	return skin, nil
+}
+
+func (s *Skins) Set(ctx context.Context, player string, skin Skin) error {
+	return kv.Typed[Skin](s.kv, uuid.Normalize(player)).Set(ctx, skin)
+}
+
+func (s *Skins) Delete(ctx context.Context, player string) error {
+	if err := s.kv.Delete(ctx, uuid.Normalize(player)); errors.Is(err, kv.ErrKeyNotFound) {
+		return ErrNoSkin
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/webhooks"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// verify checks the signature of a store request, signed like our webhook
+// deliveries: X-Store-Signature is sha256=<hex> of the HMAC-SHA256 of
+// X-Store-Timestamp, a dot and the body.
+func (p *StorePlugin) verify(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get("X-Store-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing timestamp", ErrInvalidSignature)
+	}
+
+	// Orders are fulfilled once anyway, this limits how long a captured
+	// request can be used to look up a receipt
+	if skew := time.Since(time.Unix(unix, 0)).Abs(); skew > p.maxSkew {
+		return fmt.Errorf("%w: timestamp is %s off", ErrInvalidSignature, skew.Round(time.Second))
+	}
+
+	signature, _ := strings.CutPrefix(r.Header.Get("X-Store-Signature"), "sha256=")
+	if !hmac.Equal([]byte(signature), []byte(webhooks.Sign(p.secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// handleOrder is public, stores authenticate with the signature instead of
+// the admin token.
+func (p *StorePlugin) handleOrder(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := p.verify(r, body); err != nil {
+		api.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	o := Order{}
+	if err := api.ReadJSON(r, &o); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	receipt, fresh, err := p.store.Fulfill(r.Context(), "api", o)
+	if errors.Is(err, ErrInvalidOrder) {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusOK
+	if fresh {
+		status = http.StatusCreated
+	}
+
+	api.WriteJSON(w, status, receipt)
+}
+
+func (p *StorePlugin) handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	receipt, err := p.store.Receipt(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, receipt)
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/mail"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/whitelist"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type StorePlugin struct {
+	h     *hosting.Hosting
+	store *Store
+
+	// secret signs the orders of the store, without one the endpoint is off
+	secret  string
+	maxSkew time.Duration
+}
+
+func New(h *hosting.Hosting, perms *permissions.Permissions, wl *whitelist.Whitelist, mb *mail.Mailbox) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Store",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			secret, tebexSecret := util.EnvWithDefault("STORE_SECRET", ""), util.EnvWithDefault("TEBEX_SECRET", "")
+			if secret == "" && tebexSecret == "" {
+				log.Println("The store is disabled, set STORE_SECRET or TEBEX_SECRET to fulfill purchases")
+				return nil
+			}
+
+			store, err := NewKVStore(ctx, h, perms, wl, mb)
+			if err != nil {
+				return err
+			}
+
+			p := &StorePlugin{
+				h:       h,
+				store:   store,
+				secret:  secret,
+				maxSkew: util.EnvDurationWithDefault("STORE_MAX_SKEW", 5*time.Minute),
+			}
+
+			if secret != "" {
+				h.API().HandlePublicFunc("POST /store/orders", p.handleOrder)
+			}
+			h.API().HandleFunc("GET /store/orders/{id}", p.handleGetOrder)
+
+			if tebexSecret != "" {
+				t := &tebex{
+					h:        h,
+					store:    store,
+					client:   &http.Client{Timeout: util.EnvDurationWithDefault("TEBEX_TIMEOUT", 10*time.Second)},
+					url:      util.EnvWithDefault("TEBEX_URL", "https://plugin.tebex.io"),
+					secret:   tebexSecret,
+					interval: util.EnvDurationWithDefault("TEBEX_INTERVAL", 2*time.Minute),
+					seen:     make(map[int64]time.Time),
+				}
+				h.Go("Store", t.Run)
+			}
+
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,347 @@
+// Package store fulfills the purchases of a web store: ranks, whitelisting,
+// whitelist claim codes and mailbox rewards. Orders come from the store over
+// a signed API endpoint or from the Tebex command queue, and every order is
+// fulfilled only once no matter how often it arrives.
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/mail"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/whitelist"
+)
+
+// The fulfillments an order can have.
+const (
+	// KindRank adds the player to Group, for Duration if set
+	KindRank = "rank"
+	// KindWhitelist whitelists the player on the primary network
+	KindWhitelist = "whitelist"
+	// KindCode generates a whitelist claim code for the receipt, e.g. for a
+	// gift
+	KindCode = "code"
+	// KindMail leaves Message and Reward in the mailbox of the player, e.g.
+	// for items the backend hands out when they claim it
+	KindMail = "mail"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusFulfilled = "fulfilled"
+	// StatusFailed is a receipt where at least one fulfillment failed
+	StatusFailed = "failed"
+)
+
+const (
+	// maxAttempts is how often the failed items of an order are tried
+	maxAttempts = 5
+	// fulfillTimeout bounds granting a claimed order, which doesn't stop
+	// when the caller goes away
+	fulfillTimeout = time.Minute
+)
+
+var (
+	ErrInvalidOrder = errors.New("invalid order")
+	ErrNotFound     = errors.New("order not found")
+
+	fulfilledTotal = metrics.NewCounterVec("gate_store_fulfillments_total", "Fulfillments of store orders, by kind and result.", "kind", "result")
+)
+
+type Fulfillment struct {
+	Kind     string       `json:"kind"`
+	Group    string       `json:"group,omitempty"`
+	Duration string       `json:"duration,omitempty"`
+	Message  string       `json:"message,omitempty"`
+	Reward   *mail.Reward `json:"reward,omitempty"`
+}
+
+// Order is a purchase. ID is that of the store, an order with an ID that was
+// fulfilled before gets the receipt of back then.
+type Order struct {
+	ID string `json:"id"`
+	// Player is a username or UUID
+	Player string        `json:"player"`
+	Items  []Fulfillment `json:"items"`
+}
+
+func (o Order) Validate() error {
+	if o.ID == "" || o.Player == "" || len(o.Items) == 0 {
+		return fmt.Errorf("%w: id, player and items are required", ErrInvalidOrder)
+	}
+
+	for _, item := range o.Items {
+		switch item.Kind {
+		case KindRank:
+			if item.Group == "" {
+				return fmt.Errorf("%w: a rank needs a group", ErrInvalidOrder)
+			}
+
+			if item.Duration != "" {
+				if _, err := permissions.ParseDuration(item.Duration); err != nil {
+					return fmt.Errorf("%w: %v", ErrInvalidOrder, err)
+				}
+			}
+		case KindMail:
+			if item.Message == "" {
+				return fmt.Errorf("%w: mail needs a message", ErrInvalidOrder)
+			}
+		case KindWhitelist, KindCode:
+		default:
+			return fmt.Errorf("%w: unknown kind %q", ErrInvalidOrder, item.Kind)
+		}
+	}
+
+	return nil
+}
+
+type Result struct {
+	Fulfillment
+	// Until is when a temporary rank runs out
+	Until *time.Time `json:"until,omitempty"`
+	// Code is the whitelist claim code of a code item
+	Code string `json:"code,omitempty"`
+	// Mail is the mailbox item of a mail item
+	Mail  string `json:"mail,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Receipt is what fulfilling an order did, it is kept in KV for duplicates
+// and recorded in the audit log as store.fulfill.
+type Receipt struct {
+	Order string `json:"order"`
+	// Source is api or tebex
+	Source string    `json:"source"`
+	Player string    `json:"player"`
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	// Attempts is how often the order was tried, the failed items of a
+	// failed receipt are tried again when the order arrives again
+	Attempts int      `json:"attempts"`
+	Results  []Result `json:"results"`
+}
+
+type Store struct {
+	h         *hosting.Hosting
+	kv        kv.Bucket
+	perms     *permissions.Permissions
+	whitelist *whitelist.Whitelist
+	codes     *whitelist.Codes
+	mail      *mail.Mailbox
+}
+
+func NewKVStore(ctx context.Context, h *hosting.Hosting, perms *permissions.Permissions, wl *whitelist.Whitelist, mb *mail.Mailbox) (*Store, error) {
+	bucket, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_store")
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := whitelist.NewKVCodes(ctx, h, wl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{h: h, kv: bucket, perms: perms, whitelist: wl, codes: codes, mail: mb}, nil
+}
+
+// key hashes the order ID, store IDs may have characters KV keys can't.
+func key(order string) string {
+	sum := sha256.Sum256([]byte(order))
+	return "order." + hex.EncodeToString(sum[:16])
+}
+
+// attemptKey is claimed by the proxy that tries a failed order again.
+func attemptKey(order string, attempt int) string {
+	return key(order) + ".attempt." + strconv.Itoa(attempt)
+}
+
+func (s *Store) Receipt(ctx context.Context, order string) (Receipt, error) {
+	r, ok, err := kv.Typed[Receipt](s.kv, key(order)).Lookup(ctx)
+	if err != nil {
+		return Receipt{}, err
+	} else if !ok {
+		return Receipt{}, ErrNotFound
+	}
+
+	return r, nil
+}
+
+// claim claims the next attempt of the order. It returns the receipt to
+// continue and true, or the receipt of an order that was fulfilled, is being
+// fulfilled or failed too often and false.
+func (s *Store) claim(ctx context.Context, r Receipt) (Receipt, bool, error) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return Receipt{}, false, err
+	}
+
+	if err := kv.Create(ctx, s.kv, key(r.Order), raw); err == nil {
+		return r, true, nil
+	} else if !errors.Is(err, kv.ErrKeyExists) {
+		return Receipt{}, false, err
+	}
+
+	previous, err := s.Receipt(ctx, r.Order)
+	if err != nil || previous.Status != StatusFailed || previous.Attempts >= maxAttempts {
+		return previous, false, err
+	}
+
+	// Of the proxies trying the order again one claims the attempt
+	if err := kv.Create(ctx, s.kv, attemptKey(r.Order, previous.Attempts+1), []byte(r.Source)); errors.Is(err, kv.ErrKeyExists) {
+		return previous, false, nil
+	} else if err != nil {
+		return Receipt{}, false, err
+	}
+
+	previous.Attempts++
+
+	return previous, true, nil
+}
+
+// Fulfill grants the items of the order unless it was fulfilled before, then
+// it returns the receipt of back then and false. Orders claim their key
+// before anything is granted, a proxy that dies midway leaves the receipt
+// pending for staff to look at. An order with failed items grants those
+// again when it arrives again, up to maxAttempts times.
+func (s *Store) Fulfill(ctx context.Context, source string, o Order) (Receipt, bool, error) {
+	if err := o.Validate(); err != nil {
+		return Receipt{}, false, err
+	}
+
+	id := uuid.Normalize(o.Player)
+	if len(id) != 32 {
+		var err error
+		if id, err = s.h.Profiles().ID(ctx, o.Player); err != nil {
+			return Receipt{}, false, fmt.Errorf("resolve %s: %w", o.Player, err)
+		}
+	}
+
+	r := Receipt{Order: o.ID, Source: source, Player: id, Status: StatusPending, Time: time.Now().UTC(), Attempts: 1, Results: make([]Result, 0, len(o.Items))}
+
+	r, claimed, err := s.claim(ctx, r)
+	if err != nil || !claimed {
+		return r, false, err
+	}
+
+	// The order is claimed, a caller that goes away must not leave it
+	// half granted
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fulfillTimeout)
+	defer cancel()
+
+	for i, item := range o.Items {
+		// Granted by an earlier attempt
+		if i < len(r.Results) && r.Results[i].Error == "" {
+			continue
+		}
+
+		res := s.fulfill(ctx, o, id, item)
+		if res.Error != "" {
+			fulfilledTotal.Inc(item.Kind, "failed")
+		} else {
+			fulfilledTotal.Inc(item.Kind, "fulfilled")
+		}
+
+		if i < len(r.Results) {
+			r.Results[i] = res
+		} else {
+			r.Results = append(r.Results, res)
+		}
+	}
+
+	r.Status = StatusFulfilled
+	for _, res := range r.Results {
+		if res.Error != "" {
+			r.Status = StatusFailed
+		}
+	}
+
+	if err := kv.Typed[Receipt](s.kv, key(o.ID)).Set(ctx, r); err != nil {
+		log.Printf("Failed to store the receipt of order %s: %v", o.ID, err)
+	}
+
+	summary := make([]string, len(r.Results))
+	for i, res := range r.Results {
+		summary[i] = res.Kind
+		if res.Group != "" {
+			summary[i] += ":" + res.Group
+		}
+		if res.Duration != "" {
+			summary[i] += ":" + res.Duration
+		}
+		if res.Error != "" {
+			summary[i] += ":failed"
+		}
+	}
+
+	// Everything was granted by now, a missing audit entry must not make the
+	// store send the order again
+	if err := s.h.Audit().Record(ctx, audit.Entry{
+		Actor:   "store:" + source,
+		Action:  "store.fulfill",
+		Target:  id,
+		Details: map[string]string{"order": o.ID, "status": r.Status, "attempt": strconv.Itoa(r.Attempts), "items": strings.Join(summary, ",")},
+	}); err != nil {
+		log.Printf("Failed to record the receipt of order %s: %v", o.ID, err)
+	}
+
+	return r, true, nil
+}
+
+func (s *Store) fulfill(ctx context.Context, o Order, player string, item Fulfillment) Result {
+	res := Result{Fulfillment: item}
+
+	switch item.Kind {
+	case KindRank:
+		if _, exists := s.perms.GetGroup(item.Group); !exists {
+			res.Error = "group " + item.Group + " doesn't exist"
+			return res
+		}
+
+		until := time.Time{}
+		if item.Duration != "" {
+			d, _ := permissions.ParseDuration(item.Duration)
+			until = time.Now().Add(d)
+			res.Until = &until
+		}
+
+		if _, err := s.perms.UserAddGroupUntil(ctx, player, item.Group, until); err != nil {
+			res.Error = err.Error()
+		}
+	case KindWhitelist:
+		if s.whitelist.Contains(player) {
+			return res
+		}
+
+		if err := s.whitelist.Add(player); err != nil {
+			res.Error = err.Error()
+		}
+	case KindCode:
+		code, err := s.codes.Generate(ctx, "store:"+o.ID)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		res.Code = code
+	case KindMail:
+		m, err := s.mail.Deposit(ctx, mail.Item{Player: player, From: "store", Message: item.Message, Reward: item.Reward})
+		if err != nil {
+			res.Error = err.Error()
+		}
+		res.Mail = m.ID
+	}
+
+	return res
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/storage"
+)
+
+func newStore(t *testing.T) *Store {
+	k, err := kv.NewJSONClient(storage.NewMemory(), "test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := k.Bucket(context.Background(), "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Store{kv: bucket}
+}
+
+func receipt(order string) Receipt {
+	return Receipt{Order: order, Source: "api", Status: StatusPending, Time: time.Now().UTC(), Attempts: 1}
+}
+
+func TestClaimOnce(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	if _, claimed, err := s.claim(ctx, receipt("order-1")); err != nil || !claimed {
+		t.Fatalf("expected the first claim to succeed, got %v, %v", claimed, err)
+	}
+
+	// A duplicate while the order is being fulfilled gets the pending receipt
+	r, claimed, err := s.claim(ctx, receipt("order-1"))
+	if err != nil || claimed {
+		t.Fatalf("expected the duplicate to be rejected, got %v, %v", claimed, err)
+	}
+
+	if r.Status != StatusPending {
+		t.Fatalf("expected the pending receipt, got %q", r.Status)
+	}
+
+	fulfilled := receipt("order-1")
+	fulfilled.Status = StatusFulfilled
+	if err := kv.Typed[Receipt](s.kv, key("order-1")).Set(ctx, fulfilled); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, claimed, err := s.claim(ctx, receipt("order-1")); err != nil || claimed || r.Status != StatusFulfilled {
+		t.Fatalf("expected the fulfilled receipt, got %q, %v, %v", r.Status, claimed, err)
+	}
+}
+
+func TestClaimRetriesFailed(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	failed := receipt("order-1")
+	failed.Status = StatusFailed
+	failed.Results = []Result{{Fulfillment: Fulfillment{Kind: KindWhitelist}}, {Fulfillment: Fulfillment{Kind: KindRank, Group: "vip"}, Error: "group vip doesn't exist"}}
+	if err := kv.Typed[Receipt](s.kv, key("order-1")).Set(ctx, failed); err != nil {
+		t.Fatal(err)
+	}
+
+	r, claimed, err := s.claim(ctx, receipt("order-1"))
+	if err != nil || !claimed {
+		t.Fatalf("expected the failed order to be claimed again, got %v, %v", claimed, err)
+	}
+
+	if r.Attempts != 2 || len(r.Results) != 2 {
+		t.Fatalf("expected attempt 2 with the earlier results, got %d with %d", r.Attempts, len(r.Results))
+	}
+
+	// Another proxy trying the same attempt loses
+	if _, claimed, err := s.claim(ctx, receipt("order-1")); err != nil || claimed {
+		t.Fatalf("expected the concurrent retry to be rejected, got %v, %v", claimed, err)
+	}
+}
+
+func TestClaimGivesUp(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t)
+
+	failed := receipt("order-1")
+	failed.Status, failed.Attempts = StatusFailed, maxAttempts
+	if err := kv.Typed[Receipt](s.kv, key("order-1")).Set(ctx, failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, claimed, err := s.claim(ctx, receipt("order-1")); err != nil || claimed || r.Status != StatusFailed {
+		t.Fatalf("expected the failed receipt after %d attempts, got %q, %v, %v", maxAttempts, r.Status, claimed, err)
+	}
+}
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/cluster"
+)
+
+type tebexPlayer struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+type tebexCommand struct {
+	ID         int64  `json:"id"`
+	Command    string `json:"command"`
+	Payment    int64  `json:"payment"`
+	Conditions struct {
+		// Delay is how many seconds after the purchase the command runs
+		Delay int `json:"delay"`
+	} `json:"conditions"`
+	// Player is only set on offline commands
+	Player *tebexPlayer `json:"player"`
+}
+
+type tebexQueue struct {
+	Meta struct {
+		ExecuteOffline bool `json:"execute_offline"`
+		NextCheck      int  `json:"next_check"`
+	} `json:"meta"`
+	Players []tebexPlayer `json:"players"`
+}
+
+type tebexCommands struct {
+	Commands []tebexCommand `json:"commands"`
+}
+
+// tebex polls the command queue of a Tebex webstore like their server
+// plugins do. The commands are fulfillments instead of console commands:
+//
+//	rank {uuid} vip 30d
+//	whitelist {uuid}
+//	code {uuid}
+//
+// None of them needs the player online, so online commands run right away.
+type tebex struct {
+	h        *hosting.Hosting
+	store    *Store
+	client   *http.Client
+	url      string
+	secret   string
+	interval time.Duration
+
+	// seen is when commands were first seen, for their delay, or when a
+	// command that isn't a fulfillment was logged
+	seen map[int64]time.Time
+}
+
+// Run polls on the cluster leader, as often as Tebex asks for.
+func (t *tebex) Run(ctx context.Context) {
+	wait := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		wait = t.interval
+
+		instances, err := t.h.Cluster().Instances(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to list the cluster for the Tebex queue: %v", err)
+			continue
+		}
+
+		if cluster.Leader(instances) != t.h.Info.PodName {
+			continue
+		}
+
+		next, err := t.poll(ctx)
+		if err != nil {
+			log.Printf("Failed to poll the Tebex queue: %v", err)
+			continue
+		}
+
+		if next > 0 {
+			wait = next
+		}
+	}
+}
+
+// poll fulfills the commands in the queue and returns when to poll next.
+func (t *tebex) poll(ctx context.Context) (time.Duration, error) {
+	queue := tebexQueue{}
+	if err := t.do(ctx, http.MethodGet, "/queue", &queue); err != nil {
+		return 0, err
+	}
+
+	type queued struct {
+		player  tebexPlayer
+		command tebexCommand
+	}
+
+	var commands []queued
+	if queue.Meta.ExecuteOffline {
+		offline := tebexCommands{}
+		if err := t.do(ctx, http.MethodGet, "/queue/offline-commands", &offline); err != nil {
+			return 0, err
+		}
+
+		for _, c := range offline.Commands {
+			if c.Player != nil {
+				commands = append(commands, queued{*c.Player, c})
+			}
+		}
+	}
+
+	for _, player := range queue.Players {
+		online := tebexCommands{}
+		if err := t.do(ctx, http.MethodGet, "/queue/online-commands/"+strconv.FormatInt(player.ID, 10), &online); err != nil {
+			return 0, err
+		}
+
+		for _, c := range online.Commands {
+			commands = append(commands, queued{player, c})
+		}
+	}
+
+	var done []int64
+	polled := make(map[int64]bool, len(commands))
+	for _, q := range commands {
+		polled[q.command.ID] = true
+		if t.run(ctx, q.player, q.command) {
+			done = append(done, q.command.ID)
+		}
+	}
+
+	// Commands removed in Tebex are forgotten
+	for id := range t.seen {
+		if !polled[id] {
+			delete(t.seen, id)
+		}
+	}
+
+	if len(done) > 0 {
+		q := url.Values{}
+		for _, id := range done {
+			q.Add("ids[]", strconv.FormatInt(id, 10))
+			delete(t.seen, id)
+		}
+
+		if err := t.do(ctx, http.MethodDelete, "/queue?"+q.Encode(), nil); err != nil {
+			return 0, fmt.Errorf("mark %d commands done: %w", len(done), err)
+		}
+	}
+
+	return time.Duration(queue.Meta.NextCheck) * time.Second, nil
+}
+
+// run fulfills the command and reports whether it can leave the queue.
+// Commands that aren't fulfillments stay for staff to see in Tebex, as do
+// failed ones, which are tried again on the next polls.
+func (t *tebex) run(ctx context.Context, player tebexPlayer, c tebexCommand) bool {
+	now := time.Now()
+	first, ok := t.seen[c.ID]
+	if !ok {
+		first = now
+		t.seen[c.ID] = now
+	}
+
+	order, err := parseTebexCommand(c, player)
+	if err != nil {
+		if !ok {
+			log.Printf("Skipping Tebex command %d of payment %d: %v", c.ID, c.Payment, err)
+		}
+		return false
+	}
+
+	if now.Sub(first) < time.Duration(c.Conditions.Delay)*time.Second {
+		return false
+	}
+
+	receipt, fresh, err := t.store.Fulfill(ctx, "tebex", order)
+	if err != nil {
+		log.Printf("Failed to fulfill Tebex command %d: %v", c.ID, err)
+		return false
+	}
+
+	if fresh && receipt.Status == StatusFailed {
+		log.Printf("Failed to fulfill Tebex command %d, attempt %d of %d", c.ID, receipt.Attempts, maxAttempts)
+	}
+
+	// A pending receipt is an earlier attempt that never finished
+	return receipt.Status == StatusFulfilled
+}
+
+// parseTebexCommand turns a command into an order, with the placeholders
+// Tebex leaves to plugins replaced.
+func parseTebexCommand(c tebexCommand, player tebexPlayer) (Order, error) {
+	id := player.UUID
+	if id == "" {
+		id = player.Name
+	}
+
+	command := strings.NewReplacer("{uuid}", id, "{id}", id, "{username}", player.Name, "{name}", player.Name).Replace(c.Command)
+	fields := strings.Fields(strings.TrimPrefix(command, "/"))
+	if len(fields) < 2 {
+		return Order{}, fmt.Errorf("%w: %q is not <kind> <player> ...", ErrInvalidOrder, c.Command)
+	}
+
+	item := Fulfillment{Kind: fields[0]}
+	switch {
+	case item.Kind == KindRank && len(fields) == 3:
+		item.Group = fields[2]
+	case item.Kind == KindRank && len(fields) == 4:
+		item.Group, item.Duration = fields[2], fields[3]
+	case (item.Kind == KindWhitelist || item.Kind == KindCode) && len(fields) == 2:
+	default:
+		return Order{}, fmt.Errorf("%w: unknown command %q", ErrInvalidOrder, c.Command)
+	}
+
+	o := Order{ID: "tebex:" + strconv.FormatInt(c.ID, 10), Player: fields[1], Items: []Fulfillment{item}}
+
+	return o, o.Validate()
+}
+
+func (t *tebex) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, t.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Tebex-Secret", t.secret)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, path, err)
+	}
+
+	return nil
+}
@@ -2,8 +2,10 @@ package tab
 
 import (
 	"context"
+	"strings"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
 	"github.com/robinbraemer/event"
 	"go.minekube.com/common/minecraft/color"
 	c "go.minekube.com/common/minecraft/component"
@@ -11,18 +13,24 @@ import (
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 )
 
-func New(_ *hosting.Hosting) (proxy.Plugin, error) {
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
 	return proxy.Plugin{
 		Name: "Tablist",
 		Init: func(ctx context.Context, proxy *proxy.Proxy) error {
-			event.Subscribe(proxy.Event(), 0, onPostLogin)
+			event.Subscribe(proxy.Event(), 0, hosting.Guard(h, "Tablist", onPostLogin(h)))
 
 			return nil
 		},
 	}, nil
 }
 
-func onPostLogin(e *proxy.ServerPostConnectEvent) {
+func onPostLogin(h *hosting.Hosting) func(*proxy.ServerPostConnectEvent) {
+	return func(e *proxy.ServerPostConnectEvent) {
+		sendTabList(h, e)
+	}
+}
+
+func sendTabList(h *hosting.Hosting, e *proxy.ServerPostConnectEvent) {
 	serverName := "LOADING"
 	if e.Player().CurrentServer() != nil {
 		serverName = e.Player().CurrentServer().Server().ServerInfo().Name()
@@ -42,11 +50,21 @@ func onPostLogin(e *proxy.ServerPostConnectEvent) {
 		},
 	}
 
-	footer := &c.Text{
+	var footer c.Component = &c.Text{
 		Content: "\n  github.com/community-sourced-minecraft  \n",
 		S:       c.Style{Color: color.Yellow},
 	}
 
+	if theme, ok := h.Themes().Current(); ok {
+		if theme.TabHeader != "" {
+			header = &c.Text{Extra: []c.Component{util.Text(strings.ReplaceAll(theme.TabHeader, "{server}", serverName))}}
+		}
+
+		if theme.TabFooter != "" {
+			footer = util.Text(strings.ReplaceAll(theme.TabFooter, "{server}", serverName))
+		}
+	}
+
 	// Most Gate methods are thread-safe and can be called from any goroutine.
 	// We could also handle errors gracefully, like the tab list could not be sent
 	// to the player because they disconnected, but we can often ignore them for simplicity.
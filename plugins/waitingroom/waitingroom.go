@@ -0,0 +1,114 @@
+// Package waitingroom covers for the backends while all of them are down, e.g.
+// during a network restart. Server list pings show a starting up MOTD with a
+// countdown, and logins are held until a backend is back instead of failing
+// right away.
+//
+// Gate has no limbo to keep players in, so logins are held in the login
+// phase. The client gives up on a login after 30 seconds, so players that
+// waited for the hold timeout are disconnected with the countdown instead.
+package waitingroom
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/metrics"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"github.com/robinbraemer/event"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var held = metrics.NewCounterVec("gate_waiting_room_logins_total", "Logins that arrived while every backend was down, by whether a backend recovered in time.", "result")
+
+type Plugin struct {
+	h *hosting.Hosting
+
+	// motd is shown while the backends are down, {countdown} is the time
+	// left of the estimate
+	motd string
+	// message is the disconnect reason of players that waited too long
+	message string
+	// estimate is how long the backends usually take to come back
+	estimate time.Duration
+	// hold is how long logins wait for a backend, 0 disconnects right away
+	hold time.Duration
+}
+
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "WaitingRoom",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			p := &Plugin{
+				h:        h,
+				motd:     util.EnvWithDefault("OFFLINE_MOTD", "&e&lThe network is starting up\n&7Back in {countdown}, hang tight!"),
+				message:  util.EnvWithDefault("OFFLINE_MESSAGE", "&eThe network is starting up.\n&7Please reconnect in {countdown}."),
+				estimate: util.EnvDurationWithDefault("OFFLINE_ESTIMATE", time.Minute),
+				hold:     util.EnvDurationWithDefault("WAITING_ROOM_TIMEOUT", 20*time.Second),
+			}
+
+			return p.Init(prx)
+		},
+	}, nil
+}
+
+func (p *Plugin) Init(prx *proxy.Proxy) error {
+	// Last, the starting up MOTD replaces that of the MOTD and listeners
+	// plugins, and only allowed logins are held
+	event.Subscribe(prx.Event(), -2, hosting.Guard(p.h, "WaitingRoom", p.onPing))
+	event.Subscribe(prx.Event(), -2, hosting.Guard(p.h, "WaitingRoom", p.onLogin))
+
+	return nil
+}
+
+// countdown returns what is left of the estimate since the backends went
+// down.
+func (p *Plugin) countdown(since time.Time) string {
+	left := p.estimate - time.Since(since)
+	if left < time.Second {
+		return "a moment"
+	}
+
+	return left.Round(time.Second).String()
+}
+
+func (p *Plugin) text(format string, since time.Time) Component {
+	return util.Text(strings.ReplaceAll(format, "{countdown}", p.countdown(since)))
+}
+
+func (p *Plugin) onPing(e *proxy.PingEvent) {
+	down, since := p.h.BackendsDown()
+	if !down {
+		return
+	}
+
+	e.Ping().Description = &Text{Extra: []Component{p.text(p.motd, since)}}
+}
+
+func (p *Plugin) onLogin(e *proxy.LoginEvent) {
+	if !e.Allowed() {
+		return
+	}
+
+	down, since := p.h.BackendsDown()
+	if !down {
+		return
+	}
+
+	log.Printf("Holding the login of %s, every backend is down", e.Player().Username())
+	p.h.Tracef(e.Player().Username(), "waiting room: holding the login for up to %s", p.hold)
+
+	ctx, cancel := context.WithTimeout(e.Player().Context(), p.hold)
+	defer cancel()
+
+	if p.h.WaitForBackends(ctx) {
+		held.Inc("released")
+		return
+	}
+
+	held.Inc("timeout")
+	e.Deny(p.text(p.message, since))
+}
@@ -0,0 +1,53 @@
+// Package warmup runs the registered warmups of the hosting once every other
+// plugin initialized. Gate opens its listener after the last plugin, so
+// starting a proxy waits for them, and logins are denied while a fail-closed
+// warmup is still loading.
+package warmup
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/robinbraemer/event"
+	"go.minekube.com/common/minecraft/color"
+	. "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+type Plugin struct {
+	h *hosting.Hosting
+}
+
+// New has to be the last plugin, the others register their warmups while
+// initializing.
+func New(h *hosting.Hosting) (proxy.Plugin, error) {
+	return proxy.Plugin{
+		Name: "Warmup",
+		Init: func(ctx context.Context, prx *proxy.Proxy) error {
+			p := &Plugin{h: h}
+
+			return p.Init(ctx, prx)
+		},
+	}, nil
+}
+
+func (p *Plugin) Init(ctx context.Context, prx *proxy.Proxy) error {
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Warmup", p.onPreLogin))
+
+	return p.h.WarmUp(ctx)
+}
+
+func (p *Plugin) onPreLogin(e *proxy.PreLoginEvent) {
+	blocking := p.h.WarmupBlocking()
+	if len(blocking) == 0 {
+		return
+	}
+
+	e.Deny(&Text{
+		Content: "The proxy is still starting, try again in a moment.",
+		S:       Style{Color: color.Red},
+	})
+	log.Printf("Denied login of %s while waiting for %s", e.Username(), strings.Join(blocking, ", "))
+}
@@ -0,0 +1,187 @@
+package whitelist
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
+)
+
+var (
+	ErrAlreadyWhitelisted = errors.New("player is already whitelisted")
+	ErrNotWhitelisted     = errors.New("player is not whitelisted")
+	ErrUnknownNetwork     = errors.New("unknown network")
+)
+
+type statusResponse struct {
+	Enabled bool     `json:"enabled"`
+	Players []string `json:"players"`
+}
+
+type enabledRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type playerRequest struct {
+	// Player is a username or UUID
+	Player string `json:"player"`
+}
+
+type playerResponse struct {
+	UUID string `json:"uuid"`
+}
+
+func (p *WhitelistPlugin) registerAPI() {
+	p.h.API().HandleFunc("GET /whitelist", p.handleStatus)
+	p.h.API().HandleFunc("PUT /whitelist/enabled", p.handleSetEnabled)
+	p.h.API().HandleFunc("POST /whitelist/players", p.handleAdd)
+	p.h.API().HandleFunc("DELETE /whitelist/players/{player}", p.handleRemove)
+}
+
+// resolvePlayer accepts a dashed or undashed UUID or a username.
+func (p *WhitelistPlugin) resolvePlayer(ctx context.Context, player string) (string, error) {
+	if id := uuid.Normalize(player); len(id) == 32 {
+		return id, nil
+	}
+
+	return p.h.Profiles().ID(ctx, player)
+}
+
+// network returns the whitelist of the network in the network query
+// parameter, the primary one without it. It writes a 404 for unknown ones.
+func (p *WhitelistPlugin) network(w http.ResponseWriter, r *http.Request) (*Whitelist, string, bool) {
+	name := r.URL.Query().Get("network")
+	if name == "" {
+		name = p.h.PrimaryNetwork().Name
+	}
+
+	wl, ok := p.networks[name]
+	if !ok {
+		api.WriteError(w, http.StatusNotFound, ErrUnknownNetwork)
+		return nil, "", false
+	}
+
+	return wl, name, true
+}
+
+func (p *WhitelistPlugin) record(ctx context.Context, network, action, target string) error {
+	return p.h.Audit().Record(ctx, audit.Entry{Actor: "api", Action: action, Target: target, Details: map[string]string{"network": network}})
+}
+
+func (p *WhitelistPlugin) handleStatus(w http.ResponseWriter, r *http.Request) {
+	wl, _, ok := p.network(w, r)
+	if !ok {
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, statusResponse{
+		Enabled: wl.IsEnabled(),
+		Players: wl.AllWhitelisted(),
+	})
+}
+
+func (p *WhitelistPlugin) handleSetEnabled(w http.ResponseWriter, r *http.Request) {
+	wl, network, ok := p.network(w, r)
+	if !ok {
+		return
+	}
+
+	req := enabledRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	action := "whitelist.enable"
+	set := wl.Enable
+	if !req.Enabled {
+		action = "whitelist.disable"
+		set = wl.Disable
+	}
+
+	if err := set(); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.record(r.Context(), network, action, ""); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, enabledRequest{Enabled: wl.IsEnabled()})
+}
+
+func (p *WhitelistPlugin) handleAdd(w http.ResponseWriter, r *http.Request) {
+	wl, network, ok := p.network(w, r)
+	if !ok {
+		return
+	}
+
+	req := playerRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Player == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("player is required"))
+		return
+	}
+
+	id, err := p.resolvePlayer(r.Context(), req.Player)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if wl.Contains(id) {
+		api.WriteError(w, http.StatusConflict, ErrAlreadyWhitelisted)
+		return
+	}
+
+	if err := wl.Add(id); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.record(r.Context(), network, "whitelist.add", id); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusCreated, playerResponse{UUID: id})
+}
+
+func (p *WhitelistPlugin) handleRemove(w http.ResponseWriter, r *http.Request) {
+	wl, network, ok := p.network(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := p.resolvePlayer(r.Context(), r.PathValue("player"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !wl.Contains(id) {
+		api.WriteError(w, http.StatusNotFound, ErrNotWhitelisted)
+		return
+	}
+
+	if err := wl.Remove(id); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := p.record(r.Context(), network, "whitelist.remove", id); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,247 @@
+package whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/api"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/audit"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/profiles"
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+)
+
+const (
+	codeLength    = 8
+	codeExpiresIn = 7 * 24 * time.Hour
+	// markerGrace keeps redeemed markers past the expiry of their code, a
+	// redeem that checked the code just before it expired still finds them.
+	markerGrace = time.Hour
+)
+
+var (
+	ErrCodeNotFound = errors.New("code not found")
+	ErrCodeExpired  = errors.New("code expired")
+)
+
+type Code struct {
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Codes are one-time whitelist application codes. Staff generate them in-game
+// and the application website redeems them for a username over the admin API.
+type Codes struct {
+	whitelist *Whitelist
+	audit     *audit.Log
+	profiles  *profiles.Cache
+	kv        kv.Bucket
+}
+
+func NewKVCodes(ctx context.Context, h *hosting.Hosting, whitelist *Whitelist) (*Codes, error) {
+	kv, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_whitelist_codes")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Codes{
+		whitelist: whitelist,
+		audit:     h.Audit(),
+		profiles:  h.Profiles(),
+		kv:        kv,
+	}, nil
+}
+
+func (c *Codes) Generate(ctx context.Context, createdBy string) (string, error) {
+	code, err := util.RandomCode(codeLength)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	info := Code{
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(codeExpiresIn),
+	}
+
+	if err := kv.Typed[Code](c.kv, code).Set(ctx, info); err != nil {
+		return "", err
+	}
+
+	if err := c.audit.Record(ctx, audit.Entry{
+		Actor:  createdBy,
+		Action: "whitelist.code.generate",
+		Target: code,
+	}); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// redeemedKey marks a code as redeemed. Creating it is what consumes the code,
+// so of two concurrent redeems only one succeeds. It names the creation time
+// too, a later code with the same letters is a different one.
+func redeemedKey(code string, info Code) string {
+	return "redeemed." + code + "." + strconv.FormatInt(info.CreatedAt.UnixNano(), 10)
+}
+
+// Prune deletes expired codes and the redeemed markers of codes that expired
+// more than markerGrace ago. Every proxy prunes, deleting a key that is
+// already gone is harmless.
+func (c *Codes) Prune(ctx context.Context, now time.Time) (int, error) {
+	keys, err := c.kv.ListKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range keys {
+		expired := false
+		if rest, ok := strings.CutPrefix(key, "redeemed."); ok {
+			_, ts, _ := strings.Cut(rest, ".")
+			nanos, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			expired = now.After(time.Unix(0, nanos).Add(codeExpiresIn + markerGrace))
+		} else {
+			info, ok, err := kv.Typed[Code](c.kv, key).Lookup(ctx)
+			if err != nil {
+				log.Printf("Failed to read whitelist code %s: %v", key, err)
+				continue
+			}
+
+			expired = ok && now.After(info.ExpiresAt)
+		}
+
+		if !expired {
+			continue
+		}
+
+		if err := c.kv.Delete(ctx, key); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+type redeemed struct {
+	Username   string    `json:"username"`
+	UUID       string    `json:"uuid"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
+
+// Redeem consumes the code and whitelists the given username. It returns the
+// normalized UUID that was added. The code stays valid if the username can't
+// be resolved.
+func (c *Codes) Redeem(ctx context.Context, code string, username string) (string, error) {
+	info, ok, err := kv.Typed[Code](c.kv, code).Lookup(ctx)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", ErrCodeNotFound
+	}
+
+	if time.Now().After(info.ExpiresAt) {
+		if err := c.kv.Delete(ctx, code); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return "", err
+		}
+
+		return "", ErrCodeExpired
+	}
+
+	id, err := c.profiles.ID(ctx, username)
+	if err != nil {
+		return "", err
+	}
+
+	marker, err := json.Marshal(redeemed{Username: username, UUID: id, RedeemedAt: time.Now()})
+	if err != nil {
+		return "", err
+	}
+
+	if err := kv.Create(ctx, c.kv, redeemedKey(code, info), marker); errors.Is(err, kv.ErrKeyExists) {
+		return "", ErrCodeNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if !c.whitelist.Contains(id) {
+		if err := c.whitelist.Add(id); err != nil {
+			// Nothing was redeemed, the code can be used again
+			if err := c.kv.Delete(ctx, redeemedKey(code, info)); err != nil {
+				log.Printf("Failed to release whitelist code %s: %v", code, err)
+			}
+
+			return "", err
+		}
+	}
+
+	if err := c.kv.Delete(ctx, code); err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+		return "", err
+	}
+
+	if err := c.audit.Record(ctx, audit.Entry{
+		Actor:  "code:" + code,
+		Action: "whitelist.code.redeem",
+		Target: id,
+		Details: map[string]string{
+			"username":  username,
+			"createdBy": info.CreatedBy,
+		},
+	}); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+type redeemRequest struct {
+	Code     string `json:"code"`
+	Username string `json:"username"`
+}
+
+type redeemResponse struct {
+	UUID string `json:"uuid"`
+}
+
+func (c *Codes) handleRedeem(w http.ResponseWriter, r *http.Request) {
+	req := redeemRequest{}
+	if err := api.ReadJSON(r, &req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Code == "" || req.Username == "" {
+		api.WriteError(w, http.StatusBadRequest, errors.New("code and username are required"))
+		return
+	}
+
+	id, err := c.Redeem(r.Context(), req.Code, req.Username)
+	if errors.Is(err, ErrCodeNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if errors.Is(err, ErrCodeExpired) {
+		api.WriteError(w, http.StatusGone, err)
+		return
+	} else if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, redeemResponse{UUID: id})
+}
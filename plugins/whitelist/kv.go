@@ -3,10 +3,10 @@ package whitelist
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"log"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting/kv"
@@ -15,13 +15,36 @@ import (
 type Whitelist struct {
 	Enabled     bool     `json:"enabled"`
 	Whitelisted []string `json:"whitelisted"`
-	m           sync.RWMutex
-	h           *hosting.Hosting
-	kv          kv.Bucket
+	// Added is when each UUID was added, entries from before it was
+	// recorded have none
+	Added map[string]time.Time `json:"added"`
+
+	m  sync.RWMutex
+	h  *hosting.Hosting
+	kv kv.Bucket
+
+	// loaded is set once the whitelist was loaded from KV, policy decides
+	// what Allows does until then and while the watcher is disconnected
+	loaded bool
+	policy hosting.Availability
 }
 
+// whitelistSnapshot is what is saved to disk for the last-known policy.
+type whitelistSnapshot struct {
+	Enabled     bool                 `json:"enabled"`
+	Whitelisted []string             `json:"whitelisted"`
+	Added       map[string]time.Time `json:"added"`
+}
+
+// NewKVWhitelist loads the whitelist bucket and keeps it in sync until the
+// Whitelist plugin is disabled.
 func NewKVWhitelist(ctx context.Context, h *hosting.Hosting) (*Whitelist, error) {
-	kv, err := h.KV().Bucket(ctx, h.Info.KVNetworkKey()+"_whitelist")
+	return NewKVNetworkWhitelist(ctx, h, h.PrimaryNetwork())
+}
+
+// NewKVNetworkWhitelist is NewKVWhitelist for the whitelist of a network.
+func NewKVNetworkWhitelist(ctx context.Context, h *hosting.Hosting, nw *hosting.Network) (*Whitelist, error) {
+	bucket, err := nw.KV().Bucket(ctx, nw.Info.KVNetworkKey()+"_whitelist")
 	if err != nil {
 		return nil, err
 	}
@@ -29,68 +52,128 @@ func NewKVWhitelist(ctx context.Context, h *hosting.Hosting) (*Whitelist, error)
 	w := &Whitelist{
 		Enabled:     false,
 		Whitelisted: make([]string, 0),
+		Added:       make(map[string]time.Time),
 		h:           h,
-		kv:          kv,
+		kv:          bucket,
+		policy:      h.Availability("Whitelist", hosting.AvailabilityLastKnown),
 	}
 
-	watcher, err := kv.WatchAll(context.Background())
-	if err != nil {
-		return nil, err
+	h.Go("Whitelist", func(ctx context.Context) {
+		kv.Watch(ctx, w.kv, w.handleChange, func(ctx context.Context) error {
+			return w.Reload()
+		})
+	})
+	warmup := "whitelist"
+	if !nw.Primary() {
+		warmup += "/" + nw.Name
 	}
+	h.Warmup(warmup, hosting.WarmupFailClosed, w.warm)
 
-	go func() {
-		for key := range watcher.Changes() {
-			if key == nil {
-				continue
-			}
-
-			switch key.Key {
-			case "enabled":
-				log.Printf("Enabled key changed: %s", key.Value)
+	return w, nil
+}
 
-				w.m.Lock()
+// warm loads the whitelist, or with the last-known policy the snapshot if KV
+// is unreachable.
+func (w *Whitelist) warm(ctx context.Context) error {
+	err := w.Reload()
+	if err == nil || w.policy != hosting.AvailabilityLastKnown {
+		return err
+	}
 
-				if err := json.Unmarshal(key.Value, &w.Enabled); err != nil {
-					w.m.Unlock()
-					log.Printf("Failed to unmarshal enabled key: %v", err)
-				}
+	snap := whitelistSnapshot{}
+	saved, snapErr := w.h.LoadSnapshot(w.kv.Name(), &snap)
+	if snapErr != nil {
+		log.Printf("Failed to load whitelist snapshot: %v", snapErr)
+		return err
+	}
 
-				w.m.Unlock()
+	w.m.Lock()
+	w.Enabled, w.Whitelisted = snap.Enabled, snap.Whitelisted
+	if snap.Added != nil {
+		w.Added = snap.Added
+	}
+	w.m.Unlock()
 
-			case "whitelisted":
-				log.Printf("Whitelisted key changed: %s", key.Value)
+	log.Printf("Using the whitelist snapshot from %s until KV is reachable: %v", saved.Format(time.RFC3339), err)
 
-				w.m.Lock()
+	return nil
+}
 
-				if err := json.Unmarshal(key.Value, &w.Whitelisted); err != nil {
-					w.m.Unlock()
-					log.Printf("Failed to unmarshal whitelisted key: %v", err)
-				}
+// saveSnapshot must be called with the lock held.
+func (w *Whitelist) saveSnapshot() {
+	if err := w.h.SaveSnapshot(w.kv.Name(), whitelistSnapshot{Enabled: w.Enabled, Whitelisted: w.Whitelisted, Added: w.Added}); err != nil {
+		log.Printf("Failed to save whitelist snapshot: %v", err)
+	}
+}
 
-				w.m.Unlock()
+func (w *Whitelist) handleChange(key *kv.Value) {
+	if key == nil {
+		// The replay after starting from the snapshot doesn't include keys
+		// deleted since, load everything once
+		w.m.RLock()
+		loaded := w.loaded
+		w.m.RUnlock()
+
+		if !loaded {
+			if err := w.Reload(); err != nil {
+				log.Printf("Failed to reload whitelist: %v", err)
 			}
 		}
-	}()
+		return
+	}
 
-	return w, nil
+	w.m.Lock()
+	defer w.m.Unlock()
+	defer w.saveSnapshot()
+
+	switch key.Key {
+	case "enabled":
+		log.Printf("Enabled key changed: %s", key.Value)
+
+		if err := json.Unmarshal(key.Value, &w.Enabled); err != nil {
+			log.Printf("Failed to unmarshal enabled key: %v", err)
+		}
+
+	case "whitelisted":
+		log.Printf("Whitelisted key changed: %s", key.Value)
+
+		if err := json.Unmarshal(key.Value, &w.Whitelisted); err != nil {
+			log.Printf("Failed to unmarshal whitelisted key: %v", err)
+		}
+
+	case "added":
+		added := make(map[string]time.Time)
+		if err := json.Unmarshal(key.Value, &added); err != nil {
+			log.Printf("Failed to unmarshal added key: %v", err)
+			return
+		}
+		w.Added = added
+	}
 }
 
 func (w *Whitelist) Reload() error {
 	w.m.Lock()
 	defer w.m.Unlock()
 
-	if err := hosting.GetKeyFromKV(context.Background(), w.kv, "enabled", &w.Enabled); errors.Is(errors.Unwrap(err), kv.ErrKeyNotFound) {
-		w.Enabled = false
-	} else {
+	enabled, err := kv.Typed[bool](w.kv, "enabled").Get(context.Background())
+	if err != nil {
 		return err
 	}
 
-	if err := hosting.GetKeyFromKV(context.Background(), w.kv, "whitelisted", &w.Whitelisted); errors.Is(errors.Unwrap(err), kv.ErrKeyNotFound) {
-		w.Whitelisted = make([]string, 0)
-	} else if err != nil {
+	whitelisted, err := w.whitelisted().Get(context.Background())
+	if err != nil {
 		return err
 	}
 
+	added, err := w.added().Get(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w.Enabled, w.Whitelisted, w.Added = enabled, whitelisted, added
+	w.loaded = true
+	w.saveSnapshot()
+
 	return nil
 }
 
@@ -98,22 +181,30 @@ func (w *Whitelist) saveEnabled() error {
 	w.m.Lock()
 	defer w.m.Unlock()
 
-	if err := hosting.SetKeyToKV(context.Background(), w.kv, "enabled", w.Enabled); err != nil {
+	if err := kv.Typed[bool](w.kv, "enabled").Set(context.Background(), w.Enabled); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (w *Whitelist) whitelisted() *kv.TypedKey[[]string] {
+	return kv.Typed[[]string](w.kv, "whitelisted").Default(func() []string { return make([]string, 0) })
+}
+
+func (w *Whitelist) added() *kv.TypedKey[map[string]time.Time] {
+	return kv.Typed[map[string]time.Time](w.kv, "added").Default(func() map[string]time.Time { return make(map[string]time.Time) })
+}
+
 func (w *Whitelist) saveWhitelisted() error {
 	w.m.Lock()
 	defer w.m.Unlock()
 
-	if err := hosting.SetKeyToKV(context.Background(), w.kv, "whitelisted", w.Whitelisted); err != nil {
+	if err := w.whitelisted().Set(context.Background(), w.Whitelisted); err != nil {
 		return err
 	}
 
-	return nil
+	return w.added().Set(context.Background(), w.Added)
 }
 
 func (w *Whitelist) IsEnabled() bool {
@@ -142,6 +233,7 @@ func (w *Whitelist) Disable() error {
 func (w *Whitelist) Add(uuid string) error {
 	w.m.Lock()
 	w.Whitelisted = append(w.Whitelisted, uuid)
+	w.Added[uuid] = time.Now()
 	w.m.Unlock()
 
 	return w.saveWhitelisted()
@@ -152,6 +244,7 @@ func (w *Whitelist) Remove(uuid string) error {
 	w.Whitelisted = slices.DeleteFunc(w.Whitelisted, func(s string) bool {
 		return s == uuid
 	})
+	delete(w.Added, uuid)
 	w.m.Unlock()
 
 	return w.saveWhitelisted()
@@ -164,6 +257,25 @@ func (w *Whitelist) Contains(uuid string) bool {
 	return slices.Contains(w.Whitelisted, uuid)
 }
 
+// Allows reports whether the player may join. While the whitelist isn't
+// available the availability policy decides, last-known keeps using the
+// whitelist as it was.
+func (w *Whitelist) Allows(uuid string) bool {
+	w.m.RLock()
+	defer w.m.RUnlock()
+
+	if !w.loaded || !w.h.Connected(w.kv.Name()) {
+		switch w.policy {
+		case hosting.AvailabilityOpen:
+			return true
+		case hosting.AvailabilityClosed:
+			return false
+		}
+	}
+
+	return !w.Enabled || slices.Contains(w.Whitelisted, uuid)
+}
+
 func (w *Whitelist) AllWhitelisted() []string {
 	w.m.RLock()
 	defer w.m.RUnlock()
@@ -173,3 +285,13 @@ func (w *Whitelist) AllWhitelisted() []string {
 
 	return copy
 }
+
+// AddedAt returns when the UUID was added, false for entries from before add
+// dates were recorded.
+func (w *Whitelist) AddedAt(uuid string) (time.Time, bool) {
+	w.m.RLock()
+	defer w.m.RUnlock()
+
+	t, ok := w.Added[uuid]
+	return t, ok
+}
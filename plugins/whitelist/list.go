@@ -0,0 +1,231 @@
+package whitelist
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+)
+
+const listPageSize = 15
+
+const (
+	sortName   = "name"
+	sortNewest = "newest"
+	sortOldest = "oldest"
+)
+
+// listQuery is what /whitelist list shows, parsed from its arguments, e.g.
+// "steve* group:vip sort:newest page:2". A search without * matches any
+// part of the name.
+type listQuery struct {
+	search string
+	group  string
+	sort   string
+	page   int
+}
+
+func parseListQuery(args string) (listQuery, error) {
+	q := listQuery{sort: sortName, page: 1}
+
+	for _, arg := range strings.Fields(args) {
+		key, value, ok := strings.Cut(arg, ":")
+		if !ok {
+			q.search = strings.ToLower(arg)
+			continue
+		}
+
+		switch key {
+		case "group":
+			q.group = value
+		case "sort":
+			if value != sortName && value != sortNewest && value != sortOldest {
+				return q, fmt.Errorf("unknown sort %s, use name, newest or oldest", value)
+			}
+			q.sort = value
+		case "page":
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				return q, fmt.Errorf("invalid page %s", value)
+			}
+			q.page = page
+		default:
+			return q, fmt.Errorf("unknown filter %s, use group:, sort: or page:", key)
+		}
+	}
+
+	return q, nil
+}
+
+// command returns the /whitelist list command of the query on another page.
+func (q listQuery) command(page int) string {
+	args := []string{"/whitelist list"}
+	if q.search != "" {
+		args = append(args, q.search)
+	}
+	if q.group != "" {
+		args = append(args, "group:"+q.group)
+	}
+	if q.sort != sortName {
+		args = append(args, "sort:"+q.sort)
+	}
+
+	return strings.Join(append(args, "page:"+strconv.Itoa(page)), " ")
+}
+
+func (q listQuery) matches(name string) bool {
+	if q.search == "" {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	if !strings.Contains(q.search, "*") {
+		return strings.Contains(name, q.search)
+	}
+
+	ok, _ := path.Match(q.search, name)
+	return ok
+}
+
+type listEntry struct {
+	uuid  string
+	name  string
+	added time.Time
+}
+
+// list returns the entries of the query and the number of pages. Names come
+// from the profile cache, the entries of the page that aren't cached yet are
+// resolved, so the cache fills as staff page through the list.
+func (p *WhitelistPlugin) list(ctx context.Context, wl *Whitelist, q listQuery) ([]listEntry, int, error) {
+	entries := make([]listEntry, 0)
+
+	for _, id := range wl.AllWhitelisted() {
+		if q.group != "" {
+			groups, _ := p.permissions.UserGroups(id)
+			if !slices.Contains(groups, q.group) {
+				continue
+			}
+		}
+
+		e := listEntry{uuid: id}
+		e.added, _ = wl.AddedAt(id)
+
+		if profile, ok, err := p.h.Profiles().Cached(ctx, id); err != nil {
+			return nil, 0, err
+		} else if ok {
+			e.name = profile.Name
+		}
+
+		// Names that aren't cached can't be searched yet
+		if q.search != "" && (e.name == "" || !q.matches(e.name)) {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	slices.SortFunc(entries, func(a, b listEntry) int {
+		switch q.sort {
+		case sortNewest:
+			return b.added.Compare(a.added)
+		case sortOldest:
+			return a.added.Compare(b.added)
+		}
+
+		return strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name))
+	})
+
+	pages := max(1, (len(entries)+listPageSize-1)/listPageSize)
+	start := min(len(entries), (q.page-1)*listPageSize)
+	page := entries[start:min(len(entries), start+listPageSize)]
+
+	for i := range page {
+		if page[i].name != "" {
+			continue
+		}
+
+		page[i].name = page[i].uuid
+		if profile, err := p.h.Profiles().ByUUID(ctx, page[i].uuid); err == nil {
+			page[i].name = profile.Name
+		}
+	}
+
+	return page, pages, nil
+}
+
+func (p *WhitelistPlugin) listCommand() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
+			return PermissionMissingCommand().Run(c.CommandContext)
+		}
+
+		args := ""
+		if c.Arguments["query"] != nil {
+			args = c.String("query")
+		}
+
+		q, err := parseListQuery(args)
+		if err != nil {
+			return c.SendMessage(&component.Text{Content: err.Error(), S: component.Style{Color: color.Red}})
+		}
+
+		entries, pages, err := p.list(c.Context, p.source(c.Source), q)
+		if err != nil {
+			return err
+		}
+
+		lines := []component.Component{
+			&component.Text{Content: fmt.Sprintf("Whitelisted players, page %d of %d:", min(q.page, pages), pages), S: component.Style{Color: color.Green}},
+		}
+
+		if len(entries) == 0 {
+			lines = append(lines, &component.Text{Content: "\n No players match.", S: component.Style{Color: color.Gray}})
+		}
+
+		for _, e := range entries {
+			added := "unknown"
+			if !e.added.IsZero() {
+				added = e.added.Format(time.DateOnly)
+			}
+
+			lines = append(lines,
+				&component.Text{Content: "\n " + e.name, S: component.Style{
+					Color:      color.White,
+					ClickEvent: component.SuggestCommand("/whitelist remove " + e.name),
+					HoverEvent: component.ShowText(&component.Text{Content: e.uuid}),
+				}},
+				&component.Text{Content: " added " + added, S: component.Style{Color: color.Gray}},
+			)
+		}
+
+		if q.page > 1 {
+			lines = append(lines, &component.Text{Content: "\n"}, pageLink("« previous", q.command(min(q.page, pages)-1)))
+		}
+		if q.page < pages {
+			separator := "\n"
+			if q.page > 1 {
+				separator = "  "
+			}
+			lines = append(lines, &component.Text{Content: separator}, pageLink("next »", q.command(q.page+1)))
+		}
+
+		return c.SendMessage(util.Join(lines...))
+	})
+}
+
+func pageLink(label, cmd string) component.Component {
+	return &component.Text{Content: label, S: component.Style{
+		Color:      color.Yellow,
+		ClickEvent: component.RunCommand(cmd),
+		HoverEvent: component.ShowText(&component.Text{Content: cmd}),
+	}}
+}
@@ -3,11 +3,12 @@ package whitelist
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/internal/hosting"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util"
-	"github.com/Community-Sourced-Minecraft/Gate-Proxy/lib/util/uuid"
 	"github.com/Community-Sourced-Minecraft/Gate-Proxy/plugins/permissions"
 	"github.com/robinbraemer/event"
 	"go.minekube.com/brigodier"
@@ -18,47 +19,108 @@ import (
 )
 
 type WhitelistPlugin struct {
-	whitelist   *Whitelist
+	whitelist *Whitelist
+	// networks are the whitelists of every network, the primary one is
+	// whitelist
+	networks    map[string]*Whitelist
+	codes       *Codes
 	permissions *permissions.Permissions
 	h           *hosting.Hosting
 }
 
-func NewPlugin(h *hosting.Hosting, permissions *permissions.Permissions) (*WhitelistPlugin, error) {
-	whitelist, err := NewKVWhitelist(context.Background(), h)
+func NewPlugin(ctx context.Context, h *hosting.Hosting, whitelist *Whitelist, permissions *permissions.Permissions) (*WhitelistPlugin, error) {
+	codes, err := NewKVCodes(ctx, h, whitelist)
 	if err != nil {
 		return nil, err
 	}
 
+	networks := map[string]*Whitelist{h.PrimaryNetwork().Name: whitelist}
+	for _, nw := range h.Networks() {
+		if nw.Primary() {
+			continue
+		}
+
+		if networks[nw.Name], err = NewKVNetworkWhitelist(ctx, h, nw); err != nil {
+			return nil, err
+		}
+	}
+
 	return &WhitelistPlugin{
 		whitelist:   whitelist,
+		networks:    networks,
+		codes:       codes,
 		permissions: permissions,
 		h:           h,
 	}, nil
 }
 
 func (p *WhitelistPlugin) Reload() error {
-	if err := p.whitelist.Reload(); err != nil {
-		return err
+	for _, wl := range p.networks {
+		if err := wl.Reload(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (p *WhitelistPlugin) Init(prx *proxy.Proxy) error {
-	if err := p.Reload(); err != nil {
-		return err
+// of returns the whitelist of the network the player joined.
+func (p *WhitelistPlugin) of(player proxy.Player) *Whitelist {
+	if wl, ok := p.networks[p.h.PlayerNetwork(player.ID()).Name]; ok {
+		return wl
 	}
 
-	event.Subscribe(prx.Event(), 0, p.onPostConnectEvent)
+	return p.whitelist
+}
+
+// source returns the whitelist commands of the source act on, that of the
+// network of a player and the primary one for the console.
+func (p *WhitelistPlugin) source(src command.Source) *Whitelist {
+	if player, ok := src.(proxy.Player); ok {
+		return p.of(player)
+	}
+
+	return p.whitelist
+}
+
+func (p *WhitelistPlugin) Init(prx *proxy.Proxy) error {
+	event.Subscribe(prx.Event(), 0, hosting.Guard(p.h, "Whitelist", p.onPostConnectEvent))
 	prx.Command().Register(p.command())
+	p.h.API().HandleFunc("POST /whitelist/redeem", p.codes.handleRedeem)
+	p.registerAPI()
+	p.h.OnReload("Whitelist", func(ctx context.Context) error {
+		return p.Reload()
+	})
+	p.h.Go("Whitelist", p.prune)
 
 	return nil
 }
 
+// prune deletes expired codes and their redeemed markers.
+func (p *WhitelistPlugin) prune(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := p.codes.Prune(ctx, now); err != nil {
+				log.Printf("Failed to prune whitelist codes: %v", err)
+			}
+		}
+	}
+}
+
 func (p *WhitelistPlugin) onPostConnectEvent(e *proxy.ServerPostConnectEvent) {
 	uuid := e.Player().GameProfile().ID
+	wl := p.of(e.Player())
+
+	allowed := wl.Allows(strings.Replace(uuid.String(), "-", "", -1))
+	p.h.Tracef(e.Player().Username(), "whitelist: enabled %t, allows %t", wl.IsEnabled(), allowed)
 
-	if !p.whitelist.Contains(strings.Replace(uuid.String(), "-", "", -1)) && p.whitelist.IsEnabled() {
+	if !allowed && p.h.Enforce("Whitelist", "not_whitelisted", e.Player().Username()) {
 		e.Player().Disconnect(&component.Text{
 			Content: "You are not whitelisted!",
 			S:       component.Style{Color: color.Red},
@@ -66,11 +128,11 @@ func (p *WhitelistPlugin) onPostConnectEvent(e *proxy.ServerPostConnectEvent) {
 	}
 }
 
-func New(h *hosting.Hosting, permissions *permissions.Permissions) (proxy.Plugin, error) {
+func New(h *hosting.Hosting, whitelist *Whitelist, permissions *permissions.Permissions) (proxy.Plugin, error) {
 	return proxy.Plugin{
 		Name: "Whitelist",
 		Init: func(ctx context.Context, px *proxy.Proxy) error {
-			plugin, err := NewPlugin(h, permissions)
+			plugin, err := NewPlugin(ctx, h, whitelist, permissions)
 			if err != nil {
 				return err
 			}
@@ -96,10 +158,16 @@ func (p *WhitelistPlugin) command() brigodier.LiteralNodeBuilder {
 			Executes(p.disableCommand())).
 		Then(brigodier.
 			Literal("list").
-			Executes(p.listCommand())).
+			Executes(p.listCommand()).
+			Then(brigodier.
+				Argument("query", brigodier.StringPhrase).
+				Executes(p.listCommand()))).
 		Then(brigodier.
 			Literal("reload").
 			Executes(p.reloadCommand())).
+		Then(brigodier.
+			Literal("requestcode").
+			Executes(p.requestCodeCommand())).
 		Then(brigodier.
 			Literal("add").
 			Executes(p.UsageWhitelist()).
@@ -117,10 +185,10 @@ func (p *WhitelistPlugin) command() brigodier.LiteralNodeBuilder {
 }
 
 func (p *WhitelistPlugin) UsageWhitelist() brigodier.Command {
-	usage := component.Text{Content: "Usage: /whitelist <add/remove/enable/disable> <user>", S: component.Style{Color: color.Red}}
+	usage := component.Text{Content: "Usage: /whitelist <add/remove/enable/disable/requestcode> <user>", S: component.Style{Color: color.Red}}
 
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
 		return c.SendMessage(&usage)
@@ -140,25 +208,26 @@ func PermissionMissingCommand() brigodier.Command {
 
 func (p *WhitelistPlugin) addCommand() brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
+		wl := p.source(c.Source)
 
 		username := c.Arguments["user"].Result.(string)
-		uuid, err := uuid.UsernameToUUID(username)
+		uuid, err := p.h.Profiles().ID(c.Context, username)
 
 		if err != nil {
 			return p.UsageWhitelist().Run(c.CommandContext)
 		}
 
-		if p.whitelist.Contains(uuid) {
+		if wl.Contains(uuid) {
 			return c.SendMessage(&component.Text{
 				Content: username + " is already on whitelist!",
 				S:       component.Style{Color: color.Red},
 			})
 		}
 
-		if err := p.whitelist.Add(uuid); err != nil {
+		if err := wl.Add(uuid); err != nil {
 			return err
 		}
 
@@ -168,24 +237,25 @@ func (p *WhitelistPlugin) addCommand() brigodier.Command {
 
 func (p *WhitelistPlugin) removeCommand() brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
+		wl := p.source(c.Source)
 		username := c.Arguments["user"].Result.(string)
-		uuid, err := uuid.UsernameToUUID(username)
+		uuid, err := p.h.Profiles().ID(c.Context, username)
 
 		if err != nil {
 			return p.UsageWhitelist().Run(c.CommandContext)
 		}
 
-		if !p.whitelist.Contains(uuid) {
+		if !wl.Contains(uuid) {
 			return c.SendMessage(&component.Text{
 				Content: username + " is not on whitelist!",
 				S:       component.Style{Color: color.Red},
 			})
 		}
 
-		if err := p.whitelist.Remove(uuid); err != nil {
+		if err := wl.Remove(uuid); err != nil {
 			return err
 		}
 
@@ -197,11 +267,12 @@ func (p *WhitelistPlugin) reloadCommand() brigodier.Command {
 	reloaded := component.Text{Content: "Reloaded command successfully!", S: component.Style{Color: color.Green}}
 
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
+		wl := p.source(c.Source)
 
-		if err := p.whitelist.Reload(); err != nil {
+		if err := wl.Reload(); err != nil {
 			return err
 		}
 
@@ -209,30 +280,35 @@ func (p *WhitelistPlugin) reloadCommand() brigodier.Command {
 	})
 }
 
-func (p *WhitelistPlugin) listCommand() brigodier.Command {
+func (p *WhitelistPlugin) requestCodeCommand() brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.requestcode") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
-		users := strings.Builder{}
 
-		for i, id := range p.whitelist.AllWhitelisted() {
-			str, err := uuid.UUIDtoUsername(id) // sorry mojank
-			if err != nil {
-				str = id
-			}
-
-			if i != 0 {
-				users.WriteString(", ")
-			}
+		createdBy := "console"
+		if player, ok := c.Source.(proxy.Player); ok {
+			createdBy = player.Username()
+		}
 
-			users.WriteString(str)
+		code, err := p.codes.Generate(c.Context, createdBy)
+		if err != nil {
+			return err
 		}
 
-		return c.SendMessage(&component.Text{
-			Content: fmt.Sprintf("Whitelisted users (%d): %s", len(p.whitelist.AllWhitelisted()), users.String()),
-			S:       component.Style{Color: color.Green},
-		})
+		return c.SendMessage(util.Join(
+			&component.Text{Content: "Generated whitelist code ", S: component.Style{Color: color.Green}},
+			&component.Text{
+				Content: code,
+				S: component.Style{
+					Color:      color.Yellow,
+					Bold:       component.True,
+					ClickEvent: component.CopyToClipboard(code),
+					HoverEvent: component.ShowText(&component.Text{Content: "Click to copy"}),
+				},
+			},
+			&component.Text{Content: fmt.Sprintf(" (valid for %s)", codeExpiresIn), S: component.Style{Color: color.Gray}},
+		))
 	})
 }
 
@@ -241,14 +317,15 @@ func (p *WhitelistPlugin) enableCommand() brigodier.Command {
 	enabled := component.Text{Content: "Enabled whitelist!", S: component.Style{Color: color.Green}}
 
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
-		if p.whitelist.IsEnabled() {
+		wl := p.source(c.Source)
+		if wl.IsEnabled() {
 			return c.SendMessage(&alreadyEnabled)
 		}
 
-		if err := p.whitelist.Enable(); err != nil {
+		if err := wl.Enable(); err != nil {
 			return err
 		}
 
@@ -261,14 +338,15 @@ func (p *WhitelistPlugin) disableCommand() brigodier.Command {
 	disabled := component.Text{Content: "Disabled whitelist!", S: component.Style{Color: color.Green}}
 
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
-		if !p.whitelist.IsEnabled() {
+		wl := p.source(c.Source)
+		if !wl.IsEnabled() {
 			return c.SendMessage(&alreadyDisabled)
 		}
 
-		if err := p.whitelist.Disable(); err != nil {
+		if err := wl.Disable(); err != nil {
 			return err
 		}
 
@@ -282,11 +360,12 @@ func (p *WhitelistPlugin) statusCommand() brigodier.Command {
 	disabled := component.Text{Content: "disabled", S: component.Style{Color: color.Red}}
 
 	return command.Command(func(c *command.Context) error {
-		if !p.permissions.UserHasPermission(c.Source.(proxy.Player).ID().String(), "whitelist.add") {
+		if !p.permissions.SourceHasPermission(c.Source, "whitelist.add") {
 			return PermissionMissingCommand().Run(c.CommandContext)
 		}
+		wl := p.source(c.Source)
 		var state component.Text
-		if p.whitelist.IsEnabled() {
+		if wl.IsEnabled() {
 			state = enabled
 		} else {
 			state = disabled